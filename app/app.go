@@ -2,16 +2,26 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
 	"path/filepath"
 	"syscall"
+	"time"
 
+	"github.com/neoden/mykb/backup"
 	"github.com/neoden/mykb/config"
 	"github.com/neoden/mykb/embedding"
+	"github.com/neoden/mykb/events"
 	"github.com/neoden/mykb/httpd"
+	"github.com/neoden/mykb/llm"
 	"github.com/neoden/mykb/mcp"
+	"github.com/neoden/mykb/rerank"
 	"github.com/neoden/mykb/storage"
+	"github.com/neoden/mykb/transcribe"
 	"github.com/neoden/mykb/vector"
 	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/term"
@@ -24,15 +34,64 @@ type App struct {
 	Embedder embedding.EmbeddingProvider
 	Index    *vector.Index
 	MCP      *mcp.Server
+	Events   *events.Bus
+
+	scratch string // holds the data dir's files for a database in memory
 }
 
 // New creates and initializes all application components.
 func New(cfg *config.Config) (*App, error) {
-	db, err := storage.Init(cfg.DataDir)
+	var db *storage.DB
+	var err error
+	var scratch string
+	if cfg.DataDir == storage.Memory {
+		// Files otherwise kept beside data.db (the admin token, backups,
+		// certificates) go to a directory removed on Close
+		if scratch, err = os.MkdirTemp("", "mykb-memory-"); err != nil {
+			return nil, fmt.Errorf("create scratch directory: %w", err)
+		}
+		db, err = storage.Init(storage.Memory)
+		cfg.DataDir = scratch
+	} else if cfg.Storage.ReadOnly {
+		db, err = storage.InitReadOnly(cfg.DataDir)
+	} else {
+		// Litestream checkpoints the WAL itself and loses track of it if
+		// SQLite checkpoints behind its back
+		r := cfg.Backup.Replication
+		opts := storage.Options{ExternalCheckpoints: r.Enabled && r.Litestream.Enabled()}
+		db, err = storage.InitWithOptions(cfg.DataDir, opts)
+	}
 	if err != nil {
+		removeScratch(scratch)
 		return nil, err
 	}
-	log.Printf("Database ready: %s", cfg.DataDir)
+	if err := db.ConfigureEncryption(cfg.Storage); err != nil {
+		db.Close()
+		removeScratch(scratch)
+		return nil, fmt.Errorf("encryption: %w", err)
+	}
+	if err := db.ConfigureSearch(cfg.Search); err != nil {
+		db.Close()
+		removeScratch(scratch)
+		return nil, fmt.Errorf("search: %w", err)
+	}
+	switch {
+	case db.InMemory():
+		log.Printf("Database ready: in memory, discarded on exit")
+	case db.ReadOnly():
+		log.Printf("Database ready: %s (read-only mirror)", cfg.DataDir)
+	case db.Encrypted():
+		log.Printf("Database ready: %s (encrypted)", cfg.DataDir)
+	default:
+		log.Printf("Database ready: %s", cfg.DataDir)
+	}
+	if !db.ReadOnly() {
+		if err := db.BackfillLinks(context.Background()); err != nil {
+			db.Close()
+			removeScratch(scratch)
+			return nil, fmt.Errorf("links: %w", err)
+		}
+	}
 
 	embedder, err := embedding.New(cfg.Embedding)
 	if err != nil {
@@ -40,8 +99,41 @@ func New(cfg *config.Config) (*App, error) {
 		// Not fatal - embedder is optional
 	}
 
-	index := loadVectorIndex(db, embedder)
-	mcpServer := mcp.NewServer(db, embedder, index)
+	index := loadVectorIndex(context.Background(), db, embedder, cfg.Index, filepath.Join(cfg.DataDir, snapshotFile))
+	mcpConfig := mcp.DefaultConfig()
+	mcpConfig.MetadataFields = cfg.Embedding.MetadataFields
+	mcpConfig.ReembedOnMetadata = cfg.Embedding.ReembedOnMetadata
+	mcpConfig.Events = events.NewBus()
+	mcpConfig.QueryTimeout = cfg.Embedding.QueryTimeout()
+	mcpConfig.QueryCacheSize = cfg.Embedding.QueryCacheEntries()
+	mcpConfig.QueryCacheTTL = cfg.Embedding.QueryCacheTTL()
+	mcpConfig.IngestTimeout = cfg.Embedding.IngestTimeout()
+	mcpConfig.DeferOnTimeout = cfg.Embedding.DeferOnTimeout
+	mcpConfig.RateLimit = cfg.RateLimit
+	mcpConfig.Ranking = cfg.Ranking
+	if mcpConfig.Reranker, err = rerank.New(cfg.Rerank); err != nil {
+		log.Printf("Reranking disabled: %v", err)
+	}
+	mcpConfig.RerankTopN = cfg.Rerank.Candidates()
+	mcpConfig.RerankTimeout = cfg.Rerank.Timeout()
+	mcpConfig.Sessions = cfg.Sessions
+	mcpConfig.Ingest = cfg.Ingest
+	mcpConfig.Unfurl = cfg.Unfurl
+	mcpConfig.Daily = cfg.Daily
+	if mcpConfig.LLM, err = llm.New(cfg.LLM); err != nil {
+		log.Printf("Language model disabled: %v", err)
+	}
+	mcpConfig.LLMTimeout = cfg.LLM.Timeout()
+	mcpConfig.Enrich = cfg.Enrich
+	mcpConfig.Entities = cfg.Entities
+	if mcpConfig.Transcriber, err = transcribe.New(cfg.Transcription); err != nil {
+		log.Printf("Audio transcription disabled: %v", err)
+	}
+	mcpConfig.TranscribeTimeout = cfg.Transcription.Timeout()
+	mcpConfig.Recording = cfg.Recording
+	mcpConfig.Review = cfg.Review
+	mcpConfig.ReadOnly = db.ReadOnly()
+	mcpServer := mcp.NewServerWithConfig(db, embedder, index, mcpConfig)
 
 	return &App{
 		Config:   cfg,
@@ -49,17 +141,92 @@ func New(cfg *config.Config) (*App, error) {
 		Embedder: embedder,
 		Index:    index,
 		MCP:      mcpServer,
+		Events:   mcpConfig.Events,
+		scratch:  scratch,
 	}, nil
 }
 
 // Close releases all resources.
 func (a *App) Close() error {
-	return a.DB.Close()
+	err := a.DB.Close()
+	removeScratch(a.scratch)
+	return err
+}
+
+func removeScratch(dir string) {
+	if dir != "" {
+		os.RemoveAll(dir)
+	}
 }
 
 // ServeStdio runs the MCP server over stdio.
 func (a *App) ServeStdio() error {
-	return a.MCP.ServeStdio()
+	_, stop, err := a.startReplication()
+	if err != nil {
+		return err
+	}
+	defer stop()
+	defer a.saveIndexSnapshot()
+	defer a.startRanking()()
+	defer a.startRetention()()
+	defer a.startExpiry()()
+	defer a.startReview()()
+	defer a.startStats()()
+	defer a.startMaintenance()()
+	defer a.startReembed()()
+	defer a.startEmbeddingQueue()()
+	defer a.startMirror()()
+	defer a.startGitMirror()()
+	return serveUntilSignal(a.MCP.ServeStdio, nil)
+}
+
+// serveUntilSignal runs serve until it returns or the process is asked to
+// stop, so that the caller's deferred shutdown work runs either way. On a
+// signal it calls shutdown, if given, to let serve finish gracefully.
+func serveUntilSignal(serve func() error, shutdown func(context.Context) error) error {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	done := make(chan error, 1)
+	go func() { done <- serve() }()
+	select {
+	case err := <-done:
+		return err
+	case sig := <-sigs:
+		log.Printf("Received %s, shutting down", sig)
+	}
+	if shutdown == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := shutdown(ctx); err != nil {
+		return err
+	}
+	if err := <-done; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// startRanking keeps chunk importance scores fresh in the background and
+// returns a function that stops it.
+func (a *App) startRanking() func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	go a.MCP.RunRanking(ctx)
+	return cancel
+}
+
+// startEmbeddingQueue retries failed embeddings in the background and
+// returns a function that stops it.
+func (a *App) startEmbeddingQueue() func() {
+	if a.Embedder == nil || a.DB.ReadOnly() {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go a.MCP.RunEmbeddingQueue(ctx)
+	return cancel
 }
 
 // ServeHTTP runs the HTTP server.
@@ -74,8 +241,8 @@ func (a *App) ServeHTTP() error {
 		listen = ":8080"
 	}
 
-	// Check password is set
-	if _, err := a.DB.GetPasswordHash(); err != nil {
+	// Check password is set (not needed when login is delegated to an identity provider)
+	if _, err := a.DB.GetPasswordHash(context.Background()); err != nil && !a.Config.Server.OIDC.Enabled() {
 		return fmt.Errorf("password not set; run: mykb set-password")
 	}
 
@@ -83,6 +250,35 @@ func (a *App) ServeHTTP() error {
 	httpConfig.Domain = domain
 	httpConfig.CertCache = filepath.Join(a.Config.DataDir, "certs")
 	httpConfig.BehindProxy = a.Config.Server.BehindProxy
+	httpConfig.ProxyProtocol = a.Config.Server.ProxyProtocol
+	trusted, err := httpd.ParseTrustedProxies(a.Config.Server.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	httpConfig.TrustedProxies = trusted
+	httpConfig.JWTAccessTokens = a.Config.Server.AccessTokenFormat == "jwt"
+	httpConfig.OIDC = a.Config.Server.OIDC
+	httpConfig.Hooks = a.Config.Server.Hooks
+	httpConfig.MaxAttachmentSize = a.Config.Attachments.MaxBytes()
+	httpConfig.Events = a.Events
+	httpConfig.ReadOnly = a.DB.ReadOnly()
+	adminToken, err := a.writeAdminToken()
+	if err != nil {
+		return err
+	}
+	httpConfig.AdminToken = adminToken
+	httpConfig.BackupDir = a.backupDir()
+	httpConfig.Maintainer = a
+	if a.Config.Backup.S3.Enabled() {
+		remote, err := backup.NewRemote(a.Config.Backup.S3)
+		if err != nil {
+			return fmt.Errorf("remote backup: %w", err)
+		}
+		httpConfig.BackupUploader = remote
+	}
+	if days := a.Config.Server.KeyRotationDays; days > 0 {
+		httpConfig.KeyRotation = time.Duration(days) * 24 * time.Hour
+	}
 
 	if domain != "" {
 		httpConfig.BaseURL = "https://" + domain
@@ -92,12 +288,31 @@ func (a *App) ServeHTTP() error {
 		log.Printf("Starting HTTP server on %s (dev mode)", httpConfig.Listen)
 	}
 
+	monitor, stop, err := a.startReplication()
+	if err != nil {
+		return err
+	}
+	defer stop()
+	defer a.saveIndexSnapshot()
+	defer a.startRanking()()
+	defer a.startRetention()()
+	defer a.startExpiry()()
+	defer a.startReview()()
+	defer a.startStats()()
+	defer a.startMaintenance()()
+	defer a.startReembed()()
+	defer a.startEmbeddingQueue()()
+	defer a.startMirror()()
+	defer a.startGitMirror()()
+	httpConfig.Replication = monitor
+	httpConfig.MaxReplicationLag = a.Config.Backup.Replication.MaxLag()
+
 	server := httpd.NewServer(a.DB, a.MCP, httpConfig)
-	return server.ListenAndServe()
+	return serveUntilSignal(server.ListenAndServe, server.Shutdown)
 }
 
 // SetPassword prompts for and sets the authentication password.
-func (a *App) SetPassword() error {
+func (a *App) SetPassword(ctx context.Context) error {
 	fmt.Print("Enter password: ")
 	password1, err := term.ReadPassword(int(syscall.Stdin))
 	fmt.Println()
@@ -125,7 +340,7 @@ func (a *App) SetPassword() error {
 		return fmt.Errorf("hash password: %w", err)
 	}
 
-	if err := a.DB.SetPasswordHash(string(hash)); err != nil {
+	if err := a.DB.SetPasswordHash(ctx, string(hash)); err != nil {
 		return fmt.Errorf("save password: %w", err)
 	}
 
@@ -133,86 +348,43 @@ func (a *App) SetPassword() error {
 	return nil
 }
 
-// Reindex generates embeddings for chunks.
-// If force is true, re-indexes all chunks. Otherwise only chunks without embeddings.
-func (a *App) Reindex(ctx context.Context, force bool) error {
-	if a.Embedder == nil {
-		return fmt.Errorf("embedding provider not configured")
-	}
-
-	var chunks []storage.Chunk
-	var err error
-
-	if force {
-		chunks, err = a.DB.GetAllChunks()
-		if err != nil {
-			return fmt.Errorf("get chunks: %w", err)
-		}
-		if len(chunks) == 0 {
-			log.Println("No chunks to index")
-			return nil
-		}
-		log.Printf("Re-indexing all %d chunks with %s", len(chunks), a.Embedder.Model())
-	} else {
-		chunks, err = a.DB.GetChunksWithoutEmbeddings(a.Embedder.Model())
-		if err != nil {
-			return fmt.Errorf("get chunks: %w", err)
-		}
-		if len(chunks) == 0 {
-			log.Println("All chunks already have embeddings for this model")
-			return nil
-		}
-		log.Printf("Indexing %d chunks with %s", len(chunks), a.Embedder.Model())
+// Encrypt encrypts chunks and embeddings written before encryption was enabled.
+func (a *App) Encrypt(ctx context.Context) error {
+	if !a.DB.Encrypted() {
+		return fmt.Errorf("encryption not configured: set [storage] encryption_key_file or encryption_passphrase_env")
 	}
-
-	const batchSize = 100
-
-	for i := 0; i < len(chunks); i += batchSize {
-		end := min(i+batchSize, len(chunks))
-		batch := chunks[i:end]
-
-		texts := make([]string, len(batch))
-		for j, chunk := range batch {
-			texts[j] = chunk.Content
-		}
-
-		vecs, err := a.Embedder.Embed(ctx, texts)
-		if err != nil {
-			log.Printf("Error embedding batch %d-%d: %v", i+1, end, err)
-			continue
-		}
-
-		saved := 0
-		for j, chunk := range batch {
-			if j >= len(vecs) || vecs[j] == nil {
-				log.Printf("No embedding returned for chunk %s", chunk.ID)
-				continue
-			}
-			if err := a.DB.SaveEmbedding(chunk.ID, a.Embedder.Model(), vecs[j]); err != nil {
-				log.Printf("Error saving embedding for chunk %s: %v", chunk.ID, err)
-				continue
-			}
-			saved++
-		}
-		log.Printf("[%d-%d/%d] Indexed %d chunks", i+1, end, len(chunks), saved)
+	n, err := a.DB.EncryptAll(ctx, a.Config.Embedding.MetadataFields)
+	if err != nil {
+		return err
 	}
-
-	log.Println("Done")
+	fmt.Printf("Encrypted %d chunks.\n", n)
 	return nil
 }
 
-func loadVectorIndex(db *storage.DB, embedder embedding.EmbeddingProvider) *vector.Index {
-	idx := vector.NewIndex()
-	if embedder == nil {
-		return idx
+// Compact reports reclaimable space and, unless dryRun, returns it to the
+// filesystem with an incremental vacuum.
+func (a *App) Compact(ctx context.Context, dryRun bool) error {
+	r, err := a.DB.SpaceReport(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Database size: %d bytes, reclaimable: %d bytes (%d free pages)\n",
+		r.FileBytes, r.ReclaimableBytes, r.FreePages)
+
+	if dryRun || r.FreePages == 0 {
+		return nil
 	}
-	model := embedder.Model()
-	vecs, err := db.LoadEmbeddingsByModel(model)
+	if !r.Incremental {
+		return fmt.Errorf("auto_vacuum is not INCREMENTAL; run VACUUM manually")
+	}
+	if err := a.DB.IncrementalVacuum(ctx, 0); err != nil {
+		return err
+	}
+
+	after, err := a.DB.SpaceReport(ctx)
 	if err != nil {
-		log.Printf("Failed to load embeddings: %v", err)
-		return idx
+		return err
 	}
-	idx.Load(vecs)
-	log.Printf("Loaded %d embeddings for model %s", len(vecs), model)
-	return idx
+	fmt.Printf("Reclaimed %d bytes.\n", r.FileBytes-after.FileBytes)
+	return nil
 }
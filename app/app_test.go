@@ -2,10 +2,13 @@ package app
 
 import (
 	"context"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/neoden/mykb/config"
 	"github.com/neoden/mykb/storage"
+	"github.com/neoden/mykb/vector"
 )
 
 type mockEmbedder struct{}
@@ -45,6 +48,32 @@ func TestNew(t *testing.T) {
 	// Embedder is nil when not configured - that's OK
 }
 
+func TestNewInMemory(t *testing.T) {
+	cfg := &config.Config{DataDir: storage.Memory}
+	a, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if !a.DB.InMemory() {
+		t.Error("database should be in memory")
+	}
+	if _, _, err := a.Add(context.Background(), "throwaway", nil); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	// The data dir's files go to a scratch directory, removed on Close
+	scratch := cfg.DataDir
+	if _, err := os.Stat(scratch); err != nil {
+		t.Fatalf("scratch directory: %v", err)
+	}
+	if err := a.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if _, err := os.Stat(scratch); !os.IsNotExist(err) {
+		t.Errorf("scratch directory not removed: %v", err)
+	}
+}
+
 func TestNewWithInvalidDataDir(t *testing.T) {
 	cfg := &config.Config{
 		DataDir: "/nonexistent/readonly/path/that/cannot/be/created",
@@ -95,6 +124,7 @@ func TestLoadVectorIndexWithoutEmbedder(t *testing.T) {
 }
 
 func TestLoadVectorIndexWithEmbeddings(t *testing.T) {
+	ctx := context.Background()
 	dir := t.TempDir()
 
 	// Create DB and add some embeddings
@@ -104,7 +134,7 @@ func TestLoadVectorIndexWithEmbeddings(t *testing.T) {
 	}
 
 	// Create a chunk first
-	chunk, err := db.CreateChunk("test content", nil)
+	chunk, err := db.CreateChunk(ctx, "test content", nil)
 	if err != nil {
 		t.Fatalf("CreateChunk: %v", err)
 	}
@@ -112,7 +142,7 @@ func TestLoadVectorIndexWithEmbeddings(t *testing.T) {
 	// Save embedding
 	embedder := &mockEmbedder{}
 	vec := []float32{0.1, 0.2, 0.3}
-	if err := db.SaveEmbedding(chunk.ID, embedder.Model(), vec); err != nil {
+	if err := db.SaveEmbedding(ctx, chunk.ID, embedder.Model(), chunk.Content, vec); err != nil {
 		t.Fatalf("SaveEmbedding: %v", err)
 	}
 	db.Close()
@@ -124,13 +154,14 @@ func TestLoadVectorIndexWithEmbeddings(t *testing.T) {
 	}
 	defer db2.Close()
 
-	idx := loadVectorIndex(db2, embedder)
+	idx := loadVectorIndex(ctx, db2, embedder, vector.Config{}, "")
 	if idx.Size() != 1 {
 		t.Errorf("Index size = %d, want 1", idx.Size())
 	}
 }
 
 func TestLoadVectorIndexDBError(t *testing.T) {
+	ctx := context.Background()
 	dir := t.TempDir()
 
 	db, err := storage.Init(dir)
@@ -140,7 +171,7 @@ func TestLoadVectorIndexDBError(t *testing.T) {
 	db.Close() // Close DB to cause error
 
 	embedder := &mockEmbedder{}
-	idx := loadVectorIndex(db, embedder)
+	idx := loadVectorIndex(ctx, db, embedder, vector.Config{}, "")
 
 	// Should return empty index on error
 	if idx == nil {
@@ -165,6 +196,7 @@ func TestReindexNoEmbedder(t *testing.T) {
 }
 
 func TestReindexNoChunks(t *testing.T) {
+	ctx := context.Background()
 	dir := t.TempDir()
 
 	db, err := storage.Init(dir)
@@ -173,7 +205,7 @@ func TestReindexNoChunks(t *testing.T) {
 	}
 
 	embedder := &mockEmbedder{}
-	a := &App{DB: db, Embedder: embedder, Index: loadVectorIndex(db, embedder)}
+	a := &App{DB: db, Embedder: embedder, Index: loadVectorIndex(ctx, db, embedder, vector.Config{}, "")}
 	defer a.Close()
 
 	err = a.Reindex(context.Background(), false)
@@ -183,6 +215,7 @@ func TestReindexNoChunks(t *testing.T) {
 }
 
 func TestReindexWithChunks(t *testing.T) {
+	ctx := context.Background()
 	dir := t.TempDir()
 
 	db, err := storage.Init(dir)
@@ -191,11 +224,11 @@ func TestReindexWithChunks(t *testing.T) {
 	}
 
 	// Create chunks
-	db.CreateChunk("test content 1", nil)
-	db.CreateChunk("test content 2", nil)
+	db.CreateChunk(ctx, "test content 1", nil)
+	db.CreateChunk(ctx, "test content 2", nil)
 
 	embedder := &mockEmbedder{}
-	a := &App{DB: db, Embedder: embedder, Index: loadVectorIndex(db, embedder)}
+	a := &App{DB: db, Embedder: embedder, Index: loadVectorIndex(ctx, db, embedder, vector.Config{}, "")}
 	defer a.Close()
 
 	err = a.Reindex(context.Background(), false)
@@ -204,11 +237,12 @@ func TestReindexWithChunks(t *testing.T) {
 	}
 
 	// Check embeddings were created
-	emb, err := db.GetEmbedding("test-id") // This won't work, need to check differently
+	emb, err := db.GetEmbedding(ctx, "test-id") // This won't work, need to check differently
 	_ = emb
 }
 
 func TestReindexForce(t *testing.T) {
+	ctx := context.Background()
 	dir := t.TempDir()
 
 	db, err := storage.Init(dir)
@@ -217,11 +251,11 @@ func TestReindexForce(t *testing.T) {
 	}
 
 	// Create chunk with existing embedding
-	chunk, _ := db.CreateChunk("test content", nil)
-	db.SaveEmbedding(chunk.ID, "old/model", []float32{1, 2, 3})
+	chunk, _ := db.CreateChunk(ctx, "test content", nil)
+	db.SaveEmbedding(ctx, chunk.ID, "old/model", chunk.Content, []float32{1, 2, 3})
 
 	embedder := &mockEmbedder{}
-	a := &App{DB: db, Embedder: embedder, Index: loadVectorIndex(db, embedder)}
+	a := &App{DB: db, Embedder: embedder, Index: loadVectorIndex(ctx, db, embedder, vector.Config{}, "")}
 	defer a.Close()
 
 	// Force reindex should re-embed
@@ -230,3 +264,24 @@ func TestReindexForce(t *testing.T) {
 		t.Errorf("Reindex force: %v", err)
 	}
 }
+
+func TestCompact(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	db, err := storage.Init(dir)
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	a := &App{DB: db}
+	defer a.Close()
+
+	db.CreateChunk(ctx, strings.Repeat("x", 100000), nil)
+
+	if err := a.Compact(ctx, true); err != nil {
+		t.Errorf("Compact dry run: %v", err)
+	}
+	if err := a.Compact(ctx, false); err != nil {
+		t.Errorf("Compact: %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/neoden/mykb/backup"
+	"github.com/neoden/mykb/httpd"
+	"github.com/neoden/mykb/storage"
+)
+
+// Backup writes an online backup of the database to path and, with remote,
+// uploads it to the configured bucket. An empty path writes into the
+// backups directory under the data directory.
+func (a *App) Backup(ctx context.Context, path string, remote bool) error {
+	var uploader *backup.Remote
+	if remote {
+		if !a.Config.Backup.S3.Enabled() {
+			return fmt.Errorf("remote backup not configured; set [backup.s3] in config")
+		}
+		var err error
+		if uploader, err = backup.NewRemote(a.Config.Backup.S3); err != nil {
+			return err
+		}
+	}
+
+	if path == "" {
+		dir := a.backupDir()
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("create backup directory: %w", err)
+		}
+		path = filepath.Join(dir, backup.FileName(time.Now()))
+	}
+	if err := a.checkNotLive(path); err != nil {
+		return err
+	}
+	if err := a.DB.Backup(ctx, path); err != nil {
+		return err
+	}
+	fmt.Printf("Backup written to %s\n", path)
+
+	if uploader != nil {
+		key, err := uploader.Upload(ctx, path)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Uploaded to s3://%s/%s\n", a.Config.Backup.S3.Bucket, key)
+	}
+	return nil
+}
+
+// backupDir is where backups are written by default.
+func (a *App) backupDir() string {
+	return filepath.Join(a.Config.DataDir, "backups")
+}
+
+// Restore replaces the database with the backup at path. The backup is
+// verified first, a non-empty database is only replaced with force, and the
+// current contents are saved next to the database before being overwritten.
+func (a *App) Restore(ctx context.Context, path string, force bool) error {
+	if err := a.checkNotLive(path); err != nil {
+		return err
+	}
+	info, err := storage.CheckBackup(ctx, path, a.Config.Storage)
+	if err != nil {
+		return fmt.Errorf("invalid backup: %w", err)
+	}
+
+	current, err := a.DB.CountChunks(ctx)
+	if err != nil {
+		return err
+	}
+	if current > 0 && !force {
+		return fmt.Errorf("database has %d chunks; use --force to replace them", current)
+	}
+
+	saved := filepath.Join(a.Config.DataDir, "data.db.pre-restore-"+time.Now().UTC().Format("20060102T150405Z"))
+	if err := a.DB.Backup(ctx, saved); err != nil {
+		return fmt.Errorf("save current database: %w", err)
+	}
+	fmt.Printf("Current database saved to %s\n", saved)
+
+	if err := a.DB.Restore(ctx, path); err != nil {
+		return err
+	}
+	if err := a.DB.ConfigureEncryption(a.Config.Storage); err != nil {
+		return fmt.Errorf("encryption: %w", err)
+	}
+
+	fmt.Printf("Restored %d chunks from %s. Restart any running server.\n", info.Chunks, path)
+	return nil
+}
+
+// checkNotLive refuses paths that point at the live database file.
+func (a *App) checkNotLive(path string) error {
+	live, err := filepath.Abs(filepath.Join(a.Config.DataDir, "data.db"))
+	if err != nil {
+		return err
+	}
+	target, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if target == live {
+		return fmt.Errorf("%s is the live database", path)
+	}
+	if fi, err := os.Stat(target); err == nil && fi.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	return nil
+}
+
+// RestoreAt replaces the database with its state at time at, rebuilt from
+// the continuous replica. It is otherwise the same as Restore.
+func (a *App) RestoreAt(ctx context.Context, at time.Time, force bool) error {
+	if !a.Config.Backup.S3.Enabled() {
+		return fmt.Errorf("remote backup not configured; set [backup.s3] in config")
+	}
+	tmp := filepath.Join(a.Config.DataDir, "data.db.pitr")
+	defer func() {
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			os.Remove(tmp + suffix)
+		}
+	}()
+
+	restoredTo, err := backup.RestoreReplica(ctx, a.Config.Backup.S3, tmp, at)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Rebuilt replica as of %s\n", restoredTo.UTC().Format(time.RFC3339))
+	return a.Restore(ctx, tmp, force)
+}
+
+// startReplication starts continuous replication if configured. It
+// returns the replication status source for /health (nil when disabled)
+// and a function that stops replication after shipping the last
+// committed frames.
+func (a *App) startReplication() (httpd.ReplicationMonitor, func(), error) {
+	cfg := a.Config.Backup.Replication
+	if !cfg.Enabled {
+		return nil, func() {}, nil
+	}
+
+	var monitor httpd.ReplicationMonitor
+	var run func(context.Context)
+	if cfg.Litestream.Enabled() {
+		l, err := backup.NewLitestream(a.DB.Path(), cfg.Litestream)
+		if err != nil {
+			return nil, nil, fmt.Errorf("replication: %w", err)
+		}
+		monitor, run = l, l.Run
+	} else {
+		r, err := backup.NewReplicator(a.DB, a.Config.Backup.S3, cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("replication: %w", err)
+		}
+		monitor = r
+		run = func(ctx context.Context) {
+			if err := r.Run(ctx); err != nil {
+				log.Printf("Replication stopped: %v", err)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(ctx)
+	}()
+	return monitor, func() {
+		cancel()
+		<-done
+	}, nil
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neoden/mykb/config"
+)
+
+func TestBackupRestore(t *testing.T) {
+	cfg := config.Default()
+	cfg.DataDir = t.TempDir()
+	a, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer a.Close()
+	ctx := context.Background()
+
+	a.DB.CreateChunk(ctx, "keep me", nil)
+	path := filepath.Join(t.TempDir(), "backup.db")
+	if err := a.Backup(ctx, path, false); err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	if err := a.Backup(ctx, filepath.Join(cfg.DataDir, "data.db"), false); err == nil {
+		t.Error("expected error when backing up onto the live database")
+	}
+
+	a.DB.CreateChunk(ctx, "extra", nil)
+	if err := a.Restore(ctx, path, false); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Errorf("Restore without force error = %v", err)
+	}
+	if err := a.Restore(ctx, path, true); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if n, _ := a.DB.CountChunks(ctx); n != 1 {
+		t.Errorf("CountChunks = %d, want 1", n)
+	}
+
+	saved, _ := filepath.Glob(filepath.Join(cfg.DataDir, "data.db.pre-restore-*"))
+	if len(saved) != 1 {
+		t.Errorf("pre-restore copies = %v", saved)
+	}
+
+	if err := a.Restore(ctx, filepath.Join(t.TempDir(), "missing.db"), true); err == nil {
+		t.Error("expected error for missing backup")
+	}
+}
+
+func TestRestoreAtRequiresBucket(t *testing.T) {
+	cfg := config.Default()
+	cfg.DataDir = t.TempDir()
+	a, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer a.Close()
+
+	if err := a.RestoreAt(context.Background(), time.Now(), false); err == nil || !strings.Contains(err.Error(), "backup.s3") {
+		t.Errorf("RestoreAt error = %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/neoden/mykb/bookmarks"
+)
+
+// BookmarkStats counts what ImportBookmarks did.
+type BookmarkStats struct {
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"` // already stored under the same url
+	Failed   int `json:"failed"`  // could not be fetched or had no text
+}
+
+// ImportBookmarks reads a browser bookmark or Pocket export from r, fetches
+// each page with at most concurrency requests in flight, and stores its
+// readable text as a chunk with url, title and tags metadata. Bookmarks
+// whose url is already stored are skipped, so an import can be rerun.
+func (a *App) ImportBookmarks(ctx context.Context, r io.Reader, concurrency int) (BookmarkStats, error) {
+	var stats BookmarkStats
+	list, err := bookmarks.Parse(r)
+	if err != nil {
+		return stats, err
+	}
+
+	stored, err := a.storedURLs(ctx)
+	if err != nil {
+		return stats, err
+	}
+	pending := list[:0]
+	for _, b := range list {
+		if stored[b.URL] {
+			stats.Skipped++
+			continue
+		}
+		pending = append(pending, b)
+	}
+
+	err = bookmarks.NewFetcher(concurrency).FetchAll(ctx, pending, func(res bookmarks.Result) error {
+		if res.Err != nil {
+			log.Printf("Skipping %s: %v", res.Bookmark.URL, res.Err)
+			stats.Failed++
+			return nil
+		}
+		meta, err := bookmarkMetadata(res.Bookmark, res.Page)
+		if err != nil {
+			return err
+		}
+		if _, err := a.DB.CreateChunk(ctx, res.Page.Text, meta); err != nil {
+			return fmt.Errorf("store %s: %w", res.Bookmark.URL, err)
+		}
+		stats.Imported++
+		return nil
+	})
+	return stats, err
+}
+
+// bookmarkMetadata describes a fetched bookmark. The bookmark's own title
+// wins over the page's.
+func bookmarkMetadata(b bookmarks.Bookmark, page *bookmarks.Page) (json.RawMessage, error) {
+	meta := map[string]any{"url": b.URL}
+	if b.Title != "" {
+		meta["title"] = b.Title
+	} else if page.Title != "" {
+		meta["title"] = page.Title
+	}
+	if len(b.Tags) > 0 {
+		meta["tags"] = b.Tags
+	}
+	return json.Marshal(meta)
+}
+
+// storedURLs returns the url metadata of every stored chunk.
+func (a *App) storedURLs(ctx context.Context) (map[string]bool, error) {
+	chunks, err := a.DB.GetAllChunks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	urls := make(map[string]bool)
+	for _, c := range chunks {
+		var meta struct {
+			URL string `json:"url"`
+		}
+		if len(c.Metadata) > 0 && json.Unmarshal(c.Metadata, &meta) == nil && meta.URL != "" {
+			urls[meta.URL] = true
+		}
+	}
+	return urls, nil
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/neoden/mykb/bookmarks"
+)
+
+func TestImportBookmarks(t *testing.T) {
+	ctx := context.Background()
+	bookmarks.AllowPrivate = true
+	t.Cleanup(func() { bookmarks.AllowPrivate = false })
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "<title>Page title</title><article><p>Readable text</p></article>")
+	}))
+	defer ts.Close()
+
+	a := setupExportApp(t)
+	input := "title,url,time_added,tags,status\n" +
+		",%[1]s/a,1700000000,go|web,unread\n" +
+		"Named,%[1]s/b,,,unread\n" +
+		"Gone,%[1]s/gone,,,unread\n"
+	input = fmt.Sprintf(input, ts.URL)
+
+	stats, err := a.ImportBookmarks(context.Background(), strings.NewReader(input), 2)
+	if err != nil {
+		t.Fatalf("ImportBookmarks: %v", err)
+	}
+	if stats != (BookmarkStats{Imported: 2, Failed: 1}) {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	results, _ := a.DB.SearchChunks(ctx, "Readable", 10)
+	meta := make(map[string]map[string]any)
+	for _, r := range results {
+		var m map[string]any
+		json.Unmarshal(r.Metadata, &m)
+		meta[m["url"].(string)] = m
+	}
+	if m := meta[ts.URL+"/a"]; m["title"] != "Page title" || fmt.Sprint(m["tags"]) != "[go web]" {
+		t.Errorf("metadata of /a = %v", m)
+	}
+	if m := meta[ts.URL+"/b"]; m["title"] != "Named" || m["tags"] != nil {
+		t.Errorf("metadata of /b = %v", m)
+	}
+
+	// Rerunning skips stored pages and retries the failed one
+	stats, err = a.ImportBookmarks(context.Background(), strings.NewReader(input), 2)
+	if err != nil || stats != (BookmarkStats{Skipped: 2, Failed: 1}) {
+		t.Errorf("second import = %+v, %v", stats, err)
+	}
+}
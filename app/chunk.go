@@ -0,0 +1,183 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+
+	"github.com/neoden/mykb/storage"
+)
+
+// ChunkMarkdown renders a chunk as a markdown document with its metadata as
+// front matter, as mykb get prints it and mykb edit opens it.
+func ChunkMarkdown(c storage.Chunk) string {
+	var meta map[string]any
+	if len(c.Metadata) > 0 {
+		json.Unmarshal(c.Metadata, &meta)
+	}
+	return markdownDocument(c, meta)
+}
+
+// Add stores one chunk, embedding it as store_chunk does. A document that
+// starts with front matter has it taken as metadata, under meta. It reports
+// whether the embedding was deferred to mykb reindex.
+func (a *App) Add(ctx context.Context, doc string, meta map[string]any) (*storage.Chunk, bool, error) {
+	content, docMeta := parseMarkdownDocument(doc)
+	if strings.TrimSpace(content) == "" {
+		return nil, false, errors.New("content is empty")
+	}
+	for k, v := range meta {
+		if docMeta == nil {
+			docMeta = make(map[string]any)
+		}
+		docMeta[k] = v
+	}
+	args := map[string]any{"content": content}
+	if docMeta != nil {
+		args["metadata"] = docMeta
+	}
+	var result struct {
+		storage.Chunk
+		EmbeddingDeferred bool `json:"embedding_deferred"`
+	}
+	if err := a.callTool(ctx, "", "", "store_chunk", args, &result); err != nil {
+		return nil, false, err
+	}
+	return &result.Chunk, result.EmbeddingDeferred, nil
+}
+
+// Edit opens a chunk in editor as a markdown document and saves what
+// changed, re-embedding it as update_chunk does. Removing the front matter
+// keeps the metadata as it was. It returns nil when nothing changed.
+func (a *App) Edit(ctx context.Context, id, editor string) (*storage.Chunk, error) {
+	c, err := a.DB.GetChunk(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	args := strings.Fields(editor)
+	if len(args) == 0 {
+		return nil, errors.New("no editor: set $EDITOR")
+	}
+
+	f, err := os.CreateTemp("", "mykb-"+shortID(c.ID)+"-*.md")
+	if err != nil {
+		return nil, err
+	}
+	path := f.Name()
+	defer os.Remove(path)
+	before := ChunkMarkdown(*c)
+	_, err = f.WriteString(before)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], append(args[1:], path)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("editor: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if string(data) == before {
+		return nil, nil
+	}
+
+	content, meta := parseMarkdownDocument(string(data))
+	if strings.TrimSpace(content) == "" {
+		return nil, errors.New("content is empty")
+	}
+	update := map[string]any{"chunk_id": c.ID}
+	if content != strings.Trim(c.Content, "\n") {
+		update["content"] = content
+	}
+	if meta != nil {
+		var old map[string]any
+		if len(c.Metadata) > 0 {
+			json.Unmarshal(c.Metadata, &old)
+		}
+		// Metadata named like the front matter's own fields is not shown,
+		// so it is kept
+		for _, k := range []string{"id", "created", "updated"} {
+			if v, ok := old[k]; ok {
+				meta[k] = v
+			}
+		}
+		if !reflect.DeepEqual(meta, old) && (len(meta) > 0 || len(old) > 0) {
+			update["metadata"] = meta
+		}
+	}
+	if len(update) == 1 {
+		return nil, nil
+	}
+
+	var result struct {
+		storage.Chunk
+		Found *bool `json:"found"`
+	}
+	if err := a.callTool(ctx, "", "", "update_chunk", update, &result); err != nil {
+		return nil, err
+	}
+	if result.Found != nil && !*result.Found {
+		return nil, storage.ErrChunkNotFound
+	}
+	return &result.Chunk, nil
+}
+
+// parseMarkdownDocument splits a document written by markdownDocument, or
+// edited from one, into its content and front matter metadata. Values are
+// read as JSON, falling back to plain strings; the id and timestamps are
+// dropped. meta is nil without front matter.
+func parseMarkdownDocument(doc string) (content string, meta map[string]any) {
+	doc = strings.ReplaceAll(doc, "\r\n", "\n")
+	rest, ok := strings.CutPrefix(doc, "---\n")
+	if !ok {
+		return strings.TrimRight(doc, "\n"), nil
+	}
+	front, body, ok := strings.Cut(rest, "\n---\n")
+	if !ok {
+		if front, ok = strings.CutSuffix(rest, "\n---"); !ok {
+			return strings.TrimRight(doc, "\n"), nil
+		}
+	}
+
+	meta = make(map[string]any)
+	for _, line := range strings.Split(front, "\n") {
+		k, v, ok := frontMatterField(line)
+		if !ok || k == "id" || k == "created" || k == "updated" {
+			continue
+		}
+		var value any
+		if err := json.Unmarshal([]byte(v), &value); err != nil {
+			value = v
+		}
+		meta[k] = value
+	}
+	return strings.Trim(body, "\n"), meta
+}
+
+// frontMatterField splits a `key: value` line; keys may be JSON-quoted, as
+// yamlKey writes those that are not plain.
+func frontMatterField(line string) (key, value string, ok bool) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, `"`) {
+		dec := json.NewDecoder(strings.NewReader(line))
+		if err := dec.Decode(&key); err != nil {
+			return "", "", false
+		}
+		value, ok = strings.CutPrefix(line[dec.InputOffset():], ":")
+		return key, strings.TrimSpace(value), ok
+	}
+	key, value, ok = strings.Cut(line, ":")
+	key = strings.TrimSpace(key)
+	return key, strings.TrimSpace(value), ok && key != ""
+}
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/neoden/mykb/mcp"
+	"github.com/neoden/mykb/vector"
+)
+
+func TestAddAndEdit(t *testing.T) {
+	a := setupExportApp(t)
+	a.Embedder = &mockEmbedder{}
+	a.Index = vector.NewIndex()
+	a.MCP = mcp.NewServer(a.DB, a.Embedder, a.Index)
+	ctx := context.Background()
+
+	doc := "---\nproject: mykb\ntags: [\"go\", \"cli\"]\n---\n\n# Shell\n\nAdded from the shell.\n"
+	chunk, deferred, err := a.Add(ctx, doc, map[string]any{"source": "test"})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if deferred || chunk.Content != "# Shell\n\nAdded from the shell." {
+		t.Errorf("chunk = %+v, deferred = %v", chunk, deferred)
+	}
+	var meta map[string]any
+	json.Unmarshal(chunk.Metadata, &meta)
+	if meta["project"] != "mykb" || meta["source"] != "test" || len(meta["tags"].([]any)) != 2 {
+		t.Errorf("metadata = %v", meta)
+	}
+	if a.Index.Size() != 1 {
+		t.Errorf("index size = %d, want 1", a.Index.Size())
+	}
+
+	// An editor that changes nothing
+	if updated, err := a.Edit(ctx, chunk.ID, "true"); err != nil || updated != nil {
+		t.Errorf("unchanged Edit = %v, %v", updated, err)
+	}
+
+	// An editor that rewrites the body and a metadata value
+	script := filepath.Join(t.TempDir(), "editor.sh")
+	os.WriteFile(script, []byte("#!/bin/sh\nsed -i -e 's/Added from/Edited in/' -e 's/^project: .*/project: notes/' \"$1\"\n"), 0700)
+	updated, err := a.Edit(ctx, chunk.ID, script)
+	if err != nil {
+		t.Fatalf("Edit: %v", err)
+	}
+	if updated == nil || !strings.Contains(updated.Content, "Edited in the shell.") {
+		t.Fatalf("updated = %+v", updated)
+	}
+	got, _ := a.DB.GetChunk(ctx, chunk.ID)
+	meta = nil
+	json.Unmarshal(got.Metadata, &meta)
+	if meta["project"] != "notes" || meta["source"] != "test" {
+		t.Errorf("metadata after edit = %v", meta)
+	}
+
+	if _, err := a.Edit(ctx, "missing", script); err == nil {
+		t.Error("Edit of a missing chunk succeeded")
+	}
+}
+
+func TestParseMarkdownDocument(t *testing.T) {
+	content, meta := parseMarkdownDocument("---\nid: x\n\"odd: key\": 3\nnote: plain words\n---\n\nBody\n")
+	if content != "Body" || meta["odd: key"] != float64(3) || meta["note"] != "plain words" || meta["id"] != nil {
+		t.Errorf("content = %q, meta = %v", content, meta)
+	}
+	if content, meta := parseMarkdownDocument("no front matter\n"); content != "no front matter" || meta != nil {
+		t.Errorf("content = %q, meta = %v", content, meta)
+	}
+}
@@ -0,0 +1,280 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/neoden/mykb/embedding"
+	"github.com/neoden/mykb/mcp"
+	"github.com/neoden/mykb/storage"
+)
+
+// Export formats.
+const (
+	ExportCorpus   = "corpus"
+	ExportJSONL    = "jsonl"
+	ExportMarkdown = "markdown"
+)
+
+// DefaultCorpusSeparator separates documents in corpus exports.
+// PlainText drops thematic breaks, so it cannot occur inside a document.
+const DefaultCorpusSeparator = "\n\n---\n\n"
+
+// ExportOptions controls Export.
+type ExportOptions struct {
+	Format string
+	// Separator is written between documents (corpus format).
+	Separator string
+	// Headers lists metadata keys rendered as "key: value" lines before each document.
+	Headers []string
+	// Include keeps only chunks matching all of these key=value filters.
+	Include []string
+	// Exclude drops chunks matching any of these key=value filters.
+	Exclude []string
+	// Embeddings includes stored embedding vectors (jsonl format).
+	Embeddings bool
+	// Dir is the output directory (markdown format).
+	Dir string
+	// GroupBy names the metadata key whose value picks each file's
+	// subdirectory (markdown format).
+	GroupBy string
+}
+
+// Export writes all chunks matching the filters to w, or into opts.Dir for
+// the markdown format.
+func (a *App) Export(ctx context.Context, w io.Writer, opts ExportOptions) error {
+	include, err := parseFilters(opts.Include)
+	if err != nil {
+		return err
+	}
+	exclude, err := parseFilters(opts.Exclude)
+	if err != nil {
+		return err
+	}
+
+	chunks, err := a.DB.GetAllChunks(ctx)
+	if err != nil {
+		return fmt.Errorf("get chunks: %w", err)
+	}
+
+	var selected []storage.Chunk
+	for _, c := range chunks {
+		if matchesFilters(c.Metadata, include, exclude) {
+			selected = append(selected, c)
+		}
+	}
+
+	switch opts.Format {
+	case ExportCorpus, "":
+		return exportCorpus(w, selected, opts)
+	case ExportJSONL:
+		return a.exportJSONL(ctx, w, selected, opts)
+	case ExportMarkdown:
+		return exportMarkdown(selected, opts)
+	default:
+		return fmt.Errorf("unsupported export format: %s", opts.Format)
+	}
+}
+
+func exportCorpus(w io.Writer, chunks []storage.Chunk, opts ExportOptions) error {
+	sep := opts.Separator
+	if sep == "" {
+		sep = DefaultCorpusSeparator
+	}
+
+	written := 0
+	for _, c := range chunks {
+		text := PlainText(c.Content)
+		if text == "" {
+			continue
+		}
+		if written > 0 {
+			if _, err := io.WriteString(w, sep); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, embedding.Text(text, c.Metadata, opts.Headers)); err != nil {
+			return err
+		}
+		written++
+	}
+	if written > 0 {
+		_, err := io.WriteString(w, "\n")
+		return err
+	}
+	return nil
+}
+
+// ExportFormatVersion is the version of the jsonl export format, recorded
+// in the header line an export starts with. Bump it for changes that older
+// releases would misread; Import refuses exports newer than it knows.
+// Exports without a header predate versioning and read as version 0.
+const ExportFormatVersion = 1
+
+// jsonlHeader is the first line of a jsonl export.
+type jsonlHeader struct {
+	Format int `json:"mykb_export"`
+	// Version is the mykb release and Schema the last database migration
+	// of the exporting instance.
+	Version    string    `json:"version"`
+	Schema     string    `json:"schema"`
+	ExportedAt time.Time `json:"exported_at"`
+	// Chunks counts the records that follow, so a truncated export is
+	// detected on import.
+	Chunks     int  `json:"chunks"`
+	Embeddings bool `json:"embeddings"`
+}
+
+// jsonlRecord is one line of a jsonl export: a chunk with its ID,
+// timestamps and, optionally, its embeddings.
+type jsonlRecord struct {
+	storage.Chunk
+	Embeddings []jsonlEmbedding `json:"embeddings,omitempty"`
+}
+
+type jsonlEmbedding struct {
+	Model  string    `json:"model"`
+	Vector []float32 `json:"vector"`
+}
+
+func (a *App) exportJSONL(ctx context.Context, w io.Writer, chunks []storage.Chunk, opts ExportOptions) error {
+	schema, err := a.DB.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	err = enc.Encode(jsonlHeader{
+		Format:     ExportFormatVersion,
+		Version:    mcp.Version,
+		Schema:     schema,
+		ExportedAt: time.Now().UTC().Truncate(time.Second),
+		Chunks:     len(chunks),
+		Embeddings: opts.Embeddings,
+	})
+	if err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		rec := jsonlRecord{Chunk: c}
+		if opts.Embeddings {
+			vecs, err := a.DB.GetEmbeddings(ctx, c.ID)
+			if err != nil {
+				return err
+			}
+			for model, vec := range vecs {
+				rec.Embeddings = append(rec.Embeddings, jsonlEmbedding{Model: model, Vector: vec})
+			}
+			sort.Slice(rec.Embeddings, func(i, j int) bool { return rec.Embeddings[i].Model < rec.Embeddings[j].Model })
+		}
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type metadataFilter struct {
+	key, value string
+}
+
+// parseFilters parses key=value filter expressions.
+func parseFilters(exprs []string) ([]metadataFilter, error) {
+	filters := make([]metadataFilter, 0, len(exprs))
+	for _, e := range exprs {
+		key, value, ok := strings.Cut(e, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid filter %q: expected key=value", e)
+		}
+		filters = append(filters, metadataFilter{key, value})
+	}
+	return filters, nil
+}
+
+func matchesFilters(metadata json.RawMessage, include, exclude []metadataFilter) bool {
+	var meta map[string]any
+	if len(metadata) > 0 {
+		json.Unmarshal(metadata, &meta)
+	}
+	for _, f := range include {
+		if !f.matches(meta) {
+			return false
+		}
+	}
+	for _, f := range exclude {
+		if f.matches(meta) {
+			return false
+		}
+	}
+	return true
+}
+
+// matches reports whether metadata[key] equals value, or contains it if an array.
+func (f metadataFilter) matches(meta map[string]any) bool {
+	v, ok := meta[f.key]
+	if !ok {
+		return false
+	}
+	if arr, ok := v.([]any); ok {
+		for _, item := range arr {
+			if fmt.Sprint(item) == f.value {
+				return true
+			}
+		}
+		return false
+	}
+	return fmt.Sprint(v) == f.value
+}
+
+var (
+	mdHeading    = regexp.MustCompile(`^#{1,6}\s+`)
+	mdRule       = regexp.MustCompile(`^([-*_]\s*){3,}$`)
+	mdImage      = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLink       = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	mdStrong     = regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*`)
+	mdEm         = regexp.MustCompile(`\*(\S(?:.*?\S)?)\*`)
+	mdStrike     = regexp.MustCompile(`~~(\S(?:.*?\S)?)~~`)
+	mdUnderscore = regexp.MustCompile(`(^|[\s(])__?(\S(?:.*?\S)?)__?([\s).,;:!?]|$)`) // not inside snake_case
+	mdInlineCode = regexp.MustCompile("`([^`]*)`")
+	blankLines   = regexp.MustCompile(`\n{3,}`)
+)
+
+// PlainText strips markdown syntax from content, keeping the text: headings,
+// emphasis, links, and code fences are reduced to their words, and
+// horizontal rules are dropped.
+func PlainText(content string) string {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	out := make([]string, 0, len(lines))
+	inFence := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			out = append(out, strings.TrimRight(line, " \t"))
+			continue
+		}
+		if mdRule.MatchString(trimmed) {
+			continue
+		}
+		trimmed = strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))
+		trimmed = mdHeading.ReplaceAllString(trimmed, "")
+		trimmed = mdImage.ReplaceAllString(trimmed, "$1")
+		trimmed = mdLink.ReplaceAllString(trimmed, "$1")
+		trimmed = mdInlineCode.ReplaceAllString(trimmed, "$1")
+		trimmed = mdStrong.ReplaceAllString(trimmed, "$1")
+		trimmed = mdEm.ReplaceAllString(trimmed, "$1")
+		trimmed = mdStrike.ReplaceAllString(trimmed, "$1")
+		trimmed = mdUnderscore.ReplaceAllString(trimmed, "$1$2$3")
+		out = append(out, trimmed)
+	}
+	text := blankLines.ReplaceAllString(strings.Join(out, "\n"), "\n\n")
+	return strings.TrimSpace(text)
+}
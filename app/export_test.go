@@ -0,0 +1,152 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/neoden/mykb/storage"
+)
+
+func setupExportApp(t *testing.T) *App {
+	ctx := context.Background()
+	t.Helper()
+	db, err := storage.Init(t.TempDir())
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	a := &App{DB: db}
+	t.Cleanup(func() { a.Close() })
+
+	db.CreateChunk(ctx, "# Go\n\nUse **gofmt**.", json.RawMessage(`{"title":"Go tips","tags":["go","tools"]}`))
+	db.CreateChunk(ctx, "Private notes", json.RawMessage(`{"title":"Diary","tags":["private"]}`))
+	db.CreateChunk(ctx, "Plain chunk", nil)
+	return a
+}
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"# Title\n\nBody", "Title\n\nBody"},
+		{"**bold** and *em* and ~~gone~~", "bold and em and gone"},
+		{"see [docs](https://example.com) and ![logo](x.png)", "see docs and logo"},
+		{"use `go vet`", "use go vet"},
+		{"```go\nfmt.Println(\"*x*\")\n```", "fmt.Println(\"*x*\")"},
+		{"> quoted", "quoted"},
+		{"a\n\n---\n\nb", "a\n\nb"},
+		{"snake_case_name and _em_", "snake_case_name and em"},
+		{"#hashtag stays", "#hashtag stays"},
+		{"a\n\n\n\nb", "a\n\nb"},
+	}
+	for _, tt := range tests {
+		if got := PlainText(tt.in); got != tt.want {
+			t.Errorf("PlainText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestExportCorpus(t *testing.T) {
+	ctx := context.Background()
+	a := setupExportApp(t)
+
+	var buf bytes.Buffer
+	err := a.Export(ctx, &buf, ExportOptions{
+		Format:    ExportCorpus,
+		Separator: "\n<|endoftext|>\n",
+		Headers:   []string{"title"},
+	})
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+
+	docs := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n<|endoftext|>\n")
+	if len(docs) != 3 {
+		t.Fatalf("got %d documents: %q", len(docs), buf.String())
+	}
+	if !strings.Contains(buf.String(), "title: Go tips\n\nGo\n\nUse gofmt.") {
+		t.Errorf("missing cleaned document with header: %q", buf.String())
+	}
+}
+
+func TestExportFilters(t *testing.T) {
+	ctx := context.Background()
+	a := setupExportApp(t)
+
+	var buf bytes.Buffer
+	if err := a.Export(ctx, &buf, ExportOptions{Exclude: []string{"tags=private"}}); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if strings.Contains(buf.String(), "Private") {
+		t.Errorf("excluded chunk exported: %q", buf.String())
+	}
+	if !strings.Contains(buf.String(), "Plain chunk") {
+		t.Errorf("chunk without metadata should pass exclude filter: %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := a.Export(ctx, &buf, ExportOptions{Include: []string{"tags=go"}}); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != "Go\n\nUse gofmt." {
+		t.Errorf("include export = %q", got)
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	ctx := context.Background()
+	a := setupExportApp(t)
+
+	if err := a.Export(ctx, &bytes.Buffer{}, ExportOptions{Format: "xml"}); err == nil {
+		t.Error("expected error for unsupported format")
+	}
+	if err := a.Export(ctx, &bytes.Buffer{}, ExportOptions{Include: []string{"novalue"}}); err == nil {
+		t.Error("expected error for invalid filter")
+	}
+}
+
+func TestExportMarkdown(t *testing.T) {
+	ctx := context.Background()
+	a := setupExportApp(t)
+	a.DB.CreateChunk(ctx, "# Go\n\nSecond note with the same title", json.RawMessage(`{"tags":["go"],"weird key":1}`))
+	dir := t.TempDir()
+
+	if err := a.Export(ctx, nil, ExportOptions{Format: ExportMarkdown, Dir: dir, GroupBy: "tags"}); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+
+	var files []string
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if !d.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(files)
+	if len(files) != 4 || files[0] != "go/go-tips.md" || !strings.HasPrefix(files[1], "go/go") || files[2] != "plain-chunk.md" || files[3] != "private/diary.md" {
+		t.Fatalf("files = %v", files)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, "go/go-tips.md"))
+	doc := string(data)
+	for _, want := range []string{"---\nid: ", "\ntags: [\"go\",\"tools\"]\n", "\ntitle: \"Go tips\"\n", "---\n\n# Go\n\nUse **gofmt**.\n"} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("document missing %q:\n%s", want, doc)
+		}
+	}
+	data, _ = os.ReadFile(filepath.Join(dir, files[1]))
+	if !strings.Contains(string(data), "\n\"weird key\": 1\n") {
+		t.Errorf("quoted key missing:\n%s", data)
+	}
+
+	if err := a.Export(ctx, nil, ExportOptions{Format: ExportMarkdown}); err == nil {
+		t.Error("expected error without a directory")
+	}
+}
@@ -0,0 +1,259 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/neoden/mykb/events"
+	"github.com/neoden/mykb/gitmirror"
+	"github.com/neoden/mykb/storage"
+)
+
+// maxCommitTitle bounds the chunk title quoted in a commit subject.
+const maxCommitTitle = 60
+
+// GitStatus describes the git mirror and how far it lags the database.
+type GitStatus struct {
+	gitmirror.Status
+	// Stale counts chunks whose file is missing or out of date, and
+	// Orphaned files whose chunk is gone; both are caught up on the next
+	// server start or mykb git init.
+	Stale    int `json:"stale"`
+	Orphaned int `json:"orphaned"`
+}
+
+// GitInit creates the git mirror repository configured in [git] and
+// commits every chunk to it. On an existing repository it commits whatever
+// changed since it was last updated.
+func (a *App) GitInit(ctx context.Context) (*gitmirror.Status, error) {
+	if !a.Config.Git.Enabled() {
+		return nil, errors.New("no [git] dir configured")
+	}
+	repo, err := gitmirror.Init(a.Config.Git)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := a.catchUpGit(ctx, repo); err != nil {
+		return nil, err
+	}
+	return repo.Status()
+}
+
+// GitStatus reports on the git mirror repository.
+func (a *App) GitStatus(ctx context.Context) (*GitStatus, error) {
+	if !a.Config.Git.Enabled() {
+		return nil, errors.New("no [git] dir configured")
+	}
+	repo, err := gitmirror.Open(a.Config.Git)
+	if err != nil {
+		return nil, err
+	}
+	st, err := repo.Status()
+	if err != nil {
+		return nil, err
+	}
+	status := &GitStatus{Status: *st}
+	status.Stale, status.Orphaned, err = a.diffGit(ctx, repo, nil)
+	return status, err
+}
+
+// catchUpGit rewrites the files of chunks changed outside the running
+// mirror, such as by CLI commands or while no server ran, and commits them
+// together.
+func (a *App) catchUpGit(ctx context.Context, repo *gitmirror.Repo) (bool, error) {
+	var stale, orphaned int
+	var err error
+	apply := func(id string, data []byte) error {
+		if data == nil {
+			return repo.RemoveChunk(id)
+		}
+		return repo.WriteChunk(id, data)
+	}
+	if stale, orphaned, err = a.diffGit(ctx, repo, apply); err != nil {
+		return false, err
+	}
+	if stale == 0 && orphaned == 0 {
+		return false, nil
+	}
+	return repo.Commit(fmt.Sprintf("Sync %d changed and %d deleted chunks", stale, orphaned))
+}
+
+// diffGit compares the mirror's files with the database, calling apply
+// (when non-nil) with the content each stale file should have, or nil for
+// orphaned files.
+func (a *App) diffGit(ctx context.Context, repo *gitmirror.Repo, apply func(id string, data []byte) error) (stale, orphaned int, err error) {
+	chunks, err := a.DB.GetAllChunks(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("get chunks: %w", err)
+	}
+	live := make(map[string]bool, len(chunks))
+	for _, c := range chunks {
+		live[c.ID] = true
+		want := gitDocument(c)
+		have, err := repo.ReadChunk(c.ID)
+		if err != nil {
+			return stale, orphaned, err
+		}
+		if bytes.Equal(have, want) {
+			continue
+		}
+		stale++
+		if apply != nil {
+			if err := apply(c.ID, want); err != nil {
+				return stale, orphaned, err
+			}
+		}
+	}
+	ids, err := repo.ChunkIDs()
+	if err != nil {
+		return stale, orphaned, err
+	}
+	for _, id := range ids {
+		if live[id] {
+			continue
+		}
+		orphaned++
+		if apply != nil {
+			if err := apply(id, nil); err != nil {
+				return stale, orphaned, err
+			}
+		}
+	}
+	return stale, orphaned, nil
+}
+
+// gitDocument renders a chunk's mirror file, in the markdown export format.
+func gitDocument(c storage.Chunk) []byte {
+	return []byte(ChunkMarkdown(c))
+}
+
+// gitCommitMessage describes a chunk change; commit trailers carry the
+// chunk ID and the client that made it.
+func gitCommitMessage(e events.Event) string {
+	id, _ := e.Fields["id"].(string)
+	var subject string
+	switch e.Type {
+	case events.ChunkCreated:
+		subject = "Create"
+	case events.ChunkUpdated:
+		subject = "Update"
+	default:
+		subject = "Delete"
+	}
+	subject += " " + shortID(id)
+	if c, ok := e.Data.(*storage.Chunk); ok {
+		var meta map[string]any
+		json.Unmarshal(c.Metadata, &meta)
+		if title := strings.TrimSpace(chunkTitle(*c, meta)); title != "" {
+			if r := []rune(title); len(r) > maxCommitTitle {
+				title = string(r[:maxCommitTitle]) + "…"
+			}
+			subject += ": " + title
+		}
+	}
+
+	msg := subject + "\n\nChunk: " + id
+	if client, ok := e.Fields["client"].(string); ok {
+		msg += "\nClient: " + client
+	}
+	return msg + "\n"
+}
+
+// startGitMirror commits every chunk change to the git mirror in the
+// background and returns a function that stops it. It does nothing unless
+// [git] is configured, and logs instead of failing when the repository is
+// missing.
+func (a *App) startGitMirror() func() {
+	if !a.Config.Git.Enabled() || a.DB.ReadOnly() {
+		return func() {}
+	}
+	repo, err := gitmirror.Open(a.Config.Git)
+	if err != nil {
+		log.Printf("Git mirror disabled: %v", err)
+		return func() {}
+	}
+	// Subscribe before catching up, so no change falls in between
+	ch, unsubscribe := a.Events.Subscribe()
+	if _, err := a.catchUpGit(context.Background(), repo); err != nil {
+		log.Printf("Git mirror: catch up: %v", err)
+	}
+
+	// The bus drops events for a subscriber that falls behind, and a commit
+	// is slow; queue events without bound and commit them in turn
+	var mu sync.Mutex
+	var queue []events.Event
+	wake := make(chan struct{}, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		for e := range ch {
+			if !e.Type.IsChunk() {
+				continue
+			}
+			mu.Lock()
+			queue = append(queue, e)
+			mu.Unlock()
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			mu.Lock()
+			batch := queue
+			queue = nil
+			mu.Unlock()
+			for _, e := range batch {
+				if err := a.commitGitChange(repo, e); err != nil {
+					log.Printf("Git mirror: %v", err)
+				}
+			}
+			if len(batch) > 0 {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-wake:
+			}
+		}
+	}()
+	// Stopping commits what was already queued
+	return func() {
+		unsubscribe()
+		<-read
+		cancel()
+		<-done
+	}
+}
+
+// commitGitChange writes or removes a changed chunk's file and commits it.
+func (a *App) commitGitChange(repo *gitmirror.Repo, e events.Event) error {
+	id, _ := e.Fields["id"].(string)
+	if e.Type == events.ChunkDeleted {
+		if err := repo.RemoveChunk(id); err != nil {
+			return err
+		}
+	} else {
+		c, ok := e.Data.(*storage.Chunk)
+		if !ok {
+			return fmt.Errorf("%s event for %s without a chunk", e.Type, id)
+		}
+		if err := repo.WriteChunk(id, gitDocument(*c)); err != nil {
+			return err
+		}
+	}
+	_, err := repo.Commit(gitCommitMessage(e))
+	return err
+}
@@ -0,0 +1,84 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/neoden/mykb/config"
+	"github.com/neoden/mykb/events"
+	"github.com/neoden/mykb/mcp"
+	"github.com/neoden/mykb/vector"
+)
+
+func TestGitMirror(t *testing.T) {
+	ctx := context.Background()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	a := setupExportApp(t)
+	a.Config = config.Default()
+	a.Config.Git.Dir = t.TempDir()
+	a.Events = events.NewBus()
+	cfg := mcp.DefaultConfig()
+	cfg.Events = a.Events
+	a.MCP = mcp.NewServerWithConfig(a.DB, nil, vector.NewIndex(), cfg)
+
+	if _, err := a.GitStatus(ctx); err == nil {
+		t.Error("GitStatus before init succeeded")
+	}
+	st, err := a.GitInit(ctx)
+	if err != nil {
+		t.Fatalf("GitInit: %v", err)
+	}
+	if st.Commits != 1 || !strings.HasPrefix(st.Head[strings.Index(st.Head, " ")+1:], "Sync 3 changed") {
+		t.Errorf("GitInit status = %+v", st)
+	}
+
+	// A change made while no mirror ran is caught up on start
+	plain, _ := a.DB.CreateChunk(ctx, "made offline", nil)
+	stop := a.startGitMirror()
+	ctx = mcp.WithClient(context.Background(), "laptop")
+	tool := func(name string, args map[string]any) map[string]any {
+		params, _ := json.Marshal(map[string]any{"name": name, "arguments": args})
+		resp := a.MCP.HandleRequest(ctx, &mcp.Request{JSONRPC: "2.0", ID: json.RawMessage(`1`), Method: "tools/call", Params: params})
+		data, _ := json.Marshal(resp.Result.(*mcp.CallToolResult).StructuredContent)
+		var out map[string]any
+		json.Unmarshal(data, &out)
+		return out
+	}
+	id, _ := tool("store_chunk", map[string]any{"content": "Mirrored note", "metadata": map[string]any{"title": "Mirror"}})["id"].(string)
+	tool("update_chunk", map[string]any{"chunk_id": id, "content": "Mirrored note, edited"})
+	tool("delete_chunk", map[string]any{"chunk_id": plain.ID})
+	stop()
+
+	out, err := exec.Command("git", "-C", a.Config.Git.Dir, "log", "--format=%s|%b").Output()
+	if err != nil {
+		t.Fatalf("git log: %v", err)
+	}
+	log := string(out)
+	for _, want := range []string{
+		"Delete " + shortID(plain.ID),
+		"Update " + shortID(id) + ": Mirror",
+		"Create " + shortID(id) + ": Mirror|Chunk: " + id + "\nClient: laptop",
+		"Sync 1 changed and 0 deleted",
+	} {
+		if !strings.Contains(log, want) {
+			t.Errorf("git log missing %q:\n%s", want, log)
+		}
+	}
+
+	status, err := a.GitStatus(ctx)
+	if err != nil {
+		t.Fatalf("GitStatus: %v", err)
+	}
+	if status.Commits != 5 || status.Stale != 0 || status.Orphaned != 0 || len(status.Uncommitted) != 0 {
+		t.Errorf("GitStatus = %+v", status)
+	}
+	a.DB.DeleteChunk(ctx, id)
+	if status, _ := a.GitStatus(ctx); status.Orphaned != 1 {
+		t.Errorf("Orphaned = %d after an unmirrored delete, want 1", status.Orphaned)
+	}
+}
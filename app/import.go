@@ -0,0 +1,167 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/neoden/mykb/storage"
+)
+
+// Import conflict strategies, applied when an imported chunk's ID already exists.
+const (
+	ConflictSkip      = "skip"      // keep the existing chunk
+	ConflictOverwrite = "overwrite" // replace it with the imported one
+	ConflictNewID     = "new-id"    // import under a fresh ID alongside it
+)
+
+// ImportStats counts what Import did.
+type ImportStats struct {
+	Created     int `json:"created"`
+	Overwritten int `json:"overwritten"`
+	Skipped     int `json:"skipped"`
+	Renamed     int `json:"renamed"`
+	Embeddings  int `json:"embeddings"`
+}
+
+// Import reads a jsonl export from r and merges it into the database,
+// resolving ID conflicts with the given strategy. The whole input is
+// validated before anything is written.
+func (a *App) Import(ctx context.Context, r io.Reader, conflict string) (ImportStats, error) {
+	var stats ImportStats
+	switch conflict {
+	case ConflictSkip, ConflictOverwrite, ConflictNewID:
+	case "":
+		conflict = ConflictSkip
+	default:
+		return stats, fmt.Errorf("unknown conflict strategy %q: expected skip, overwrite or new-id", conflict)
+	}
+
+	records, err := readJSONL(r)
+	if err != nil {
+		return stats, err
+	}
+
+	for _, rec := range records {
+		existing, err := a.DB.GetChunk(ctx, rec.ID)
+		if err != nil && !errors.Is(err, storage.ErrChunkNotFound) {
+			return stats, err
+		}
+		if existing != nil {
+			switch conflict {
+			case ConflictSkip:
+				stats.Skipped++
+				continue
+			case ConflictNewID:
+				rec.ID = uuid.New().String()
+				stats.Renamed++
+			case ConflictOverwrite:
+				stats.Overwritten++
+			}
+		} else {
+			stats.Created++
+		}
+
+		if err := a.DB.PutChunk(ctx, &rec.Chunk); err != nil {
+			return stats, fmt.Errorf("chunk %s: %w", rec.ID, err)
+		}
+		if existing != nil && conflict == ConflictOverwrite && existing.Content != rec.Content {
+			// Drop outdated vectors so reindex embeds the new content
+			if err := a.DB.DeleteEmbedding(ctx, rec.ID); err != nil {
+				return stats, err
+			}
+		}
+		for _, e := range rec.Embeddings {
+			if err := a.DB.SaveEmbedding(ctx, rec.ID, e.Model, a.embedText(&rec.Chunk), e.Vector); err != nil {
+				return stats, fmt.Errorf("chunk %s: %w", rec.ID, err)
+			}
+			stats.Embeddings++
+		}
+	}
+	return stats, nil
+}
+
+// readJSONL parses and validates every record of a jsonl export. Header
+// lines are checked wherever they occur, so concatenated exports import too.
+func readJSONL(r io.Reader) ([]jsonlRecord, error) {
+	var records []jsonlRecord
+	seen := make(map[string]bool)
+	// The chunk count announced by the last header, and the records since
+	var header *jsonlHeader
+	var headerLine, count int
+	checkCount := func() error {
+		if header != nil && count != header.Chunks {
+			return fmt.Errorf("line %d: export announces %d chunks but has %d; is it truncated?", headerLine, header.Chunks, count)
+		}
+		return nil
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 64<<20) // lines carry whole chunks and vectors
+	line := 1
+	for ; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var probe struct {
+			Format *int `json:"mykb_export"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &probe); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if probe.Format != nil {
+			if err := checkCount(); err != nil {
+				return nil, err
+			}
+			header = new(jsonlHeader)
+			json.Unmarshal(sc.Bytes(), header)
+			if header.Format > ExportFormatVersion {
+				return nil, fmt.Errorf("line %d: export format %d (from mykb %s) is newer than this mykb supports (%d); upgrade to import it",
+					line, header.Format, header.Version, ExportFormatVersion)
+			}
+			headerLine, count = line, 0
+			continue
+		}
+		count++
+
+		var rec jsonlRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if rec.ID == "" {
+			return nil, fmt.Errorf("line %d: missing id", line)
+		}
+		if seen[rec.ID] {
+			return nil, fmt.Errorf("line %d: duplicate id %s", line, rec.ID)
+		}
+		seen[rec.ID] = true
+		if string(rec.Metadata) == "null" {
+			rec.Metadata = nil
+		}
+		for _, e := range rec.Embeddings {
+			if e.Model == "" || len(e.Vector) == 0 {
+				return nil, fmt.Errorf("line %d: embedding needs model and vector", line)
+			}
+		}
+		now := time.Now().UTC()
+		if rec.CreatedAt.IsZero() {
+			rec.CreatedAt = now
+		}
+		if rec.UpdatedAt.IsZero() {
+			rec.UpdatedAt = rec.CreatedAt
+		}
+		records = append(records, rec)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read import: %w", err)
+	}
+	if err := checkCount(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
@@ -0,0 +1,90 @@
+package app
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/neoden/mykb/ingest"
+	"github.com/neoden/mykb/mcp"
+)
+
+// ingestExts are the files picked up when ingesting a directory.
+var ingestExts = map[string]bool{
+	".md": true, ".markdown": true, ".html": true, ".htm": true, ".txt": true, ".pdf": true,
+}
+
+// Ingest stores the document at src (a file, a directory of markdown,
+// HTML, text and PDF files, or an http(s) URL) as chunks, calling done
+// after each document. Audio files are transcribed (see mcp.IngestAudio);
+// directories include them when a transcription provider is configured.
+func (a *App) Ingest(ctx context.Context, src string, metadata map[string]any, done func(*mcp.IngestResult)) error {
+	sources := []string{src}
+	if !strings.Contains(src, "://") {
+		var err error
+		if sources, err = ingestFiles(src, a.MCP.Transcribes()); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range sources {
+		if contentType := ingest.AudioType(s); contentType != "" && !strings.Contains(s, "://") {
+			res, err := a.ingestAudio(ctx, s, contentType, metadata)
+			if err != nil {
+				return err
+			}
+			done(res)
+			continue
+		}
+		doc, err := ingest.Load(ctx, s)
+		if err != nil {
+			return err
+		}
+		res, err := a.MCP.IngestDocument(ctx, doc, metadata)
+		if err != nil {
+			return err
+		}
+		done(res)
+	}
+	return nil
+}
+
+func (a *App) ingestAudio(ctx context.Context, path, contentType string, metadata map[string]any) (*mcp.IngestResult, error) {
+	audio, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return a.MCP.IngestAudio(ctx, path, contentType, audio, metadata)
+}
+
+// ingestFiles lists path itself, or the ingestible files below a
+// directory, including audio files if audio is set.
+func ingestFiles(path string, audio bool) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == path && !d.IsDir() {
+			files = append(files, p)
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") && p != path {
+			// Hidden directories and editor lock and swap files
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && (ingestExts[strings.ToLower(filepath.Ext(p))] || audio && ingest.AudioType(p) != "") {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, err
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/neoden/mykb/mcp"
+	"github.com/neoden/mykb/vector"
+)
+
+func TestIngestDirectory(t *testing.T) {
+	ctx := context.Background()
+	a := setupExportApp(t)
+	a.MCP = mcp.NewServer(a.DB, nil, vector.NewIndex())
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	os.MkdirAll(filepath.Join(dir, ".git"), 0755)
+	os.WriteFile(filepath.Join(dir, "a.md"), []byte("# A\n\nalpha"), 0644)
+	os.WriteFile(filepath.Join(dir, "sub", "b.html"), []byte("<p>beta</p>"), 0644)
+	os.WriteFile(filepath.Join(dir, "image.png"), []byte("png"), 0644)
+	os.WriteFile(filepath.Join(dir, ".git", "c.txt"), []byte("hidden"), 0644)
+
+	var sources []string
+	err := a.Ingest(context.Background(), dir, map[string]any{"batch": "1"}, func(res *mcp.IngestResult) {
+		sources = append(sources, filepath.Base(res.Source))
+	})
+	if err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+	if len(sources) != 2 || sources[0] != "a.md" || sources[1] != "b.html" {
+		t.Errorf("ingested %v, want a.md and b.html", sources)
+	}
+	if n, _ := a.DB.CountChunks(ctx); n != 5 {
+		t.Errorf("CountChunks = %d, want 5", n)
+	}
+}
+
+func TestIngestAudioFiles(t *testing.T) {
+	a := setupExportApp(t)
+	a.MCP = mcp.NewServer(a.DB, nil, vector.NewIndex())
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "memo.mp3"), []byte("ID3"), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.md"), []byte("notes"), 0644)
+
+	var results []*mcp.IngestResult
+	ingestDir := func() error {
+		results = nil
+		return a.Ingest(context.Background(), dir, nil, func(res *mcp.IngestResult) {
+			results = append(results, res)
+		})
+	}
+	// Only with a transcriber are recordings picked up
+	if err := ingestDir(); err != nil || len(results) != 1 {
+		t.Fatalf("Ingest without transcription: %d results, %v", len(results), err)
+	}
+	mcpConfig := mcp.DefaultConfig()
+	mcpConfig.Transcriber = fakeTranscriber{}
+	a.MCP = mcp.NewServerWithConfig(a.DB, nil, vector.NewIndex(), mcpConfig)
+	if err := ingestDir(); err != nil || len(results) != 2 {
+		t.Fatalf("Ingest: %d results, %v", len(results), err)
+	}
+	if res := results[0]; filepath.Base(res.Source) != "memo.mp3" || res.AttachmentID == "" {
+		t.Errorf("audio result = %+v", res)
+	}
+}
+
+// fakeTranscriber transcribes every recording the same.
+type fakeTranscriber struct{}
+
+func (fakeTranscriber) Transcribe(ctx context.Context, name string, audio []byte) (string, error) {
+	return "spoken words", nil
+}
+
+func (fakeTranscriber) Model() string { return "fake/whisper" }
@@ -0,0 +1,48 @@
+package app
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/neoden/mykb/storage"
+)
+
+// Maintain runs one maintenance pass over the database: purging expired
+// tokens, stale clients and old tombstones, then VACUUM, ANALYZE and a WAL
+// checkpoint.
+func (a *App) Maintain(ctx context.Context) (*storage.MaintenanceReport, error) {
+	return a.DB.Maintain(ctx, a.Config.Maintenance.TombstoneAge())
+}
+
+// startMaintenance runs Maintain every [maintenance] interval in the
+// background and returns a function that stops it. It does nothing unless
+// an interval is configured.
+func (a *App) startMaintenance() func() {
+	interval := a.Config.Maintenance.Interval()
+	if interval <= 0 || a.DB.ReadOnly() {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			// The first pass waits an interval, keeping VACUUM's lock off
+			// server startup
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			r, err := a.Maintain(ctx)
+			if err != nil {
+				log.Printf("Maintenance failed: %v", err)
+				continue
+			}
+			log.Printf("Maintenance: purged %d expired tokens, %d stale clients, %d tombstones; %d -> %d bytes",
+				r.ExpiredTokens, r.StaleClients, r.Tombstones, r.BytesBefore, r.BytesAfter)
+		}
+	}()
+	return cancel
+}
@@ -0,0 +1,152 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/neoden/mykb/storage"
+)
+
+// maxSlugLen bounds file and directory names derived from chunk text.
+const maxSlugLen = 60
+
+var yamlPlainKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// exportMarkdown writes one .md file per chunk into opts.Dir, with metadata
+// as YAML front matter. With opts.GroupBy, files go into a subdirectory
+// named after that metadata value (the first one for arrays).
+func exportMarkdown(chunks []storage.Chunk, opts ExportOptions) error {
+	if opts.Dir == "" {
+		return fmt.Errorf("markdown export needs an output directory")
+	}
+
+	used := make(map[string]bool)
+	for _, c := range chunks {
+		var meta map[string]any
+		if len(c.Metadata) > 0 {
+			json.Unmarshal(c.Metadata, &meta)
+		}
+
+		dir := opts.Dir
+		if opts.GroupBy != "" {
+			if group := groupValue(meta[opts.GroupBy]); group != "" {
+				dir = filepath.Join(dir, slugOr(group, "_"))
+			}
+		}
+
+		name := slugOr(chunkTitle(c, meta), c.ID)
+		path := filepath.Join(dir, name+".md")
+		if used[path] {
+			path = filepath.Join(dir, name+"-"+shortID(c.ID)+".md")
+		}
+		used[path] = true
+
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("create directory: %w", err)
+		}
+		if err := os.WriteFile(path, []byte(markdownDocument(c, meta)), 0644); err != nil {
+			return fmt.Errorf("write %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// markdownDocument renders a chunk as front matter followed by its content.
+// The chunk's ID and timestamps come first; metadata keys of the same name
+// are left out of the front matter.
+func markdownDocument(c storage.Chunk, meta map[string]any) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "id: %s\n", c.ID)
+	fmt.Fprintf(&b, "created: %s\n", c.CreatedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "updated: %s\n", c.UpdatedAt.UTC().Format(time.RFC3339))
+
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		if k != "id" && k != "created" && k != "updated" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		// JSON values are valid YAML flow scalars and sequences
+		v, _ := json.Marshal(meta[k])
+		fmt.Fprintf(&b, "%s: %s\n", yamlKey(k), v)
+	}
+	b.WriteString("---\n\n")
+	b.WriteString(strings.TrimRight(c.Content, "\n"))
+	b.WriteString("\n")
+	return b.String()
+}
+
+func yamlKey(k string) string {
+	if yamlPlainKey.MatchString(k) {
+		return k
+	}
+	q, _ := json.Marshal(k)
+	return string(q)
+}
+
+// chunkTitle names a chunk: its title metadata, else its first line of text.
+func chunkTitle(c storage.Chunk, meta map[string]any) string {
+	if title, ok := meta["title"].(string); ok && strings.TrimSpace(title) != "" {
+		return title
+	}
+	first, _, _ := strings.Cut(PlainText(c.Content), "\n")
+	return first
+}
+
+// groupValue returns the directory name for a metadata value.
+func groupValue(v any) string {
+	if arr, ok := v.([]any); ok {
+		if len(arr) == 0 {
+			return ""
+		}
+		v = arr[0]
+	}
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// slugOr turns s into a lowercase file name, or returns fallback if
+// nothing usable remains.
+func slugOr(s, fallback string) string {
+	var b strings.Builder
+	dash := false
+	n := 0
+	for _, r := range strings.ToLower(s) {
+		if n >= maxSlugLen {
+			break
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+			n++
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+			n++
+		}
+	}
+	slug := strings.TrimRight(b.String(), "-")
+	if slug == "" {
+		return fallback
+	}
+	return slug
+}
+
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
@@ -0,0 +1,91 @@
+package app
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+// mirrorPollInterval is how often a read-only mirror checks whether its
+// replica file has changed.
+const mirrorPollInterval = 5 * time.Second
+
+// startMirror keeps a read-only mirror in step with its replica file and
+// returns a function that stops it. It does nothing for a writable database.
+func (a *App) startMirror() func() {
+	if !a.DB.ReadOnly() {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go a.watchReplica(ctx, mirrorPollInterval)
+	return cancel
+}
+
+// watchReplica reloads the mirror whenever the replica's database or WAL
+// file is replaced, grows or is touched.
+func (a *App) watchReplica(ctx context.Context, interval time.Duration) {
+	last := statReplica(a.DB.Path())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := statReplica(a.DB.Path())
+		if current.same(last) {
+			continue
+		}
+		last = current
+		a.reloadMirror(ctx)
+	}
+}
+
+// reloadMirror drops state derived from the old replica contents: pooled
+// connections and cached searches, the vector index and link ranking.
+func (a *App) reloadMirror(ctx context.Context) {
+	a.DB.Refresh()
+	if a.Embedder != nil {
+		vecs, err := a.DB.LoadEmbeddingsByModel(ctx, a.Embedder.Model())
+		if err != nil {
+			log.Printf("Reload embeddings: %v", err)
+		} else {
+			a.Index.Load(vecs)
+		}
+	}
+	if err := a.MCP.RefreshRanking(ctx); err != nil {
+		log.Printf("Reload ranking: %v", err)
+	}
+	log.Printf("Replica changed, reloaded %d embeddings", a.Index.Size())
+}
+
+// replicaState identifies the version of a replica's files on disk.
+type replicaState [2]os.FileInfo // database, WAL; nil if missing
+
+func statReplica(path string) replicaState {
+	var s replicaState
+	for i, p := range []string{path, path + "-wal"} {
+		if info, err := os.Stat(p); err == nil {
+			s[i] = info
+		}
+	}
+	return s
+}
+
+func (s replicaState) same(o replicaState) bool {
+	for i := range s {
+		a, b := s[i], o[i]
+		if a == nil || b == nil {
+			if a != b {
+				return false
+			}
+			continue
+		}
+		if !os.SameFile(a, b) || a.Size() != b.Size() || !a.ModTime().Equal(b.ModTime()) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/neoden/mykb/config"
+	"github.com/neoden/mykb/storage"
+)
+
+func TestMirrorReloadsReplica(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	primary, err := storage.Init(dir)
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	defer primary.Close()
+	chunk, _ := primary.CreateChunk(ctx, "replicated", nil)
+	primary.SaveEmbedding(ctx, chunk.ID, "mock/test", chunk.Content, []float32{0.1, 0.2, 0.3})
+
+	cfg := &config.Config{DataDir: dir}
+	cfg.Storage.ReadOnly = true
+	a, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer a.Close()
+	a.Embedder = &mockEmbedder{}
+	if !a.DB.ReadOnly() {
+		t.Fatal("expected read-only database")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.watchReplica(ctx, 10*time.Millisecond)
+
+	time.Sleep(20 * time.Millisecond)
+	next, _ := primary.CreateChunk(ctx, "later", nil)
+	primary.SaveEmbedding(ctx, next.ID, "mock/test", next.Content, []float32{0.3, 0.2, 0.1})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for a.Index.Size() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("index has %d vectors after replica changed, want 2", a.Index.Size())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"context"
+	"log"
+)
+
+// modelChange compares the configured embedding model with the stored
+// embeddings. It returns the model most chunks were embedded by, when that
+// is not the configured one and covers more chunks than it does.
+func (a *App) modelChange(ctx context.Context) (previous string, err error) {
+	counts, err := a.DB.EmbeddingModels(ctx)
+	if err != nil {
+		return "", err
+	}
+	current := a.Embedder.Model()
+	for model, n := range counts {
+		if model != current && n > counts[current] && (previous == "" || n > counts[previous]) {
+			previous = model
+		}
+	}
+	return previous, nil
+}
+
+// startReembed detects a changed embedding model at startup, which would
+// leave semantic search with few or no vectors. With auto_reindex it
+// re-embeds the chunks in the background, filling the index as it goes;
+// otherwise it warns. It returns a function that stops the re-embedding.
+func (a *App) startReembed() func() {
+	if a.Embedder == nil {
+		return func() {}
+	}
+	previous, err := a.modelChange(context.Background())
+	if err != nil {
+		log.Printf("Checking embedding model: %v", err)
+		return func() {}
+	}
+	if previous == "" {
+		return func() {}
+	}
+	if !a.Config.Embedding.AutoReindex || a.DB.ReadOnly() {
+		log.Printf("WARNING: most chunks are embedded with %s, not the configured %s; semantic search will miss them until you run: mykb reindex",
+			previous, a.Embedder.Model())
+		return func() {}
+	}
+
+	log.Printf("Embedding model changed from %s to %s; re-embedding in the background", previous, a.Embedder.Model())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := a.Reindex(ctx, false); err != nil && ctx.Err() == nil {
+			log.Printf("Background re-embedding stopped: %v", err)
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
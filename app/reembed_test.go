@@ -0,0 +1,53 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/neoden/mykb/config"
+	"github.com/neoden/mykb/storage"
+	"github.com/neoden/mykb/vector"
+)
+
+func TestReembedAfterModelChange(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Init(t.TempDir())
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	for _, content := range []string{"one", "two", "three"} {
+		c, _ := db.CreateChunk(ctx, content, nil)
+		db.SaveEmbedding(ctx, c.ID, "old/model", c.Content, []float32{1, 0, 0})
+	}
+
+	cfg := config.Default()
+	embedder := &mockEmbedder{}
+	a := &App{Config: cfg, DB: db, Embedder: embedder, Index: loadVectorIndex(ctx, db, embedder, vector.Config{}, "")}
+	defer a.Close()
+
+	previous, err := a.modelChange(ctx)
+	if err != nil || previous != "old/model" {
+		t.Fatalf("modelChange = %q, %v", previous, err)
+	}
+
+	// Without auto_reindex nothing is embedded
+	a.startReembed()()
+	if a.Index.Size() != 0 {
+		t.Fatalf("index has %d vectors without auto_reindex", a.Index.Size())
+	}
+
+	cfg.Embedding.AutoReindex = true
+	stop := a.startReembed()
+	defer stop()
+	deadline := time.Now().Add(5 * time.Second)
+	for a.Index.Size() < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if a.Index.Size() != 3 {
+		t.Errorf("index has %d vectors after re-embedding, want 3", a.Index.Size())
+	}
+	if previous, _ := a.modelChange(ctx); previous != "" {
+		t.Errorf("modelChange after re-embedding = %q, want none", previous)
+	}
+}
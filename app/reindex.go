@@ -0,0 +1,349 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/neoden/mykb/embedding"
+	"github.com/neoden/mykb/storage"
+)
+
+// reindexCheckpointKey is the setting that records a reindex until it
+// finishes, so an interrupted one can be resumed.
+const reindexCheckpointKey = "reindex_checkpoint"
+
+// defaultReindexBatch is how many chunks go into each Embed call.
+const defaultReindexBatch = 100
+
+// ReindexOptions controls ReindexWith.
+type ReindexOptions struct {
+	// Force re-embeds all chunks, replacing existing embeddings; otherwise
+	// only chunks without an embedding for the model are embedded.
+	Force bool
+	// BatchSize is how many chunks are embedded per request (default 100).
+	BatchSize int
+	// Concurrency is how many batches are embedded at once (default 1).
+	Concurrency int
+	// Resume continues the interrupted reindex recorded in the checkpoint,
+	// skipping the chunks it already embedded.
+	Resume bool
+	// Progress, if set, is called after each batch.
+	Progress func(ReindexProgress)
+}
+
+// ReindexProgress reports how far a reindex has got.
+type ReindexProgress struct {
+	Model    string `json:"model"`
+	Total    int    `json:"total"`
+	Done     int    `json:"done"`
+	Embedded int    `json:"embedded"`
+	Failed   int    `json:"failed"`
+}
+
+// ReindexPlan is what a reindex would embed, for --dry-run.
+type ReindexPlan struct {
+	Model  string `json:"model"`
+	Chunks int    `json:"chunks"`
+	// Tokens is estimated from text length (see embedding.EstimateTokens).
+	Tokens int `json:"tokens"`
+	// Cost is in US dollars at list price; Priced is false when the
+	// model's price is unknown.
+	Cost   float64 `json:"cost_usd"`
+	Priced bool    `json:"priced"`
+}
+
+// reindexRun selects the chunks a reindex embeds, a page at a time so that
+// none but the batches in flight are held in memory.
+type reindexRun struct {
+	db         *storage.DB
+	model      string
+	checkpoint *reindexCheckpoint
+	// embedded is what a resumed run already embedded
+	embedded map[string]bool
+	// total is how many chunks are to be embedded
+	total int
+}
+
+// reindexCheckpoint identifies a reindex in progress.
+type reindexCheckpoint struct {
+	Model     string    `json:"model"`
+	Force     bool      `json:"force"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// Reindex generates embeddings for chunks.
+// If force is true, re-indexes all chunks. Otherwise only chunks without embeddings.
+func (a *App) Reindex(ctx context.Context, force bool) error {
+	return a.ReindexWith(ctx, ReindexOptions{Force: force})
+}
+
+// PlanReindex reports how many chunks ReindexWith would embed with opts,
+// and the estimated tokens and cost, without calling the provider.
+func (a *App) PlanReindex(ctx context.Context, opts ReindexOptions) (*ReindexPlan, error) {
+	if a.Embedder == nil {
+		return nil, fmt.Errorf("embedding provider not configured")
+	}
+	run, err := a.reindexRun(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	plan := &ReindexPlan{Model: run.model}
+	for after := ""; ; {
+		chunks, err := run.page(ctx, after, defaultReindexBatch)
+		if err != nil {
+			return nil, err
+		}
+		if len(chunks) == 0 {
+			break
+		}
+		plan.Chunks += len(chunks)
+		plan.Tokens += embedding.EstimateTokens(a.embedTexts(chunks))
+		after = chunks[len(chunks)-1].ID
+	}
+	plan.Cost, plan.Priced = embedding.Price(plan.Model, plan.Tokens)
+	return plan, nil
+}
+
+// ReindexWith generates embeddings for chunks as opts directs. Until it
+// finishes, a checkpoint lets an interrupted run be resumed.
+func (a *App) ReindexWith(ctx context.Context, opts ReindexOptions) error {
+	if a.Embedder == nil {
+		return fmt.Errorf("embedding provider not configured")
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultReindexBatch
+	}
+	workers := max(opts.Concurrency, 1)
+
+	run, err := a.reindexRun(ctx, opts)
+	if err != nil {
+		return err
+	}
+	model, checkpoint, total := run.model, run.checkpoint, run.total
+	if total == 0 {
+		if checkpoint.Force {
+			log.Println("No chunks to index")
+		} else {
+			log.Println("All chunks already have embeddings for this model")
+		}
+		return a.DB.SetSetting(ctx, reindexCheckpointKey, "")
+	}
+	switch {
+	case opts.Resume:
+		log.Printf("Resuming reindex: %d chunks left with %s", total, model)
+	case checkpoint.Force:
+		log.Printf("Re-indexing all %d chunks with %s", total, model)
+	default:
+		log.Printf("Indexing %d chunks with %s", total, model)
+	}
+	data, _ := json.Marshal(checkpoint)
+	if err := a.DB.SetSetting(ctx, reindexCheckpointKey, string(data)); err != nil {
+		return fmt.Errorf("save checkpoint: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		mu       sync.Mutex
+		progress = ReindexProgress{Model: model, Total: total}
+		fatal    error
+		wg       sync.WaitGroup
+	)
+	// A batch is numbered from the chunk it starts at
+	type batch struct {
+		start  int
+		chunks []storage.Chunk
+	}
+	batches := make(chan batch)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range batches {
+				i, end := b.start, b.start+len(b.chunks)
+				saved, err := a.reindexBatch(ctx, b.chunks)
+
+				mu.Lock()
+				var limited *embedding.RateLimitedError
+				switch {
+				case errors.As(err, &limited):
+					// Later batches would be rejected too
+					if fatal == nil {
+						fatal = fmt.Errorf("batch %d-%d: %w", i+1, end, err)
+						cancel()
+					}
+				case err != nil && ctx.Err() == nil:
+					log.Printf("Error embedding batch %d-%d: %v", i+1, end, err)
+				}
+				progress.Done += end - i
+				progress.Embedded += saved
+				progress.Failed += end - i - saved
+				log.Printf("[%d-%d/%d] Indexed %d chunks", i+1, end, total, saved)
+				if opts.Progress != nil {
+					opts.Progress(progress)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	// Pages are read as workers free up, after the last chunk of the page
+	// before; chunks created meanwhile may be picked up too
+	var pageErr error
+	after := ""
+feed:
+	for i := 0; ; {
+		chunks, err := run.page(ctx, after, batchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				pageErr = err
+			}
+			break
+		}
+		if len(chunks) == 0 {
+			break
+		}
+		select {
+		case batches <- batch{start: i, chunks: chunks}:
+		case <-ctx.Done():
+			break feed
+		}
+		i += len(chunks)
+		after = chunks[len(chunks)-1].ID
+	}
+	close(batches)
+	wg.Wait()
+
+	// The checkpoint stays for --resume
+	if fatal != nil {
+		return fmt.Errorf("%w; resume later with mykb reindex --resume", fatal)
+	}
+	if pageErr != nil {
+		return fmt.Errorf("%w; resume later with mykb reindex --resume", pageErr)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := a.DB.SetSetting(ctx, reindexCheckpointKey, ""); err != nil {
+		return fmt.Errorf("clear checkpoint: %w", err)
+	}
+	log.Println("Done")
+	return nil
+}
+
+// reindexRun counts the chunks to embed and sets up the checkpoint of the
+// run: a new one, or with Resume the saved one, whose embedded chunks are
+// left out.
+func (a *App) reindexRun(ctx context.Context, opts ReindexOptions) (*reindexRun, error) {
+	model := a.Embedder.Model()
+	checkpoint := &reindexCheckpoint{Model: model, Force: opts.Force, StartedAt: time.Now().UTC()}
+	var embedded map[string]bool
+	if opts.Resume {
+		v, _ := a.DB.GetSetting(ctx, reindexCheckpointKey)
+		if v == "" {
+			return nil, fmt.Errorf("no interrupted reindex to resume")
+		}
+		if err := json.Unmarshal([]byte(v), checkpoint); err != nil {
+			return nil, fmt.Errorf("read checkpoint: %w", err)
+		}
+		if checkpoint.Model != model {
+			return nil, fmt.Errorf("interrupted reindex was with %s, not %s", checkpoint.Model, model)
+		}
+		var err error
+		if embedded, err = a.DB.EmbeddedSince(ctx, model, checkpoint.StartedAt); err != nil {
+			return nil, err
+		}
+	}
+
+	run := &reindexRun{db: a.DB, model: model, checkpoint: checkpoint, embedded: embedded}
+	var err error
+	if checkpoint.Force {
+		// Every chunk embedded since the checkpoint is one of them
+		run.total, err = a.DB.CountChunks(ctx)
+		run.total -= len(embedded)
+	} else {
+		run.total, err = a.DB.CountChunksWithoutEmbeddings(ctx, model)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("count chunks: %w", err)
+	}
+	return run, nil
+}
+
+// page returns up to limit of the chunks to embed with IDs after after, in
+// ID order; none once they are all read.
+func (r *reindexRun) page(ctx context.Context, after string, limit int) ([]storage.Chunk, error) {
+	var chunks []storage.Chunk
+	for len(chunks) < limit {
+		var page []storage.Chunk
+		var err error
+		if r.checkpoint.Force {
+			page, err = r.db.GetChunksPage(ctx, after, limit-len(chunks))
+		} else {
+			page, err = r.db.GetChunksWithoutEmbeddingsPage(ctx, r.model, after, limit-len(chunks))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get chunks: %w", err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		after = page[len(page)-1].ID
+		for _, c := range page {
+			if !r.embedded[c.ID] {
+				chunks = append(chunks, c)
+			}
+		}
+	}
+	return chunks, nil
+}
+
+// reindexBatch embeds and saves one batch, returning how many chunks were
+// saved. Chunks that fail to save are logged and skipped.
+func (a *App) reindexBatch(ctx context.Context, batch []storage.Chunk) (int, error) {
+	texts := a.embedTexts(batch)
+	vecs, err := a.Embedder.Embed(ctx, texts)
+	if err != nil {
+		return 0, err
+	}
+
+	saved := 0
+	for j, chunk := range batch {
+		if j >= len(vecs) || vecs[j] == nil {
+			log.Printf("No embedding returned for chunk %s", chunk.ID)
+			continue
+		}
+		if err := a.DB.SaveEmbedding(ctx, chunk.ID, a.Embedder.Model(), texts[j], vecs[j]); err != nil {
+			log.Printf("Error saving embedding for chunk %s: %v", chunk.ID, err)
+			continue
+		}
+		if a.Index != nil {
+			a.Index.Add(chunk.ID, vecs[j])
+		}
+		saved++
+	}
+	return saved, nil
+}
+
+// embedTexts returns the texts embedded for chunks.
+func (a *App) embedTexts(chunks []storage.Chunk) []string {
+	texts := make([]string, len(chunks))
+	for i := range chunks {
+		texts[i] = a.embedText(&chunks[i])
+	}
+	return texts
+}
+
+// embedText returns the text embedded for chunk.
+func (a *App) embedText(chunk *storage.Chunk) string {
+	var fields []string
+	if a.Config != nil {
+		fields = a.Config.Embedding.MetadataFields
+	}
+	return embedding.Text(chunk.Content, chunk.Metadata, fields)
+}
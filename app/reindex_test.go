@@ -0,0 +1,136 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neoden/mykb/config"
+	"github.com/neoden/mykb/embedding"
+	"github.com/neoden/mykb/storage"
+	"github.com/neoden/mykb/vector"
+)
+
+// countingEmbedder records the batches it embeds
+type countingEmbedder struct {
+	mockEmbedder
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (e *countingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.mu.Lock()
+	e.batches = append(e.batches, texts)
+	e.mu.Unlock()
+	return e.mockEmbedder.Embed(ctx, texts)
+}
+
+func newReindexApp(t *testing.T, embedder embedding.EmbeddingProvider, contents ...string) *App {
+	ctx := context.Background()
+	t.Helper()
+	db, err := storage.Init(t.TempDir())
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for _, c := range contents {
+		db.CreateChunk(ctx, c, nil)
+	}
+	return &App{Config: config.Default(), DB: db, Embedder: embedder, Index: loadVectorIndex(ctx, db, embedder, vector.Config{}, "")}
+}
+
+func TestReindexBatchesAndProgress(t *testing.T) {
+	ctx := context.Background()
+	embedder := &countingEmbedder{}
+	a := newReindexApp(t, embedder, "a", "b", "c", "d", "e")
+
+	var last ReindexProgress
+	calls := 0
+	err := a.ReindexWith(context.Background(), ReindexOptions{
+		BatchSize:   2,
+		Concurrency: 2,
+		Progress:    func(p ReindexProgress) { last = p; calls++ },
+	})
+	if err != nil {
+		t.Fatalf("ReindexWith: %v", err)
+	}
+	if len(embedder.batches) != 3 || calls != 3 {
+		t.Errorf("batches = %d, progress calls = %d, want 3", len(embedder.batches), calls)
+	}
+	if last.Total != 5 || last.Done != 5 || last.Embedded != 5 || last.Failed != 0 {
+		t.Errorf("progress = %+v", last)
+	}
+	if v, _ := a.DB.GetSetting(ctx, reindexCheckpointKey); v != "" {
+		t.Errorf("checkpoint left after a finished reindex: %s", v)
+	}
+}
+
+func TestReindexForcePages(t *testing.T) {
+	ctx := context.Background()
+	embedder := &countingEmbedder{}
+	a := newReindexApp(t, embedder, "a", "b", "c", "d", "e")
+	if err := a.Reindex(ctx, false); err != nil {
+		t.Fatalf("Reindex: %v", err)
+	}
+
+	// Every chunk is read again a page at a time, embedded or not
+	embedder.batches = nil
+	var last ReindexProgress
+	if err := a.ReindexWith(ctx, ReindexOptions{Force: true, BatchSize: 2, Progress: func(p ReindexProgress) { last = p }}); err != nil {
+		t.Fatalf("ReindexWith: %v", err)
+	}
+	seen := make(map[string]bool)
+	for _, b := range embedder.batches {
+		for _, text := range b {
+			seen[text] = true
+		}
+	}
+	if len(embedder.batches) != 3 || len(seen) != 5 {
+		t.Errorf("batches = %q, want all 5 chunks in 3", embedder.batches)
+	}
+	if last.Total != 5 || last.Embedded != 5 {
+		t.Errorf("progress = %+v", last)
+	}
+}
+
+func TestReindexResume(t *testing.T) {
+	ctx := context.Background()
+	embedder := &countingEmbedder{}
+	a := newReindexApp(t, embedder, "a", "b", "c")
+	chunks, _ := a.DB.GetAllChunks(ctx)
+
+	if err := a.ReindexWith(context.Background(), ReindexOptions{Resume: true}); err == nil {
+		t.Error("expected an error without a checkpoint")
+	}
+
+	// A forced reindex got through one chunk before it was interrupted
+	started := time.Now().Add(-time.Minute).UTC()
+	data, _ := json.Marshal(reindexCheckpoint{Model: embedder.Model(), Force: true, StartedAt: started})
+	a.DB.SetSetting(ctx, reindexCheckpointKey, string(data))
+	a.DB.SaveEmbedding(ctx, chunks[0].ID, embedder.Model(), chunks[0].Content, []float32{1, 0, 0})
+
+	plan, err := a.PlanReindex(ctx, ReindexOptions{Resume: true})
+	if err != nil || plan.Chunks != 2 {
+		t.Fatalf("plan = %+v, %v; want 2 chunks left", plan, err)
+	}
+	if err := a.ReindexWith(context.Background(), ReindexOptions{Resume: true}); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if len(embedder.batches) != 1 || len(embedder.batches[0]) != 2 {
+		t.Errorf("resumed batches = %q, want the 2 chunks left", embedder.batches)
+	}
+}
+
+func TestPlanReindex(t *testing.T) {
+	ctx := context.Background()
+	a := newReindexApp(t, &mockEmbedder{}, "12345678", "1234")
+	plan, err := a.PlanReindex(ctx, ReindexOptions{})
+	if err != nil {
+		t.Fatalf("PlanReindex: %v", err)
+	}
+	if plan.Chunks != 2 || plan.Tokens != 3 || plan.Priced {
+		t.Errorf("plan = %+v", plan)
+	}
+}
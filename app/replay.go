@@ -0,0 +1,80 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/neoden/mykb/mcp"
+	"github.com/neoden/mykb/storage"
+)
+
+// ReplayResult is a recorded tool call with the response it gives now.
+type ReplayResult struct {
+	Call     *storage.ToolCall
+	Recorded *mcp.CallToolResult
+	Current  *mcp.CallToolResult
+	// Same is true when the current response matches the recorded one.
+	Same bool
+}
+
+// Replay runs the recorded tool call id again against a scratch copy of
+// the current database, so calls that write change nothing.
+func (a *App) Replay(ctx context.Context, id int64) (*ReplayResult, error) {
+	call, err := a.DB.GetToolCall(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var recorded mcp.CallToolResult
+	if err := json.Unmarshal(call.Response, &recorded); err != nil {
+		return nil, fmt.Errorf("decode recorded response: %w", err)
+	}
+
+	dir, err := os.MkdirTemp("", "mykb-replay-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "data.db")
+	if err := a.DB.Backup(ctx, path); err != nil {
+		return nil, err
+	}
+	scratch, err := storage.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer scratch.Close()
+	if err := scratch.ConfigureEncryption(a.Config.Storage); err != nil {
+		return nil, fmt.Errorf("encryption: %w", err)
+	}
+
+	srv := a.MCP.WithStorage(scratch, loadVectorIndex(ctx, scratch, a.Embedder, a.Config.Index, a.snapshotPath()))
+	if err := srv.RefreshRanking(ctx); err != nil {
+		return nil, fmt.Errorf("ranking: %w", err)
+	}
+	current, err := srv.Replay(ctx, call)
+	if err != nil {
+		return nil, err
+	}
+	return &ReplayResult{
+		Call:     call,
+		Recorded: &recorded,
+		Current:  current,
+		Same:     sameResponse(&recorded, current),
+	}, nil
+}
+
+// sameResponse compares the text returned to the client.
+func sameResponse(a, b *mcp.CallToolResult) bool {
+	text := func(r *mcp.CallToolResult) []string {
+		var t []string
+		for _, c := range r.Content {
+			t = append(t, c.Text)
+		}
+		return t
+	}
+	return a.IsError == b.IsError && slices.Equal(text(a), text(b))
+}
@@ -0,0 +1,66 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/neoden/mykb/config"
+	"github.com/neoden/mykb/mcp"
+	"github.com/neoden/mykb/vector"
+)
+
+func TestReplay(t *testing.T) {
+	ctx := context.Background()
+	a := setupExportApp(t)
+	a.Config = config.Default()
+	cfg := mcp.DefaultConfig()
+	cfg.Recording.Enabled = true
+	a.MCP = mcp.NewServerWithConfig(a.DB, nil, vector.NewIndex(), cfg)
+
+	callTool := func(name string, args map[string]any) {
+		params, _ := json.Marshal(map[string]any{"name": name, "arguments": args})
+		resp := a.MCP.HandleRequest(context.Background(), &mcp.Request{
+			JSONRPC: "2.0", ID: json.RawMessage(`1`), Method: "tools/call", Params: params,
+		})
+		if resp.Error != nil {
+			t.Fatalf("%s: %v", name, resp.Error.Message)
+		}
+	}
+	callTool("search_chunks", map[string]any{"query": "gofmt"})
+	callTool("store_chunk", map[string]any{"content": "written during the call"})
+	before, _ := a.DB.CountChunks(ctx)
+
+	calls, err := a.DB.ListToolCalls(ctx, 10)
+	if err != nil || len(calls) != 2 {
+		t.Fatalf("ListToolCalls = %+v, %v", calls, err)
+	}
+	search, store := calls[1], calls[0]
+
+	res, err := a.Replay(context.Background(), search.ID)
+	if err != nil {
+		t.Fatalf("Replay search: %v", err)
+	}
+	if !res.Same || res.Current.IsError {
+		t.Errorf("search replay differs: recorded %+v, now %+v", res.Recorded.Content, res.Current.Content)
+	}
+
+	// A replayed write gets a new chunk ID and is not kept
+	res, err = a.Replay(context.Background(), store.ID)
+	if err != nil {
+		t.Fatalf("Replay store: %v", err)
+	}
+	if res.Same || res.Current.IsError {
+		t.Errorf("store replay: same = %v, now %+v", res.Same, res.Current.Content)
+	}
+	if after, _ := a.DB.CountChunks(ctx); after != before {
+		t.Errorf("replay changed the database: %d chunks, want %d", after, before)
+	}
+	if calls, _ := a.DB.ListToolCalls(ctx, 10); len(calls) != 2 {
+		t.Errorf("replay recorded calls: %d, want 2", len(calls))
+	}
+
+	if _, err := a.Replay(context.Background(), 999); err == nil {
+		t.Error("expected error for unknown call")
+	}
+}
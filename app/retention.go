@@ -0,0 +1,270 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/neoden/mykb/events"
+	"github.com/neoden/mykb/retention"
+	"github.com/neoden/mykb/storage"
+)
+
+// retentionReviewedKey is the setting holding the fingerprints of the rules
+// that have had a dry-run report, and may now be enforced.
+const retentionReviewedKey = "retention_reviewed"
+
+// RuleReport is what one retention rule did, or would do.
+type RuleReport struct {
+	Name     string
+	Action   string
+	ChunkIDs []string
+	// DryRun is true when the chunks were only reported.
+	DryRun bool
+	// Archive is the file archived chunks were appended to.
+	Archive string
+}
+
+// ApplyRetention evaluates the retention rules. With enforce, each rule
+// that has already had a dry-run report deletes or archives its chunks;
+// rules that are new or changed since are reported only, and enforced from
+// the next run. Without enforce every rule is reported only.
+func (a *App) ApplyRetention(ctx context.Context, enforce bool) ([]RuleReport, error) {
+	if a.DB.ReadOnly() {
+		return nil, errors.New("database is a read-only mirror")
+	}
+	cfg := a.Config.Retention
+	chunks, err := a.unlockedChunks(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get chunks: %w", err)
+	}
+	plan := cfg.Plan(chunks, time.Now())
+
+	reviewed := make(map[string]bool)
+	if v, err := a.DB.GetSetting(ctx, retentionReviewedKey); err == nil {
+		for _, fp := range strings.Fields(v) {
+			reviewed[fp] = true
+		}
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+
+	var reports []RuleReport
+	var fingerprints []string
+	for _, rule := range cfg.Rules {
+		if ctx.Err() != nil {
+			return reports, ctx.Err()
+		}
+		matched := plan[rule.Name]
+		r := RuleReport{Name: rule.Name, Action: rule.Action, ChunkIDs: []string{}}
+		for _, c := range matched {
+			r.ChunkIDs = append(r.ChunkIDs, c.ID)
+		}
+		fp := rule.Fingerprint()
+		fingerprints = append(fingerprints, fp)
+		r.DryRun = !enforce || !reviewed[fp]
+
+		if !r.DryRun && len(matched) > 0 {
+			if rule.Action == retention.ActionArchive {
+				if r.Archive, err = a.archiveChunks("retention", matched); err != nil {
+					return reports, fmt.Errorf("rule %q: %w", rule.Name, err)
+				}
+			}
+			if _, err := a.MCP.DeleteChunks(ctx, r.ChunkIDs); err != nil {
+				return reports, fmt.Errorf("rule %q: %w", rule.Name, err)
+			}
+		}
+		reports = append(reports, r)
+	}
+
+	// Every current rule has now been reported; forget removed ones
+	if err := a.DB.SetSetting(ctx, retentionReviewedKey, strings.Join(fingerprints, " ")); err != nil {
+		return reports, err
+	}
+	return reports, nil
+}
+
+// archiveChunks appends chunks as jsonl to today's archive file named for
+// prefix, which `mykb import` reads back.
+func (a *App) archiveChunks(prefix string, chunks []storage.Chunk) (string, error) {
+	dir := filepath.Join(a.Config.DataDir, "archive")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, prefix+"-"+time.Now().Format("2006-01-02")+".jsonl")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return "", err
+	}
+	enc := json.NewEncoder(f)
+	for _, c := range chunks {
+		if err := enc.Encode(jsonlRecord{Chunk: c}); err != nil {
+			f.Close()
+			return "", err
+		}
+	}
+	// The chunks are deleted next; make sure the copy is on disk first
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
+
+// startRetention applies the retention rules in the background and returns
+// a function that stops it. It does nothing without rules.
+func (a *App) startRetention() func() {
+	if len(a.Config.Retention.Rules) == 0 || a.DB.ReadOnly() {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go a.runRetention(ctx, a.Config.Retention.Interval())
+	return cancel
+}
+
+func (a *App) runRetention(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		reports, err := a.ApplyRetention(ctx, true)
+		for _, r := range reports {
+			switch {
+			case r.DryRun:
+				log.Printf("Retention %q: would %s %d chunks (dry run; enforced from the next run)", r.Name, r.Action, len(r.ChunkIDs))
+			case len(r.ChunkIDs) > 0:
+				log.Printf("Retention %q: %sd %d chunks", r.Name, r.Action, len(r.ChunkIDs))
+			}
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Retention failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ExpiryReport is what one expiry pass did, or would do.
+type ExpiryReport struct {
+	Action   string
+	ChunkIDs []string
+	// DryRun is true when the chunks were only reported.
+	DryRun bool
+	// Archive is the file archived chunks were appended to.
+	Archive string
+}
+
+// ExpireChunks finds the chunks whose metadata expiry has passed. With
+// apply it archives them if so configured and deletes them, logging each,
+// publishing a chunk_expired event for it and posting the batch to the
+// expiry webhook; a failed webhook is only logged, as the chunks are gone.
+func (a *App) ExpireChunks(ctx context.Context, apply bool) (ExpiryReport, error) {
+	cfg := a.Config.Retention.Expiry
+	r := ExpiryReport{Action: cfg.ExpiryAction(), ChunkIDs: []string{}, DryRun: !apply}
+	if a.DB.ReadOnly() {
+		return r, errors.New("database is a read-only mirror")
+	}
+	chunks, err := a.unlockedChunks(ctx)
+	if err != nil {
+		return r, fmt.Errorf("get chunks: %w", err)
+	}
+	expired := cfg.Expired(chunks, time.Now())
+	for _, c := range expired {
+		r.ChunkIDs = append(r.ChunkIDs, c.ID)
+	}
+	if r.DryRun || len(expired) == 0 {
+		return r, nil
+	}
+
+	if r.Action == retention.ActionArchive {
+		if r.Archive, err = a.archiveChunks("expired", expired); err != nil {
+			return r, err
+		}
+	}
+	type expiredChunk struct {
+		ID        string    `json:"id"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	notice := make([]expiredChunk, 0, len(expired))
+	for _, c := range expired {
+		at, _ := cfg.ExpiresAt(c)
+		log.Printf("Expiry: %s chunk %s (%s %s)", r.Action, c.ID, cfg.MetadataKey(), at.Format(time.RFC3339))
+		a.Events.Publish(events.Event{
+			Type:    events.ChunkExpired,
+			Message: c.ID,
+			Fields:  map[string]any{"id": c.ID, "expires_at": at, "action": r.Action},
+		})
+		notice = append(notice, expiredChunk{ID: c.ID, ExpiresAt: at})
+	}
+	if _, err := a.MCP.DeleteChunks(ctx, r.ChunkIDs); err != nil {
+		return r, err
+	}
+
+	payload := map[string]any{"event": events.ChunkExpired, "action": r.Action, "chunks": notice, "count": len(notice)}
+	if r.Archive != "" {
+		payload["archive"] = r.Archive
+	}
+	if err := cfg.Notify(ctx, payload); err != nil {
+		log.Printf("WARNING: expiry webhook: %v", err)
+	}
+	return r, nil
+}
+
+// startExpiry deletes or archives expired chunks in the background and
+// returns a function that stops it. It does nothing unless expiry is
+// enabled.
+func (a *App) startExpiry() func() {
+	if !a.Config.Retention.Expiry.Enabled || a.DB.ReadOnly() {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go a.runExpiry(ctx, a.Config.Retention.Expiry.Interval())
+	return cancel
+}
+
+func (a *App) runExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := a.ExpireChunks(ctx, true); err != nil && ctx.Err() == nil {
+			log.Printf("Expiry failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// unlockedChunks returns every chunk but the locked ones, which retention
+// and expiry keep.
+func (a *App) unlockedChunks(ctx context.Context) ([]storage.Chunk, error) {
+	chunks, err := a.DB.GetAllChunks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	locked, err := a.DB.LockedChunkIDs(ctx)
+	if err != nil || len(locked) == 0 {
+		return chunks, err
+	}
+	keep := make(map[string]bool, len(locked))
+	for _, id := range locked {
+		keep[id] = true
+	}
+	unlocked := chunks[:0]
+	for _, c := range chunks {
+		if !keep[c.ID] {
+			unlocked = append(unlocked, c)
+		}
+	}
+	return unlocked, nil
+}
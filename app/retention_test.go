@@ -0,0 +1,140 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neoden/mykb/config"
+	"github.com/neoden/mykb/events"
+	"github.com/neoden/mykb/mcp"
+	"github.com/neoden/mykb/retention"
+	"github.com/neoden/mykb/storage"
+	"github.com/neoden/mykb/vector"
+)
+
+func TestApplyRetention(t *testing.T) {
+	ctx := context.Background()
+	a := setupExportApp(t)
+	a.MCP = mcp.NewServer(a.DB, nil, vector.NewIndex())
+	a.Config = config.Default()
+	a.Config.DataDir = t.TempDir()
+	a.Config.Retention.Rules = []retention.Rule{
+		{Name: "logs", Match: []string{"type=log"}, OlderThanDays: 180, Action: retention.ActionDelete},
+		{Name: "untagged", Untagged: true, OlderThanDays: 365, Action: retention.ActionArchive},
+	}
+	old := time.Now().Add(-400 * 24 * time.Hour)
+	for _, c := range []storage.Chunk{
+		{ID: "log", Content: "server log", Metadata: json.RawMessage(`{"type":"log","tags":["ops"]}`)},
+		{ID: "note", Content: "untagged note"},
+		{ID: "tagged", Content: "tagged note", Metadata: json.RawMessage(`{"tags":["go"]}`)},
+	} {
+		c.CreatedAt, c.UpdatedAt = old, old
+		if err := a.DB.PutChunk(ctx, &c); err != nil {
+			t.Fatalf("PutChunk: %v", err)
+		}
+	}
+	count := func() int {
+		n, _ := a.DB.CountChunks(ctx)
+		return n
+	}
+	before := count()
+
+	// The first enforced run only reports
+	reports, err := a.ApplyRetention(context.Background(), true)
+	if err != nil {
+		t.Fatalf("ApplyRetention: %v", err)
+	}
+	if len(reports) != 2 || !reports[0].DryRun || !reports[1].DryRun {
+		t.Fatalf("reports = %+v, want two dry runs", reports)
+	}
+	if len(reports[0].ChunkIDs) != 1 || reports[0].ChunkIDs[0] != "log" {
+		t.Errorf("logs rule selects %v", reports[0].ChunkIDs)
+	}
+	if count() != before {
+		t.Fatal("dry run deleted chunks")
+	}
+
+	reports, err = a.ApplyRetention(context.Background(), true)
+	if err != nil {
+		t.Fatalf("ApplyRetention: %v", err)
+	}
+	if reports[0].DryRun || reports[1].DryRun {
+		t.Fatalf("reports = %+v, want enforcement", reports)
+	}
+	if count() != before-2 {
+		t.Errorf("CountChunks = %d, want %d", count(), before-2)
+	}
+	if _, err := a.DB.GetChunk(ctx, "tagged"); err != nil {
+		t.Errorf("tagged chunk removed: %v", err)
+	}
+	data, err := os.ReadFile(reports[1].Archive)
+	if err != nil {
+		t.Fatalf("read archive: %v", err)
+	}
+	if !strings.Contains(string(data), `"id":"note"`) || strings.Contains(string(data), `"id":"log"`) {
+		t.Errorf("archive = %s", data)
+	}
+
+	// A changed rule is reported again before it is enforced
+	a.Config.Retention.Rules[0].OlderThanDays = 30
+	reports, _ = a.ApplyRetention(context.Background(), true)
+	if !reports[0].DryRun || reports[1].DryRun {
+		t.Errorf("after change: dry runs = %v, %v; want true, false", reports[0].DryRun, reports[1].DryRun)
+	}
+}
+
+func TestExpireChunks(t *testing.T) {
+	ctx := context.Background()
+	a := setupExportApp(t)
+	a.Events = events.NewBus()
+	a.MCP = mcp.NewServer(a.DB, nil, vector.NewIndex())
+	var posted map[string]any
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&posted)
+	}))
+	defer hook.Close()
+	a.Config = config.Default()
+	a.Config.DataDir = t.TempDir()
+	a.Config.Retention.Expiry = retention.ExpiryConfig{Enabled: true, Action: retention.ActionArchive, WebhookURL: hook.URL}
+
+	expired, _ := a.DB.CreateChunk(ctx, "scratch note", json.RawMessage(`{"expires_at":"2020-01-01"}`))
+	kept, _ := a.DB.CreateChunk(ctx, "still needed", json.RawMessage(`{"expires_at":"2999-01-01"}`))
+
+	r, err := a.ExpireChunks(context.Background(), false)
+	if err != nil {
+		t.Fatalf("ExpireChunks: %v", err)
+	}
+	if !r.DryRun || len(r.ChunkIDs) != 1 || r.ChunkIDs[0] != expired.ID {
+		t.Fatalf("dry run = %+v, want %s", r, expired.ID)
+	}
+	if _, err := a.DB.GetChunk(ctx, expired.ID); err != nil {
+		t.Fatalf("dry run deleted the chunk: %v", err)
+	}
+
+	ch, unsubscribe := a.Events.Subscribe()
+	defer unsubscribe()
+	if r, err = a.ExpireChunks(context.Background(), true); err != nil {
+		t.Fatalf("ExpireChunks: %v", err)
+	}
+	if _, err := a.DB.GetChunk(ctx, expired.ID); err == nil {
+		t.Error("expired chunk not deleted")
+	}
+	if _, err := a.DB.GetChunk(ctx, kept.ID); err != nil {
+		t.Errorf("unexpired chunk removed: %v", err)
+	}
+	if e := <-ch; e.Type != events.ChunkExpired || e.Message != expired.ID {
+		t.Errorf("event = %+v, want chunk_expired", e)
+	}
+	if data, err := os.ReadFile(r.Archive); err != nil || !strings.Contains(string(data), expired.ID) {
+		t.Errorf("archive = %s, %v", data, err)
+	}
+	if posted["event"] != "chunk_expired" || posted["count"] != float64(1) {
+		t.Errorf("webhook payload = %v", posted)
+	}
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/neoden/mykb/storage"
+)
+
+// reviewDigestKey is the setting holding when the last review digest was
+// sent (Unix seconds), so restarts don't send it again early.
+const reviewDigestKey = "review_digest_sent"
+
+// SendReviewDigest sends the review queue to the configured digest
+// destinations, if it has any chunks, and returns how many it had.
+func (a *App) SendReviewDigest(ctx context.Context) (int, error) {
+	if !a.Config.Review.Digest.Enabled() {
+		return 0, errors.New("no [review.digest] destination configured")
+	}
+	items, err := a.MCP.ReviewQueue(ctx, 0)
+	if err != nil || len(items) == 0 {
+		return 0, err
+	}
+	if err := a.Config.Review.Digest.Send(ctx, items); err != nil {
+		return 0, err
+	}
+	return len(items), nil
+}
+
+// startReview sends the review digest in the background every interval and
+// returns a function that stops it. It does nothing without a review
+// policy and digest destination.
+func (a *App) startReview() func() {
+	cfg := a.Config.Review
+	if !cfg.Enabled() || !cfg.Digest.Enabled() || a.DB.ReadOnly() {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go a.runReview(ctx, cfg.Interval())
+	return cancel
+}
+
+func (a *App) runReview(ctx context.Context, interval time.Duration) {
+	last := a.lastReviewDigest(ctx)
+	for {
+		if wait := interval - time.Since(last); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+		n, err := a.SendReviewDigest(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// Retried after another interval rather than in a tight loop
+			log.Printf("Review digest failed: %v", err)
+		} else if n > 0 {
+			log.Printf("Sent review digest (%d chunks)", n)
+		}
+		last = time.Now()
+		if err := a.DB.SetSetting(ctx, reviewDigestKey, strconv.FormatInt(last.Unix(), 10)); err != nil {
+			log.Printf("Review digest: %v", err)
+		}
+	}
+}
+
+// lastReviewDigest returns when the review digest was last sent, zero if
+// never.
+func (a *App) lastReviewDigest(ctx context.Context) time.Time {
+	v, err := a.DB.GetSetting(ctx, reviewDigestKey)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Review digest: %v", err)
+		}
+		return time.Time{}
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
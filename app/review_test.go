@@ -0,0 +1,48 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/neoden/mykb/config"
+	"github.com/neoden/mykb/mcp"
+	"github.com/neoden/mykb/review"
+	"github.com/neoden/mykb/storage"
+	"github.com/neoden/mykb/vector"
+)
+
+func TestSendReviewDigest(t *testing.T) {
+	ctx := context.Background()
+	var received int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Count int `json:"count"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		received = body.Count
+	}))
+	defer srv.Close()
+
+	db, err := storage.Init(t.TempDir())
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	cfg := config.Default()
+	cfg.Review = review.Config{NeverAccessed: true, Digest: review.DigestConfig{WebhookURL: srv.URL}}
+	mcpConfig := mcp.DefaultConfig()
+	mcpConfig.Review = cfg.Review
+	a := &App{Config: cfg, DB: db, MCP: mcp.NewServerWithConfig(db, nil, vector.NewIndex(), mcpConfig)}
+	defer a.Close()
+
+	if n, err := a.SendReviewDigest(context.Background()); err != nil || n != 0 || received != 0 {
+		t.Errorf("empty queue: sent %d (webhook got %d), err = %v; want nothing sent", n, received, err)
+	}
+	db.CreateChunk(ctx, "unread", nil)
+	db.CreateChunk(ctx, "also unread", nil)
+	if n, err := a.SendReviewDigest(context.Background()); err != nil || n != 2 || received != 2 {
+		t.Errorf("sent %d (webhook got %d), err = %v; want 2", n, received, err)
+	}
+}
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/neoden/mykb/mcp"
+	"github.com/neoden/mykb/storage"
+)
+
+// SearchOptions selects how Search runs.
+type SearchOptions struct {
+	// Semantic uses semantic_search instead of full-text search_chunks.
+	Semantic     bool
+	Limit        int
+	BoostCentral bool
+	BoostRecent  bool
+	// MinScore drops semantic hits scoring below it (0 to 1).
+	MinScore float64
+	// URL, when set, searches the mykb server there through its /mcp
+	// endpoint, authenticating with Token, instead of the local database.
+	URL   string
+	Token string
+}
+
+// SearchHit is one ranked search result.
+type SearchHit struct {
+	ID string `json:"id"`
+	// Score is the semantic similarity; full-text hits are ranked by order.
+	Score    float32         `json:"score,omitempty"`
+	Snippet  string          `json:"snippet,omitempty"`
+	Content  string          `json:"content"`
+	Metadata json.RawMessage `json:"metadata,omitempty"`
+	// SnippetText and Highlights are Snippet unmarked and the byte ranges
+	// of its matches.
+	SnippetText string         `json:"snippet_text,omitempty"`
+	Highlights  []storage.Span `json:"highlights,omitempty"`
+}
+
+// Search runs a full-text or semantic search, through the same tools an
+// MCP client would call, and returns the ranked hits.
+func (a *App) Search(ctx context.Context, query string, opts SearchOptions) ([]SearchHit, error) {
+	tool := "search_chunks"
+	if opts.Semantic {
+		tool = "semantic_search"
+	}
+	args := map[string]any{"query": query, "boost_central": opts.BoostCentral, "boost_recent": opts.BoostRecent}
+	if opts.Limit > 0 {
+		args["limit"] = opts.Limit
+	}
+	if opts.Semantic && opts.MinScore > 0 {
+		args["min_score"] = opts.MinScore
+	}
+	var result struct {
+		Results []SearchHit `json:"results"`
+	}
+	if err := a.callTool(ctx, opts.URL, opts.Token, tool, args, &result); err != nil {
+		return nil, err
+	}
+	return result.Results, nil
+}
+
+// callTool calls an MCP tool, locally or (with url set) on a remote
+// server, and decodes its structured result into v.
+func (a *App) callTool(ctx context.Context, url, token, tool string, args map[string]any, v any) error {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	params, err := json.Marshal(mcp.CallToolParams{Name: tool, Arguments: data})
+	if err != nil {
+		return err
+	}
+	req := &mcp.Request{JSONRPC: "2.0", ID: json.RawMessage(`1`), Method: "tools/call", Params: params}
+
+	var resp *mcp.Response
+	if url == "" {
+		resp = a.MCP.HandleRequest(ctx, req)
+	} else if resp, err = remoteMCP(ctx, url, token, req); err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return errors.New(resp.Error.Message)
+	}
+
+	// A remote result arrives as JSON; a local one is re-encoded to match
+	if data, err = json.Marshal(resp.Result); err != nil {
+		return err
+	}
+	var result struct {
+		mcp.CallToolResult
+		StructuredContent json.RawMessage `json:"structuredContent"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("decode result: %w", err)
+	}
+	if result.IsError {
+		var msgs []string
+		for _, c := range result.Content {
+			msgs = append(msgs, c.Text)
+		}
+		return errors.New(strings.Join(msgs, "; "))
+	}
+	if err := json.Unmarshal(result.StructuredContent, v); err != nil {
+		return fmt.Errorf("decode result: %w", err)
+	}
+	return nil
+}
+
+// remoteMCP sends one JSON-RPC request to a server's /mcp endpoint.
+func remoteMCP(ctx context.Context, baseURL, token string, req *mcp.Request) (*mcp.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(baseURL, "/")+"/mcp", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+	httpResp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server: %s", httpResp.Status)
+	}
+	var resp mcp.Response
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &resp, nil
+}
@@ -0,0 +1,48 @@
+package app
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/neoden/mykb/httpd"
+	"github.com/neoden/mykb/mcp"
+	"github.com/neoden/mykb/storage"
+	"github.com/neoden/mykb/vector"
+)
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	a := setupExportApp(t)
+	a.MCP = mcp.NewServer(a.DB, nil, vector.NewIndex())
+
+	hits, err := a.Search(context.Background(), "gofmt", SearchOptions{})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(hits) != 1 || hits[0].Snippet == "" || string(hits[0].Metadata) == "" {
+		t.Errorf("hits = %+v", hits)
+	}
+	if _, err := a.Search(context.Background(), "gofmt", SearchOptions{Semantic: true}); err == nil {
+		t.Error("semantic search without an embedder succeeded")
+	}
+
+	// The same search against a running server
+	cfg := httpd.DefaultConfig()
+	ts := httptest.NewServer(httpd.NewServer(a.DB, a.MCP, cfg).Handler())
+	defer ts.Close()
+	token := "search-test-token"
+	a.DB.StoreToken(ctx, storage.HashToken(token), storage.TokenAccess, "cli", time.Now().Add(time.Hour).Unix(), nil)
+
+	remote, err := a.Search(context.Background(), "gofmt", SearchOptions{URL: ts.URL, Token: token})
+	if err != nil {
+		t.Fatalf("remote Search: %v", err)
+	}
+	if len(remote) != 1 || remote[0].ID != hits[0].ID {
+		t.Errorf("remote hits = %+v, want %+v", remote, hits)
+	}
+	if _, err := a.Search(context.Background(), "gofmt", SearchOptions{URL: ts.URL, Token: "wrong"}); err == nil {
+		t.Error("remote search with a bad token succeeded")
+	}
+}
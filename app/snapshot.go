@@ -0,0 +1,140 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/neoden/mykb/embedding"
+	"github.com/neoden/mykb/storage"
+	"github.com/neoden/mykb/vector"
+)
+
+// snapshotFile holds the vector index between runs, in the data dir.
+const snapshotFile = "index.snapshot"
+
+func (a *App) snapshotPath() string {
+	return filepath.Join(a.Config.DataDir, snapshotFile)
+}
+
+// loadVectorIndex fills an index with the embedder's vectors. With a
+// snapshot from an earlier run it only reads the embeddings saved since
+// then, checked vector by vector, so a snapshot that has fallen behind the
+// database (after a crash, or writes by another process) is never trusted
+// beyond what it still matches. Encrypted databases are always read in
+// full, as the snapshot would hold their vectors in the clear.
+func loadVectorIndex(ctx context.Context, db *storage.DB, embedder embedding.EmbeddingProvider, cfg vector.Config, snapshot string) *vector.Index {
+	if embedder == nil {
+		return vector.NewIndexWithConfig(cfg, nil)
+	}
+	model := embedder.Model()
+	idx := vector.NewIndexWithConfig(cfg, func(ids []string) (map[string][]float32, error) {
+		// The index outlives ctx, and rescores within searches it is not
+		// given the context of
+		return db.LoadEmbeddingsFor(context.Background(), model, ids)
+	})
+	if snapshot != "" && db.Encrypted() {
+		// Left from before the database was encrypted
+		os.Remove(snapshot)
+	} else if snapshot != "" {
+		n, restored, err := restoreVectorIndex(ctx, idx, db, model, snapshot)
+		if err == nil {
+			log.Printf("Loaded %d embeddings for model %s (%d from snapshot)", n, model, restored)
+			return idx
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Vector index snapshot not used: %v", err)
+		}
+	}
+
+	readAt := time.Now()
+	vecs, err := db.LoadEmbeddingsByModel(ctx, model)
+	if err != nil {
+		log.Printf("Failed to load embeddings: %v", err)
+		return idx
+	}
+	idx.LoadAt(vecs, readAt)
+	log.Printf("Loaded %d embeddings for model %s", len(vecs), model)
+	return idx
+}
+
+// errSnapshotModel reports a snapshot taken for another embedding model.
+var errSnapshotModel = errors.New("taken for another embedding model")
+
+// restoreVectorIndex loads idx from the snapshot at path, reading from db
+// the embeddings saved since each vector was snapshotted and dropping
+// those deleted. It returns how many vectors the index holds and how many
+// came from the snapshot.
+func restoreVectorIndex(ctx context.Context, idx *vector.Index, db *storage.DB, model, path string) (total, restored int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	key, entries, err := vector.ReadSnapshot(f)
+	f.Close()
+	if err != nil {
+		return 0, 0, err
+	}
+	if key != model {
+		return 0, 0, errSnapshotModel
+	}
+
+	readAt := time.Now()
+	times, err := db.EmbeddingTimes(ctx, model)
+	if err != nil {
+		return 0, 0, err
+	}
+	current := make(map[string]vector.SnapshotEntry, len(times))
+	var stale []string
+	for id, savedAt := range times {
+		// Timestamps are in seconds, so a vector snapshotted in the second
+		// its embedding was saved is read again
+		if e, ok := entries[id]; ok && e.AsOf > savedAt {
+			current[id] = e
+		} else {
+			stale = append(stale, id)
+		}
+	}
+	fresh, err := db.LoadEmbeddingsFor(ctx, model, stale)
+	if err != nil {
+		return 0, 0, err
+	}
+	idx.Restore(current, fresh, readAt)
+	return len(current) + len(fresh), len(current), nil
+}
+
+// saveIndexSnapshot writes the vector index to the data dir for the next
+// start, except for databases in memory, read-only mirrors, encrypted
+// databases and quantized indexes.
+func (a *App) saveIndexSnapshot() {
+	if a.Embedder == nil || a.DB.InMemory() || a.DB.ReadOnly() || a.DB.Encrypted() || a.Config.Index.Quantization != "" {
+		return
+	}
+	path := a.snapshotPath()
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		log.Printf("Vector index snapshot: %v", err)
+		return
+	}
+	err = a.Index.WriteSnapshot(f, a.Embedder.Model())
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		log.Printf("Vector index snapshot: %v", err)
+		return
+	}
+	log.Printf("Saved vector index snapshot (%d embeddings)", a.Index.Size())
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/neoden/mykb/config"
+	"github.com/neoden/mykb/storage"
+	"github.com/neoden/mykb/vector"
+)
+
+func TestIndexSnapshotRestore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	db, err := storage.Init(dir)
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	embedder := &mockEmbedder{}
+	cfg := config.Default()
+	cfg.DataDir = dir
+	a := &App{Config: cfg, DB: db, Embedder: embedder, Index: vector.NewIndex()}
+	defer a.Close()
+
+	kept, _ := db.CreateChunk(ctx, "kept", nil)
+	deleted, _ := db.CreateChunk(ctx, "deleted", nil)
+	db.SaveEmbedding(ctx, kept.ID, embedder.Model(), kept.Content, []float32{1, 0, 0})
+	db.SaveEmbedding(ctx, deleted.ID, embedder.Model(), deleted.Content, []float32{0, 1, 0})
+	vecs, _ := db.LoadEmbeddingsByModel(ctx, embedder.Model())
+	// Stamped past the embeddings' second, so the snapshot can vouch for them
+	a.Index.LoadAt(vecs, time.Now().Add(time.Hour))
+	a.saveIndexSnapshot()
+
+	// Changes after the snapshot, as by another process
+	db.DeleteChunk(ctx, deleted.ID)
+	added, _ := db.CreateChunk(ctx, "added", nil)
+	db.SaveEmbedding(ctx, added.ID, embedder.Model(), added.Content, []float32{0, 0, 1})
+
+	idx := vector.NewIndex()
+	total, restored, err := restoreVectorIndex(ctx, idx, db, embedder.Model(), a.snapshotPath())
+	if err != nil {
+		t.Fatalf("restoreVectorIndex: %v", err)
+	}
+	if total != 2 || restored != 1 {
+		t.Errorf("restored %d of %d vectors, want 1 of 2", restored, total)
+	}
+	if r := idx.Search([]float32{0, 0, 1}, 1, 0); len(r) != 1 || r[0].ID != added.ID {
+		t.Errorf("Search = %v, want the added chunk", r)
+	}
+	if r := idx.Search([]float32{0, 1, 0}, 2, 0); len(r) != 2 || r[0].ID == deleted.ID || r[1].ID == deleted.ID {
+		t.Errorf("Search = %v, deleted chunk still indexed", r)
+	}
+
+	// A snapshot of another model is ignored in favour of the database
+	if _, _, err := restoreVectorIndex(ctx, vector.NewIndex(), db, "other/model", a.snapshotPath()); err != errSnapshotModel {
+		t.Errorf("other model: err = %v, want errSnapshotModel", err)
+	}
+	// The same-model snapshot is restored from at startup
+	if idx := loadVectorIndex(ctx, db, embedder, cfg.Index, a.snapshotPath()); idx.Size() != 2 {
+		t.Errorf("loadVectorIndex: size = %d, want 2", idx.Size())
+	}
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/neoden/mykb/storage"
+)
+
+// statsInterval is how often a running server refreshes today's snapshot;
+// the last one of each day is kept.
+const statsInterval = time.Hour
+
+// Stats measures the database now, counting embeddings for the configured
+// model.
+func (a *App) Stats(ctx context.Context) (*storage.StatsSnapshot, error) {
+	model := ""
+	if a.Embedder != nil {
+		model = a.Embedder.Model()
+	}
+	return a.DB.TakeStats(ctx, model)
+}
+
+// IndexSize returns the number of vectors in the search index.
+func (a *App) IndexSize() int {
+	if a.Index == nil {
+		return 0
+	}
+	return a.Index.Size()
+}
+
+// recordStats stores today's snapshot.
+func (a *App) recordStats(ctx context.Context) error {
+	s, err := a.Stats(ctx)
+	if err != nil {
+		return err
+	}
+	return a.DB.RecordStats(ctx, s)
+}
+
+// startStats records daily storage snapshots in the background and returns
+// a function that stops it.
+func (a *App) startStats() func() {
+	if a.DB.ReadOnly() {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		ticker := time.NewTicker(statsInterval)
+		defer ticker.Stop()
+		for {
+			if err := a.recordStats(ctx); err != nil {
+				log.Printf("Record storage stats: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return cancel
+}
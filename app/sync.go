@@ -0,0 +1,246 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/neoden/mykb/httpd"
+	"github.com/neoden/mykb/storage"
+)
+
+// Sync conflict policies, applied when a chunk changed on both instances
+// since they last synced.
+const (
+	SyncNewest   = "newest"    // keep the version changed last
+	SyncLocal    = "local"     // keep this instance's version
+	SyncRemote   = "remote"    // keep the remote version
+	SyncKeepBoth = "keep-both" // keep ours, and the remote edit under a new ID
+)
+
+// syncStatePrefix prefixes the setting holding the sync cursors for a
+// remote URL.
+const syncStatePrefix = "sync:"
+
+// syncState is where the last sync with a remote left off, on each
+// instance's own clock.
+type syncState struct {
+	Local  time.Time `json:"local"`
+	Remote time.Time `json:"remote"`
+}
+
+// SyncStats counts what Sync did.
+type SyncStats struct {
+	Pulled        int `json:"pulled"`
+	Deleted       int `json:"deleted"`
+	Pushed        int `json:"pushed"`
+	RemoteDeleted int `json:"remote_deleted"`
+	Conflicts     int `json:"conflicts"`
+	// Deferred counts pulled chunks left for reindex to embed.
+	Deferred int `json:"embeddings_deferred,omitempty"`
+}
+
+// syncChange is one side's change to a chunk: a new version, or a delete.
+type syncChange struct {
+	chunk *storage.Chunk
+	at    time.Time
+}
+
+func (c syncChange) deleted() bool { return c.chunk == nil }
+
+func changesByID(changes *httpd.SyncChanges) map[string]syncChange {
+	m := make(map[string]syncChange, len(changes.Chunks)+len(changes.Tombstones))
+	for i := range changes.Chunks {
+		c := &changes.Chunks[i]
+		m[c.ID] = syncChange{chunk: c, at: c.UpdatedAt}
+	}
+	for _, t := range changes.Tombstones {
+		if _, ok := m[t.ChunkID]; !ok || m[t.ChunkID].at.Before(t.DeletedAt) {
+			m[t.ChunkID] = syncChange{at: t.DeletedAt}
+		}
+	}
+	return m
+}
+
+// Sync exchanges changes with the mykb server at remoteURL: chunks changed
+// or deleted on either side since the last sync are applied to the other.
+// Chunks changed on both sides are resolved by policy (default newest).
+func (a *App) Sync(ctx context.Context, remoteURL, token, policy string) (*SyncStats, error) {
+	switch policy {
+	case SyncNewest, SyncLocal, SyncRemote, SyncKeepBoth:
+	case "":
+		policy = SyncNewest
+	default:
+		return nil, fmt.Errorf("unknown conflict policy %q: expected newest, local, remote or keep-both", policy)
+	}
+	if a.DB.ReadOnly() {
+		return nil, errors.New("database is a read-only mirror")
+	}
+	remoteURL = strings.TrimSuffix(remoteURL, "/")
+	key := syncStatePrefix + remoteURL
+
+	var state syncState
+	if v, err := a.DB.GetSetting(ctx, key); err == nil {
+		if err := json.Unmarshal([]byte(v), &state); err != nil {
+			return nil, fmt.Errorf("sync state: %w", err)
+		}
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+
+	localNow := time.Now().UTC()
+	var local httpd.SyncChanges
+	var err error
+	if local.Chunks, local.Tombstones, err = a.DB.ChangesSince(ctx, state.Local); err != nil {
+		return nil, err
+	}
+	remote, err := syncPull(ctx, remoteURL, token, state.Remote)
+	if err != nil {
+		return nil, err
+	}
+
+	// ours ends up holding the local changes to push
+	stats := &SyncStats{}
+	ours := changesByID(&local)
+	var pull, copies []storage.Chunk
+	var deletes []string
+	for id, theirs := range changesByID(remote) {
+		if mine, changed := ours[id]; changed {
+			if sameChange(mine, theirs) {
+				delete(ours, id)
+				continue
+			}
+			stats.Conflicts++
+			var remoteWins bool
+			switch policy {
+			case SyncNewest:
+				remoteWins = theirs.at.After(mine.at)
+			case SyncRemote:
+				remoteWins = true
+			case SyncKeepBoth:
+				// An edit beats a delete; of two edits, theirs is copied
+				remoteWins = mine.deleted()
+				if !mine.deleted() && !theirs.deleted() {
+					c := *theirs.chunk
+					c.ID = uuid.New().String()
+					copies = append(copies, c)
+				}
+			}
+			if !remoteWins {
+				continue
+			}
+			delete(ours, id)
+		}
+		if theirs.deleted() {
+			deletes = append(deletes, id)
+		} else if existing, err := a.DB.GetChunk(ctx, id); err != nil || !sameChunk(existing, theirs.chunk) {
+			pull = append(pull, *theirs.chunk)
+		}
+	}
+
+	pull = append(pull, copies...)
+	if stats.Deferred, err = a.MCP.PutChunks(ctx, pull); err != nil {
+		return stats, fmt.Errorf("apply remote changes: %w", err)
+	}
+	stats.Pulled = len(pull)
+	if stats.Deleted, err = a.MCP.DeleteChunks(ctx, deletes); err != nil {
+		return stats, fmt.Errorf("apply remote deletes: %w", err)
+	}
+
+	push := &httpd.SyncChanges{Chunks: copies, Tombstones: []storage.Tombstone{}}
+	for id, c := range ours {
+		if c.deleted() {
+			push.Tombstones = append(push.Tombstones, storage.Tombstone{ChunkID: id, DeletedAt: c.at})
+		} else {
+			push.Chunks = append(push.Chunks, *c.chunk)
+		}
+	}
+	if len(push.Chunks) > 0 || len(push.Tombstones) > 0 {
+		res, err := syncPush(ctx, remoteURL, token, push)
+		if err != nil {
+			return stats, err
+		}
+		stats.Pushed = res.Applied
+		stats.RemoteDeleted = res.Deleted
+	}
+
+	data, err := json.Marshal(syncState{Local: localNow, Remote: remote.Now})
+	if err != nil {
+		return stats, err
+	}
+	return stats, a.DB.SetSetting(ctx, key, string(data))
+}
+
+func sameChange(a, b syncChange) bool {
+	if a.deleted() || b.deleted() {
+		return a.deleted() && b.deleted()
+	}
+	return sameChunk(a.chunk, b.chunk)
+}
+
+func sameChunk(a, b *storage.Chunk) bool {
+	return a.Content == b.Content && bytes.Equal(compactJSON(a.Metadata), compactJSON(b.Metadata))
+}
+
+func compactJSON(data json.RawMessage) []byte {
+	var b bytes.Buffer
+	if json.Compact(&b, data) != nil {
+		return data
+	}
+	return b.Bytes()
+}
+
+// syncPull fetches the remote's changes since the given time.
+func syncPull(ctx context.Context, remoteURL, token string, since time.Time) (*httpd.SyncChanges, error) {
+	u := remoteURL + "/sync/changes"
+	if !since.IsZero() {
+		u += "?since=" + url.QueryEscape(since.Format(time.RFC3339Nano))
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	var changes httpd.SyncChanges
+	if err := doSync(req, token, &changes); err != nil {
+		return nil, fmt.Errorf("pull: %w", err)
+	}
+	return &changes, nil
+}
+
+// syncPush sends changes to the remote.
+func syncPush(ctx context.Context, remoteURL, token string, changes *httpd.SyncChanges) (*httpd.SyncResult, error) {
+	body, err := json.Marshal(changes)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", remoteURL+"/sync/changes", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var res httpd.SyncResult
+	if err := doSync(req, token, &res); err != nil {
+		return nil, fmt.Errorf("push: %w", err)
+	}
+	return &res, nil
+}
+
+func doSync(req *http.Request, token string, out any) error {
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
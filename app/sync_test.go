@@ -0,0 +1,103 @@
+package app
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/neoden/mykb/httpd"
+	"github.com/neoden/mykb/mcp"
+	"github.com/neoden/mykb/storage"
+	"github.com/neoden/mykb/vector"
+)
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	laptop := setupExportApp(t)
+	laptop.MCP = mcp.NewServer(laptop.DB, nil, vector.NewIndex())
+
+	vps, err := storage.Init(t.TempDir())
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	t.Cleanup(func() { vps.Close() })
+	vpsMCP := mcp.NewServer(vps, nil, vector.NewIndex())
+	cfg := httpd.DefaultConfig()
+	cfg.AdminToken = "secret"
+	ts := httptest.NewServer(httpd.NewServer(vps, vpsMCP, cfg).Handler())
+	defer ts.Close()
+
+	sync := func(policy string, want SyncStats) {
+		t.Helper()
+		stats, err := laptop.Sync(context.Background(), ts.URL, "secret", policy)
+		if err != nil {
+			t.Fatalf("Sync: %v", err)
+		}
+		if *stats != want {
+			t.Errorf("stats = %+v, want %+v", *stats, want)
+		}
+	}
+	content := func(db *storage.DB, id string) string {
+		c, err := db.GetChunk(ctx, id)
+		if err != nil {
+			return ""
+		}
+		return c.Content
+	}
+
+	// The first sync copies everything across
+	sync("", SyncStats{Pushed: 3})
+	chunks, _ := laptop.DB.GetAllChunks(ctx)
+	if n, _ := vps.CountChunks(ctx); n != 3 {
+		t.Fatalf("vps has %d chunks, want 3", n)
+	}
+	a, b, c := chunks[0].ID, chunks[1].ID, chunks[2].ID
+
+	// Changes on each side; c is edited on both, last on the vps
+	onVPS, _ := vps.CreateChunk(ctx, "written on the vps", nil)
+	vps.DeleteChunk(ctx, b)
+	edit := func(db *storage.DB, id, text string) {
+		time.Sleep(5 * time.Millisecond)
+		if _, err := db.UpdateChunk(ctx, id, &text, nil); err != nil {
+			t.Fatalf("UpdateChunk: %v", err)
+		}
+	}
+	edit(laptop.DB, a, "edited on the laptop")
+	edit(laptop.DB, c, "laptop version")
+	edit(vps, c, "vps version")
+
+	sync("", SyncStats{Pulled: 2, Deleted: 1, Pushed: 1, Conflicts: 1})
+	if content(vps, a) != "edited on the laptop" || content(laptop.DB, onVPS.ID) != "written on the vps" {
+		t.Error("edits not exchanged")
+	}
+	if content(laptop.DB, b) != "" {
+		t.Error("delete not pulled")
+	}
+	if content(laptop.DB, c) != "vps version" || content(vps, c) != "vps version" {
+		t.Errorf("conflict: laptop %q, vps %q, want the newest (vps) version", content(laptop.DB, c), content(vps, c))
+	}
+
+	// Nothing changed since, so nothing is applied
+	sync("", SyncStats{})
+
+	// keep-both keeps the laptop's version and copies the vps edit
+	edit(vps, c, "vps again")
+	edit(laptop.DB, c, "laptop again")
+	sync(SyncKeepBoth, SyncStats{Pulled: 1, Pushed: 2, Conflicts: 1})
+	if content(vps, c) != "laptop again" {
+		t.Errorf("vps has %q, want the laptop version", content(vps, c))
+	}
+	for _, db := range []*storage.DB{laptop.DB, vps} {
+		if n, _ := db.CountChunks(ctx); n != 4 {
+			t.Errorf("%d chunks after keep-both, want 4", n)
+		}
+	}
+
+	if _, err := laptop.Sync(context.Background(), ts.URL, "wrong", ""); err == nil {
+		t.Error("expected error for rejected token")
+	}
+	if _, err := laptop.Sync(context.Background(), ts.URL, "secret", "merge"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
@@ -0,0 +1,115 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/neoden/mykb/events"
+	"github.com/neoden/mykb/httpd"
+)
+
+// adminTokenFile holds the admin token of the running HTTP server.
+const adminTokenFile = "admin.token"
+
+// writeAdminToken generates a fresh admin token and stores it in the data
+// directory, readable only by the owner.
+func (a *App) writeAdminToken() (string, error) {
+	token, err := httpd.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(a.Config.DataDir, adminTokenFile)
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("write admin token: %w", err)
+	}
+	return token, nil
+}
+
+// serverURL returns the base URL of the configured HTTP server.
+func (a *App) serverURL() string {
+	if a.Config.Server.Domain != "" {
+		return "https://" + a.Config.Server.Domain
+	}
+	listen := a.Config.Server.Listen
+	if listen == "" {
+		listen = ":8080"
+	}
+	_, baseURL := httpd.LocalhostAddr(listen)
+	return baseURL
+}
+
+// Tail streams activity events from a running HTTP server to w until ctx
+// is cancelled or the server closes the stream. Empty baseURL and token
+// default to the configured server and its admin token file.
+func (a *App) Tail(ctx context.Context, baseURL, token string, w io.Writer) error {
+	if baseURL == "" {
+		baseURL = a.serverURL()
+	}
+	if token == "" {
+		data, err := os.ReadFile(filepath.Join(a.Config.DataDir, adminTokenFile))
+		if err != nil {
+			return fmt.Errorf("read admin token (is the server running?): %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(baseURL, "/")+"/admin/events", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("connect: %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var e events.Event
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			continue
+		}
+		fmt.Fprintln(w, formatEvent(e))
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("read stream: %w", err)
+	}
+	return nil
+}
+
+// formatEvent renders an event as a single log-style line.
+func formatEvent(e events.Event) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %-9s %s", e.Time.Local().Format("15:04:05"), e.Type, e.Message)
+
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%v", k, e.Fields[k])
+	}
+	return b.String()
+}
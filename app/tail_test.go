@@ -0,0 +1,59 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neoden/mykb/config"
+	"github.com/neoden/mykb/events"
+)
+
+func TestTail(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/admin/events" || r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": ping\n\n")
+		fmt.Fprint(w, `data: {"time":"2024-01-02T03:04:05Z","type":"tool_call","message":"search","fields":{"tool":"search","duration_ms":3}}`+"\n\n")
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, adminTokenFile), []byte("secret\n"), 0600)
+	a := &App{Config: &config.Config{DataDir: dir}}
+
+	var out bytes.Buffer
+	if err := a.Tail(context.Background(), ts.URL, "", &out); err != nil {
+		t.Fatalf("Tail: %v", err)
+	}
+	got := out.String()
+	if !strings.Contains(got, "tool_call") || !strings.Contains(got, "search duration_ms=3 tool=search") {
+		t.Errorf("output = %q", got)
+	}
+
+	if err := a.Tail(context.Background(), ts.URL, "wrong", &out); err == nil {
+		t.Error("expected error for rejected token")
+	}
+}
+
+func TestFormatEvent(t *testing.T) {
+	e := events.Event{
+		Time:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local),
+		Type:    events.Auth,
+		Message: "tokens issued",
+		Fields:  map[string]any{"client_id": "abc"},
+	}
+	if got, want := formatEvent(e), "03:04:05 auth      tokens issued client_id=abc"; got != want {
+		t.Errorf("formatEvent = %q, want %q", got, want)
+	}
+}
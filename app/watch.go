@@ -0,0 +1,212 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/neoden/mykb/ingest"
+)
+
+// DefaultWatchInterval is how often a watched directory is rescanned.
+const DefaultWatchInterval = 2 * time.Second
+
+// watchHashKey is the chunk metadata key holding the SHA-256 of the file a
+// watched chunk was split from.
+const watchHashKey = "content_hash"
+
+// Watch actions reported in WatchEvent.
+const (
+	WatchIngested = "ingested"
+	WatchUpdated  = "updated"
+	WatchDeleted  = "deleted"
+	WatchFailed   = "failed"
+)
+
+// WatchEvent reports one change synced from a watched directory.
+type WatchEvent struct {
+	Action string
+	Path   string
+	Chunks int
+	// Deferred counts chunks stored without an embedding.
+	Deferred int
+	Err      error
+}
+
+// watchedFile is a file's last seen state and the chunks stored for it.
+type watchedFile struct {
+	hash    string
+	ids     []string
+	size    int64
+	modTime time.Time
+}
+
+// watcher syncs the ingestible files below dir into the knowledge base.
+type watcher struct {
+	a        *App
+	dir      string
+	metadata map[string]any
+	files    map[string]*watchedFile // by absolute path
+}
+
+// Watch keeps the chunks of the ingestible files below dir in step with
+// them until ctx is cancelled, rescanning every interval. New files are
+// ingested, changed files re-ingested and the chunks of deleted files
+// removed. Each chunk records its file's content hash, so a restarted
+// watch only re-ingests files that changed while it was stopped.
+func (a *App) Watch(ctx context.Context, dir string, metadata map[string]any, interval time.Duration, report func(WatchEvent)) error {
+	if a.DB.ReadOnly() {
+		return errors.New("database is a read-only mirror")
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(abs); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return errors.New(dir + " is not a directory")
+	}
+
+	w := &watcher{a: a, dir: abs, metadata: metadata}
+	if err := w.load(ctx); err != nil {
+		return err
+	}
+	defer a.startGitMirror()()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		w.sync(ctx, report)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// load finds the chunks a previous watch stored for files below dir.
+func (w *watcher) load(ctx context.Context) error {
+	chunks, err := w.a.DB.GetAllChunks(ctx)
+	if err != nil {
+		return err
+	}
+	w.files = make(map[string]*watchedFile)
+	prefix := w.dir + string(filepath.Separator)
+	for _, c := range chunks {
+		var meta struct {
+			Source string `json:"source"`
+			Hash   string `json:"content_hash"`
+		}
+		if json.Unmarshal(c.Metadata, &meta) != nil || meta.Hash == "" || !strings.HasPrefix(meta.Source, prefix) {
+			continue
+		}
+		f := w.files[meta.Source]
+		if f == nil {
+			f = &watchedFile{hash: meta.Hash}
+			w.files[meta.Source] = f
+		} else if f.hash != meta.Hash {
+			f.hash = "" // left over from an interrupted update; re-ingest
+		}
+		f.ids = append(f.ids, c.ID)
+	}
+	return nil
+}
+
+// sync ingests new and changed files and removes the chunks of deleted ones.
+func (w *watcher) sync(ctx context.Context, report func(WatchEvent)) {
+	paths, err := ingestFiles(w.dir, false)
+	if err != nil {
+		// Keep everything rather than delete chunks for an unreadable tree
+		report(WatchEvent{Action: WatchFailed, Path: w.dir, Err: err})
+		return
+	}
+
+	seen := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		if ctx.Err() != nil {
+			return
+		}
+		seen[p] = true
+		if ev, changed := w.syncFile(ctx, p); changed {
+			report(ev)
+		}
+	}
+	for p, f := range w.files {
+		if seen[p] {
+			continue
+		}
+		if len(f.ids) == 0 {
+			delete(w.files, p) // never ingested
+			continue
+		}
+		n, err := w.a.MCP.DeleteChunks(ctx, f.ids)
+		if err != nil {
+			report(WatchEvent{Action: WatchFailed, Path: p, Err: err})
+			continue
+		}
+		delete(w.files, p)
+		report(WatchEvent{Action: WatchDeleted, Path: p, Chunks: n})
+	}
+}
+
+// syncFile re-ingests p if its content changed since it was last seen.
+// A failed file is retried once it changes again; its old chunks stay.
+func (w *watcher) syncFile(ctx context.Context, p string) (WatchEvent, bool) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return WatchEvent{}, false // removed mid-scan; handled next time
+	}
+	f := w.files[p]
+	if f != nil && f.size == info.Size() && f.modTime.Equal(info.ModTime()) {
+		return WatchEvent{}, false
+	}
+	if f == nil {
+		f = &watchedFile{}
+		w.files[p] = f
+	}
+	f.size, f.modTime = info.Size(), info.ModTime()
+
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return WatchEvent{Action: WatchFailed, Path: p, Err: err}, true
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if hash == f.hash {
+		return WatchEvent{}, false // touched, not changed
+	}
+
+	doc, err := ingest.Parse(p, data, "")
+	if err != nil {
+		return WatchEvent{Action: WatchFailed, Path: p, Err: err}, true
+	}
+	meta := make(map[string]any, len(w.metadata)+1)
+	for k, v := range w.metadata {
+		meta[k] = v
+	}
+	meta[watchHashKey] = hash
+	res, err := w.a.MCP.IngestDocument(ctx, doc, meta)
+	if err != nil {
+		return WatchEvent{Action: WatchFailed, Path: p, Err: err}, true
+	}
+
+	// Drop the old version only once the new one is stored
+	action := WatchIngested
+	if len(f.ids) > 0 {
+		action = WatchUpdated
+		if _, err := w.a.MCP.DeleteChunks(ctx, f.ids); err != nil {
+			// Keep the leftovers tracked so the next change removes them
+			f.hash, f.ids = hash, append(f.ids, res.ChunkIDs...)
+			return WatchEvent{Action: WatchFailed, Path: p, Err: err}, true
+		}
+	}
+	f.hash, f.ids = hash, res.ChunkIDs
+	return WatchEvent{Action: action, Path: p, Chunks: len(res.ChunkIDs), Deferred: res.Deferred}, true
+}
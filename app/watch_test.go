@@ -0,0 +1,86 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/neoden/mykb/mcp"
+	"github.com/neoden/mykb/vector"
+)
+
+func TestWatchSync(t *testing.T) {
+	ctx := context.Background()
+	a := setupExportApp(t)
+	a.MCP = mcp.NewServer(a.DB, nil, vector.NewIndex())
+	dir := t.TempDir()
+	notes := filepath.Join(dir, "notes.md")
+	todo := filepath.Join(dir, "todo.txt")
+	os.WriteFile(notes, []byte("# Notes\n\nfirst draft"), 0644)
+	os.WriteFile(todo, []byte("buy milk"), 0644)
+	os.WriteFile(filepath.Join(dir, ".#notes.md"), []byte("lock"), 0644)
+
+	var events []string
+	collect := func(ev WatchEvent) {
+		if ev.Err != nil {
+			t.Errorf("%s: %v", ev.Path, ev.Err)
+		}
+		events = append(events, ev.Action+" "+filepath.Base(ev.Path))
+	}
+	newWatcher := func() *watcher {
+		w := &watcher{a: a, dir: dir, metadata: map[string]any{"folder": "notes"}}
+		if err := w.load(ctx); err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		return w
+	}
+	sync := func(w *watcher, want ...string) {
+		t.Helper()
+		events = nil
+		w.sync(context.Background(), collect)
+		if strings.Join(events, ", ") != strings.Join(want, ", ") {
+			t.Errorf("events = %v, want %v", events, want)
+		}
+	}
+	sources := func() map[string]int {
+		chunks, _ := a.DB.GetAllChunks(ctx)
+		n := map[string]int{}
+		for _, c := range chunks {
+			var meta map[string]any
+			json.Unmarshal(c.Metadata, &meta)
+			if meta["folder"] == "notes" && meta["content_hash"] != nil {
+				n[filepath.Base(meta["source"].(string))]++
+			}
+		}
+		return n
+	}
+
+	w := newWatcher()
+	sync(w, "ingested notes.md", "ingested todo.txt")
+	sync(w) // nothing changed
+
+	os.WriteFile(notes, []byte("# Notes\n\nsecond, longer draft"), 0644)
+	os.Remove(todo)
+	sync(w, "updated notes.md", "deleted todo.txt")
+	if got := sources(); got["notes.md"] != 1 || got["todo.txt"] != 0 {
+		t.Errorf("chunks by source = %v", got)
+	}
+	chunks, _ := a.DB.GetAllChunks(ctx)
+	for _, c := range chunks {
+		if strings.Contains(c.Content, "first draft") {
+			t.Error("old version of notes.md still stored")
+		}
+	}
+
+	// A restarted watch finds the stored hashes: unchanged files are kept
+	w = newWatcher()
+	sync(w)
+	os.WriteFile(notes, []byte("# Notes\n\nthird draft, longer still"), 0644)
+	sync(w, "updated notes.md")
+	if got := sources(); got["notes.md"] != 1 {
+		t.Errorf("chunks by source = %v", got)
+	}
+}
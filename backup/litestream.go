@@ -0,0 +1,182 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Litestream restart backoff: the delay doubles after each quick exit up to
+// litestreamMaxDelay, and resets once a process has stayed up for
+// litestreamStableRun.
+const (
+	litestreamMinDelay  = time.Second
+	litestreamMaxDelay  = time.Minute
+	litestreamStableRun = time.Minute
+	// litestreamStopWait is how long litestream may take to ship its last
+	// frames after being interrupted before it is killed.
+	litestreamStopWait = 10 * time.Second
+)
+
+// LitestreamConfig runs `litestream replicate` for the database, either
+// from a litestream.yml or straight to one replica URL.
+type LitestreamConfig struct {
+	// Path is the litestream binary (default "litestream" from $PATH).
+	Path string `toml:"path"`
+	// Config is a litestream.yml listing the database and its replicas.
+	Config string `toml:"config"`
+	// ReplicaURL replicates the database to one URL (s3://bucket/path,
+	// file:///backups/mykb) without a config file.
+	ReplicaURL string `toml:"replica_url"`
+}
+
+// Enabled reports whether litestream replaces the built-in replicator.
+func (c LitestreamConfig) Enabled() bool {
+	return c.Config != "" || c.ReplicaURL != ""
+}
+
+func (c LitestreamConfig) path() string {
+	if c.Path != "" {
+		return c.Path
+	}
+	return "litestream"
+}
+
+// Litestream supervises a litestream process replicating the database,
+// restarting it whenever it exits. Litestream runs its own checkpoints, so
+// the database should be opened with storage.Options.ExternalCheckpoints.
+type Litestream struct {
+	cfg      LitestreamConfig
+	bin      string
+	dbPath   string
+	minDelay time.Duration
+
+	mu       sync.Mutex // guards the fields below, read by Status
+	running  bool
+	restarts int
+	lastErr  string
+}
+
+// NewLitestream creates a supervisor replicating the database at dbPath.
+// It fails if the litestream binary cannot be found.
+func NewLitestream(dbPath string, cfg LitestreamConfig) (*Litestream, error) {
+	bin, err := exec.LookPath(cfg.path())
+	if err != nil {
+		return nil, fmt.Errorf("litestream: %w", err)
+	}
+	return &Litestream{cfg: cfg, bin: bin, dbPath: dbPath, minDelay: litestreamMinDelay}, nil
+}
+
+// args returns the litestream command line.
+func (l *Litestream) args() []string {
+	if l.cfg.Config != "" {
+		return []string{"replicate", "-config", l.cfg.Config}
+	}
+	return []string{"replicate", l.dbPath, l.cfg.ReplicaURL}
+}
+
+// Run keeps litestream running until ctx is cancelled, then interrupts it
+// so it ships outstanding frames.
+func (l *Litestream) Run(ctx context.Context) {
+	delay := l.minDelay
+	for {
+		started := time.Now()
+		err := l.runOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = errors.New("exited")
+		}
+		log.Printf("Litestream stopped: %v; restarting in %s", err, delay)
+
+		l.mu.Lock()
+		l.restarts++
+		l.lastErr = err.Error()
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if time.Since(started) >= litestreamStableRun {
+			delay = l.minDelay
+		} else {
+			delay = min(delay*2, litestreamMaxDelay)
+		}
+	}
+}
+
+// runOnce runs one litestream process until it exits or ctx is cancelled.
+func (l *Litestream) runOnce(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, l.bin, l.args()...)
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = litestreamStopWait
+	out := &logWriter{prefix: "litestream: "}
+	cmd.Stdout, cmd.Stderr = out, out
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.running = true
+	l.mu.Unlock()
+	err := cmd.Wait()
+	l.mu.Lock()
+	l.running = false
+	l.mu.Unlock()
+	out.flush()
+	return err
+}
+
+// Status reports whether litestream is running. Litestream does not expose
+// its replication position, so no lag is reported.
+func (l *Litestream) Status() ReplicationStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return ReplicationStatus{
+		Mode:      "litestream",
+		Running:   l.running,
+		Restarts:  l.restarts,
+		LastError: l.lastErr,
+	}
+}
+
+// logWriter logs each line written to it.
+type logWriter struct {
+	prefix string
+	mu     sync.Mutex
+	buf    []byte
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		log.Printf("%s%s", w.prefix, w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush logs a final unterminated line.
+func (w *logWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		log.Printf("%s%s", w.prefix, w.buf)
+		w.buf = nil
+	}
+}
@@ -0,0 +1,61 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLitestreamRestarts(t *testing.T) {
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	bin := filepath.Join(dir, "litestream")
+	script := "#!/bin/sh\necho \"$@\" >> " + argsFile + "\necho replicating\nexit 1\n"
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := NewLitestream("/data/data.db", LitestreamConfig{Path: bin, ReplicaURL: "s3://bucket/kb"})
+	if err != nil {
+		t.Fatalf("NewLitestream: %v", err)
+	}
+	l.minDelay = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		l.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for l.Status().Restarts < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("litestream was not restarted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	st := l.Status()
+	if st.Mode != "litestream" || st.Running || st.LastError == "" {
+		t.Errorf("Status = %+v", st)
+	}
+	data, _ := os.ReadFile(argsFile)
+	if first := strings.SplitN(string(data), "\n", 2)[0]; first != "replicate /data/data.db s3://bucket/kb" {
+		t.Errorf("args = %q", first)
+	}
+}
+
+func TestLitestreamArgs(t *testing.T) {
+	l := &Litestream{dbPath: "/data/data.db", cfg: LitestreamConfig{Config: "/etc/litestream.yml"}}
+	if got := strings.Join(l.args(), " "); got != "replicate -config /etc/litestream.yml" {
+		t.Errorf("args = %q", got)
+	}
+	if _, err := NewLitestream("x", LitestreamConfig{Path: "/nonexistent/litestream", Config: "x"}); err == nil {
+		t.Error("expected error for missing binary")
+	}
+}
@@ -0,0 +1,112 @@
+// Package backup uploads database backups to S3-compatible object storage,
+// prunes old ones, and continuously replicates the write-ahead log.
+package backup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultRetain is how many remote backups are kept when not configured.
+const DefaultRetain = 7
+
+// Config holds remote backup settings.
+type Config struct {
+	S3          S3Config          `toml:"s3"`
+	Replication ReplicationConfig `toml:"replication"`
+}
+
+// S3Config describes an S3-compatible bucket.
+type S3Config struct {
+	Endpoint        string `toml:"endpoint"` // e.g. https://s3.us-east-1.amazonaws.com
+	Region          string `toml:"region"`   // default us-east-1
+	Bucket          string `toml:"bucket"`
+	Prefix          string `toml:"prefix"` // key prefix, e.g. "mykb/"
+	AccessKeyID     string `toml:"access_key_id"`
+	SecretAccessKey string `toml:"secret_access_key"`
+	// Retain is how many of the newest backups are kept; older ones are
+	// deleted after each upload. 0 means DefaultRetain.
+	Retain int `toml:"retain"`
+}
+
+// Enabled reports whether a bucket is configured.
+func (c S3Config) Enabled() bool {
+	return c.Bucket != ""
+}
+
+// FileName names a backup taken at t. Names sort chronologically.
+func FileName(t time.Time) string {
+	return "mykb-" + t.UTC().Format("20060102T150405Z") + ".db"
+}
+
+// isBackupName reports whether name was produced by FileName.
+func isBackupName(name string) bool {
+	return strings.HasPrefix(name, "mykb-") && strings.HasSuffix(name, ".db")
+}
+
+// Remote uploads backups to an S3-compatible bucket.
+type Remote struct {
+	s3     *s3Client
+	prefix string
+	retain int
+}
+
+// NewRemote creates a Remote for cfg.
+func NewRemote(cfg S3Config) (*Remote, error) {
+	c, err := newS3Client(cfg)
+	if err != nil {
+		return nil, err
+	}
+	retain := cfg.Retain
+	if retain <= 0 {
+		retain = DefaultRetain
+	}
+	return &Remote{s3: c, prefix: cfg.Prefix, retain: retain}, nil
+}
+
+// Upload stores the backup file at path in the bucket under a timestamped
+// key, then prunes backups beyond the retention count. It returns the key.
+func (r *Remote) Upload(ctx context.Context, path string) (string, error) {
+	key := r.prefix + FileName(r.s3.now())
+	if err := r.s3.putFile(ctx, key, path); err != nil {
+		return "", fmt.Errorf("upload %s: %w", key, err)
+	}
+
+	if _, err := r.Prune(ctx); err != nil {
+		// The upload succeeded; old backups are pruned next time
+		log.Printf("Prune remote backups: %v", err)
+	}
+	return key, nil
+}
+
+// Prune deletes all but the newest retained backups under the prefix and
+// returns the deleted keys. Objects not named like backups are left alone.
+func (r *Remote) Prune(ctx context.Context) ([]string, error) {
+	keys, err := r.s3.list(ctx, r.prefix)
+	if err != nil {
+		return nil, fmt.Errorf("list backups: %w", err)
+	}
+	var backups []string
+	for _, k := range keys {
+		name := strings.TrimPrefix(k, r.prefix)
+		if !strings.Contains(name, "/") && isBackupName(name) {
+			backups = append(backups, k)
+		}
+	}
+	if len(backups) <= r.retain {
+		return nil, nil
+	}
+	sort.Strings(backups)
+
+	expired := backups[:len(backups)-r.retain]
+	for _, k := range expired {
+		if err := r.s3.delete(ctx, k); err != nil {
+			return nil, fmt.Errorf("delete %s: %w", k, err)
+		}
+	}
+	return expired, nil
+}
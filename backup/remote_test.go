@@ -0,0 +1,138 @@
+package backup
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a minimal in-memory S3 bucket.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	switch {
+	case r.Method == "PUT":
+		data, _ := io.ReadAll(r.Body)
+		f.objects[key] = data
+	case r.Method == "DELETE":
+		delete(f.objects, key)
+	case r.Method == "GET" && r.URL.Path == "/bucket":
+		var result struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+		}
+		for k := range f.objects {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				result.Contents = append(result.Contents, struct {
+					Key string `xml:"Key"`
+				}{k})
+			}
+		}
+		xml.NewEncoder(w).Encode(result)
+	case r.Method == "GET":
+		data, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	default:
+		http.Error(w, "unsupported", http.StatusBadRequest)
+	}
+}
+
+func (f *fakeS3) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for k := range f.objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestUploadAndPrune(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{
+		"kb/notes.txt":                   []byte("not a backup"),
+		"other/mykb-20200101T000000Z.db": []byte("other prefix"),
+	}}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	remote, err := NewRemote(S3Config{
+		Endpoint:        ts.URL,
+		Bucket:          "bucket",
+		Prefix:          "kb/",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		Retain:          2,
+	})
+	if err != nil {
+		t.Fatalf("NewRemote: %v", err)
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	remote.s3.now = func() time.Time { return now }
+
+	path := filepath.Join(t.TempDir(), "backup.db")
+	os.WriteFile(path, []byte("database bytes"), 0600)
+
+	for i := 0; i < 3; i++ {
+		key, err := remote.Upload(context.Background(), path)
+		if err != nil {
+			t.Fatalf("Upload: %v", err)
+		}
+		if key != "kb/"+FileName(now) {
+			t.Errorf("key = %q", key)
+		}
+		now = now.Add(time.Hour)
+	}
+
+	want := []string{
+		"kb/mykb-20240101T010000Z.db",
+		"kb/mykb-20240101T020000Z.db",
+		"kb/notes.txt",
+		"other/mykb-20200101T000000Z.db",
+	}
+	if got := fake.keys(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("objects = %v, want %v", got, want)
+	}
+	if string(fake.objects["kb/mykb-20240101T020000Z.db"]) != "database bytes" {
+		t.Error("uploaded content mismatch")
+	}
+}
+
+func TestUploadError(t *testing.T) {
+	ts := httptest.NewServer(&fakeS3{objects: map[string][]byte{}})
+	defer ts.Close()
+
+	remote, _ := NewRemote(S3Config{Endpoint: ts.URL, Bucket: "bucket", AccessKeyID: "wrong", SecretAccessKey: "x"})
+	path := filepath.Join(t.TempDir(), "backup.db")
+	os.WriteFile(path, []byte("x"), 0600)
+
+	if _, err := remote.Upload(context.Background(), path); err == nil || !strings.Contains(err.Error(), "status 403") {
+		t.Errorf("Upload error = %v", err)
+	}
+}
@@ -0,0 +1,615 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neoden/mykb/storage"
+)
+
+// Replication defaults.
+const (
+	DefaultReplicationInterval = time.Second
+	DefaultSnapshotInterval    = 24 * time.Hour
+	DefaultReplicaRetention    = 72 * time.Hour
+)
+
+// walCheckpointSize is how large the WAL may grow before the replicator
+// checkpoints it into the database file and starts a new one.
+const walCheckpointSize = 4 << 20
+
+// ReplicationConfig controls continuous WAL replication to the [backup.s3] bucket.
+type ReplicationConfig struct {
+	Enabled bool `toml:"enabled"`
+	// IntervalSeconds is how often new WAL frames are shipped (default 1).
+	IntervalSeconds int `toml:"interval_seconds"`
+	// SnapshotIntervalHours is how often a full snapshot starts a new
+	// generation, bounding how much WAL a restore replays (default 24).
+	SnapshotIntervalHours int `toml:"snapshot_interval_hours"`
+	// RetentionHours is how far back point-in-time restore reaches (default 72).
+	RetentionHours int `toml:"retention_hours"`
+	// MaxLagSeconds makes /health fail once the replica is further behind
+	// than this, or replication has stopped (0 never fails).
+	MaxLagSeconds int `toml:"max_lag_seconds"`
+
+	// Litestream runs litestream as a supervised child process in place
+	// of the built-in replicator.
+	Litestream LitestreamConfig `toml:"litestream"`
+}
+
+// MaxLag returns the largest healthy replication lag (0 for no limit).
+func (c ReplicationConfig) MaxLag() time.Duration {
+	return time.Duration(c.MaxLagSeconds) * time.Second
+}
+
+// ReplicationStatus describes continuous replication for /health.
+type ReplicationStatus struct {
+	// Mode is "builtin" or "litestream".
+	Mode    string `json:"mode"`
+	Running bool   `json:"running"`
+	// Generation is the replica generation being written (builtin only).
+	Generation string `json:"generation,omitempty"`
+	// CaughtUp is when the replica last held every committed write, and
+	// LagSeconds how long ago that was (builtin only; litestream does not
+	// report it).
+	CaughtUp   *time.Time `json:"caught_up,omitempty"`
+	LagSeconds *float64   `json:"lag_seconds,omitempty"`
+	// Restarts counts litestream process restarts.
+	Restarts  int    `json:"restarts,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Healthy reports whether replication is running and, with maxLag set,
+// at most maxLag behind.
+func (st ReplicationStatus) Healthy(maxLag time.Duration) bool {
+	if !st.Running {
+		return false
+	}
+	if maxLag <= 0 || st.Mode != "builtin" {
+		return true
+	}
+	return st.LagSeconds != nil && *st.LagSeconds <= maxLag.Seconds()
+}
+
+// Interval returns the WAL shipping interval.
+func (c ReplicationConfig) Interval() time.Duration {
+	if c.IntervalSeconds > 0 {
+		return time.Duration(c.IntervalSeconds) * time.Second
+	}
+	return DefaultReplicationInterval
+}
+
+// SnapshotInterval returns how often a new generation is started.
+func (c ReplicationConfig) SnapshotInterval() time.Duration {
+	if c.SnapshotIntervalHours > 0 {
+		return time.Duration(c.SnapshotIntervalHours) * time.Hour
+	}
+	return DefaultSnapshotInterval
+}
+
+// Retention returns how long replicated history is kept.
+func (c ReplicationConfig) Retention() time.Duration {
+	if c.RetentionHours > 0 {
+		return time.Duration(c.RetentionHours) * time.Hour
+	}
+	return DefaultReplicaRetention
+}
+
+// errWALReset means the WAL was restarted behind the replicator's back, so
+// the frames shipped so far no longer lead up to the current database.
+var errWALReset = errors.New("wal restarted unexpectedly")
+
+// Replicator ships the database's write-ahead log to object storage.
+//
+// Replicas are organised in generations under <prefix>replica/<generation>/:
+// a snapshot.db copy of the database file followed by wal/ segments. Each
+// segment is a byte range of one WAL file, named by WAL index (bumped after
+// every checkpoint), start offset and upload time. Restoring a point in time
+// replays the segments uploaded before it on top of the snapshot.
+//
+// Between checkpoints the replicator holds a read transaction, which stops
+// SQLite from restarting the WAL, so every committed frame stays readable
+// until it has been shipped.
+type Replicator struct {
+	db       *storage.DB
+	s3       *s3Client
+	prefix   string
+	cfg      ReplicationConfig
+	walPath  string
+	walLimit int64
+
+	lock     *storage.ReadLock
+	gen      string
+	genStart time.Time
+	index    uint32
+	pos      *walState // end of the shipped part of the current WAL
+	oldSalts *walState // header of the checkpointed WAL not yet overwritten
+
+	mu       sync.Mutex // guards the fields below, read by Status
+	running  bool
+	current  string    // generation, copied from gen
+	caughtUp time.Time // start of the last step that shipped everything
+	lastErr  string
+}
+
+// NewReplicator creates a Replicator for db that replicates to the bucket in s3cfg.
+func NewReplicator(db *storage.DB, s3cfg S3Config, cfg ReplicationConfig) (*Replicator, error) {
+	c, err := newS3Client(s3cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Replicator{
+		db:       db,
+		s3:       c,
+		prefix:   s3cfg.Prefix + "replica/",
+		cfg:      cfg,
+		walPath:  db.Path() + "-wal",
+		walLimit: walCheckpointSize,
+	}, nil
+}
+
+// Run replicates until ctx is cancelled. Errors after the first snapshot
+// are logged and retried on the next tick.
+func (r *Replicator) Run(ctx context.Context) error {
+	begin := r.s3.now()
+	if err := r.startGeneration(ctx); err != nil {
+		r.record(begin, err)
+		return fmt.Errorf("start replication: %w", err)
+	}
+	log.Printf("Replicating to generation %s", r.gen)
+	r.mu.Lock()
+	r.running = true
+	r.mu.Unlock()
+	r.record(begin, nil)
+	defer func() {
+		r.mu.Lock()
+		r.running = false
+		r.mu.Unlock()
+	}()
+	defer r.release()
+
+	ticker := time.NewTicker(r.cfg.Interval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// Ship what was committed before shutdown
+			final, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if r.lock != nil {
+				if err := r.sync(final); err != nil {
+					log.Printf("Replication: final sync: %v", err)
+				}
+			}
+			return nil
+		case <-ticker.C:
+			begin := r.s3.now()
+			err := r.step(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Replication: %v", err)
+			}
+			r.record(begin, err)
+		}
+	}
+}
+
+// record notes the outcome of a step begun at begin: on success every
+// write committed before begin has been shipped.
+func (r *Replicator) record(begin time.Time, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current = r.gen
+	if err != nil {
+		r.lastErr = err.Error()
+		return
+	}
+	r.caughtUp, r.lastErr = begin, ""
+}
+
+// Status reports how far behind the replica is.
+func (r *Replicator) Status() ReplicationStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := ReplicationStatus{
+		Mode:       "builtin",
+		Running:    r.running,
+		Generation: r.current,
+		LastError:  r.lastErr,
+	}
+	if !r.caughtUp.IsZero() {
+		caughtUp := r.caughtUp
+		lag := max(r.s3.now().Sub(caughtUp), 0).Seconds()
+		st.CaughtUp, st.LagSeconds = &caughtUp, &lag
+	}
+	return st
+}
+
+// step ships new frames, checkpointing or starting a new generation when due.
+func (r *Replicator) step(ctx context.Context) error {
+	if r.lock == nil || r.s3.now().Sub(r.genStart) >= r.cfg.SnapshotInterval() {
+		return r.startGeneration(ctx)
+	}
+	err := r.sync(ctx)
+	if errors.Is(err, errWALReset) {
+		log.Printf("Replication: %v; starting a new generation", err)
+		return r.startGeneration(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Stat(r.walPath); err == nil && fi.Size() >= r.walLimit {
+		return r.checkpoint(ctx)
+	}
+	return nil
+}
+
+// startGeneration uploads a snapshot of the database file and starts
+// shipping the WAL from empty.
+func (r *Replicator) startGeneration(ctx context.Context) error {
+	r.release()
+	r.pos, r.oldSalts = nil, nil
+
+	// Fold the WAL into the database file, then pin it empty. A reader that
+	// started on an empty WAL blocks checkpoints, so the file stays
+	// unchanged while it is copied.
+	for {
+		if done, err := r.db.Checkpoint(ctx, "TRUNCATE"); err != nil {
+			return err
+		} else if done {
+			lock, err := r.db.AcquireReadLock(ctx)
+			if err != nil {
+				return err
+			}
+			if fi, err := os.Stat(r.walPath); err == nil && fi.Size() > 0 {
+				lock.Release() // a write got in between
+			} else {
+				r.lock = lock
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	start := r.s3.now().UTC()
+	gen, err := newGenerationID(start)
+	if err != nil {
+		return err
+	}
+	if err := r.s3.putFile(ctx, r.prefix+gen+"/snapshot.db", r.db.Path()); err != nil {
+		r.release()
+		return fmt.Errorf("upload snapshot: %w", err)
+	}
+	r.gen, r.genStart, r.index = gen, start, 0
+
+	if err := r.prune(ctx); err != nil {
+		log.Printf("Replication: prune: %v", err)
+	}
+	return nil
+}
+
+// sync uploads frames committed since the last sync.
+func (r *Replicator) sync(ctx context.Context) error {
+	f, err := os.Open(r.walPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() < walHeaderSize {
+		return nil
+	}
+
+	hdr, err := readWALHeader(f)
+	if err != nil {
+		if r.pos == nil {
+			return nil // header of a new WAL not written yet
+		}
+		return err
+	}
+	base := r.pos
+	var start int64
+	switch {
+	case base != nil:
+		if !hdr.sameWAL(base) {
+			return errWALReset
+		}
+		start = base.offset
+	case r.oldSalts != nil && hdr.sameWAL(r.oldSalts):
+		return nil // checkpointed WAL not restarted yet
+	case r.oldSalts != nil && hdr.salt1 != r.oldSalts.salt1+1:
+		return errWALReset // restarted more than once
+	default:
+		base = hdr // shipped from the start, header included
+	}
+
+	end := scanFrames(f, fi.Size(), *base)
+	if end.offset == base.offset {
+		return nil
+	}
+	data := make([]byte, end.offset-start)
+	if _, err := f.ReadAt(data, start); err != nil {
+		return fmt.Errorf("read wal: %w", err)
+	}
+	// A restarted WAL gets its new header before any frame is overwritten,
+	// so an unchanged header means data was read intact
+	if again, err := readWALHeader(f); err != nil || !again.sameWAL(hdr) {
+		return errWALReset
+	}
+
+	key := fmt.Sprintf("%s%s/wal/%08x-%016x-%013d.wal", r.prefix, r.gen, r.index, start, r.s3.now().UnixMilli())
+	sum := sha256.Sum256(data)
+	if err := r.s3.put(ctx, key, bytes.NewReader(data), int64(len(data)), hex.EncodeToString(sum[:])); err != nil {
+		return fmt.Errorf("upload wal segment: %w", err)
+	}
+	r.pos, r.oldSalts = &end, nil
+	return nil
+}
+
+// checkpoint ships the WAL, checkpoints it and moves on to the next WAL
+// index. The read lock is released for the checkpoint, so frames committed
+// meanwhile are shipped afterwards from the old WAL if it is still intact.
+func (r *Replicator) checkpoint(ctx context.Context) error {
+	if err := r.sync(ctx); err != nil {
+		return err
+	}
+	r.release()
+	done, cpErr := r.db.Checkpoint(ctx, "RESTART")
+
+	err := r.sync(ctx)
+	if errors.Is(err, errWALReset) {
+		log.Printf("Replication: %v during checkpoint; starting a new generation", err)
+		return r.startGeneration(ctx)
+	}
+	if err != nil {
+		// Without the lock the WAL may restart before the next sync, so
+		// the next step starts a new generation
+		return err
+	}
+	if done && cpErr == nil && r.pos != nil {
+		r.index++
+		r.oldSalts, r.pos = r.pos, nil
+	}
+
+	if r.lock, err = r.db.AcquireReadLock(ctx); err != nil {
+		return err
+	}
+	return cpErr
+}
+
+// prune deletes generations superseded by one started before the retention window.
+func (r *Replicator) prune(ctx context.Context) error {
+	keys, err := r.s3.list(ctx, r.prefix)
+	if err != nil {
+		return err
+	}
+	gens := replicaGenerations(keys, r.prefix)
+	cutoff := r.s3.now().Add(-r.cfg.Retention())
+	for i := 0; i+1 < len(gens); i++ {
+		if gens[i].id == r.gen || !gens[i+1].start.Before(cutoff) {
+			continue
+		}
+		for _, k := range gens[i].keys {
+			if err := r.s3.delete(ctx, k); err != nil {
+				return fmt.Errorf("delete %s: %w", k, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Replicator) release() {
+	if r.lock != nil {
+		r.lock.Release()
+		r.lock = nil
+	}
+}
+
+// newGenerationID names a generation started at t. IDs sort chronologically.
+func newGenerationID(t time.Time) (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return t.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b), nil
+}
+
+// generation is one replica generation found in the bucket.
+type generation struct {
+	id       string
+	start    time.Time
+	snapshot string
+	segments []walSegment
+	keys     []string
+}
+
+// walSegment is one uploaded byte range of a WAL file.
+type walSegment struct {
+	key    string
+	index  uint32
+	offset int64
+	time   time.Time
+}
+
+// replicaGenerations groups keys under prefix by generation, oldest first.
+func replicaGenerations(keys []string, prefix string) []*generation {
+	byID := make(map[string]*generation)
+	for _, k := range keys {
+		id, rest, ok := strings.Cut(strings.TrimPrefix(k, prefix), "/")
+		if !ok {
+			continue
+		}
+		start, err := time.Parse("20060102T150405Z", strings.SplitN(id, "-", 2)[0])
+		if err != nil {
+			continue
+		}
+		g := byID[id]
+		if g == nil {
+			g = &generation{id: id, start: start}
+			byID[id] = g
+		}
+		g.keys = append(g.keys, k)
+
+		var seg walSegment
+		var ms int64
+		switch {
+		case rest == "snapshot.db":
+			g.snapshot = k
+		case strings.HasPrefix(rest, "wal/"):
+			if _, err := fmt.Sscanf(strings.TrimPrefix(rest, "wal/"), "%08x-%016x-%013d.wal", &seg.index, &seg.offset, &ms); err == nil {
+				seg.key, seg.time = k, time.UnixMilli(ms)
+				g.segments = append(g.segments, seg)
+			}
+		}
+	}
+
+	gens := make([]*generation, 0, len(byID))
+	for _, g := range byID {
+		sort.Slice(g.segments, func(i, j int) bool {
+			a, b := g.segments[i], g.segments[j]
+			if a.index != b.index {
+				return a.index < b.index
+			}
+			return a.offset < b.offset
+		})
+		gens = append(gens, g)
+	}
+	sort.Slice(gens, func(i, j int) bool { return gens[i].id < gens[j].id })
+	return gens
+}
+
+// RestoreReplica rebuilds the database as it was at time at from the
+// replica in the bucket and writes it to dst. It returns the upload time of
+// the last WAL segment applied, or the generation start if none was.
+func RestoreReplica(ctx context.Context, cfg S3Config, dst string, at time.Time) (time.Time, error) {
+	c, err := newS3Client(cfg)
+	if err != nil {
+		return time.Time{}, err
+	}
+	prefix := cfg.Prefix + "replica/"
+	keys, err := c.list(ctx, prefix)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("list replica: %w", err)
+	}
+
+	var gen *generation
+	for _, g := range replicaGenerations(keys, prefix) {
+		if g.snapshot != "" && !g.start.After(at) {
+			gen = g
+		}
+	}
+	if gen == nil {
+		return time.Time{}, fmt.Errorf("no replica generation started before %s", at.Format(time.RFC3339))
+	}
+
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		os.Remove(dst + suffix)
+	}
+	if err := download(ctx, c, gen.snapshot, dst); err != nil {
+		return time.Time{}, err
+	}
+
+	// Replay WAL indexes in order, each from offset 0 with no gaps, stopping
+	// at the first segment uploaded after at
+	restoredTo := gen.start
+	segs := gen.segments
+	for index := uint32(0); len(segs) > 0 && segs[0].index == index; index++ {
+		var wal bytes.Buffer
+		complete := true
+		for len(segs) > 0 && segs[0].index == index {
+			seg := segs[0]
+			if seg.time.After(at) || seg.offset != int64(wal.Len()) {
+				complete = false
+				break
+			}
+			if err := c.get(ctx, seg.key, &wal); err != nil {
+				return time.Time{}, err
+			}
+			restoredTo = seg.time
+			segs = segs[1:]
+		}
+		if wal.Len() > 0 {
+			if err := applyWAL(dst, wal.Bytes()); err != nil {
+				return time.Time{}, fmt.Errorf("apply wal %d: %w", index, err)
+			}
+		}
+		if !complete {
+			break
+		}
+	}
+
+	if err := setJournalMode(dst, "DELETE"); err != nil {
+		return time.Time{}, err
+	}
+	return restoredTo, nil
+}
+
+// download writes key to the file at path.
+func download(ctx context.Context, c *s3Client, key, path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := c.get(ctx, key, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// applyWAL checkpoints wal into the database file at path.
+func applyWAL(path string, wal []byte) error {
+	os.Remove(path + "-shm")
+	if err := os.WriteFile(path+"-wal", wal, 0600); err != nil {
+		return err
+	}
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+
+	var busy, logFrames, checkpointed int
+	if err := conn.QueryRow("PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logFrames, &checkpointed); err != nil {
+		return err
+	}
+	if busy != 0 || logFrames != checkpointed {
+		return fmt.Errorf("checkpoint incomplete: %d of %d frames", checkpointed, logFrames)
+	}
+	return nil
+}
+
+// setJournalMode switches the database file at path to mode.
+func setJournalMode(path, mode string) error {
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Exec("PRAGMA journal_mode=" + mode); err != nil {
+		return fmt.Errorf("set journal mode: %w", err)
+	}
+	return nil
+}
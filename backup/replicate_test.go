@@ -0,0 +1,202 @@
+package backup
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neoden/mykb/storage"
+)
+
+func TestScanFrames(t *testing.T) {
+	const pageSize = 512
+	wal := make([]byte, walHeaderSize)
+	binary.BigEndian.PutUint32(wal[0:], walMagicLE)
+	binary.BigEndian.PutUint32(wal[4:], 3007000)
+	binary.BigEndian.PutUint32(wal[8:], pageSize)
+	binary.BigEndian.PutUint32(wal[16:], 11)
+	binary.BigEndian.PutUint32(wal[20:], 22)
+	s1, s2 := walChecksum(false, 0, 0, wal[:24])
+	binary.BigEndian.PutUint32(wal[24:], s1)
+	binary.BigEndian.PutUint32(wal[28:], s2)
+
+	appendFrame := func(pgno, commit uint32) {
+		frame := make([]byte, walFrameHeaderSize+pageSize)
+		binary.BigEndian.PutUint32(frame[0:], pgno)
+		binary.BigEndian.PutUint32(frame[4:], commit)
+		binary.BigEndian.PutUint32(frame[8:], 11)
+		binary.BigEndian.PutUint32(frame[12:], 22)
+		frame[walFrameHeaderSize] = byte(pgno)
+		s1, s2 = walChecksum(false, s1, s2, frame[:8])
+		s1, s2 = walChecksum(false, s1, s2, frame[walFrameHeaderSize:])
+		binary.BigEndian.PutUint32(frame[16:], s1)
+		binary.BigEndian.PutUint32(frame[20:], s2)
+		wal = append(wal, frame...)
+	}
+	appendFrame(1, 0)
+	appendFrame(2, 2) // commits a two-page transaction
+	appendFrame(3, 0) // transaction still in progress
+
+	st, err := readWALHeader(strings.NewReader(string(wal)))
+	if err != nil {
+		t.Fatalf("readWALHeader: %v", err)
+	}
+	frameSize := int64(walFrameHeaderSize + pageSize)
+	end := scanFrames(strings.NewReader(string(wal)), int64(len(wal)), *st)
+	if end.offset != walHeaderSize+2*frameSize {
+		t.Errorf("committed offset = %d, want %d", end.offset, walHeaderSize+2*frameSize)
+	}
+
+	// A corrupted page ends the valid log before it
+	wal[walHeaderSize+walFrameHeaderSize]++
+	if end := scanFrames(strings.NewReader(string(wal)), int64(len(wal)), *st); end.offset != walHeaderSize {
+		t.Errorf("offset after corruption = %d, want %d", end.offset, walHeaderSize)
+	}
+
+	if _, err := readWALHeader(strings.NewReader(strings.Repeat("x", walHeaderSize))); err == nil {
+		t.Error("expected error for invalid header")
+	}
+}
+
+func TestReplicateAndRestore(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeS3{objects: map[string][]byte{}}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+	s3cfg := S3Config{
+		Endpoint:        ts.URL,
+		Bucket:          "bucket",
+		Prefix:          "kb/",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+	}
+
+	dir := t.TempDir()
+	db, err := storage.Open(filepath.Join(dir, "data.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	db.CreateChunk(ctx, "before replication", nil)
+
+	r, err := NewReplicator(db, s3cfg, ReplicationConfig{Enabled: true})
+	if err != nil {
+		t.Fatalf("NewReplicator: %v", err)
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.s3.now = func() time.Time { return now }
+
+	if err := r.startGeneration(ctx); err != nil {
+		t.Fatalf("startGeneration: %v", err)
+	}
+	defer r.release()
+
+	// One chunk per minute; the third lands after a checkpoint in a new WAL
+	for i, content := range []string{"first", "second", "third"} {
+		now = now.Add(time.Minute)
+		if i == 2 {
+			if err := r.checkpoint(ctx); err != nil {
+				t.Fatalf("checkpoint: %v", err)
+			}
+			if r.index != 1 {
+				t.Fatalf("index after checkpoint = %d, want 1", r.index)
+			}
+		}
+		if _, err := db.CreateChunk(ctx, content, nil); err != nil {
+			t.Fatalf("CreateChunk: %v", err)
+		}
+		if err := r.sync(ctx); err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		at   time.Time
+		want int
+	}{
+		{start, 1},
+		{start.Add(90 * time.Second), 2},
+		{start.Add(2 * time.Minute), 3},
+		{start.Add(time.Hour), 4},
+	} {
+		dst := filepath.Join(dir, "restored-"+tc.at.Format("150405")+".db")
+		if _, err := RestoreReplica(ctx, s3cfg, dst, tc.at); err != nil {
+			t.Fatalf("RestoreReplica(%s): %v", tc.at, err)
+		}
+		info, err := storage.CheckBackup(ctx, dst, storage.Config{})
+		if err != nil {
+			t.Fatalf("CheckBackup: %v", err)
+		}
+		if info.Chunks != tc.want {
+			t.Errorf("chunks at %s = %d, want %d", tc.at.Format(time.TimeOnly), info.Chunks, tc.want)
+		}
+	}
+
+	if _, err := RestoreReplica(ctx, s3cfg, filepath.Join(dir, "early.db"), start.Add(-time.Hour)); err == nil {
+		t.Error("expected error restoring before the first generation")
+	}
+}
+
+func TestReplicaPrune(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{
+		"replica/20240101T000000Z-aaaa/snapshot.db":                                     nil,
+		"replica/20240101T000000Z-aaaa/wal/00000000-0000000000000000-1704067200000.wal": nil,
+		"replica/20240102T000000Z-bbbb/snapshot.db":                                     nil,
+		"replica/20240105T000000Z-cccc/snapshot.db":                                     nil,
+	}}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	c, err := newS3Client(S3Config{Endpoint: ts.URL, Bucket: "bucket", AccessKeyID: "AKID"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.now = func() time.Time { return time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC) }
+	r := &Replicator{s3: c, prefix: "replica/", gen: "20240105T000000Z-cccc", cfg: ReplicationConfig{RetentionHours: 72}}
+
+	if err := r.prune(context.Background()); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	// aaaa was superseded more than 72h ago; bbbb still covers part of the window
+	want := "replica/20240102T000000Z-bbbb/snapshot.db,replica/20240105T000000Z-cccc/snapshot.db"
+	if got := strings.Join(fake.keys(), ","); got != want {
+		t.Errorf("objects = %s, want %s", got, want)
+	}
+}
+
+func TestReplicationStatus(t *testing.T) {
+	c, err := newS3Client(S3Config{Endpoint: "http://localhost", Bucket: "bucket", AccessKeyID: "AKID"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	r := &Replicator{s3: c, gen: "20240101T000000Z-aaaa"}
+
+	if st := r.Status(); st.Running || st.LagSeconds != nil || st.Healthy(0) {
+		t.Errorf("Status before start = %+v", st)
+	}
+
+	r.running = true
+	r.record(now, nil)
+	now = now.Add(5 * time.Second)
+	r.record(now, errors.New("upload failed")) // the replica falls behind
+	now = now.Add(5 * time.Second)
+
+	st := r.Status()
+	if st.LagSeconds == nil || *st.LagSeconds != 10 || st.Generation != "20240101T000000Z-aaaa" || st.LastError != "upload failed" {
+		t.Errorf("Status = %+v", st)
+	}
+	if !st.Healthy(0) || !st.Healthy(time.Minute) || st.Healthy(9*time.Second) {
+		t.Errorf("Healthy mismatch for lag %v", *st.LagSeconds)
+	}
+}
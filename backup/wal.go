@@ -0,0 +1,104 @@
+package backup
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// SQLite write-ahead log layout (https://www.sqlite.org/fileformat.html#the_write_ahead_log).
+const (
+	walHeaderSize      = 32
+	walFrameHeaderSize = 24
+	walMagicLE         = 0x377f0682 // checksums over little-endian words
+	walMagicBE         = 0x377f0683 // checksums over big-endian words
+)
+
+// walState identifies a position in one WAL: the salts of its header and
+// the running checksum after the last committed frame read so far.
+type walState struct {
+	salt1, salt2 uint32
+	ck1, ck2     uint32
+	bigEndian    bool
+	pageSize     int64
+	offset       int64 // end of the last committed frame
+}
+
+// readWALHeader parses the WAL header at the start of r.
+func readWALHeader(r io.ReaderAt) (*walState, error) {
+	hdr := make([]byte, walHeaderSize)
+	if _, err := r.ReadAt(hdr, 0); err != nil {
+		return nil, fmt.Errorf("read wal header: %w", err)
+	}
+	st := &walState{}
+	switch binary.BigEndian.Uint32(hdr[0:4]) {
+	case walMagicLE:
+	case walMagicBE:
+		st.bigEndian = true
+	default:
+		return nil, errors.New("invalid wal magic")
+	}
+	st.pageSize = int64(binary.BigEndian.Uint32(hdr[8:12]))
+	if st.pageSize == 1 { // 65536 is stored as 1
+		st.pageSize = 65536
+	}
+	if st.pageSize < 512 || st.pageSize&(st.pageSize-1) != 0 {
+		return nil, fmt.Errorf("invalid wal page size %d", st.pageSize)
+	}
+	st.salt1 = binary.BigEndian.Uint32(hdr[16:20])
+	st.salt2 = binary.BigEndian.Uint32(hdr[20:24])
+	st.ck1, st.ck2 = walChecksum(st.bigEndian, 0, 0, hdr[:24])
+	if st.ck1 != binary.BigEndian.Uint32(hdr[24:28]) || st.ck2 != binary.BigEndian.Uint32(hdr[28:32]) {
+		return nil, errors.New("wal header checksum mismatch")
+	}
+	st.offset = walHeaderSize
+	return st, nil
+}
+
+// sameWAL reports whether two states belong to the same WAL generation.
+func (st *walState) sameWAL(other *walState) bool {
+	return st.salt1 == other.salt1 && st.salt2 == other.salt2
+}
+
+// scanFrames validates frames after st.offset and returns the state after
+// the last committed frame. Frames of a later transaction that is still
+// being written, or left over from an earlier WAL, are not included.
+func scanFrames(r io.ReaderAt, size int64, st walState) walState {
+	frameSize := walFrameHeaderSize + st.pageSize
+	frame := make([]byte, frameSize)
+	committed := st
+	for off := st.offset; off+frameSize <= size; off += frameSize {
+		if _, err := r.ReadAt(frame, off); err != nil {
+			break
+		}
+		if binary.BigEndian.Uint32(frame[8:12]) != st.salt1 || binary.BigEndian.Uint32(frame[12:16]) != st.salt2 {
+			break
+		}
+		ck1, ck2 := walChecksum(st.bigEndian, st.ck1, st.ck2, frame[:8])
+		ck1, ck2 = walChecksum(st.bigEndian, ck1, ck2, frame[walFrameHeaderSize:])
+		if ck1 != binary.BigEndian.Uint32(frame[16:20]) || ck2 != binary.BigEndian.Uint32(frame[20:24]) {
+			break
+		}
+		st.ck1, st.ck2 = ck1, ck2
+		st.offset = off + frameSize
+		if binary.BigEndian.Uint32(frame[4:8]) != 0 { // commit frame
+			committed = st
+		}
+	}
+	return committed
+}
+
+// walChecksum continues the WAL checksum (s1, s2) over data, which must be
+// a multiple of 8 bytes long.
+func walChecksum(bigEndian bool, s1, s2 uint32, data []byte) (uint32, uint32) {
+	var order binary.ByteOrder = binary.LittleEndian
+	if bigEndian {
+		order = binary.BigEndian
+	}
+	for i := 0; i+8 <= len(data); i += 8 {
+		s1 += order.Uint32(data[i:]) + s2
+		s2 += order.Uint32(data[i+4:]) + s1
+	}
+	return s1, s2
+}
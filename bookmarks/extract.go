@@ -0,0 +1,123 @@
+package bookmarks
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Page is the readable part of a fetched page.
+type Page struct {
+	Title string
+	Text  string
+}
+
+var whitespace = regexp.MustCompile(`\s+`)
+
+// skipped elements never hold readable text.
+var skipped = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Svg: true, atom.Iframe: true, atom.Form: true, atom.Button: true,
+	atom.Nav: true, atom.Header: true, atom.Footer: true, atom.Aside: true,
+}
+
+// blocks start a new line of text.
+var blocks = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Br: true, atom.Li: true, atom.Tr: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Section: true, atom.Article: true, atom.Main: true, atom.Blockquote: true,
+	atom.Pre: true, atom.Ul: true, atom.Ol: true, atom.Table: true, atom.Dd: true, atom.Dt: true,
+	atom.Figcaption: true, atom.Hr: true,
+}
+
+// Extract returns the title and readable text of an HTML document: the
+// text of its <article> (or <main>, or <body>) without scripts, styles and
+// navigation, one block per line.
+func Extract(r io.Reader) (*Page, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("parse html: %w", err)
+	}
+
+	page := &Page{}
+	if t := find(doc, atom.Title); t != nil {
+		page.Title = collapse(textOf(t))
+	}
+	root := find(doc, atom.Article)
+	if root == nil {
+		root = find(doc, atom.Main)
+	}
+	if root == nil {
+		root = doc
+	}
+
+	var b strings.Builder
+	writeText(&b, root, false)
+	var lines []string
+	for _, line := range strings.Split(b.String(), "\n") {
+		if line = collapse(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	page.Text = strings.Join(lines, "\n")
+	return page, nil
+}
+
+// writeText writes the text under n. Line breaks in the source only
+// survive inside <pre>.
+func writeText(b *strings.Builder, n *html.Node, pre bool) {
+	switch n.Type {
+	case html.TextNode:
+		if pre {
+			b.WriteString(n.Data)
+		} else {
+			b.WriteString(whitespace.ReplaceAllString(n.Data, " "))
+		}
+		return
+	case html.ElementNode:
+		if skipped[n.DataAtom] || n.DataAtom == atom.Head {
+			return
+		}
+	}
+	block := n.Type == html.ElementNode && blocks[n.DataAtom]
+	if block {
+		b.WriteByte('\n')
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeText(b, c, pre || n.DataAtom == atom.Pre)
+	}
+	if block {
+		b.WriteByte('\n')
+	}
+}
+
+// find returns the first element of type a in document order.
+func find(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := find(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func textOf(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+	}
+	return b.String()
+}
+
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
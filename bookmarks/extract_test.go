@@ -0,0 +1,43 @@
+package bookmarks
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name, html, title, text string
+	}{
+		{
+			"article",
+			`<html><head><title> A   post </title><style>p{}</style></head><body>
+				<nav>Home | About</nav>
+				<article><h1>Heading</h1><p>First <b>bold</b>
+				paragraph.</p><script>track()</script><ul><li>one</li><li>two</li></ul></article>
+				<footer>Copyright</footer></body></html>`,
+			"A post",
+			"Heading\nFirst bold paragraph.\none\ntwo",
+		},
+		{
+			"body without article",
+			`<body><header>Site</header><div>Only<br>text, <i>styled</i>.</div></body>`,
+			"",
+			"Only\ntext, styled.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := Extract(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatalf("Extract: %v", err)
+			}
+			if page.Title != tt.title {
+				t.Errorf("Title = %q, want %q", page.Title, tt.title)
+			}
+			if page.Text != tt.text {
+				t.Errorf("Text = %q, want %q", page.Text, tt.text)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package bookmarks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fetch defaults.
+const (
+	DefaultConcurrency = 8
+	DefaultMaxBytes    = 5 << 20
+	defaultTimeout     = 30 * time.Second
+	userAgent          = "mykb-bookmark-import/1.0"
+)
+
+// Fetcher downloads bookmarked pages and extracts their text.
+type Fetcher struct {
+	Client *http.Client
+	// Concurrency is how many pages are fetched at once.
+	Concurrency int
+	// MaxBytes caps how much of each page is read.
+	MaxBytes int64
+}
+
+// NewFetcher creates a Fetcher running up to concurrency requests at once
+// (DefaultConcurrency if not positive). It fetches only from public
+// addresses; see PublicClient.
+func NewFetcher(concurrency int) *Fetcher {
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+	return &Fetcher{
+		Client:      PublicClient(defaultTimeout),
+		Concurrency: concurrency,
+		MaxBytes:    DefaultMaxBytes,
+	}
+}
+
+// Result is the outcome of fetching one bookmark.
+type Result struct {
+	Bookmark Bookmark
+	Page     *Page // nil if Err is set
+	Err      error
+}
+
+// FetchAll fetches every bookmark and calls fn with each result as it
+// completes. fn is called from one goroutine at a time, so it may write to
+// storage directly. If fn returns an error, outstanding fetches are
+// cancelled and that error is returned.
+func (f *Fetcher) FetchAll(ctx context.Context, list []Bookmark, fn func(Result) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan Bookmark)
+	results := make(chan Result)
+	var wg sync.WaitGroup
+	for i := 0; i < f.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range jobs {
+				page, err := f.Fetch(ctx, b.URL)
+				select {
+				case results <- Result{Bookmark: b, Page: page, Err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, b := range list {
+			select {
+			case jobs <- b:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var fnErr error
+	for r := range results {
+		if fnErr != nil {
+			continue // drain until workers exit
+		}
+		if err := fn(r); err != nil {
+			fnErr = err
+			cancel()
+		}
+	}
+	if fnErr != nil {
+		return fnErr
+	}
+	return ctx.Err()
+}
+
+// Fetch downloads one page and extracts its readable text.
+func (f *Fetcher) Fetch(ctx context.Context, url string) (*Page, error) {
+	data, mediaType, err := f.Download(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return PageOf(data, mediaType)
+}
+
+// Download fetches up to MaxBytes of a page, returning it with its media
+// type.
+func (f *Fetcher) Download(ctx context.Context, url string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,text/plain;q=0.9")
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, "", fmt.Errorf("%s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.MaxBytes))
+	if err != nil {
+		return nil, "", fmt.Errorf("read body: %w", err)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return data, mediaType, nil
+}
+
+// PageOf extracts the readable text of a downloaded page.
+func PageOf(data []byte, mediaType string) (*Page, error) {
+	var page *Page
+	switch {
+	case mediaType == "" || mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		var err error
+		if page, err = Extract(bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+	case mediaType == "text/plain" || mediaType == "text/markdown":
+		page = &Page{Text: strings.TrimSpace(string(data))}
+	default:
+		return nil, fmt.Errorf("unsupported content type %s", mediaType)
+	}
+	if page.Text == "" {
+		return nil, fmt.Errorf("no readable text")
+	}
+	return page, nil
+}
@@ -0,0 +1,119 @@
+package bookmarks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetchAll(t *testing.T) {
+	AllowPrivate = true
+	t.Cleanup(func() { AllowPrivate = false })
+	var inFlight, peak atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+		case "/plain":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprint(w, "  plain text  ")
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, "<title>%s</title><p>Page %s</p>", r.URL.Path, r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	var list []Bookmark
+	for i := 0; i < 10; i++ {
+		list = append(list, Bookmark{URL: fmt.Sprintf("%s/p%d", ts.URL, i)})
+	}
+	list = append(list, Bookmark{URL: ts.URL + "/missing"}, Bookmark{URL: ts.URL + "/image"}, Bookmark{URL: ts.URL + "/plain"})
+
+	f := NewFetcher(3)
+	pages, failed := 0, 0
+	err := f.FetchAll(context.Background(), list, func(r Result) error {
+		if r.Err != nil {
+			failed++
+			return nil
+		}
+		if r.Page.Text == "" {
+			t.Errorf("%s: empty text", r.Bookmark.URL)
+		}
+		pages++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("FetchAll: %v", err)
+	}
+	if pages != 11 || failed != 2 {
+		t.Errorf("pages = %d, failed = %d, want 11 and 2", pages, failed)
+	}
+	if p := peak.Load(); p > 3 {
+		t.Errorf("peak concurrency = %d, want at most 3", p)
+	}
+
+	// An error from fn stops the import
+	stop := errors.New("stop")
+	calls := 0
+	err = f.FetchAll(context.Background(), list, func(Result) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("FetchAll = %v after %d calls, want stop after 1", err, calls)
+	}
+}
+
+func TestPublicClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<p>Internal</p>")
+	}))
+	defer ts.Close()
+
+	f := NewFetcher(1)
+	for _, u := range []string{ts.URL, strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)} {
+		if _, err := f.Fetch(context.Background(), u); err == nil || !strings.Contains(err.Error(), "not a public address") {
+			t.Errorf("Fetch(%s) = %v, want refused", u, err)
+		}
+	}
+
+	for addr, want := range map[string]bool{
+		"93.184.216.34":    true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"100.64.0.1":       false,
+		"169.254.169.254":  false,
+		"fe80::1":          false,
+		"fd00::1":          false,
+		"0.0.0.0":          false,
+		"224.0.0.1":        false,
+		"::ffff:127.0.0.1": false,
+	} {
+		if got := isPublic(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("isPublic(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Package bookmarks reads browser bookmark and Pocket exports and fetches
+// the readable text of each bookmarked page.
+package bookmarks
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Bookmark is one saved URL.
+type Bookmark struct {
+	URL     string
+	Title   string
+	Tags    []string
+	AddedAt time.Time // zero if the export has no date
+}
+
+// Parse reads a Netscape bookmark file (exported by browsers and by
+// Pocket's HTML export) or a Pocket CSV export, detected from the content.
+// Bookmarks that are not http(s) URLs are left out, and a URL listed twice
+// is kept once.
+func Parse(r io.Reader) ([]Bookmark, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, fmt.Errorf("read bookmarks: %w", err)
+	}
+	head = bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\ufeff")), " \t\r\n")
+
+	var list []Bookmark
+	if bytes.HasPrefix(head, []byte("<")) {
+		list, err = parseNetscape(br)
+	} else {
+		list, err = parsePocketCSV(br)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	out := list[:0]
+	for _, b := range list {
+		if !isWebURL(b.URL) || seen[b.URL] {
+			continue
+		}
+		seen[b.URL] = true
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+// parseNetscape reads <A HREF="..." ADD_DATE="..." TAGS="...">Title</A> entries.
+func parseNetscape(r io.Reader) ([]Bookmark, error) {
+	var list []Bookmark
+	var cur *Bookmark
+	z := html.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return list, nil
+			}
+			return nil, fmt.Errorf("parse bookmarks: %w", z.Err())
+		case html.StartTagToken:
+			name, hasAttr := z.TagName()
+			if string(name) != "a" {
+				continue
+			}
+			cur = &Bookmark{}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				switch string(key) {
+				case "href":
+					cur.URL = strings.TrimSpace(string(val))
+				case "add_date", "time_added":
+					cur.AddedAt = unixTime(string(val))
+				case "tags":
+					cur.Tags = splitTags(string(val), ",")
+				}
+			}
+		case html.TextToken:
+			if cur != nil {
+				cur.Title += string(z.Text())
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "a" && cur != nil {
+				cur.Title = strings.Join(strings.Fields(cur.Title), " ")
+				list = append(list, *cur)
+				cur = nil
+			}
+		}
+	}
+}
+
+// parsePocketCSV reads Pocket's title,url,time_added,tags,status export.
+// Tags are separated by "|".
+func parsePocketCSV(r io.Reader) ([]Bookmark, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header: %w", err)
+	}
+	col := make(map[string]int)
+	for i, name := range header {
+		col[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := col["url"]; !ok {
+		return nil, fmt.Errorf("not a bookmark export: expected HTML or CSV with a url column")
+	}
+	field := func(rec []string, name string) string {
+		if i, ok := col[name]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	var list []Bookmark
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return list, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read csv: %w", err)
+		}
+		list = append(list, Bookmark{
+			URL:     field(rec, "url"),
+			Title:   field(rec, "title"),
+			Tags:    splitTags(field(rec, "tags"), "|"),
+			AddedAt: unixTime(field(rec, "time_added")),
+		})
+	}
+}
+
+func splitTags(s, sep string) []string {
+	var tags []string
+	for _, t := range strings.Split(s, sep) {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+func unixTime(s string) time.Time {
+	secs, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || secs <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(secs, 0).UTC()
+}
+
+func isWebURL(u string) bool {
+	return strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://")
+}
@@ -0,0 +1,57 @@
+package bookmarks
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseNetscape(t *testing.T) {
+	input := `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+    <DT><H3 ADD_DATE="1700000000">Reading</H3>
+    <DL><p>
+        <DT><A HREF="https://go.dev/doc/effective_go" ADD_DATE="1700000001" TAGS="go,docs">Effective
+            Go</A>
+        <DT><A HREF="javascript:alert(1)">Bookmarklet</A>
+        <DT><A HREF="https://go.dev/doc/effective_go">Duplicate</A>
+    </DL><p>
+    <DT><A HREF="http://example.com/">Example</A>
+</DL><p>`
+	got, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := []Bookmark{
+		{URL: "https://go.dev/doc/effective_go", Title: "Effective Go", Tags: []string{"go", "docs"}, AddedAt: time.Unix(1700000001, 0).UTC()},
+		{URL: "http://example.com/", Title: "Example"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse = %+v, want %+v", got, want)
+	}
+}
+
+func TestParsePocketCSV(t *testing.T) {
+	input := "\ufefftitle,url,time_added,tags,status\n" +
+		`"Go, the language",https://go.dev/,1700000000,go|lang,unread` + "\n" +
+		`,https://example.com/x,,,archive` + "\n"
+	got, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := []Bookmark{
+		{URL: "https://go.dev/", Title: "Go, the language", Tags: []string{"go", "lang"}, AddedAt: time.Unix(1700000000, 0).UTC()},
+		{URL: "https://example.com/x"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse = %+v, want %+v", got, want)
+	}
+
+	if _, err := Parse(strings.NewReader("name,link\na,b\n")); err == nil {
+		t.Error("expected error for CSV without a url column")
+	}
+}
@@ -0,0 +1,62 @@
+package bookmarks
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// AllowPrivate lets clients from PublicClient connect to loopback and
+// private addresses, as tests serving pages with httptest need. It must
+// not be set otherwise.
+var AllowPrivate bool
+
+// sharedAddress is the carrier-grade NAT range, private but not covered by
+// netip.Addr.IsPrivate.
+var sharedAddress = netip.MustParsePrefix("100.64.0.0/10")
+
+// PublicClient returns an HTTP client for fetching URLs given by users and
+// agents. It refuses to connect to anything but public addresses, so a URL
+// cannot reach the mykb host itself, the local network or a cloud metadata
+// endpoint. The check is made on the address dialed, after DNS resolution,
+// so it holds for every redirect and for names resolving to private
+// addresses. Proxies from the environment are not used.
+func PublicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   dialControl,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// dialControl refuses connections to addresses that are not public.
+func dialControl(network, address string, _ syscall.RawConn) error {
+	if AllowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !isPublic(addr) {
+		return fmt.Errorf("refusing to connect to %s: not a public address", addr)
+	}
+	return nil
+}
+
+// isPublic reports whether addr is a globally routable unicast address.
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddress.Contains(addr)
+}
@@ -8,15 +8,53 @@ import (
 	"runtime"
 	"strings"
 
+	"github.com/neoden/mykb/backup"
 	"github.com/neoden/mykb/embedding"
+	"github.com/neoden/mykb/gitmirror"
+	"github.com/neoden/mykb/httpd"
+	"github.com/neoden/mykb/ingest"
+	"github.com/neoden/mykb/llm"
+	"github.com/neoden/mykb/mcp"
+	"github.com/neoden/mykb/rerank"
+	"github.com/neoden/mykb/retention"
+	"github.com/neoden/mykb/review"
+	"github.com/neoden/mykb/storage"
+	"github.com/neoden/mykb/transcribe"
+	"github.com/neoden/mykb/vector"
 	"github.com/pelletier/go-toml/v2"
 )
 
 // Config holds all application configuration.
 type Config struct {
-	DataDir   string           `toml:"data_dir"`
-	Embedding embedding.Config `toml:"embedding"`
-	Server    ServerConfig     `toml:"server"`
+	DataDir   string               `toml:"data_dir"`
+	Embedding embedding.Config     `toml:"embedding"`
+	Server    ServerConfig         `toml:"server"`
+	Storage   storage.Config       `toml:"storage"`
+	Search    storage.SearchConfig `toml:"search"`
+	Backup    backup.Config        `toml:"backup"`
+	RateLimit mcp.RateLimitConfig  `toml:"rate_limit"`
+	Ranking   mcp.RankingConfig    `toml:"ranking"`
+	Sessions  mcp.SessionConfig    `toml:"sessions"`
+	Ingest    ingest.Config        `toml:"ingest"`
+	Recording mcp.RecordingConfig  `toml:"recording"`
+	Unfurl    mcp.UnfurlConfig     `toml:"unfurl"`
+	Enrich    mcp.EnrichConfig     `toml:"enrich"`
+	Entities  mcp.EntitiesConfig   `toml:"entities"`
+	Daily     mcp.DailyConfig      `toml:"daily"`
+	LLM       llm.Config           `toml:"llm"`
+	Retention retention.Config     `toml:"retention"`
+	Review    review.Config        `toml:"review"`
+	Git       gitmirror.Config     `toml:"git"`
+	Index     vector.Config        `toml:"index"`
+	Rerank    rerank.Config        `toml:"rerank"`
+
+	Transcription transcribe.Config `toml:"transcription"`
+
+	Maintenance storage.MaintenanceConfig `toml:"maintenance"`
+	Attachments storage.AttachmentConfig  `toml:"attachments"`
+
+	// Profile names the [profiles.<name>] table applied, if any.
+	Profile string `toml:"-"`
 }
 
 // ServerConfig holds HTTP server settings.
@@ -24,6 +62,21 @@ type ServerConfig struct {
 	Listen      string `toml:"listen"`
 	Domain      string `toml:"domain"`
 	BehindProxy bool   `toml:"behind_proxy"`
+	// ProxyProtocol accepts PROXY protocol (v1/v2) headers from a fronting
+	// TCP load balancer; every connection from TrustedProxies (IPs or CIDR
+	// prefixes, required with it) must then carry one.
+	ProxyProtocol  bool     `toml:"proxy_protocol"`
+	TrustedProxies []string `toml:"trusted_proxies"`
+
+	// AccessTokenFormat is "opaque" (default, stored in DB) or "jwt" (signed, stateless).
+	AccessTokenFormat string `toml:"access_token_format"`
+	// KeyRotationDays is how long a JWT signing key is used before rotating.
+	KeyRotationDays int `toml:"key_rotation_days"`
+
+	OIDC httpd.OIDCConfig `toml:"oidc"`
+
+	// Hooks accept JSON payloads at POST /hooks/<name> as chunks.
+	Hooks []httpd.HookConfig `toml:"hooks"`
 }
 
 // Default returns a Config with default values.
@@ -45,21 +98,44 @@ func Default() *Config {
 	}
 }
 
-// Load reads configuration from a TOML file.
-// If the file doesn't exist, returns default config.
-// Applies platform-specific defaults for empty values.
+// Load reads configuration from a TOML file, for the profile named by
+// $MYKB_PROFILE if set (see LoadProfile).
 func Load(path string) (*Config, error) {
+	return LoadProfile(path, "")
+}
+
+// LoadProfile reads configuration from a TOML file.
+// If the file doesn't exist (or path is empty), returns default config.
+// A profile, or else $MYKB_PROFILE, selects a [profiles.<name>] table to
+// overlay (see applyProfile). MYKB_* environment variables then override
+// it (see applyEnv), and platform-specific defaults fill empty values.
+func LoadProfile(path, profile string) (*Config, error) {
 	cfg := Default()
+	if profile == "" {
+		profile = os.Getenv("MYKB_PROFILE")
+	}
 
-	data, err := os.ReadFile(path)
-	if err != nil && !os.IsNotExist(err) {
-		return nil, fmt.Errorf("read config: %w", err)
+	var data []byte
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("read config: %w", err)
+		}
+		if err == nil {
+			if err := toml.Unmarshal(data, cfg); err != nil {
+				return nil, fmt.Errorf("parse config: %w", err)
+			}
+		}
 	}
-	if err == nil {
-		if err := toml.Unmarshal(data, cfg); err != nil {
-			return nil, fmt.Errorf("parse config: %w", err)
+	if profile != "" {
+		if err := applyProfile(cfg, data, profile); err != nil {
+			return nil, err
 		}
 	}
+	if err := applyEnv(cfg, lookupEnv); err != nil {
+		return nil, fmt.Errorf("environment: %w", err)
+	}
 
 	// Apply platform-specific defaults
 	if cfg.DataDir == "" {
@@ -115,12 +191,116 @@ func (c *Config) Validate() error {
 	if c.Server.Listen != "" && c.Server.Domain != "" {
 		return fmt.Errorf("server: listen and domain are mutually exclusive")
 	}
+	switch c.Server.AccessTokenFormat {
+	case "", "opaque", "jwt":
+	default:
+		return fmt.Errorf("server: unknown access_token_format: %s (valid: opaque, jwt)", c.Server.AccessTokenFormat)
+	}
+	if c.Server.KeyRotationDays < 0 {
+		return fmt.Errorf("server: key_rotation_days must not be negative")
+	}
+	if c.Server.ProxyProtocol && len(c.Server.TrustedProxies) == 0 {
+		return fmt.Errorf("server: proxy_protocol requires trusted_proxies")
+	}
+	if _, err := httpd.ParseTrustedProxies(c.Server.TrustedProxies); err != nil {
+		return fmt.Errorf("server: %w", err)
+	}
+	if err := validateOIDC(&c.Server.OIDC); err != nil {
+		return fmt.Errorf("server.oidc: %w", err)
+	}
+	if err := validateHooks(c.Server.Hooks); err != nil {
+		return fmt.Errorf("server.hooks: %w", err)
+	}
 
 	// Validate embedding config
 	if err := validateEmbedding(&c.Embedding); err != nil {
 		return fmt.Errorf("embedding: %w", err)
 	}
 
+	// Validate storage config
+	if c.Storage.EncryptionKeyFile != "" && c.Storage.EncryptionPassphraseEnv != "" {
+		return fmt.Errorf("storage: encryption_key_file and encryption_passphrase_env are mutually exclusive")
+	}
+	if c.Storage.ReadOnly && c.Backup.Replication.Enabled {
+		return fmt.Errorf("storage: read_only mirrors cannot run [backup.replication]")
+	}
+	if c.DataDir == storage.Memory && (c.Storage.ReadOnly || c.Backup.Replication.Enabled) {
+		return fmt.Errorf("storage: a database in memory cannot be a read_only mirror or run [backup.replication]")
+	}
+
+	if err := c.Search.Validate(); err != nil {
+		return fmt.Errorf("search: %w", err)
+	}
+
+	// Validate backup config
+	if err := validateS3(&c.Backup.S3); err != nil {
+		return fmt.Errorf("backup.s3: %w", err)
+	}
+	if err := validateReplication(&c.Backup); err != nil {
+		return fmt.Errorf("backup.replication: %w", err)
+	}
+
+	if c.RateLimit.ToolCallsPerMinute < 0 || c.RateLimit.Burst < 0 {
+		return fmt.Errorf("rate_limit: values must not be negative")
+	}
+	if c.Ranking.IntervalMinutes < 0 || c.Ranking.Boost < 0 || c.Ranking.RecencyBoost < 0 || c.Ranking.RecencyHalfLifeDays < 0 {
+		return fmt.Errorf("ranking: values must not be negative")
+	}
+	if c.Sessions.WindowMinutes < 0 {
+		return fmt.Errorf("sessions: window_minutes must not be negative")
+	}
+	if err := c.Ingest.Validate(); err != nil {
+		return fmt.Errorf("ingest: %w", err)
+	}
+	if err := c.Unfurl.Validate(); err != nil {
+		return fmt.Errorf("unfurl: %w", err)
+	}
+	if err := c.LLM.Validate(); err != nil {
+		return fmt.Errorf("llm: %w", err)
+	}
+	if err := c.Enrich.Validate(); err != nil {
+		return fmt.Errorf("enrich: %w", err)
+	}
+	if c.Enrich.Enabled && c.LLM.Provider == "" {
+		return fmt.Errorf("enrich: enabled needs [llm] provider")
+	}
+	if c.Entities.Enabled && c.LLM.Provider == "" {
+		return fmt.Errorf("entities: enabled needs [llm] provider")
+	}
+	if err := c.Daily.Validate(); err != nil {
+		return fmt.Errorf("daily: %w", err)
+	}
+	if c.Recording.Keep < 0 {
+		return fmt.Errorf("recording: keep must not be negative")
+	}
+	if err := c.Retention.Validate(); err != nil {
+		return fmt.Errorf("retention: %w", err)
+	}
+	if err := c.Review.Validate(); err != nil {
+		return fmt.Errorf("review: %w", err)
+	}
+	if err := c.Index.Validate(); err != nil {
+		return fmt.Errorf("index: %w", err)
+	}
+	if err := c.Rerank.Validate(); err != nil {
+		return fmt.Errorf("rerank: %w", err)
+	}
+	if err := c.Transcription.Validate(); err != nil {
+		return fmt.Errorf("transcription: %w", err)
+	}
+	if c.Maintenance.IntervalHours < 0 || c.Maintenance.TombstoneDays < 0 {
+		return fmt.Errorf("maintenance: values must not be negative")
+	}
+	if c.Attachments.MaxMB < 0 {
+		return fmt.Errorf("attachments: max_mb must not be negative")
+	}
+	if c.Retention.Archives() && c.Storage.EncryptionEnabled() {
+		return fmt.Errorf("retention: archive writes plaintext files; use delete with [storage] encryption")
+	}
+	if c.Git.Enabled() && c.Storage.EncryptionEnabled() {
+		return fmt.Errorf("git: the mirror writes plaintext files, which would defeat [storage] encryption")
+	}
+
 	return nil
 }
 
@@ -129,6 +309,9 @@ func validateDataDir(dir string) error {
 	if dir == "" {
 		return fmt.Errorf("path is empty")
 	}
+	if dir == storage.Memory {
+		return nil
+	}
 
 	info, err := os.Stat(dir)
 	if os.IsNotExist(err) {
@@ -158,8 +341,104 @@ func validateDataDir(dir string) error {
 	return nil
 }
 
+// validateOIDC checks identity provider configuration.
+func validateOIDC(cfg *httpd.OIDCConfig) error {
+	if !cfg.Enabled() {
+		return nil
+	}
+	u, err := url.Parse(cfg.Issuer)
+	if err != nil || u.Scheme != "https" && u.Hostname() != "localhost" {
+		return fmt.Errorf("issuer must be an https URL")
+	}
+	if cfg.ClientID == "" {
+		return fmt.Errorf("client_id is required")
+	}
+	if len(cfg.AllowedSubjects) == 0 && len(cfg.AllowedEmails) == 0 {
+		return fmt.Errorf("allowed_subjects or allowed_emails is required")
+	}
+	return nil
+}
+
+// minHookTokenLen is the shortest accepted webhook token.
+const minHookTokenLen = 16
+
+// validateHooks checks inbound webhook configuration.
+func validateHooks(hooks []httpd.HookConfig) error {
+	names := make(map[string]bool)
+	for _, h := range hooks {
+		if h.Name == "" || strings.ContainsAny(h.Name, "/?#") {
+			return fmt.Errorf("hook name %q must be non-empty and URL path safe", h.Name)
+		}
+		if names[h.Name] {
+			return fmt.Errorf("duplicate hook %q", h.Name)
+		}
+		names[h.Name] = true
+		if len(h.Token) < minHookTokenLen {
+			return fmt.Errorf("hook %q: token must be at least %d characters", h.Name, minHookTokenLen)
+		}
+	}
+	return nil
+}
+
+// validateS3 checks remote backup configuration.
+func validateS3(cfg *backup.S3Config) error {
+	if !cfg.Enabled() {
+		return nil
+	}
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil || cfg.Endpoint == "" {
+		return fmt.Errorf("endpoint is required")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("endpoint must use http or https scheme")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return fmt.Errorf("access_key_id and secret_access_key are required")
+	}
+	if cfg.Retain < 0 {
+		return fmt.Errorf("retain must not be negative")
+	}
+	return nil
+}
+
+// validateReplication checks continuous replication settings.
+func validateReplication(cfg *backup.Config) error {
+	r := cfg.Replication
+	if r.IntervalSeconds < 0 || r.SnapshotIntervalHours < 0 || r.RetentionHours < 0 || r.MaxLagSeconds < 0 {
+		return fmt.Errorf("intervals, retention and max_lag_seconds must not be negative")
+	}
+	if r.Litestream.Config != "" && r.Litestream.ReplicaURL != "" {
+		return fmt.Errorf("litestream: config and replica_url are mutually exclusive")
+	}
+	if r.Enabled && !cfg.S3.Enabled() && !r.Litestream.Enabled() {
+		return fmt.Errorf("requires [backup.s3] or [backup.replication.litestream] to be configured")
+	}
+	return nil
+}
+
 // validateEmbedding checks embedding configuration.
 func validateEmbedding(cfg *embedding.Config) error {
+	if cfg.QueryTimeoutSeconds < 0 {
+		return fmt.Errorf("query_timeout_seconds must not be negative")
+	}
+	if cfg.QueryCacheTTLSeconds < 0 {
+		return fmt.Errorf("query_cache_ttl_seconds must not be negative")
+	}
+	if cfg.IngestTimeoutSeconds < 0 {
+		return fmt.Errorf("ingest_timeout_seconds must not be negative")
+	}
+	if cfg.MaxAttempts < 0 {
+		return fmt.Errorf("max_attempts must not be negative")
+	}
+	if cfg.RequestsPerMinute < 0 || cfg.TokensPerMinute < 0 || cfg.MaxConcurrentRequests < 0 {
+		return fmt.Errorf("requests_per_minute, tokens_per_minute and max_concurrent_requests must not be negative")
+	}
+	switch cfg.LongInputs {
+	case "", embedding.LongInputsTruncate, embedding.LongInputsAverage:
+	default:
+		return fmt.Errorf("long_inputs must be %q or %q, got %q", embedding.LongInputsTruncate, embedding.LongInputsAverage, cfg.LongInputs)
+	}
+
 	switch cfg.Provider {
 	case "":
 		// No provider configured - that's OK
@@ -173,6 +452,9 @@ func validateEmbedding(cfg *embedding.Config) error {
 		if !strings.HasPrefix(cfg.OpenAI.APIKey, "sk-") {
 			return fmt.Errorf("openai.api_key should start with 'sk-'")
 		}
+		if err := validateOpenAIDimensions(cfg.OpenAI); err != nil {
+			return err
+		}
 
 	case "ollama":
 		if cfg.Ollama.URL != "" {
@@ -185,9 +467,77 @@ func validateEmbedding(cfg *embedding.Config) error {
 			}
 		}
 
+	case "gemini":
+		if cfg.Gemini.APIKey == "" {
+			return fmt.Errorf("gemini.api_key is required")
+		}
+
+	case "cohere":
+		if cfg.Cohere.APIKey == "" {
+			return fmt.Errorf("cohere.api_key is required")
+		}
+		switch cfg.Cohere.InputType {
+		case "", "search_document", "classification", "clustering":
+		default:
+			return fmt.Errorf("cohere.input_type must be search_document, classification or clustering")
+		}
+		switch cfg.Cohere.Truncate {
+		case "", "NONE", "START", "END":
+		default:
+			return fmt.Errorf("cohere.truncate must be NONE, START or END")
+		}
+
+	case "azure":
+		if cfg.Azure.APIKey == "" {
+			return fmt.Errorf("azure.api_key is required")
+		}
+		if cfg.Azure.Deployment == "" {
+			return fmt.Errorf("azure.deployment is required")
+		}
+		u, err := url.Parse(cfg.Azure.Endpoint)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("azure.endpoint must be an https URL")
+		}
+
+	case "openai-compatible":
+		c := cfg.OpenAICompatible
+		u, err := url.Parse(c.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("openai_compatible.base_url must be an http or https URL")
+		}
+		if c.Model == "" {
+			return fmt.Errorf("openai_compatible.model is required")
+		}
+		if c.Dimensions < 0 {
+			return fmt.Errorf("openai_compatible.dimensions must not be negative")
+		}
+
 	default:
-		return fmt.Errorf("unknown provider: %s (valid: openai, ollama)", cfg.Provider)
+		return fmt.Errorf("unknown provider: %s (valid: openai, ollama, gemini, cohere, azure, openai-compatible)", cfg.Provider)
 	}
 
 	return nil
 }
+
+// validateOpenAIDimensions checks openai.dimensions against the model:
+// only text-embedding-3 models can shorten embeddings, down to one
+// dimension and up to their full size.
+func validateOpenAIDimensions(cfg embedding.OpenAIConfig) error {
+	if cfg.Dimensions == 0 {
+		return nil
+	}
+	if cfg.Dimensions < 0 {
+		return fmt.Errorf("openai.dimensions must not be negative")
+	}
+	model := cfg.Model
+	if model == "" {
+		model = "text-embedding-3-small"
+	}
+	if !strings.HasPrefix(model, "text-embedding-3-") {
+		return fmt.Errorf("openai.dimensions is only supported by text-embedding-3 models, not %s", model)
+	}
+	if full := embedding.NewOpenAIEmbeddingProvider("", model).Dimensions(); cfg.Dimensions > full {
+		return fmt.Errorf("openai.dimensions must be at most %d for %s", full, model)
+	}
+	return nil
+}
@@ -3,8 +3,19 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/neoden/mykb/backup"
+	"github.com/neoden/mykb/embedding"
+	"github.com/neoden/mykb/httpd"
+	"github.com/neoden/mykb/retention"
+	"github.com/neoden/mykb/storage"
+	"github.com/neoden/mykb/vector"
 )
 
 func TestDefault(t *testing.T) {
@@ -55,6 +66,16 @@ provider = "openai"
 [embedding.openai]
 api_key = "sk-test"
 model = "text-embedding-3-large"
+
+[rate_limit]
+tool_calls_per_minute = 120
+
+[ranking]
+interval_minutes = 15
+
+[recording]
+enabled = true
+keep = 50
 `
 	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
 		t.Fatal(err)
@@ -83,6 +104,79 @@ model = "text-embedding-3-large"
 	if cfg.Embedding.OpenAI.Model != "text-embedding-3-large" {
 		t.Errorf("Model = %q, want text-embedding-3-large", cfg.Embedding.OpenAI.Model)
 	}
+	if cfg.RateLimit.ToolCallsPerMinute != 120 {
+		t.Errorf("ToolCallsPerMinute = %d, want 120", cfg.RateLimit.ToolCallsPerMinute)
+	}
+	if cfg.Ranking.Interval() != 15*time.Minute {
+		t.Errorf("Ranking.Interval() = %s, want 15m", cfg.Ranking.Interval())
+	}
+	if !cfg.Recording.Enabled || cfg.Recording.Limit() != 50 {
+		t.Errorf("Recording = %+v, want enabled keeping 50", cfg.Recording)
+	}
+}
+
+func TestLoadEnvOverrides(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	content := `
+data_dir = "/custom/data"
+
+[server]
+domain = "example.com"
+
+[embedding]
+provider = "ollama"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MYKB_DATA_DIR", "/env/data")
+	t.Setenv("MYKB_EMBEDDING_PROVIDER", "openai")
+	t.Setenv("MYKB_OPENAI_API_KEY", "sk-env")
+	t.Setenv("MYKB_SERVER_BEHIND_PROXY", "true")
+	t.Setenv("MYKB_RATE_LIMIT_BURST", "7")
+	t.Setenv("MYKB_EMBEDDING_METADATA_FIELDS", "title, tags")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.DataDir != "/env/data" {
+		t.Errorf("DataDir = %q, want /env/data", cfg.DataDir)
+	}
+	if cfg.Server.Domain != "example.com" {
+		t.Errorf("Domain = %q, want example.com from the file", cfg.Server.Domain)
+	}
+	if cfg.Embedding.Provider != "openai" || cfg.Embedding.OpenAI.APIKey != "sk-env" {
+		t.Errorf("Embedding = %+v, want openai with sk-env", cfg.Embedding)
+	}
+	if !cfg.Server.BehindProxy || cfg.RateLimit.Burst != 7 {
+		t.Errorf("BehindProxy = %v, Burst = %d", cfg.Server.BehindProxy, cfg.RateLimit.Burst)
+	}
+	if got := cfg.Embedding.MetadataFields; len(got) != 2 || got[0] != "title" || got[1] != "tags" {
+		t.Errorf("MetadataFields = %q", got)
+	}
+
+	// The full name wins over the alias
+	t.Setenv("MYKB_EMBEDDING_OPENAI_API_KEY", "sk-full")
+	if cfg, _ = Load(path); cfg.Embedding.OpenAI.APIKey != "sk-full" {
+		t.Errorf("APIKey = %q, want sk-full", cfg.Embedding.OpenAI.APIKey)
+	}
+
+	// Without a file, the environment still applies
+	if cfg, _ = Load(""); cfg.DataDir != "/env/data" {
+		t.Errorf("DataDir without file = %q", cfg.DataDir)
+	}
+
+	t.Setenv("MYKB_RATE_LIMIT_BURST", "lots")
+	if _, err := Load(path); err == nil {
+		t.Error("expected error for an invalid integer")
+	}
+	t.Setenv("MYKB_RATE_LIMIT_BURST", "")
+	t.Setenv("MYKB_RETENTION_RULES", "x")
+	if _, err := Load(path); err == nil {
+		t.Error("expected error for an array of tables")
+	}
 }
 
 func TestLoadInvalidTOML(t *testing.T) {
@@ -191,6 +285,22 @@ func TestValidateDataDir(t *testing.T) {
 	}
 }
 
+func TestValidateDataDirMemory(t *testing.T) {
+	cfg := Default()
+	cfg.DataDir = storage.Memory
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("In-memory data_dir should pass: %v", err)
+	}
+	if _, err := os.Stat(storage.Memory); !os.IsNotExist(err) {
+		t.Errorf("Validate should not create a %s directory", storage.Memory)
+	}
+
+	cfg.Storage.ReadOnly = true
+	if err := cfg.Validate(); err == nil {
+		t.Error("A read-only mirror in memory should fail")
+	}
+}
+
 func TestValidateDataDirCreatesDir(t *testing.T) {
 	dir := t.TempDir()
 	newDir := filepath.Join(dir, "new", "nested")
@@ -242,6 +352,123 @@ func TestValidateServerMutuallyExclusive(t *testing.T) {
 	}
 }
 
+func TestValidateAccessTokenFormat(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		format  string
+		wantErr bool
+	}{
+		{"", false},
+		{"opaque", false},
+		{"jwt", false},
+		{"paseto", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			cfg := Default()
+			cfg.DataDir = dir
+			cfg.Server.AccessTokenFormat = tt.format
+
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateTrustedProxies(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		enabled bool
+		trusted []string
+		wantErr bool
+	}{
+		{"disabled", false, nil, false},
+		{"no trusted proxies", true, nil, true},
+		{"prefix and IP", true, []string{"10.0.0.0/8", "2001:db8::1"}, false},
+		{"invalid", true, []string{"10.0.0.0/33"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.DataDir = dir
+			cfg.Server.ProxyProtocol = tt.enabled
+			cfg.Server.TrustedProxies = tt.trusted
+
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateOIDC(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		oidc    httpd.OIDCConfig
+		wantErr bool
+	}{
+		{"disabled", httpd.OIDCConfig{}, false},
+		{"valid", httpd.OIDCConfig{Issuer: "https://accounts.google.com", ClientID: "id", AllowedEmails: []string{"me@example.com"}}, false},
+		{"http issuer", httpd.OIDCConfig{Issuer: "http://idp.example.com", ClientID: "id", AllowedSubjects: []string{"x"}}, true},
+		{"missing client_id", httpd.OIDCConfig{Issuer: "https://idp.example.com", AllowedSubjects: []string{"x"}}, true},
+		{"no allowed identities", httpd.OIDCConfig{Issuer: "https://idp.example.com", ClientID: "id"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.DataDir = dir
+			cfg.Server.OIDC = tt.oidc
+
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateHooks(t *testing.T) {
+	dir := t.TempDir()
+	token := "0123456789abcdef"
+
+	tests := []struct {
+		name    string
+		hooks   []httpd.HookConfig
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"valid", []httpd.HookConfig{{Name: "links", Token: token}}, false},
+		{"short token", []httpd.HookConfig{{Name: "links", Token: "short"}}, true},
+		{"no name", []httpd.HookConfig{{Token: token}}, true},
+		{"slash in name", []httpd.HookConfig{{Name: "a/b", Token: token}}, true},
+		{"duplicate", []httpd.HookConfig{{Name: "links", Token: token}, {Name: "links", Token: token}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.DataDir = dir
+			cfg.Server.Hooks = tt.hooks
+
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestValidateEmbeddingOpenAI(t *testing.T) {
 	dir := t.TempDir()
 
@@ -300,6 +527,122 @@ func TestValidateEmbeddingOllama(t *testing.T) {
 	}
 }
 
+func TestValidateEmbeddingGemini(t *testing.T) {
+	cfg := Default()
+	cfg.DataDir = t.TempDir()
+	cfg.Embedding.Provider = "gemini"
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error without gemini.api_key")
+	}
+	cfg.Embedding.Gemini.APIKey = "AIza-test"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
+
+func TestValidateEmbeddingCohere(t *testing.T) {
+	tests := []struct {
+		name    string
+		cohere  embedding.CohereConfig
+		wantErr bool
+	}{
+		{"valid", embedding.CohereConfig{APIKey: "key"}, false},
+		{"options", embedding.CohereConfig{APIKey: "key", InputType: "clustering", Truncate: "START"}, false},
+		{"no key", embedding.CohereConfig{}, true},
+		{"query input type", embedding.CohereConfig{APIKey: "key", InputType: "search_query"}, true},
+		{"bad truncate", embedding.CohereConfig{APIKey: "key", Truncate: "middle"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.DataDir = t.TempDir()
+			cfg.Embedding.Provider = "cohere"
+			cfg.Embedding.Cohere = tt.cohere
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateOpenAIDimensions(t *testing.T) {
+	tests := []struct {
+		name       string
+		model      string
+		dimensions int
+		wantErr    bool
+	}{
+		{"unset", "text-embedding-ada-002", 0, false},
+		{"shortened", "text-embedding-3-small", 512, false},
+		{"full large", "text-embedding-3-large", 3072, false},
+		{"too many", "text-embedding-3-small", 2048, true},
+		{"negative", "text-embedding-3-small", -1, true},
+		{"ada", "text-embedding-ada-002", 512, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.DataDir = t.TempDir()
+			cfg.Embedding.Provider = "openai"
+			cfg.Embedding.OpenAI = embedding.OpenAIConfig{APIKey: "sk-test", Model: tt.model, Dimensions: tt.dimensions}
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateEmbeddingAzure(t *testing.T) {
+	valid := embedding.AzureConfig{Endpoint: "https://r.openai.azure.com", Deployment: "emb", APIKey: "key"}
+	tests := []struct {
+		name    string
+		edit    func(*embedding.AzureConfig)
+		wantErr bool
+	}{
+		{"valid", func(*embedding.AzureConfig) {}, false},
+		{"no key", func(c *embedding.AzureConfig) { c.APIKey = "" }, true},
+		{"no deployment", func(c *embedding.AzureConfig) { c.Deployment = "" }, true},
+		{"http endpoint", func(c *embedding.AzureConfig) { c.Endpoint = "http://r.openai.azure.com" }, true},
+		{"no endpoint", func(c *embedding.AzureConfig) { c.Endpoint = "" }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.DataDir = t.TempDir()
+			cfg.Embedding.Provider = "azure"
+			cfg.Embedding.Azure = valid
+			tt.edit(&cfg.Embedding.Azure)
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateEmbeddingOpenAICompatible(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  embedding.OpenAICompatibleConfig
+		wantErr bool
+	}{
+		{"valid", embedding.OpenAICompatibleConfig{BaseURL: "http://localhost:1234/v1", Model: "m"}, false},
+		{"no model", embedding.OpenAICompatibleConfig{BaseURL: "http://localhost:1234/v1"}, true},
+		{"no base_url", embedding.OpenAICompatibleConfig{Model: "m"}, true},
+		{"bad scheme", embedding.OpenAICompatibleConfig{BaseURL: "ftp://host/v1", Model: "m"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.DataDir = t.TempDir()
+			cfg.Embedding.Provider = "openai-compatible"
+			cfg.Embedding.OpenAICompatible = tt.config
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestValidateEmbeddingUnknownProvider(t *testing.T) {
 	dir := t.TempDir()
 
@@ -337,3 +680,377 @@ func containsAt(s, substr string, start int) bool {
 	}
 	return false
 }
+
+func TestValidateStorageEncryption(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		storage storage.Config
+		wantErr bool
+	}{
+		{"disabled", storage.Config{}, false},
+		{"key file", storage.Config{EncryptionKeyFile: "/etc/mykb.key"}, false},
+		{"passphrase", storage.Config{EncryptionPassphraseEnv: "MYKB_PASSPHRASE"}, false},
+		{"both", storage.Config{EncryptionKeyFile: "/etc/mykb.key", EncryptionPassphraseEnv: "MYKB_PASSPHRASE"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.DataDir = dir
+			cfg.Storage = tt.storage
+
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateRetention(t *testing.T) {
+	dir := t.TempDir()
+	archive := retention.Config{Rules: []retention.Rule{
+		{Name: "untagged", Untagged: true, OlderThanDays: 365, Action: retention.ActionArchive},
+	}}
+
+	tests := []struct {
+		name      string
+		retention retention.Config
+		storage   storage.Config
+		wantErr   bool
+	}{
+		{"none", retention.Config{}, storage.Config{}, false},
+		{"archive", archive, storage.Config{}, false},
+		{"invalid rule", retention.Config{Rules: []retention.Rule{{Name: "x", Action: retention.ActionDelete}}}, storage.Config{}, true},
+		{"archive with encryption", archive, storage.Config{EncryptionKeyFile: "/etc/mykb.key"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.DataDir = dir
+			cfg.Retention = tt.retention
+			cfg.Storage = tt.storage
+
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateEmbeddingTimeouts(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		query   int
+		ingest  int
+		wantErr string
+	}{
+		{"defaults", 0, 0, ""},
+		{"custom", 3, 120, ""},
+		{"negative query", -1, 0, "query_timeout_seconds"},
+		{"negative ingest", 0, -1, "ingest_timeout_seconds"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.DataDir = dir
+			cfg.Embedding.QueryTimeoutSeconds = tt.query
+			cfg.Embedding.IngestTimeoutSeconds = tt.ingest
+
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+			} else if err == nil || !contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateBackupS3(t *testing.T) {
+	dir := t.TempDir()
+	valid := backup.S3Config{
+		Endpoint:        "https://s3.us-east-1.amazonaws.com",
+		Bucket:          "kb-backups",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*backup.S3Config)
+		wantErr bool
+	}{
+		{"valid", func(c *backup.S3Config) {}, false},
+		{"disabled", func(c *backup.S3Config) { *c = backup.S3Config{} }, false},
+		{"missing endpoint", func(c *backup.S3Config) { c.Endpoint = "" }, true},
+		{"bad scheme", func(c *backup.S3Config) { c.Endpoint = "ftp://s3.example.com" }, true},
+		{"missing secret", func(c *backup.S3Config) { c.SecretAccessKey = "" }, true},
+		{"negative retain", func(c *backup.S3Config) { c.Retain = -1 }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.DataDir = dir
+			cfg.Backup.S3 = valid
+			tt.modify(&cfg.Backup.S3)
+
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateReplication(t *testing.T) {
+	cfg := Default()
+	cfg.DataDir = t.TempDir()
+	cfg.Backup.Replication.Enabled = true
+	if err := cfg.Validate(); err == nil || !contains(err.Error(), "backup.s3") {
+		t.Errorf("Validate() without bucket = %v, want backup.s3 error", err)
+	}
+
+	cfg.Backup.S3 = backup.S3Config{
+		Endpoint:        "https://s3.us-east-1.amazonaws.com",
+		Bucket:          "kb-backups",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	cfg.Backup.Replication.RetentionHours = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for negative retention")
+	}
+
+	cfg.Backup.Replication.RetentionHours = 0
+	cfg.Backup.S3 = backup.S3Config{}
+	cfg.Backup.Replication.Litestream = backup.LitestreamConfig{ReplicaURL: "s3://bucket/kb"}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() with litestream and no bucket = %v", err)
+	}
+	cfg.Backup.Replication.Litestream.Config = "/etc/litestream.yml"
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for litestream config with replica_url")
+	}
+	cfg.Backup.Replication.Litestream.Config = ""
+
+	cfg.Storage.ReadOnly = true
+	if err := cfg.Validate(); err == nil || !contains(err.Error(), "read_only") {
+		t.Errorf("Validate() replicating a read-only mirror = %v, want read_only error", err)
+	}
+}
+
+func TestValidateGitWithEncryption(t *testing.T) {
+	cfg := Default()
+	cfg.DataDir = t.TempDir()
+	cfg.Git.Dir = t.TempDir()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+	cfg.Storage.EncryptionKeyFile = "/etc/mykb.key"
+	if err := cfg.Validate(); err == nil || !contains(err.Error(), "git") {
+		t.Errorf("Validate() git mirror with encryption = %v, want git error", err)
+	}
+}
+
+func TestValidateIndex(t *testing.T) {
+	tests := []struct {
+		name    string
+		index   vector.Config
+		wantErr bool
+	}{
+		{"none", vector.Config{}, false},
+		{"int8", vector.Config{Quantization: "int8"}, false},
+		{"binary", vector.Config{Quantization: "binary", Oversample: 20}, false},
+		{"unknown", vector.Config{Quantization: "pq"}, true},
+		{"negative oversample", vector.Config{Oversample: -1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.DataDir = t.TempDir()
+			cfg.Index = tt.index
+
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.Embedding.OpenAI.APIKey = "sk-secret"
+	cfg.Backup.S3.SecretAccessKey = "s3-secret"
+	cfg.Rerank.Cohere.APIKey = "rerank-secret"
+	cfg.Review.Digest.Email.Password = "smtp-secret"
+	cfg.Transcription.OpenAI.APIKey = "whisper-secret"
+	cfg.LLM.OpenAI.APIKey = "llm-secret"
+	cfg.Server.Hooks = []httpd.HookConfig{{Name: "links", Token: "hook-secret-token"}}
+
+	data, err := cfg.MarshalRedacted()
+	if err != nil {
+		t.Fatalf("MarshalRedacted: %v", err)
+	}
+	for _, secret := range []string{"sk-secret", "s3-secret", "hook-secret-token", "rerank-secret", "smtp-secret", "whisper-secret", "llm-secret"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("output contains %q:\n%s", secret, data)
+		}
+	}
+	if !strings.Contains(string(data), "<redacted>") || !strings.Contains(string(data), "links") {
+		t.Errorf("output:\n%s", data)
+	}
+	// Empty secrets stay empty, so unset keys are not mistaken for set ones
+	if cfg.Redacted().Server.OIDC.ClientSecret != "" {
+		t.Error("empty client_secret was redacted")
+	}
+
+	if cfg.Embedding.OpenAI.APIKey != "sk-secret" || cfg.Server.Hooks[0].Token != "hook-secret-token" {
+		t.Error("Redacted modified the original config")
+	}
+}
+
+// secretKey matches toml keys that hold secrets, independently of isSecret.
+var secretKey = regexp.MustCompile(`api_key|password|secret|^token$`)
+
+// fillSecrets sets every secret-shaped string under v to a distinct value,
+// adding an element to empty slices of structs so their fields are reached,
+// and returns the values set by path.
+func fillSecrets(v reflect.Value, path string, set map[string]string) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			key, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+			field := v.Field(i)
+			if field.Kind() == reflect.String && secretKey.MatchString(key) {
+				value := "leaked-" + path + "." + key
+				field.SetString(value)
+				set[path+"."+key] = value
+				continue
+			}
+			fillSecrets(field, path+"."+key, set)
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Struct && v.Len() == 0 {
+			v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		}
+		for i := 0; i < v.Len(); i++ {
+			fillSecrets(v.Index(i), path, set)
+		}
+	}
+}
+
+func TestRedactedCoversEverySecret(t *testing.T) {
+	cfg := Default()
+	set := make(map[string]string)
+	fillSecrets(reflect.ValueOf(cfg).Elem(), "", set)
+	if len(set) < 10 {
+		t.Fatalf("found only %d secret settings: %v", len(set), set)
+	}
+
+	data, err := cfg.MarshalRedacted()
+	if err != nil {
+		t.Fatalf("MarshalRedacted: %v", err)
+	}
+	for path, value := range set {
+		if strings.Contains(string(data), value) {
+			t.Errorf("%s is not redacted", path)
+		}
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	content := `
+data_dir = "/var/lib/mykb"
+
+[server]
+listen = ":8080"
+
+[embedding]
+provider = "ollama"
+
+[embedding.ollama]
+model = "all-minilm"
+
+[profiles.work]
+data_dir = "/srv/work"
+
+[profiles.work.embedding]
+provider = "openai"
+
+[profiles.work.embedding.openai]
+api_key = "sk-work"
+
+[profiles.personal.server]
+listen = ":8081"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadProfile(path, "work")
+	if err != nil {
+		t.Fatalf("LoadProfile work: %v", err)
+	}
+	if cfg.Profile != "work" || cfg.DataDir != "/srv/work" {
+		t.Errorf("Profile = %q, DataDir = %q", cfg.Profile, cfg.DataDir)
+	}
+	if cfg.Embedding.Provider != "openai" || cfg.Embedding.OpenAI.APIKey != "sk-work" {
+		t.Errorf("Embedding = %+v, want the profile's openai", cfg.Embedding)
+	}
+	// Keys the profile leaves out keep their top-level values
+	if cfg.Server.Listen != ":8080" || cfg.Embedding.Ollama.Model != "all-minilm" {
+		t.Errorf("Listen = %q, Ollama model = %q", cfg.Server.Listen, cfg.Embedding.Ollama.Model)
+	}
+
+	// Without data_dir, a profile gets its own directory
+	t.Setenv("MYKB_PROFILE", "personal")
+	cfg, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load personal: %v", err)
+	}
+	if want := filepath.Join("/var/lib/mykb", "profiles", "personal"); cfg.DataDir != want {
+		t.Errorf("DataDir = %q, want %q", cfg.DataDir, want)
+	}
+	if cfg.Server.Listen != ":8081" || cfg.Embedding.Provider != "ollama" {
+		t.Errorf("Listen = %q, Provider = %q", cfg.Server.Listen, cfg.Embedding.Provider)
+	}
+
+	// The flag wins over the environment
+	if cfg, _ = LoadProfile(path, "work"); cfg.Profile != "work" {
+		t.Errorf("Profile = %q, want work", cfg.Profile)
+	}
+
+	for _, name := range []string{"missing", "../escape"} {
+		if _, err := LoadProfile(path, name); err == nil {
+			t.Errorf("LoadProfile(%q): expected error", name)
+		}
+	}
+
+	t.Setenv("MYKB_PROFILE", "")
+	if cfg, _ = Load(path); cfg.Profile != "" || cfg.DataDir != "/var/lib/mykb" {
+		t.Errorf("no profile: Profile = %q, DataDir = %q", cfg.Profile, cfg.DataDir)
+	}
+}
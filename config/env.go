@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// envPrefix starts the environment variable of every config key: the key's
+// TOML path, upper-cased and joined with underscores, so embedding.provider
+// is MYKB_EMBEDDING_PROVIDER.
+const envPrefix = "MYKB"
+
+// envAliases are shorter names accepted for common keys; the full name
+// takes precedence when both are set.
+var envAliases = map[string]string{
+	"MYKB_EMBEDDING_OPENAI_API_KEY": "MYKB_OPENAI_API_KEY",
+	"MYKB_EMBEDDING_GEMINI_API_KEY": "MYKB_GEMINI_API_KEY",
+	"MYKB_EMBEDDING_COHERE_API_KEY": "MYKB_COHERE_API_KEY",
+	"MYKB_EMBEDDING_AZURE_API_KEY":  "MYKB_AZURE_OPENAI_API_KEY",
+	"MYKB_EMBEDDING_OLLAMA_URL":     "MYKB_OLLAMA_URL",
+}
+
+// applyEnv overrides cfg with the MYKB_* environment variables that are
+// set. Lists are comma-separated; arrays of tables ([[server.hooks]],
+// [[retention.rules]]) can only be set in the file.
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	return applyEnvStruct(reflect.ValueOf(cfg).Elem(), envPrefix, lookup)
+}
+
+func applyEnvStruct(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	t := v.Type()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+		if !f.IsExported() || tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(tag)
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := applyEnvStruct(field, name, lookup); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := lookup(name)
+		if !ok {
+			value, ok = lookup(envAliases[name])
+		}
+		if !ok {
+			continue
+		}
+		if err := setEnvValue(field, value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// setEnvValue parses value into a config field.
+func setEnvValue(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		x, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		field.SetFloat(x)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("cannot be set from the environment")
+		}
+		var items []string
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				items = append(items, s)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("cannot be set from the environment")
+	}
+	return nil
+}
+
+// lookupEnv reads the process environment; empty values count as unset.
+func lookupEnv(name string) (string, bool) {
+	if name == "" {
+		return "", false
+	}
+	v := os.Getenv(name)
+	return v, v != ""
+}
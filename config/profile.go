@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"github.com/neoden/mykb/storage"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// validProfile restricts profile names to what is safe as a directory name.
+var validProfile = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// applyProfile overlays the [profiles.<name>] table of a config file on
+// cfg. The table takes the same keys as the file itself; those it leaves
+// out keep their top-level values, except data_dir, which defaults to
+// <data_dir>/profiles/<name> so profiles never share a database.
+func applyProfile(cfg *Config, data []byte, name string) error {
+	if !validProfile.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q", name)
+	}
+	var file struct {
+		Profiles map[string]map[string]any `toml:"profiles"`
+	}
+	if err := toml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("parse config: %w", err)
+	}
+	table, ok := file.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(file.Profiles))
+		for n := range file.Profiles {
+			names = append(names, n)
+		}
+		slices.Sort(names)
+		return fmt.Errorf("unknown profile %q (configured: %v)", name, names)
+	}
+
+	// Re-encoded, the table decodes onto cfg, setting only the keys it has
+	overlay, err := toml.Marshal(table)
+	if err != nil {
+		return fmt.Errorf("profile %s: %w", name, err)
+	}
+	if err := toml.Unmarshal(overlay, cfg); err != nil {
+		return fmt.Errorf("profile %s: %w", name, err)
+	}
+	if _, ok := table["data_dir"]; !ok && cfg.DataDir != storage.Memory {
+		base := cfg.DataDir
+		if base == "" {
+			base = defaultDataDir()
+		}
+		cfg.DataDir = filepath.Join(base, "profiles", name)
+	}
+	cfg.Profile = name
+	return nil
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// redactedValue replaces secrets in Redacted output.
+const redactedValue = "<redacted>"
+
+// Redacted returns a copy of the config with API keys, passwords, client
+// secrets and hook tokens replaced, safe to print or attach to a bug report.
+// Secrets are found by their toml key (see isSecret), so a setting added
+// under one of those names is redacted without being listed here.
+func (c *Config) Redacted() *Config {
+	r := redactedCopy(reflect.ValueOf(*c), false)
+	out := r.Interface().(Config)
+	return &out
+}
+
+// isSecret reports whether a setting named key holds a secret.
+func isSecret(key string) bool {
+	return key == "api_key" || key == "password" || key == "token" || strings.Contains(key, "secret")
+}
+
+// redactedCopy returns a deep copy of v, so the original config is never
+// modified, with non-empty secret strings replaced. Empty secrets stay
+// empty, so unset keys are not mistaken for set ones.
+func redactedCopy(v reflect.Value, secret bool) reflect.Value {
+	out := reflect.New(v.Type()).Elem()
+	switch v.Kind() {
+	case reflect.String:
+		out.Set(v)
+		if secret && v.String() != "" {
+			out.SetString(redactedValue)
+		}
+	case reflect.Struct:
+		out.Set(v) // carries unexported fields
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			key, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+			out.Field(i).Set(redactedCopy(v.Field(i), isSecret(key)))
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			break
+		}
+		out.Set(reflect.MakeSlice(v.Type(), v.Len(), v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(redactedCopy(v.Index(i), secret))
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(redactedCopy(v.Index(i), secret))
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			break
+		}
+		out.Set(reflect.MakeMapWithSize(v.Type(), v.Len()))
+		for it := v.MapRange(); it.Next(); {
+			out.SetMapIndex(it.Key(), redactedCopy(it.Value(), secret))
+		}
+	case reflect.Pointer:
+		if v.IsNil() {
+			break
+		}
+		p := reflect.New(v.Type().Elem())
+		p.Elem().Set(redactedCopy(v.Elem(), secret))
+		out.Set(p)
+	default:
+		out.Set(v)
+	}
+	return out
+}
+
+// MarshalRedacted encodes the redacted config as TOML, in the form Load
+// reads.
+func (c *Config) MarshalRedacted() ([]byte, error) {
+	return toml.Marshal(c.Redacted())
+}
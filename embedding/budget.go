@@ -0,0 +1,156 @@
+package embedding
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// openAIInputTokens is the most tokens OpenAI's embedding models accept per
+// input; longer inputs fail the whole request.
+const openAIInputTokens = 8191
+
+// budgetBytesPerToken converts a token budget to bytes. Text rarely runs
+// below three bytes a token (CJK is about that), so cutting at three keeps
+// inputs under the limit without a tokenizer.
+const budgetBytesPerToken = 3
+
+// Ways of embedding an input over the token budget.
+const (
+	LongInputsTruncate = "truncate"
+	LongInputsAverage  = "average"
+)
+
+// defaultInputTokens is the input limit of providers that reject longer
+// inputs; the others (Ollama, Cohere, Gemini) truncate on their side.
+func defaultInputTokens(provider string) int {
+	switch provider {
+	case "openai", "azure":
+		return openAIInputTokens
+	default:
+		return 0
+	}
+}
+
+// inputBudget keeps inputs within a provider's context by truncating them,
+// or by embedding their pieces and averaging the vectors. The zero value
+// sends inputs as they are.
+type inputBudget struct {
+	maxBytes int
+	average  bool
+}
+
+// newInputBudget follows the max_input_tokens and long_inputs settings.
+func newInputBudget(cfg Config) inputBudget {
+	tokens := cfg.MaxInputTokens
+	if tokens == 0 {
+		tokens = defaultInputTokens(cfg.Provider)
+	}
+	if tokens <= 0 {
+		return inputBudget{}
+	}
+	return inputBudget{
+		maxBytes: tokens * budgetBytesPerToken,
+		average:  cfg.LongInputs == LongInputsAverage,
+	}
+}
+
+// embed calls embed with texts fitted to the budget, returning a vector
+// for each of the original texts.
+func (b inputBudget) embed(texts []string, embed func([]string) ([][]float32, error)) ([][]float32, error) {
+	over := false
+	for _, t := range texts {
+		if b.maxBytes > 0 && len(t) > b.maxBytes {
+			over = true
+			break
+		}
+	}
+	if !over {
+		return embed(texts)
+	}
+
+	if !b.average {
+		cut := make([]string, len(texts))
+		for i, t := range texts {
+			cut[i], _ = splitText(t, b.maxBytes)
+		}
+		return embed(cut)
+	}
+
+	// Embed every piece in one call, remembering which text each came from
+	var pieces []string
+	owners := make([]int, 0, len(texts))
+	for i, t := range texts {
+		for {
+			var piece string
+			piece, t = splitText(t, b.maxBytes)
+			pieces = append(pieces, piece)
+			owners = append(owners, i)
+			if t == "" {
+				break
+			}
+		}
+	}
+	vecs, err := embed(pieces)
+	if err != nil {
+		return nil, err
+	}
+	if len(vecs) != len(pieces) {
+		return nil, fmt.Errorf("provider returned %d embeddings for %d pieces", len(vecs), len(pieces))
+	}
+	return averagePieces(vecs, pieces, owners, len(texts)), nil
+}
+
+// averagePieces combines the vectors of each text's pieces, weighted by
+// piece length, and normalizes the result as providers do.
+func averagePieces(vecs [][]float32, pieces []string, owners []int, n int) [][]float32 {
+	sums := make([][]float64, n)
+	for j, vec := range vecs {
+		i := owners[j]
+		if sums[i] == nil {
+			sums[i] = make([]float64, len(vec))
+		}
+		w := float64(len(pieces[j]))
+		for k, x := range vec {
+			sums[i][k] += w * float64(x)
+		}
+	}
+	out := make([][]float32, n)
+	for i, sum := range sums {
+		var norm float64
+		for _, x := range sum {
+			norm += x * x
+		}
+		norm = math.Sqrt(norm)
+		out[i] = make([]float32, len(sum))
+		for k, x := range sum {
+			if norm > 0 {
+				x /= norm
+			}
+			out[i][k] = float32(x)
+		}
+	}
+	return out
+}
+
+// splitText returns the first piece of text within maxBytes and the rest,
+// cutting at whitespace near the limit when there is some and never inside
+// a UTF-8 sequence.
+func splitText(text string, maxBytes int) (piece, rest string) {
+	if len(text) <= maxBytes {
+		return text, ""
+	}
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	if space := strings.LastIndexAny(text[:cut], " \t\n"); space > cut*3/4 {
+		cut = space + 1
+	}
+	if cut == 0 {
+		// maxBytes is smaller than one rune
+		_, cut = utf8.DecodeRuneInString(text)
+	}
+	return text[:cut], text[cut:]
+}
@@ -0,0 +1,100 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// budgetServer is an Ollama server recording the inputs it embeds. Each
+// vector is [1, 0] for inputs starting with "a" and [0, 1] otherwise.
+func budgetServer(t *testing.T, inputs *[]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		*inputs = append(*inputs, req.Input...)
+		var resp ollamaResponse
+		for _, in := range req.Input {
+			if strings.HasPrefix(in, "a") {
+				resp.Embeddings = append(resp.Embeddings, []float32{1, 0})
+			} else {
+				resp.Embeddings = append(resp.Embeddings, []float32{0, 1})
+			}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestBudgetTruncates(t *testing.T) {
+	var inputs []string
+	p := NewOllamaEmbeddingProvider(budgetServer(t, &inputs).URL, "nomic-embed-text")
+	p.budget = newInputBudget(Config{Provider: "ollama", MaxInputTokens: 4})
+
+	vecs, err := p.Embed(context.Background(), []string{"short", strings.Repeat("a", 40)})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(vecs) != 2 || len(inputs) != 2 {
+		t.Fatalf("vecs = %v, inputs = %q", vecs, inputs)
+	}
+	if inputs[0] != "short" || len(inputs[1]) != 4*budgetBytesPerToken {
+		t.Errorf("inputs = %q", inputs)
+	}
+}
+
+func TestBudgetAverages(t *testing.T) {
+	var inputs []string
+	p := NewOllamaEmbeddingProvider(budgetServer(t, &inputs).URL, "nomic-embed-text")
+	p.budget = newInputBudget(Config{Provider: "ollama", MaxInputTokens: 2, LongInputs: LongInputsAverage})
+
+	// Two pieces of six bytes: one embedded [1, 0], the other [0, 1]
+	vecs, err := p.Embed(context.Background(), []string{"aaaaa bbbbbb", "bb"})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(inputs) != 3 || len(vecs) != 2 {
+		t.Fatalf("inputs = %q, vecs = %v", inputs, vecs)
+	}
+	want := float32(1 / math.Sqrt2)
+	if math.Abs(float64(vecs[0][0]-want)) > 1e-6 || math.Abs(float64(vecs[0][1]-want)) > 1e-6 {
+		t.Errorf("averaged vector = %v, want [%v %v]", vecs[0], want, want)
+	}
+	if vecs[1][0] != 0 || vecs[1][1] != 1 {
+		t.Errorf("short text vector = %v", vecs[1])
+	}
+}
+
+func TestBudgetDefaults(t *testing.T) {
+	if b := newInputBudget(Config{Provider: "openai"}); b.maxBytes != openAIInputTokens*budgetBytesPerToken {
+		t.Errorf("openai budget = %d bytes", b.maxBytes)
+	}
+	if b := newInputBudget(Config{Provider: "ollama"}); b.maxBytes != 0 {
+		t.Errorf("ollama budget = %d bytes, want none", b.maxBytes)
+	}
+	if b := newInputBudget(Config{Provider: "openai", MaxInputTokens: -1}); b.maxBytes != 0 {
+		t.Errorf("disabled budget = %d bytes", b.maxBytes)
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	piece, rest := splitText("hello world again", 14)
+	if piece != "hello world " || rest != "again" {
+		t.Errorf("splitText = %q, %q", piece, rest)
+	}
+
+	// Never inside a UTF-8 sequence
+	text := strings.Repeat("日本", 5)
+	for rest := text; rest != ""; {
+		piece, rest = splitText(rest, 4)
+		if !utf8.ValidString(piece) || piece == "" {
+			t.Fatalf("piece %q", piece)
+		}
+	}
+}
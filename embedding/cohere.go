@@ -0,0 +1,163 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const cohereURL = "https://api.cohere.com/v2/embed"
+
+// cohereBatchLimit is the most texts the embed endpoint accepts per request.
+const cohereBatchLimit = 96
+
+// Cohere input types for retrieval: documents and queries are embedded
+// differently, so that a query lands near the documents that answer it.
+const (
+	cohereSearchDocument = "search_document"
+	cohereSearchQuery    = "search_query"
+)
+
+// CohereEmbeddingProvider implements EmbeddingProvider using the Cohere API.
+type CohereEmbeddingProvider struct {
+	apiKey    string
+	model     string
+	inputType string
+	truncate  string
+	client    *http.Client
+	retry     retryPolicy
+	budget    inputBudget
+}
+
+// NewCohereEmbeddingProvider creates a new Cohere embedding provider.
+// inputType applies to documents ("search_document" if empty; queries then
+// use "search_query"); truncate is "NONE", "START" or "END" (the API's
+// default if empty).
+func NewCohereEmbeddingProvider(apiKey, model, inputType, truncate string) *CohereEmbeddingProvider {
+	if inputType == "" {
+		inputType = cohereSearchDocument
+	}
+	return &CohereEmbeddingProvider{
+		apiKey:    apiKey,
+		model:     model,
+		inputType: inputType,
+		truncate:  truncate,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+type cohereRequest struct {
+	Model          string   `json:"model"`
+	Texts          []string `json:"texts"`
+	InputType      string   `json:"input_type"`
+	EmbeddingTypes []string `json:"embedding_types"`
+	Truncate       string   `json:"truncate,omitempty"`
+}
+
+type cohereResponse struct {
+	Embeddings struct {
+		Float [][]float32 `json:"float"`
+	} `json:"embeddings"`
+	Message string `json:"message,omitempty"`
+}
+
+// Embed embeds texts with the configured input type.
+func (p *CohereEmbeddingProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return p.embed(ctx, texts, p.inputType)
+}
+
+// EmbedQueries embeds texts as search queries. With an input type other
+// than search_document, queries are embedded like documents.
+func (p *CohereEmbeddingProvider) EmbedQueries(ctx context.Context, texts []string) ([][]float32, error) {
+	if p.inputType != cohereSearchDocument {
+		return p.embed(ctx, texts, p.inputType)
+	}
+	return p.embed(ctx, texts, cohereSearchQuery)
+}
+
+func (p *CohereEmbeddingProvider) embed(ctx context.Context, texts []string, inputType string) ([][]float32, error) {
+	return p.budget.embed(texts, func(texts []string) ([][]float32, error) {
+		return p.embedBatches(ctx, texts, inputType)
+	})
+}
+
+func (p *CohereEmbeddingProvider) embedBatches(ctx context.Context, texts []string, inputType string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	embeddings := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += cohereBatchLimit {
+		batch := texts[start:min(start+cohereBatchLimit, len(texts))]
+		vecs, err := p.embedBatch(ctx, batch, inputType)
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, vecs...)
+	}
+	return embeddings, nil
+}
+
+func (p *CohereEmbeddingProvider) embedBatch(ctx context.Context, texts []string, inputType string) ([][]float32, error) {
+	reqBody, err := json.Marshal(cohereRequest{
+		Model:          p.model,
+		Texts:          texts,
+		InputType:      inputType,
+		EmbeddingTypes: []string{"float"},
+		Truncate:       p.truncate,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", cohereURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	resp, err := p.retry.do(p.client, req)
+	if err != nil {
+		return nil, fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("cohere api error: status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result cohereResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	if len(result.Embeddings.Float) != len(texts) {
+		if result.Message != "" {
+			return nil, fmt.Errorf("cohere error: %s", result.Message)
+		}
+		return nil, fmt.Errorf("cohere returned %d embeddings for %d texts", len(result.Embeddings.Float), len(texts))
+	}
+	return result.Embeddings.Float, nil
+}
+
+func (p *CohereEmbeddingProvider) Dimensions() int {
+	switch p.model {
+	case "embed-english-light-v3.0", "embed-multilingual-light-v3.0":
+		return 384
+	case "embed-v4.0":
+		return 1536
+	default: // embed-english-v3.0, embed-multilingual-v3.0
+		return 1024
+	}
+}
+
+func (p *CohereEmbeddingProvider) Model() string {
+	return "cohere/" + p.model
+}
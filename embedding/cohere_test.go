@@ -0,0 +1,101 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCohereEmbed(t *testing.T) {
+	var reqs []cohereRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		var req cohereRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		reqs = append(reqs, req)
+
+		var resp cohereResponse
+		for i := range req.Texts {
+			resp.Embeddings.Float = append(resp.Embeddings.Float, []float32{float32(i), 0.5})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	p := NewCohereEmbeddingProvider("test-key", "embed-english-v3.0", "", "END")
+	p.client = &http.Client{Transport: &urlRewriteTransport{base: http.DefaultTransport, url: server.URL}}
+
+	vecs, err := p.Embed(context.Background(), []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(vecs) != 2 || vecs[1][0] != 1 {
+		t.Errorf("vecs = %v", vecs)
+	}
+	r := reqs[0]
+	if r.Model != "embed-english-v3.0" || r.InputType != "search_document" || r.Truncate != "END" {
+		t.Errorf("request = %+v", r)
+	}
+	if len(r.EmbeddingTypes) != 1 || r.EmbeddingTypes[0] != "float" {
+		t.Errorf("embedding_types = %q", r.EmbeddingTypes)
+	}
+
+	if _, err := EmbedQueries(context.Background(), p, []string{"q"}); err != nil {
+		t.Fatalf("EmbedQueries: %v", err)
+	}
+	if got := reqs[1].InputType; got != "search_query" {
+		t.Errorf("query input_type = %q, want search_query", got)
+	}
+
+	// Texts beyond the batch limit are split across requests
+	reqs = nil
+	if vecs, err = p.Embed(context.Background(), make([]string, 100)); err != nil || len(vecs) != 100 {
+		t.Fatalf("Embed 100: %d vectors, %v", len(vecs), err)
+	}
+	if len(reqs) != 2 || len(reqs[0].Texts) != 96 || len(reqs[1].Texts) != 4 {
+		t.Errorf("got %d requests", len(reqs))
+	}
+
+	// Other input types embed queries the same way as documents
+	p.inputType = "clustering"
+	reqs = nil
+	EmbedQueries(context.Background(), p, []string{"q"})
+	if got := reqs[0].InputType; got != "clustering" {
+		t.Errorf("clustering query input_type = %q", got)
+	}
+}
+
+func TestCohereEmbedHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"message": "invalid api token"}`))
+	}))
+	defer server.Close()
+
+	p := NewCohereEmbeddingProvider("bad", "embed-english-v3.0", "", "")
+	p.client = &http.Client{Transport: &urlRewriteTransport{base: http.DefaultTransport, url: server.URL}}
+	_, err := p.Embed(context.Background(), []string{"hello"})
+	if err == nil || !strings.Contains(err.Error(), "status 401") {
+		t.Errorf("err = %v, want status 401", err)
+	}
+}
+
+func TestCohereDimensions(t *testing.T) {
+	tests := map[string]int{
+		"embed-english-v3.0":            1024,
+		"embed-multilingual-v3.0":       1024,
+		"embed-english-light-v3.0":      384,
+		"embed-multilingual-light-v3.0": 384,
+		"embed-v4.0":                    1536,
+	}
+	for model, want := range tests {
+		if got := NewCohereEmbeddingProvider("k", model, "", "").Dimensions(); got != want {
+			t.Errorf("%s: Dimensions = %d, want %d", model, got, want)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const geminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
+// geminiBatchLimit is the most texts batchEmbedContents accepts per request.
+const geminiBatchLimit = 100
+
+// Gemini task types: documents and queries are embedded differently, so
+// that a query lands near the documents that answer it.
+const (
+	geminiTaskDocument = "RETRIEVAL_DOCUMENT"
+	geminiTaskQuery    = "RETRIEVAL_QUERY"
+)
+
+// GeminiEmbeddingProvider implements EmbeddingProvider using the Google
+// Gemini API.
+type GeminiEmbeddingProvider struct {
+	apiKey string
+	model  string
+	client *http.Client
+	retry  retryPolicy
+	budget inputBudget
+}
+
+// NewGeminiEmbeddingProvider creates a new Gemini embedding provider.
+func NewGeminiEmbeddingProvider(apiKey, model string) *GeminiEmbeddingProvider {
+	return &GeminiEmbeddingProvider{
+		apiKey: apiKey,
+		model:  model,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+type geminiRequest struct {
+	Requests []geminiEmbedRequest `json:"requests"`
+}
+
+type geminiEmbedRequest struct {
+	Model   string `json:"model"`
+	Content struct {
+		Parts []geminiPart `json:"parts"`
+	} `json:"content"`
+	TaskType string `json:"taskType,omitempty"`
+}
+
+type geminiPart struct {
+	Text string `json:"text"`
+}
+
+type geminiResponse struct {
+	Embeddings []struct {
+		Values []float32 `json:"values"`
+	} `json:"embeddings"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// Embed embeds texts as documents to be retrieved.
+func (p *GeminiEmbeddingProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return p.budget.embed(texts, func(texts []string) ([][]float32, error) {
+		return p.embed(ctx, texts, geminiTaskDocument)
+	})
+}
+
+// EmbedQueries embeds texts as search queries.
+func (p *GeminiEmbeddingProvider) EmbedQueries(ctx context.Context, texts []string) ([][]float32, error) {
+	return p.budget.embed(texts, func(texts []string) ([][]float32, error) {
+		return p.embed(ctx, texts, geminiTaskQuery)
+	})
+}
+
+func (p *GeminiEmbeddingProvider) embed(ctx context.Context, texts []string, taskType string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	embeddings := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += geminiBatchLimit {
+		batch := texts[start:min(start+geminiBatchLimit, len(texts))]
+		vecs, err := p.embedBatch(ctx, batch, taskType)
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, vecs...)
+	}
+	return embeddings, nil
+}
+
+func (p *GeminiEmbeddingProvider) embedBatch(ctx context.Context, texts []string, taskType string) ([][]float32, error) {
+	body := geminiRequest{Requests: make([]geminiEmbedRequest, len(texts))}
+	for i, text := range texts {
+		r := &body.Requests[i]
+		r.Model = "models/" + p.model
+		r.Content.Parts = []geminiPart{{Text: text}}
+		r.TaskType = taskType
+	}
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	url := geminiBaseURL + "/models/" + p.model + ":batchEmbedContents"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-goog-api-key", p.apiKey)
+
+	resp, err := p.retry.do(p.client, req)
+	if err != nil {
+		return nil, fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("gemini api error: status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result geminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("gemini error: %s", result.Error.Message)
+	}
+	if len(result.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("gemini returned %d embeddings for %d texts", len(result.Embeddings), len(texts))
+	}
+
+	embeddings := make([][]float32, len(texts))
+	for i, e := range result.Embeddings {
+		embeddings[i] = e.Values
+	}
+	return embeddings, nil
+}
+
+func (p *GeminiEmbeddingProvider) Dimensions() int {
+	switch p.model {
+	case "gemini-embedding-001", "gemini-embedding-exp-03-07":
+		return 3072
+	default:
+		return 768
+	}
+}
+
+func (p *GeminiEmbeddingProvider) Model() string {
+	return "gemini/" + p.model
+}
@@ -0,0 +1,121 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// geminiTestServer answers batchEmbedContents with one vector per request,
+// recording the task types and batch sizes it saw.
+func geminiTestServer(t *testing.T, tasks *[]string, batches *[]int) *GeminiEmbeddingProvider {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-goog-api-key") != "test-key" {
+			t.Errorf("x-goog-api-key = %q", r.Header.Get("x-goog-api-key"))
+		}
+		if r.URL.Path != "/v1beta/models/text-embedding-004:batchEmbedContents" {
+			t.Errorf("Path = %s", r.URL.Path)
+		}
+		var req geminiRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		*batches = append(*batches, len(req.Requests))
+
+		var resp strings.Builder
+		resp.WriteString(`{"embeddings":[`)
+		for i, e := range req.Requests {
+			if e.Model != "models/text-embedding-004" {
+				t.Errorf("Model = %q", e.Model)
+			}
+			*tasks = append(*tasks, e.TaskType)
+			if i > 0 {
+				resp.WriteString(",")
+			}
+			fmt.Fprintf(&resp, `{"values":[%d, 0.5]}`, len(e.Content.Parts[0].Text))
+		}
+		resp.WriteString(`]}`)
+		w.Write([]byte(resp.String()))
+	}))
+	t.Cleanup(server.Close)
+
+	p := NewGeminiEmbeddingProvider("test-key", "text-embedding-004")
+	p.client = &http.Client{Transport: &urlRewriteTransport{base: http.DefaultTransport, url: server.URL}}
+	return p
+}
+
+func TestGeminiEmbed(t *testing.T) {
+	var tasks []string
+	var batches []int
+	p := geminiTestServer(t, &tasks, &batches)
+
+	vecs, err := p.Embed(context.Background(), []string{"a", "bb"})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(vecs) != 2 || vecs[0][0] != 1 || vecs[1][0] != 2 {
+		t.Errorf("vecs = %v", vecs)
+	}
+	if tasks[0] != "RETRIEVAL_DOCUMENT" {
+		t.Errorf("task = %q, want RETRIEVAL_DOCUMENT", tasks[0])
+	}
+
+	tasks = nil
+	if _, err := EmbedQueries(context.Background(), p, []string{"query"}); err != nil {
+		t.Fatalf("EmbedQueries: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0] != "RETRIEVAL_QUERY" {
+		t.Errorf("tasks = %q, want RETRIEVAL_QUERY", tasks)
+	}
+}
+
+func TestGeminiEmbedBatches(t *testing.T) {
+	var tasks []string
+	var batches []int
+	p := geminiTestServer(t, &tasks, &batches)
+
+	texts := make([]string, 250)
+	for i := range texts {
+		texts[i] = strings.Repeat("x", i)
+	}
+	vecs, err := p.Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(batches) != 3 || batches[0] != 100 || batches[2] != 50 {
+		t.Errorf("batches = %v, want 100, 100, 50", batches)
+	}
+	for i, v := range vecs {
+		if int(v[0]) != i {
+			t.Fatalf("vecs[%d] = %v, out of order", i, v)
+		}
+	}
+}
+
+func TestGeminiEmbedHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": {"message": "API key not valid"}}`))
+	}))
+	defer server.Close()
+
+	p := NewGeminiEmbeddingProvider("bad", "text-embedding-004")
+	p.client = &http.Client{Transport: &urlRewriteTransport{base: http.DefaultTransport, url: server.URL}}
+	_, err := p.Embed(context.Background(), []string{"hello"})
+	if err == nil || !strings.Contains(err.Error(), "status 400") {
+		t.Errorf("err = %v, want status 400", err)
+	}
+}
+
+func TestGeminiDimensionsAndModel(t *testing.T) {
+	if d := NewGeminiEmbeddingProvider("k", "text-embedding-004").Dimensions(); d != 768 {
+		t.Errorf("text-embedding-004 dimensions = %d", d)
+	}
+	p := NewGeminiEmbeddingProvider("k", "gemini-embedding-001")
+	if p.Dimensions() != 3072 || p.Model() != "gemini/gemini-embedding-001" {
+		t.Errorf("Dimensions = %d, Model = %q", p.Dimensions(), p.Model())
+	}
+}
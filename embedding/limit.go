@@ -0,0 +1,95 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/time/rate"
+)
+
+// limitedProvider throttles Embed calls to a provider's quota, shared by
+// everything that embeds through it: tool calls, ingest and reindex.
+type limitedProvider struct {
+	EmbeddingProvider
+	requests *rate.Limiter // nil when requests are not limited
+	tokens   *rate.Limiter // nil when tokens are not limited
+	slots    chan struct{} // nil when concurrency is not bounded
+}
+
+// limit wraps p according to the requests_per_minute, tokens_per_minute
+// and max_concurrent_requests settings, returning p itself when none is set.
+func limit(p EmbeddingProvider, cfg Config) EmbeddingProvider {
+	if cfg.RequestsPerMinute <= 0 && cfg.TokensPerMinute <= 0 && cfg.MaxConcurrentRequests <= 0 {
+		return p
+	}
+	l := &limitedProvider{EmbeddingProvider: p}
+	if cfg.RequestsPerMinute > 0 {
+		l.requests = rate.NewLimiter(rate.Limit(float64(cfg.RequestsPerMinute)/60), 1)
+	}
+	if cfg.TokensPerMinute > 0 {
+		// A full minute's tokens may go at once, as providers meter them
+		l.tokens = rate.NewLimiter(rate.Limit(float64(cfg.TokensPerMinute)/60), cfg.TokensPerMinute)
+	}
+	if cfg.MaxConcurrentRequests > 0 {
+		l.slots = make(chan struct{}, cfg.MaxConcurrentRequests)
+	}
+	return l
+}
+
+func (l *limitedProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	release, err := l.acquire(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return l.EmbeddingProvider.Embed(ctx, texts)
+}
+
+// EmbedQueries keeps the wrapped provider's query mode.
+func (l *limitedProvider) EmbedQueries(ctx context.Context, texts []string) ([][]float32, error) {
+	release, err := l.acquire(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return EmbedQueries(ctx, l.EmbeddingProvider, texts)
+}
+
+// acquire waits for a concurrency slot and for the request and its
+// estimated tokens to fit the rate limits.
+func (l *limitedProvider) acquire(ctx context.Context, texts []string) (release func(), err error) {
+	release = func() {}
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+			release = func() { <-l.slots }
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if l.requests != nil {
+		if err := l.requests.Wait(ctx); err != nil {
+			release()
+			return nil, fmt.Errorf("embedding rate limit: %w", err)
+		}
+	}
+	if l.tokens != nil {
+		// A batch larger than a minute's quota waits for all of it
+		n := min(EstimateTokens(texts), l.tokens.Burst())
+		if err := l.tokens.WaitN(ctx, n); err != nil {
+			release()
+			return nil, fmt.Errorf("embedding rate limit: %w", err)
+		}
+	}
+	return release, nil
+}
+
+// EstimateTokens approximates how providers meter texts, at OpenAI's rule
+// of thumb of four bytes a token.
+func EstimateTokens(texts []string) int {
+	n := 0
+	for _, t := range texts {
+		n += (len(t) + 3) / 4
+	}
+	return max(n, 1)
+}
@@ -0,0 +1,114 @@
+package embedding
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingProvider records how many Embed calls are in flight at once.
+type countingProvider struct {
+	inFlight, peak atomic.Int32
+	queries        atomic.Int32
+	delay          time.Duration
+}
+
+func (p *countingProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	n := p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+	for {
+		peak := p.peak.Load()
+		if n <= peak || p.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(p.delay)
+	return make([][]float32, len(texts)), nil
+}
+
+func (p *countingProvider) EmbedQueries(ctx context.Context, texts []string) ([][]float32, error) {
+	p.queries.Add(1)
+	return p.Embed(ctx, texts)
+}
+
+func (p *countingProvider) Dimensions() int { return 2 }
+func (p *countingProvider) Model() string   { return "counting" }
+
+func TestLimitUnset(t *testing.T) {
+	p := &countingProvider{}
+	if got := limit(p, Config{}); got != EmbeddingProvider(p) {
+		t.Errorf("limit without settings = %T, want the provider itself", got)
+	}
+}
+
+func TestLimitConcurrency(t *testing.T) {
+	p := &countingProvider{delay: 20 * time.Millisecond}
+	l := limit(p, Config{MaxConcurrentRequests: 2})
+
+	var wg sync.WaitGroup
+	for range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := l.Embed(context.Background(), []string{"x"}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if peak := p.peak.Load(); peak != 2 {
+		t.Errorf("peak concurrency = %d, want 2", peak)
+	}
+}
+
+func TestLimitRequestsPerMinute(t *testing.T) {
+	// 1200 a minute is one request every 50ms
+	l := limit(&countingProvider{}, Config{RequestsPerMinute: 1200})
+
+	start := time.Now()
+	for range 3 {
+		if _, err := l.Embed(context.Background(), []string{"x"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("3 requests took %s, want at least 100ms", elapsed)
+	}
+}
+
+func TestLimitTokensContextDeadline(t *testing.T) {
+	// The first request spends the minute's tokens; the next cannot fit
+	// before the deadline.
+	l := limit(&countingProvider{}, Config{TokensPerMinute: 10})
+	if _, err := l.Embed(context.Background(), []string{"0123456789012345678901234567890123456789"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := l.Embed(ctx, []string{"0123456789abcdef"}); err == nil {
+		t.Error("expected rate limit error before the deadline")
+	}
+}
+
+func TestLimitKeepsQueryMode(t *testing.T) {
+	p := &countingProvider{}
+	l := limit(p, Config{MaxConcurrentRequests: 1})
+	if _, err := EmbedQueries(context.Background(), l, []string{"q"}); err != nil {
+		t.Fatal(err)
+	}
+	if p.queries.Load() != 1 {
+		t.Error("EmbedQueries was not forwarded to the provider")
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	if n := EstimateTokens([]string{"", "abcd", "abcde"}); n != 3 {
+		t.Errorf("EstimateTokens = %d, want 3", n)
+	}
+	if n := EstimateTokens(nil); n != 1 {
+		t.Errorf("EstimateTokens(nil) = %d, want 1", n)
+	}
+}
@@ -15,6 +15,8 @@ type OllamaEmbeddingProvider struct {
 	url    string
 	model  string
 	client *http.Client
+	retry  retryPolicy
+	budget inputBudget
 }
 
 // NewOllamaEmbeddingProvider creates a new Ollama embedding provider.
@@ -39,6 +41,12 @@ type ollamaResponse struct {
 }
 
 func (p *OllamaEmbeddingProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return p.budget.embed(texts, func(texts []string) ([][]float32, error) {
+		return p.embed(ctx, texts)
+	})
+}
+
+func (p *OllamaEmbeddingProvider) embed(ctx context.Context, texts []string) ([][]float32, error) {
 	if len(texts) == 0 {
 		return nil, nil
 	}
@@ -58,7 +66,7 @@ func (p *OllamaEmbeddingProvider) Embed(ctx context.Context, texts []string) ([]
 
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := p.client.Do(req)
+	resp, err := p.retry.do(p.client, req)
 	if err != nil {
 		return nil, fmt.Errorf("do request: %w", err)
 	}
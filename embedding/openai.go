@@ -7,14 +7,35 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
-// OpenAIEmbeddingProvider implements EmbeddingProvider using the OpenAI API.
+// OpenAIEmbeddingProvider implements EmbeddingProvider using the OpenAI API,
+// or an Azure OpenAI deployment or other server that speaks the same
+// protocol.
 type OpenAIEmbeddingProvider struct {
 	apiKey string
 	model  string
 	client *http.Client
+	retry  retryPolicy
+	budget inputBudget
+	// azure, when set, sends requests to an Azure OpenAI deployment.
+	azure *azureDeployment
+	// baseURL, when set, replaces https://api.openai.com/v1 for an
+	// OpenAI-compatible server, whose models need dimensions given.
+	baseURL string
+	// dimensions, for OpenAI's own models, asks text-embedding-3 for
+	// shortened (Matryoshka) embeddings; 0 keeps the model's native size.
+	dimensions int
+}
+
+// azureDeployment locates an Azure OpenAI embedding deployment.
+type azureDeployment struct {
+	endpoint   string
+	name       string
+	apiVersion string
 }
 
 // NewOpenAIEmbeddingProvider creates a new OpenAI embedding provider.
@@ -28,9 +49,34 @@ func NewOpenAIEmbeddingProvider(apiKey, model string) *OpenAIEmbeddingProvider {
 	}
 }
 
+// NewAzureOpenAIEmbeddingProvider creates a provider for an Azure OpenAI
+// deployment at endpoint (https://<resource>.openai.azure.com). model names
+// the deployed model, for Dimensions.
+func NewAzureOpenAIEmbeddingProvider(endpoint, deployment, apiVersion, apiKey, model string) *OpenAIEmbeddingProvider {
+	p := NewOpenAIEmbeddingProvider(apiKey, model)
+	p.azure = &azureDeployment{
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		name:       deployment,
+		apiVersion: apiVersion,
+	}
+	return p
+}
+
+// NewOpenAICompatibleEmbeddingProvider creates a provider for a server with
+// an OpenAI-compatible /embeddings endpoint under baseURL (LM Studio, vLLM,
+// llama.cpp, LiteLLM, together.ai). apiKey may be empty for servers without
+// auth; dimensions may be 0 when unknown.
+func NewOpenAICompatibleEmbeddingProvider(baseURL, apiKey, model string, dimensions int) *OpenAIEmbeddingProvider {
+	p := NewOpenAIEmbeddingProvider(apiKey, model)
+	p.baseURL = strings.TrimSuffix(baseURL, "/")
+	p.dimensions = dimensions
+	return p
+}
+
 type openAIRequest struct {
-	Input []string `json:"input"`
-	Model string   `json:"model"`
+	Input      []string `json:"input"`
+	Model      string   `json:"model"`
+	Dimensions int      `json:"dimensions,omitempty"`
 }
 
 type openAIResponse struct {
@@ -44,27 +90,46 @@ type openAIResponse struct {
 }
 
 func (p *OpenAIEmbeddingProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return p.budget.embed(texts, func(texts []string) ([][]float32, error) {
+		return p.embed(ctx, texts)
+	})
+}
+
+func (p *OpenAIEmbeddingProvider) embed(ctx context.Context, texts []string) ([][]float32, error) {
 	if len(texts) == 0 {
 		return nil, nil
 	}
 
-	reqBody, err := json.Marshal(openAIRequest{
-		Input: texts,
-		Model: p.model,
-	})
+	body := openAIRequest{Input: texts, Model: p.model}
+	if p.baseURL == "" {
+		body.Dimensions = p.dimensions
+	}
+	reqBody, err := json.Marshal(body)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/embeddings", bytes.NewReader(reqBody))
+	endpoint := "https://api.openai.com/v1/embeddings"
+	if p.baseURL != "" {
+		endpoint = p.baseURL + "/embeddings"
+	}
+	if p.azure != nil {
+		endpoint = p.azure.endpoint + "/openai/deployments/" + url.PathEscape(p.azure.name) +
+			"/embeddings?api-version=" + url.QueryEscape(p.azure.apiVersion)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(reqBody))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	if p.azure != nil {
+		req.Header.Set("api-key", p.apiKey)
+	} else if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
 
-	resp, err := p.client.Do(req)
+	resp, err := p.retry.do(p.client, req)
 	if err != nil {
 		return nil, fmt.Errorf("do request: %w", err)
 	}
@@ -72,7 +137,7 @@ func (p *OpenAIEmbeddingProvider) Embed(ctx context.Context, texts []string) ([]
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-		return nil, fmt.Errorf("openai api error: status %d: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("%s api error: status %d: %s", p.apiName(), resp.StatusCode, string(body))
 	}
 
 	var result openAIResponse
@@ -81,7 +146,7 @@ func (p *OpenAIEmbeddingProvider) Embed(ctx context.Context, texts []string) ([]
 	}
 
 	if result.Error != nil {
-		return nil, fmt.Errorf("openai error: %s", result.Error.Message)
+		return nil, fmt.Errorf("%s error: %s", p.apiName(), result.Error.Message)
 	}
 
 	embeddings := make([][]float32, len(texts))
@@ -93,6 +158,9 @@ func (p *OpenAIEmbeddingProvider) Embed(ctx context.Context, texts []string) ([]
 }
 
 func (p *OpenAIEmbeddingProvider) Dimensions() int {
+	if p.baseURL != "" || p.dimensions > 0 {
+		return p.dimensions
+	}
 	switch p.model {
 	case "text-embedding-3-large":
 		return 3072
@@ -101,6 +169,30 @@ func (p *OpenAIEmbeddingProvider) Dimensions() int {
 	}
 }
 
+// Model names the model, with the dimensions when shortened so that
+// embeddings of different sizes are stored and indexed apart.
 func (p *OpenAIEmbeddingProvider) Model() string {
-	return "openai/" + p.model
+	if p.baseURL != "" {
+		return "openai-compatible/" + p.model
+	}
+	name := "openai/" + p.model
+	if p.azure != nil {
+		name = "azure/" + p.azure.name
+	}
+	if p.dimensions > 0 {
+		name += fmt.Sprintf("@%d", p.dimensions)
+	}
+	return name
+}
+
+// apiName names the server in errors.
+func (p *OpenAIEmbeddingProvider) apiName() string {
+	switch {
+	case p.azure != nil:
+		return "azure openai"
+	case p.baseURL != "":
+		return p.baseURL
+	default:
+		return "openai"
+	}
 }
@@ -70,6 +70,64 @@ func TestOpenAIEmbed(t *testing.T) {
 	}
 }
 
+func TestAzureOpenAIEmbed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/deployments/my-embeddings/embeddings" {
+			t.Errorf("Path = %s", r.URL.Path)
+		}
+		if v := r.URL.Query().Get("api-version"); v != "2024-02-01" {
+			t.Errorf("api-version = %q", v)
+		}
+		if r.Header.Get("api-key") != "azure-key" || r.Header.Get("Authorization") != "" {
+			t.Errorf("api-key = %q, Authorization = %q", r.Header.Get("api-key"), r.Header.Get("Authorization"))
+		}
+		w.Write([]byte(`{"data": [{"embedding": [0.1, 0.2], "index": 0}]}`))
+	}))
+	defer server.Close()
+
+	provider := NewAzureOpenAIEmbeddingProvider(server.URL+"/", "my-embeddings", "2024-02-01", "azure-key", "text-embedding-3-large")
+	vecs, err := provider.Embed(context.Background(), []string{"hello"})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(vecs) != 1 || vecs[0][1] != 0.2 {
+		t.Errorf("vecs = %v", vecs)
+	}
+	if provider.Model() != "azure/my-embeddings" || provider.Dimensions() != 3072 {
+		t.Errorf("Model = %q, Dimensions = %d", provider.Model(), provider.Dimensions())
+	}
+}
+
+func TestOpenAICompatibleEmbed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			t.Errorf("Path = %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("Authorization = %q, want none without a key", r.Header.Get("Authorization"))
+		}
+		var req openAIRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "nomic-embed-text-v1.5" || req.Dimensions != 0 {
+			t.Errorf("Model = %q, Dimensions = %d", req.Model, req.Dimensions)
+		}
+		w.Write([]byte(`{"data": [{"embedding": [0.5], "index": 0}]}`))
+	}))
+	defer server.Close()
+
+	provider := NewOpenAICompatibleEmbeddingProvider(server.URL+"/v1/", "", "nomic-embed-text-v1.5", 768)
+	vecs, err := provider.Embed(context.Background(), []string{"hello"})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(vecs) != 1 || vecs[0][0] != 0.5 {
+		t.Errorf("vecs = %v", vecs)
+	}
+	if provider.Model() != "openai-compatible/nomic-embed-text-v1.5" || provider.Dimensions() != 768 {
+		t.Errorf("Model = %q, Dimensions = %d", provider.Model(), provider.Dimensions())
+	}
+}
+
 func TestOpenAIEmbedEmpty(t *testing.T) {
 	provider := NewOpenAIEmbeddingProvider("key", "model")
 
@@ -138,6 +196,32 @@ func TestOpenAIModel(t *testing.T) {
 	}
 }
 
+func TestOpenAIShortenedDimensions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openAIRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Dimensions != 512 {
+			t.Errorf("Dimensions = %d, want 512", req.Dimensions)
+		}
+		w.Write([]byte(`{"data": [{"embedding": [0.5], "index": 0}]}`))
+	}))
+	defer server.Close()
+
+	p, err := New(Config{Provider: "openai", OpenAI: OpenAIConfig{APIKey: "sk-test", Dimensions: 512}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	provider := p.(*OpenAIEmbeddingProvider)
+	provider.client.Transport = &urlRewriteTransport{base: http.DefaultTransport, url: server.URL}
+	if _, err := provider.Embed(context.Background(), []string{"hello"}); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	// Shortened embeddings are stored apart from full-size ones
+	if provider.Model() != "openai/text-embedding-3-small@512" || provider.Dimensions() != 512 {
+		t.Errorf("Model = %q, Dimensions = %d", provider.Model(), provider.Dimensions())
+	}
+}
+
 func TestOpenAIEmbedHTTPError(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
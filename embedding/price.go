@@ -0,0 +1,31 @@
+package embedding
+
+import "strings"
+
+// pricePerMillion is the list price in US dollars per million input tokens
+// of hosted embedding models, by model ID.
+var pricePerMillion = map[string]float64{
+	"openai/text-embedding-3-small":   0.02,
+	"openai/text-embedding-3-large":   0.13,
+	"openai/text-embedding-ada-002":   0.10,
+	"cohere/embed-english-v3.0":       0.10,
+	"cohere/embed-multilingual-v3.0":  0.10,
+	"cohere/embed-english-light-v3.0": 0.10,
+	"cohere/embed-v4.0":               0.12,
+	"gemini/text-embedding-004":       0,
+	"gemini/gemini-embedding-001":     0.15,
+}
+
+// Price returns the cost in US dollars of embedding tokens with model, a
+// provider's Model() ID. Local Ollama models cost nothing; ok is false for
+// models whose price is not known (Azure deployments, OpenAI-compatible
+// servers).
+func Price(model string, tokens int) (cost float64, ok bool) {
+	if strings.HasPrefix(model, "ollama/") {
+		return 0, true
+	}
+	// Shortened OpenAI embeddings cost the same as full ones
+	model, _, _ = strings.Cut(model, "@")
+	price, ok := pricePerMillion[model]
+	return price * float64(tokens) / 1e6, ok
+}
@@ -2,7 +2,11 @@ package embedding
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
+	"time"
 )
 
 // EmbeddingProvider generates vector embeddings for text.
@@ -15,17 +19,139 @@ type EmbeddingProvider interface {
 	Model() string
 }
 
+// QueryEmbedder is implemented by providers that embed search queries
+// differently from the documents they are matched against.
+type QueryEmbedder interface {
+	EmbedQueries(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// EmbedQueries embeds search queries, with the provider's query mode if it
+// has one.
+func EmbedQueries(ctx context.Context, p EmbeddingProvider, texts []string) ([][]float32, error) {
+	if q, ok := p.(QueryEmbedder); ok {
+		return q.EmbedQueries(ctx, texts)
+	}
+	return p.Embed(ctx, texts)
+}
+
 // Config holds embedding provider configuration.
 type Config struct {
 	Provider string       `toml:"provider"`
 	OpenAI   OpenAIConfig `toml:"openai"`
 	Ollama   OllamaConfig `toml:"ollama"`
+	Gemini   GeminiConfig `toml:"gemini"`
+	Cohere   CohereConfig `toml:"cohere"`
+	Azure    AzureConfig  `toml:"azure"`
+	// OpenAICompatible configures the "openai-compatible" provider.
+	OpenAICompatible OpenAICompatibleConfig `toml:"openai_compatible"`
+
+	// MetadataFields lists metadata keys whose values are embedded along
+	// with the content (see Text). Empty means content only.
+	MetadataFields []string `toml:"metadata_fields"`
+	// ReembedOnMetadata re-generates the embedding when an update changes
+	// any of MetadataFields without touching content.
+	ReembedOnMetadata bool `toml:"reembed_on_metadata"`
+
+	// QueryTimeoutSeconds bounds query-time embedding (semantic search) so
+	// searches fail fast when the provider is slow. 0 means 5 seconds.
+	QueryTimeoutSeconds int `toml:"query_timeout_seconds"`
+	// QueryCacheSize is how many query embeddings are kept in memory for
+	// repeated searches (0 means 256; negative disables the cache), each for
+	// QueryCacheTTLSeconds (0 means 10 minutes).
+	QueryCacheSize       int `toml:"query_cache_size"`
+	QueryCacheTTLSeconds int `toml:"query_cache_ttl_seconds"`
+	// IngestTimeoutSeconds bounds embedding when chunks are stored or
+	// updated. 0 means the provider's HTTP timeout.
+	IngestTimeoutSeconds int `toml:"ingest_timeout_seconds"`
+	// DeferOnTimeout stores a chunk without its embedding when ingest-time
+	// embedding times out or stays rate limited; `mykb reindex` fills it in
+	// later.
+	DeferOnTimeout bool `toml:"defer_on_timeout"`
+
+	// AutoReindex embeds chunks in the background at startup when most
+	// stored embeddings are from another model, as after changing provider
+	// or model. Otherwise the server only warns to run `mykb reindex`.
+	AutoReindex bool `toml:"auto_reindex"`
+
+	// MaxAttempts is how many times a request is tried on 429, 5xx and
+	// network errors, backing off in between (0 means 3; 1 disables retries).
+	MaxAttempts int `toml:"max_attempts"`
+
+	// RequestsPerMinute and TokensPerMinute throttle embedding requests to
+	// the provider's quota, tokens estimated at four bytes each; 0 means
+	// unlimited.
+	RequestsPerMinute int `toml:"requests_per_minute"`
+	TokensPerMinute   int `toml:"tokens_per_minute"`
+	// MaxConcurrentRequests bounds requests in flight; 0 means unbounded.
+	MaxConcurrentRequests int `toml:"max_concurrent_requests"`
+
+	// MaxInputTokens is the longest input sent to the provider, estimated
+	// at three bytes a token. 0 means the model's limit where the provider
+	// rejects longer inputs (8191 for OpenAI and Azure); negative disables.
+	MaxInputTokens int `toml:"max_input_tokens"`
+	// LongInputs is how longer inputs are embedded: "truncate" (default)
+	// or "average", which embeds their pieces and averages the vectors.
+	LongInputs string `toml:"long_inputs"`
+}
+
+// DefaultQueryTimeout bounds query-time embedding when not configured.
+const DefaultQueryTimeout = 5 * time.Second
+
+// QueryTimeout returns the timeout for query-time embedding.
+func (c Config) QueryTimeout() time.Duration {
+	if c.QueryTimeoutSeconds > 0 {
+		return time.Duration(c.QueryTimeoutSeconds) * time.Second
+	}
+	return DefaultQueryTimeout
+}
+
+// Query embedding cache defaults, when not configured.
+const (
+	DefaultQueryCacheSize = 256
+	DefaultQueryCacheTTL  = 10 * time.Minute
+)
+
+// QueryCacheEntries returns how many query embeddings to cache, 0 for none.
+func (c Config) QueryCacheEntries() int {
+	switch {
+	case c.QueryCacheSize < 0:
+		return 0
+	case c.QueryCacheSize > 0:
+		return c.QueryCacheSize
+	}
+	return DefaultQueryCacheSize
+}
+
+// QueryCacheTTL returns how long a cached query embedding is reused.
+func (c Config) QueryCacheTTL() time.Duration {
+	if c.QueryCacheTTLSeconds > 0 {
+		return time.Duration(c.QueryCacheTTLSeconds) * time.Second
+	}
+	return DefaultQueryCacheTTL
+}
+
+// Attempts returns how many times a request is tried.
+func (c Config) Attempts() int {
+	if c.MaxAttempts > 0 {
+		return c.MaxAttempts
+	}
+	return DefaultMaxAttempts
+}
+
+// IngestTimeout returns the timeout for ingest-time embedding, or 0 to
+// rely on the provider's HTTP timeout.
+func (c Config) IngestTimeout() time.Duration {
+	return time.Duration(c.IngestTimeoutSeconds) * time.Second
 }
 
 // OpenAIConfig holds OpenAI-specific settings.
 type OpenAIConfig struct {
 	APIKey string `toml:"api_key"`
 	Model  string `toml:"model"`
+	// Dimensions shortens text-embedding-3 embeddings (e.g. 512) for less
+	// storage and faster search; 0 keeps the model's full size. Changing
+	// it needs a reindex.
+	Dimensions int `toml:"dimensions"`
 }
 
 // OllamaConfig holds Ollama-specific settings.
@@ -34,9 +160,66 @@ type OllamaConfig struct {
 	Model string `toml:"model"`
 }
 
+// GeminiConfig holds Google Gemini-specific settings.
+type GeminiConfig struct {
+	APIKey string `toml:"api_key"`
+	Model  string `toml:"model"`
+}
+
+// CohereConfig holds Cohere-specific settings.
+type CohereConfig struct {
+	APIKey string `toml:"api_key"`
+	Model  string `toml:"model"`
+	// InputType is how documents are embedded: "search_document" (default,
+	// with queries embedded as "search_query"), "classification" or
+	// "clustering".
+	InputType string `toml:"input_type"`
+	// Truncate is how over-long texts are cut: "NONE" (fail), "START" or
+	// "END" (the API's default).
+	Truncate string `toml:"truncate"`
+}
+
+// DefaultAzureAPIVersion is the Azure OpenAI REST API version used when
+// none is configured.
+const DefaultAzureAPIVersion = "2024-02-01"
+
+// AzureConfig holds Azure OpenAI settings.
+type AzureConfig struct {
+	// Endpoint is the resource URL, https://<resource>.openai.azure.com.
+	Endpoint   string `toml:"endpoint"`
+	Deployment string `toml:"deployment"`
+	APIVersion string `toml:"api_version"`
+	APIKey     string `toml:"api_key"`
+	// Model is the model deployed, which sets the embedding dimensions
+	// (default text-embedding-3-small).
+	Model string `toml:"model"`
+}
+
+// OpenAICompatibleConfig holds settings for a server with an OpenAI-style
+// embeddings endpoint.
+type OpenAICompatibleConfig struct {
+	// BaseURL is the API root, under which /embeddings is requested
+	// (e.g. http://localhost:1234/v1).
+	BaseURL string `toml:"base_url"`
+	// APIKey is sent as a Bearer token; leave empty for servers without auth.
+	APIKey string `toml:"api_key"`
+	Model  string `toml:"model"`
+	// Dimensions of the model's embeddings, informational only.
+	Dimensions int `toml:"dimensions"`
+}
+
 // New creates an EmbeddingProvider based on the config.
-// Supported providers: "openai", "ollama".
+// Supported providers: "openai", "ollama", "gemini", "cohere", "azure",
+// "openai-compatible".
 func New(cfg Config) (EmbeddingProvider, error) {
+	p, err := newProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return limit(p, cfg), nil
+}
+
+func newProvider(cfg Config) (EmbeddingProvider, error) {
 	switch cfg.Provider {
 	case "openai":
 		if cfg.OpenAI.APIKey == "" {
@@ -46,7 +229,12 @@ func New(cfg Config) (EmbeddingProvider, error) {
 		if model == "" {
 			model = "text-embedding-3-small"
 		}
-		return NewOpenAIEmbeddingProvider(cfg.OpenAI.APIKey, model), nil
+		p := NewOpenAIEmbeddingProvider(cfg.OpenAI.APIKey, model)
+		p.dimensions = cfg.OpenAI.Dimensions
+		raiseTimeout(p.client, cfg.IngestTimeout())
+		p.retry = newRetryPolicy(cfg.Attempts())
+		p.budget = newInputBudget(cfg)
+		return p, nil
 
 	case "ollama":
 		url := cfg.Ollama.URL
@@ -57,7 +245,71 @@ func New(cfg Config) (EmbeddingProvider, error) {
 		if model == "" {
 			model = "nomic-embed-text"
 		}
-		return NewOllamaEmbeddingProvider(url, model), nil
+		p := NewOllamaEmbeddingProvider(url, model)
+		raiseTimeout(p.client, cfg.IngestTimeout())
+		p.retry = newRetryPolicy(cfg.Attempts())
+		p.budget = newInputBudget(cfg)
+		return p, nil
+
+	case "gemini":
+		if cfg.Gemini.APIKey == "" {
+			return nil, fmt.Errorf("gemini.api_key not set")
+		}
+		model := cfg.Gemini.Model
+		if model == "" {
+			model = "text-embedding-004"
+		}
+		p := NewGeminiEmbeddingProvider(cfg.Gemini.APIKey, model)
+		raiseTimeout(p.client, cfg.IngestTimeout())
+		p.retry = newRetryPolicy(cfg.Attempts())
+		p.budget = newInputBudget(cfg)
+		return p, nil
+
+	case "cohere":
+		if cfg.Cohere.APIKey == "" {
+			return nil, fmt.Errorf("cohere.api_key not set")
+		}
+		model := cfg.Cohere.Model
+		if model == "" {
+			model = "embed-english-v3.0"
+		}
+		p := NewCohereEmbeddingProvider(cfg.Cohere.APIKey, model, cfg.Cohere.InputType, cfg.Cohere.Truncate)
+		raiseTimeout(p.client, cfg.IngestTimeout())
+		p.retry = newRetryPolicy(cfg.Attempts())
+		p.budget = newInputBudget(cfg)
+		return p, nil
+
+	case "azure":
+		if cfg.Azure.Endpoint == "" || cfg.Azure.Deployment == "" {
+			return nil, fmt.Errorf("azure.endpoint and azure.deployment must be set")
+		}
+		if cfg.Azure.APIKey == "" {
+			return nil, fmt.Errorf("azure.api_key not set")
+		}
+		version := cfg.Azure.APIVersion
+		if version == "" {
+			version = DefaultAzureAPIVersion
+		}
+		model := cfg.Azure.Model
+		if model == "" {
+			model = "text-embedding-3-small"
+		}
+		p := NewAzureOpenAIEmbeddingProvider(cfg.Azure.Endpoint, cfg.Azure.Deployment, version, cfg.Azure.APIKey, model)
+		raiseTimeout(p.client, cfg.IngestTimeout())
+		p.retry = newRetryPolicy(cfg.Attempts())
+		p.budget = newInputBudget(cfg)
+		return p, nil
+
+	case "openai-compatible":
+		c := cfg.OpenAICompatible
+		if c.BaseURL == "" || c.Model == "" {
+			return nil, fmt.Errorf("openai_compatible.base_url and openai_compatible.model must be set")
+		}
+		p := NewOpenAICompatibleEmbeddingProvider(c.BaseURL, c.APIKey, c.Model, c.Dimensions)
+		raiseTimeout(p.client, cfg.IngestTimeout())
+		p.retry = newRetryPolicy(cfg.Attempts())
+		p.budget = newInputBudget(cfg)
+		return p, nil
 
 	case "":
 		return nil, fmt.Errorf("embedding provider not configured")
@@ -66,3 +318,67 @@ func New(cfg Config) (EmbeddingProvider, error) {
 		return nil, fmt.Errorf("unknown embedding provider: %s", cfg.Provider)
 	}
 }
+
+// raiseTimeout lets a configured ingest timeout exceed the provider's
+// default HTTP timeout. Shorter timeouts are applied per call via context.
+func raiseTimeout(client *http.Client, timeout time.Duration) {
+	if timeout > client.Timeout {
+		client.Timeout = timeout
+	}
+}
+
+// Text returns the text that represents a chunk for embedding.
+//
+// With no fields, it is the content unchanged. Otherwise each listed
+// metadata field present on the chunk contributes a "key: value" line, in
+// the order given (array values are joined with ", "), followed by a blank
+// line and the content:
+//
+//	title: Meeting notes
+//	tags: work, q3
+//
+//	<content>
+func Text(content string, metadata json.RawMessage, fields []string) string {
+	header := metadataHeader(metadata, fields)
+	if header == "" {
+		return content
+	}
+	return header + "\n" + content
+}
+
+// metadataHeader renders the metadata lines used by Text.
+func metadataHeader(metadata json.RawMessage, fields []string) string {
+	if len(fields) == 0 || len(metadata) == 0 {
+		return ""
+	}
+	var meta map[string]any
+	if err := json.Unmarshal(metadata, &meta); err != nil {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, field := range fields {
+		v, ok := meta[field]
+		if !ok || v == nil {
+			continue
+		}
+		var value string
+		if arr, ok := v.([]any); ok {
+			parts := make([]string, len(arr))
+			for i, item := range arr {
+				parts[i] = fmt.Sprint(item)
+			}
+			value = strings.Join(parts, ", ")
+		} else {
+			value = fmt.Sprint(v)
+		}
+		fmt.Fprintf(&b, "%s: %s\n", field, value)
+	}
+	return b.String()
+}
+
+// MetadataChanged reports whether switching from oldMeta to newMeta changes
+// the embedded text for the given fields.
+func MetadataChanged(oldMeta, newMeta json.RawMessage, fields []string) bool {
+	return metadataHeader(oldMeta, fields) != metadataHeader(newMeta, fields)
+}
@@ -1,7 +1,10 @@
 package embedding
 
 import (
+	"encoding/json"
+	"math"
 	"testing"
+	"time"
 )
 
 func TestNewOpenAI(t *testing.T) {
@@ -33,6 +36,72 @@ func TestNewOpenAINoKey(t *testing.T) {
 	}
 }
 
+func TestNewGemini(t *testing.T) {
+	p, err := New(Config{Provider: "gemini", Gemini: GeminiConfig{APIKey: "test-key"}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if p.Model() != "gemini/text-embedding-004" {
+		t.Errorf("Model = %q, want gemini/text-embedding-004", p.Model())
+	}
+	if _, ok := p.(QueryEmbedder); !ok {
+		t.Error("Gemini provider should embed queries separately")
+	}
+
+	if _, err := New(Config{Provider: "gemini"}); err == nil {
+		t.Error("Expected error when api_key not set")
+	}
+}
+
+func TestNewCohere(t *testing.T) {
+	p, err := New(Config{Provider: "cohere", Cohere: CohereConfig{APIKey: "test-key"}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if p.Model() != "cohere/embed-english-v3.0" || p.Dimensions() != 1024 {
+		t.Errorf("Model = %q, Dimensions = %d", p.Model(), p.Dimensions())
+	}
+	if _, err := New(Config{Provider: "cohere"}); err == nil {
+		t.Error("Expected error when api_key not set")
+	}
+}
+
+func TestNewAzure(t *testing.T) {
+	azure := AzureConfig{Endpoint: "https://r.openai.azure.com", Deployment: "emb", APIKey: "key"}
+	p, err := New(Config{Provider: "azure", Azure: azure})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	o, ok := p.(*OpenAIEmbeddingProvider)
+	if !ok || o.azure == nil || o.azure.apiVersion != DefaultAzureAPIVersion {
+		t.Fatalf("provider = %#v", p)
+	}
+	if p.Dimensions() != 1536 {
+		t.Errorf("Dimensions = %d, want 1536", p.Dimensions())
+	}
+
+	azure.Deployment = ""
+	if _, err := New(Config{Provider: "azure", Azure: azure}); err == nil {
+		t.Error("Expected error without a deployment")
+	}
+}
+
+func TestNewOpenAICompatible(t *testing.T) {
+	c := OpenAICompatibleConfig{BaseURL: "http://localhost:1234/v1", Model: "m"}
+	p, err := New(Config{Provider: "openai-compatible", OpenAICompatible: c})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if p.Model() != "openai-compatible/m" {
+		t.Errorf("Model = %q", p.Model())
+	}
+
+	c.Model = ""
+	if _, err := New(Config{Provider: "openai-compatible", OpenAICompatible: c}); err == nil {
+		t.Error("Expected error without a model")
+	}
+}
+
 func TestNewOllama(t *testing.T) {
 	cfg := Config{
 		Provider: "ollama",
@@ -112,3 +181,88 @@ func TestNewEmptyProvider(t *testing.T) {
 		t.Error("Expected error for empty provider")
 	}
 }
+
+func TestText(t *testing.T) {
+	meta := json.RawMessage(`{"title":"Go notes","tags":["go","db"],"n":3}`)
+
+	tests := []struct {
+		name   string
+		fields []string
+		want   string
+	}{
+		{"no fields", nil, "body"},
+		{"string", []string{"title"}, "title: Go notes\n\nbody"},
+		{"array and order", []string{"tags", "title"}, "tags: go, db\ntitle: Go notes\n\nbody"},
+		{"number", []string{"n"}, "n: 3\n\nbody"},
+		{"missing", []string{"author"}, "body"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Text("body", meta, tt.fields); got != tt.want {
+				t.Errorf("Text = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetadataChanged(t *testing.T) {
+	old := json.RawMessage(`{"title":"A","tags":["x"]}`)
+	fields := []string{"title"}
+
+	if MetadataChanged(old, json.RawMessage(`{"title":"A","tags":["y"]}`), fields) {
+		t.Error("change to unembedded field reported")
+	}
+	if !MetadataChanged(old, json.RawMessage(`{"title":"B"}`), fields) {
+		t.Error("change to embedded field not reported")
+	}
+	if MetadataChanged(old, json.RawMessage(`{"title":"B"}`), nil) {
+		t.Error("change reported with no embedded fields")
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	var cfg Config
+	if cfg.QueryTimeout() != DefaultQueryTimeout || cfg.IngestTimeout() != 0 {
+		t.Errorf("defaults = %s, %s", cfg.QueryTimeout(), cfg.IngestTimeout())
+	}
+
+	cfg = Config{Provider: "ollama", QueryTimeoutSeconds: 2, IngestTimeoutSeconds: 300}
+	if cfg.QueryTimeout() != 2*time.Second || cfg.IngestTimeout() != 300*time.Second {
+		t.Errorf("configured = %s, %s", cfg.QueryTimeout(), cfg.IngestTimeout())
+	}
+
+	// A longer ingest timeout raises the provider's HTTP timeout
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if got := p.(*OllamaEmbeddingProvider).client.Timeout; got != 300*time.Second {
+		t.Errorf("client timeout = %s, want 5m", got)
+	}
+
+	// A shorter one leaves it alone; it is applied per call instead
+	cfg.IngestTimeoutSeconds = 1
+	p, _ = New(cfg)
+	if got := p.(*OllamaEmbeddingProvider).client.Timeout; got != 60*time.Second {
+		t.Errorf("client timeout = %s, want 60s", got)
+	}
+}
+
+func TestPrice(t *testing.T) {
+	tests := []struct {
+		model  string
+		cost   float64
+		priced bool
+	}{
+		{"openai/text-embedding-3-small", 0.02, true},
+		{"openai/text-embedding-3-large@256", 0.13, true},
+		{"ollama/nomic-embed-text", 0, true},
+		{"azure/my-deployment", 0, false},
+	}
+	for _, tt := range tests {
+		cost, ok := Price(tt.model, 1_000_000)
+		if ok != tt.priced || math.Abs(cost-tt.cost) > 1e-9 {
+			t.Errorf("Price(%q) = %v, %v; want %v, %v", tt.model, cost, ok, tt.cost, tt.priced)
+		}
+	}
+}
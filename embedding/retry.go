@@ -0,0 +1,144 @@
+package embedding
+
+import (
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMaxAttempts is how many times a request is tried when
+// max_attempts is not configured.
+const DefaultMaxAttempts = 3
+
+// retryBaseDelay and retryMaxDelay bound the backoff between attempts; a
+// Retry-After longer than retryMaxDelay is not waited out.
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+)
+
+// RateLimitedError reports that the provider kept rejecting requests with
+// 429 Too Many Requests. Callers can store the chunk and leave its
+// embedding to mykb reindex.
+type RateLimitedError struct {
+	// RetryAfter is the wait the provider asked for, 0 if it named none.
+	RetryAfter time.Duration
+	// Message is the start of the provider's response body.
+	Message string
+}
+
+func (e *RateLimitedError) Error() string {
+	msg := "embedding provider rate limited: status 429"
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(" (retry after %s)", e.RetryAfter)
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// retryPolicy retries requests that fail with 429, a 5xx status or a
+// network error, backing off exponentially or as Retry-After asks. The zero
+// value tries once.
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+func newRetryPolicy(maxAttempts int) retryPolicy {
+	return retryPolicy{maxAttempts: maxAttempts, baseDelay: retryBaseDelay, maxDelay: retryMaxDelay}
+}
+
+// do sends req, whose body must be replayable (as NewRequest makes it for
+// a bytes.Reader), until it succeeds or attempts run out. Responses that are
+// not retried, or fail the last attempt with a 5xx, are returned for the
+// caller to report; a last 429 becomes a *RateLimitedError.
+func (r retryPolicy) do(client *http.Client, req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := client.Do(req)
+		var retryAfter time.Duration
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil, err
+			}
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+			retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		default:
+			return resp, nil
+		}
+
+		wait := retryAfter
+		if wait == 0 {
+			wait = r.backoff(attempt)
+		}
+		last := attempt >= r.maxAttempts || wait > r.maxDelay
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			last = true
+		}
+		if last {
+			switch {
+			case err != nil:
+				return nil, err
+			case resp.StatusCode == http.StatusTooManyRequests:
+				body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+				resp.Body.Close()
+				return nil, &RateLimitedError{RetryAfter: retryAfter, Message: strings.TrimSpace(string(body))}
+			default:
+				return resp, nil
+			}
+		}
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff doubles the delay with each attempt, with jitter so that
+// clients rate limited together do not retry together.
+func (r retryPolicy) backoff(attempt int) time.Duration {
+	d := r.baseDelay << (attempt - 1)
+	if d <= 0 || d > r.maxDelay {
+		d = r.maxDelay
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// parseRetryAfter reads a Retry-After header, in seconds or as an HTTP
+// date; it returns 0 when absent or unreadable.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
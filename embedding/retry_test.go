@@ -0,0 +1,141 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// retryingOllama returns a provider for server that retries quickly.
+func retryingOllama(url string, attempts int) *OllamaEmbeddingProvider {
+	p := NewOllamaEmbeddingProvider(url, "nomic-embed-text")
+	p.retry = retryPolicy{maxAttempts: attempts, baseDelay: time.Millisecond, maxDelay: 50 * time.Millisecond}
+	return p
+}
+
+func TestRetryRecovers(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"embeddings": [[0.1, 0.2]]}`))
+	}))
+	defer server.Close()
+
+	vecs, err := retryingOllama(server.URL, 3).Embed(context.Background(), []string{"hello"})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if calls != 3 || len(vecs) != 1 {
+		t.Errorf("calls = %d, vecs = %v", calls, vecs)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	if _, err := retryingOllama(server.URL, 2).Embed(context.Background(), []string{"hello"}); err == nil {
+		t.Error("expected error")
+	}
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+}
+
+func TestRetryNotOnClientError(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	retryingOllama(server.URL, 3).Embed(context.Background(), []string{"hello"})
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestRetryRateLimited(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "0")
+		} else {
+			// Longer than the policy waits: give up at once
+			w.Header().Set("Retry-After", "120")
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte("slow down"))
+	}))
+	defer server.Close()
+
+	_, err := retryingOllama(server.URL, 5).Embed(context.Background(), []string{"hello"})
+	var limited *RateLimitedError
+	if !errors.As(err, &limited) {
+		t.Fatalf("err = %v, want RateLimitedError", err)
+	}
+	if limited.RetryAfter != 2*time.Minute || limited.Message != "slow down" {
+		t.Errorf("limited = %+v", limited)
+	}
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+}
+
+func TestRetryKeepsBody(t *testing.T) {
+	var bodies []int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bodies = append(bodies, r.ContentLength)
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"embeddings": [[1]]}`))
+	}))
+	defer server.Close()
+
+	if _, err := retryingOllama(server.URL, 2).Embed(context.Background(), []string{"hello"}); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(bodies) != 2 || bodies[0] != bodies[1] || bodies[0] == 0 {
+		t.Errorf("request bodies = %v, want the same body twice", bodies)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d := parseRetryAfter("7"); d != 7*time.Second {
+		t.Errorf("seconds: %s", d)
+	}
+	if d := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)); d < 58*time.Second || d > time.Minute {
+		t.Errorf("date: %s", d)
+	}
+	for _, v := range []string{"", "soon", "-3"} {
+		if d := parseRetryAfter(v); d != 0 {
+			t.Errorf("%q: %s", v, d)
+		}
+	}
+}
+
+func TestNewConfiguresRetries(t *testing.T) {
+	p, _ := New(Config{Provider: "ollama"})
+	if got := p.(*OllamaEmbeddingProvider).retry.maxAttempts; got != DefaultMaxAttempts {
+		t.Errorf("default attempts = %d", got)
+	}
+	p, _ = New(Config{Provider: "ollama", MaxAttempts: 1})
+	if got := p.(*OllamaEmbeddingProvider).retry.maxAttempts; got != 1 {
+		t.Errorf("attempts = %d, want 1", got)
+	}
+}
@@ -0,0 +1,93 @@
+// Package events provides an in-process feed of server activity
+// (tool calls, auth events, errors, chunk changes) for live inspection.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Type classifies an event.
+type Type string
+
+const (
+	ToolCall Type = "tool_call"
+	Auth     Type = "auth"
+	Error    Type = "error"
+
+	ChunkCreated Type = "chunk_created"
+	ChunkUpdated Type = "chunk_updated"
+	ChunkDeleted Type = "chunk_deleted"
+	// ChunkExpired precedes the chunk_deleted of a chunk removed because
+	// its metadata expiry passed.
+	ChunkExpired Type = "chunk_expired"
+)
+
+// IsChunk reports whether t is a chunk change.
+func (t Type) IsChunk() bool {
+	return t == ChunkCreated || t == ChunkUpdated || t == ChunkDeleted
+}
+
+// Event is a single activity record.
+type Event struct {
+	Time    time.Time      `json:"time"`
+	Type    Type           `json:"type"`
+	Message string         `json:"message"`
+	Fields  map[string]any `json:"fields,omitempty"`
+	// Data is the event's payload, such as the chunk that was created or
+	// updated.
+	Data any `json:"data,omitempty"`
+}
+
+// subscriberBuffer is how many events a slow subscriber may lag behind
+// before further events are dropped for it.
+const subscriberBuffer = 64
+
+// Bus fans events out to subscribers. Publishing never blocks, and a nil
+// *Bus discards events, so callers need not check whether one is configured.
+type Bus struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+// NewBus creates an event bus.
+func NewBus() *Bus {
+	return &Bus{subs: make(map[chan Event]struct{})}
+}
+
+// Publish sends e to all current subscribers.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default: // subscriber is behind; drop rather than stall the server
+		}
+	}
+}
+
+// Subscribe returns a channel of future events and a function that
+// unsubscribes and closes the channel.
+func (b *Bus) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestPublishSubscribe(t *testing.T) {
+	b := NewBus()
+	ch, cancel := b.Subscribe()
+	defer cancel()
+
+	b.Publish(Event{Type: ToolCall, Message: "store_chunk"})
+
+	e := <-ch
+	if e.Type != ToolCall || e.Message != "store_chunk" {
+		t.Errorf("event = %+v", e)
+	}
+	if e.Time.IsZero() {
+		t.Error("Time not set")
+	}
+}
+
+func TestPublishDoesNotBlock(t *testing.T) {
+	b := NewBus()
+	ch, cancel := b.Subscribe()
+	defer cancel()
+
+	for i := 0; i < subscriberBuffer*2; i++ {
+		b.Publish(Event{Type: Auth})
+	}
+	if len(ch) != subscriberBuffer {
+		t.Errorf("buffered = %d, want %d", len(ch), subscriberBuffer)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	b := NewBus()
+	ch, cancel := b.Subscribe()
+	cancel()
+	cancel() // idempotent
+
+	b.Publish(Event{Type: Error})
+	if _, ok := <-ch; ok {
+		t.Error("channel should be closed")
+	}
+}
+
+func TestNilBus(t *testing.T) {
+	var b *Bus
+	b.Publish(Event{Type: Error}) // must not panic
+}
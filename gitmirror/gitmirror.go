@@ -0,0 +1,223 @@
+// Package gitmirror keeps a copy of the knowledge base as files in a git
+// repository, committing every change, for history, diffs and offsite
+// pushes with plain git.
+package gitmirror
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ChunkDir is the repository directory holding one file per chunk.
+const ChunkDir = "chunks"
+
+// Committer identity used when git has none configured.
+const (
+	defaultName  = "mykb"
+	defaultEmail = "mykb@localhost"
+)
+
+// ErrNotRepository is returned by Open for a directory that `mykb git init`
+// has not set up.
+var ErrNotRepository = errors.New("not a git repository (run mykb git init)")
+
+// Config enables the git mirror.
+type Config struct {
+	// Dir is the repository's working tree; the mirror is off when empty.
+	Dir string `toml:"dir"`
+	// Path is the git binary (default "git" from $PATH).
+	Path string `toml:"path"`
+	// Push runs `git push` after each commit, to the branch's upstream.
+	Push bool `toml:"push"`
+}
+
+// Enabled reports whether chunks are mirrored.
+func (c Config) Enabled() bool {
+	return c.Dir != ""
+}
+
+func (c Config) path() string {
+	if c.Path != "" {
+		return c.Path
+	}
+	return "git"
+}
+
+// Repo is a mirror repository.
+type Repo struct {
+	dir  string
+	bin  string
+	push bool
+}
+
+// Init creates the repository if needed, with a committer identity when
+// git has none, and returns it.
+func Init(cfg Config) (*Repo, error) {
+	r, err := newRepo(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(r.dir, ChunkDir), 0700); err != nil {
+		return nil, err
+	}
+	if _, err := r.git("init", "--quiet"); err != nil {
+		return nil, err
+	}
+	if _, err := r.git("config", "user.email"); err != nil {
+		if _, err := r.git("config", "user.name", defaultName); err != nil {
+			return nil, err
+		}
+		if _, err := r.git("config", "user.email", defaultEmail); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Open returns the repository set up by Init.
+func Open(cfg Config) (*Repo, error) {
+	r, err := newRepo(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(r.dir, ".git")); err != nil {
+		return nil, ErrNotRepository
+	}
+	return r, nil
+}
+
+func newRepo(cfg Config) (*Repo, error) {
+	bin, err := exec.LookPath(cfg.path())
+	if err != nil {
+		return nil, fmt.Errorf("git: %w", err)
+	}
+	dir, err := filepath.Abs(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Repo{dir: dir, bin: bin, push: cfg.Push}, nil
+}
+
+// Dir returns the repository's working tree.
+func (r *Repo) Dir() string {
+	return r.dir
+}
+
+// chunkPath returns the file mirroring a chunk. Files are named by ID so a
+// chunk keeps its history when its content changes.
+func (r *Repo) chunkPath(id string) string {
+	return filepath.Join(r.dir, ChunkDir, id+".md")
+}
+
+// ReadChunk returns a chunk's file, or nil if it has none.
+func (r *Repo) ReadChunk(id string) ([]byte, error) {
+	data, err := os.ReadFile(r.chunkPath(id))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// WriteChunk writes a chunk's file.
+func (r *Repo) WriteChunk(id string, data []byte) error {
+	return os.WriteFile(r.chunkPath(id), data, 0600)
+}
+
+// RemoveChunk removes a chunk's file, if any.
+func (r *Repo) RemoveChunk(id string) error {
+	if err := os.Remove(r.chunkPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ChunkIDs returns the IDs of the chunks with files.
+func (r *Repo) ChunkIDs() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(r.dir, ChunkDir))
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if id, ok := strings.CutSuffix(e.Name(), ".md"); ok && !e.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// Commit commits every change under the chunk directory, then pushes if
+// configured. It reports false, committing nothing, when there were no
+// changes.
+func (r *Repo) Commit(message string) (bool, error) {
+	if _, err := r.git("add", "--all", "--", ChunkDir); err != nil {
+		return false, err
+	}
+	changes, err := r.git("status", "--porcelain", "--", ChunkDir)
+	if err != nil || len(changes) == 0 {
+		return false, err
+	}
+	if _, err := r.git("commit", "--quiet", "--no-verify", "-m", message, "--", ChunkDir); err != nil {
+		return false, err
+	}
+	if r.push {
+		if _, err := r.git("push", "--quiet"); err != nil {
+			return true, fmt.Errorf("committed, but %w", err)
+		}
+	}
+	return true, nil
+}
+
+// Status describes the repository.
+type Status struct {
+	Dir string `json:"dir"`
+	// Head is the last commit, as `<short hash> <subject>`; empty before
+	// the first one.
+	Head string `json:"head,omitempty"`
+	// Commits counts the commits on the current branch.
+	Commits int `json:"commits"`
+	// Uncommitted lists files changed since the last commit, in
+	// `git status --short` form.
+	Uncommitted []string `json:"uncommitted,omitempty"`
+}
+
+// Status reports the last commit and any uncommitted changes.
+func (r *Repo) Status() (*Status, error) {
+	st := &Status{Dir: r.dir}
+	if out, err := r.git("log", "-1", "--format=%h %s"); err == nil {
+		st.Head = strings.TrimSpace(string(out))
+		if out, err := r.git("rev-list", "--count", "HEAD"); err == nil {
+			fmt.Sscan(string(out), &st.Commits)
+		}
+	}
+	out, err := r.git("status", "--short")
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+		if line != "" {
+			st.Uncommitted = append(st.Uncommitted, line)
+		}
+	}
+	return st, nil
+}
+
+// git runs a git command in the repository and returns its output.
+func (r *Repo) git(args ...string) ([]byte, error) {
+	cmd := exec.Command(r.bin, append([]string{"-C", r.dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return out, nil
+}
@@ -0,0 +1,70 @@
+package gitmirror
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func setupRepo(t *testing.T) *Repo {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	r, err := Init(Config{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	return r
+}
+
+func TestRepo(t *testing.T) {
+	r := setupRepo(t)
+
+	st, err := r.Status()
+	if err != nil || st.Head != "" || st.Commits != 0 {
+		t.Fatalf("Status of new repo = %+v, %v", st, err)
+	}
+	if ok, err := r.Commit("nothing"); err != nil || ok {
+		t.Errorf("Commit without changes = %v, %v", ok, err)
+	}
+
+	r.WriteChunk("a", []byte("first\n"))
+	r.WriteChunk("b", []byte("second\n"))
+	if ok, err := r.Commit("Add two"); err != nil || !ok {
+		t.Fatalf("Commit = %v, %v", ok, err)
+	}
+	if data, _ := r.ReadChunk("a"); string(data) != "first\n" {
+		t.Errorf("ReadChunk = %q", data)
+	}
+	if data, err := r.ReadChunk("missing"); data != nil || err != nil {
+		t.Errorf("ReadChunk(missing) = %q, %v", data, err)
+	}
+
+	r.RemoveChunk("a")
+	r.WriteChunk("c", []byte("third\n"))
+	st, _ = r.Status()
+	if len(st.Uncommitted) != 2 {
+		t.Errorf("Uncommitted = %v, want 2 entries", st.Uncommitted)
+	}
+	r.Commit("Replace a with c\n\nChunk: c\n")
+	st, err = r.Status()
+	if err != nil || st.Commits != 2 || len(st.Uncommitted) != 0 {
+		t.Errorf("Status = %+v, %v", st, err)
+	}
+	if ids, _ := r.ChunkIDs(); len(ids) != 2 || ids[0] != "b" || ids[1] != "c" {
+		t.Errorf("ChunkIDs = %v", ids)
+	}
+	if err := r.RemoveChunk("missing"); err != nil {
+		t.Errorf("RemoveChunk(missing): %v", err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	r := setupRepo(t)
+	if _, err := Open(Config{Dir: r.Dir()}); err != nil {
+		t.Errorf("Open: %v", err)
+	}
+	if _, err := Open(Config{Dir: t.TempDir()}); err != ErrNotRepository {
+		t.Errorf("Open of plain directory err = %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+// Package graph scores chunks by their place in the link graph.
+package graph
+
+import "math"
+
+const (
+	// Damping is the probability of following a link rather than jumping
+	// to a random chunk.
+	Damping = 0.85
+
+	maxIterations = 100
+	tolerance     = 1e-9
+)
+
+// PageRank scores each node by the PageRank of the graph where links maps
+// a node to the nodes it links to. Scores sum to 1. Links to nodes missing
+// from nodes are ignored; nodes without outgoing links spread their score
+// evenly across the graph.
+func PageRank(nodes []string, links map[string][]string) map[string]float64 {
+	n := len(nodes)
+	if n == 0 {
+		return map[string]float64{}
+	}
+
+	index := make(map[string]int, n)
+	for i, id := range nodes {
+		index[id] = i
+	}
+	out := make([][]int, n)
+	for src, targets := range links {
+		i, ok := index[src]
+		if !ok {
+			continue
+		}
+		for _, dst := range targets {
+			if j, ok := index[dst]; ok && j != i {
+				out[i] = append(out[i], j)
+			}
+		}
+	}
+
+	rank := make([]float64, n)
+	next := make([]float64, n)
+	for i := range rank {
+		rank[i] = 1 / float64(n)
+	}
+	for iter := 0; iter < maxIterations; iter++ {
+		dangling := 0.0
+		for i := range next {
+			next[i] = 0
+		}
+		for i, targets := range out {
+			if len(targets) == 0 {
+				dangling += rank[i]
+				continue
+			}
+			share := rank[i] / float64(len(targets))
+			for _, j := range targets {
+				next[j] += share
+			}
+		}
+
+		base := (1-Damping)/float64(n) + Damping*dangling/float64(n)
+		delta := 0.0
+		for i := range next {
+			next[i] = base + Damping*next[i]
+			delta += math.Abs(next[i] - rank[i])
+		}
+		rank, next = next, rank
+		if delta < tolerance {
+			break
+		}
+	}
+
+	scores := make(map[string]float64, n)
+	for i, id := range nodes {
+		scores[id] = rank[i]
+	}
+	return scores
+}
@@ -0,0 +1,43 @@
+package graph
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPageRank(t *testing.T) {
+	nodes := []string{"hub", "a", "b", "c", "lonely"}
+	links := map[string][]string{
+		"a":   {"hub", "missing"},
+		"b":   {"hub"},
+		"c":   {"hub", "a", "c"}, // self-links are ignored
+		"hub": {"a"},
+	}
+	scores := PageRank(nodes, links)
+
+	sum := 0.0
+	for _, s := range scores {
+		sum += s
+	}
+	if math.Abs(sum-1) > 1e-6 {
+		t.Errorf("scores sum to %f, want 1", sum)
+	}
+	for _, id := range nodes[1:] {
+		if scores["hub"] <= scores[id] {
+			t.Errorf("hub = %f, not above %s = %f", scores["hub"], id, scores[id])
+		}
+	}
+	if scores["a"] <= scores["b"] {
+		t.Errorf("a = %f should outrank unlinked b = %f", scores["a"], scores["b"])
+	}
+	if math.Abs(scores["b"]-scores["lonely"]) > 1e-9 {
+		t.Errorf("nodes without backlinks differ: b = %f, lonely = %f", scores["b"], scores["lonely"])
+	}
+	if _, ok := scores["missing"]; ok {
+		t.Error("links to unknown nodes should not add nodes")
+	}
+
+	if got := PageRank(nil, nil); len(got) != 0 {
+		t.Errorf("empty graph = %v", got)
+	}
+}
@@ -0,0 +1,252 @@
+package httpd
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neoden/mykb/backup"
+	"github.com/neoden/mykb/events"
+	"github.com/neoden/mykb/storage"
+)
+
+// eventsPingInterval keeps idle event streams alive through proxies.
+const eventsPingInterval = 30 * time.Second
+
+// requireAdmin accepts the local admin token, falling back to regular
+// Bearer authentication so OAuth clients can use admin endpoints too;
+// their child tokens cannot.
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	authed := s.requireAuth(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if s.config.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.config.AdminToken)) == 1 {
+			next(w, r)
+			return
+		}
+		authed(w, r)
+	}
+}
+
+// requireAdminToken accepts only the local admin token, for actions kept
+// out of reach of OAuth clients, such as unlocking chunks.
+func (s *Server) requireAdminToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if s.config.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.config.AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mykb"`)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "admin token required"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleChunkLock locks or unlocks a chunk against changes by clients.
+func (s *Server) handleChunkLock(locked bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		err := s.db.SetChunkLocked(r.Context(), id, locked)
+		if errors.Is(err, storage.ErrChunkNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			log.Printf("Chunk lock: %v", err)
+			writeError(w, http.StatusInternalServerError, "failed to set chunk lock")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"chunk_id": id, "locked": locked})
+	}
+}
+
+// handleAdminEvents streams activity events as Server-Sent Events.
+func (s *Server) handleAdminEvents(w http.ResponseWriter, r *http.Request) {
+	s.streamEvents(w, r, func(events.Event) bool { return true })
+}
+
+// handleEvents streams chunk created/updated/deleted events as Server-Sent
+// Events, so clients can follow the knowledge base without polling. Events
+// are not replayed: a client that reconnects, or falls behind, should
+// re-read what it needs.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	s.streamEvents(w, r, func(e events.Event) bool { return e.Type.IsChunk() })
+}
+
+// streamEvents writes the events accepted by keep to w until the client
+// disconnects.
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request, keep func(events.Event) bool) {
+	rc := http.NewResponseController(w)
+	// The stream outlives the server's write timeout
+	rc.SetWriteDeadline(time.Time{})
+
+	ch, cancel := s.config.Events.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	ping := time.NewTicker(eventsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ping.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if !keep(e) {
+				continue
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// Admin stats history bounds, in days.
+const (
+	defaultStatsDays = 30
+	maxStatsDays     = 3650
+)
+
+// handleAdminStats returns the daily storage snapshots of the last ?days
+// days (default 30), oldest first.
+func (s *Server) handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	days := defaultStatsDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "days must be a positive integer")
+			return
+		}
+		days = min(n, maxStatsDays)
+	}
+	history, err := s.db.StatsHistory(r.Context(), days)
+	if err != nil {
+		log.Printf("Stats history: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to read stats")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"history": history})
+}
+
+// maxUsageLimit bounds each list of the admin usage report.
+const maxUsageLimit = 1000
+
+// handleAdminUsage reports the ?limit (default 20) most and least used
+// chunks.
+func (s *Server) handleAdminUsage(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, maxUsageLimit)
+	}
+	report, err := s.db.UsageReport(r.Context(), limit)
+	if err != nil {
+		log.Printf("Usage report: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to read usage")
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// BackupUploader copies a finished backup file to remote storage.
+type BackupUploader interface {
+	Upload(ctx context.Context, path string) (key string, err error)
+}
+
+// handleBackupDownload streams a fresh backup of the database.
+func (s *Server) handleBackupDownload(w http.ResponseWriter, r *http.Request) {
+	dir, err := os.MkdirTemp("", "mykb-backup-")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create backup")
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	name := backup.FileName(time.Now())
+	path := filepath.Join(dir, name)
+	if err := s.db.Backup(r.Context(), path); err != nil {
+		log.Printf("Backup failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "backup failed")
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "backup failed")
+		return
+	}
+	defer f.Close()
+
+	// Large databases take longer than the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	if fi, err := f.Stat(); err == nil {
+		w.Header().Set("Content-Length", fmt.Sprint(fi.Size()))
+	}
+	io.Copy(w, f)
+}
+
+// handleBackupCreate writes a backup into the configured backup directory
+// and uploads it when remote backups are configured.
+func (s *Server) handleBackupCreate(w http.ResponseWriter, r *http.Request) {
+	if err := os.MkdirAll(s.config.BackupDir, 0700); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create backup directory")
+		return
+	}
+	path := filepath.Join(s.config.BackupDir, backup.FileName(time.Now()))
+	if err := s.db.Backup(r.Context(), path); err != nil {
+		log.Printf("Backup failed: %v", err)
+		s.config.Events.Publish(events.Event{Type: events.Error, Message: "backup failed: " + err.Error()})
+		writeError(w, http.StatusInternalServerError, "backup failed")
+		return
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "backup failed")
+		return
+	}
+	log.Printf("Backup written: %s", path)
+	resp := map[string]any{"path": path, "bytes": fi.Size()}
+
+	if s.config.BackupUploader != nil {
+		key, err := s.config.BackupUploader.Upload(r.Context(), path)
+		if err != nil {
+			log.Printf("Backup upload failed: %v", err)
+			s.config.Events.Publish(events.Event{Type: events.Error, Message: "backup upload failed: " + err.Error()})
+			writeError(w, http.StatusBadGateway, "backup written but upload failed")
+			return
+		}
+		log.Printf("Backup uploaded: %s", key)
+		resp["remote"] = key
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,494 @@
+package httpd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neoden/mykb/events"
+	"github.com/neoden/mykb/mcp"
+	"github.com/neoden/mykb/storage"
+	"github.com/neoden/mykb/vector"
+)
+
+func setupAdminServer(t *testing.T) *Server {
+	t.Helper()
+	db, err := storage.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	config := DefaultConfig()
+	config.BaseURL = "http://localhost:8080"
+	config.Events = events.NewBus()
+	config.AdminToken = "admin-secret"
+	config.BackupDir = filepath.Join(t.TempDir(), "backups")
+
+	mcpServer := mcp.NewServer(db, nil, vector.NewIndex())
+	return NewServer(db, mcpServer, config)
+}
+
+func TestAdminEventsRequiresAuth(t *testing.T) {
+	server := setupAdminServer(t)
+
+	for _, token := range []string{"", "wrong"} {
+		req := httptest.NewRequest("GET", "/admin/events", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: status = %d, want 401", token, w.Code)
+		}
+	}
+}
+
+func TestAdminEventsNotRegisteredWithoutBus(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	req := httptest.NewRequest("GET", "/admin/events", nil)
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+}
+
+func TestAdminEventsStream(t *testing.T) {
+	server := setupAdminServer(t)
+	ts := httptest.NewServer(server.mux)
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/admin/events", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	// Headers are flushed after subscribing, so this event is not missed
+	server.authFailed("invalid password from %s", "1.2.3.4")
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var e events.Event
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			t.Fatalf("decode event: %v", err)
+		}
+		if e.Type != events.Auth || !strings.Contains(e.Message, "invalid password from 1.2.3.4") {
+			t.Errorf("event = %+v", e)
+		}
+		return
+	}
+	t.Fatalf("stream ended without event: %v", scanner.Err())
+}
+
+func TestEventsStream(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	bus := events.NewBus()
+	mcpConfig := mcp.DefaultConfig()
+	mcpConfig.Events = bus
+	mcpServer := mcp.NewServerWithConfig(db, nil, vector.NewIndex(), mcpConfig)
+	config := DefaultConfig()
+	config.BaseURL = "http://localhost:8080"
+	config.Events = bus
+	server := NewServer(db, mcpServer, config)
+	ts := httptest.NewServer(server.mux)
+	defer ts.Close()
+
+	token := mustGenerateToken(t)
+	db.StoreToken(ctx, storage.HashToken(token), storage.TokenAccess, "client", time.Now().Add(time.Hour).Unix(), nil)
+
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/events", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated: status = %d, want 401", w.Code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/events", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	// Activity other than chunk changes is not streamed
+	server.authFailed("invalid password from %s", "1.2.3.4")
+	chunk, _, err := mcpServer.StoreChunk(ctx, "hello", nil)
+	if err != nil {
+		t.Fatalf("StoreChunk: %v", err)
+	}
+	mcpServer.DeleteChunks(ctx, []string{chunk.ID})
+
+	var got []string
+	scanner := bufio.NewScanner(resp.Body)
+	for len(got) < 2 && scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var e struct {
+			events.Event
+			Data *storage.Chunk `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			t.Fatalf("decode event: %v", err)
+		}
+		if e.Fields["id"] != chunk.ID {
+			t.Errorf("event = %+v", e)
+		}
+		if e.Type == events.ChunkCreated && (e.Data == nil || e.Data.Content != "hello") {
+			t.Errorf("created event data = %+v", e.Data)
+		}
+		got = append(got, string(e.Type))
+	}
+	if strings.Join(got, " ") != "chunk_created chunk_deleted" {
+		t.Errorf("events = %v (%v)", got, scanner.Err())
+	}
+}
+
+func TestAdminBackupDownload(t *testing.T) {
+	server := setupAdminServer(t)
+
+	req := httptest.NewRequest("GET", "/admin/backup", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if !strings.HasPrefix(w.Body.String(), "SQLite format 3") {
+		t.Error("body is not a SQLite database")
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, "attachment") {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+}
+
+func TestAdminBackupCreate(t *testing.T) {
+	server := setupAdminServer(t)
+
+	req := httptest.NewRequest("POST", "/admin/backup", nil)
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated status = %d, want 401", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/admin/backup", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Path string `json:"path"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if _, err := storage.CheckBackup(req.Context(), resp.Path, storage.Config{}); err != nil {
+		t.Errorf("CheckBackup(%q): %v", resp.Path, err)
+	}
+}
+
+func TestAdminStats(t *testing.T) {
+	ctx := context.Background()
+	server := setupAdminServer(t)
+	snap, err := server.db.TakeStats(ctx, "")
+	if err != nil {
+		t.Fatalf("TakeStats: %v", err)
+	}
+	server.db.RecordStats(ctx, snap)
+
+	req := httptest.NewRequest("GET", "/admin/stats?days=7", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		History []storage.StatsSnapshot `json:"history"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.History) != 1 || resp.History[0].Day != snap.Day {
+		t.Errorf("history = %+v", resp.History)
+	}
+
+	req = httptest.NewRequest("GET", "/admin/stats?days=-1", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("days=-1: status = %d, want 400", w.Code)
+	}
+}
+
+func TestAdminUsage(t *testing.T) {
+	ctx := context.Background()
+	server := setupAdminServer(t)
+	read, _ := server.db.CreateChunk(ctx, "read often", nil)
+	server.db.CreateChunk(ctx, "never read", nil)
+	server.db.RecordAccess(ctx, read.ID)
+
+	req := httptest.NewRequest("GET", "/admin/usage?limit=5", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var report storage.UsageReport
+	json.Unmarshal(w.Body.Bytes(), &report)
+	if len(report.MostAccessed) != 1 || report.MostAccessed[0].ID != read.ID || len(report.NeverTouched) != 1 {
+		t.Errorf("report = %+v", report)
+	}
+
+	req = httptest.NewRequest("GET", "/admin/usage?limit=x", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("limit=x: status = %d, want 400", w.Code)
+	}
+}
+
+// fakeMaintainer records reindex calls.
+type fakeMaintainer struct {
+	reindexed chan bool
+}
+
+func (m *fakeMaintainer) Stats(ctx context.Context) (*storage.StatsSnapshot, error) {
+	return &storage.StatsSnapshot{Chunks: 4, Embedded: 3, Model: "test-model"}, nil
+}
+
+func (m *fakeMaintainer) IndexSize() int { return 3 }
+
+func (m *fakeMaintainer) Reindex(ctx context.Context, force bool) error {
+	m.reindexed <- force
+	return nil
+}
+
+func adminRequest(t *testing.T, server *Server, method, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminDashboardPage(t *testing.T) {
+	server := setupAdminServer(t)
+
+	// The page is served without auth; its data is not
+	req := httptest.NewRequest("GET", "/admin", nil)
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/admin/status") {
+		t.Errorf("GET /admin: status = %d", w.Code)
+	}
+	req = httptest.NewRequest("GET", "/admin/status", nil)
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated status = %d, want 401", w.Code)
+	}
+}
+
+func TestAdminStatus(t *testing.T) {
+	ctx := context.Background()
+	server := setupAdminServer(t)
+	server.db.StoreToken(ctx, storage.HashToken("tok"), storage.TokenAccess, "claude", time.Now().Add(time.Hour).Unix(), nil)
+	server.config.Events.Publish(events.Event{Type: events.Error, Message: "backup failed: disk full"})
+	server.config.Events.Publish(events.Event{Type: events.Error, Message: "rate limited: search_chunks",
+		Fields: map[string]any{"retry_after_ms": 100}})
+	server.config.Events.Publish(events.Event{Type: events.ToolCall, Message: "search_chunks"})
+	server.Shutdown(context.Background()) // stops the recorder once it has seen the events
+
+	w := adminRequest(t, server, "GET", "/admin/status")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Sessions    []storage.TokenSession `json:"sessions"`
+		Errors      []events.Event         `json:"errors"`
+		RateLimited map[string]int         `json:"rate_limited"`
+		Actions     map[string]bool        `json:"actions"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Sessions) != 1 || resp.Sessions[0].ClientID != "claude" {
+		t.Errorf("sessions = %+v", resp.Sessions)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].Message != "backup failed: disk full" {
+		t.Errorf("errors = %+v", resp.Errors)
+	}
+	if resp.RateLimited["tools"] != 1 {
+		t.Errorf("rate_limited = %v", resp.RateLimited)
+	}
+	if resp.Actions["reindex"] || !resp.Actions["compact"] || !resp.Actions["backup"] {
+		t.Errorf("actions = %v", resp.Actions)
+	}
+}
+
+func TestAdminCompact(t *testing.T) {
+	server := setupAdminServer(t)
+
+	w := adminRequest(t, server, "POST", "/admin/compact")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		FileBytes int64 `json:"file_bytes"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.FileBytes == 0 {
+		t.Errorf("response = %s", w.Body.String())
+	}
+}
+
+func TestAdminReindex(t *testing.T) {
+	server := setupAdminServer(t)
+	if w := adminRequest(t, server, "POST", "/admin/reindex"); w.Code != http.StatusNotFound && w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("without maintainer: status = %d", w.Code)
+	}
+
+	m := &fakeMaintainer{reindexed: make(chan bool)}
+	config := *server.config
+	config.Maintainer = m
+	server = NewServer(server.db, server.mcp, &config)
+
+	w := adminRequest(t, server, "POST", "/admin/reindex?force=true")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	// The first reindex blocks on the channel, so a second one is refused
+	if w := adminRequest(t, server, "POST", "/admin/reindex"); w.Code != http.StatusConflict {
+		t.Errorf("concurrent reindex: status = %d, want 409", w.Code)
+	}
+	var status struct {
+		IndexSize  int  `json:"index_size"`
+		Reindexing bool `json:"reindexing"`
+	}
+	json.Unmarshal(adminRequest(t, server, "GET", "/admin/status").Body.Bytes(), &status)
+	if status.IndexSize != 3 || !status.Reindexing {
+		t.Errorf("status = %+v", status)
+	}
+	if force := <-m.reindexed; !force {
+		t.Error("force not passed to Reindex")
+	}
+}
+
+func TestAdminChunkLock(t *testing.T) {
+	ctx := context.Background()
+	server := setupAdminServer(t)
+	chunk, _ := server.db.CreateChunk(ctx, "reference", nil)
+	token := mustGenerateToken(t)
+	server.db.StoreToken(ctx, storage.HashToken(token), storage.TokenAccess, "client", time.Now().Add(time.Hour).Unix(), nil)
+
+	do := func(bearer, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("admin-secret", "/admin/chunks/"+chunk.ID+"/lock"); w.Code != http.StatusOK {
+		t.Fatalf("lock: status = %d: %s", w.Code, w.Body.String())
+	}
+	if locked, _ := server.db.ChunkLocked(ctx, chunk.ID); !locked {
+		t.Error("chunk not locked")
+	}
+	// A client's own token cannot lift the lock
+	if w := do(token, "/admin/chunks/"+chunk.ID+"/unlock"); w.Code != http.StatusUnauthorized {
+		t.Errorf("unlock with an OAuth token: status = %d, want 401", w.Code)
+	}
+	if w := do("admin-secret", "/admin/chunks/missing/unlock"); w.Code != http.StatusNotFound {
+		t.Errorf("unlock missing chunk: status = %d, want 404", w.Code)
+	}
+	if w := do("admin-secret", "/admin/chunks/"+chunk.ID+"/unlock"); w.Code != http.StatusOK {
+		t.Errorf("unlock: status = %d: %s", w.Code, w.Body.String())
+	}
+	if locked, _ := server.db.ChunkLocked(ctx, chunk.ID); locked {
+		t.Error("chunk still locked")
+	}
+}
+
+func TestSyncPushLockedChunk(t *testing.T) {
+	ctx := context.Background()
+	server := setupAdminServer(t)
+	locked, _ := server.db.CreateChunk(ctx, "reference", nil)
+	other, _ := server.db.CreateChunk(ctx, "scratch", nil)
+	server.db.SetChunkLocked(ctx, locked.ID, true)
+
+	push := func(changes SyncChanges) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(changes)
+		req := httptest.NewRequest("POST", "/sync/changes", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	overwrite := *locked
+	overwrite.Content = "overwritten"
+	if w := push(SyncChanges{Chunks: []storage.Chunk{overwrite}}); w.Code != http.StatusForbidden {
+		t.Errorf("push over a locked chunk: status = %d, want 403", w.Code)
+	}
+	// Nothing of a refused push is applied
+	if w := push(SyncChanges{Tombstones: []storage.Tombstone{{ChunkID: other.ID}, {ChunkID: locked.ID}}}); w.Code != http.StatusForbidden {
+		t.Errorf("push deleting a locked chunk: status = %d, want 403", w.Code)
+	}
+	if got, err := server.db.GetChunk(ctx, locked.ID); err != nil || got.Content != "reference" {
+		t.Errorf("locked chunk = %v, %v", got, err)
+	}
+	if _, err := server.db.GetChunk(ctx, other.ID); err != nil {
+		t.Errorf("unlocked chunk of a refused push: %v", err)
+	}
+}
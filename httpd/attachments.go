@@ -0,0 +1,134 @@
+package httpd
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/neoden/mykb/ingest"
+	"github.com/neoden/mykb/mcp"
+	"github.com/neoden/mykb/storage"
+)
+
+// handleAttachmentUpload stores the request body as an attachment of the
+// chunk, named by ?name and typed by the Content-Type header.
+func (s *Server) handleAttachmentUpload(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	} else if _, _, err := mime.ParseMediaType(contentType); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid Content-Type")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxAttachmentSize)
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, "attachment too large")
+		return
+	}
+	a, err := s.mcp.AddAttachment(r.Context(), r.PathValue("id"), name, contentType, data)
+	if err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, a)
+}
+
+// handleAudioIngest transcribes the request body, a recording named by
+// ?name, and stores the transcript as chunks with the recording attached.
+func (s *Server) handleAudioIngest(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = ingest.AudioType(name)
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || !strings.HasPrefix(mediaType, "audio/") {
+		writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be an audio type")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxAttachmentSize)
+	audio, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, "recording too large")
+		return
+	}
+	res, err := s.mcp.IngestAudio(r.Context(), name, contentType, audio, nil)
+	switch {
+	case errors.Is(err, mcp.ErrNoTranscriber):
+		writeError(w, http.StatusNotImplemented, err.Error())
+		return
+	case errors.Is(err, mcp.ErrNotAllowed), errors.Is(err, mcp.ErrReadOnly):
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	case err != nil:
+		log.Printf("Audio ingest: %v", err)
+		writeError(w, http.StatusBadGateway, "failed to transcribe recording")
+		return
+	}
+	writeJSON(w, http.StatusCreated, res)
+}
+
+// handleChunkAttachments lists the attachments of a chunk.
+func (s *Server) handleChunkAttachments(w http.ResponseWriter, r *http.Request) {
+	attachments, err := s.mcp.ChunkAttachments(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"attachments": attachments})
+}
+
+// handleAttachmentDownload serves an attachment's data.
+func (s *Server) handleAttachmentDownload(w http.ResponseWriter, r *http.Request) {
+	a, data, err := s.mcp.Attachment(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", a.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(data)
+}
+
+// handleAttachmentDelete deletes an attachment.
+func (s *Server) handleAttachmentDelete(w http.ResponseWriter, r *http.Request) {
+	deleted, err := s.mcp.DeleteAttachment(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+	if !deleted {
+		writeError(w, http.StatusNotFound, storage.ErrAttachmentNotFound.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeAttachmentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrChunkNotFound), errors.Is(err, storage.ErrAttachmentNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, mcp.ErrNotAllowed), errors.Is(err, mcp.ErrReadOnly), errors.Is(err, mcp.ErrPermissionDenied):
+		writeError(w, http.StatusForbidden, err.Error())
+	default:
+		log.Printf("Attachment: %v", err)
+		writeError(w, http.StatusInternalServerError, "attachment request failed")
+	}
+}
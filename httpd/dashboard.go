@@ -0,0 +1,365 @@
+package httpd
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/neoden/mykb/events"
+	"github.com/neoden/mykb/storage"
+)
+
+// maxRecentErrors bounds the errors the admin dashboard lists.
+const maxRecentErrors = 20
+
+// Maintainer measures the knowledge base and rebuilds its embeddings for
+// the admin dashboard.
+type Maintainer interface {
+	Stats(ctx context.Context) (*storage.StatsSnapshot, error)
+	// IndexSize is the number of vectors in the in-memory search index.
+	IndexSize() int
+	Reindex(ctx context.Context, force bool) error
+}
+
+// activity keeps what the admin dashboard shows of the event feed: the
+// latest errors and how many tool calls were rate limited.
+type activity struct {
+	mu          sync.Mutex
+	errors      []events.Event // oldest first
+	rateLimited int
+}
+
+// watch records events from bus until the returned function is called.
+func (a *activity) watch(bus *events.Bus) func() {
+	ch, unsubscribe := bus.Subscribe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for e := range ch {
+			if e.Type == events.Error {
+				a.record(e)
+			}
+		}
+	}()
+	return func() {
+		unsubscribe()
+		<-done
+	}
+}
+
+func (a *activity) record(e events.Event) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// mcp reports rate-limited tool calls as errors; count them instead of
+	// letting a busy client push real errors out
+	if _, ok := e.Fields["retry_after_ms"]; ok {
+		a.rateLimited++
+		return
+	}
+	if len(a.errors) == maxRecentErrors {
+		a.errors = a.errors[1:]
+	}
+	a.errors = append(a.errors, e)
+}
+
+// snapshot returns the recorded errors, newest first, and the rate-limited
+// tool call count.
+func (a *activity) snapshot() ([]events.Event, int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	errs := make([]events.Event, len(a.errors))
+	for i, e := range a.errors {
+		errs[len(errs)-1-i] = e
+	}
+	return errs, a.rateLimited
+}
+
+// handleDashboard serves the admin dashboard. The page holds no data: it
+// asks for the admin token and calls the /admin endpoints with it.
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Write([]byte(dashboardPage))
+}
+
+// handleAdminStatus reports the live state shown on the admin dashboard.
+func (s *Server) handleAdminStatus(w http.ResponseWriter, r *http.Request) {
+	var stats *storage.StatsSnapshot
+	var err error
+	if s.config.Maintainer != nil {
+		stats, err = s.config.Maintainer.Stats(r.Context())
+	} else {
+		stats, err = s.db.TakeStats(r.Context(), "")
+	}
+	if err != nil {
+		log.Printf("Admin status: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to read stats")
+		return
+	}
+	space, err := s.db.SpaceReport(r.Context())
+	if err != nil {
+		log.Printf("Admin status: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to read stats")
+		return
+	}
+	sessions, err := s.db.TokenSessions(r.Context())
+	if err != nil {
+		log.Printf("Admin status: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to read sessions")
+		return
+	}
+
+	rateLimited := map[string]int64{"http": s.rateLimiter.Rejected()}
+	resp := map[string]any{
+		"chunks":            stats.Chunks,
+		"embedded":          stats.Embedded,
+		"coverage":          stats.Coverage(),
+		"model":             stats.Model,
+		"db_bytes":          stats.DBBytes,
+		"reclaimable_bytes": space.ReclaimableBytes,
+		"sessions":          sessions,
+		"rate_limited":      rateLimited,
+		"read_only":         s.config.ReadOnly,
+		"actions": map[string]bool{
+			"reindex": s.config.Maintainer != nil && !s.config.ReadOnly,
+			"compact": !s.config.ReadOnly,
+			"backup":  s.config.BackupDir != "",
+		},
+	}
+	if s.config.Maintainer != nil {
+		resp["index_size"] = s.config.Maintainer.IndexSize()
+		resp["reindexing"] = s.reindexing.Load()
+	}
+	if s.config.Events != nil {
+		errs, limited := s.activity.snapshot()
+		resp["errors"] = errs
+		rateLimited["tools"] = int64(limited)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleAdminCompact returns the database's free pages to the filesystem.
+func (s *Server) handleAdminCompact(w http.ResponseWriter, r *http.Request) {
+	before, err := s.db.SpaceReport(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to read space report")
+		return
+	}
+	if before.FreePages > 0 {
+		if !before.Incremental {
+			writeError(w, http.StatusConflict, "auto_vacuum is not INCREMENTAL; run VACUUM manually")
+			return
+		}
+		if err := s.db.IncrementalVacuum(r.Context(), 0); err != nil {
+			log.Printf("Compact failed: %v", err)
+			s.config.Events.Publish(events.Event{Type: events.Error, Message: "compact failed: " + err.Error()})
+			writeError(w, http.StatusInternalServerError, "compact failed")
+			return
+		}
+	}
+	after, err := s.db.SpaceReport(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to read space report")
+		return
+	}
+	log.Printf("Compacted database: reclaimed %d bytes", before.FileBytes-after.FileBytes)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"reclaimed_bytes": before.FileBytes - after.FileBytes,
+		"file_bytes":      after.FileBytes,
+	})
+}
+
+// handleAdminReindex starts embedding the chunks that lack an embedding,
+// or every chunk with ?force=true, in the background. Progress shows on
+// the dashboard and failures in its error list.
+func (s *Server) handleAdminReindex(w http.ResponseWriter, r *http.Request) {
+	force := r.URL.Query().Get("force") == "true"
+	if !s.reindexing.CompareAndSwap(false, true) {
+		writeError(w, http.StatusConflict, "reindex already running")
+		return
+	}
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		defer s.reindexing.Store(false)
+		if err := s.config.Maintainer.Reindex(s.ctx, force); err != nil {
+			log.Printf("Reindex failed: %v", err)
+			s.config.Events.Publish(events.Event{Type: events.Error, Message: "reindex failed: " + err.Error()})
+		}
+	}()
+	writeJSON(w, http.StatusAccepted, map[string]any{"status": "started", "force": force})
+}
+
+const dashboardPage = `<!DOCTYPE html>
+<html>
+<head>
+    <title>Admin - MyKB</title>
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <style>
+        body { font-family: system-ui, sans-serif; max-width: 800px; margin: 50px auto; padding: 20px; }
+        h1 { font-size: 1.5em; }
+        h2 { font-size: 1.1em; margin-top: 30px; }
+        form, .actions { display: flex; gap: 10px; }
+        input { flex: 1; padding: 10px; font-size: 16px; border: 1px solid #ccc; border-radius: 4px; }
+        button { padding: 10px 16px; font-size: 16px; background: #007bff; color: white; border: none; border-radius: 4px; cursor: pointer; }
+        button:hover { background: #0056b3; }
+        button:disabled { background: #ccc; cursor: default; }
+        table { width: 100%; border-collapse: collapse; }
+        td, th { text-align: left; padding: 6px 8px; border-bottom: 1px solid #eee; }
+        .info { color: #666; font-size: 0.9em; }
+        .stats { display: grid; grid-template-columns: repeat(auto-fill, minmax(170px, 1fr)); gap: 10px; }
+        .stat { padding: 12px; border: 1px solid #eee; border-radius: 4px; }
+        .stat b { display: block; font-size: 1.4em; }
+        .error { color: #c00; }
+        [hidden] { display: none; }
+    </style>
+</head>
+<body>
+    <h1>MyKB Admin</h1>
+    <form id="login" hidden>
+        <input type="password" id="token" placeholder="Admin token" required autofocus>
+        <button type="submit">Open</button>
+    </form>
+    <p class="info" id="message"></p>
+    <div id="dashboard" hidden>
+        <div class="stats" id="stats"></div>
+        <h2>Maintenance</h2>
+        <div class="actions">
+            <button data-action="reindex">Reindex</button>
+            <button data-action="compact">Compact</button>
+            <button data-action="backup">Backup</button>
+        </div>
+        <h2>Token sessions</h2>
+        <table id="sessions"></table>
+        <h2>Recent errors</h2>
+        <table id="errors"></table>
+    </div>
+    <script>
+    (function () {
+        var token = sessionStorage.getItem("mykb-admin-token");
+        var status = null;
+        var $ = function (id) { return document.getElementById(id); };
+
+        function api(method, path) {
+            return fetch(path, { method: method, headers: { "Authorization": "Bearer " + token } })
+                .then(function (r) {
+                    return r.json().then(function (body) {
+                        if (r.status === 401) { logout(); }
+                        if (!r.ok) { throw new Error(body.error || r.statusText); }
+                        return body;
+                    });
+                });
+        }
+
+        function bytes(n) {
+            var units = ["B", "KB", "MB", "GB", "TB"], i = 0;
+            while (n >= 1024 && i < units.length - 1) { n /= 1024; i++; }
+            return (i ? n.toFixed(1) : n) + " " + units[i];
+        }
+
+        function row(table, cells, head) {
+            var tr = table.insertRow();
+            cells.forEach(function (c) {
+                var cell = document.createElement(head ? "th" : "td");
+                cell.textContent = c;
+                tr.appendChild(cell);
+            });
+        }
+
+        function render(s) {
+            status = s;
+            var stats = $("stats");
+            stats.textContent = "";
+            [
+                ["Chunks", s.chunks],
+                ["Embedding coverage", (s.coverage * 100).toFixed(1) + "%"],
+                ["Index size", s.index_size === undefined ? "-" : s.index_size],
+                ["Database", bytes(s.db_bytes)],
+                ["Reclaimable", bytes(s.reclaimable_bytes)],
+                ["Rate-limited requests", s.rate_limited.http],
+                ["Rate-limited tool calls", s.rate_limited.tools === undefined ? "-" : s.rate_limited.tools]
+            ].forEach(function (st) {
+                var div = document.createElement("div"), b = document.createElement("b");
+                div.className = "stat";
+                b.textContent = st[1];
+                div.appendChild(b);
+                div.appendChild(document.createTextNode(st[0]));
+                stats.appendChild(div);
+            });
+
+            document.querySelectorAll("[data-action]").forEach(function (btn) {
+                var name = btn.dataset.action;
+                btn.disabled = !s.actions[name] || (name === "reindex" && s.reindexing);
+                btn.textContent = name === "reindex" && s.reindexing ? "Reindexing..." : name.charAt(0).toUpperCase() + name.slice(1);
+            });
+
+            var sessions = $("sessions");
+            sessions.textContent = "";
+            row(sessions, ["Client", "Access", "Refresh", "Expires"], true);
+            s.sessions.forEach(function (t) {
+                row(sessions, [t.client_id, t.access, t.refresh, new Date(t.expires_at).toLocaleString()]);
+            });
+
+            var errors = $("errors");
+            errors.textContent = "";
+            if (!s.errors || s.errors.length === 0) {
+                row(errors, [s.errors ? "No errors since the server started." : "The event feed is not enabled."]);
+            } else {
+                s.errors.forEach(function (e) {
+                    row(errors, [new Date(e.time).toLocaleString(), e.message]);
+                });
+            }
+        }
+
+        function refresh() {
+            return api("GET", "/admin/status").then(render).catch(show);
+        }
+
+        function show(msg) {
+            var m = $("message");
+            m.className = msg instanceof Error ? "info error" : "info";
+            m.textContent = msg instanceof Error ? msg.message : msg;
+        }
+
+        function logout() {
+            token = null;
+            sessionStorage.removeItem("mykb-admin-token");
+            $("dashboard").hidden = true;
+            $("login").hidden = false;
+        }
+
+        function open() {
+            $("login").hidden = true;
+            $("dashboard").hidden = false;
+            refresh();
+        }
+
+        $("login").addEventListener("submit", function (ev) {
+            ev.preventDefault();
+            token = $("token").value;
+            sessionStorage.setItem("mykb-admin-token", token);
+            show("");
+            open();
+        });
+
+        document.querySelectorAll("[data-action]").forEach(function (btn) {
+            btn.addEventListener("click", function () {
+                var name = btn.dataset.action;
+                btn.disabled = true;
+                show(name + "...");
+                api("POST", "/admin/" + name).then(function (r) {
+                    if (name === "compact") { show("Reclaimed " + bytes(r.reclaimed_bytes) + "."); }
+                    else if (name === "backup") { show("Backup written to " + r.path + (r.remote ? " and uploaded as " + r.remote : "") + "."); }
+                    else { show("Reindex started."); }
+                }).catch(show).then(refresh);
+            });
+        });
+
+        setInterval(function () { if (token) { refresh(); } }, 10000);
+        if (token) { open(); } else { logout(); }
+    })();
+    </script>
+</body>
+</html>
+`
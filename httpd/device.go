@@ -0,0 +1,354 @@
+package httpd
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"html"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neoden/mykb/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// deviceCodeGrantType is the grant_type for device code token requests (RFC 8628).
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// deviceCodeInterval is the minimum polling interval for device clients.
+const deviceCodeInterval = 5 * time.Second
+
+// userCodeAlphabet omits vowels and look-alike characters so codes are easy
+// to read off one screen and type into another.
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// Device code status values stored in token data.
+const (
+	deviceStatusPending  = "pending"
+	deviceStatusApproved = "approved"
+)
+
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// generateUserCode creates a short user code formatted as XXXX-XXXX.
+func generateUserCode() (string, error) {
+	b := make([]byte, 8)
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("crypto/rand failed: %w", err)
+		}
+		b[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(b[:4]) + "-" + string(b[4:]), nil
+}
+
+// normalizeUserCode makes user code input case- and separator-insensitive.
+func normalizeUserCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
+
+// allowsDeviceGrant reports whether a registration asks for the device code grant.
+func (c clientRegistration) allowsDeviceGrant() bool {
+	return slices.Contains(c.GrantTypes, deviceCodeGrantType)
+}
+
+// deviceClient reports whether clientID is a client registered for the
+// device code grant.
+func (s *Server) deviceClient(ctx context.Context, clientID string) bool {
+	client, err := s.db.GetClient(ctx, clientID)
+	return err == nil && slices.Contains(client.GrantTypes, deviceCodeGrantType)
+}
+
+func (s *Server) handleDeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxOAuthBodySize)
+
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid form")
+		return
+	}
+
+	clientID := r.FormValue("client_id")
+	client, err := s.db.GetClient(r.Context(), clientID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid client_id")
+		return
+	}
+	if !slices.Contains(client.GrantTypes, deviceCodeGrantType) {
+		writeError(w, http.StatusBadRequest, "unauthorized_client")
+		return
+	}
+
+	deviceCode, err := GenerateToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+	userCode, err := generateUserCode()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+
+	deviceHash := storage.HashToken(deviceCode)
+	expiry := time.Now().Add(s.config.DeviceCodeExpiry).Unix()
+	if err := s.db.StoreToken(r.Context(), deviceHash, storage.TokenDeviceCode, clientID, expiry, map[string]string{
+		"status": deviceStatusPending,
+	}); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to store token")
+		return
+	}
+	if err := s.db.StoreToken(r.Context(), storage.HashToken(normalizeUserCode(userCode)), storage.TokenUserCode, clientID, expiry, map[string]string{
+		"device_code": deviceHash,
+	}); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to store token")
+		return
+	}
+
+	verificationURI := s.config.BaseURL + "/device"
+	writeJSON(w, http.StatusOK, deviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(userCode),
+		ExpiresIn:               int(s.config.DeviceCodeExpiry.Seconds()),
+		Interval:                int(deviceCodeInterval.Seconds()),
+	})
+}
+
+func (s *Server) handleDeviceGet(w http.ResponseWriter, r *http.Request) {
+	csrfToken, err := GenerateToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+	csrfExpiry := time.Now().Add(5 * time.Minute).Unix()
+	s.db.StoreToken(r.Context(), storage.HashToken(csrfToken), storage.TokenCSRF, "", csrfExpiry, map[string]string{
+		"device": "true",
+	})
+
+	passwordField := devicePasswordField
+	if s.config.OIDC.Enabled() {
+		passwordField = ""
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, devicePage,
+		html.EscapeString(csrfToken),
+		html.EscapeString(r.URL.Query().Get("user_code")),
+		passwordField)
+}
+
+func (s *Server) handleDevicePost(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxOAuthBodySize)
+
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid form")
+		return
+	}
+
+	csrf, err := s.db.ConsumeToken(r.Context(), storage.HashToken(r.FormValue("csrf_token")), storage.TokenCSRF)
+	if err != nil || csrf == nil || csrf.Data["device"] != "true" {
+		writeError(w, http.StatusBadRequest, "invalid or expired CSRF token")
+		return
+	}
+
+	userCodeHash := storage.HashToken(normalizeUserCode(r.FormValue("user_code")))
+	userCode, err := s.db.ValidateToken(r.Context(), userCodeHash, storage.TokenUserCode)
+	if err != nil {
+		s.authFailed("invalid user code from %s", getIP(r))
+		writeError(w, http.StatusBadRequest, "invalid or expired user code")
+		return
+	}
+
+	// Delegate login to the identity provider; the callback approves the device
+	if s.config.OIDC.Enabled() {
+		state, err1 := GenerateToken()
+		nonce, err2 := GenerateToken()
+		verifier, err3 := GenerateToken()
+		if err1 != nil || err2 != nil || err3 != nil {
+			writeError(w, http.StatusInternalServerError, "failed to generate token")
+			return
+		}
+		stateExpiry := time.Now().Add(10 * time.Minute).Unix()
+		s.db.StoreToken(r.Context(), storage.HashToken(state), storage.TokenCSRF, userCode.ClientID, stateExpiry, map[string]string{
+			"client_id":        userCode.ClientID,
+			"device_user_code": userCodeHash,
+			"oidc_nonce":       nonce,
+			"oidc_verifier":    verifier,
+		})
+		s.redirectToOIDC(w, r, state, nonce, verifier)
+		return
+	}
+
+	storedHash, err := s.db.GetPasswordHash(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "password not configured")
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(r.FormValue("password"))); err != nil {
+		s.authFailed("invalid password from %s for device client %s", getIP(r), userCode.ClientID)
+		writeError(w, http.StatusUnauthorized, "invalid password")
+		return
+	}
+
+	s.approveDevice(r.Context(), w, userCodeHash)
+}
+
+// approveDevice marks the device code behind a user code as approved, so the
+// next poll from the device receives tokens.
+func (s *Server) approveDevice(ctx context.Context, w http.ResponseWriter, userCodeHash string) {
+	userCode, err := s.db.ConsumeToken(ctx, userCodeHash, storage.TokenUserCode)
+	if err != nil || userCode == nil {
+		writeError(w, http.StatusBadRequest, "invalid or expired user code")
+		return
+	}
+
+	deviceHash := userCode.Data["device_code"]
+	device, err := s.db.ValidateToken(ctx, deviceHash, storage.TokenDeviceCode)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid or expired user code")
+		return
+	}
+	device.Data["status"] = deviceStatusApproved
+	if err := s.db.StoreToken(ctx, deviceHash, storage.TokenDeviceCode, device.ClientID, device.ExpiresAt, device.Data); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to store token")
+		return
+	}
+
+	log.Printf("Device authorized for client %s", device.ClientID)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, deviceApprovedPage)
+}
+
+func (s *Server) handleTokenDeviceCode(w http.ResponseWriter, r *http.Request) {
+	deviceCode := r.FormValue("device_code")
+	clientID := r.FormValue("client_id")
+	if deviceCode == "" || clientID == "" {
+		writeError(w, http.StatusBadRequest, "missing required parameters")
+		return
+	}
+	if !s.deviceClient(r.Context(), clientID) {
+		writeError(w, http.StatusBadRequest, "unauthorized_client")
+		return
+	}
+
+	hash := storage.HashToken(deviceCode)
+	device, err := s.db.ValidateToken(r.Context(), hash, storage.TokenDeviceCode)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "expired_token")
+		return
+	}
+	if device.ClientID != clientID {
+		writeError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	if device.Data["status"] != deviceStatusApproved {
+		now := time.Now()
+		lastPoll, _ := strconv.ParseInt(device.Data["last_poll"], 10, 64)
+		device.Data["last_poll"] = strconv.FormatInt(now.Unix(), 10)
+		s.db.StoreToken(r.Context(), hash, storage.TokenDeviceCode, device.ClientID, device.ExpiresAt, device.Data)
+		if now.Sub(time.Unix(lastPoll, 0)) < deviceCodeInterval {
+			writeError(w, http.StatusBadRequest, "slow_down")
+			return
+		}
+		writeError(w, http.StatusBadRequest, "authorization_pending")
+		return
+	}
+
+	// Device codes are single-use once approved
+	if _, err := s.db.ConsumeToken(r.Context(), hash, storage.TokenDeviceCode); err != nil {
+		writeError(w, http.StatusBadRequest, "expired_token")
+		return
+	}
+
+	s.issueTokens(r.Context(), w, clientID)
+}
+
+// rateLimitToken applies the IP rate limit to the token endpoint, except for
+// device code polls: devices poll every deviceCodeInterval, which the IP
+// limiter would reject, so polls have a limiter of their own that allows a
+// few devices per address and answers slow_down (RFC 8628 section 3.5)
+// rather than 429.
+func (s *Server) rateLimitToken(next http.HandlerFunc) http.HandlerFunc {
+	limited := s.rateLimiter.RateLimit(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxOAuthBodySize)
+		if r.ParseForm() == nil && r.FormValue("grant_type") == deviceCodeGrantType {
+			if !s.pollLimiter.Allow(s.pollLimiter.clientIP(r)) {
+				writeError(w, http.StatusBadRequest, "slow_down")
+				return
+			}
+			next(w, r)
+			return
+		}
+		limited(w, r)
+	}
+}
+
+const devicePasswordField = `<input type="password" name="password" placeholder="Enter password" required>`
+
+const devicePage = `<!DOCTYPE html>
+<html>
+<head>
+    <title>Connect Device - MyKB</title>
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <style>
+        body { font-family: system-ui, sans-serif; max-width: 400px; margin: 50px auto; padding: 20px; }
+        h1 { font-size: 1.5em; }
+        form { display: flex; flex-direction: column; gap: 15px; }
+        input { padding: 10px; font-size: 16px; border: 1px solid #ccc; border-radius: 4px; }
+        button { padding: 12px; font-size: 16px; background: #007bff; color: white; border: none; border-radius: 4px; cursor: pointer; }
+        button:hover { background: #0056b3; }
+        .info { color: #666; font-size: 0.9em; }
+    </style>
+</head>
+<body>
+    <h1>Connect Device</h1>
+    <p class="info">Enter the code shown on your device to give it access to your MyKB data.</p>
+    <form method="POST" action="/device">
+        <input type="hidden" name="csrf_token" value="%s">
+        <input type="text" name="user_code" value="%s" placeholder="XXXX-XXXX" required autofocus autocomplete="off">
+        %s
+        <button type="submit">Authorize</button>
+    </form>
+</body>
+</html>`
+
+const deviceApprovedPage = `<!DOCTYPE html>
+<html>
+<head>
+    <title>Device Connected - MyKB</title>
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <style>
+        body { font-family: system-ui, sans-serif; max-width: 400px; margin: 50px auto; padding: 20px; }
+        h1 { font-size: 1.5em; }
+        .info { color: #666; font-size: 0.9em; }
+    </style>
+</head>
+<body>
+    <h1>Device Connected</h1>
+    <p class="info">You can close this window and return to your device.</p>
+</body>
+</html>`
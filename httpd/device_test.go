@@ -0,0 +1,224 @@
+package httpd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neoden/mykb/storage"
+)
+
+func postForm(t *testing.T, server *Server, path string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	return w
+}
+
+func requestDeviceCode(t *testing.T, server *Server, clientID string) deviceAuthorizationResponse {
+	t.Helper()
+	w := postForm(t, server, "/device_authorization", url.Values{"client_id": {clientID}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("device_authorization status = %d, body: %s", w.Code, w.Body.String())
+	}
+	var resp deviceAuthorizationResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	return resp
+}
+
+func pollDeviceToken(t *testing.T, server *Server, clientID, deviceCode string) *httptest.ResponseRecorder {
+	t.Helper()
+	return postForm(t, server, "/token", url.Values{
+		"grant_type":  {deviceCodeGrantType},
+		"device_code": {deviceCode},
+		"client_id":   {clientID},
+	})
+}
+
+func deviceCSRF(t *testing.T, server *Server) string {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/device", nil)
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	body := w.Body.String()
+	start := strings.Index(body, `name="csrf_token" value="`) + len(`name="csrf_token" value="`)
+	end := strings.Index(body[start:], `"`)
+	return body[start : start+end]
+}
+
+func TestGenerateUserCode(t *testing.T) {
+	code, err := generateUserCode()
+	if err != nil {
+		t.Fatalf("generateUserCode: %v", err)
+	}
+	if len(code) != 9 || code[4] != '-' {
+		t.Errorf("code = %q, want XXXX-XXXX", code)
+	}
+	if got := normalizeUserCode(strings.ToLower(code)); got != strings.ReplaceAll(code, "-", "") {
+		t.Errorf("normalizeUserCode = %q", got)
+	}
+}
+
+func TestDeviceAuthorizationInvalidClient(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	w := postForm(t, server, "/device_authorization", url.Values{"client_id": {"nope"}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestRegisterDeviceClientWithoutRedirectURIs(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	body := `{"client_name":"cli","grant_types":["urn:ietf:params:oauth:grant-type:device_code"]}`
+	req := httptest.NewRequest("POST", "/register", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("status = %d, want %d, body: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+}
+
+func TestDeviceFlow(t *testing.T) {
+	ctx := context.Background()
+	server, db := setupTestServer(t)
+	db.CreateClient(ctx, "device-client", "CLI", nil, []string{deviceCodeGrantType})
+
+	dev := requestDeviceCode(t, server, "device-client")
+	if dev.DeviceCode == "" || dev.UserCode == "" {
+		t.Fatalf("missing codes: %+v", dev)
+	}
+	if dev.VerificationURI != "http://localhost:8080/device" {
+		t.Errorf("verification_uri = %q", dev.VerificationURI)
+	}
+
+	// Pending until the user approves
+	w := pollDeviceToken(t, server, "device-client", dev.DeviceCode)
+	if !strings.Contains(w.Body.String(), "authorization_pending") {
+		t.Fatalf("poll before approval: %d %s", w.Code, w.Body.String())
+	}
+
+	// Polling faster than the interval is told to slow down
+	w = pollDeviceToken(t, server, "device-client", dev.DeviceCode)
+	if !strings.Contains(w.Body.String(), "slow_down") {
+		t.Errorf("fast poll: %d %s", w.Code, w.Body.String())
+	}
+
+	// Wrong password does not approve
+	w = postForm(t, server, "/device", url.Values{
+		"csrf_token": {deviceCSRF(t, server)},
+		"user_code":  {dev.UserCode},
+		"password":   {"wrong"},
+	})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong password status = %d", w.Code)
+	}
+
+	// User enters the code (case-insensitive, no dash) in the browser
+	w = postForm(t, server, "/device", url.Values{
+		"csrf_token": {deviceCSRF(t, server)},
+		"user_code":  {strings.ToLower(strings.ReplaceAll(dev.UserCode, "-", ""))},
+		"password":   {"testpass"},
+	})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Device Connected") {
+		t.Fatalf("approve status = %d, body: %s", w.Code, w.Body.String())
+	}
+
+	// Another client cannot redeem the code
+	w = pollDeviceToken(t, server, "other-client", dev.DeviceCode)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("other client status = %d", w.Code)
+	}
+
+	w = pollDeviceToken(t, server, "device-client", dev.DeviceCode)
+	if w.Code != http.StatusOK {
+		t.Fatalf("token status = %d, body: %s", w.Code, w.Body.String())
+	}
+	var tok tokenResponse
+	json.NewDecoder(w.Body).Decode(&tok)
+	if tok.AccessToken == "" || tok.RefreshToken == "" {
+		t.Errorf("missing tokens: %+v", tok)
+	}
+	if _, _, err := server.validateAccessToken(ctx, tok.AccessToken); err != nil {
+		t.Errorf("access token invalid: %v", err)
+	}
+
+	// Device codes are single-use
+	w = pollDeviceToken(t, server, "device-client", dev.DeviceCode)
+	if !strings.Contains(w.Body.String(), "expired_token") {
+		t.Errorf("reuse: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDeviceGrantRequiresDeviceClient(t *testing.T) {
+	ctx := context.Background()
+	server, db := setupTestServer(t)
+	db.CreateClient(ctx, "web-client", "Web", []string{"http://localhost/callback"}, nil)
+
+	w := postForm(t, server, "/device_authorization", url.Values{"client_id": {"web-client"}})
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "unauthorized_client") {
+		t.Errorf("device_authorization for a web client: %d %s", w.Code, w.Body.String())
+	}
+
+	// Nor may it redeem an approved device code
+	code := "approved-device-code"
+	db.StoreToken(ctx, storage.HashToken(code), storage.TokenDeviceCode, "web-client", time.Now().Add(time.Minute).Unix(),
+		map[string]string{"status": deviceStatusApproved})
+	w = pollDeviceToken(t, server, "web-client", code)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "unauthorized_client") {
+		t.Errorf("device token for a web client: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDevicePollRateLimit(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	// Polls with made-up codes are limited per address, with slow_down
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 20; i++ {
+		w = pollDeviceToken(t, server, "device-client", "guess")
+	}
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "slow_down") {
+		t.Errorf("poll flood: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDevicePostInvalidUserCode(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	w := postForm(t, server, "/device", url.Values{
+		"csrf_token": {deviceCSRF(t, server)},
+		"user_code":  {"BCDF-GHJK"},
+		"password":   {"testpass"},
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestDeviceCSRFNotAcceptedByAuthorize(t *testing.T) {
+	ctx := context.Background()
+	server, db := setupTestServer(t)
+
+	csrf := deviceCSRF(t, server)
+	if _, err := db.ValidateToken(ctx, storage.HashToken(csrf), storage.TokenCSRF); err != nil {
+		t.Fatalf("device CSRF not stored: %v", err)
+	}
+
+	w := postForm(t, server, "/authorize", url.Values{
+		"csrf_token": {csrf},
+		"password":   {"testpass"},
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
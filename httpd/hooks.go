@@ -0,0 +1,134 @@
+package httpd
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/neoden/mykb/events"
+	"github.com/neoden/mykb/mcp"
+)
+
+// hookField matches a {{field.path}} placeholder in a hook template.
+var hookField = regexp.MustCompile(`\{\{\s*([\w.-]+)\s*\}\}`)
+
+// HookConfig maps JSON payloads posted to /hooks/<name> to chunks.
+// Templates refer to payload fields as {{field}} or {{nested.field}}; a
+// missing field renders empty.
+type HookConfig struct {
+	Name string `toml:"name"`
+	// Token authenticates the hook, as a Bearer token or ?token= for
+	// senders that cannot set headers.
+	Token string `toml:"token"`
+	// Content is the chunk content template (default "{{content}}").
+	Content string `toml:"content"`
+	// Metadata maps metadata keys to templates; empty results are dropped.
+	Metadata map[string]string `toml:"metadata"`
+}
+
+func (h *HookConfig) content() string {
+	if h.Content != "" {
+		return h.Content
+	}
+	return "{{content}}"
+}
+
+// render fills tmpl with fields of payload.
+func render(tmpl string, payload map[string]any) string {
+	return hookField.ReplaceAllStringFunc(tmpl, func(m string) string {
+		var v any = payload
+		for _, key := range strings.Split(hookField.FindStringSubmatch(m)[1], ".") {
+			obj, ok := v.(map[string]any)
+			if !ok {
+				return ""
+			}
+			v = obj[key]
+		}
+		switch v := v.(type) {
+		case nil:
+			return ""
+		case string:
+			return v
+		case float64, bool:
+			return fmt.Sprint(v)
+		default:
+			data, _ := json.Marshal(v)
+			return string(data)
+		}
+	})
+}
+
+// hook returns the hook named name if token authenticates it.
+func (s *Server) hook(name, token string) *HookConfig {
+	for i := range s.config.Hooks {
+		h := &s.config.Hooks[i]
+		if h.Name == name {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(h.Token)) == 1 {
+				return h
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// handleHook stores a chunk from a JSON payload posted to /hooks/{name}.
+func (s *Server) handleHook(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		token = r.URL.Query().Get("token")
+	}
+	h := s.hook(name, token)
+	if h == nil {
+		s.authFailed("hook %q: invalid token", name)
+		writeError(w, http.StatusUnauthorized, "invalid hook or token")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, "request too large")
+		return
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		writeError(w, http.StatusBadRequest, "payload must be a JSON object")
+		return
+	}
+
+	content := strings.TrimSpace(render(h.content(), payload))
+	if content == "" {
+		writeError(w, http.StatusBadRequest, "payload has no content")
+		return
+	}
+	meta := map[string]any{"hook": h.Name}
+	for k, tmpl := range h.Metadata {
+		if v := render(tmpl, payload); v != "" {
+			meta[k] = v
+		}
+	}
+	raw, err := json.Marshal(meta)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to encode metadata")
+		return
+	}
+
+	ctx := mcp.WithClient(r.Context(), "hook:"+h.Name)
+	chunk, deferred, err := s.mcp.StoreChunk(ctx, content, raw)
+	if err != nil {
+		s.config.Events.Publish(events.Event{
+			Type:    events.Error,
+			Message: fmt.Sprintf("hook %s: %v", h.Name, err),
+			Fields:  map[string]any{"hook": h.Name},
+		})
+		writeError(w, http.StatusInternalServerError, "failed to store chunk")
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"id": chunk.ID, "embedding_deferred": deferred})
+}
@@ -0,0 +1,101 @@
+package httpd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/neoden/mykb/mcp"
+	"github.com/neoden/mykb/vector"
+)
+
+func TestRender(t *testing.T) {
+	payload := map[string]any{
+		"title": "Read later",
+		"link":  map[string]any{"url": "https://example.com", "rank": 2.0},
+		"tags":  []any{"a", "b"},
+	}
+	tests := []struct{ tmpl, want string }{
+		{"{{title}}", "Read later"},
+		{"{{ link.url }} #{{link.rank}}", "https://example.com #2"},
+		{"{{tags}}", `["a","b"]`},
+		{"[{{missing}}{{title.nested}}]", "[]"},
+	}
+	for _, tt := range tests {
+		if got := render(tt.tmpl, payload); got != tt.want {
+			t.Errorf("render(%q) = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+}
+
+func TestHook(t *testing.T) {
+	ctx := context.Background()
+	_, db := setupTestServer(t)
+	config := DefaultConfig()
+	config.BaseURL = "http://localhost:8080"
+	config.Hooks = []HookConfig{{
+		Name:     "links",
+		Token:    "hook-secret-0123456789",
+		Content:  "{{title}}\n\n{{url}}",
+		Metadata: map[string]string{"source": "{{url}}", "via": "zapier", "note": "{{note}}"},
+	}}
+	server := NewServer(db, mcp.NewServer(db, nil, vector.NewIndex()), config)
+
+	post := func(path, auth, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		if auth != "" {
+			req.Header.Set("Authorization", "Bearer "+auth)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+	payload := `{"title":"Go blog","url":"https://go.dev/blog"}`
+
+	for _, tc := range []struct {
+		name, path, auth string
+	}{
+		{"no token", "/hooks/links", ""},
+		{"wrong token", "/hooks/links", "wrong"},
+		{"unknown hook", "/hooks/other", "hook-secret-0123456789"},
+	} {
+		if w := post(tc.path, tc.auth, payload); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want 401", tc.name, w.Code)
+		}
+	}
+	if w := post("/hooks/links", "hook-secret-0123456789", `["not an object"]`); w.Code != http.StatusBadRequest {
+		t.Errorf("array payload: status = %d, want 400", w.Code)
+	}
+
+	w := post("/hooks/links", "hook-secret-0123456789", payload)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	chunk, err := db.GetChunk(ctx, resp.ID)
+	if err != nil {
+		t.Fatalf("GetChunk: %v", err)
+	}
+	if chunk.Content != "Go blog\n\nhttps://go.dev/blog" {
+		t.Errorf("content = %q", chunk.Content)
+	}
+	var meta map[string]any
+	json.Unmarshal(chunk.Metadata, &meta)
+	if meta["hook"] != "links" || meta["source"] != "https://go.dev/blog" || meta["via"] != "zapier" {
+		t.Errorf("metadata = %v", meta)
+	}
+	if _, ok := meta["note"]; ok {
+		t.Error("empty template result kept in metadata")
+	}
+
+	// Senders that cannot set headers pass the token in the query
+	if w := post("/hooks/links?token=hook-secret-0123456789", "", payload); w.Code != http.StatusCreated {
+		t.Errorf("query token: status = %d", w.Code)
+	}
+}
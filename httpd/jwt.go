@@ -0,0 +1,308 @@
+package httpd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/neoden/mykb/storage"
+)
+
+// errInvalidJWT is returned for any JWT that fails parsing or verification.
+var errInvalidJWT = errors.New("invalid jwt")
+
+// jwtClaims are the claims carried by mykb access tokens.
+type jwtClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	Audience  string `json:"aud"`
+	ClientID  string `json:"client_id"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	ID        string `json:"jti"`
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid"`
+}
+
+// jwk is a public key in JSON Web Key format (EC P-256 only).
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+type signingKey struct {
+	kid       string
+	key       *ecdsa.PrivateKey
+	createdAt time.Time
+}
+
+// jwtIssuer signs and verifies ES256 access tokens.
+// Private keys are persisted in the database and rotated after KeyRotation.
+// Retired keys stay published until every token they signed has expired.
+type jwtIssuer struct {
+	db       *storage.DB
+	issuer   string
+	audience string
+	rotation time.Duration
+	ttl      time.Duration
+
+	mu       sync.Mutex
+	keys     []signingKey // newest first
+	loadedAt time.Time
+}
+
+// keyReload is how often an unknown kid may reload keys from the database,
+// so tokens with made-up kids cannot make every request query it.
+const keyReload = time.Minute
+
+func newJWTIssuer(db *storage.DB, config *Config) *jwtIssuer {
+	rotation := config.KeyRotation
+	if rotation <= 0 {
+		rotation = 30 * 24 * time.Hour
+	}
+	return &jwtIssuer{
+		db:       db,
+		issuer:   config.BaseURL,
+		audience: config.BaseURL + "/mcp",
+		rotation: rotation,
+		ttl:      config.TokenExpiry,
+	}
+}
+
+// loadKeys reads keys from the database. Caller must hold mu.
+func (j *jwtIssuer) loadKeys(ctx context.Context) error {
+	stored, err := j.db.ListSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+	keys := make([]signingKey, 0, len(stored))
+	for _, s := range stored {
+		parsed, err := x509.ParsePKCS8PrivateKey(s.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("parse signing key %s: %w", s.KID, err)
+		}
+		ec, ok := parsed.(*ecdsa.PrivateKey)
+		if !ok {
+			return fmt.Errorf("signing key %s is not ECDSA", s.KID)
+		}
+		keys = append(keys, signingKey{kid: s.KID, key: ec, createdAt: time.Unix(s.CreatedAt, 0)})
+	}
+	j.keys = keys
+	j.loadedAt = time.Now()
+	return nil
+}
+
+// currentKey returns the active signing key, rotating it if it is too old.
+func (j *jwtIssuer) currentKey(ctx context.Context) (*signingKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.keys == nil {
+		if err := j.loadKeys(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if len(j.keys) > 0 && time.Since(j.keys[0].createdAt) < j.rotation {
+		return &j.keys[0], nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate signing key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("marshal signing key: %w", err)
+	}
+	kid := uuid.New().String()
+	if err := j.db.CreateSigningKey(ctx, kid, der); err != nil {
+		return nil, err
+	}
+
+	// Keys older than one rotation period plus token lifetime can't verify any live token
+	cutoff := time.Now().Add(-(j.rotation + j.ttl)).Unix()
+	if err := j.db.DeleteSigningKeysBefore(ctx, cutoff, kid); err != nil {
+		return nil, err
+	}
+	if err := j.loadKeys(ctx); err != nil {
+		return nil, err
+	}
+	return &j.keys[0], nil
+}
+
+// publicKeys returns all keys that may have signed a live token.
+func (j *jwtIssuer) publicKeys(ctx context.Context) ([]signingKey, error) {
+	// Ensure at least one key exists so the JWKS is never empty
+	if _, err := j.currentKey(ctx); err != nil {
+		return nil, err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]signingKey(nil), j.keys...), nil
+}
+
+// Issue creates a signed access token for the client.
+func (j *jwtIssuer) Issue(ctx context.Context, clientID string, expiresAt time.Time) (string, error) {
+	key, err := j.currentKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	header, _ := json.Marshal(jwtHeader{Alg: "ES256", Typ: "at+jwt", Kid: key.kid})
+	claims, _ := json.Marshal(jwtClaims{
+		Issuer:    j.issuer,
+		Subject:   "owner",
+		Audience:  j.audience,
+		ClientID:  clientID,
+		IssuedAt:  time.Now().Unix(),
+		ExpiresAt: expiresAt.Unix(),
+		ID:        uuid.New().String(),
+	})
+
+	signingInput := b64(header) + "." + b64(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, key.key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("sign token: %w", err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	return signingInput + "." + b64(sig), nil
+}
+
+// Verify checks the signature and claims of a token issued by Issue.
+func (j *jwtIssuer) Verify(ctx context.Context, token string) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidJWT
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "ES256" {
+		return nil, errInvalidJWT
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(sig) != 64 {
+		return nil, errInvalidJWT
+	}
+
+	key := j.lookupKey(ctx, header.Kid)
+	if key == nil {
+		return nil, errInvalidJWT
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(&key.PublicKey, digest[:], r, s) {
+		return nil, errInvalidJWT
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errInvalidJWT
+	}
+	if claims.Issuer != j.issuer || claims.Audience != j.audience {
+		return nil, errInvalidJWT
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, errInvalidJWT
+	}
+	return &claims, nil
+}
+
+// lookupKey finds a key by kid, reloading from the database if it is
+// unknown and keys were not loaded within keyReload.
+func (j *jwtIssuer) lookupKey(ctx context.Context, kid string) *ecdsa.PrivateKey {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for attempt := 0; attempt < 2; attempt++ {
+		for _, k := range j.keys {
+			if k.kid == kid {
+				return k.key
+			}
+		}
+		if attempt > 0 || (j.keys != nil && time.Since(j.loadedAt) < keyReload) {
+			break
+		}
+		if err := j.loadKeys(ctx); err != nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *Server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.jwt.publicKeys(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load keys")
+		return
+	}
+
+	set := jwkSet{Keys: make([]jwk, 0, len(keys))}
+	for _, k := range keys {
+		pub := k.key.PublicKey
+		x := make([]byte, 32)
+		y := make([]byte, 32)
+		pub.X.FillBytes(x)
+		pub.Y.FillBytes(y)
+		set.Keys = append(set.Keys, jwk{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   b64(x),
+			Y:   b64(y),
+			Kid: k.kid,
+			Use: "sig",
+			Alg: "ES256",
+		})
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, set)
+}
+
+// isJWT reports whether a bearer token has JWT shape (three dot-separated segments).
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
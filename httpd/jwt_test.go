@@ -0,0 +1,169 @@
+package httpd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neoden/mykb/mcp"
+	"github.com/neoden/mykb/vector"
+)
+
+func setupJWTServer(t *testing.T) *Server {
+	t.Helper()
+	_, db := setupTestServer(t)
+	config := DefaultConfig()
+	config.BaseURL = "http://localhost:8080"
+	config.JWTAccessTokens = true
+	return NewServer(db, mcp.NewServer(db, nil, vector.NewIndex()), config)
+}
+
+func TestJWTIssueAndVerify(t *testing.T) {
+	ctx := context.Background()
+	server := setupJWTServer(t)
+
+	token, err := server.jwt.Issue(ctx, "client-1", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if !isJWT(token) {
+		t.Fatalf("token %q is not JWT-shaped", token)
+	}
+
+	claims, err := server.jwt.Verify(ctx, token)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if claims.ClientID != "client-1" {
+		t.Errorf("client_id = %q, want client-1", claims.ClientID)
+	}
+	if claims.Audience != "http://localhost:8080/mcp" {
+		t.Errorf("aud = %q", claims.Audience)
+	}
+}
+
+func TestJWTVerifyRejectsTampered(t *testing.T) {
+	ctx := context.Background()
+	server := setupJWTServer(t)
+
+	token, _ := server.jwt.Issue(ctx, "client-1", time.Now().Add(time.Hour))
+	parts := strings.Split(token, ".")
+	claims := b64([]byte(`{"iss":"http://localhost:8080","aud":"http://localhost:8080/mcp","client_id":"evil","exp":9999999999}`))
+
+	if _, err := server.jwt.Verify(ctx, parts[0]+"."+claims+"."+parts[2]); err == nil {
+		t.Error("Expected tampered token to fail verification")
+	}
+}
+
+func TestJWTVerifyRejectsExpired(t *testing.T) {
+	ctx := context.Background()
+	server := setupJWTServer(t)
+
+	token, _ := server.jwt.Issue(ctx, "client-1", time.Now().Add(-time.Minute))
+	if _, err := server.jwt.Verify(ctx, token); err == nil {
+		t.Error("Expected expired token to fail verification")
+	}
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	server := setupJWTServer(t)
+	server.jwt.rotation = time.Millisecond
+
+	old, _ := server.jwt.Issue(ctx, "client-1", time.Now().Add(time.Hour))
+	time.Sleep(5 * time.Millisecond)
+	fresh, _ := server.jwt.Issue(ctx, "client-1", time.Now().Add(time.Hour))
+
+	var h1, h2 jwtHeader
+	decodeSegment(strings.Split(old, ".")[0], &h1)
+	decodeSegment(strings.Split(fresh, ".")[0], &h2)
+	if h1.Kid == h2.Kid {
+		t.Error("Expected a new signing key after rotation")
+	}
+
+	// Token signed by the retired key must still verify
+	if _, err := server.jwt.Verify(ctx, old); err != nil {
+		t.Errorf("Verify old token after rotation: %v", err)
+	}
+}
+
+func TestJWTUnknownKidReload(t *testing.T) {
+	ctx := context.Background()
+	server := setupJWTServer(t)
+	if _, err := server.jwt.Issue(ctx, "client-1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	// Another process sharing the database rotates to a new key
+	other := newJWTIssuer(server.jwt.db, &Config{BaseURL: server.jwt.issuer, KeyRotation: time.Millisecond, TokenExpiry: time.Hour})
+	time.Sleep(5 * time.Millisecond)
+	token, err := other.Issue(ctx, "client-1", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Issue with other issuer: %v", err)
+	}
+
+	// Keys were just loaded, so the unknown kid does not reload them
+	if _, err := server.jwt.Verify(ctx, token); err == nil {
+		t.Error("Verify with an unknown kid reloaded keys within keyReload")
+	}
+	server.jwt.mu.Lock()
+	server.jwt.loadedAt = time.Now().Add(-keyReload)
+	server.jwt.mu.Unlock()
+	if _, err := server.jwt.Verify(ctx, token); err != nil {
+		t.Errorf("Verify after keyReload: %v", err)
+	}
+}
+
+func TestJWKSEndpoint(t *testing.T) {
+	server := setupJWTServer(t)
+
+	req := httptest.NewRequest("GET", "/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	var set jwkSet
+	json.NewDecoder(w.Body).Decode(&set)
+	if len(set.Keys) != 1 {
+		t.Fatalf("len(keys) = %d, want 1", len(set.Keys))
+	}
+	if set.Keys[0].Kty != "EC" || set.Keys[0].Alg != "ES256" {
+		t.Errorf("key = %+v, want EC/ES256", set.Keys[0])
+	}
+}
+
+func TestJWKSDisabledByDefault(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	req := httptest.NewRequest("GET", "/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestMCPWithJWTAccessToken(t *testing.T) {
+	ctx := context.Background()
+	server := setupJWTServer(t)
+
+	token, _ := server.jwt.Issue(ctx, "client-1", time.Now().Add(time.Hour))
+
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
@@ -1,6 +1,7 @@
 package httpd
 
 import (
+	"context"
 	"crypto/subtle"
 	"encoding/json"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/neoden/mykb/events"
 	"github.com/neoden/mykb/storage"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -23,6 +25,8 @@ type oauthMetadata struct {
 	ResponseTypesSupported        []string `json:"response_types_supported"`
 	GrantTypesSupported           []string `json:"grant_types_supported"`
 	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported"`
+	DeviceAuthorizationEndpoint   string   `json:"device_authorization_endpoint"`
+	JWKSURI                       string   `json:"jwks_uri,omitempty"`
 }
 
 type protectedResourceMetadata struct {
@@ -33,12 +37,14 @@ type protectedResourceMetadata struct {
 type clientRegistration struct {
 	ClientName   string   `json:"client_name,omitempty"`
 	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types,omitempty"`
 }
 
 type clientRegistrationResponse struct {
 	ClientID     string   `json:"client_id"`
 	ClientName   string   `json:"client_name,omitempty"`
 	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types,omitempty"`
 }
 
 type tokenResponse struct {
@@ -79,14 +85,20 @@ func validateRedirectURI(uri string) error {
 }
 
 func (s *Server) handleOAuthMetadata(w http.ResponseWriter, r *http.Request) {
+	var jwksURI string
+	if s.config.JWTAccessTokens {
+		jwksURI = s.config.BaseURL + "/.well-known/jwks.json"
+	}
 	writeJSON(w, http.StatusOK, oauthMetadata{
 		Issuer:                        s.config.BaseURL,
 		AuthorizationEndpoint:         s.config.BaseURL + "/authorize",
 		TokenEndpoint:                 s.config.BaseURL + "/token",
 		RegistrationEndpoint:          s.config.BaseURL + "/register",
 		ResponseTypesSupported:        []string{"code"},
-		GrantTypesSupported:           []string{"authorization_code", "refresh_token"},
+		GrantTypesSupported:           []string{"authorization_code", "refresh_token", deviceCodeGrantType},
 		CodeChallengeMethodsSupported: []string{"S256"},
+		DeviceAuthorizationEndpoint:   s.config.BaseURL + "/device_authorization",
+		JWKSURI:                       jwksURI,
 	})
 }
 
@@ -106,7 +118,8 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(req.RedirectURIs) == 0 {
+	// Device clients have nowhere to redirect to
+	if len(req.RedirectURIs) == 0 && !req.allowsDeviceGrant() {
 		writeError(w, http.StatusBadRequest, "redirect_uris required")
 		return
 	}
@@ -120,12 +133,12 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Cleanup stale clients (best-effort, log errors)
-	if err := s.db.DeleteStaleClients(); err != nil {
+	if _, err := s.db.DeleteStaleClients(r.Context()); err != nil {
 		log.Printf("warning: failed to cleanup stale clients: %v", err)
 	}
 
 	clientID := uuid.New().String()
-	if err := s.db.CreateClient(clientID, req.ClientName, req.RedirectURIs); err != nil {
+	if err := s.db.CreateClient(r.Context(), clientID, req.ClientName, req.RedirectURIs, req.GrantTypes); err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to create client")
 		return
 	}
@@ -134,6 +147,7 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 		ClientID:     clientID,
 		ClientName:   req.ClientName,
 		RedirectURIs: req.RedirectURIs,
+		GrantTypes:   req.GrantTypes,
 	})
 }
 
@@ -147,7 +161,7 @@ func (s *Server) handleAuthorizeGet(w http.ResponseWriter, r *http.Request) {
 	state := q.Get("state")
 
 	// Validate client
-	client, err := s.db.GetClient(clientID)
+	client, err := s.db.GetClient(r.Context(), clientID)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, "invalid client_id")
 		return
@@ -185,14 +199,32 @@ func (s *Server) handleAuthorizeGet(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "failed to generate token")
 		return
 	}
-	csrfExpiry := time.Now().Add(5 * time.Minute).Unix()
-	s.db.StoreToken(storage.HashToken(csrfToken), storage.TokenCSRF, clientID, csrfExpiry, map[string]string{
+	data := map[string]string{
 		"client_id":             clientID,
 		"redirect_uri":          redirectURI,
 		"code_challenge":        codeChallenge,
 		"code_challenge_method": codeChallengeMethod,
 		"state":                 state,
-	})
+	}
+
+	// Delegate login to the identity provider (CSRF token doubles as OIDC state)
+	if s.config.OIDC.Enabled() {
+		nonce, err1 := GenerateToken()
+		verifier, err2 := GenerateToken()
+		if err1 != nil || err2 != nil {
+			writeError(w, http.StatusInternalServerError, "failed to generate token")
+			return
+		}
+		data["oidc_nonce"] = nonce
+		data["oidc_verifier"] = verifier
+		csrfExpiry := time.Now().Add(10 * time.Minute).Unix()
+		s.db.StoreToken(r.Context(), storage.HashToken(csrfToken), storage.TokenCSRF, clientID, csrfExpiry, data)
+		s.redirectToOIDC(w, r, csrfToken, nonce, verifier)
+		return
+	}
+
+	csrfExpiry := time.Now().Add(5 * time.Minute).Unix()
+	s.db.StoreToken(r.Context(), storage.HashToken(csrfToken), storage.TokenCSRF, clientID, csrfExpiry, data)
 
 	// Render login form
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -202,6 +234,12 @@ func (s *Server) handleAuthorizeGet(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleAuthorizePost(w http.ResponseWriter, r *http.Request) {
 	r.Body = http.MaxBytesReader(w, r.Body, maxOAuthBodySize)
 
+	// Password login is disabled when an identity provider is configured
+	if s.config.OIDC.Enabled() {
+		writeError(w, http.StatusForbidden, "password login disabled")
+		return
+	}
+
 	if err := r.ParseForm(); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid form")
 		return
@@ -211,32 +249,40 @@ func (s *Server) handleAuthorizePost(w http.ResponseWriter, r *http.Request) {
 	password := r.FormValue("password")
 
 	// Verify and consume CSRF token, extract bound parameters
-	csrf, err := s.db.ConsumeToken(storage.HashToken(csrfToken), storage.TokenCSRF)
-	if err != nil || csrf == nil {
+	csrf, err := s.db.ConsumeToken(r.Context(), storage.HashToken(csrfToken), storage.TokenCSRF)
+	if err != nil || csrf == nil || csrf.Data["device"] != "" {
 		writeError(w, http.StatusBadRequest, "invalid or expired CSRF token")
 		return
 	}
 
-	// Use parameters bound to CSRF token (not from form - prevents tampering)
 	clientID := csrf.Data["client_id"]
-	redirectURI := csrf.Data["redirect_uri"]
-	codeChallenge := csrf.Data["code_challenge"]
-	codeChallengeMethod := csrf.Data["code_challenge_method"]
-	state := csrf.Data["state"]
 
 	// Verify password
-	storedHash, err := s.db.GetPasswordHash()
+	storedHash, err := s.db.GetPasswordHash(r.Context())
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "password not configured")
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(password)); err != nil {
-		log.Printf("AUTH FAILED: invalid password from %s for client %s", getIP(r), clientID)
+		s.authFailed("invalid password from %s for client %s", getIP(r), clientID)
 		writeError(w, http.StatusUnauthorized, "invalid password")
 		return
 	}
 
+	s.completeAuthorization(w, r, csrf)
+}
+
+// completeAuthorization issues an authorization code for an authenticated
+// user and redirects back to the client.
+func (s *Server) completeAuthorization(w http.ResponseWriter, r *http.Request, csrf *storage.Token) {
+	// Use parameters bound to CSRF token (not from form - prevents tampering)
+	clientID := csrf.Data["client_id"]
+	redirectURI := csrf.Data["redirect_uri"]
+	codeChallenge := csrf.Data["code_challenge"]
+	codeChallengeMethod := csrf.Data["code_challenge_method"]
+	state := csrf.Data["state"]
+
 	// Generate authorization code
 	code, err := GenerateToken()
 	if err != nil {
@@ -244,7 +290,7 @@ func (s *Server) handleAuthorizePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	codeExpiry := time.Now().Add(s.config.CodeExpiry).Unix()
-	s.db.StoreToken(storage.HashToken(code), storage.TokenAuthCode, clientID, codeExpiry, map[string]string{
+	s.db.StoreToken(r.Context(), storage.HashToken(code), storage.TokenAuthCode, clientID, codeExpiry, map[string]string{
 		"client_id":             clientID,
 		"redirect_uri":          redirectURI,
 		"code_challenge":        codeChallenge,
@@ -278,6 +324,8 @@ func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
 		s.handleTokenAuthCode(w, r)
 	case "refresh_token":
 		s.handleTokenRefresh(w, r)
+	case deviceCodeGrantType:
+		s.handleTokenDeviceCode(w, r)
 	default:
 		writeError(w, http.StatusBadRequest, "unsupported grant_type")
 	}
@@ -295,7 +343,7 @@ func (s *Server) handleTokenAuthCode(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get and consume authorization code
-	authCode, err := s.db.ConsumeToken(storage.HashToken(code), storage.TokenAuthCode)
+	authCode, err := s.db.ConsumeToken(r.Context(), storage.HashToken(code), storage.TokenAuthCode)
 	if err != nil || authCode == nil {
 		writeError(w, http.StatusBadRequest, "invalid or expired code")
 		return
@@ -318,41 +366,7 @@ func (s *Server) handleTokenAuthCode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate tokens
-	accessToken, err := GenerateToken()
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to generate token")
-		return
-	}
-	refreshToken, err := GenerateToken()
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to generate token")
-		return
-	}
-
-	// Store tokens in database
-	now := time.Now()
-	accessExpiry := now.Add(s.config.TokenExpiry).Unix()
-	refreshExpiry := now.Add(s.config.RefreshTokenExpiry).Unix()
-
-	if err := s.db.StoreToken(storage.HashToken(accessToken), storage.TokenAccess, clientID, accessExpiry, nil); err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to store token")
-		return
-	}
-	if err := s.db.StoreToken(storage.HashToken(refreshToken), storage.TokenRefresh, clientID, refreshExpiry, nil); err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to store token")
-		return
-	}
-
-	// Update client last used
-	s.db.TouchClient(clientID)
-
-	writeJSON(w, http.StatusOK, tokenResponse{
-		AccessToken:  accessToken,
-		TokenType:    "Bearer",
-		ExpiresIn:    int(s.config.TokenExpiry.Seconds()),
-		RefreshToken: refreshToken,
-	})
+	s.issueTokens(r.Context(), w, clientID)
 }
 
 func (s *Server) handleTokenRefresh(w http.ResponseWriter, r *http.Request) {
@@ -369,59 +383,80 @@ func (s *Server) handleTokenRefresh(w http.ResponseWriter, r *http.Request) {
 
 	// Validate refresh token
 	hash := storage.HashToken(refreshToken)
-	token, err := s.db.ValidateToken(hash, storage.TokenRefresh)
+	token, err := s.db.ValidateToken(r.Context(), hash, storage.TokenRefresh)
 	if err != nil {
-		log.Printf("AUTH FAILED: invalid refresh token from %s", getIP(r))
+		s.authFailed("invalid refresh token from %s", getIP(r))
 		writeError(w, http.StatusBadRequest, "invalid or expired refresh_token")
 		return
 	}
 
 	// Verify token belongs to this client (RFC 6749 Section 6)
 	if token.ClientID != clientID {
-		log.Printf("AUTH FAILED: refresh token client mismatch from %s", getIP(r))
+		s.authFailed("refresh token client mismatch from %s", getIP(r))
 		writeError(w, http.StatusBadRequest, "invalid refresh_token")
 		return
 	}
 
 	// Revoke old refresh token (rotation)
-	s.db.DeleteToken(hash)
+	s.db.DeleteToken(r.Context(), hash)
 
-	// Generate new tokens
-	newAccessToken, err := GenerateToken()
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to generate token")
-		return
-	}
-	newRefreshToken, err := GenerateToken()
+	s.issueTokens(r.Context(), w, token.ClientID)
+}
+
+// issueTokens issues a new access/refresh token pair and writes the token response.
+func (s *Server) issueTokens(ctx context.Context, w http.ResponseWriter, clientID string) {
+	refreshToken, err := GenerateToken()
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to generate token")
 		return
 	}
 
 	now := time.Now()
-	accessExpiry := now.Add(s.config.TokenExpiry).Unix()
 	refreshExpiry := now.Add(s.config.RefreshTokenExpiry).Unix()
 
-	if err := s.db.StoreToken(storage.HashToken(newAccessToken), storage.TokenAccess, token.ClientID, accessExpiry, nil); err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to store token")
+	accessToken, err := s.issueAccessToken(ctx, clientID, now.Add(s.config.TokenExpiry))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to issue token")
 		return
 	}
-	if err := s.db.StoreToken(storage.HashToken(newRefreshToken), storage.TokenRefresh, token.ClientID, refreshExpiry, nil); err != nil {
+	if err := s.db.StoreToken(ctx, storage.HashToken(refreshToken), storage.TokenRefresh, clientID, refreshExpiry, nil); err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to store token")
 		return
 	}
 
 	// Update client last used
-	s.db.TouchClient(token.ClientID)
+	s.db.TouchClient(ctx, clientID)
+	s.config.Events.Publish(events.Event{
+		Type:    events.Auth,
+		Message: "tokens issued",
+		Fields:  map[string]any{"client_id": clientID},
+	})
 
 	writeJSON(w, http.StatusOK, tokenResponse{
-		AccessToken:  newAccessToken,
+		AccessToken:  accessToken,
 		TokenType:    "Bearer",
 		ExpiresIn:    int(s.config.TokenExpiry.Seconds()),
-		RefreshToken: newRefreshToken,
+		RefreshToken: refreshToken,
 	})
 }
 
+// issueAccessToken creates an access token for the client.
+// JWT tokens are self-contained; opaque tokens are stored in the database.
+// Refresh tokens are always opaque and stored server-side.
+func (s *Server) issueAccessToken(ctx context.Context, clientID string, expiresAt time.Time) (string, error) {
+	if s.config.JWTAccessTokens {
+		return s.jwt.Issue(ctx, clientID, expiresAt)
+	}
+	token, err := GenerateToken()
+	if err != nil {
+		return "", err
+	}
+	if err := s.db.StoreToken(ctx, storage.HashToken(token), storage.TokenAccess, clientID, expiresAt.Unix(), nil); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
 const authorizePage = `<!DOCTYPE html>
 <html>
 <head>
@@ -0,0 +1,371 @@
+package httpd
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neoden/mykb/storage"
+)
+
+// OIDCConfig configures login through an upstream OpenID Connect provider.
+// When Issuer is set, /authorize redirects to the provider instead of
+// showing the password form.
+type OIDCConfig struct {
+	Issuer       string `toml:"issuer"`
+	ClientID     string `toml:"client_id"`
+	ClientSecret string `toml:"client_secret"`
+	// AllowedSubjects lists provider "sub" claims granted access.
+	AllowedSubjects []string `toml:"allowed_subjects"`
+	// AllowedEmails lists verified email addresses granted access.
+	AllowedEmails []string `toml:"allowed_emails"`
+}
+
+// Enabled reports whether OIDC login is configured.
+func (c OIDCConfig) Enabled() bool {
+	return c.Issuer != ""
+}
+
+// allows reports whether the verified identity may access mykb.
+func (c OIDCConfig) allows(id *idTokenClaims) bool {
+	if slices.Contains(c.AllowedSubjects, id.Subject) {
+		return true
+	}
+	return id.EmailVerified && id.Email != "" && slices.Contains(c.AllowedEmails, id.Email)
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type idTokenClaims struct {
+	Issuer        string          `json:"iss"`
+	Subject       string          `json:"sub"`
+	Audience      json.RawMessage `json:"aud"` // string or array
+	ExpiresAt     int64           `json:"exp"`
+	Nonce         string          `json:"nonce"`
+	Email         string          `json:"email"`
+	EmailVerified bool            `json:"email_verified"`
+}
+
+func (c *idTokenClaims) hasAudience(aud string) bool {
+	var one string
+	if json.Unmarshal(c.Audience, &one) == nil {
+		return one == aud
+	}
+	var many []string
+	if json.Unmarshal(c.Audience, &many) == nil {
+		return slices.Contains(many, aud)
+	}
+	return false
+}
+
+// oidcProvider caches discovery metadata and signing keys for an issuer.
+type oidcProvider struct {
+	config OIDCConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]crypto.PublicKey
+	keysAt    time.Time
+}
+
+func newOIDCProvider(config OIDCConfig) *oidcProvider {
+	return &oidcProvider{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *oidcProvider) getJSON(ctx context.Context, rawURL string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", rawURL, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// metadata returns discovery metadata, fetching it on first use.
+func (p *oidcProvider) metadata(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var d oidcDiscovery
+	wellKnown := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &d); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if d.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer mismatch: %s", d.Issuer)
+	}
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// key returns the provider's public key for kid, refreshing the JWKS when
+// the kid is unknown (at most once a minute, to tolerate key rotation).
+func (p *oidcProvider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	d, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+	if time.Since(p.keysAt) < time.Minute && p.keys != nil {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, d.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		switch k.Kty {
+		case "RSA":
+			n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+			e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			x, err1 := base64.RawURLEncoding.DecodeString(k.X)
+			y, err2 := base64.RawURLEncoding.DecodeString(k.Y)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+		}
+	}
+	p.keys = keys
+	p.keysAt = time.Now()
+
+	if k, ok := keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// verifyIDToken checks signature, issuer, audience, expiry and nonce.
+func (p *oidcProvider) verifyIDToken(ctx context.Context, token, nonce string) (*idTokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidJWT
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errInvalidJWT
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errInvalidJWT
+	}
+
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" || rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) != nil {
+			return nil, errInvalidJWT
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg != "ES256" || len(sig) != 64 ||
+			!ecdsa.Verify(k, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+			return nil, errInvalidJWT
+		}
+	default:
+		return nil, errInvalidJWT
+	}
+
+	var claims idTokenClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errInvalidJWT
+	}
+	if claims.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("issuer mismatch")
+	}
+	if !claims.hasAudience(p.config.ClientID) {
+		return nil, fmt.Errorf("audience mismatch")
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, fmt.Errorf("id token expired")
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("nonce mismatch")
+	}
+	return &claims, nil
+}
+
+// exchangeCode redeems an authorization code at the provider's token endpoint.
+func (p *oidcProvider) exchangeCode(ctx context.Context, code, redirectURI, verifier string) (string, error) {
+	d, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("client_secret", p.config.ClientSecret)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("token endpoint: status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var tr struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return "", fmt.Errorf("decode token response: %w", err)
+	}
+	if tr.IDToken == "" {
+		return "", fmt.Errorf("no id_token in response")
+	}
+	return tr.IDToken, nil
+}
+
+// redirectToOIDC sends the user to the provider's login page.
+// The CSRF token doubles as the OIDC state parameter.
+func (s *Server) redirectToOIDC(w http.ResponseWriter, r *http.Request, csrfToken, nonce, verifier string) {
+	d, err := s.oidc.metadata(r.Context())
+	if err != nil {
+		log.Printf("OIDC: %v", err)
+		writeError(w, http.StatusBadGateway, "identity provider unavailable")
+		return
+	}
+
+	target, err := url.Parse(d.AuthorizationEndpoint)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "invalid identity provider metadata")
+		return
+	}
+	q := target.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", s.config.OIDC.ClientID)
+	q.Set("redirect_uri", s.config.BaseURL+"/oidc/callback")
+	q.Set("scope", "openid email")
+	q.Set("state", csrfToken)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", HashPKCE(verifier))
+	q.Set("code_challenge_method", "S256")
+	target.RawQuery = q.Encode()
+
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func (s *Server) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if errCode := q.Get("error"); errCode != "" {
+		writeError(w, http.StatusUnauthorized, "identity provider error: "+errCode)
+		return
+	}
+
+	csrf, err := s.db.ConsumeToken(r.Context(), storage.HashToken(q.Get("state")), storage.TokenCSRF)
+	if err != nil || csrf == nil || csrf.Data["oidc_nonce"] == "" {
+		writeError(w, http.StatusBadRequest, "invalid or expired state")
+		return
+	}
+
+	rawIDToken, err := s.oidc.exchangeCode(r.Context(), q.Get("code"), s.config.BaseURL+"/oidc/callback", csrf.Data["oidc_verifier"])
+	if err != nil {
+		log.Printf("OIDC: %v", err)
+		writeError(w, http.StatusBadGateway, "failed to exchange code")
+		return
+	}
+
+	id, err := s.oidc.verifyIDToken(r.Context(), rawIDToken, csrf.Data["oidc_nonce"])
+	if err != nil {
+		s.authFailed("invalid id token from %s: %v", getIP(r), err)
+		writeError(w, http.StatusUnauthorized, "invalid id token")
+		return
+	}
+
+	if !s.config.OIDC.allows(id) {
+		s.authFailed("subject %q (%s) not allowed, from %s", id.Subject, id.Email, getIP(r))
+		writeError(w, http.StatusForbidden, "access denied")
+		return
+	}
+
+	log.Printf("OIDC login: subject %q for client %s", id.Subject, csrf.Data["client_id"])
+	if userCode := csrf.Data["device_user_code"]; userCode != "" {
+		s.approveDevice(r.Context(), w, userCode)
+		return
+	}
+	s.completeAuthorization(w, r, csrf)
+}
@@ -0,0 +1,203 @@
+package httpd
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neoden/mykb/mcp"
+	"github.com/neoden/mykb/vector"
+)
+
+// fakeIdP is a minimal OpenID provider issuing RS256 id tokens.
+type fakeIdP struct {
+	*httptest.Server
+	key     *rsa.PrivateKey
+	subject string
+	nonce   string // captured from the authorize redirect
+}
+
+func newFakeIdP(t *testing.T, subject string) *fakeIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	idp := &fakeIdP{key: key, subject: subject}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, oidcDiscovery{
+			Issuer:                idp.URL,
+			AuthorizationEndpoint: idp.URL + "/auth",
+			TokenEndpoint:         idp.URL + "/token",
+			JWKSURI:               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"n":   b64(key.N.Bytes()),
+			"e":   b64(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.FormValue("code") != "idp-code" || r.FormValue("client_secret") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"id_token": idp.sign(t)})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (idp *fakeIdP) sign(t *testing.T) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   idp.URL,
+		"sub":   idp.subject,
+		"aud":   "mykb",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": idp.nonce,
+	})
+	input := b64(header) + "." + b64(claims)
+	digest := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return input + "." + b64(sig)
+}
+
+func setupOIDCServer(t *testing.T, idp *fakeIdP) *Server {
+	ctx := context.Background()
+	t.Helper()
+	_, db := setupTestServer(t)
+	config := DefaultConfig()
+	config.BaseURL = "http://localhost:8080"
+	config.OIDC = OIDCConfig{
+		Issuer:          idp.URL,
+		ClientID:        "mykb",
+		ClientSecret:    "secret",
+		AllowedSubjects: []string{"alice"},
+	}
+	db.CreateClient(ctx, "oidc-client", "Test", []string{"http://localhost/callback"}, nil)
+	return NewServer(db, mcp.NewServer(db, nil, vector.NewIndex()), config)
+}
+
+// startOIDCLogin performs GET /authorize and returns the IdP redirect.
+func startOIDCLogin(t *testing.T, server *Server, idp *fakeIdP) *url.URL {
+	t.Helper()
+	authURL := "/authorize?client_id=oidc-client&redirect_uri=http://localhost/callback&response_type=code&code_challenge=" + HashPKCE("verifier") + "&state=xyz"
+	req := httptest.NewRequest("GET", authURL, nil)
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("Authorize status = %d, want %d: %s", w.Code, http.StatusFound, w.Body.String())
+	}
+	loc, _ := url.Parse(w.Header().Get("Location"))
+	if !strings.HasPrefix(loc.String(), idp.URL+"/auth") {
+		t.Fatalf("Redirect = %s, want IdP authorize endpoint", loc)
+	}
+	idp.nonce = loc.Query().Get("nonce")
+	return loc
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	idp := newFakeIdP(t, "alice")
+	server := setupOIDCServer(t, idp)
+
+	loc := startOIDCLogin(t, server, idp)
+	if loc.Query().Get("client_id") != "mykb" {
+		t.Errorf("client_id = %q, want mykb", loc.Query().Get("client_id"))
+	}
+
+	req := httptest.NewRequest("GET", "/oidc/callback?code=idp-code&state="+url.QueryEscape(loc.Query().Get("state")), nil)
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("Callback status = %d, want %d: %s", w.Code, http.StatusFound, w.Body.String())
+	}
+	back, _ := url.Parse(w.Header().Get("Location"))
+	if back.Host != "localhost" || back.Query().Get("code") == "" {
+		t.Errorf("Redirect = %s, want client callback with code", back)
+	}
+	if back.Query().Get("state") != "xyz" {
+		t.Errorf("state = %q, want xyz", back.Query().Get("state"))
+	}
+}
+
+func TestOIDCSubjectNotAllowed(t *testing.T) {
+	idp := newFakeIdP(t, "mallory")
+	server := setupOIDCServer(t, idp)
+
+	loc := startOIDCLogin(t, server, idp)
+
+	req := httptest.NewRequest("GET", "/oidc/callback?code=idp-code&state="+url.QueryEscape(loc.Query().Get("state")), nil)
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestOIDCNonceMismatch(t *testing.T) {
+	idp := newFakeIdP(t, "alice")
+	server := setupOIDCServer(t, idp)
+
+	loc := startOIDCLogin(t, server, idp)
+	idp.nonce = "replayed"
+
+	req := httptest.NewRequest("GET", "/oidc/callback?code=idp-code&state="+url.QueryEscape(loc.Query().Get("state")), nil)
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestOIDCCallbackInvalidState(t *testing.T) {
+	idp := newFakeIdP(t, "alice")
+	server := setupOIDCServer(t, idp)
+
+	req := httptest.NewRequest("GET", "/oidc/callback?code=idp-code&state=bogus", nil)
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestOIDCDisablesPasswordLogin(t *testing.T) {
+	idp := newFakeIdP(t, "alice")
+	server := setupOIDCServer(t, idp)
+
+	form := url.Values{"csrf_token": {"x"}, "password": {"testpass"}}
+	req := httptest.NewRequest("POST", "/authorize", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
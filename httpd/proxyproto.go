@@ -0,0 +1,214 @@
+package httpd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyHeaderTimeout bounds how long a connection may take to send its
+// PROXY protocol header.
+const proxyHeaderTimeout = 5 * time.Second
+
+// proxyV2Signature starts every PROXY protocol v2 header.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyProtoListener accepts connections from a load balancer that prefixes
+// each one with a PROXY protocol (v1 or v2) header, and reports the client
+// address from the header as the connection's RemoteAddr. Only peers in
+// trusted may send a header; their connections without a valid one are
+// dropped. Other peers are served as plain connections, so they cannot
+// choose the client address.
+type proxyProtoListener struct {
+	net.Listener
+	trusted []netip.Prefix
+}
+
+func (l *proxyProtoListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.trusts(c.RemoteAddr()) {
+		return c, nil
+	}
+	return &proxyProtoConn{Conn: c, r: bufio.NewReader(c)}, nil
+}
+
+// trusts reports whether addr is one of the trusted proxies.
+func (l *proxyProtoListener) trusts(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	ip, ok := netip.AddrFromSlice(tcp.IP)
+	if !ok {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, p := range l.trusted {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedProxies parses the addresses of trusted proxies, each a CIDR
+// prefix or a single IP.
+func ParseTrustedProxies(list []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(list))
+	for _, s := range list {
+		if ip, err := netip.ParseAddr(s); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: want an IP or CIDR prefix", s)
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+// proxyProtoConn parses the header lazily, on first Read or RemoteAddr,
+// so a slow client cannot stall the accept loop.
+type proxyProtoConn struct {
+	net.Conn
+	r *bufio.Reader
+
+	once   sync.Once
+	remote net.Addr
+	err    error
+}
+
+func (c *proxyProtoConn) init() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+
+		c.remote, c.err = readProxyHeader(c.r)
+		if c.err == nil && c.remote == nil {
+			c.remote = c.Conn.RemoteAddr() // LOCAL or UNKNOWN: health checks from the balancer
+		}
+		if c.err != nil {
+			c.err = fmt.Errorf("proxy protocol: %w", c.err)
+			c.Conn.Close()
+		}
+	})
+}
+
+func (c *proxyProtoConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+func (c *proxyProtoConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.err != nil {
+		return c.Conn.RemoteAddr()
+	}
+	return c.remote
+}
+
+// readProxyHeader consumes a PROXY protocol header and returns the source
+// address it carries, or nil when the header carries none.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	sig, err := r.Peek(len(proxyV2Signature))
+	if err == nil && bytes.Equal(sig, proxyV2Signature) {
+		return readProxyV2(r)
+	}
+	prefix, err := r.Peek(6)
+	if err != nil {
+		return nil, err
+	}
+	if string(prefix) != "PROXY " {
+		return nil, errors.New("missing header")
+	}
+	return readProxyV1(r)
+}
+
+// readProxyV1 parses "PROXY TCP4|TCP6|UNKNOWN src dst sport dport\r\n".
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < 107 { // maximum v1 header length
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	s, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		return nil, errors.New("v1 header too long or not CRLF-terminated")
+	}
+
+	fields := strings.Split(s, " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed v1 header %q", s)
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, fmt.Errorf("malformed v1 source address %q", s)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyV2 parses the binary v2 header.
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, err
+	}
+	verCmd, family := hdr[12], hdr[13]
+	payload := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("unsupported version %d", verCmd>>4)
+	}
+	switch verCmd & 0x0f {
+	case 0x0: // LOCAL
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, fmt.Errorf("unsupported command %d", verCmd&0x0f)
+	}
+
+	switch family >> 4 {
+	case 0x1: // AF_INET
+		if len(payload) < 12 {
+			return nil, errors.New("short IPv4 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 0x2: // AF_INET6
+		if len(payload) < 36 {
+			return nil, errors.New("short IPv6 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	default: // AF_UNSPEC or AF_UNIX: no usable client address
+		return nil, nil
+	}
+}
@@ -0,0 +1,153 @@
+package httpd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func proxyV2Header(cmd byte, family byte, addrs []byte) []byte {
+	h := append([]byte{}, proxyV2Signature...)
+	h = append(h, 0x20|cmd, family, 0, 0)
+	binary.BigEndian.PutUint16(h[14:16], uint16(len(addrs)))
+	return append(h, addrs...)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	v4 := []byte{203, 0, 113, 7, 10, 0, 0, 1, 0x30, 0x39, 0x01, 0xbb}
+	v6 := make([]byte, 36)
+	copy(v6, net.ParseIP("2001:db8::7"))
+	binary.BigEndian.PutUint16(v6[32:], 4242)
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string // "" means no address in the header
+		wantErr bool
+	}{
+		{"v1 tcp4", "PROXY TCP4 203.0.113.7 10.0.0.1 12345 443\r\nGET", "203.0.113.7:12345", false},
+		{"v1 tcp6", "PROXY TCP6 2001:db8::7 2001:db8::1 4242 443\r\nGET", "[2001:db8::7]:4242", false},
+		{"v1 unknown", "PROXY UNKNOWN\r\nGET", "", false},
+		{"v1 malformed", "PROXY TCP4 nonsense\r\nGET", "", true},
+		{"v1 no crlf", "PROXY TCP4 " + strings.Repeat("1", 120), "", true},
+		{"v2 tcp4", string(proxyV2Header(1, 0x11, v4)) + "GET", "203.0.113.7:12345", false},
+		{"v2 tcp6", string(proxyV2Header(1, 0x21, v6)) + "GET", "[2001:db8::7]:4242", false},
+		{"v2 local", string(proxyV2Header(0, 0x00, nil)) + "GET", "", false},
+		{"v2 short", string(proxyV2Header(1, 0x11, v4[:4])) + "GET", "", true},
+		{"no header", "GET / HTTP/1.1\r\n", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.input))
+			addr, err := readProxyHeader(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := ""
+			if addr != nil {
+				got = addr.String()
+			}
+			if got != tt.want {
+				t.Errorf("addr = %q, want %q", got, tt.want)
+			}
+			if rest, _ := io.ReadAll(r); string(rest) != "GET" {
+				t.Errorf("remaining = %q, want GET", rest)
+			}
+		})
+	}
+}
+
+func TestProxyProtoListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	remote := make(chan string, 1)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remote <- getIP(r)
+	})}
+	trusted, _ := ParseTrustedProxies([]string{"127.0.0.0/8"})
+	go srv.Serve(&proxyProtoListener{Listener: ln, trusted: trusted})
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "PROXY TCP6 2001:db8::7 2001:db8::1 4242 80\r\nGET / HTTP/1.1\r\nHost: x\r\n\r\n")
+
+	if got := <-remote; got != "2001:db8::7" {
+		t.Errorf("client IP = %q, want 2001:db8::7", got)
+	}
+
+	// A connection without a header is dropped
+	plain, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer plain.Close()
+	io.WriteString(plain, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	if b, _ := io.ReadAll(plain); len(b) != 0 {
+		t.Errorf("connection without PROXY header got %q", b)
+	}
+	select {
+	case got := <-remote:
+		t.Errorf("handler called for %q", got)
+	default:
+	}
+}
+
+func TestProxyProtoListenerUntrustedPeer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	remote := make(chan string, 1)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remote <- getIP(r)
+	})}
+	trusted, _ := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	go srv.Serve(&proxyProtoListener{Listener: ln, trusted: trusted})
+	defer srv.Close()
+
+	// A peer that is not a trusted proxy is served as it connected
+	plain, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer plain.Close()
+	io.WriteString(plain, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	if got := <-remote; got != "127.0.0.1" {
+		t.Errorf("client IP = %q, want 127.0.0.1", got)
+	}
+
+	// and cannot claim another client address
+	spoof, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer spoof.Close()
+	io.WriteString(spoof, "PROXY TCP4 203.0.113.9 127.0.0.1 4242 80\r\nGET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(spoof), nil)
+	if err != nil {
+		t.Fatalf("ReadResponse: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", resp.StatusCode)
+	}
+	select {
+	case got := <-remote:
+		t.Errorf("handler called for %q", got)
+	default:
+	}
+}
@@ -2,9 +2,14 @@ package httpd
 
 import (
 	"log"
+	"math"
 	"net"
 	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/time/rate"
@@ -18,6 +23,7 @@ type IPRateLimiter struct {
 	burst       int
 	behindProxy bool
 	warnedProxy bool // log warning only once
+	rejected    atomic.Int64
 	stop        chan struct{}
 }
 
@@ -46,15 +52,17 @@ func (rl *IPRateLimiter) Stop() {
 }
 
 func (rl *IPRateLimiter) getLimiter(ip string) *rate.Limiter {
+	key := rateLimitKey(ip)
+
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
-	v, exists := rl.limiters[ip]
+	v, exists := rl.limiters[key]
 	if !exists {
 		v = &visitorLimiter{
 			limiter: rate.NewLimiter(rl.rate, rl.burst),
 		}
-		rl.limiters[ip] = v
+		rl.limiters[key] = v
 	}
 	v.lastSeen = time.Now()
 	return v.limiter
@@ -62,7 +70,25 @@ func (rl *IPRateLimiter) getLimiter(ip string) *rate.Limiter {
 
 // Allow checks if request from ip is allowed.
 func (rl *IPRateLimiter) Allow(ip string) bool {
-	return rl.getLimiter(ip).Allow()
+	return rl.retryAfter(ip) == 0
+}
+
+// retryAfter admits a request from ip and returns 0, or rejects it and
+// returns how long until the next request would be admitted.
+func (rl *IPRateLimiter) retryAfter(ip string) time.Duration {
+	r := rl.getLimiter(ip).Reserve()
+	wait := r.Delay()
+	if wait > 0 {
+		r.Cancel()
+		rl.rejected.Add(1)
+	}
+	return wait
+}
+
+// Rejected returns how many requests were rejected since the limiter was
+// created.
+func (rl *IPRateLimiter) Rejected() int64 {
+	return rl.rejected.Load()
 }
 
 // cleanup removes stale entries every minute.
@@ -86,6 +112,21 @@ func (rl *IPRateLimiter) cleanup() {
 	}
 }
 
+// rateLimitKey returns the bucket for a client address. IPv6 clients are
+// grouped by /64, since one host usually controls a whole /64 and could
+// otherwise rotate addresses to dodge the limit.
+func rateLimitKey(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap().WithZone("")
+	if addr.Is4() {
+		return addr.String()
+	}
+	return netip.PrefixFrom(addr, 64).Masked().String()
+}
+
 // getIP extracts client IP from request.
 func getIP(r *http.Request) string {
 	ip, _, err := net.SplitHostPort(r.RemoteAddr)
@@ -99,38 +140,43 @@ func getIP(r *http.Request) string {
 func getIPFromXFF(xff string) string {
 	for i := 0; i < len(xff); i++ {
 		if xff[i] == ',' {
-			return xff[:i]
+			xff = xff[:i]
+			break
+		}
+	}
+	return strings.TrimSpace(xff)
+}
+
+// clientIP returns the address r is limited by.
+func (rl *IPRateLimiter) clientIP(r *http.Request) string {
+	xff := r.Header.Get("X-Forwarded-For")
+	if rl.behindProxy && xff != "" {
+		return getIPFromXFF(xff)
+	}
+	// Warn if we see XFF but are not configured to trust it
+	if xff != "" && !rl.warnedProxy {
+		rl.mu.Lock()
+		if !rl.warnedProxy {
+			log.Printf("WARNING: X-Forwarded-For header detected but --behind-proxy not set. " +
+				"If behind a proxy, all clients will share one rate limit. " +
+				"Use --behind-proxy flag if running behind a reverse proxy.")
+			rl.warnedProxy = true
 		}
+		rl.mu.Unlock()
 	}
-	return xff
+	return getIP(r)
 }
 
 // RateLimit wraps a handler with rate limiting.
 func (rl *IPRateLimiter) RateLimit(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var ip string
-		xff := r.Header.Get("X-Forwarded-For")
-
-		if rl.behindProxy && xff != "" {
-			ip = getIPFromXFF(xff)
-		} else {
-			ip = getIP(r)
-			// Warn if we see XFF but are not configured to trust it
-			if xff != "" && !rl.warnedProxy {
-				rl.mu.Lock()
-				if !rl.warnedProxy {
-					log.Printf("WARNING: X-Forwarded-For header detected but --behind-proxy not set. " +
-						"If behind a proxy, all clients will share one rate limit. " +
-						"Use --behind-proxy flag if running behind a reverse proxy.")
-					rl.warnedProxy = true
-				}
-				rl.mu.Unlock()
-			}
-		}
-
-		if !rl.Allow(ip) {
-			w.Header().Set("Retry-After", "1")
-			writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		if wait := rl.retryAfter(rl.clientIP(r)); wait > 0 {
+			secs := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(secs))
+			writeJSON(w, http.StatusTooManyRequests, map[string]any{
+				"error":       "rate limit exceeded",
+				"retry_after": secs,
+			})
 			return
 		}
 		next(w, r)
@@ -39,6 +39,7 @@ func TestGetIPFromXFF(t *testing.T) {
 		{"1.2.3.4", "1.2.3.4"},
 		{"1.2.3.4, 5.6.7.8", "1.2.3.4"},
 		{"1.2.3.4, 5.6.7.8, 9.10.11.12", "1.2.3.4"},
+		{" 2001:db8::1 , 5.6.7.8", "2001:db8::1"},
 		{"", ""},
 	}
 
@@ -210,4 +211,44 @@ func TestRateLimiterEnforcesLimit(t *testing.T) {
 	if w.Code != http.StatusTooManyRequests {
 		t.Errorf("request 3: expected 429, got %d", w.Code)
 	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+	if !strings.Contains(w.Body.String(), `"retry_after":1`) {
+		t.Errorf("body = %s", w.Body.String())
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"1.2.3.4", "1.2.3.4"},
+		{"::ffff:1.2.3.4", "1.2.3.4"},
+		{"2001:db8:1:2:3:4:5:6", "2001:db8:1:2::/64"},
+		{"2001:db8:1:2::ffff", "2001:db8:1:2::/64"},
+		{"fe80::1%eth0", "fe80::/64"},
+		{"not-an-ip", "not-an-ip"},
+	}
+	for _, tt := range tests {
+		if got := rateLimitKey(tt.ip); got != tt.want {
+			t.Errorf("rateLimitKey(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimiterSharesIPv6Slash64(t *testing.T) {
+	rl := NewIPRateLimiter(0.001, 1, false)
+	defer rl.Stop()
+
+	if !rl.Allow("2001:db8:1:2::1") {
+		t.Fatal("first request should be allowed")
+	}
+	if rl.Allow("2001:db8:1:2::2") {
+		t.Error("address in the same /64 should share the limit")
+	}
+	if !rl.Allow("2001:db8:1:3::1") {
+		t.Error("address in another /64 should have its own limit")
+	}
 }
@@ -4,11 +4,19 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/netip"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/neoden/mykb/backup"
+	"github.com/neoden/mykb/events"
 	"github.com/neoden/mykb/mcp"
 	"github.com/neoden/mykb/storage"
 	"golang.org/x/crypto/acme/autocert"
@@ -22,9 +30,40 @@ type Config struct {
 	BaseURL     string // Base URL for OAuth endpoints
 	BehindProxy bool   // Trust X-Forwarded-For header for client IP
 
+	// ProxyProtocol expects a PROXY protocol header on every connection
+	// from TrustedProxies (a TCP load balancer) and takes the client IP from
+	// it. Connections from other peers are served without one.
+	ProxyProtocol  bool
+	TrustedProxies []netip.Prefix
+
+	Events         *events.Bus    // Activity feed served at /admin/events and /events (optional)
+	AdminToken     string         // Bearer token accepted by /admin endpoints
+	BackupDir      string         // Where POST /admin/backup writes backups (optional)
+	BackupUploader BackupUploader // Uploads backups made via POST /admin/backup (optional)
+
+	Maintainer Maintainer // Stats and reindexing for the /admin dashboard (optional)
+
+	Replication       ReplicationMonitor // Continuous replication, reported by /health (optional)
+	MaxReplicationLag time.Duration      // /health fails beyond this lag (0: never)
+
+	JWTAccessTokens bool          // Issue signed JWT access tokens instead of opaque DB tokens
+	KeyRotation     time.Duration // JWT signing key lifetime
+
+	OIDC OIDCConfig // Upstream identity provider (replaces password login when set)
+
+	Hooks []HookConfig // Inbound webhooks served at /hooks/<name> (optional)
+
+	MaxAttachmentSize int64 // Largest upload to POST /chunks/{id}/attachments
+
+	// ReadOnly serves a read-only mirror: endpoints that issue tokens or
+	// register clients are not served. Opaque access tokens issued by the
+	// primary reach the mirror with the replicated database and are accepted.
+	ReadOnly bool
+
 	TokenExpiry        time.Duration
 	RefreshTokenExpiry time.Duration
 	CodeExpiry         time.Duration
+	DeviceCodeExpiry   time.Duration
 }
 
 // DefaultConfig returns configuration with default values.
@@ -34,6 +73,9 @@ func DefaultConfig() *Config {
 		TokenExpiry:        time.Hour,
 		RefreshTokenExpiry: 30 * 24 * time.Hour,
 		CodeExpiry:         5 * time.Minute,
+		DeviceCodeExpiry:   10 * time.Minute,
+		KeyRotation:        30 * 24 * time.Hour,
+		MaxAttachmentSize:  storage.DefaultAttachmentMaxMB << 20,
 	}
 }
 
@@ -43,7 +85,22 @@ type Server struct {
 	mcp         *mcp.Server
 	config      *Config
 	rateLimiter *IPRateLimiter
+	pollLimiter *IPRateLimiter
+	jwt         *jwtIssuer
+	oidc        *oidcProvider
 	mux         *http.ServeMux
+
+	mu      sync.Mutex
+	servers []*http.Server // running servers, stopped by Shutdown
+
+	activity     activity
+	stopActivity func()
+	reindexing   atomic.Bool // a dashboard-started reindex is running
+
+	// ctx is cancelled by Shutdown, which then waits for background work
+	ctx        context.Context
+	cancel     context.CancelFunc
+	background sync.WaitGroup
 }
 
 // NewServer creates a new HTTP server.
@@ -53,8 +110,17 @@ func NewServer(db *storage.DB, mcpServer *mcp.Server, config *Config) *Server {
 		mcp:         mcpServer,
 		config:      config,
 		rateLimiter: NewIPRateLimiter(0.1, 3, config.BehindProxy), // 1 req/10sec, burst 3
+		pollLimiter: NewIPRateLimiter(1, 10, config.BehindProxy),  // device code polls, see rateLimitToken
+		jwt:         newJWTIssuer(db, config),
 		mux:         http.NewServeMux(),
 	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	if config.Events != nil {
+		s.stopActivity = s.activity.watch(config.Events)
+	}
+	if config.OIDC.Enabled() {
+		s.oidc = newOIDCProvider(config.OIDC)
+	}
 	s.registerRoutes()
 	return s
 }
@@ -65,18 +131,81 @@ func (s *Server) registerRoutes() {
 	s.mux.HandleFunc("GET /.well-known/oauth-authorization-server/mcp", s.handleOAuthMetadata)
 	s.mux.HandleFunc("GET /.well-known/oauth-protected-resource", s.handleProtectedResourceMetadata)
 	s.mux.HandleFunc("GET /.well-known/oauth-protected-resource/mcp", s.handleProtectedResourceMetadata)
+	if s.config.JWTAccessTokens && !s.config.ReadOnly {
+		s.mux.HandleFunc("GET /.well-known/jwks.json", s.handleJWKS)
+	}
+
+	// MCP endpoint
+	s.mux.HandleFunc("POST /mcp", s.requireToolAuth(s.handleMCP))
+
+	// Chunk change feed
+	if s.config.Events != nil {
+		s.mux.HandleFunc("GET /events", s.requireAuth(s.handleEvents))
+	}
+
+	// Attachment downloads; uploads are served below unless read-only
+	s.mux.HandleFunc("GET /chunks/{id}/attachments", s.requireToolAuth(s.handleChunkAttachments))
+	s.mux.HandleFunc("GET /attachments/{id}", s.requireToolAuth(s.handleAttachmentDownload))
+
+	// Health check
+	s.mux.HandleFunc("GET /health", s.handleHealth)
+
+	// Admin
+	s.mux.HandleFunc("GET /admin", s.handleDashboard)
+	s.mux.HandleFunc("GET /admin/status", s.requireAdmin(s.handleAdminStatus))
+	if s.config.Events != nil {
+		s.mux.HandleFunc("GET /admin/events", s.requireAdmin(s.handleAdminEvents))
+	}
+	s.mux.HandleFunc("GET /admin/backup", s.requireAdmin(s.handleBackupDownload))
+	s.mux.HandleFunc("GET /admin/stats", s.requireAdmin(s.handleAdminStats))
+	s.mux.HandleFunc("GET /admin/usage", s.requireAdmin(s.handleAdminUsage))
+	if s.config.BackupDir != "" {
+		s.mux.HandleFunc("POST /admin/backup", s.requireAdmin(s.handleBackupCreate))
+	}
+
+	// Multi-instance sync (mykb sync)
+	s.mux.HandleFunc("GET /sync/changes", s.requireAdmin(s.handleSyncPull))
+
+	if s.config.ReadOnly {
+		return // tokens are issued by the primary
+	}
+
+	s.mux.HandleFunc("POST /sync/changes", s.requireAdmin(s.handleSyncPush))
+
+	s.mux.HandleFunc("POST /chunks/{id}/attachments", s.requireToolAuth(s.handleAttachmentUpload))
+	s.mux.HandleFunc("DELETE /attachments/{id}", s.requireToolAuth(s.handleAttachmentDelete))
+	s.mux.HandleFunc("POST /ingest/audio", s.requireToolAuth(s.handleAudioIngest))
+
+	// Admin dashboard maintenance
+	s.mux.HandleFunc("POST /admin/compact", s.requireAdmin(s.handleAdminCompact))
+	s.mux.HandleFunc("POST /admin/chunks/{id}/lock", s.requireAdminToken(s.handleChunkLock(true)))
+	s.mux.HandleFunc("POST /admin/chunks/{id}/unlock", s.requireAdminToken(s.handleChunkLock(false)))
+	if s.config.Maintainer != nil {
+		s.mux.HandleFunc("POST /admin/reindex", s.requireAdmin(s.handleAdminReindex))
+	}
+
+	// Inbound webhooks
+	if len(s.config.Hooks) > 0 {
+		s.mux.HandleFunc("POST /hooks/{name}", s.handleHook)
+	}
 
 	// OAuth endpoints (rate limited)
 	s.mux.HandleFunc("POST /register", s.rateLimiter.RateLimit(s.handleRegister))
 	s.mux.HandleFunc("GET /authorize", s.handleAuthorizeGet)
 	s.mux.HandleFunc("POST /authorize", s.rateLimiter.RateLimit(s.handleAuthorizePost))
-	s.mux.HandleFunc("POST /token", s.rateLimiter.RateLimit(s.handleToken))
-
-	// MCP endpoint
-	s.mux.HandleFunc("POST /mcp", s.requireAuth(s.handleMCP))
+	s.mux.HandleFunc("POST /token", s.rateLimitToken(s.handleToken))
+	s.mux.HandleFunc("POST /device_authorization", s.rateLimiter.RateLimit(s.handleDeviceAuthorization))
+	s.mux.HandleFunc("GET /device", s.handleDeviceGet)
+	s.mux.HandleFunc("POST /device", s.rateLimiter.RateLimit(s.handleDevicePost))
+	if s.config.OIDC.Enabled() {
+		s.mux.HandleFunc("GET /oidc/callback", s.rateLimiter.RateLimit(s.handleOIDCCallback))
+	}
+}
 
-	// Health check
-	s.mux.HandleFunc("GET /health", s.handleHealth)
+// Handler returns the server's routes without a listener, for serving
+// them from elsewhere (such as httptest).
+func (s *Server) Handler() http.Handler {
+	return s.mux
 }
 
 // ListenAndServe starts the HTTP or HTTPS server.
@@ -87,75 +216,182 @@ func (s *Server) ListenAndServe() error {
 	log.Printf("HTTP server listening on %s", s.config.Listen)
 	log.Printf("Base URL: %s", s.config.BaseURL)
 
-	server := &http.Server{
-		Addr:              s.config.Listen,
-		Handler:           s.mux,
-		ReadTimeout:       30 * time.Second,
-		ReadHeaderTimeout: 10 * time.Second,
-		WriteTimeout:      30 * time.Second,
-		IdleTimeout:       120 * time.Second,
+	ln, err := s.listen(s.config.Listen)
+	if err != nil {
+		return err
 	}
-	return server.ListenAndServe()
+	return s.track(s.newHTTPServer(s.mux)).Serve(ln)
+}
+
+// listen opens a TCP listener on addr, expecting PROXY protocol headers
+// when configured.
+func (s *Server) listen(addr string) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if s.config.ProxyProtocol {
+		return &proxyProtoListener{Listener: ln, trusted: s.config.TrustedProxies}, nil
+	}
+	return ln, nil
+}
+
+// certManager obtains TLS certificates and answers ACME HTTP challenges.
+// *autocert.Manager implements it; tests substitute a static certificate.
+type certManager interface {
+	GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	HTTPHandler(fallback http.Handler) http.Handler
 }
 
 func (s *Server) listenAndServeTLS() error {
 	manager := &autocert.Manager{
 		Prompt:     autocert.AcceptTOS,
-		HostPolicy: autocert.HostWhitelist(s.config.Domain),
+		HostPolicy: s.hostPolicy(),
 		Cache:      autocert.DirCache(s.config.CertCache),
 	}
 
-	// HTTPS server
-	server := &http.Server{
-		Addr:              ":443",
-		Handler:           s.mux,
-		ReadTimeout:       30 * time.Second,
-		ReadHeaderTimeout: 10 * time.Second,
-		WriteTimeout:      30 * time.Second,
-		IdleTimeout:       120 * time.Second,
-		TLSConfig: &tls.Config{
-			GetCertificate: manager.GetCertificate,
-			MinVersion:     tls.VersionTLS13,
-		},
+	httpsLn, err := s.listen(":443")
+	if err != nil {
+		return err
+	}
+	httpLn, err := s.listen(":80")
+	if err != nil {
+		httpsLn.Close()
+		return err
+	}
+
+	log.Printf("HTTPS server listening on :443")
+	log.Printf("HTTP server listening on :80 (ACME + redirect)")
+	log.Printf("Domain: %s", s.config.Domain)
+	log.Printf("Base URL: %s", s.config.BaseURL)
+	return s.serveTLS(httpsLn, httpLn, manager)
+}
+
+// hostPolicy restricts certificate issuance to the configured domain.
+func (s *Server) hostPolicy() autocert.HostPolicy {
+	return autocert.HostWhitelist(s.config.Domain)
+}
+
+// serveTLS serves HTTPS on httpsLn and ACME challenges plus HTTPS redirects
+// on httpLn. The redirect server stops when the HTTPS server does.
+func (s *Server) serveTLS(httpsLn, httpLn net.Listener, manager certManager) error {
+	server := s.newHTTPServer(s.mux)
+	server.TLSConfig = &tls.Config{
+		GetCertificate: manager.GetCertificate,
+		MinVersion:     tls.VersionTLS13,
 	}
+	redirect := s.newHTTPServer(manager.HTTPHandler(s.redirectHandler()))
+	s.track(server)
+	s.track(redirect)
 
-	// HTTP server for ACME challenges and redirect
 	go func() {
-		log.Printf("HTTP server listening on :80 (ACME + redirect)")
-		h := manager.HTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			target := "https://" + s.config.Domain + r.URL.Path
-			if r.URL.RawQuery != "" {
-				target += "?" + r.URL.RawQuery
-			}
-			http.Redirect(w, r, target, http.StatusMovedPermanently)
-		}))
-		if err := http.ListenAndServe(":80", h); err != nil {
+		if err := redirect.Serve(httpLn); err != nil && err != http.ErrServerClosed {
 			log.Printf("HTTP redirect server error: %v", err)
 		}
 	}()
 
-	log.Printf("HTTPS server listening on :443")
-	log.Printf("Domain: %s", s.config.Domain)
-	log.Printf("Base URL: %s", s.config.BaseURL)
-	return server.ListenAndServeTLS("", "")
+	err := server.ServeTLS(httpsLn, "", "")
+	redirect.Close()
+	return err
+}
+
+// redirectHandler sends plain HTTP requests to the HTTPS domain.
+func (s *Server) redirectHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := "https://" + s.config.Domain + r.URL.Path
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+}
+
+// newHTTPServer creates an http.Server with the standard timeouts.
+func (s *Server) newHTTPServer(h http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           h,
+		ReadTimeout:       30 * time.Second,
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       120 * time.Second,
+	}
+}
+
+// track registers srv to be stopped by Shutdown.
+func (s *Server) track(srv *http.Server) *http.Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.servers = append(s.servers, srv)
+	return srv
 }
 
 // Shutdown gracefully shuts down the server.
 func (s *Server) Shutdown(ctx context.Context) error {
 	s.rateLimiter.Stop()
-	return nil
+	s.pollLimiter.Stop()
+	if s.stopActivity != nil {
+		s.stopActivity()
+	}
+	s.cancel()
+	s.background.Wait()
+
+	s.mu.Lock()
+	servers := s.servers
+	s.servers = nil
+	s.mu.Unlock()
+
+	var errs []error
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	resp := map[string]any{"status": "ok"}
+	code := http.StatusOK
+	if s.config.Replication != nil {
+		st := s.config.Replication.Status()
+		if s.config.MaxReplicationLag > 0 && !st.Healthy(s.config.MaxReplicationLag) {
+			resp["status"], code = "degraded", http.StatusServiceUnavailable
+		}
+		resp["replication"] = st
+	}
+	// Semantic search being down does not fail the check; the provider's
+	// error is left to authenticated clients
+	if health := s.mcp.EmbeddingHealth(r.Context()); health.Configured {
+		health.Error = ""
+		resp["semantic_search"] = health
+	}
+	writeJSON(w, code, resp)
 }
 
-// requireAuth wraps a handler with Bearer token authentication.
+// ReplicationMonitor reports the state of continuous replication.
+type ReplicationMonitor interface {
+	Status() backup.ReplicationStatus
+}
+
+// requireAuth wraps a handler with Bearer token authentication. Child
+// tokens are refused: what they may do is granted per MCP tool, which
+// these endpoints do not map to.
 func (s *Server) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return s.authenticate(next, false)
+}
+
+// requireToolAuth is requireAuth for /mcp and the endpoints that stand
+// for a tool (attachments, audio ingest), which also accept child tokens
+// and check their grant against that tool.
+func (s *Server) requireToolAuth(next http.HandlerFunc) http.HandlerFunc {
+	return s.authenticate(next, true)
+}
+
+func (s *Server) authenticate(next http.HandlerFunc, delegated bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		auth := r.Header.Get("Authorization")
 		if !strings.HasPrefix(auth, "Bearer ") {
-			log.Printf("AUTH FAILED: missing token from %s", getIP(r))
+			s.authFailed("missing token from %s", getIP(r))
 			w.Header().Set("WWW-Authenticate", `Bearer realm="mykb"`)
 			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing token"})
 			return
@@ -163,25 +399,54 @@ func (s *Server) requireAuth(next http.HandlerFunc) http.HandlerFunc {
 
 		token := strings.TrimPrefix(auth, "Bearer ")
 		if token == "" {
-			log.Printf("AUTH FAILED: empty token from %s", getIP(r))
+			s.authFailed("empty token from %s", getIP(r))
 			w.Header().Set("WWW-Authenticate", `Bearer realm="mykb"`)
 			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing token"})
 			return
 		}
-		hash := storage.HashToken(token)
-
-		_, err := s.db.ValidateToken(hash, storage.TokenAccess)
+		clientID, grant, err := s.validateAccessToken(r.Context(), token)
 		if err != nil {
-			log.Printf("AUTH FAILED: invalid token from %s", getIP(r))
+			s.authFailed("invalid token from %s", getIP(r))
 			w.Header().Set("WWW-Authenticate", `Bearer realm="mykb", error="invalid_token"`)
 			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid token"})
 			return
 		}
+		if grant.Delegated() && !delegated {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "child tokens may only call MCP tools"})
+			return
+		}
 
-		next(w, r)
+		ctx := mcp.WithGrant(mcp.WithClient(r.Context(), clientID), grant)
+		next(w, r.WithContext(ctx))
 	}
 }
 
+// validateAccessToken accepts JWT access tokens (when enabled) and opaque DB tokens,
+// returning the OAuth client the token was issued to and what it may do.
+// Opaque tokens remain valid after switching to JWT until they expire.
+// Child tokens minted by create_child_token are always opaque.
+func (s *Server) validateAccessToken(ctx context.Context, token string) (string, *mcp.Grant, error) {
+	if s.config.JWTAccessTokens && isJWT(token) {
+		claims, err := s.jwt.Verify(ctx, token)
+		if err != nil {
+			return "", nil, err
+		}
+		return claims.ClientID, &mcp.Grant{ExpiresAt: time.Unix(claims.ExpiresAt, 0)}, nil
+	}
+	t, err := s.db.ValidateToken(ctx, storage.HashToken(token), storage.TokenAccess)
+	if err != nil {
+		return "", nil, err
+	}
+	return t.ClientID, mcp.GrantFromToken(t), nil
+}
+
+// authFailed logs a failed authentication attempt and publishes it as an event.
+func (s *Server) authFailed(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("AUTH FAILED: %s", msg)
+	s.config.Events.Publish(events.Event{Type: events.Auth, Message: "failed: " + msg})
+}
+
 func writeJSON(w http.ResponseWriter, status int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -194,12 +459,19 @@ func writeError(w http.ResponseWriter, status int, msg string) {
 
 // LocalhostAddr extracts port from addr and returns localhost binding.
 // Used to force HTTP mode to bind only to localhost for security.
+// The IPv6 loopback ([::1]:port) is kept; any other host becomes 127.0.0.1.
 func LocalhostAddr(addr string) (listen, baseURL string) {
-	port := addr
-	if len(port) > 0 && port[0] == ':' {
-		port = port[1:]
-	} else if idx := strings.LastIndex(port, ":"); idx != -1 {
-		port = port[idx+1:]
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		// Bare port ("8080") or host without port
+		host, port = "", addr
+		if ip := net.ParseIP(strings.Trim(addr, "[]")); ip != nil {
+			host, port = ip.String(), "8080"
+		}
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.Equal(net.IPv6loopback) {
+		hostPort := net.JoinHostPort("::1", port)
+		return hostPort, "http://" + hostPort
 	}
 	return "127.0.0.1:" + port, "http://localhost:" + port
 }
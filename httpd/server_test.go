@@ -1,7 +1,9 @@
 package httpd
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -10,6 +12,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/neoden/mykb/backup"
 	"github.com/neoden/mykb/mcp"
 	"github.com/neoden/mykb/storage"
 	"github.com/neoden/mykb/vector"
@@ -27,6 +30,7 @@ func mustGenerateToken(t *testing.T) string {
 }
 
 func setupTestServer(t *testing.T) (*Server, *storage.DB) {
+	ctx := context.Background()
 	t.Helper()
 	dir := t.TempDir()
 	db, err := storage.Open(filepath.Join(dir, "test.db"))
@@ -40,7 +44,7 @@ func setupTestServer(t *testing.T) (*Server, *storage.DB) {
 
 	// Set password
 	hash, _ := bcrypt.GenerateFromPassword([]byte("testpass"), bcrypt.MinCost)
-	db.SetPasswordHash(string(hash))
+	db.SetPasswordHash(ctx, string(hash))
 
 	config := DefaultConfig()
 	config.BaseURL = "http://localhost:8080"
@@ -89,6 +93,70 @@ func TestHealthEndpoint(t *testing.T) {
 	}
 }
 
+// failingEmbedder always fails, as an unreachable provider does
+type failingEmbedder struct{}
+
+func (failingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return nil, errors.New("connection refused")
+}
+func (failingEmbedder) Dimensions() int { return 3 }
+func (failingEmbedder) Model() string   { return "mock/failing" }
+
+func TestHealthSemanticSearch(t *testing.T) {
+	server, db := setupTestServer(t)
+	server.mcp = mcp.NewServer(db, failingEmbedder{}, vector.NewIndex())
+
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	var resp struct {
+		Status         string              `json:"status"`
+		SemanticSearch mcp.EmbeddingHealth `json:"semantic_search"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || resp.Status != "ok" {
+		t.Errorf("health = %d %q; semantic search should not fail it", w.Code, resp.Status)
+	}
+	if !resp.SemanticSearch.Configured || resp.SemanticSearch.Available || resp.SemanticSearch.Error != "" {
+		t.Errorf("semantic_search = %+v, want unavailable without the error", resp.SemanticSearch)
+	}
+}
+
+type fakeReplication struct{ st backup.ReplicationStatus }
+
+func (f *fakeReplication) Status() backup.ReplicationStatus { return f.st }
+
+func TestHealthReplicationLag(t *testing.T) {
+	server, _ := setupTestServer(t)
+	lag := 3.0
+	repl := &fakeReplication{backup.ReplicationStatus{Mode: "builtin", Running: true, LagSeconds: &lag}}
+	server.config.Replication = repl
+	server.config.MaxReplicationLag = 10 * time.Second
+
+	get := func() (int, map[string]any) {
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+		var resp map[string]any
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+
+	code, resp := get()
+	replication, _ := resp["replication"].(map[string]any)
+	if code != http.StatusOK || resp["status"] != "ok" || replication["lag_seconds"] != 3.0 {
+		t.Errorf("health = %d %v", code, resp)
+	}
+
+	lag = 30
+	if code, resp := get(); code != http.StatusServiceUnavailable || resp["status"] != "degraded" {
+		t.Errorf("health with lag 30s = %d %v, want 503 degraded", code, resp)
+	}
+
+	server.config.MaxReplicationLag = 0
+	if code, _ := get(); code != http.StatusOK {
+		t.Errorf("health without max lag = %d, want 200", code)
+	}
+}
+
 func TestOAuthMetadata(t *testing.T) {
 	server, _ := setupTestServer(t)
 
@@ -173,10 +241,11 @@ func TestRegisterClientNoRedirectURIs(t *testing.T) {
 }
 
 func TestAuthorizeGetShowsForm(t *testing.T) {
+	ctx := context.Background()
 	server, db := setupTestServer(t)
 
 	// Register client first
-	db.CreateClient("test-client", "Test", []string{"http://localhost/callback"})
+	db.CreateClient(ctx, "test-client", "Test", []string{"http://localhost/callback"}, nil)
 
 	req := httptest.NewRequest("GET", "/authorize?client_id=test-client&redirect_uri=http://localhost/callback&response_type=code&code_challenge=abc&code_challenge_method=S256", nil)
 	w := httptest.NewRecorder()
@@ -224,13 +293,14 @@ func TestMCPRequiresAuth(t *testing.T) {
 }
 
 func TestMCPWithValidToken(t *testing.T) {
+	ctx := context.Background()
 	server, db := setupTestServer(t)
 
 	// Create valid token
 	token := mustGenerateToken(t)
 	hash := storage.HashToken(token)
 	expiry := time.Now().Add(time.Hour).Unix()
-	db.StoreToken(hash, storage.TokenAccess, "client", expiry, nil)
+	db.StoreToken(ctx, hash, storage.TokenAccess, "client", expiry, nil)
 
 	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
 	req.Header.Set("Content-Type", "application/json")
@@ -250,6 +320,60 @@ func TestMCPWithValidToken(t *testing.T) {
 	}
 }
 
+func TestMCPWithChildToken(t *testing.T) {
+	ctx := context.Background()
+	server, db := setupTestServer(t)
+	parent := mustGenerateToken(t)
+	db.StoreToken(ctx, storage.HashToken(parent), storage.TokenAccess, "client", time.Now().Add(time.Hour).Unix(), nil)
+
+	callTool := func(token, name string, args string) map[string]any {
+		body := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"` + name + `","arguments":` + args + `}}`
+		req := httptest.NewRequest("POST", "/mcp", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		var resp struct {
+			Result struct {
+				IsError           bool           `json:"isError"`
+				StructuredContent map[string]any `json:"structuredContent"`
+			} `json:"result"`
+		}
+		json.NewDecoder(w.Body).Decode(&resp)
+		if resp.Result.IsError {
+			return nil
+		}
+		return resp.Result.StructuredContent
+	}
+
+	minted := callTool(parent, "create_child_token", `{"tools":["search_chunks"],"name":"sub"}`)
+	child, _ := minted["access_token"].(string)
+	if child == "" {
+		t.Fatalf("create_child_token = %v", minted)
+	}
+	if tok, err := db.ValidateToken(ctx, storage.HashToken(child), storage.TokenAccess); err != nil || tok.ClientID != "client/sub" || tok.Data["parent"] != "client" {
+		t.Errorf("child token = %+v, %v", tok, err)
+	}
+	if callTool(child, "search_chunks", `{"query":"x"}`) == nil {
+		t.Error("child token could not call search_chunks")
+	}
+	if callTool(child, "store_chunk", `{"content":"x"}`) != nil {
+		t.Error("child token called store_chunk")
+	}
+
+	// Its grant covers tools only, not the database behind them
+	for _, route := range []string{"GET /admin/backup", "GET /sync/changes", "POST /sync/changes", "GET /admin/stats", "POST /admin/compact"} {
+		method, path, _ := strings.Cut(route, " ")
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"chunks":[]}`))
+		req.Header.Set("Authorization", "Bearer "+child)
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s with a child token = %d, want 403", route, w.Code)
+		}
+	}
+}
+
 func TestMCPWithInvalidToken(t *testing.T) {
 	server, _ := setupTestServer(t)
 
@@ -266,9 +390,10 @@ func TestMCPWithInvalidToken(t *testing.T) {
 }
 
 func TestAuthorizeInvalidRedirectURI(t *testing.T) {
+	ctx := context.Background()
 	server, db := setupTestServer(t)
 
-	db.CreateClient("test-client", "Test", []string{"http://localhost/callback"})
+	db.CreateClient(ctx, "test-client", "Test", []string{"http://localhost/callback"}, nil)
 
 	req := httptest.NewRequest("GET", "/authorize?client_id=test-client&redirect_uri=http://evil.com/callback&response_type=code&code_challenge=abc", nil)
 	w := httptest.NewRecorder()
@@ -281,9 +406,10 @@ func TestAuthorizeInvalidRedirectURI(t *testing.T) {
 }
 
 func TestAuthorizeDefaultCodeChallengeMethod(t *testing.T) {
+	ctx := context.Background()
 	server, db := setupTestServer(t)
 
-	db.CreateClient("test-client", "Test", []string{"http://localhost/callback"})
+	db.CreateClient(ctx, "test-client", "Test", []string{"http://localhost/callback"}, nil)
 
 	// No code_challenge_method - should default to S256
 	req := httptest.NewRequest("GET", "/authorize?client_id=test-client&redirect_uri=http://localhost/callback&response_type=code&code_challenge=abc", nil)
@@ -302,9 +428,10 @@ func TestAuthorizeDefaultCodeChallengeMethod(t *testing.T) {
 }
 
 func TestAuthorizeUnsupportedCodeChallengeMethod(t *testing.T) {
+	ctx := context.Background()
 	server, db := setupTestServer(t)
 
-	db.CreateClient("test-client", "Test", []string{"http://localhost/callback"})
+	db.CreateClient(ctx, "test-client", "Test", []string{"http://localhost/callback"}, nil)
 
 	// Use unsupported method "plain"
 	req := httptest.NewRequest("GET", "/authorize?client_id=test-client&redirect_uri=http://localhost/callback&response_type=code&code_challenge=abc&code_challenge_method=plain", nil)
@@ -318,9 +445,10 @@ func TestAuthorizeUnsupportedCodeChallengeMethod(t *testing.T) {
 }
 
 func TestAuthorizeUnsupportedResponseType(t *testing.T) {
+	ctx := context.Background()
 	server, db := setupTestServer(t)
 
-	db.CreateClient("test-client", "Test", []string{"http://localhost/callback"})
+	db.CreateClient(ctx, "test-client", "Test", []string{"http://localhost/callback"}, nil)
 
 	req := httptest.NewRequest("GET", "/authorize?client_id=test-client&redirect_uri=http://localhost/callback&response_type=token&code_challenge=abc", nil)
 	w := httptest.NewRecorder()
@@ -333,9 +461,10 @@ func TestAuthorizeUnsupportedResponseType(t *testing.T) {
 }
 
 func TestAuthorizePostInvalidCSRF(t *testing.T) {
+	ctx := context.Background()
 	server, db := setupTestServer(t)
 
-	db.CreateClient("test-client", "Test", []string{"http://localhost/callback"})
+	db.CreateClient(ctx, "test-client", "Test", []string{"http://localhost/callback"}, nil)
 
 	form := url.Values{}
 	form.Set("client_id", "test-client")
@@ -357,14 +486,15 @@ func TestAuthorizePostInvalidCSRF(t *testing.T) {
 }
 
 func TestAuthorizePostNoPasswordConfigured(t *testing.T) {
+	ctx := context.Background()
 	server, db := setupTestServerNoPassword(t)
 
-	db.CreateClient("test-client", "Test", []string{"http://localhost/callback"})
+	db.CreateClient(ctx, "test-client", "Test", []string{"http://localhost/callback"}, nil)
 
 	// Store a CSRF token manually
 	csrfToken := mustGenerateToken(t)
 	csrfExpiry := time.Now().Add(time.Minute).Unix()
-	db.StoreToken(storage.HashToken(csrfToken), storage.TokenCSRF, "test-client", csrfExpiry, map[string]string{
+	db.StoreToken(ctx, storage.HashToken(csrfToken), storage.TokenCSRF, "test-client", csrfExpiry, map[string]string{
 		"client_id":             "test-client",
 		"redirect_uri":          "http://localhost/callback",
 		"code_challenge":        "abc",
@@ -388,9 +518,10 @@ func TestAuthorizePostNoPasswordConfigured(t *testing.T) {
 }
 
 func TestAuthorizePostInvalidPassword(t *testing.T) {
+	ctx := context.Background()
 	server, db := setupTestServer(t)
 
-	db.CreateClient("test-client", "Test", []string{"http://localhost/callback"})
+	db.CreateClient(ctx, "test-client", "Test", []string{"http://localhost/callback"}, nil)
 
 	// Get CSRF token
 	authURL := "/authorize?client_id=test-client&redirect_uri=http://localhost/callback&response_type=code&code_challenge=abc&code_challenge_method=S256"
@@ -515,9 +646,10 @@ func TestTokenMissingRefreshToken(t *testing.T) {
 }
 
 func TestTokenPKCEVerificationFailure(t *testing.T) {
+	ctx := context.Background()
 	server, db := setupTestServer(t)
 
-	db.CreateClient("pkce-client", "Test", []string{"http://localhost/callback"})
+	db.CreateClient(ctx, "pkce-client", "Test", []string{"http://localhost/callback"}, nil)
 
 	// Get CSRF and submit authorization with one challenge
 	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
@@ -576,10 +708,11 @@ func TestTokenPKCEVerificationFailure(t *testing.T) {
 }
 
 func TestTokenClientIDMismatch(t *testing.T) {
+	ctx := context.Background()
 	server, db := setupTestServer(t)
 
-	db.CreateClient("client-a", "Test A", []string{"http://localhost/callback"})
-	db.CreateClient("client-b", "Test B", []string{"http://localhost/callback"})
+	db.CreateClient(ctx, "client-a", "Test A", []string{"http://localhost/callback"}, nil)
+	db.CreateClient(ctx, "client-b", "Test B", []string{"http://localhost/callback"}, nil)
 
 	// Authorize as client-a
 	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
@@ -632,9 +765,10 @@ func TestTokenClientIDMismatch(t *testing.T) {
 }
 
 func TestTokenRedirectURIMismatch(t *testing.T) {
+	ctx := context.Background()
 	server, db := setupTestServer(t)
 
-	db.CreateClient("redirect-client", "Test", []string{"http://localhost/callback", "http://localhost/other"})
+	db.CreateClient(ctx, "redirect-client", "Test", []string{"http://localhost/callback", "http://localhost/other"}, nil)
 
 	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
 	challenge := HashPKCE(verifier)
@@ -799,15 +933,16 @@ func TestRefreshTokenMissingClientID(t *testing.T) {
 }
 
 func TestRefreshTokenClientMismatch(t *testing.T) {
+	ctx := context.Background()
 	server, db := setupTestServer(t)
 
-	db.CreateClient("client-a", "Test A", []string{"http://localhost/callback"})
-	db.CreateClient("client-b", "Test B", []string{"http://localhost/callback"})
+	db.CreateClient(ctx, "client-a", "Test A", []string{"http://localhost/callback"}, nil)
+	db.CreateClient(ctx, "client-b", "Test B", []string{"http://localhost/callback"}, nil)
 
 	// Create refresh token for client-a
 	refreshToken := mustGenerateToken(t)
 	expiry := time.Now().Add(time.Hour).Unix()
-	db.StoreToken(storage.HashToken(refreshToken), storage.TokenRefresh, "client-a", expiry, nil)
+	db.StoreToken(ctx, storage.HashToken(refreshToken), storage.TokenRefresh, "client-a", expiry, nil)
 
 	// Try to use it with client-b
 	form := url.Values{}
@@ -827,16 +962,17 @@ func TestRefreshTokenClientMismatch(t *testing.T) {
 }
 
 func TestRefreshTokenExpired(t *testing.T) {
+	ctx := context.Background()
 	server, db := setupTestServer(t)
 
-	db.CreateClient("test-client", "Test", []string{"http://localhost/callback"})
+	db.CreateClient(ctx, "test-client", "Test", []string{"http://localhost/callback"}, nil)
 
 	// Create expired refresh token (expired 1 hour ago)
 	// StoreToken's cleanup only deletes existing expired tokens before insert,
 	// so inserting with past expiry works
 	refreshToken := mustGenerateToken(t)
 	expiry := time.Now().Add(-time.Hour).Unix()
-	db.StoreToken(storage.HashToken(refreshToken), storage.TokenRefresh, "test-client", expiry, nil)
+	db.StoreToken(ctx, storage.HashToken(refreshToken), storage.TokenRefresh, "test-client", expiry, nil)
 
 	form := url.Values{}
 	form.Set("grant_type", "refresh_token")
@@ -861,14 +997,15 @@ func TestRefreshTokenExpired(t *testing.T) {
 }
 
 func TestRefreshTokenWrongTokenType(t *testing.T) {
+	ctx := context.Background()
 	server, db := setupTestServer(t)
 
-	db.CreateClient("test-client", "Test", []string{"http://localhost/callback"})
+	db.CreateClient(ctx, "test-client", "Test", []string{"http://localhost/callback"}, nil)
 
 	// Create an access token (not refresh token)
 	accessToken := mustGenerateToken(t)
 	expiry := time.Now().Add(time.Hour).Unix()
-	db.StoreToken(storage.HashToken(accessToken), storage.TokenAccess, "test-client", expiry, nil)
+	db.StoreToken(ctx, storage.HashToken(accessToken), storage.TokenAccess, "test-client", expiry, nil)
 
 	// Try to use access token as refresh token
 	form := url.Values{}
@@ -894,12 +1031,13 @@ func TestRefreshTokenWrongTokenType(t *testing.T) {
 }
 
 func TestMCPInvalidContentType(t *testing.T) {
+	ctx := context.Background()
 	server, db := setupTestServer(t)
 
 	token := mustGenerateToken(t)
 	hash := storage.HashToken(token)
 	expiry := time.Now().Add(time.Hour).Unix()
-	db.StoreToken(hash, storage.TokenAccess, "client", expiry, nil)
+	db.StoreToken(ctx, hash, storage.TokenAccess, "client", expiry, nil)
 
 	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
 	req.Header.Set("Content-Type", "text/plain")
@@ -914,13 +1052,14 @@ func TestMCPInvalidContentType(t *testing.T) {
 }
 
 func TestMCPParseError(t *testing.T) {
+	ctx := context.Background()
 	server, db := setupTestServer(t)
 
 	// Create valid token
 	token := mustGenerateToken(t)
 	hash := storage.HashToken(token)
 	expiry := time.Now().Add(time.Hour).Unix()
-	db.StoreToken(hash, storage.TokenAccess, "client", expiry, nil)
+	db.StoreToken(ctx, hash, storage.TokenAccess, "client", expiry, nil)
 
 	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{invalid json`))
 	req.Header.Set("Content-Type", "application/json")
@@ -942,10 +1081,11 @@ func TestMCPParseError(t *testing.T) {
 }
 
 func TestFullOAuthFlow(t *testing.T) {
+	ctx := context.Background()
 	server, db := setupTestServer(t)
 
 	// 1. Register client
-	db.CreateClient("flow-client", "Test", []string{"http://localhost/callback"})
+	db.CreateClient(ctx, "flow-client", "Test", []string{"http://localhost/callback"}, nil)
 
 	// 2. Get authorize page to get CSRF token
 	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
@@ -1072,6 +1212,11 @@ func TestLocalhostAddr(t *testing.T) {
 		{"8080", "127.0.0.1:8080", "http://localhost:8080"},
 		{"0.0.0.0:8080", "127.0.0.1:8080", "http://localhost:8080"},
 		{"192.168.1.1:3000", "127.0.0.1:3000", "http://localhost:3000"},
+		{"[::]:8080", "127.0.0.1:8080", "http://localhost:8080"},
+		{"[2001:db8::1]:8080", "127.0.0.1:8080", "http://localhost:8080"},
+		{"[::1]:8080", "[::1]:8080", "http://[::1]:8080"},
+		{"::1", "[::1]:8080", "http://[::1]:8080"},
+		{"2001:db8::1", "127.0.0.1:8080", "http://localhost:8080"},
 	}
 
 	for _, tt := range tests {
@@ -1101,3 +1246,90 @@ func TestLocalhostAddrIgnoresExternalBindings(t *testing.T) {
 		}
 	}
 }
+
+func TestReadOnlyMirrorRoutes(t *testing.T) {
+	ctx := context.Background()
+	_, db := setupTestServer(t)
+	token := mustGenerateToken(t)
+	db.StoreToken(ctx, storage.HashToken(token), storage.TokenAccess, "client-1", time.Now().Add(time.Hour).Unix(), nil)
+
+	config := DefaultConfig()
+	config.BaseURL = "http://localhost:8080"
+	config.ReadOnly = true
+	server := NewServer(db, mcp.NewServer(db, nil, vector.NewIndex()), config)
+
+	for _, path := range []string{"/token", "/register", "/authorize"} {
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest("POST", path, nil))
+		if w.Code != http.StatusNotFound && w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("POST %s = %d, want not served", path, w.Code)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("POST /mcp with primary's token = %d, want 200", w.Code)
+	}
+}
+
+func TestAttachmentEndpoints(t *testing.T) {
+	ctx := context.Background()
+	server, db := setupTestServer(t)
+	token := mustGenerateToken(t)
+	db.StoreToken(ctx, storage.HashToken(token), storage.TokenAccess, "client", time.Now().Add(time.Hour).Unix(), nil)
+	readOnly := mustGenerateToken(t)
+	db.StoreToken(ctx, storage.HashToken(readOnly), storage.TokenAccess, "client/sub", time.Now().Add(time.Hour).Unix(),
+		map[string]string{mcp.TokenDataTools: "get_chunk"})
+	chunk, _ := db.CreateChunk(ctx, "meeting recording", nil)
+
+	do := func(token, method, path, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(token, "POST", "/chunks/"+chunk.ID+"/attachments?name=call.ogg", "audio/ogg", "OggS audio")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload: status = %d: %s", w.Code, w.Body.String())
+	}
+	var a storage.Attachment
+	json.Unmarshal(w.Body.Bytes(), &a)
+
+	w = do(readOnly, "GET", "/attachments/"+a.ID, "", "")
+	if w.Code != http.StatusOK || w.Body.String() != "OggS audio" || w.Header().Get("Content-Type") != "audio/ogg" {
+		t.Errorf("download: status = %d, type %q, body %q", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, "call.ogg") {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	w = do(token, "GET", "/chunks/"+chunk.ID+"/attachments", "", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), a.ID) {
+		t.Errorf("list: status = %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := do(readOnly, "POST", "/chunks/"+chunk.ID+"/attachments?name=x", "text/plain", "x"); w.Code != http.StatusForbidden {
+		t.Errorf("upload with a get_chunk token: status = %d, want 403", w.Code)
+	}
+	if w := do(token, "POST", "/chunks/missing/attachments?name=x", "text/plain", "x"); w.Code != http.StatusNotFound {
+		t.Errorf("upload to missing chunk: status = %d, want 404", w.Code)
+	}
+	server.config.MaxAttachmentSize = 4
+	if w := do(token, "POST", "/chunks/"+chunk.ID+"/attachments?name=x", "text/plain", "too large"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized upload: status = %d, want 413", w.Code)
+	}
+
+	if w := do(token, "DELETE", "/attachments/"+a.ID, "", ""); w.Code != http.StatusNoContent {
+		t.Errorf("delete: status = %d", w.Code)
+	}
+	if w := do(token, "GET", "/attachments/"+a.ID, "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("download after delete: status = %d, want 404", w.Code)
+	}
+}
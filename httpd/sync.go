@@ -0,0 +1,103 @@
+package httpd
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/neoden/mykb/mcp"
+	"github.com/neoden/mykb/storage"
+)
+
+// maxSyncBodySize bounds a pushed batch of changes, which carries whole
+// chunks.
+const maxSyncBodySize = 64 << 20
+
+// SyncChanges is a batch of changes exchanged by mykb sync.
+type SyncChanges struct {
+	// Now is the server's clock when the changes were read; the next pull
+	// asks for changes since then.
+	Now        time.Time           `json:"now,omitempty"`
+	Chunks     []storage.Chunk     `json:"chunks"`
+	Tombstones []storage.Tombstone `json:"tombstones"`
+}
+
+// SyncResult is what applying pushed changes did.
+type SyncResult struct {
+	Applied  int `json:"applied"`
+	Deleted  int `json:"deleted"`
+	Deferred int `json:"embeddings_deferred,omitempty"`
+}
+
+// handleSyncPull returns the chunks changed and deleted after ?since (RFC
+// 3339; all chunks when omitted).
+func (s *Server) handleSyncPull(w http.ResponseWriter, r *http.Request) {
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			writeError(w, http.StatusBadRequest, "since must be an RFC 3339 time")
+			return
+		}
+	}
+	now := time.Now().UTC()
+	chunks, tombstones, err := s.db.ChangesSince(r.Context(), since)
+	if err != nil {
+		log.Printf("Sync pull: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to read changes")
+		return
+	}
+	writeJSON(w, http.StatusOK, SyncChanges{Now: now, Chunks: chunks, Tombstones: tombstones})
+}
+
+// handleSyncPush applies changes pushed by another instance. The pushing
+// side has already resolved conflicts, so its versions replace ours.
+func (s *Server) handleSyncPush(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxSyncBodySize)
+	var changes SyncChanges
+	if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid changes")
+		return
+	}
+	for _, c := range changes.Chunks {
+		if c.ID == "" {
+			writeError(w, http.StatusBadRequest, "chunk without id")
+			return
+		}
+	}
+
+	// Locked chunks refuse the whole push, before any of it is applied
+	ids := make([]string, 0, len(changes.Chunks)+len(changes.Tombstones))
+	for _, c := range changes.Chunks {
+		ids = append(ids, c.ID)
+	}
+	for _, t := range changes.Tombstones {
+		ids = append(ids, t.ChunkID)
+	}
+	if err := s.mcp.CheckUnlocked(r.Context(), ids...); err != nil {
+		if errors.Is(err, mcp.ErrPermissionDenied) {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		log.Printf("Sync push: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to apply changes")
+		return
+	}
+
+	var res SyncResult
+	var err error
+	if res.Deferred, err = s.mcp.PutChunks(r.Context(), changes.Chunks); err != nil {
+		log.Printf("Sync push: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to apply changes")
+		return
+	}
+	res.Applied = len(changes.Chunks)
+	if res.Deleted, err = s.mcp.DeleteChunks(r.Context(), ids[len(changes.Chunks):]); err != nil {
+		log.Printf("Sync push: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to apply changes")
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
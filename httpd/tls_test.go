@@ -0,0 +1,140 @@
+package httpd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// fakeCertManager serves a self-signed certificate and records whether
+// plain HTTP requests passed through its ACME handler.
+type fakeCertManager struct {
+	cert       tls.Certificate
+	acmeCalled bool
+}
+
+func newFakeCertManager(t *testing.T, host string) *fakeCertManager {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	return &fakeCertManager{cert: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}}
+}
+
+func (m *fakeCertManager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return &m.cert, nil
+}
+
+func (m *fakeCertManager) HTTPHandler(fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.acmeCalled = true
+		fallback.ServeHTTP(w, r)
+	})
+}
+
+func listenLocal(t *testing.T) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	return ln
+}
+
+func TestServeTLS(t *testing.T) {
+	server, _ := setupTestServer(t)
+	server.config.Domain = "kb.example.com"
+
+	httpsLn, httpLn := listenLocal(t), listenLocal(t)
+	manager := newFakeCertManager(t, "kb.example.com")
+	done := make(chan error, 1)
+	go func() { done <- server.serveTLS(httpsLn, httpLn, manager) }()
+
+	// HTTPS serves the API with TLS 1.3
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true, ServerName: "kb.example.com"},
+	}}
+	resp, err := client.Get("https://" + httpsLn.Addr().String() + "/health")
+	if err != nil {
+		t.Fatalf("HTTPS request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("HTTPS status = %d, want 200", resp.StatusCode)
+	}
+	if resp.TLS == nil || resp.TLS.Version != tls.VersionTLS13 {
+		t.Errorf("TLS state = %+v, want TLS 1.3", resp.TLS)
+	}
+
+	// Plain HTTP goes through the ACME handler and redirects to HTTPS
+	noFollow := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err = noFollow.Get("http://" + httpLn.Addr().String() + "/mcp?x=1")
+	if err != nil {
+		t.Fatalf("HTTP request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMovedPermanently {
+		t.Errorf("redirect status = %d, want 301", resp.StatusCode)
+	}
+	if loc := resp.Header.Get("Location"); loc != "https://kb.example.com/mcp?x=1" {
+		t.Errorf("Location = %q", loc)
+	}
+	if !manager.acmeCalled {
+		t.Error("redirect bypassed the ACME handler")
+	}
+
+	// Shutdown stops both servers
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != http.ErrServerClosed {
+			t.Errorf("serveTLS = %v, want ErrServerClosed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serveTLS did not return after Shutdown")
+	}
+	if conn, err := net.DialTimeout("tcp", httpLn.Addr().String(), time.Second); err == nil {
+		conn.Close()
+		t.Error("redirect server still accepting connections")
+	}
+}
+
+func TestHostPolicy(t *testing.T) {
+	server, _ := setupTestServer(t)
+	server.config.Domain = "kb.example.com"
+	policy := server.hostPolicy()
+
+	if err := policy(context.Background(), "kb.example.com"); err != nil {
+		t.Errorf("configured domain rejected: %v", err)
+	}
+	for _, host := range []string{"evil.example.com", "example.com", "127.0.0.1"} {
+		if err := policy(context.Background(), host); err == nil {
+			t.Errorf("host %q allowed", host)
+		}
+	}
+}
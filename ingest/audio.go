@@ -0,0 +1,25 @@
+package ingest
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// audioTypes maps the extensions of audio files that can be transcribed to
+// their media types.
+var audioTypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".wav":  "audio/wav",
+	".ogg":  "audio/ogg",
+	".oga":  "audio/ogg",
+	".opus": "audio/ogg",
+	".flac": "audio/flac",
+	".webm": "audio/webm",
+}
+
+// AudioType returns the media type of an audio file by its extension, or
+// "" if path is not one.
+func AudioType(path string) string {
+	return audioTypes[strings.ToLower(filepath.Ext(path))]
+}
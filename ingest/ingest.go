@@ -0,0 +1,174 @@
+// Package ingest turns whole documents (markdown, HTML, plain text or PDF,
+// from a file or URL) into overlapping chunks.
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/neoden/mykb/bookmarks"
+)
+
+// httpClient fetches documents from public addresses only, since URLs come
+// from agents.
+var httpClient = bookmarks.PublicClient(30 * time.Second)
+
+// Document formats.
+const (
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+	FormatText     = "text"
+	FormatPDF      = "pdf"
+)
+
+// Document is the text of one source document.
+type Document struct {
+	// Source is the path or URL the document came from.
+	Source string
+	Title  string
+	// Text is the extracted text; chunk offsets index into it.
+	Text string
+	// Pages holds the offset in Text at which each page starts, for
+	// paginated formats (PDF). Each page is then chunked separately.
+	Pages []int
+}
+
+// Load reads a document from a local path or an http(s) URL.
+func Load(ctx context.Context, src string) (*Document, error) {
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		data, format, err := fetch(ctx, src)
+		if err != nil {
+			return nil, fmt.Errorf("fetch %s: %w", src, err)
+		}
+		return Parse(src, data, format)
+	}
+
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(src)
+	if err != nil {
+		abs = src
+	}
+	return Parse(abs, data, "")
+}
+
+// Parse extracts the text of data. An empty format is inferred from the
+// source's extension, falling back to sniffing for HTML.
+func Parse(source string, data []byte, format string) (*Document, error) {
+	if format == "" {
+		format = detectFormat(source, data)
+	}
+	doc := &Document{Source: source}
+	switch format {
+	case FormatHTML:
+		page, err := bookmarks.Extract(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		doc.Title, doc.Text = page.Title, pageText(page)
+	case FormatMarkdown:
+		doc.Text = strings.TrimSpace(string(data))
+		doc.Title = markdownTitle(doc.Text)
+	case FormatText:
+		doc.Text = strings.TrimSpace(string(data))
+	case FormatPDF:
+		title, pages, err := extractPDF(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+		doc.Title = title
+		doc.Text, doc.Pages = joinPages(pages)
+		if strings.TrimSpace(doc.Text) == "" {
+			doc.Text = "" // scanned pages: nothing but images
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %q: expected markdown, html, text or pdf", format)
+	}
+	if doc.Title == "" && source != "" {
+		doc.Title = strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+	}
+	if doc.Text == "" {
+		return nil, fmt.Errorf("%s: no text to ingest", source)
+	}
+	return doc, nil
+}
+
+// fetch downloads url, returning its body and the format its content type
+// implies (empty to infer it from the URL and body).
+func fetch(ctx context.Context, url string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, "", fmt.Errorf("%s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, bookmarks.DefaultMaxBytes))
+	if err != nil {
+		return nil, "", fmt.Errorf("read body: %w", err)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		return data, FormatHTML, nil
+	case mediaType == "text/markdown":
+		return data, FormatMarkdown, nil
+	case mediaType == "application/pdf":
+		return data, FormatPDF, nil
+	case mediaType == "" || strings.HasPrefix(mediaType, "text/"):
+		return data, "", nil
+	}
+	return nil, "", fmt.Errorf("unsupported content type %s", mediaType)
+}
+
+// pageText separates the blocks of an extracted page as paragraphs.
+func pageText(page *bookmarks.Page) string {
+	return strings.ReplaceAll(page.Text, "\n", "\n\n")
+}
+
+func detectFormat(source string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(source)) {
+	case ".md", ".markdown":
+		return FormatMarkdown
+	case ".html", ".htm", ".xhtml":
+		return FormatHTML
+	case ".txt", ".text":
+		return FormatText
+	case ".pdf":
+		return FormatPDF
+	}
+	if bytes.HasPrefix(data, []byte("%PDF-")) {
+		return FormatPDF
+	}
+	head := bytes.ToLower(bytes.TrimSpace(data[:min(len(data), 512)]))
+	if bytes.HasPrefix(head, []byte("<!doctype html")) || bytes.HasPrefix(head, []byte("<html")) {
+		return FormatHTML
+	}
+	return FormatMarkdown // plain text is valid markdown
+}
+
+// markdownTitle returns the text of the first level-one heading.
+func markdownTitle(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if title, ok := strings.CutPrefix(line, "# "); ok {
+			return strings.TrimSpace(title)
+		}
+	}
+	return ""
+}
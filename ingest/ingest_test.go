@@ -0,0 +1,86 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/neoden/mykb/bookmarks"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name, source, data, format string
+		title, text                string
+	}{
+		{"markdown by extension", "/notes/go.md", "# Go tips\n\nUse gofmt.\n", "", "Go tips", "# Go tips\n\nUse gofmt."},
+		{"html by extension", "page.html", "<title>T</title><p>One</p><p>Two</p>", "", "T", "One\n\nTwo"},
+		{"sniffed html", "", "<!DOCTYPE html><title>T</title><p>Body</p>", "", "T", "Body"},
+		{"text keeps its name as title", "/tmp/log.txt", "line one\nline two", "", "log", "line one\nline two"},
+		{"explicit format", "x.md", "<p>raw</p>", FormatText, "x", "<p>raw</p>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(tt.source, []byte(tt.data), tt.format)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if doc.Title != tt.title || doc.Text != tt.text {
+				t.Errorf("Parse = %q, %q; want %q, %q", doc.Title, doc.Text, tt.title, tt.text)
+			}
+		})
+	}
+
+	if _, err := Parse("x", []byte("  \n"), ""); err == nil {
+		t.Error("expected error for empty document")
+	}
+	if _, err := Parse("x", []byte("text"), "pdf"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/readme":
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprint(w, "# Readme\n\n```\ncode\n```")
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<title>Page</title><p>Hello</p>")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	ctx := context.Background()
+
+	// The test server is on loopback, which is refused unless allowed
+	if _, err := Load(ctx, ts.URL+"/page"); err == nil || !strings.Contains(err.Error(), "not a public address") {
+		t.Errorf("Load(loopback) = %v, want refused", err)
+	}
+	bookmarks.AllowPrivate = true
+	t.Cleanup(func() { bookmarks.AllowPrivate = false })
+
+	// Plain text from a URL is kept verbatim as markdown
+	if doc, err := Load(ctx, ts.URL+"/readme"); err != nil || doc.Title != "Readme" || !strings.Contains(doc.Text, "```\ncode\n```") {
+		t.Errorf("Load(readme) = %+v, %v", doc, err)
+	}
+	if doc, err := Load(ctx, ts.URL+"/page"); err != nil || doc.Title != "Page" || doc.Text != "Hello" {
+		t.Errorf("Load(page) = %+v, %v", doc, err)
+	}
+	if _, err := Load(ctx, ts.URL+"/missing"); err == nil {
+		t.Error("expected error for 404")
+	}
+
+	path := filepath.Join(t.TempDir(), "note.md")
+	os.WriteFile(path, []byte("Body"), 0644)
+	if doc, err := Load(ctx, path); err != nil || doc.Source != path || doc.Title != "note" {
+		t.Errorf("Load(file) = %+v, %v", doc, err)
+	}
+}
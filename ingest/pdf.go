@@ -0,0 +1,597 @@
+package ingest
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// This is a text extractor, not a renderer: it reads the page tree, runs
+// each page's content streams through the text operators and maps string
+// bytes to Unicode with the font's ToUnicode CMap or, for simple fonts,
+// its encoding. Layout is approximated from text positioning operators,
+// which is enough to chunk and search prose. Scanned pages (images only)
+// yield no text.
+
+// PDF object types. Numbers are float64, booleans bool and null nil.
+type (
+	pdfName    string
+	pdfString  string // raw bytes
+	pdfKeyword string // operator or unknown bare word
+	pdfArray   []any
+	pdfDict    map[pdfName]any
+	pdfRef     struct{ num, gen int }
+	pdfStream  struct {
+		dict pdfDict
+		raw  []byte
+	}
+)
+
+// maxPDFDepth bounds reference chains and page tree nesting.
+const maxPDFDepth = 32
+
+var (
+	pdfObjHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+	errPDFSyntax = errors.New("pdf syntax error")
+)
+
+// pdfLexer parses PDF objects and content stream tokens from data.
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelim(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// word reads a run of regular characters.
+func (l *pdfLexer) word() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelim(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+// object parses the next object; io.EOF at end of data.
+func (l *pdfLexer) object() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+	switch c := l.data[l.pos]; {
+	case c == '/':
+		l.pos++
+		return pdfName(decodeNameEscapes(l.word())), nil
+	case c == '(':
+		return l.literalString()
+	case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		l.pos += 2
+		return l.dictOrStream()
+	case c == '<':
+		return l.hexString()
+	case c == '[':
+		l.pos++
+		var arr pdfArray
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.data) {
+				return nil, errPDFSyntax
+			}
+			if l.data[l.pos] == ']' {
+				l.pos++
+				return arr, nil
+			}
+			v, err := l.object()
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+	case c == '+' || c == '-' || c == '.' || c >= '0' && c <= '9':
+		return l.numberOrRef()
+	case isPDFDelim(c):
+		l.pos++ // stray delimiter
+		return pdfKeyword(c), nil
+	default:
+		switch w := l.word(); w {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		default:
+			return pdfKeyword(w), nil
+		}
+	}
+}
+
+func (l *pdfLexer) numberOrRef() (any, error) {
+	w := l.word()
+	n, err := strconv.ParseFloat(w, 64)
+	if err != nil {
+		return nil, errPDFSyntax
+	}
+	// "num gen R" is a reference
+	if !strings.ContainsAny(w, ".+-") {
+		save := l.pos
+		l.skipSpace()
+		gen := l.word()
+		l.skipSpace()
+		if g, err := strconv.Atoi(gen); err == nil && l.pos < len(l.data) && l.data[l.pos] == 'R' &&
+			(l.pos+1 == len(l.data) || isPDFSpace(l.data[l.pos+1]) || isPDFDelim(l.data[l.pos+1])) {
+			l.pos++
+			return pdfRef{int(n), g}, nil
+		}
+		l.pos = save
+	}
+	return n, nil
+}
+
+func (l *pdfLexer) literalString() (any, error) {
+	l.pos++ // (
+	var b []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return pdfString(b), nil
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return nil, errPDFSyntax
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n': // line continuation
+				if e == '\r' && l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return nil, errPDFSyntax
+}
+
+func (l *pdfLexer) hexString() (any, error) {
+	l.pos++ // <
+	end := bytes.IndexByte(l.data[l.pos:], '>')
+	if end < 0 {
+		return nil, errPDFSyntax
+	}
+	s := l.data[l.pos : l.pos+end]
+	l.pos += end + 1
+	return pdfString(decodeHex(s)), nil
+}
+
+func (l *pdfLexer) dictOrStream() (any, error) {
+	d := pdfDict{}
+	for {
+		l.skipSpace()
+		if l.pos+1 < len(l.data) && l.data[l.pos] == '>' && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			break
+		}
+		k, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(pdfName)
+		if !ok {
+			return nil, errPDFSyntax
+		}
+		v, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		d[key] = v
+	}
+
+	save := l.pos
+	l.skipSpace()
+	if !bytes.HasPrefix(l.data[l.pos:], []byte("stream")) {
+		l.pos = save
+		return d, nil
+	}
+	l.pos += len("stream")
+	if l.pos < len(l.data) && l.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+		l.pos++
+	}
+	start := l.pos
+
+	// Trust a direct /Length if endstream follows it; it may be an
+	// indirect object, so fall back to searching for endstream
+	if n, ok := d["Length"].(float64); ok && n >= 0 && start+int(n) <= len(l.data) {
+		end := start + int(n)
+		after := &pdfLexer{data: l.data, pos: end}
+		after.skipSpace()
+		if bytes.HasPrefix(l.data[after.pos:], []byte("endstream")) {
+			l.pos = after.pos + len("endstream")
+			return &pdfStream{dict: d, raw: l.data[start:end]}, nil
+		}
+	}
+	end := bytes.Index(l.data[start:], []byte("endstream"))
+	if end < 0 {
+		return nil, errPDFSyntax
+	}
+	raw := bytes.TrimRight(l.data[start:start+end], "\r\n")
+	l.pos = start + end + len("endstream")
+	return &pdfStream{dict: d, raw: raw}, nil
+}
+
+func decodeNameEscapes(s string) string {
+	if !strings.Contains(s, "#") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '#' && i+2 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func decodeHex(s []byte) []byte {
+	var digits []byte
+	for _, c := range s {
+		if !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, 0, len(digits)/2)
+	for i := 0; i < len(digits); i += 2 {
+		v, err := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+		if err != nil {
+			break
+		}
+		out = append(out, byte(v))
+	}
+	return out
+}
+
+// pdfFile holds the objects of a PDF, found by scanning rather than via
+// the cross-reference table so damaged files still yield text.
+type pdfFile struct {
+	objects map[int]any
+	trailer pdfDict
+}
+
+func parsePDF(data []byte) (*pdfFile, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \r\n\t"), []byte("%PDF-")) {
+		return nil, fmt.Errorf("not a PDF file")
+	}
+	f := &pdfFile{objects: make(map[int]any), trailer: pdfDict{}}
+
+	// Later definitions win, as incremental updates append to the file
+	next := 0
+	for _, m := range pdfObjHeader.FindAllSubmatchIndex(data, -1) {
+		if m[0] < next {
+			continue // inside the previous object's stream
+		}
+		num, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+		l := &pdfLexer{data: data, pos: m[1]}
+		obj, err := l.object()
+		if err != nil {
+			continue
+		}
+		f.objects[num] = obj
+		next = l.pos
+	}
+	if len(f.objects) == 0 {
+		return nil, fmt.Errorf("no objects found")
+	}
+
+	// Trailer dictionaries, or the cross-reference streams replacing them
+	for i := 0; ; {
+		j := bytes.Index(data[i:], []byte("trailer"))
+		if j < 0 {
+			break
+		}
+		l := &pdfLexer{data: data, pos: i + j + len("trailer")}
+		if d, err := l.object(); err == nil {
+			if d, ok := d.(pdfDict); ok {
+				for k, v := range d {
+					f.trailer[k] = v
+				}
+			}
+		}
+		i += j + len("trailer")
+	}
+	for _, obj := range f.objects {
+		if s, ok := obj.(*pdfStream); ok && s.dict["Type"] == pdfName("XRef") {
+			for _, k := range []pdfName{"Root", "Info", "Encrypt"} {
+				if _, ok := f.trailer[k]; !ok && s.dict[k] != nil {
+					f.trailer[k] = s.dict[k]
+				}
+			}
+		}
+	}
+	if f.trailer["Encrypt"] != nil {
+		return nil, fmt.Errorf("encrypted PDFs are not supported")
+	}
+
+	f.loadObjectStreams()
+	return f, nil
+}
+
+// loadObjectStreams adds the objects compressed into object streams.
+func (f *pdfFile) loadObjectStreams() {
+	var streams []*pdfStream
+	for _, obj := range f.objects {
+		if s, ok := obj.(*pdfStream); ok && s.dict["Type"] == pdfName("ObjStm") {
+			streams = append(streams, s)
+		}
+	}
+	for _, s := range streams {
+		data, err := f.decode(s)
+		if err != nil {
+			continue
+		}
+		n, _ := f.resolve(s.dict["N"]).(float64)
+		first, _ := f.resolve(s.dict["First"]).(float64)
+		header := &pdfLexer{data: data}
+		for i := 0; i < int(n); i++ {
+			num, err1 := header.object()
+			off, err2 := header.object()
+			numF, ok1 := num.(float64)
+			offF, ok2 := off.(float64)
+			if err1 != nil || err2 != nil || !ok1 || !ok2 {
+				break
+			}
+			if _, ok := f.objects[int(numF)]; ok {
+				continue
+			}
+			l := &pdfLexer{data: data, pos: int(first) + int(offF)}
+			if l.pos >= len(data) {
+				continue
+			}
+			if obj, err := l.object(); err == nil {
+				f.objects[int(numF)] = obj
+			}
+		}
+	}
+}
+
+// resolve follows references to the object they name.
+func (f *pdfFile) resolve(v any) any {
+	for i := 0; i < maxPDFDepth; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = f.objects[ref.num]
+	}
+	return nil
+}
+
+func (f *pdfFile) dict(v any) pdfDict {
+	switch v := f.resolve(v).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	}
+	return nil
+}
+
+// decode returns the decoded data of a stream.
+func (f *pdfFile) decode(s *pdfStream) ([]byte, error) {
+	var filters []any
+	switch v := f.resolve(s.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []any{v}
+	case pdfArray:
+		filters = v
+	}
+	data := s.raw
+	for _, name := range filters {
+		switch f.resolve(name) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			r, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			// Keep what inflated before a truncated or corrupt tail
+			out, err := io.ReadAll(r)
+			if err != nil && len(out) == 0 {
+				return nil, err
+			}
+			data = out
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			if i := bytes.IndexByte(data, '>'); i >= 0 {
+				data = data[:i]
+			}
+			data = decodeHex(data)
+		default:
+			return nil, fmt.Errorf("unsupported filter %v", name)
+		}
+	}
+	return data, nil
+}
+
+// pages returns the page dictionaries in order, each with the resources
+// it inherits from the page tree.
+func (f *pdfFile) pages() []pdfPage {
+	root := f.dict(f.trailer["Root"])
+	if root == nil {
+		for _, obj := range f.objects {
+			if d, ok := obj.(pdfDict); ok && d["Type"] == pdfName("Catalog") {
+				root = d
+				break
+			}
+		}
+	}
+	if root == nil {
+		return nil
+	}
+
+	var out []pdfPage
+	seen := make(map[pdfRef]bool)
+	var walk func(node any, resources pdfDict, depth int)
+	walk = func(node any, resources pdfDict, depth int) {
+		if ref, ok := node.(pdfRef); ok {
+			if seen[ref] {
+				return
+			}
+			seen[ref] = true
+		}
+		d := f.dict(node)
+		if d == nil || depth > maxPDFDepth {
+			return
+		}
+		if r := f.dict(d["Resources"]); r != nil {
+			resources = r
+		}
+		if kids, ok := f.resolve(d["Kids"]).(pdfArray); ok {
+			for _, kid := range kids {
+				walk(kid, resources, depth+1)
+			}
+			return
+		}
+		out = append(out, pdfPage{dict: d, resources: resources})
+	}
+	walk(root["Pages"], nil, 0)
+	return out
+}
+
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+// contents returns the page's concatenated content streams.
+func (f *pdfFile) contents(p pdfPage) []byte {
+	var streams []any
+	switch v := f.resolve(p.dict["Contents"]).(type) {
+	case *pdfStream:
+		streams = []any{v}
+	case pdfArray:
+		streams = v
+	}
+	var out []byte
+	for _, s := range streams {
+		if s, ok := f.resolve(s).(*pdfStream); ok {
+			if data, err := f.decode(s); err == nil {
+				out = append(out, data...)
+				out = append(out, '\n')
+			}
+		}
+	}
+	return out
+}
+
+// infoTitle returns the document title from the info dictionary.
+func (f *pdfFile) infoTitle() string {
+	if s, ok := f.resolve(f.dict(f.trailer["Info"])["Title"]).(pdfString); ok {
+		return strings.TrimSpace(textString(string(s)))
+	}
+	return ""
+}
+
+// textString decodes a PDF text string: UTF-16BE with a byte order mark,
+// otherwise PDFDocEncoding (treated as Latin-1).
+func textString(s string) string {
+	if strings.HasPrefix(s, "\xfe\xff") {
+		return utf16BE([]byte(s[2:]))
+	}
+	r := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		r[i] = rune(s[i])
+	}
+	return string(r)
+}
+
+func utf16BE(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return string(utf16.Decode(u))
+}
+
+// extractPDF returns the document title and the text of each page.
+func extractPDF(data []byte) (string, []string, error) {
+	f, err := parsePDF(data)
+	if err != nil {
+		return "", nil, err
+	}
+	pages := f.pages()
+	if len(pages) == 0 {
+		return "", nil, fmt.Errorf("no pages found")
+	}
+	fonts := make(map[any]*pdfFont)
+	texts := make([]string, len(pages))
+	for i, p := range pages {
+		texts[i] = f.pageText(p, fonts)
+	}
+	return f.infoTitle(), texts, nil
+}
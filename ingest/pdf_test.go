@@ -0,0 +1,132 @@
+package ingest
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func flate(s string) string {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write([]byte(s))
+	w.Close()
+	return b.String()
+}
+
+func stream(dict, data string) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+// testPDF builds a two-page PDF whose page objects sit in a compressed
+// object stream and whose fonts are inherited from the page tree.
+func testPDF() []byte {
+	cmap := `/CIDInit /ProcSet findresource begin
+begincmap
+1 begincodespacerange <0000> <FFFF> endcodespacerange
+1 beginbfchar <0001> <0048> endbfchar
+1 beginbfrange <0002> <0003> <0069> endbfrange
+endcmap`
+	page1 := `BT /F1 12 Tf 72 720 Td (Hello, world) Tj 0 -14 Td [(Split) -300 (words)] TJ
+T* (exam-) Tj T* (ple it' s) Tj ET`
+	page2a := `BT /F2 12 Tf <00010002> Tj ET`
+	page2b := `BT /F1 12 Tf 1 0 0 1 72 700 Tm (page two) Tj 1 0 0 1 72 686 Tm (more) Tj ET`
+
+	pages := []string{
+		"<< /Type /Page /Parent 2 0 R /Contents 7 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /Contents [8 0 R 9 0 R] >>",
+	}
+	header := fmt.Sprintf("3 0 4 %d ", len(pages[0])+1)
+	objStm := header + pages[0] + " " + pages[1]
+
+	objects := map[int]string{
+		1:  "<< /Type /Catalog /Pages 2 0 R >>",
+		2:  "<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /Resources << /Font << /F1 5 0 R /F2 6 0 R >> >> >>",
+		5:  "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding << /Differences [39 /quoteright] >> >>",
+		6:  "<< /Type /Font /Subtype /Type0 /BaseFont /Custom /ToUnicode 11 0 R >>",
+		7:  stream("", page1),
+		8:  stream("/Filter /FlateDecode", flate(page2a)),
+		9:  stream("", page2b),
+		10: stream(fmt.Sprintf("/Type /ObjStm /N 2 /First %d /Filter /FlateDecode", len(header)), flate(objStm)),
+		11: stream("", cmap),
+		12: "<< /Title (Test Paper) >>",
+	}
+	var b strings.Builder
+	b.WriteString("%PDF-1.7\n")
+	for _, n := range []int{1, 2, 5, 6, 7, 8, 9, 10, 11, 12} {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", n, objects[n])
+	}
+	b.WriteString("trailer\n<< /Root 1 0 R /Info 12 0 R >>\n%%EOF\n")
+	return []byte(b.String())
+}
+
+func TestExtractPDF(t *testing.T) {
+	title, pages, err := extractPDF(testPDF())
+	if err != nil {
+		t.Fatalf("extractPDF: %v", err)
+	}
+	if title != "Test Paper" {
+		t.Errorf("title = %q", title)
+	}
+	want := []string{
+		"Hello, world\nSplit words\nexample it’ s",
+		"Hi page two\nmore",
+	}
+	if len(pages) != len(want) {
+		t.Fatalf("got %d pages, want %d: %q", len(pages), len(want), pages)
+	}
+	for i := range want {
+		if pages[i] != want[i] {
+			t.Errorf("page %d = %q, want %q", i+1, pages[i], want[i])
+		}
+	}
+
+	if _, _, err := extractPDF([]byte("not a pdf")); err == nil {
+		t.Error("expected error for non-PDF data")
+	}
+	encrypted := bytes.Replace(testPDF(), []byte("/Info 12 0 R"), []byte("/Info 12 0 R /Encrypt 12 0 R"), 1)
+	if _, _, err := extractPDF(encrypted); err == nil {
+		t.Error("expected error for encrypted PDF")
+	}
+}
+
+func TestParsePDFPages(t *testing.T) {
+	doc, err := Parse("/papers/test.pdf", testPDF(), "")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if doc.Title != "Test Paper" || len(doc.Pages) != 2 {
+		t.Fatalf("doc = %+v", doc)
+	}
+
+	pieces := Config{ChunkTokens: 4, OverlapTokens: 1}.SplitDocument(doc)
+	pagesSeen := map[int]bool{}
+	for _, p := range pieces {
+		if doc.Text[p.Start:p.End] != p.Text {
+			t.Errorf("piece %q does not match its offsets", p.Text)
+		}
+		pageEnd := len(doc.Text)
+		if p.Page < len(doc.Pages) {
+			pageEnd = doc.Pages[p.Page]
+		}
+		if p.Page < 1 || p.Start < doc.Pages[p.Page-1] || p.End > pageEnd {
+			t.Errorf("piece %q (page %d) crosses a page boundary", p.Text, p.Page)
+		}
+		pagesSeen[p.Page] = true
+	}
+	if !pagesSeen[1] || !pagesSeen[2] {
+		t.Errorf("pieces cover pages %v, want 1 and 2", pagesSeen)
+	}
+}
+
+func TestCleanPDFText(t *testing.T) {
+	got := cleanPDFText("  two   spaces\x01\n\ninfor-\nmation re-\nLinked\n")
+	if want := "two spaces\ninformation re-\nLinked"; got != want {
+		t.Errorf("cleanPDFText = %q, want %q", got, want)
+	}
+	if len(winAnsi1252) != 32 {
+		t.Errorf("winAnsi1252 has %d entries, want 32", len(winAnsi1252))
+	}
+}
@@ -0,0 +1,385 @@
+package ingest
+
+import (
+	"bytes"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tjSpace is the TJ adjustment (thousandths of an em) taken as a word gap.
+const tjSpace = -250
+
+// maxCMapRange bounds how many codes one bfrange entry may map.
+const maxCMapRange = 1 << 16
+
+var (
+	pdfInlineImageEnd = regexp.MustCompile(`\sEI(?:\s|$)`)
+	pdfSpaces         = regexp.MustCompile(`[ \t]+`)
+)
+
+// pdfFont maps the bytes of shown strings to text.
+type pdfFont struct {
+	toUnicode   map[string]string // code bytes to text, from the ToUnicode CMap
+	codeLen     int               // bytes per code
+	differences map[byte]string   // glyph names replacing the base encoding
+	composite   bool              // Type0: codes are glyph IDs unless mapped
+}
+
+// font returns the font resource name, cached by reference.
+func (f *pdfFile) font(fonts pdfDict, name pdfName, cache map[any]*pdfFont) *pdfFont {
+	ref := fonts[name]
+	if _, ok := ref.(pdfRef); ok {
+		if font, ok := cache[ref]; ok {
+			return font
+		}
+	}
+	d := f.dict(ref)
+	font := &pdfFont{codeLen: 1, composite: d["Subtype"] == pdfName("Type0")}
+	if font.composite {
+		font.codeLen = 2
+	}
+	if s, ok := f.resolve(d["ToUnicode"]).(*pdfStream); ok {
+		if data, err := f.decode(s); err == nil {
+			font.toUnicode, font.codeLen = parseCMap(data, font.codeLen)
+		}
+	}
+	if enc := f.dict(d["Encoding"]); enc != nil {
+		if diffs, ok := f.resolve(enc["Differences"]).(pdfArray); ok {
+			font.differences = make(map[byte]string)
+			code := 0
+			for _, v := range diffs {
+				switch v := f.resolve(v).(type) {
+				case float64:
+					code = int(v)
+				case pdfName:
+					if code >= 0 && code < 256 {
+						font.differences[byte(code)] = string(v)
+					}
+					code++
+				}
+			}
+		}
+	}
+	if _, ok := ref.(pdfRef); ok {
+		cache[ref] = font
+	}
+	return font
+}
+
+// parseCMap reads the bfchar and bfrange mappings of a ToUnicode CMap,
+// returning them with the code length its codespace declares.
+func parseCMap(data []byte, codeLen int) (map[string]string, int) {
+	m := make(map[string]string)
+	l := &pdfLexer{data: data}
+	var ops []any
+	for {
+		obj, err := l.object()
+		if err != nil {
+			break
+		}
+		kw, ok := obj.(pdfKeyword)
+		if !ok {
+			ops = append(ops, obj)
+			continue
+		}
+		switch kw {
+		case "endcodespacerange":
+			if len(ops) > 0 {
+				if lo, ok := ops[0].(pdfString); ok && len(lo) > 0 {
+					codeLen = len(lo)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(ops); i += 2 {
+				src, ok1 := ops[i].(pdfString)
+				dst, ok2 := ops[i+1].(pdfString)
+				if ok1 && ok2 {
+					m[string(src)] = utf16BE([]byte(dst))
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(ops); i += 3 {
+				lo, ok1 := ops[i].(pdfString)
+				hi, ok2 := ops[i+1].(pdfString)
+				if !ok1 || !ok2 || len(lo) != len(hi) || len(lo) == 0 || len(lo) > 4 {
+					continue
+				}
+				start, end := codeValue(lo), codeValue(hi)
+				if end < start || end-start >= maxCMapRange {
+					continue
+				}
+				for c := start; c <= end; c++ {
+					code := codeBytes(c, len(lo))
+					switch dst := ops[i+2].(type) {
+					case pdfString:
+						if len(dst) < 2 {
+							continue
+						}
+						// The last byte of dst counts up through the range
+						next := []byte(dst)
+						next[len(next)-1] += byte(c - start)
+						m[code] = utf16BE(next)
+					case pdfArray:
+						if k := int(c - start); k < len(dst) {
+							if s, ok := dst[k].(pdfString); ok {
+								m[code] = utf16BE([]byte(s))
+							}
+						}
+					}
+				}
+			}
+		}
+		ops = ops[:0]
+	}
+	return m, codeLen
+}
+
+func codeValue(s pdfString) uint32 {
+	var v uint32
+	for i := 0; i < len(s); i++ {
+		v = v<<8 | uint32(s[i])
+	}
+	return v
+}
+
+func codeBytes(v uint32, n int) string {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return string(b)
+}
+
+// text decodes the bytes of a shown string.
+func (font *pdfFont) text(s pdfString) string {
+	var b strings.Builder
+	if font.toUnicode != nil {
+		n := max(font.codeLen, 1)
+		for i := 0; i+n <= len(s); i += n {
+			if u, ok := font.toUnicode[string(s[i:i+n])]; ok {
+				b.WriteString(u)
+			} else if !font.composite && n == 1 {
+				b.WriteString(font.simpleText(s[i]))
+			}
+		}
+		return b.String()
+	}
+	if font.composite {
+		return "" // glyph IDs with no way back to characters
+	}
+	for i := 0; i < len(s); i++ {
+		b.WriteString(font.simpleText(s[i]))
+	}
+	return b.String()
+}
+
+func (font *pdfFont) simpleText(c byte) string {
+	if name, ok := font.differences[c]; ok {
+		if t := glyphText(name); t != "" {
+			return t
+		}
+	}
+	return string(winAnsiRune(c))
+}
+
+// winAnsi1252 holds the WinAnsiEncoding characters at 0x80-0x9F, which
+// differ from Latin-1. Unused codes are 0.
+var winAnsi1252 = []rune("€\x00‚ƒ„…†‡ˆ‰Š‹Œ\x00Ž\x00\x00‘’“”•–—˜™š›œ\x00žŸ")
+
+func winAnsiRune(c byte) rune {
+	if c >= 0x80 && c < 0xA0 {
+		return winAnsi1252[c-0x80]
+	}
+	return rune(c)
+}
+
+// glyphNames maps common glyph names that are not single characters.
+var glyphNames = map[string]string{
+	"space": " ", "exclam": "!", "quotedbl": "\"", "numbersign": "#", "dollar": "$",
+	"percent": "%", "ampersand": "&", "quotesingle": "'", "parenleft": "(",
+	"parenright": ")", "asterisk": "*", "plus": "+", "comma": ",", "hyphen": "-",
+	"period": ".", "slash": "/", "colon": ":", "semicolon": ";", "less": "<",
+	"equal": "=", "greater": ">", "question": "?", "at": "@", "bracketleft": "[",
+	"backslash": "\\", "bracketright": "]", "underscore": "_", "braceleft": "{",
+	"bar": "|", "braceright": "}", "zero": "0", "one": "1", "two": "2", "three": "3",
+	"four": "4", "five": "5", "six": "6", "seven": "7", "eight": "8", "nine": "9",
+	"quoteleft": "‘", "quoteright": "’", "quotedblleft": "“", "quotedblright": "”",
+	"endash": "–", "emdash": "—", "bullet": "•", "ellipsis": "…", "minus": "−",
+	"fi": "fi", "fl": "fl", "ff": "ff", "ffi": "ffi", "ffl": "ffl",
+}
+
+func glyphText(name string) string {
+	if t, ok := glyphNames[name]; ok {
+		return t
+	}
+	if utf8.RuneCountInString(name) == 1 {
+		return name
+	}
+	if hex, ok := strings.CutPrefix(name, "uni"); ok && len(hex) == 4 {
+		if v, err := strconv.ParseUint(hex, 16, 32); err == nil {
+			return string(rune(v))
+		}
+	}
+	return ""
+}
+
+// pageText runs the page's content streams and returns the text shown.
+func (f *pdfFile) pageText(p pdfPage, cache map[any]*pdfFont) string {
+	fonts := f.dict(p.resources["Font"])
+	font := &pdfFont{codeLen: 1}
+
+	var b strings.Builder
+	last := func() byte {
+		if b.Len() == 0 {
+			return '\n'
+		}
+		return b.String()[b.Len()-1]
+	}
+	newline := func() {
+		if last() != '\n' {
+			b.WriteByte('\n')
+		}
+	}
+	space := func() {
+		if c := last(); c != '\n' && c != ' ' {
+			b.WriteByte(' ')
+		}
+	}
+	show := func(v any) {
+		if s, ok := v.(pdfString); ok {
+			b.WriteString(font.text(s))
+		}
+	}
+
+	var y float64
+	haveY := false
+	l := &pdfLexer{data: f.contents(p)}
+	var ops []any
+	for {
+		obj, err := l.object()
+		if err != nil {
+			break // end of stream, or damage the rest cannot be read past
+		}
+		kw, ok := obj.(pdfKeyword)
+		if !ok {
+			ops = append(ops, obj)
+			continue
+		}
+		num := func(i int) float64 {
+			if i < len(ops) {
+				n, _ := ops[i].(float64)
+				return n
+			}
+			return 0
+		}
+		lastOp := func() any {
+			if len(ops) == 0 {
+				return nil
+			}
+			return ops[len(ops)-1]
+		}
+
+		switch kw {
+		case "Tf":
+			if len(ops) >= 2 {
+				if name, ok := ops[len(ops)-2].(pdfName); ok && fonts != nil {
+					font = f.font(fonts, name, cache)
+				}
+			}
+		case "Tj":
+			show(lastOp())
+		case "'", "\"":
+			newline()
+			show(lastOp())
+		case "TJ":
+			arr, _ := lastOp().(pdfArray)
+			for _, v := range arr {
+				if n, ok := v.(float64); ok && n < tjSpace {
+					space()
+				}
+				show(v)
+			}
+		case "Td", "TD":
+			if ty := num(1); math.Abs(ty) > 0.1 {
+				newline()
+				y += ty
+			} else {
+				space()
+			}
+		case "T*":
+			newline()
+		case "Tm":
+			if ty := num(5); haveY && math.Abs(ty-y) > 0.1 {
+				newline()
+			} else {
+				space()
+			}
+			y, haveY = num(5), true
+		case "BI":
+			// Inline image data is binary; skip to its end marker
+			rest := l.data[l.pos:]
+			if m := pdfInlineImageEnd.FindIndex(rest); m != nil {
+				l.pos += m[1]
+			} else {
+				l.pos = len(l.data)
+			}
+		}
+		ops = ops[:0]
+	}
+	return cleanPDFText(b.String())
+}
+
+// cleanPDFText drops control characters and extra spaces and rejoins
+// words hyphenated across line breaks.
+func cleanPDFText(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' || !unicode.IsControl(r) && r != utf8.RuneError {
+			return r
+		}
+		return -1
+	}, s)
+
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(pdfSpaces.ReplaceAllString(line, " "))
+		if line == "" {
+			continue
+		}
+		if n := len(lines); n > 0 && hyphenated(lines[n-1], line) {
+			lines[n-1] = strings.TrimSuffix(lines[n-1], "-") + line
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// hyphenated reports whether a word was split between prev and next.
+func hyphenated(prev, next string) bool {
+	if !strings.HasSuffix(prev, "-") || len(prev) < 2 {
+		return false
+	}
+	before, _ := utf8.DecodeLastRuneInString(prev[:len(prev)-1])
+	first, _ := utf8.DecodeRuneInString(next)
+	return unicode.IsLetter(before) && unicode.IsLower(first)
+}
+
+// joinPages joins page texts with blank lines, returning the offset at
+// which each page starts.
+func joinPages(pages []string) (string, []int) {
+	var b bytes.Buffer
+	starts := make([]int, len(pages))
+	for i, p := range pages {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		starts[i] = b.Len()
+		b.WriteString(p)
+	}
+	return b.String(), starts
+}
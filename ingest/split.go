@@ -0,0 +1,194 @@
+package ingest
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Chunkers.
+const (
+	// ChunkParagraphs packs whole paragraphs into each chunk, splitting only
+	// paragraphs longer than a chunk.
+	ChunkParagraphs = "paragraphs"
+	// ChunkTokens cuts fixed-size windows of tokens regardless of structure.
+	ChunkTokens = "tokens"
+)
+
+// DefaultChunkTokens is the chunk size when not configured.
+const DefaultChunkTokens = 300
+
+// Config controls how documents are split. Tokens are counted as
+// whitespace-separated words, which is close enough to bound chunk size
+// without tying chunking to one embedding model's tokenizer.
+type Config struct {
+	// Chunker is "paragraphs" (default) or "tokens".
+	Chunker string `toml:"chunker"`
+	// ChunkTokens is the largest chunk (default 300).
+	ChunkTokens int `toml:"chunk_tokens"`
+	// OverlapTokens is how much of each chunk's end is repeated at the
+	// start of the next (default a sixth of ChunkTokens).
+	OverlapTokens int `toml:"overlap_tokens"`
+}
+
+// Validate checks the chunker settings.
+func (c Config) Validate() error {
+	switch c.Chunker {
+	case "", ChunkParagraphs, ChunkTokens:
+	default:
+		return fmt.Errorf("unknown chunker %q: expected paragraphs or tokens", c.Chunker)
+	}
+	if c.ChunkTokens < 0 || c.OverlapTokens < 0 {
+		return fmt.Errorf("chunk_tokens and overlap_tokens must not be negative")
+	}
+	if c.overlap() >= c.size() {
+		return fmt.Errorf("overlap_tokens (%d) must be less than chunk_tokens (%d)", c.overlap(), c.size())
+	}
+	return nil
+}
+
+func (c Config) size() int {
+	if c.ChunkTokens > 0 {
+		return c.ChunkTokens
+	}
+	return DefaultChunkTokens
+}
+
+func (c Config) overlap() int {
+	if c.OverlapTokens > 0 {
+		return c.OverlapTokens
+	}
+	return c.size() / 6
+}
+
+// Piece is one chunk of a document: Text is Document.Text[Start:End].
+type Piece struct {
+	Text  string
+	Start int
+	End   int
+	// Page is the 1-based page the piece comes from (0 if not paginated).
+	Page int
+}
+
+// span is a byte range of the text holding some number of tokens.
+type span struct {
+	start, end, tokens int
+}
+
+// SplitDocument cuts doc into overlapping pieces, never across pages.
+func (c Config) SplitDocument(doc *Document) []Piece {
+	if len(doc.Pages) == 0 {
+		return c.Split(doc.Text)
+	}
+	var out []Piece
+	for i, start := range doc.Pages {
+		end := len(doc.Text)
+		if i+1 < len(doc.Pages) {
+			end = doc.Pages[i+1]
+		}
+		for _, p := range c.Split(doc.Text[start:end]) {
+			p.Start += start
+			p.End += start
+			p.Page = i + 1
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Split cuts text into overlapping pieces.
+func (c Config) Split(text string) []Piece {
+	if c.Chunker == ChunkTokens {
+		return pieces(text, c.windows(text, 0, len(text)))
+	}
+
+	var units []span
+	for _, p := range paragraphs(text) {
+		if p.tokens <= c.size() {
+			units = append(units, p)
+		} else {
+			units = append(units, c.windows(text, p.start, p.end)...)
+		}
+	}
+
+	// Pack paragraphs up to the chunk size, starting each chunk with the
+	// trailing paragraphs of the previous one that fit in the overlap
+	var packed []span
+	for i := 0; i < len(units); {
+		j, tokens := i, 0
+		for j < len(units) && (j == i || tokens+units[j].tokens <= c.size()) {
+			tokens += units[j].tokens
+			j++
+		}
+		packed = append(packed, span{units[i].start, units[j-1].end, tokens})
+		if j == len(units) {
+			break
+		}
+		next, back := j, 0
+		for next-1 > i && back+units[next-1].tokens <= c.overlap() {
+			next--
+			back += units[next].tokens
+		}
+		i = next
+	}
+	return pieces(text, packed)
+}
+
+func pieces(text string, spans []span) []Piece {
+	out := make([]Piece, len(spans))
+	for i, s := range spans {
+		out[i] = Piece{Text: text[s.start:s.end], Start: s.start, End: s.end}
+	}
+	return out
+}
+
+// windows cuts text[start:end] into runs of up to size tokens, each
+// overlapping the previous by the configured overlap.
+func (c Config) windows(text string, start, end int) []span {
+	words := wordSpans(text[start:end])
+	var out []span
+	step := c.size() - c.overlap()
+	for i := 0; i < len(words); i += step {
+		j := min(i+c.size(), len(words))
+		out = append(out, span{start + words[i][0], start + words[j-1][1], j - i})
+		if j == len(words) {
+			break
+		}
+	}
+	return out
+}
+
+// paragraphs returns the blank-line separated blocks of text.
+func paragraphs(text string) []span {
+	var out []span
+	pos := 0
+	for _, block := range strings.SplitAfter(text, "\n\n") {
+		trimmed := strings.TrimSpace(block)
+		if trimmed != "" {
+			lead := strings.Index(block, trimmed)
+			out = append(out, span{pos + lead, pos + lead + len(trimmed), len(strings.Fields(trimmed))})
+		}
+		pos += len(block)
+	}
+	return out
+}
+
+// wordSpans returns the byte range of each whitespace-separated word.
+func wordSpans(s string) [][2]int {
+	var out [][2]int
+	start := -1
+	for i, r := range s {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				out = append(out, [2]int{start, i})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		out = append(out, [2]int{start, len(s)})
+	}
+	return out
+}
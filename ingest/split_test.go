@@ -0,0 +1,75 @@
+package ingest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func words(from, to int) string {
+	var w []string
+	for i := from; i < to; i++ {
+		w = append(w, fmt.Sprintf("w%d", i))
+	}
+	return strings.Join(w, " ")
+}
+
+func TestSplitTokens(t *testing.T) {
+	text := words(0, 25)
+	got := Config{Chunker: ChunkTokens, ChunkTokens: 10, OverlapTokens: 3}.Split(text)
+	want := []string{words(0, 10), words(7, 17), words(14, 24), words(21, 25)}
+	if len(got) != len(want) {
+		t.Fatalf("got %d pieces, want %d: %+v", len(got), len(want), got)
+	}
+	for i, p := range got {
+		if p.Text != want[i] {
+			t.Errorf("piece %d = %q, want %q", i, p.Text, want[i])
+		}
+		if text[p.Start:p.End] != p.Text {
+			t.Errorf("piece %d offsets [%d:%d] do not match its text", i, p.Start, p.End)
+		}
+	}
+}
+
+func TestSplitParagraphs(t *testing.T) {
+	paras := []string{words(0, 4), words(4, 6), words(6, 10), words(10, 24), words(24, 26)}
+	text := strings.Join(paras, "\n\n") + "\n"
+	got := Config{ChunkTokens: 8, OverlapTokens: 2}.Split(text)
+
+	want := []string{
+		paras[0] + "\n\n" + paras[1],
+		paras[1] + "\n\n" + paras[2], // a short paragraph fits in the overlap
+		words(10, 18),                // a long paragraph is split by tokens
+		words(16, 24),
+		paras[4],
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d pieces, want %d: %q", len(got), len(want), got)
+	}
+	for i, p := range got {
+		if p.Text != want[i] {
+			t.Errorf("piece %d = %q, want %q", i, p.Text, want[i])
+		}
+		if text[p.Start:p.End] != p.Text {
+			t.Errorf("piece %d offsets [%d:%d] do not match its text", i, p.Start, p.End)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		cfg Config
+		ok  bool
+	}{
+		{Config{}, true},
+		{Config{Chunker: ChunkTokens, ChunkTokens: 10}, true},
+		{Config{Chunker: "sentences"}, false},
+		{Config{ChunkTokens: -1}, false},
+		{Config{ChunkTokens: 10, OverlapTokens: 10}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); (err == nil) != tt.ok {
+			t.Errorf("Validate(%+v) = %v, want ok=%v", tt.cfg, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Package llm asks a language model to complete a prompt, through the
+// OpenAI chat completions API (or a compatible server) or a local Ollama.
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Completer answers prompts with a language model.
+type Completer interface {
+	// Complete returns the model's reply to prompt, following the
+	// instructions in system.
+	Complete(ctx context.Context, system, prompt string) (string, error)
+	// Model returns the model identifier.
+	Model() string
+}
+
+// DefaultTimeout bounds one completion when not configured.
+const DefaultTimeout = time.Minute
+
+// Config holds language model settings.
+type Config struct {
+	// Provider is "openai" (the chat completions API, or a compatible
+	// server at openai.base_url) or "ollama"; empty disables the features
+	// that need a model.
+	Provider string `toml:"provider"`
+	// TimeoutSeconds bounds each completion (default 60).
+	TimeoutSeconds int `toml:"timeout_seconds"`
+
+	OpenAI OpenAIConfig `toml:"openai"`
+	Ollama OllamaConfig `toml:"ollama"`
+}
+
+// OpenAIConfig holds OpenAI chat settings.
+type OpenAIConfig struct {
+	APIKey string `toml:"api_key"`
+	// Model defaults to gpt-4o-mini.
+	Model string `toml:"model"`
+	// BaseURL defaults to https://api.openai.com/v1.
+	BaseURL string `toml:"base_url"`
+}
+
+// OllamaConfig holds Ollama chat settings.
+type OllamaConfig struct {
+	// URL defaults to http://localhost:11434.
+	URL string `toml:"url"`
+	// Model defaults to llama3.2.
+	Model string `toml:"model"`
+}
+
+// Validate checks the language model settings.
+func (c Config) Validate() error {
+	switch c.Provider {
+	case "", "ollama":
+	case "openai":
+		if c.OpenAI.APIKey == "" {
+			return fmt.Errorf("openai.api_key not set")
+		}
+	default:
+		return fmt.Errorf("unknown provider %q: expected openai or ollama", c.Provider)
+	}
+	if c.TimeoutSeconds < 0 {
+		return fmt.Errorf("timeout_seconds must not be negative")
+	}
+	return nil
+}
+
+// Timeout returns the timeout for one completion.
+func (c Config) Timeout() time.Duration {
+	if c.TimeoutSeconds > 0 {
+		return time.Duration(c.TimeoutSeconds) * time.Second
+	}
+	return DefaultTimeout
+}
+
+// New creates the configured Completer, or returns nil if none is.
+func New(cfg Config) (Completer, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	switch cfg.Provider {
+	case "openai":
+		model := cfg.OpenAI.Model
+		if model == "" {
+			model = "gpt-4o-mini"
+		}
+		baseURL := cfg.OpenAI.BaseURL
+		if baseURL == "" {
+			baseURL = "https://api.openai.com/v1"
+		}
+		return NewOpenAICompleter(cfg.OpenAI.APIKey, model, baseURL), nil
+	case "ollama":
+		url := cfg.Ollama.URL
+		if url == "" {
+			url = "http://localhost:11434"
+		}
+		model := cfg.Ollama.Model
+		if model == "" {
+			model = "llama3.2"
+		}
+		return NewOllamaCompleter(url, model), nil
+	}
+	return nil, nil
+}
+
+// message is a chat message in the format both APIs share.
+type message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+func messages(system, prompt string) []message {
+	var msgs []message
+	if system != "" {
+		msgs = append(msgs, message{Role: "system", Content: system})
+	}
+	return append(msgs, message{Role: "user", Content: prompt})
+}
+
+// post sends a JSON request and decodes the JSON response into result.
+// The context bounds it.
+func post(ctx context.Context, url string, request any, headers map[string]string, result any) error {
+	reqBody, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBody))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
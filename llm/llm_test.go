@@ -0,0 +1,78 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAIComplete(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("Path = %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("Authorization = %q", got)
+		}
+		var req openAIRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "gpt-4o-mini" || len(req.Messages) != 2 || req.Messages[0].Role != "system" || req.Messages[1].Content != "hi" {
+			t.Errorf("request = %+v", req)
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":" hello "}}]}`))
+	}))
+	defer server.Close()
+
+	reply, err := NewOpenAICompleter("test-key", "gpt-4o-mini", server.URL+"/v1/").Complete(context.Background(), "be brief", "hi")
+	if err != nil || reply != "hello" {
+		t.Errorf("Complete = %q, %v", reply, err)
+	}
+}
+
+func TestOllamaComplete(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("Path = %s, want /api/chat", r.URL.Path)
+		}
+		var req ollamaRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Stream || len(req.Messages) != 1 {
+			t.Errorf("request = %+v", req)
+		}
+		if req.Model == "missing" {
+			http.Error(w, `{"error":"model not found"}`, http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"message":{"role":"assistant","content":"hello"}}`))
+	}))
+	defer server.Close()
+
+	reply, err := NewOllamaCompleter(server.URL+"/", "llama3.2").Complete(context.Background(), "", "hi")
+	if err != nil || reply != "hello" {
+		t.Errorf("Complete = %q, %v", reply, err)
+	}
+	if _, err := NewOllamaCompleter(server.URL, "missing").Complete(context.Background(), "", "hi"); err == nil {
+		t.Error("server error not returned")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		cfg Config
+		ok  bool
+	}{
+		{Config{}, true},
+		{Config{Provider: "openai", OpenAI: OpenAIConfig{APIKey: "k"}}, true},
+		{Config{Provider: "openai"}, false},
+		{Config{Provider: "ollama"}, true},
+		{Config{Provider: "claude"}, false},
+		{Config{TimeoutSeconds: -1}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); (err == nil) != tt.ok {
+			t.Errorf("Validate(%+v) = %v", tt.cfg, err)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// OllamaCompleter implements Completer with the /api/chat endpoint of an
+// Ollama server.
+type OllamaCompleter struct {
+	model string
+	url   string
+}
+
+// NewOllamaCompleter creates a completer for the server at url.
+func NewOllamaCompleter(url, model string) *OllamaCompleter {
+	return &OllamaCompleter{
+		model: model,
+		url:   strings.TrimRight(url, "/") + "/api/chat",
+	}
+}
+
+type ollamaRequest struct {
+	Model    string    `json:"model"`
+	Messages []message `json:"messages"`
+	Stream   bool      `json:"stream"`
+}
+
+type ollamaResponse struct {
+	Message message `json:"message"`
+}
+
+func (c *OllamaCompleter) Complete(ctx context.Context, system, prompt string) (string, error) {
+	var result ollamaResponse
+	if err := post(ctx, c.url, ollamaRequest{Model: c.model, Messages: messages(system, prompt)}, nil, &result); err != nil {
+		return "", fmt.Errorf("ollama: %w", err)
+	}
+	return strings.TrimSpace(result.Message.Content), nil
+}
+
+func (c *OllamaCompleter) Model() string {
+	return "ollama/" + c.model
+}
@@ -0,0 +1,51 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// OpenAICompleter implements Completer with the OpenAI chat completions
+// API.
+type OpenAICompleter struct {
+	apiKey string
+	model  string
+	url    string
+}
+
+// NewOpenAICompleter creates a completer for the API at baseURL.
+func NewOpenAICompleter(apiKey, model, baseURL string) *OpenAICompleter {
+	return &OpenAICompleter{
+		apiKey: apiKey,
+		model:  model,
+		url:    strings.TrimRight(baseURL, "/") + "/chat/completions",
+	}
+}
+
+type openAIRequest struct {
+	Model    string    `json:"model"`
+	Messages []message `json:"messages"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message message `json:"message"`
+	} `json:"choices"`
+}
+
+func (c *OpenAICompleter) Complete(ctx context.Context, system, prompt string) (string, error) {
+	var result openAIResponse
+	headers := map[string]string{"Authorization": "Bearer " + c.apiKey}
+	if err := post(ctx, c.url, openAIRequest{Model: c.model, Messages: messages(system, prompt)}, headers, &result); err != nil {
+		return "", fmt.Errorf("openai: %w", err)
+	}
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("openai: no choices returned")
+	}
+	return strings.TrimSpace(result.Choices[0].Message.Content), nil
+}
+
+func (c *OpenAICompleter) Model() string {
+	return "openai/" + c.model
+}
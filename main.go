@@ -2,22 +2,36 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/neoden/mykb/app"
+	"github.com/neoden/mykb/bookmarks"
 	"github.com/neoden/mykb/config"
+	"github.com/neoden/mykb/mcp"
+	"github.com/neoden/mykb/review"
+	"github.com/neoden/mykb/storage"
+	"golang.org/x/term"
 )
 
 func main() {
 	log.SetFlags(log.Ltime | log.Lshortfile)
 	log.SetOutput(os.Stderr)
 
-	var configPath string
+	var configPath, profile, dataDir string
 	flag.StringVar(&configPath, "config", "", "Config file path")
+	flag.StringVar(&profile, "profile", "", "Config profile ([profiles.<name>]) to use (default $MYKB_PROFILE)")
+	flag.StringVar(&dataDir, "data", "", "Data directory, or :memory: for a throwaway database (default data_dir)")
 	flag.Usage = usage
 	flag.Parse()
 
@@ -31,21 +45,13 @@ func main() {
 		}
 	}
 
-	// Load config
-	var cfg *config.Config
-	if configPath != "" {
-		var err error
-		cfg, err = config.Load(configPath)
-		if err != nil {
-			log.Fatalf("Failed to load config: %v", err)
-		}
-	} else {
-		cfg = config.Default()
+	// Load config; without a file, defaults and MYKB_* variables apply
+	cfg, err := config.LoadProfile(configPath, profile)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
 	}
-
-	// Validate config
-	if err := cfg.Validate(); err != nil {
-		log.Fatalf("Invalid config: %v", err)
+	if dataDir != "" {
+		cfg.DataDir = dataDir
 	}
 
 	args := flag.Args()
@@ -54,12 +60,24 @@ func main() {
 		os.Exit(1)
 	}
 
+	// mykb config needs neither a valid config nor the database
+	if args[0] == "config" {
+		showConfig(cfg, configPath, args[1:])
+		return
+	}
+
+	// Validate config
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+
 	// Initialize app
 	a, err := app.New(cfg)
 	if err != nil {
 		log.Fatalf("Failed to initialize: %v", err)
 	}
 	defer a.Close()
+	ctx := context.Background()
 
 	switch args[0] {
 	case "serve":
@@ -81,20 +99,463 @@ func main() {
 			os.Exit(1)
 		}
 
+	case "tail":
+		fs := flag.NewFlagSet("tail", flag.ExitOnError)
+		url := fs.String("url", "", "Server base URL (default from config)")
+		token := fs.String("token", "", "Admin or access token (default from data dir)")
+		fs.Parse(args[1:])
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if err := a.Tail(ctx, *url, *token, os.Stdout); err != nil {
+			log.Fatalf("Tail: %v", err)
+		}
+
 	case "set-password":
-		if err := a.SetPassword(); err != nil {
+		if err := a.SetPassword(ctx); err != nil {
 			log.Fatalf("Set password: %v", err)
 		}
 
 	case "reindex":
 		fs := flag.NewFlagSet("reindex", flag.ExitOnError)
 		force := fs.Bool("force", false, "Re-index all chunks, replacing existing embeddings")
+		batchSize := fs.Int("batch-size", 100, "Chunks per embedding request")
+		concurrency := fs.Int("concurrency", 1, "Embedding requests in flight at once")
+		resume := fs.Bool("resume", false, "Continue an interrupted reindex, skipping chunks it embedded")
+		dryRun := fs.Bool("dry-run", false, "Report the chunks, estimated tokens and cost, without embedding")
+		asJSON := fs.Bool("json", false, "Print the plan, or progress after each batch, as JSON lines")
 		fs.Parse(args[1:])
 
-		if err := a.Reindex(context.Background(), *force); err != nil {
+		opts := app.ReindexOptions{Force: *force, BatchSize: *batchSize, Concurrency: *concurrency, Resume: *resume}
+		if *dryRun {
+			plan, err := a.PlanReindex(ctx, opts)
+			if err != nil {
+				log.Fatalf("Reindex: %v", err)
+			}
+			if *asJSON {
+				json.NewEncoder(os.Stdout).Encode(plan)
+				return
+			}
+			fmt.Printf("Would embed %d chunks with %s, about %d tokens", plan.Chunks, plan.Model, plan.Tokens)
+			if plan.Priced {
+				fmt.Printf(" ($%.4f)", plan.Cost)
+			}
+			fmt.Println()
+			return
+		}
+		if *asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			opts.Progress = func(p app.ReindexProgress) { enc.Encode(p) }
+		}
+
+		// An interrupted reindex can be resumed with --resume
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if err := a.ReindexWith(ctx, opts); err != nil {
 			log.Fatalf("Reindex: %v", err)
 		}
 
+	case "export":
+		fs := flag.NewFlagSet("export", flag.ExitOnError)
+		format := fs.String("format", "", "Export format: corpus, jsonl or markdown (default jsonl for .jsonl output, else corpus)")
+		var output string
+		fs.StringVar(&output, "output", "", "Output file (default stdout)")
+		fs.StringVar(&output, "out", "", "Alias for --output")
+		embeddings := fs.Bool("embeddings", false, "Include embedding vectors (jsonl format)")
+		dir := fs.String("dir", "", "Output directory (markdown format)")
+		groupBy := fs.String("group-by", "", "Metadata key whose value names each file's subdirectory (markdown format)")
+		separator := fs.String("separator", app.DefaultCorpusSeparator, `Document separator (\n and \t are unescaped)`)
+		headers := fs.String("headers", "", "Comma-separated metadata keys to prepend as headers")
+		var include, exclude stringList
+		fs.Var(&include, "include", "Only export chunks with metadata key=value (repeatable)")
+		fs.Var(&exclude, "exclude", "Skip chunks with metadata key=value (repeatable)")
+		fs.Parse(args[1:])
+
+		opts := app.ExportOptions{
+			Format:     *format,
+			Separator:  strings.NewReplacer(`\n`, "\n", `\t`, "\t").Replace(*separator),
+			Include:    include,
+			Exclude:    exclude,
+			Embeddings: *embeddings,
+			Dir:        *dir,
+			GroupBy:    *groupBy,
+		}
+		if opts.Format == "" {
+			switch {
+			case *dir != "":
+				opts.Format = app.ExportMarkdown
+			case strings.HasSuffix(output, ".jsonl"):
+				opts.Format = app.ExportJSONL
+			default:
+				opts.Format = app.ExportCorpus
+			}
+		}
+		if *headers != "" {
+			opts.Headers = strings.Split(*headers, ",")
+		}
+
+		out := os.Stdout
+		if output != "" {
+			f, err := os.Create(output)
+			if err != nil {
+				log.Fatalf("Export: %v", err)
+			}
+			defer f.Close()
+			out = f
+		}
+		if err := a.Export(ctx, out, opts); err != nil {
+			log.Fatalf("Export: %v", err)
+		}
+
+	case "ingest":
+		fs := flag.NewFlagSet("ingest", flag.ExitOnError)
+		var meta stringList
+		fs.Var(&meta, "meta", "Add metadata key=value to every chunk (repeatable)")
+		fs.Parse(args[1:])
+		if fs.NArg() == 0 {
+			fmt.Fprintln(os.Stderr, "Usage: mykb ingest [--meta k=v] <path|url>...")
+			os.Exit(1)
+		}
+		metadata := meta.metadata("Ingest")
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		for _, src := range fs.Args() {
+			err := a.Ingest(ctx, src, metadata, func(res *mcp.IngestResult) {
+				fmt.Printf("Ingested %s: %d chunks\n", res.Source, len(res.ChunkIDs))
+				if res.Deferred > 0 {
+					fmt.Printf("  %d embeddings deferred; run mykb reindex\n", res.Deferred)
+				}
+			})
+			if err != nil {
+				log.Fatalf("Ingest: %v", err)
+			}
+		}
+
+	case "watch":
+		fs := flag.NewFlagSet("watch", flag.ExitOnError)
+		var meta stringList
+		fs.Var(&meta, "meta", "Add metadata key=value to every chunk (repeatable)")
+		interval := fs.Duration("interval", app.DefaultWatchInterval, "How often to rescan the directory")
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, "Usage: mykb watch [--meta k=v] [--interval D] <dir>")
+			os.Exit(1)
+		}
+		metadata := meta.metadata("Watch")
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		err := a.Watch(ctx, fs.Arg(0), metadata, *interval, func(ev app.WatchEvent) {
+			switch ev.Action {
+			case app.WatchFailed:
+				log.Printf("Watch %s: %v", ev.Path, ev.Err)
+			case app.WatchDeleted:
+				fmt.Printf("Deleted %s: %d chunks\n", ev.Path, ev.Chunks)
+			default:
+				fmt.Printf("%s %s: %d chunks\n", strings.ToUpper(ev.Action[:1])+ev.Action[1:], ev.Path, ev.Chunks)
+				if ev.Deferred > 0 {
+					fmt.Printf("  %d embeddings deferred; run mykb reindex\n", ev.Deferred)
+				}
+			}
+		})
+		if err != nil {
+			log.Fatalf("Watch: %v", err)
+		}
+
+	case "stats":
+		fs := flag.NewFlagSet("stats", flag.ExitOnError)
+		history := fs.Bool("history", false, "Show daily snapshots recorded by the server")
+		days := fs.Int("days", 30, "Days of history to show")
+		asJSON := fs.Bool("json", false, "Print current stats as JSON")
+		fs.Parse(args[1:])
+
+		if *history {
+			snaps, err := a.DB.StatsHistory(ctx, *days)
+			if err != nil {
+				log.Fatalf("Stats: %v", err)
+			}
+			if len(snaps) == 0 {
+				fmt.Println("No snapshots yet; a running server records one daily")
+				return
+			}
+			fmt.Printf("%-10s  %8s  %7s  %9s  %10s\n", "DAY", "CHUNKS", "CHANGE", "EMBEDDED", "SIZE")
+			for i, s := range snaps {
+				change := ""
+				if i > 0 {
+					change = fmt.Sprintf("%+d", s.Chunks-snaps[i-1].Chunks)
+				}
+				fmt.Printf("%-10s  %8d  %7s  %8.1f%%  %10s\n", s.Day, s.Chunks, change, 100*s.Coverage(), formatBytes(s.DBBytes))
+			}
+			return
+		}
+
+		s, err := a.DB.ContentStats(ctx)
+		if err != nil {
+			log.Fatalf("Stats: %v", err)
+		}
+		if *asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(s)
+			return
+		}
+		printStats(a, s)
+
+	case "retention":
+		fs := flag.NewFlagSet("retention", flag.ExitOnError)
+		apply := fs.Bool("apply", false, "Delete or archive expired chunks, and those of rules that have had a dry-run report")
+		fs.Parse(args[1:])
+		if len(cfg.Retention.Rules) == 0 && !cfg.Retention.Expiry.Enabled {
+			fmt.Println("No retention rules configured")
+			return
+		}
+
+		reports, err := a.ApplyRetention(context.Background(), *apply)
+		for _, r := range reports {
+			switch {
+			case r.DryRun && *apply:
+				fmt.Printf("%s: would %s %d chunks (new or changed rule; enforced on the next --apply)\n", r.Name, r.Action, len(r.ChunkIDs))
+			case r.DryRun:
+				fmt.Printf("%s: would %s %d chunks\n", r.Name, r.Action, len(r.ChunkIDs))
+			case r.Archive != "":
+				fmt.Printf("%s: archived %d chunks to %s\n", r.Name, len(r.ChunkIDs), r.Archive)
+			default:
+				fmt.Printf("%s: %sd %d chunks\n", r.Name, r.Action, len(r.ChunkIDs))
+			}
+		}
+		if err != nil {
+			log.Fatalf("Retention: %v", err)
+		}
+		if cfg.Retention.Expiry.Enabled {
+			r, err := a.ExpireChunks(context.Background(), *apply)
+			if err != nil {
+				log.Fatalf("Expiry: %v", err)
+			}
+			switch {
+			case r.DryRun:
+				fmt.Printf("expired: would %s %d chunks\n", r.Action, len(r.ChunkIDs))
+			case r.Archive != "":
+				fmt.Printf("expired: archived %d chunks to %s\n", len(r.ChunkIDs), r.Archive)
+			default:
+				fmt.Printf("expired: %sd %d chunks\n", r.Action, len(r.ChunkIDs))
+			}
+		}
+		if !*apply {
+			fmt.Println("Dry run; run mykb retention --apply to enforce these rules")
+		}
+
+	case "review":
+		fs := flag.NewFlagSet("review", flag.ExitOnError)
+		send := fs.Bool("send", false, "Send the queue to the [review.digest] destinations now")
+		fs.Parse(args[1:])
+		if *send {
+			n, err := a.SendReviewDigest(context.Background())
+			if err != nil {
+				log.Fatalf("Review digest: %v", err)
+			}
+			if n == 0 {
+				fmt.Println("Nothing due for review")
+			} else {
+				fmt.Printf("Sent review digest (%d chunks)\n", n)
+			}
+			return
+		}
+		items, err := a.MCP.ReviewQueue(ctx, 0)
+		if err != nil {
+			log.Fatalf("Review: %v", err)
+		}
+		fmt.Print(review.FormatDigest(items))
+
+	case "sync":
+		fs := flag.NewFlagSet("sync", flag.ExitOnError)
+		token := fs.String("token", os.Getenv("MYKB_SYNC_TOKEN"), "Access or admin token of the remote server (default $MYKB_SYNC_TOKEN)")
+		conflict := fs.String("conflict", app.SyncNewest, "Chunks changed on both sides: newest, local, remote or keep-both")
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 || *token == "" {
+			fmt.Fprintln(os.Stderr, "Usage: mykb sync [--token T] [--conflict newest|local|remote|keep-both] <remote-url>")
+			os.Exit(1)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		stats, err := a.Sync(ctx, fs.Arg(0), *token, *conflict)
+		if err != nil {
+			log.Fatalf("Sync: %v", err)
+		}
+		fmt.Printf("Pulled %d chunks and %d deletes, pushed %d chunks and %d deletes (%d conflicts)\n",
+			stats.Pulled, stats.Deleted, stats.Pushed, stats.RemoteDeleted, stats.Conflicts)
+		if stats.Deferred > 0 {
+			fmt.Printf("Run mykb reindex to embed %d pulled chunks\n", stats.Deferred)
+		}
+
+	case "git":
+		if len(args) != 2 || args[1] != "init" && args[1] != "status" {
+			fmt.Fprintln(os.Stderr, "Usage: mykb git <init|status>")
+			os.Exit(1)
+		}
+		if args[1] == "init" {
+			st, err := a.GitInit(ctx)
+			if err != nil {
+				log.Fatalf("Git init: %v", err)
+			}
+			fmt.Printf("Mirroring chunks to %s (%d commits, last: %s)\n", st.Dir, st.Commits, st.Head)
+			return
+		}
+		st, err := a.GitStatus(ctx)
+		if err != nil {
+			log.Fatalf("Git status: %v", err)
+		}
+		fmt.Printf("Repository: %s\n", st.Dir)
+		if st.Head != "" {
+			fmt.Printf("Last commit: %s (%d commits)\n", st.Head, st.Commits)
+		}
+		for _, line := range st.Uncommitted {
+			fmt.Printf("Uncommitted: %s\n", line)
+		}
+		if st.Stale > 0 || st.Orphaned > 0 {
+			fmt.Printf("Behind the database: %d changed and %d deleted chunks (committed on the next server start or mykb git init)\n", st.Stale, st.Orphaned)
+		} else {
+			fmt.Println("Up to date with the database")
+		}
+
+	case "fts":
+		if len(args) != 2 || args[1] != "check" && args[1] != "rebuild" {
+			fmt.Fprintln(os.Stderr, "Usage: mykb fts <check|rebuild>")
+			os.Exit(1)
+		}
+		check, err := a.DB.CheckFTS(ctx)
+		if err != nil {
+			log.Fatalf("FTS check: %v", err)
+		}
+		if args[1] == "check" {
+			fmt.Println(check)
+			if !check.OK() {
+				fmt.Println("Run mykb fts rebuild to repair the index")
+				os.Exit(1)
+			}
+			fmt.Println("Full-text index is in sync")
+			return
+		}
+		if a.DB.ReadOnly() {
+			log.Fatalf("FTS rebuild: the database is a read-only mirror")
+		}
+		fmt.Printf("Before: %s\n", check)
+		if err := a.DB.RebuildFTS(ctx); err != nil {
+			log.Fatalf("FTS rebuild: %v", err)
+		}
+		if check, err = a.DB.CheckFTS(ctx); err != nil {
+			log.Fatalf("FTS check: %v", err)
+		}
+		fmt.Printf("After:  %s\n", check)
+
+	case "add":
+		addChunk(a, args[1:])
+
+	case "get":
+		getChunk(ctx, a, args[1:])
+
+	case "edit":
+		editChunk(a, args[1:])
+
+	case "lock", "unlock":
+		lockChunks(ctx, a, args[0] == "lock", args[1:])
+
+	case "search", "semantic":
+		search(a, args[0] == "semantic", args[1:])
+
+	case "replay":
+		replay(ctx, a, args[1:])
+
+	case "import":
+		if len(args) > 1 && args[1] == "bookmarks" {
+			importBookmarks(a, args[2:])
+			break
+		}
+		fs := flag.NewFlagSet("import", flag.ExitOnError)
+		conflict := fs.String("conflict", app.ConflictSkip, "When a chunk ID exists: skip, overwrite or new-id")
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, "Usage: mykb import [--conflict skip|overwrite|new-id] <file.jsonl>")
+			os.Exit(1)
+		}
+
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			log.Fatalf("Import: %v", err)
+		}
+		defer f.Close()
+		stats, err := a.Import(ctx, f, *conflict)
+		if err != nil {
+			log.Fatalf("Import: %v", err)
+		}
+		fmt.Printf("Imported %d new, %d overwritten, %d renamed, %d skipped chunks (%d embeddings)\n",
+			stats.Created, stats.Overwritten, stats.Renamed, stats.Skipped, stats.Embeddings)
+		if stats.Created+stats.Overwritten+stats.Renamed > stats.Embeddings {
+			fmt.Println("Run mykb reindex to embed chunks imported without embeddings")
+		}
+
+	case "encrypt":
+		if err := a.Encrypt(ctx); err != nil {
+			log.Fatalf("Encrypt: %v", err)
+		}
+
+	case "backup":
+		fs := flag.NewFlagSet("backup", flag.ExitOnError)
+		remote := fs.Bool("remote", false, "Upload the backup to the configured S3 bucket")
+		fs.Parse(args[1:])
+		if fs.NArg() > 1 || (fs.NArg() == 0 && !*remote) {
+			fmt.Fprintln(os.Stderr, "Usage: mykb backup [--remote] <path>")
+			os.Exit(1)
+		}
+
+		if err := a.Backup(context.Background(), fs.Arg(0), *remote); err != nil {
+			log.Fatalf("Backup: %v", err)
+		}
+
+	case "restore":
+		fs := flag.NewFlagSet("restore", flag.ExitOnError)
+		force := fs.Bool("force", false, "Replace a database that already has chunks")
+		timestamp := fs.String("timestamp", "", "Restore the replica as of this RFC 3339 time")
+		fs.Parse(args[1:])
+		if fs.NArg() > 1 || (fs.NArg() == 1) == (*timestamp != "") {
+			fmt.Fprintln(os.Stderr, "Usage: mykb restore [--force] <path>\n       mykb restore [--force] --timestamp TIME")
+			os.Exit(1)
+		}
+
+		if *timestamp != "" {
+			at, err := time.Parse(time.RFC3339, *timestamp)
+			if err != nil {
+				log.Fatalf("Invalid --timestamp: %v", err)
+			}
+			if err := a.RestoreAt(context.Background(), at, *force); err != nil {
+				log.Fatalf("Restore: %v", err)
+			}
+		} else if err := a.Restore(context.Background(), fs.Arg(0), *force); err != nil {
+			log.Fatalf("Restore: %v", err)
+		}
+
+	case "compact":
+		fs := flag.NewFlagSet("compact", flag.ExitOnError)
+		dryRun := fs.Bool("dry-run", false, "Only report reclaimable space")
+		fs.Parse(args[1:])
+
+		if err := a.Compact(ctx, *dryRun); err != nil {
+			log.Fatalf("Compact: %v", err)
+		}
+
+	case "maintain":
+		if a.DB.ReadOnly() {
+			log.Fatalf("Maintain: the database is a read-only mirror")
+		}
+		r, err := a.Maintain(ctx)
+		if err != nil {
+			log.Fatalf("Maintain: %v", err)
+		}
+		fmt.Printf("Purged %d expired tokens, %d stale clients, %d tombstones.\n",
+			r.ExpiredTokens, r.StaleClients, r.Tombstones)
+		fmt.Printf("Database size: %s (was %s).\n", formatBytes(r.BytesAfter), formatBytes(r.BytesBefore))
+
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", args[0])
 		usage()
@@ -102,6 +563,372 @@ func main() {
 	}
 }
 
+// showConfig prints the effective configuration, after defaults and
+// environment overrides, with secrets redacted.
+func showConfig(cfg *config.Config, path string, args []string) {
+	if len(args) != 1 || args[0] != "show" {
+		fmt.Fprintln(os.Stderr, "Usage: mykb config show")
+		os.Exit(1)
+	}
+	data, err := cfg.MarshalRedacted()
+	if err != nil {
+		log.Fatalf("Config: %v", err)
+	}
+	if path != "" {
+		fmt.Printf("# Loaded from %s, with MYKB_* environment overrides\n", path)
+	} else {
+		fmt.Println("# No config file found: defaults, with MYKB_* environment overrides")
+	}
+	if cfg.Profile != "" {
+		fmt.Printf("# Profile: %s\n", cfg.Profile)
+	}
+	os.Stdout.Write(data)
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+// importBookmarks runs mykb import bookmarks.
+func importBookmarks(a *app.App, args []string) {
+	fs := flag.NewFlagSet("import bookmarks", flag.ExitOnError)
+	concurrency := fs.Int("concurrency", bookmarks.DefaultConcurrency, "Pages fetched at once")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: mykb import bookmarks [--concurrency N] <bookmarks.html|pocket.csv>")
+		os.Exit(1)
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Import: %v", err)
+	}
+	defer f.Close()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	stats, err := a.ImportBookmarks(ctx, f, *concurrency)
+	if err != nil {
+		log.Fatalf("Import: %v", err)
+	}
+	fmt.Printf("Imported %d bookmarks (%d already stored, %d failed)\n", stats.Imported, stats.Skipped, stats.Failed)
+	if stats.Imported > 0 && a.Embedder != nil {
+		fmt.Println("Run mykb reindex to embed the imported pages")
+	}
+}
+
+// replay runs mykb replay: lists recorded tool calls, or re-runs one.
+// searchPreviewLen bounds the text shown per search hit.
+const searchPreviewLen = 160
+
+func search(a *app.App, semantic bool, args []string) {
+	name := "search"
+	if semantic {
+		name = "semantic"
+	}
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	limit := fs.Int("n", 10, "Results to show")
+	boost := fs.Bool("boost-central", false, "Rank chunks that many notes link to higher")
+	recent := fs.Bool("boost-recent", false, "Rank recently updated chunks higher")
+	minScore := fs.Float64("min-score", 0, "Drop semantic hits scoring below this (0 to 1)")
+	asJSON := fs.Bool("json", false, "Print results as JSON")
+	url := fs.String("url", "", "Search the mykb server at this URL instead of the local database")
+	token := fs.String("token", os.Getenv("MYKB_TOKEN"), "Access token for --url (default $MYKB_TOKEN)")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: mykb %s [-n N] [--min-score S] [--json] [--url URL --token T] <query>\n", name)
+		os.Exit(1)
+	}
+	if *url != "" && *token == "" {
+		log.Fatalf("Search: --url needs --token or $MYKB_TOKEN")
+	}
+
+	query := strings.Join(fs.Args(), " ")
+	hits, err := a.Search(context.Background(), query, app.SearchOptions{
+		Semantic: semantic, Limit: *limit, BoostCentral: *boost, BoostRecent: *recent, MinScore: *minScore, URL: *url, Token: *token,
+	})
+	if err != nil {
+		log.Fatalf("Search: %v", err)
+	}
+	if *asJSON {
+		if hits == nil {
+			hits = []app.SearchHit{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		enc.Encode(hits)
+		return
+	}
+	if len(hits) == 0 {
+		fmt.Println("No results")
+		return
+	}
+
+	// Full-text snippets mark matches; embolden them on a terminal
+	mark, unmark := "", ""
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		mark, unmark = "\x1b[1m", "\x1b[0m"
+	}
+	start, end := a.Config.Search.Highlight()
+	for i, h := range hits {
+		text := h.Snippet
+		if text == "" {
+			text = h.Content
+		}
+		text = strings.Join(strings.Fields(text), " ")
+		if r := []rune(text); len(r) > searchPreviewLen {
+			text = string(r[:searchPreviewLen]) + "..."
+		}
+		text = strings.NewReplacer(start, mark, end, unmark).Replace(text)
+		if semantic {
+			fmt.Printf("%2d. %s  %.3f\n", i+1, h.ID, h.Score)
+		} else {
+			fmt.Printf("%2d. %s\n", i+1, h.ID)
+		}
+		fmt.Printf("    %s\n", text)
+		if len(h.Metadata) > 0 {
+			fmt.Printf("    %s\n", h.Metadata)
+		}
+	}
+}
+
+func addChunk(a *app.App, args []string) {
+	fs := flag.NewFlagSet("add", flag.ExitOnError)
+	var meta stringList
+	fs.Var(&meta, "meta", "Add metadata key=value (repeatable)")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "Usage: mykb add [--meta k=v] [file|-]")
+		os.Exit(1)
+	}
+	var data []byte
+	var err error
+	if path := fs.Arg(0); path != "" && path != "-" {
+		data, err = os.ReadFile(path)
+	} else {
+		data, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		log.Fatalf("Add: %v", err)
+	}
+
+	chunk, deferred, err := a.Add(context.Background(), string(data), meta.metadata("Add"))
+	if err != nil {
+		log.Fatalf("Add: %v", err)
+	}
+	fmt.Println(chunk.ID)
+	if deferred {
+		fmt.Fprintln(os.Stderr, "Embedding deferred; run mykb reindex")
+	}
+}
+
+func getChunk(ctx context.Context, a *app.App, args []string) {
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print the chunk as JSON")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: mykb get [--json] <id>")
+		os.Exit(1)
+	}
+	chunk, err := a.DB.GetChunk(ctx, fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Get: %v", err)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		enc.Encode(chunk)
+		return
+	}
+	fmt.Print(app.ChunkMarkdown(*chunk))
+}
+
+func editChunk(a *app.App, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: mykb edit <id>")
+		os.Exit(1)
+	}
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	chunk, err := a.Edit(context.Background(), args[0], editor)
+	if err != nil {
+		log.Fatalf("Edit: %v", err)
+	}
+	if chunk == nil {
+		fmt.Println("No changes")
+		return
+	}
+	fmt.Printf("Updated %s\n", chunk.ID)
+}
+
+// lockChunks locks or unlocks chunks against changes by MCP clients; lock
+// without IDs lists the locked chunks.
+func lockChunks(ctx context.Context, a *app.App, locked bool, ids []string) {
+	if len(ids) == 0 && locked {
+		locks, err := a.DB.LockedChunkIDs(ctx)
+		if err != nil {
+			log.Fatalf("Lock: %v", err)
+		}
+		for _, id := range locks {
+			title := ""
+			if c, err := a.DB.GetChunk(ctx, id); err == nil {
+				title, _, _ = strings.Cut(strings.TrimSpace(c.Content), "\n")
+				title, _ = storage.Truncate(title, 60)
+			}
+			fmt.Printf("%s  %s\n", id, title)
+		}
+		return
+	}
+	if len(ids) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: mykb unlock <id>...")
+		os.Exit(1)
+	}
+	for _, id := range ids {
+		if err := a.DB.SetChunkLocked(ctx, id, locked); err != nil {
+			log.Fatalf("Lock %s: %v", id, err)
+		}
+		if locked {
+			fmt.Printf("Locked %s\n", id)
+		} else {
+			fmt.Printf("Unlocked %s\n", id)
+		}
+	}
+}
+
+func replay(ctx context.Context, a *app.App, args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	limit := fs.Int("n", 20, "Recorded calls to list")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		calls, err := a.DB.ListToolCalls(ctx, *limit)
+		if err != nil {
+			log.Fatalf("Replay: %v", err)
+		}
+		if len(calls) == 0 && !a.Config.Recording.Enabled {
+			fmt.Println("No recorded tool calls; enable [recording] to record them")
+		}
+		for _, c := range calls {
+			status := ""
+			if c.IsError {
+				status = " (error)"
+			}
+			fmt.Printf("%6d  %s  %-16s %s%s\n", c.ID, c.Time.Format(time.RFC3339), c.Client, c.Tool, status)
+		}
+		return
+	}
+
+	id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		log.Fatalf("Replay: invalid call id %q", fs.Arg(0))
+	}
+	res, err := a.Replay(context.Background(), id)
+	if err != nil {
+		log.Fatalf("Replay: %v", err)
+	}
+	fmt.Printf("Call %d: %s by %q at %s\n", res.Call.ID, res.Call.Tool, res.Call.Client, res.Call.Time.Format(time.RFC3339))
+	fmt.Printf("Arguments: %s\n", res.Call.Arguments)
+	printResult := func(label string, r *mcp.CallToolResult) {
+		fmt.Printf("\n%s", label)
+		if r.IsError {
+			fmt.Print(" (error)")
+		}
+		fmt.Println(":")
+		for _, c := range r.Content {
+			fmt.Println(c.Text)
+		}
+	}
+	printResult("Recorded response", res.Recorded)
+	printResult("Current response (dry run)", res.Current)
+	if res.Same {
+		fmt.Println("\nResponse unchanged")
+	} else {
+		fmt.Println("\nResponse differs")
+	}
+}
+
+// printStats prints the knowledge base's current stats, with the
+// configured embedding model's coverage first.
+func printStats(a *app.App, s *storage.ContentStats) {
+	fmt.Printf("Chunks:    %d (%s of content)\n", s.Chunks, formatBytes(s.ContentBytes))
+	models := make([]string, 0, len(s.Embeddings))
+	for m := range s.Embeddings {
+		models = append(models, m)
+	}
+	sort.Strings(models)
+	if a.Embedder != nil {
+		model := a.Embedder.Model()
+		fmt.Printf("Embedded:  %d (%.1f%%, %s)\n", s.Embeddings[model], 100*s.Coverage(model), model)
+		models = slices.DeleteFunc(models, func(m string) bool { return m == model })
+	} else if len(models) == 0 {
+		fmt.Println("Embedded:  0")
+	}
+	for _, m := range models {
+		fmt.Printf("           %d (%.1f%%, %s)\n", s.Embeddings[m], 100*s.Coverage(m), m)
+	}
+	fmt.Printf("Database:  %s (full-text index %s)\n", formatBytes(s.DBBytes), formatBytes(s.FTSBytes))
+	if s.Oldest != nil {
+		fmt.Printf("Oldest:    %s\n", s.Oldest.Local().Format(time.DateTime))
+		fmt.Printf("Newest:    %s\n", s.Newest.Local().Format(time.DateTime))
+		fmt.Printf("Updated:   %s\n", s.LastUpdated.Local().Format(time.DateTime))
+	}
+	if len(s.MetadataKeys) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(s.MetadataKeys))
+	for k := range s.MetadataKeys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if s.MetadataKeys[keys[i]] != s.MetadataKeys[keys[j]] {
+			return s.MetadataKeys[keys[i]] > s.MetadataKeys[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	fmt.Println("Metadata keys (chunks):")
+	for _, k := range keys {
+		fmt.Printf("  %-20s %d\n", k, s.MetadataKeys[k])
+	}
+}
+
+// formatBytes formats n with a binary unit.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+// metadata parses --meta key=value flags, exiting on malformed ones.
+func (l stringList) metadata(cmd string) map[string]any {
+	metadata := make(map[string]any)
+	for _, kv := range l {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			log.Fatalf("%s: --meta %q: expected key=value", cmd, kv)
+		}
+		metadata[k] = v
+	}
+	return metadata
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
 func usage() {
 	fmt.Fprintf(os.Stderr, `mykb - Personal knowledge base with full-text search
 
@@ -109,9 +936,56 @@ Usage:
   mykb serve stdio      Run MCP server over stdio
   mykb serve http       Run HTTP server
   mykb set-password     Set password for auth
-  mykb reindex [--force]   Generate embeddings for chunks without them
+  mykb config show      Print the effective configuration, secrets redacted
+  mykb tail [--url URL]    Stream tool calls, auth events and errors from a running server
+  mykb reindex [--force] [--resume] [--dry-run] [--batch-size N] [--concurrency N] [--json]
+                           Generate embeddings for chunks without them
+  mykb encrypt            Encrypt existing data (after configuring [storage])
+  mykb compact [--dry-run] Report and reclaim free space after deletes
+  mykb maintain           Purge expired tokens, stale clients and old tombstones; VACUUM and ANALYZE
+  mykb fts <check|rebuild> Verify, or rebuild from the chunks table, the full-text index and its triggers
+  mykb backup [--remote] <path>
+                           Write an online backup (--remote: upload to S3; path optional)
+  mykb restore [--force] <path>
+                           Replace the database with a verified backup
+  mykb restore [--force] --timestamp TIME
+                           Restore the continuous replica as of an RFC 3339 time
+  mykb export [--format corpus|jsonl|markdown] [--out PATH | --dir DIR] [--include k=v] [--exclude k=v]
+                           Export chunks as plain text, jsonl or markdown files (see mykb export -h)
+  mykb ingest [--meta k=v] <path|url>...
+                           Split documents (markdown, HTML, text, PDF; files, directories or URLs) into chunks;
+                           audio files are transcribed with [transcription]
+  mykb watch [--meta k=v] [--interval D] <dir>
+                           Keep chunks in sync with a directory's files as they change
+  mykb stats [--json] [--history [--days N]]
+                           Show chunk and content size, embedding coverage per model, metadata keys and database size (--history: daily growth)
+  mykb retention [--apply]
+                           Report (--apply: enforce) the [retention] rules; each rule is reported before it is enforced,
+                           and expired chunks ([retention.expiry]) are removed
+  mykb review [--send]     Print (--send: send the digest of) the chunks due for review under [review]
+  mykb sync [--token T] [--conflict newest|local|remote|keep-both] <remote-url>
+                           Exchange chunk changes and deletes with another mykb server
+  mykb git <init|status>   Set up, or report on, the [git] mirror committing every chunk change
+  mykb add [--meta k=v] [file|-]
+                           Store one chunk from a file or stdin (front matter becomes metadata)
+  mykb get [--json] <id>   Print a chunk as markdown with front matter
+  mykb edit <id>           Edit a chunk in $EDITOR; changed content is re-embedded on save
+  mykb lock [id...]        Lock chunks against updates and deletes by MCP clients (no IDs: list locked chunks)
+  mykb unlock <id>...      Lift the lock
+  mykb search [-n N] [--json] [--url URL] <query>
+                           Full-text search, from the local database or a running server
+  mykb semantic [-n N] [--json] [--url URL] <query>
+                           Semantic search (needs an embedding provider)
+  mykb replay [-n N] [id]
+                           List recorded tool calls, or dry-run one against a copy of the database
+  mykb import [--conflict skip|overwrite|new-id] <file.jsonl>
+                           Merge chunks from a jsonl export
+  mykb import bookmarks [--concurrency N] <bookmarks.html|pocket.csv>
+                           Fetch bookmarked pages and store their text
 
 Options:
   --config PATH    Config file (searches: %s)
+  --profile NAME   Use the [profiles.NAME] config section (default $MYKB_PROFILE)
+  --data DIR       Data directory (default data_dir); :memory: keeps a throwaway database in memory
 `, strings.Join(config.SearchPaths(), ", "))
 }
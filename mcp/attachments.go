@@ -0,0 +1,151 @@
+package mcp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/neoden/mykb/storage"
+)
+
+// attachmentURIPrefix addresses attachments as MCP resources.
+const attachmentURIPrefix = "mykb://attachments/"
+
+// AttachmentURI returns the resource URI of an attachment.
+func AttachmentURI(id string) string {
+	return attachmentURIPrefix + id
+}
+
+// Errors returned by the attachment methods.
+var (
+	ErrReadOnly   = errors.New("this server is a read-only mirror")
+	ErrNotAllowed = errors.New("not available to this token")
+)
+
+// attachmentRef is an attachment listed with its chunk.
+type attachmentRef struct {
+	storage.Attachment
+	URI string `json:"uri"`
+}
+
+// Attachments are written under the update_chunk permission and read
+// under get_chunk, so that a child token sees them as it sees chunks.
+func (s *Server) canWriteAttachments(ctx context.Context) error {
+	if s.config.ReadOnly {
+		return ErrReadOnly
+	}
+	if !grantFrom(ctx).allows("update_chunk") {
+		return ErrNotAllowed
+	}
+	return nil
+}
+
+func (s *Server) canReadAttachments(ctx context.Context) error {
+	if !grantFrom(ctx).allows("get_chunk") {
+		return ErrNotAllowed
+	}
+	return nil
+}
+
+// AddAttachment stores data as an attachment of a chunk.
+func (s *Server) AddAttachment(ctx context.Context, chunkID, name, contentType string, data []byte) (*storage.Attachment, error) {
+	if err := s.canWriteAttachments(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.checkUnlocked(ctx, chunkID); err != nil {
+		return nil, err
+	}
+	return s.db.AddAttachment(ctx, chunkID, name, contentType, data)
+}
+
+// Attachment returns an attachment and its data.
+func (s *Server) Attachment(ctx context.Context, id string) (*storage.Attachment, []byte, error) {
+	if err := s.canReadAttachments(ctx); err != nil {
+		return nil, nil, err
+	}
+	return s.db.GetAttachment(ctx, id)
+}
+
+// ChunkAttachments lists the attachments of a chunk.
+func (s *Server) ChunkAttachments(ctx context.Context, chunkID string) ([]storage.Attachment, error) {
+	if err := s.canReadAttachments(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := s.db.GetChunk(ctx, chunkID); err != nil {
+		return nil, err
+	}
+	return s.db.ListAttachments(ctx, chunkID)
+}
+
+// DeleteAttachment deletes an attachment, reporting whether it existed.
+func (s *Server) DeleteAttachment(ctx context.Context, id string) (bool, error) {
+	if err := s.canWriteAttachments(ctx); err != nil {
+		return false, err
+	}
+	a, _, err := s.db.GetAttachment(ctx, id)
+	if errors.Is(err, storage.ErrAttachmentNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := s.checkUnlocked(ctx, a.ChunkID); err != nil {
+		return false, err
+	}
+	return s.db.DeleteAttachment(ctx, id)
+}
+
+// handleResourcesList lists every attachment as a resource, or none to a
+// token that may not read chunks.
+func (s *Server) handleResourcesList(ctx context.Context) *ResourcesListResult {
+	result := &ResourcesListResult{Resources: []Resource{}}
+	if s.canReadAttachments(ctx) != nil {
+		return result
+	}
+	attachments, err := s.db.ListAttachments(ctx, "")
+	if err != nil {
+		log.Printf("resources/list: %v", err)
+		return result
+	}
+	for _, a := range attachments {
+		result.Resources = append(result.Resources, Resource{
+			URI:         AttachmentURI(a.ID),
+			Name:        a.Name,
+			Description: "Attachment of chunk " + a.ChunkID,
+			MimeType:    a.ContentType,
+			Size:        a.Size,
+		})
+	}
+	return result
+}
+
+// handleResourcesRead returns an attachment's data, base64-encoded.
+func (s *Server) handleResourcesRead(ctx context.Context, params json.RawMessage) (*ReadResourceResult, *Error) {
+	var p ReadResourceParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &Error{Code: CodeInvalidParams, Message: "Invalid params"}
+	}
+	id, ok := strings.CutPrefix(p.URI, attachmentURIPrefix)
+	if !ok || id == "" {
+		return nil, &Error{Code: CodeResourceNotFound, Message: fmt.Sprintf("Resource not found: %s", p.URI)}
+	}
+	a, data, err := s.Attachment(ctx, id)
+	switch {
+	case errors.Is(err, storage.ErrAttachmentNotFound):
+		return nil, &Error{Code: CodeResourceNotFound, Message: fmt.Sprintf("Resource not found: %s", p.URI)}
+	case errors.Is(err, ErrNotAllowed):
+		return nil, &Error{Code: CodeInvalidRequest, Message: fmt.Sprintf("%s is %v", p.URI, err)}
+	case err != nil:
+		log.Printf("resources/read: %v", err)
+		return nil, &Error{Code: CodeInternalError, Message: "Internal error"}
+	}
+	return &ReadResourceResult{Contents: []ResourceContents{{
+		URI:      p.URI,
+		MimeType: a.ContentType,
+		Blob:     base64.StdEncoding.EncodeToString(data),
+	}}}, nil
+}
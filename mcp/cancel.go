@@ -0,0 +1,71 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+)
+
+// inflight tracks the requests being handled, so a notifications/cancelled
+// from the client that sent one cancels its context, and with it the
+// storage queries and embedding calls it is waiting on.
+type inflight struct {
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+// requestKey identifies a request by its client and JSON-RPC id; ids are
+// only unique per client.
+func requestKey(ctx context.Context, id json.RawMessage) string {
+	return clientFrom(ctx) + "\x00" + string(id)
+}
+
+// track returns a context for the request with id, cancelled by cancel or
+// once the returned function is called when the request is done.
+func (f *inflight) track(ctx context.Context, id json.RawMessage) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	key := requestKey(ctx, id)
+	f.mu.Lock()
+	if f.cancels == nil {
+		f.cancels = make(map[string]context.CancelFunc)
+	}
+	f.cancels[key] = cancel
+	f.mu.Unlock()
+	return ctx, func() {
+		f.mu.Lock()
+		delete(f.cancels, key)
+		f.mu.Unlock()
+		cancel()
+	}
+}
+
+// cancel cancels the request with id from the client of ctx, reporting
+// whether it was still being handled.
+func (f *inflight) cancel(ctx context.Context, id json.RawMessage) bool {
+	f.mu.Lock()
+	cancel, ok := f.cancels[requestKey(ctx, id)]
+	f.mu.Unlock()
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// handleCancelled cancels the request a notifications/cancelled names.
+func (s *Server) handleCancelled(ctx context.Context, params json.RawMessage) {
+	var p CancelledParams
+	if err := json.Unmarshal(params, &p); err != nil || len(p.RequestID) == 0 {
+		log.Printf("Request cancelled: invalid params")
+		return
+	}
+	if !s.inflight.cancel(ctx, p.RequestID) {
+		log.Printf("Request %s cancelled after it finished", p.RequestID)
+		return
+	}
+	if p.Reason != "" {
+		log.Printf("Request %s cancelled: %s", p.RequestID, p.Reason)
+	} else {
+		log.Printf("Request %s cancelled", p.RequestID)
+	}
+}
@@ -0,0 +1,57 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCancelledNotification(t *testing.T) {
+	s := setupTestServer(t)
+	started := make(chan struct{})
+	s.tools["wait"] = func(ctx context.Context, _ json.RawMessage) (any, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	cancelled := &Request{JSONRPC: "2.0", Method: "notifications/cancelled", Params: json.RawMessage(`{"requestId":7,"reason":"user abort"}`)}
+
+	ctx := WithClient(context.Background(), "agent")
+	done := make(chan *Response)
+	go func() {
+		done <- s.HandleRequest(ctx, &Request{JSONRPC: "2.0", ID: json.RawMessage(`7`), Method: "tools/call", Params: json.RawMessage(`{"name":"wait"}`)})
+	}()
+	<-started
+
+	// Request ids are the client's own
+	s.HandleRequest(WithClient(context.Background(), "other"), cancelled)
+	select {
+	case <-done:
+		t.Fatal("cancelled by another client")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.HandleRequest(ctx, cancelled)
+	select {
+	case resp := <-done:
+		result, ok := resp.Result.(*CallToolResult)
+		if !ok || !result.IsError || !strings.Contains(result.Content[0].Text, "context canceled") {
+			t.Errorf("result = %+v, want a context canceled error", resp.Result)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request not cancelled")
+	}
+	if s.inflight.cancel(ctx, json.RawMessage(`7`)) {
+		t.Error("finished request still tracked")
+	}
+
+	// Storage queries stop with the context
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := s.tools["search_chunks"](cctx, json.RawMessage(`{"query":"anything"}`)); !errors.Is(err, context.Canceled) {
+		t.Errorf("search_chunks with a cancelled context: err = %v, want context.Canceled", err)
+	}
+}
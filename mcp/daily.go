@@ -0,0 +1,136 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/neoden/mykb/storage"
+)
+
+// DailyNoteKey is the metadata key holding the date of a daily note.
+const DailyNoteKey = "daily_note"
+
+// DailyConfig controls daily notes.
+type DailyConfig struct {
+	// Timezone is the IANA time zone whose calendar days daily notes
+	// follow, such as "Europe/Berlin"; empty uses the server's.
+	Timezone string `toml:"timezone"`
+}
+
+// Validate checks the daily note settings.
+func (c DailyConfig) Validate() error {
+	if c.Timezone == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		return fmt.Errorf("timezone: %w", err)
+	}
+	return nil
+}
+
+func (c DailyConfig) location() *time.Location {
+	if c.Timezone != "" {
+		if loc, err := time.LoadLocation(c.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// dailyDate resolves a daily note's date: YYYY-MM-DD, "today" or
+// "yesterday", empty meaning today. today reports whether it is the
+// current day.
+func (s *Server) dailyDate(date string) (day string, today bool, err error) {
+	now := time.Now().In(s.config.Daily.location())
+	switch strings.ToLower(date) {
+	case "", "today":
+		return now.Format(time.DateOnly), true, nil
+	case "yesterday":
+		return now.AddDate(0, 0, -1).Format(time.DateOnly), false, nil
+	}
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		return "", false, fmt.Errorf("date must be YYYY-MM-DD, today or yesterday")
+	}
+	return date, date == now.Format(time.DateOnly), nil
+}
+
+// dailyNote returns the daily note of day, or nil if there is none.
+func (s *Server) dailyNote(ctx context.Context, day string) (*storage.Chunk, error) {
+	ids, err := s.db.FilterChunkIDs(ctx, map[string]any{DailyNoteKey: day})
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	chunk, err := s.db.GetChunk(ctx, ids[0])
+	if errors.Is(err, storage.ErrChunkNotFound) {
+		return nil, nil
+	}
+	return chunk, err
+}
+
+func (s *Server) toolGetDailyNote(ctx context.Context, args json.RawMessage) (any, error) {
+	var params struct {
+		Date string `json:"date"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	day, _, err := s.dailyDate(params.Date)
+	if err != nil {
+		return nil, err
+	}
+	chunk, err := s.dailyNote(ctx, day)
+	if err != nil {
+		return nil, err
+	}
+	if chunk == nil {
+		return map[string]any{"found": false, "date": day}, nil
+	}
+	return chunk, nil
+}
+
+func (s *Server) toolAppendDailyNote(ctx context.Context, args json.RawMessage) (any, error) {
+	var params struct {
+		Text string `json:"text"`
+		Date string `json:"date"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	text := strings.TrimSpace(params.Text)
+	if text == "" {
+		return nil, fmt.Errorf("text is required")
+	}
+	day, today, err := s.dailyDate(params.Date)
+	if err != nil {
+		return nil, err
+	}
+	// Entries of today are stamped with the time they were logged
+	if today {
+		text = time.Now().In(s.config.Daily.location()).Format("15:04") + " " + text
+	}
+
+	// Serialized, so concurrent appends do not each create the day's note
+	s.dailyMu.Lock()
+	defer s.dailyMu.Unlock()
+	note, err := s.dailyNote(ctx, day)
+	if err != nil {
+		return nil, err
+	}
+	if note == nil {
+		metadata, _ := json.Marshal(map[string]any{DailyNoteKey: day})
+		chunk, _, err := s.storeChunk(ctx, "# "+day+"\n\n"+text, metadata, "")
+		if err != nil {
+			return nil, err
+		}
+		return struct {
+			*storage.Chunk
+			Created bool `json:"created"`
+		}{chunk, true}, nil
+	}
+	content := strings.TrimRight(note.Content, "\n") + "\n\n" + text
+	return s.updateChunk(ctx, note.ID, &content, nil, nil)
+}
@@ -0,0 +1,144 @@
+package mcp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/neoden/mykb/events"
+	"github.com/neoden/mykb/storage"
+)
+
+// Child token lifetimes.
+const (
+	DefaultChildTokenTTL = 15 * time.Minute
+	MaxChildTokenTTL     = 24 * time.Hour
+)
+
+// Token data keys of child tokens.
+const (
+	TokenDataTools  = "tools"  // space-separated tools the token may call
+	TokenDataParent = "parent" // client that minted the token
+)
+
+// Grant is what the access token authenticating a request allows.
+type Grant struct {
+	// Tools limits the tools that may be called; nil allows all.
+	Tools []string
+	// Parent is the client that minted a child token.
+	Parent string
+	// ExpiresAt is when the token expires; child tokens never outlive it.
+	ExpiresAt time.Time
+}
+
+// GrantFromToken returns the grant of an opaque access token.
+func GrantFromToken(t *storage.Token) *Grant {
+	g := &Grant{Parent: t.Data[TokenDataParent], ExpiresAt: time.Unix(t.ExpiresAt, 0)}
+	if tools, ok := t.Data[TokenDataTools]; ok {
+		g.Tools = strings.Fields(tools)
+	}
+	return g
+}
+
+// allows reports whether the grant permits calling tool. A nil grant
+// allows everything.
+func (g *Grant) allows(tool string) bool {
+	return g == nil || g.Tools == nil || slices.Contains(g.Tools, tool)
+}
+
+// Delegated reports whether the grant is a child token's, limited to some
+// tools or minted by another client. Such a grant covers MCP tool calls
+// only.
+func (g *Grant) Delegated() bool {
+	return g != nil && (g.Tools != nil || g.Parent != "")
+}
+
+type grantKey struct{}
+
+// WithGrant returns ctx carrying the grant of the request's access token.
+// Requests without one (stdio) can call every tool but not mint child
+// tokens.
+func WithGrant(ctx context.Context, g *Grant) context.Context {
+	return context.WithValue(ctx, grantKey{}, g)
+}
+
+func grantFrom(ctx context.Context) *Grant {
+	g, _ := ctx.Value(grantKey{}).(*Grant)
+	return g
+}
+
+func (s *Server) toolCreateChildToken(ctx context.Context, args json.RawMessage) (any, error) {
+	var params struct {
+		Tools      []string `json:"tools"`
+		TTLMinutes int      `json:"ttl_minutes"`
+		Name       string   `json:"name"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	parent := grantFrom(ctx)
+	if parent == nil {
+		return nil, fmt.Errorf("child tokens are only issued to clients authenticated with an access token")
+	}
+	if len(params.Tools) == 0 {
+		return nil, fmt.Errorf("tools is required")
+	}
+	for _, tool := range params.Tools {
+		if _, ok := s.tools[tool]; !ok {
+			return nil, fmt.Errorf("unknown tool: %s", tool)
+		}
+		if !parent.allows(tool) {
+			return nil, fmt.Errorf("%s is not available to this token, so it cannot be delegated", tool)
+		}
+	}
+	if strings.ContainsAny(params.Name, "/ ") {
+		return nil, fmt.Errorf("name must not contain spaces or slashes")
+	}
+	if params.Name == "" {
+		params.Name = "child"
+	}
+
+	ttl := DefaultChildTokenTTL
+	if params.TTLMinutes > 0 {
+		ttl = min(time.Duration(params.TTLMinutes)*time.Minute, MaxChildTokenTTL)
+	}
+	expires := time.Now().Add(ttl)
+	if !parent.ExpiresAt.IsZero() && expires.After(parent.ExpiresAt) {
+		expires = parent.ExpiresAt
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("generate token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	parentClient := clientFrom(ctx)
+	// The child's client ID extends its parent's, so chunks and recorded
+	// calls show where they came from
+	client := parentClient + "/" + params.Name
+	data := map[string]string{
+		TokenDataTools:  strings.Join(params.Tools, " "),
+		TokenDataParent: parentClient,
+	}
+	if err := s.db.StoreToken(ctx, storage.HashToken(token), storage.TokenAccess, client, expires.Unix(), data); err != nil {
+		return nil, fmt.Errorf("store token: %w", err)
+	}
+
+	s.config.Events.Publish(events.Event{
+		Type:    events.Auth,
+		Message: "child token issued to " + client,
+		Fields:  map[string]any{"client": client, "parent": parentClient, "tools": data[TokenDataTools]},
+	})
+	return map[string]any{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"client":       client,
+		"tools":        params.Tools,
+		"expires_at":   expires.UTC().Truncate(time.Second),
+	}, nil
+}
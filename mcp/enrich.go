@@ -0,0 +1,149 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// AutoPrefix marks the metadata keys set by enrichment, so suggestions are
+// told apart from what the user wrote.
+const AutoPrefix = "auto:"
+
+// DefaultEnrichMaxTags is how many tags enrichment suggests by default.
+const DefaultEnrichMaxTags = 5
+
+// llmMaxContent is how much of a chunk's content the model is shown.
+const llmMaxContent = 8000
+
+// ErrNoLLM is returned when enrichment is asked for without a language
+// model configured.
+var ErrNoLLM = errors.New("no language model configured: set [llm] provider")
+
+// EnrichConfig controls suggesting metadata for new chunks.
+type EnrichConfig struct {
+	// Enabled has store_chunk ask the [llm] model for a title, a one-line
+	// summary and tags, stored as auto:title, auto:summary and auto:tags;
+	// calls can override it with enrich.
+	Enabled bool `toml:"enabled"`
+	// MaxTags is how many tags are suggested (default 5).
+	MaxTags int `toml:"max_tags"`
+}
+
+// Validate checks the enrichment settings.
+func (c EnrichConfig) Validate() error {
+	if c.MaxTags < 0 {
+		return errors.New("max_tags must not be negative")
+	}
+	return nil
+}
+
+func (c EnrichConfig) maxTags() int {
+	if c.MaxTags > 0 {
+		return c.MaxTags
+	}
+	return DefaultEnrichMaxTags
+}
+
+// suggestion is the reply enrichment asks the model for.
+type suggestion struct {
+	Title   string   `json:"title"`
+	Summary string   `json:"summary"`
+	Tags    []string `json:"tags"`
+}
+
+// enrich returns metadata with the model's suggestions for content added
+// under AutoPrefix keys; keys already in metadata are kept.
+func (s *Server) enrich(ctx context.Context, content string, metadata json.RawMessage) (json.RawMessage, error) {
+	if s.config.LLM == nil {
+		return nil, ErrNoLLM
+	}
+	meta := make(map[string]any)
+	if len(metadata) > 0 && string(metadata) != "null" {
+		if err := json.Unmarshal(metadata, &meta); err != nil {
+			return nil, fmt.Errorf("metadata must be an object: %w", err)
+		}
+	}
+
+	maxTags := s.config.Enrich.maxTags()
+	system := fmt.Sprintf("You describe notes stored in a personal knowledge base. "+
+		"Reply with only a JSON object with the keys title (a short title), "+
+		"summary (one sentence) and tags (at most %d lowercase keywords).", maxTags)
+	reply, err := s.complete(ctx, system, content)
+	if err != nil {
+		return nil, err
+	}
+	var sug suggestion
+	if err := decodeReply(reply, &sug); err != nil {
+		return nil, err
+	}
+
+	set := func(key string, value any) {
+		if _, ok := meta[AutoPrefix+key]; !ok {
+			meta[AutoPrefix+key] = value
+		}
+	}
+	if title := strings.TrimSpace(sug.Title); title != "" {
+		set("title", title)
+	}
+	if summary := strings.TrimSpace(sug.Summary); summary != "" {
+		set("summary", summary)
+	}
+	if tags := normalizeTags(sug.Tags, maxTags); len(tags) > 0 {
+		set("tags", tags)
+	}
+	return json.Marshal(meta)
+}
+
+// complete asks the model about content, cut to llmMaxContent bytes,
+// within LLMTimeout.
+func (s *Server) complete(ctx context.Context, system, content string) (string, error) {
+	if len(content) > llmMaxContent {
+		n := llmMaxContent
+		for n > 0 && !utf8.RuneStart(content[n]) {
+			n--
+		}
+		content = content[:n]
+	}
+	if s.config.LLMTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.LLMTimeout)
+		defer cancel()
+	}
+	return s.config.LLM.Complete(ctx, system, content)
+}
+
+// decodeReply decodes the JSON object in a model's reply, which may wrap
+// it in prose or a code fence, into v.
+func decodeReply(reply string, v any) error {
+	start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return fmt.Errorf("no JSON object in model reply")
+	}
+	if err := json.Unmarshal([]byte(reply[start:end+1]), v); err != nil {
+		return fmt.Errorf("decode model reply: %w", err)
+	}
+	return nil
+}
+
+// normalizeTags lowercases tags and drops blanks and duplicates, keeping
+// at most limit.
+func normalizeTags(tags []string, limit int) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		out = append(out, tag)
+		if len(out) == limit {
+			break
+		}
+	}
+	return out
+}
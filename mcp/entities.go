@@ -0,0 +1,183 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/neoden/mykb/storage"
+)
+
+// EntitiesConfig controls extracting the entities chunks mention.
+type EntitiesConfig struct {
+	// Enabled has store_chunk and update_chunk ask the [llm] model for the
+	// people, projects and dates a chunk mentions, recorded for
+	// get_entities and the entity filter of semantic_search.
+	Enabled bool `toml:"enabled"`
+}
+
+// entityReply is the reply extraction asks the model for.
+type entityReply struct {
+	People   []string `json:"people"`
+	Projects []string `json:"projects"`
+	Dates    []string `json:"dates"`
+}
+
+const entitiesPrompt = "You index notes stored in a personal knowledge base. " +
+	"Reply with only a JSON object with the keys people (names of the people the note mentions), " +
+	"projects (names of projects, products or organizations) and dates (the dates it mentions, as YYYY-MM-DD). " +
+	"Use empty arrays for none."
+
+// extractsEntities reports whether new and changed chunks have their
+// entities extracted.
+func (s *Server) extractsEntities() bool {
+	return s.config.Entities.Enabled && s.config.LLM != nil
+}
+
+// recordEntities replaces the entities recorded for chunk with those the
+// model finds in it, when extraction is enabled. Failures are logged; the
+// chunk is kept regardless.
+func (s *Server) recordEntities(ctx context.Context, chunk *storage.Chunk) {
+	if !s.extractsEntities() {
+		return
+	}
+	entities, err := s.extractEntities(ctx, chunk.Content)
+	if err == nil {
+		err = s.db.SetChunkEntities(ctx, chunk.ID, entities)
+	}
+	if err != nil {
+		log.Printf("WARNING: entity extraction for %s: %v", chunk.ID, err)
+	}
+}
+
+// extractEntities asks the model for the entities content mentions.
+// Dates not in YYYY-MM-DD form are dropped.
+func (s *Server) extractEntities(ctx context.Context, content string) ([]storage.Entity, error) {
+	if s.config.LLM == nil {
+		return nil, ErrNoLLM
+	}
+	reply, err := s.complete(ctx, entitiesPrompt, content)
+	if err != nil {
+		return nil, err
+	}
+	var found entityReply
+	if err := decodeReply(reply, &found); err != nil {
+		return nil, err
+	}
+
+	var entities []storage.Entity
+	add := func(kind string, names []string) {
+		for _, name := range names {
+			if name = strings.TrimSpace(name); name != "" {
+				entities = append(entities, storage.Entity{Kind: kind, Name: name})
+			}
+		}
+	}
+	add(storage.EntityPerson, found.People)
+	add(storage.EntityProject, found.Projects)
+	for _, d := range found.Dates {
+		if _, err := time.Parse(time.DateOnly, strings.TrimSpace(d)); err == nil {
+			add(storage.EntityDate, []string{d})
+		}
+	}
+	return entities, nil
+}
+
+// checkEntityKind rejects kinds other than those of storage.EntityKinds.
+func checkEntityKind(kind string) error {
+	if kind != "" && !slices.Contains(storage.EntityKinds, kind) {
+		return fmt.Errorf("kind must be one of %s", strings.Join(storage.EntityKinds, ", "))
+	}
+	return nil
+}
+
+// filterIDs returns the IDs of the chunks matching a metadata filter and
+// mentioning an entity, either of which may be empty.
+func (s *Server) filterIDs(ctx context.Context, metadata map[string]any, kind, entity string) ([]string, error) {
+	var ids []string
+	if len(metadata) > 0 {
+		var err error
+		if ids, err = s.db.FilterChunkIDs(ctx, metadata); err != nil {
+			return nil, err
+		}
+	}
+	if entity == "" {
+		return ids, nil
+	}
+	mentioning, err := s.db.EntityChunkIDs(ctx, kind, entity)
+	if err != nil || len(metadata) == 0 {
+		return mentioning, err
+	}
+	return slices.DeleteFunc(ids, func(id string) bool {
+		_, found := slices.BinarySearch(mentioning, id)
+		return !found
+	}), nil
+}
+
+// entityResult is an entity listed by get_entities.
+type entityResult struct {
+	storage.EntityCount
+	ChunkIDs []string `json:"chunk_ids,omitempty"`
+}
+
+func (s *Server) toolGetEntities(ctx context.Context, args json.RawMessage) (any, error) {
+	var params struct {
+		Kind          string `json:"kind"`
+		Query         string `json:"query"`
+		ChunkID       string `json:"chunk_id"`
+		IncludeChunks bool   `json:"include_chunks"`
+		Limit         int    `json:"limit"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if err := checkEntityKind(params.Kind); err != nil {
+		return nil, err
+	}
+	if params.ChunkID != "" {
+		if _, err := s.db.GetChunk(ctx, params.ChunkID); errors.Is(err, storage.ErrChunkNotFound) {
+			return map[string]any{"found": false}, nil
+		} else if err != nil {
+			return nil, err
+		}
+		entities, err := s.db.ChunkEntities(ctx, params.ChunkID)
+		if err != nil {
+			return nil, err
+		}
+		if params.Kind != "" {
+			entities = slices.DeleteFunc(entities, func(e storage.Entity) bool { return e.Kind != params.Kind })
+		}
+		return map[string]any{"entities": entities, "count": len(entities)}, nil
+	}
+	if params.Limit <= 0 {
+		params.Limit = 50
+	}
+
+	counts, err := s.db.ListEntities(ctx, params.Kind)
+	if err != nil {
+		return nil, err
+	}
+	query := storage.NormalizeEntity(params.Query)
+	results := []entityResult{}
+	for _, c := range counts {
+		if len(results) == params.Limit {
+			break
+		}
+		if query != "" && !strings.Contains(storage.NormalizeEntity(c.Name), query) {
+			continue
+		}
+		r := entityResult{EntityCount: c}
+		if params.IncludeChunks {
+			if r.ChunkIDs, err = s.db.EntityChunkIDs(ctx, c.Kind, c.Name); err != nil {
+				return nil, err
+			}
+		}
+		results = append(results, r)
+	}
+	return map[string]any{"entities": results, "count": len(results)}, nil
+}
@@ -0,0 +1,76 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// semanticSearchCapability is the experimental capability reporting
+// whether semantic_search can currently embed queries.
+const semanticSearchCapability = "mykb/semanticSearch"
+
+// Embedding health probing: results are reused for healthTTL, and a probe
+// gives up after healthProbeTimeout so initialize stays quick.
+const (
+	healthTTL          = time.Minute
+	healthProbeTimeout = 2 * time.Second
+)
+
+// EmbeddingHealth reports whether the embedding provider is reachable, and
+// so whether semantic_search works.
+type EmbeddingHealth struct {
+	Configured bool      `json:"configured"`
+	Available  bool      `json:"available"`
+	Model      string    `json:"model,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	CheckedAt  time.Time `json:"checkedAt,omitzero"`
+}
+
+// embedHealth caches the last embedding outcome, from a probe or from
+// any embedding the server made.
+type embedHealth struct {
+	mu   sync.Mutex
+	last EmbeddingHealth
+}
+
+// EmbeddingHealth returns the provider's health, probing it with a short
+// embedding when the last outcome is older than a minute.
+func (s *Server) EmbeddingHealth(ctx context.Context) EmbeddingHealth {
+	if s.embedder == nil {
+		return EmbeddingHealth{}
+	}
+	s.health.mu.Lock()
+	last := s.health.last
+	s.health.mu.Unlock()
+	if !last.CheckedAt.IsZero() && time.Since(last.CheckedAt) < healthTTL {
+		return last
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthProbeTimeout)
+	defer cancel()
+	_, err := s.embedder.Embed(ctx, []string{"ping"})
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = errors.New("embedding provider did not respond within " + healthProbeTimeout.String())
+	}
+	s.recordHealth(err)
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+	return s.health.last
+}
+
+// recordHealth notes the outcome of an embedding request. Cancelled
+// requests say nothing about the provider.
+func (s *Server) recordHealth(err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	h := EmbeddingHealth{Configured: true, Available: err == nil, Model: s.embedder.Model(), CheckedAt: time.Now()}
+	if err != nil {
+		h.Error = err.Error()
+	}
+	s.health.mu.Lock()
+	s.health.last = h
+	s.health.mu.Unlock()
+}
@@ -0,0 +1,244 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/neoden/mykb/events"
+	"github.com/neoden/mykb/ingest"
+	"github.com/neoden/mykb/storage"
+)
+
+// IngestResult reports the chunks stored for one document.
+type IngestResult struct {
+	Source   string   `json:"source"`
+	Title    string   `json:"title,omitempty"`
+	ChunkIDs []string `json:"chunk_ids"`
+	// Deferred counts chunks stored without an embedding (see DeferOnTimeout).
+	Deferred int `json:"embeddings_deferred,omitempty"`
+	// SourceID is the source record the chunks reference.
+	SourceID string `json:"source_id,omitempty"`
+	// AttachmentID is the recording a transcript's first chunk is
+	// attached to.
+	AttachmentID string `json:"attachment_id,omitempty"`
+}
+
+// IngestDocument splits doc with the configured chunker and stores each
+// piece as a chunk, embedded like store_chunk. Chunk metadata is metadata
+// plus source, title, offset and length (the piece's byte range in
+// doc.Text), part/parts and, for PDFs, page. The chunks reference the
+// source record named doc.Source, which is created if needed. If a piece
+// fails, the chunks already stored for doc are removed again.
+func (s *Server) IngestDocument(ctx context.Context, doc *ingest.Document, metadata map[string]any) (*IngestResult, error) {
+	pieces := s.config.Ingest.SplitDocument(doc)
+	result := &IngestResult{Source: doc.Source, Title: doc.Title, ChunkIDs: []string{}}
+	if doc.Source != "" {
+		var err error
+		if result.SourceID, err = s.documentSource(ctx, doc.Source, doc.Title); err != nil {
+			return nil, fmt.Errorf("source %s: %w", doc.Source, err)
+		}
+	}
+
+	for i, p := range pieces {
+		meta := make(map[string]any, len(metadata)+7)
+		if doc.Title != "" {
+			meta["title"] = doc.Title
+		}
+		for k, v := range metadata {
+			meta[k] = v
+		}
+		meta["source"] = doc.Source
+		meta["offset"] = p.Start
+		meta["length"] = p.End - p.Start
+		meta["part"] = i + 1
+		meta["parts"] = len(pieces)
+		if p.Page > 0 {
+			meta["page"] = p.Page
+		}
+		raw, err := json.Marshal(meta)
+		if err != nil {
+			return nil, fmt.Errorf("encode metadata: %w", err)
+		}
+
+		chunk, deferred, err := s.storeChunk(ctx, p.Text, raw, result.SourceID)
+		if err != nil {
+			s.removeChunks(ctx, result.ChunkIDs)
+			return nil, fmt.Errorf("part %d of %s: %w", i+1, doc.Source, err)
+		}
+		result.ChunkIDs = append(result.ChunkIDs, chunk.ID)
+		if deferred {
+			result.Deferred++
+		}
+	}
+	return result, nil
+}
+
+// ErrNoTranscriber is returned by IngestAudio when no transcription
+// provider is configured.
+var ErrNoTranscriber = errors.New("no transcription provider is configured")
+
+// Transcribes reports whether IngestAudio has a transcription provider.
+func (s *Server) Transcribes() bool {
+	return s.config.Transcriber != nil
+}
+
+// IngestAudio transcribes a recording and ingests the transcript like
+// IngestDocument, with the recording attached to its first chunk; the
+// chunks' metadata also records the transcription model. name is the
+// recording's file name, which becomes the document source.
+func (s *Server) IngestAudio(ctx context.Context, name, contentType string, audio []byte, metadata map[string]any) (*IngestResult, error) {
+	if s.config.ReadOnly {
+		return nil, ErrReadOnly
+	}
+	if !grantFrom(ctx).allows("ingest_document") {
+		return nil, ErrNotAllowed
+	}
+	if s.config.Transcriber == nil {
+		return nil, ErrNoTranscriber
+	}
+
+	tctx := ctx
+	if s.config.TranscribeTimeout > 0 {
+		var cancel context.CancelFunc
+		tctx, cancel = context.WithTimeout(ctx, s.config.TranscribeTimeout)
+		defer cancel()
+	}
+	text, err := s.config.Transcriber.Transcribe(tctx, filepath.Base(name), audio)
+	if err != nil {
+		return nil, fmt.Errorf("transcribe %s: %w", name, err)
+	}
+	if text == "" {
+		return nil, fmt.Errorf("%s: no speech to ingest", name)
+	}
+
+	meta := make(map[string]any, len(metadata)+1)
+	for k, v := range metadata {
+		meta[k] = v
+	}
+	meta["transcribed_by"] = s.config.Transcriber.Model()
+	doc := &ingest.Document{
+		Source: name,
+		Title:  strings.TrimSuffix(filepath.Base(name), filepath.Ext(name)),
+		Text:   text,
+	}
+	result, err := s.IngestDocument(ctx, doc, meta)
+	if err != nil {
+		return nil, err
+	}
+	a, err := s.db.AddAttachment(ctx, result.ChunkIDs[0], filepath.Base(name), contentType, audio)
+	if err != nil {
+		s.removeChunks(ctx, result.ChunkIDs)
+		return nil, fmt.Errorf("attach %s: %w", name, err)
+	}
+	result.AttachmentID = a.ID
+	return result, nil
+}
+
+// StoreChunk stores a chunk and its embedding like store_chunk, attributed
+// to the client in ctx. deferred is true when its embedding timed out and
+// was left for reindex (see DeferOnTimeout).
+func (s *Server) StoreChunk(ctx context.Context, content string, metadata json.RawMessage) (chunk *storage.Chunk, deferred bool, err error) {
+	return s.storeChunk(ctx, content, metadata, "")
+}
+
+// DeleteChunks deletes chunks and their vectors, returning how many
+// existed. If any is locked none are deleted.
+func (s *Server) DeleteChunks(ctx context.Context, ids []string) (int, error) {
+	deleted, err := s.deleteUnlocked(ctx, ids...)
+	return len(deleted), err
+}
+
+// PutChunks stores chunks received from another instance with their own
+// IDs and timestamps, replacing any local versions. Chunks whose embedded
+// text changed are embedded again; those that fail to embed are queued
+// (see RunEmbeddingQueue) and counted in deferred. If any is locked none
+// are stored.
+func (s *Server) PutChunks(ctx context.Context, chunks []storage.Chunk) (deferred int, err error) {
+	for i := range chunks {
+		if err := s.checkUnlocked(ctx, chunks[i].ID); err != nil {
+			return 0, err
+		}
+	}
+	for i := range chunks {
+		c := &chunks[i]
+		existing, err := s.db.GetChunk(ctx, c.ID)
+		if err != nil && !errors.Is(err, storage.ErrChunkNotFound) {
+			return deferred, err
+		}
+		if err := s.db.PutChunk(ctx, c); err != nil {
+			return deferred, err
+		}
+
+		if text := s.embedText(c); s.embedder != nil && (existing == nil || s.embedText(existing) != text) {
+			vec, err := s.embed(ctx, s.config.IngestTimeout, text, false)
+			if err == nil {
+				err = s.db.SaveEmbedding(ctx, c.ID, s.embedder.Model(), text, vec)
+			}
+			if err != nil {
+				// An outdated vector would match the old text
+				log.Printf("Embedding deferred for chunk %s: %v", c.ID, err)
+				if err := s.db.DeleteEmbedding(ctx, c.ID); err != nil {
+					return deferred, err
+				}
+				s.index.Remove(c.ID)
+				s.queueEmbedding(ctx, c.ID, err)
+				deferred++
+			} else {
+				s.index.Add(c.ID, vec)
+			}
+		}
+
+		if existing == nil {
+			s.publishChunk(ctx, events.ChunkCreated, c.ID, c)
+		} else {
+			s.publishChunk(ctx, events.ChunkUpdated, c.ID, c)
+		}
+	}
+	return deferred, nil
+}
+
+// removeChunks undoes a partial ingestion. Chunks locked meanwhile are
+// kept.
+func (s *Server) removeChunks(ctx context.Context, ids []string) {
+	for _, id := range ids {
+		if _, err := s.deleteUnlocked(ctx, id); err != nil {
+			log.Printf("Remove partially ingested chunk %s: %v", id, err)
+		}
+	}
+}
+
+func (s *Server) toolIngestDocument(ctx context.Context, args json.RawMessage) (any, error) {
+	var params struct {
+		Content  string         `json:"content"`
+		URL      string         `json:"url"`
+		Format   string         `json:"format"`
+		Source   string         `json:"source"`
+		Metadata map[string]any `json:"metadata"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if (params.Content == "") == (params.URL == "") {
+		return nil, fmt.Errorf("exactly one of content or url is required")
+	}
+
+	var doc *ingest.Document
+	var err error
+	if params.URL != "" {
+		if !strings.HasPrefix(params.URL, "http://") && !strings.HasPrefix(params.URL, "https://") {
+			return nil, fmt.Errorf("url must be http or https") // never read server files
+		}
+		doc, err = ingest.Load(ctx, params.URL)
+	} else {
+		doc, err = ingest.Parse(params.Source, []byte(params.Content), params.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.IngestDocument(ctx, doc, params.Metadata)
+}
@@ -0,0 +1,87 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/neoden/mykb/events"
+)
+
+// ErrPermissionDenied is returned when a client would change or delete a
+// locked chunk.
+var ErrPermissionDenied = errors.New("PERMISSION_DENIED")
+
+// lockReader reads chunk locks: the database, or a write transaction, in
+// which a lock found absent stays so until it commits.
+type lockReader interface {
+	ChunkLocked(ctx context.Context, id string) (bool, error)
+}
+
+// checkUnlocked fails with ErrPermissionDenied if chunk id is locked.
+// Locks are lifted only by an admin (mykb unlock, or POST
+// /admin/chunks/{id}/unlock with the admin token), never by MCP clients.
+func (s *Server) checkUnlocked(ctx context.Context, id string) error {
+	return checkUnlocked(ctx, s.db, id)
+}
+
+func checkUnlocked(ctx context.Context, locks lockReader, id string) error {
+	locked, err := locks.ChunkLocked(ctx, id)
+	if err != nil {
+		return err
+	}
+	if locked {
+		return fmt.Errorf("%w: chunk %s is locked; only an admin can unlock it", ErrPermissionDenied, id)
+	}
+	return nil
+}
+
+// CheckUnlocked fails with ErrPermissionDenied if any of the chunks is
+// locked, so that a batch can be refused before any of it is applied.
+func (s *Server) CheckUnlocked(ctx context.Context, ids ...string) error {
+	for _, id := range ids {
+		if err := s.checkUnlocked(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteUnlocked deletes chunks and their vectors in one transaction,
+// returning those that existed. If any is locked none are deleted; the
+// check and the deletes cannot be split by a lock committed in between.
+func (s *Server) deleteUnlocked(ctx context.Context, ids ...string) ([]string, error) {
+	tx, err := s.db.BeginTx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, id := range ids {
+		if err := checkUnlocked(ctx, tx, id); err != nil {
+			return nil, err
+		}
+	}
+	var deleted []string
+	for _, id := range ids {
+		ok, err := tx.DeleteChunk(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			deleted = append(deleted, id)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+
+	// The database cascades to embeddings; the index is kept here
+	for _, id := range deleted {
+		if s.index != nil {
+			s.index.Remove(id)
+		}
+		s.publishChunk(ctx, events.ChunkDeleted, id, nil)
+	}
+	return deleted, nil
+}
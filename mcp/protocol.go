@@ -34,6 +34,9 @@ const (
 	CodeMethodNotFound = -32601
 	CodeInvalidParams  = -32602
 	CodeInternalError  = -32603
+
+	// CodeResourceNotFound is MCP's error for reading an unknown resource.
+	CodeResourceNotFound = -32002
 )
 
 // MCP protocol types (2025-11-25)
@@ -65,8 +68,11 @@ type InitializeResult struct {
 
 // Capabilities describes server capabilities.
 type Capabilities struct {
-	Tools   *ToolsCapability `json:"tools,omitempty"`
-	Logging *struct{}        `json:"logging,omitempty"`
+	Tools     *ToolsCapability     `json:"tools,omitempty"`
+	Resources *ResourcesCapability `json:"resources,omitempty"`
+	Logging   *struct{}            `json:"logging,omitempty"`
+	// Experimental holds non-standard capabilities, keyed by name.
+	Experimental map[string]any `json:"experimental,omitempty"`
 }
 
 // ToolsCapability describes tool support.
@@ -74,6 +80,12 @@ type ToolsCapability struct {
 	ListChanged bool `json:"listChanged,omitempty"`
 }
 
+// ResourcesCapability describes resource support.
+type ResourcesCapability struct {
+	Subscribe   bool `json:"subscribe,omitempty"`
+	ListChanged bool `json:"listChanged,omitempty"`
+}
+
 // Tool describes an MCP tool.
 type Tool struct {
 	Name         string           `json:"name"`
@@ -114,6 +126,7 @@ type Property struct {
 	Default     interface{} `json:"default,omitempty"`
 	Items       *Property   `json:"items,omitempty"` // for arrays
 	AnyOf       []Property  `json:"anyOf,omitempty"` // for unions
+	Enum        []string    `json:"enum,omitempty"`  // allowed string values
 }
 
 // ToolsListResult is returned from tools/list.
@@ -128,6 +141,12 @@ type CallToolParams struct {
 	Arguments json.RawMessage `json:"arguments,omitempty"`
 }
 
+// CancelledParams are params for notifications/cancelled.
+type CancelledParams struct {
+	RequestID json.RawMessage `json:"requestId"`
+	Reason    string          `json:"reason,omitempty"`
+}
+
 // CallToolResult is returned from tools/call.
 type CallToolResult struct {
 	Content           []Content   `json:"content"`
@@ -135,6 +154,40 @@ type CallToolResult struct {
 	IsError           bool        `json:"isError,omitempty"`
 }
 
+// Resource describes a readable MCP resource.
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+}
+
+// ResourcesListResult is returned from resources/list.
+type ResourcesListResult struct {
+	Resources  []Resource `json:"resources"`
+	NextCursor *string    `json:"nextCursor,omitempty"`
+}
+
+// ReadResourceParams are params for resources/read.
+type ReadResourceParams struct {
+	URI string `json:"uri"`
+}
+
+// ReadResourceResult is returned from resources/read.
+type ReadResourceResult struct {
+	Contents []ResourceContents `json:"contents"`
+}
+
+// ResourceContents is the content of a resource: Text, or base64 Blob for
+// binary data.
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
 // Content is a content block in tool results.
 type Content struct {
 	Type        string              `json:"type"`
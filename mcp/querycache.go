@@ -0,0 +1,82 @@
+package mcp
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// queryCache keeps recent query embeddings so that agents repeating or
+// refining a semantic_search don't wait on the provider each time. Entries
+// expire after ttl, and the least recently used is evicted beyond size.
+type queryCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+type queryCacheEntry struct {
+	query   string
+	vec     []float32
+	expires time.Time
+}
+
+// newQueryCache returns nil, caching nothing, when size is not positive.
+func newQueryCache(size int, ttl time.Duration) *queryCache {
+	if size <= 0 {
+		return nil
+	}
+	return &queryCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// get returns the cached embedding of query. The vector is shared and must
+// not be modified.
+func (c *queryCache) get(query string) ([]float32, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[query]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*queryCacheEntry)
+	if c.ttl > 0 && !c.now().Before(e.expires) {
+		c.order.Remove(el)
+		delete(c.entries, query)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return e.vec, true
+}
+
+func (c *queryCache) put(query string, vec []float32) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := c.now().Add(c.ttl)
+	if el, ok := c.entries[query]; ok {
+		e := el.Value.(*queryCacheEntry)
+		e.vec, e.expires = vec, expires
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[query] = c.order.PushFront(&queryCacheEntry{query: query, vec: vec, expires: expires})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*queryCacheEntry).query)
+	}
+}
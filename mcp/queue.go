@@ -0,0 +1,116 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/neoden/mykb/embedding"
+	"github.com/neoden/mykb/storage"
+)
+
+// Embedding queue pacing: how often it is checked, how many chunks are
+// embedded per pass, and the longest wait between attempts for one chunk.
+const (
+	queueInterval = 30 * time.Second
+	queueBatch    = 50
+	queueMaxDelay = time.Hour
+)
+
+// queueEmbedding leaves a chunk whose embedding failed for RunEmbeddingQueue.
+func (s *Server) queueEmbedding(ctx context.Context, chunkID string, cause error) {
+	if err := s.db.QueueEmbedding(ctx, chunkID, cause.Error()); err != nil {
+		log.Printf("Queueing embedding for chunk %s: %v", chunkID, err)
+	}
+}
+
+// RunEmbeddingQueue retries queued embeddings every 30 seconds until ctx is
+// done, backing off per chunk while the provider keeps failing.
+func (s *Server) RunEmbeddingQueue(ctx context.Context) {
+	ticker := time.NewTicker(queueInterval)
+	defer ticker.Stop()
+	for {
+		n, err := s.DrainEmbeddingQueue(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Embedding queue: %v", err)
+		}
+		if n > 0 {
+			log.Printf("Embedding queue: embedded %d chunks", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DrainEmbeddingQueue makes one pass over the queued chunks that are due,
+// returning how many were embedded. A rate-limited provider ends the pass.
+func (s *Server) DrainEmbeddingQueue(ctx context.Context) (int, error) {
+	if s.embedder == nil {
+		return 0, nil
+	}
+	due, err := s.db.DueEmbeddings(ctx, time.Now(), queueBatch)
+	if err != nil {
+		return 0, err
+	}
+	model := s.embedder.Model()
+	embedded := 0
+	for _, q := range due {
+		if ctx.Err() != nil {
+			return embedded, ctx.Err()
+		}
+		// Reindex may have got to it first
+		status, err := s.db.EmbeddingStatus(ctx, q.ChunkID, model, s.config.MetadataFields)
+		if errors.Is(err, storage.ErrChunkNotFound) || status == storage.EmbeddingFresh {
+			if err := s.db.DequeueEmbedding(ctx, q.ChunkID); err != nil {
+				return embedded, err
+			}
+			continue
+		}
+		if err != nil {
+			return embedded, err
+		}
+		chunk, err := s.db.GetChunk(ctx, q.ChunkID)
+		if err != nil {
+			return embedded, err
+		}
+
+		text := s.embedText(chunk)
+		vec, err := s.embed(ctx, s.config.IngestTimeout, text, false)
+		if err == nil {
+			err = s.db.SaveEmbedding(ctx, chunk.ID, model, text, vec)
+		}
+		if err != nil {
+			var limited *embedding.RateLimitedError
+			wait := queueBackoff(q.Attempts)
+			if errors.As(err, &limited) {
+				wait = max(wait, limited.RetryAfter)
+			}
+			if perr := s.db.PostponeEmbedding(ctx, q.ChunkID, err.Error(), time.Now().Add(wait)); perr != nil {
+				return embedded, perr
+			}
+			if limited != nil {
+				// The rest would be rejected too
+				return embedded, err
+			}
+			continue
+		}
+		s.index.Add(chunk.ID, vec)
+		if err := s.db.DequeueEmbedding(ctx, chunk.ID); err != nil {
+			return embedded, err
+		}
+		embedded++
+	}
+	return embedded, nil
+}
+
+// queueBackoff doubles the wait from a minute with each failed attempt.
+func queueBackoff(attempts int) time.Duration {
+	if attempts >= 6 {
+		return queueMaxDelay
+	}
+	return min(time.Minute<<attempts, queueMaxDelay)
+}
@@ -0,0 +1,189 @@
+package mcp
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/neoden/mykb/graph"
+)
+
+// Ranking defaults.
+const (
+	DefaultRankingInterval = time.Hour
+	DefaultCentralityBoost = 0.5
+	DefaultRecencyBoost    = 0.2
+	DefaultRecencyHalfLife = 30 // days
+
+	// boostCandidates is how many times the requested limit boosted
+	// searches fetch before reordering.
+	boostCandidates = 3
+	// rrfK smooths full-text rank positions into scores (as in reciprocal
+	// rank fusion) so centrality can lift results past near neighbours.
+	rrfK = 10
+)
+
+// RankingConfig controls chunk importance scores computed over the
+// [[chunk-id]] link graph.
+type RankingConfig struct {
+	// IntervalMinutes is how often scores are recomputed (default 60).
+	IntervalMinutes int `toml:"interval_minutes"`
+	// Boost is how much the most central chunk's score is raised in searches
+	// with boost_central (default 0.5, i.e. up to 1.5x).
+	Boost float64 `toml:"boost"`
+	// RecencyBoost is how much a chunk updated just now is raised in
+	// searches with boost_recent (default 0.2, i.e. up to 1.2x); the boost
+	// halves every RecencyHalfLifeDays (default 30) since its last update.
+	RecencyBoost        float64 `toml:"recency_boost"`
+	RecencyHalfLifeDays float64 `toml:"recency_half_life_days"`
+}
+
+// Interval returns how often scores are recomputed.
+func (c RankingConfig) Interval() time.Duration {
+	if c.IntervalMinutes > 0 {
+		return time.Duration(c.IntervalMinutes) * time.Minute
+	}
+	return DefaultRankingInterval
+}
+
+func (c RankingConfig) boost() float64 {
+	if c.Boost > 0 {
+		return c.Boost
+	}
+	return DefaultCentralityBoost
+}
+
+// recency returns the factor a chunk last updated age ago is boosted by.
+func (c RankingConfig) recency(age time.Duration) float64 {
+	boost := c.RecencyBoost
+	if boost <= 0 {
+		boost = DefaultRecencyBoost
+	}
+	return 1 + boost*c.decay(age)
+}
+
+// decay halves from 1 every RecencyHalfLifeDays of age.
+func (c RankingConfig) decay(age time.Duration) float64 {
+	halfLife := c.RecencyHalfLifeDays
+	if halfLife <= 0 {
+		halfLife = DefaultRecencyHalfLife
+	}
+	days := max(age.Hours()/24, 0)
+	return math.Exp2(-days / halfLife)
+}
+
+// centrality holds the latest PageRank scores.
+type centrality struct {
+	mu      sync.RWMutex
+	scores  map[string]float64
+	max     float64
+	updated time.Time
+}
+
+// RefreshRanking recomputes chunk importance from the link graph.
+func (s *Server) RefreshRanking(ctx context.Context) error {
+	nodes, links, err := s.db.LinkGraph(ctx)
+	if err != nil {
+		return err
+	}
+	scores := graph.PageRank(nodes, links)
+	max := 0.0
+	for _, v := range scores {
+		if v > max {
+			max = v
+		}
+	}
+
+	s.rank.mu.Lock()
+	defer s.rank.mu.Unlock()
+	s.rank.scores = scores
+	s.rank.max = max
+	s.rank.updated = time.Now().UTC()
+	return nil
+}
+
+// RunRanking recomputes scores every RankingConfig.Interval until ctx is done.
+func (s *Server) RunRanking(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Ranking.Interval())
+	defer ticker.Stop()
+	for {
+		if err := s.RefreshRanking(ctx); err != nil {
+			log.Printf("Ranking refresh failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// rankingSnapshot returns the current scores, computing them first if
+// RunRanking has not.
+func (s *Server) rankingSnapshot(ctx context.Context) (map[string]float64, float64, time.Time, error) {
+	s.rank.mu.RLock()
+	scores, max, updated := s.rank.scores, s.rank.max, s.rank.updated
+	s.rank.mu.RUnlock()
+	if scores != nil {
+		return scores, max, updated, nil
+	}
+	if err := s.RefreshRanking(ctx); err != nil {
+		return nil, 0, time.Time{}, err
+	}
+	return s.rankingSnapshot(ctx)
+}
+
+// boosts selects what a search's results are boosted by.
+type boosts struct {
+	central bool // boost_central
+	recent  bool // boost_recent
+}
+
+func (b boosts) any() bool { return b.central || b.recent }
+
+// boostOrder returns the positions of ids reordered by base score times
+// 1 + Boost*score/max for centrality, so the most central chunk gains the
+// full Boost, and times RankingConfig.recency for recency.
+func (s *Server) boostOrder(ctx context.Context, ids []string, base func(i int) float64, b boosts) ([]int, error) {
+	boosted := make([]float64, len(ids))
+	order := make([]int, len(ids))
+	for i := range ids {
+		boosted[i] = base(i)
+		order[i] = i
+	}
+	if b.central {
+		scores, max, _, err := s.rankingSnapshot(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for i, id := range ids {
+			if max > 0 {
+				boosted[i] *= 1 + s.config.Ranking.boost()*scores[id]/max
+			}
+		}
+	}
+	if b.recent {
+		updated, err := s.db.UpdatedTimes(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		for i, id := range ids {
+			if t, ok := updated[id]; ok {
+				boosted[i] *= s.config.Ranking.recency(now.Sub(t))
+			}
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return boosted[order[a]] > boosted[order[b]]
+	})
+	return order, nil
+}
+
+// reciprocalRank scores a full-text result by its position.
+func reciprocalRank(i int) float64 {
+	return 1 / float64(rrfK+i)
+}
@@ -0,0 +1,85 @@
+package mcp
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// CodeRateLimited is returned for tool calls rejected by the rate limit.
+// Error.Data is a RetryInfo.
+const CodeRateLimited = -32029
+
+// rateLimitsCapability is the experimental capability advertising limits.
+const rateLimitsCapability = "mykb/rateLimits"
+
+// RateLimitConfig limits tool calls across all clients.
+type RateLimitConfig struct {
+	// ToolCallsPerMinute is the sustained rate; 0 disables the limit.
+	ToolCallsPerMinute int `toml:"tool_calls_per_minute" json:"toolCallsPerMinute"`
+	// Burst is how many calls may be made back to back (default ToolCallsPerMinute).
+	Burst int `toml:"burst" json:"burst"`
+}
+
+// Enabled reports whether tool calls are limited.
+func (c RateLimitConfig) Enabled() bool {
+	return c.ToolCallsPerMinute > 0
+}
+
+func (c RateLimitConfig) burst() int {
+	if c.Burst > 0 {
+		return c.Burst
+	}
+	return c.ToolCallsPerMinute
+}
+
+// RetryInfo tells a rate-limited client when to try again.
+type RetryInfo struct {
+	RetryAfterMs       int64 `json:"retryAfterMs"`
+	ToolCallsPerMinute int   `json:"toolCallsPerMinute"`
+	Burst              int   `json:"burst"`
+}
+
+func newToolLimiter(c RateLimitConfig) *rate.Limiter {
+	if !c.Enabled() {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(float64(c.ToolCallsPerMinute)/60), c.burst())
+}
+
+// rateLimitWait takes a token for one tool call. If none is available it
+// returns how long until one is, and the call should be rejected.
+func (s *Server) rateLimitWait() time.Duration {
+	if s.limiter == nil {
+		return 0
+	}
+	r := s.limiter.Reserve()
+	wait := r.Delay()
+	if wait == 0 {
+		return 0
+	}
+	r.Cancel() // the call is rejected, not queued
+	return (wait + time.Millisecond - 1).Truncate(time.Millisecond)
+}
+
+// rateLimitError is the error for a call rejected with wait remaining.
+func (s *Server) rateLimitError(wait time.Duration) *Error {
+	return &Error{
+		Code:    CodeRateLimited,
+		Message: fmt.Sprintf("Rate limit exceeded; retry after %s", wait),
+		Data: RetryInfo{
+			RetryAfterMs:       wait.Milliseconds(),
+			ToolCallsPerMinute: s.config.RateLimit.ToolCallsPerMinute,
+			Burst:              s.config.RateLimit.burst(),
+		},
+	}
+}
+
+// instructions tells agents how to pace themselves.
+func (c RateLimitConfig) instructions() string {
+	return fmt.Sprintf(`
+
+Tool calls are limited to %d per minute (bursts of %d). A rejected call returns error code %d with data.retryAfterMs; wait that long before retrying instead of retrying immediately.`,
+		c.ToolCallsPerMinute, c.burst(), CodeRateLimited)
+}
@@ -0,0 +1,85 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/neoden/mykb/storage"
+	"github.com/neoden/mykb/vector"
+)
+
+// DefaultRecordedCalls is how many tool calls are kept when recording.
+const DefaultRecordedCalls = 200
+
+// RecordingConfig controls the tool call log replayed by `mykb replay`.
+// Recorded arguments and responses quote chunk content, so recording is
+// off unless enabled.
+type RecordingConfig struct {
+	// Enabled records every tool call with its arguments and response.
+	Enabled bool `toml:"enabled"`
+	// Keep is how many of the most recent calls are kept (default 200).
+	Keep int `toml:"keep"`
+}
+
+// Limit returns how many calls are kept.
+func (c RecordingConfig) Limit() int {
+	if c.Keep > 0 {
+		return c.Keep
+	}
+	return DefaultRecordedCalls
+}
+
+// recordToolCall logs a finished call for replay. Failures only cost the
+// call its record, so they are logged.
+func (s *Server) recordToolCall(ctx context.Context, p CallToolParams, result *CallToolResult, elapsed time.Duration) {
+	if !s.config.Recording.Enabled || s.config.ReadOnly {
+		return
+	}
+	resp, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("Record %s call: %v", p.Name, err)
+		return
+	}
+	args := p.Arguments
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	call := &storage.ToolCall{
+		Client:     clientFrom(ctx),
+		Tool:       p.Name,
+		Arguments:  args,
+		Response:   resp,
+		IsError:    result.IsError,
+		DurationMS: elapsed.Milliseconds(),
+	}
+	// Cancelled calls are recorded too
+	if err := s.db.RecordToolCall(context.WithoutCancel(ctx), call, s.config.Recording.Limit()); err != nil {
+		log.Printf("Record %s call: %v", p.Name, err)
+	}
+}
+
+// WithStorage returns a server running the same tools against db and
+// index, for dry runs. It publishes and records nothing and is not rate
+// limited.
+func (s *Server) WithStorage(db storage.TxStorage, index *vector.Index) *Server {
+	cfg := *s.config
+	cfg.Events = nil
+	cfg.RateLimit = RateLimitConfig{}
+	cfg.Recording = RecordingConfig{}
+	cfg.ReadOnly = false
+	return NewServerWithConfig(db, s.embedder, index, &cfg)
+}
+
+// Replay runs a recorded call again as the same client and returns the
+// response it gives now.
+func (s *Server) Replay(ctx context.Context, call *storage.ToolCall) (*CallToolResult, error) {
+	handler, ok := s.tools[call.Tool]
+	if !ok {
+		return nil, fmt.Errorf("unknown tool: %s", call.Tool)
+	}
+	result, err := handler(WithClient(ctx, call.Client), call.Arguments)
+	return toolResult(result, err), nil
+}
@@ -0,0 +1,49 @@
+package mcp
+
+import (
+	"context"
+	"log"
+	"sort"
+)
+
+// reranks reports whether a search reranks its results: when a reranker
+// is configured, unless the call passed rerank: false.
+func (s *Server) reranks(requested *bool) bool {
+	return s.config.Reranker != nil && (requested == nil || *requested)
+}
+
+// rerankLimit is how many results a reranked search fetches for limit.
+func (s *Server) rerankLimit(limit int) int {
+	return max(limit, s.config.RerankTopN)
+}
+
+// rerankOrder returns the positions of texts, the best results of a
+// search for query (at most RerankTopN), ordered by the reranker's
+// relevance scores, and the score at each position. If reranking fails, ok
+// is false and the search keeps its order.
+func (s *Server) rerankOrder(ctx context.Context, query string, texts []string) (order []int, scores []float64, ok bool) {
+	if len(texts) == 0 {
+		return nil, nil, false
+	}
+	if s.config.RerankTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.RerankTimeout)
+		defer cancel()
+	}
+	relevance, err := s.config.Reranker.Rerank(ctx, query, texts)
+	if err != nil {
+		log.Printf("WARNING: rerank with %s: %v", s.config.Reranker.Model(), err)
+		return nil, nil, false
+	}
+
+	order = make([]int, len(texts))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return relevance[order[a]] > relevance[order[b]] })
+	scores = make([]float64, len(order))
+	for i, pos := range order {
+		scores[i] = relevance[pos]
+	}
+	return order, scores, true
+}
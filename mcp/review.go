@@ -0,0 +1,48 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/neoden/mykb/review"
+)
+
+// ReviewQueue returns up to limit chunks due for review (the configured
+// length if limit is 0).
+func (s *Server) ReviewQueue(ctx context.Context, limit int) ([]review.Item, error) {
+	cfg := s.config.Review
+	if !cfg.Enabled() {
+		return nil, fmt.Errorf("review not configured: set a policy under [review]")
+	}
+	if limit <= 0 {
+		limit = cfg.QueueLimit()
+	}
+	chunks, err := s.db.GetAllChunks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	accessed, err := s.db.AccessTimes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Queue(chunks, accessed, time.Now(), limit), nil
+}
+
+func (s *Server) toolGetReviewQueue(ctx context.Context, args json.RawMessage) (any, error) {
+	var params struct {
+		Limit int `json:"limit"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	items, err := s.ReviewQueue(ctx, params.Limit)
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []review.Item{}
+	}
+	return map[string]any{"items": items, "count": len(items)}, nil
+}
@@ -0,0 +1,91 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"time"
+
+	"github.com/neoden/mykb/storage"
+)
+
+// maxSample is the most chunks sample_chunks returns.
+const maxSample = 100
+
+func (s *Server) toolSampleChunks(ctx context.Context, args json.RawMessage) (any, error) {
+	var params struct {
+		N            int            `json:"n"`
+		Metadata     map[string]any `json:"metadata"`
+		WeightRecent bool           `json:"weight_recent"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if params.N <= 0 {
+		params.N = 5
+	}
+	params.N = min(params.N, maxSample)
+
+	// Without a filter, every chunk
+	ids, err := s.db.FilterChunkIDs(ctx, params.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	var weights []float64
+	if params.WeightRecent {
+		updated, err := s.db.UpdatedTimes(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		weights = make([]float64, len(ids))
+		for i, id := range ids {
+			weights[i] = s.config.Ranking.decay(now.Sub(updated[id]))
+		}
+	}
+
+	type sampled struct {
+		ID        string          `json:"id"`
+		Content   string          `json:"content"`
+		Metadata  json.RawMessage `json:"metadata,omitempty"`
+		Truncated bool            `json:"truncated,omitempty"`
+		UpdatedAt time.Time       `json:"updated_at"`
+	}
+	results := make([]sampled, 0, min(params.N, len(ids)))
+	for _, i := range sample(len(ids), params.N, weights) {
+		chunk, err := s.db.GetChunk(ctx, ids[i])
+		if err != nil {
+			continue // deleted since it was listed
+		}
+		content, truncated := storage.Truncate(chunk.Content, storage.SemanticPreviewLength)
+		results = append(results, sampled{
+			ID:        chunk.ID,
+			Content:   content,
+			Metadata:  chunk.Metadata,
+			Truncated: truncated,
+			UpdatedAt: chunk.UpdatedAt,
+		})
+	}
+	return map[string]any{"results": results, "count": len(results), "population": len(ids)}, nil
+}
+
+// sample picks k of n positions at random without replacement, each with
+// a chance proportional to its weight, or uniformly when weights is nil
+// (Efraimidis-Spirakis: keep the k largest u^(1/w) for uniform u).
+func sample(n, k int, weights []float64) []int {
+	if weights == nil {
+		return rand.Perm(n)[:min(k, n)]
+	}
+	keys := make([]float64, n)
+	order := make([]int, n)
+	for i, w := range weights {
+		order[i] = i
+		// In log space, as u^(1/w) underflows for tiny weights
+		keys[i] = math.Log(1-rand.Float64()) / max(w, math.SmallestNonzeroFloat64)
+	}
+	sort.Slice(order, func(a, b int) bool { return keys[order[a]] > keys[order[b]] })
+	return order[:min(k, n)]
+}
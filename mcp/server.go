@@ -8,24 +8,125 @@ import (
 	"io"
 	"log"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/neoden/mykb/embedding"
+	"github.com/neoden/mykb/events"
+	"github.com/neoden/mykb/ingest"
+	"github.com/neoden/mykb/llm"
+	"github.com/neoden/mykb/rerank"
+	"github.com/neoden/mykb/review"
 	"github.com/neoden/mykb/storage"
+	"github.com/neoden/mykb/transcribe"
 	"github.com/neoden/mykb/vector"
+	"golang.org/x/time/rate"
 )
 
+// Version is the mykb release, reported to MCP clients and recorded in
+// exports.
+const Version = "0.1.0"
+
 const (
-	serverName    = "mykb"
-	serverVersion = "0.1.0"
-	mcpVersion    = "2025-11-25"
+	serverName = "mykb"
+	mcpVersion = "2025-11-25"
 )
 
+// Config holds MCP server settings.
+type Config struct {
+	// MetadataFields are embedded along with content (see embedding.Text).
+	MetadataFields []string
+	// ReembedOnMetadata re-embeds on metadata-only updates touching MetadataFields.
+	ReembedOnMetadata bool
+	// Events receives a record of every tool call (optional).
+	Events *events.Bus
+
+	// QueryTimeout bounds query embedding in semantic_search.
+	QueryTimeout time.Duration
+	// QueryCacheSize is how many query embeddings semantic_search keeps for
+	// QueryCacheTTL (0 disables the cache; a TTL of 0 never expires them).
+	QueryCacheSize int
+	QueryCacheTTL  time.Duration
+	// IngestTimeout bounds embedding in store_chunk and update_chunk
+	// (0 uses the provider's HTTP timeout).
+	IngestTimeout time.Duration
+	// DeferOnTimeout stores chunks without an embedding when IngestTimeout
+	// expires or the provider stays rate limited (embedding.RateLimitedError).
+	DeferOnTimeout bool
+
+	// RateLimit limits tool calls; limits are advertised in initialize.
+	RateLimit RateLimitConfig
+
+	// Ranking controls link-graph importance scores.
+	Ranking RankingConfig
+
+	// Sessions controls capture sessions (get_session_chunks).
+	Sessions SessionConfig
+
+	// Reranker, when set, reorders the best RerankTopN results of
+	// search_chunks and semantic_search, each call bounded by
+	// RerankTimeout.
+	Reranker      rerank.Reranker
+	RerankTopN    int
+	RerankTimeout time.Duration
+
+	// Ingest controls how ingest_document splits documents into chunks.
+	Ingest ingest.Config
+
+	// Unfurl controls fetching the pages linked from store_chunk content.
+	Unfurl UnfurlConfig
+
+	// Daily sets the time zone of append_daily_note and get_daily_note.
+	Daily DailyConfig
+
+	// LLM, when set, suggests metadata for new chunks as Enrich
+	// configures and extracts their entities as Entities does, each
+	// completion bounded by LLMTimeout.
+	LLM        llm.Completer
+	LLMTimeout time.Duration
+	Enrich     EnrichConfig
+	Entities   EntitiesConfig
+
+	// Transcriber, when set, turns audio into text for IngestAudio, each
+	// recording bounded by TranscribeTimeout.
+	Transcriber       transcribe.Transcriber
+	TranscribeTimeout time.Duration
+
+	// Recording keeps recent tool calls for replay.
+	Recording RecordingConfig
+
+	// Review selects the chunks get_review_queue returns.
+	Review review.Config
+
+	// ReadOnly serves a read-only mirror: only tools with ReadOnlyHint are
+	// listed, and calls to the others are refused.
+	ReadOnly bool
+}
+
+// DefaultConfig returns configuration with default values.
+func DefaultConfig() *Config {
+	return &Config{
+		QueryTimeout:   embedding.DefaultQueryTimeout,
+		QueryCacheSize: embedding.DefaultQueryCacheSize,
+		QueryCacheTTL:  embedding.DefaultQueryCacheTTL,
+		RerankTopN:     rerank.DefaultTopN,
+		RerankTimeout:  rerank.DefaultTimeout,
+	}
+}
+
 // Server is an MCP server.
 type Server struct {
 	db       storage.TxStorage
 	embedder embedding.EmbeddingProvider
 	index    *vector.Index
+	config   *Config
 	tools    map[string]ToolHandler
+	limiter  *rate.Limiter // nil when tool calls are unlimited
+	rank     centrality
+	queries  *queryCache // nil when query embeddings are not cached
+	health   embedHealth
+	dailyMu  sync.Mutex // serializes append_daily_note
+	inflight inflight
 }
 
 // ToolHandler handles a tool call.
@@ -34,30 +135,59 @@ type ToolHandler func(ctx context.Context, args json.RawMessage) (any, error)
 // NewServer creates a new MCP server.
 // embedder can be nil if embedding provider is not configured.
 func NewServer(db storage.TxStorage, embedder embedding.EmbeddingProvider, index *vector.Index) *Server {
+	return NewServerWithConfig(db, embedder, index, DefaultConfig())
+}
+
+// NewServerWithConfig creates a new MCP server with the given settings.
+func NewServerWithConfig(db storage.TxStorage, embedder embedding.EmbeddingProvider, index *vector.Index, config *Config) *Server {
 	s := &Server{
 		db:       db,
 		embedder: embedder,
 		index:    index,
+		config:   config,
 		tools:    make(map[string]ToolHandler),
+		limiter:  newToolLimiter(config.RateLimit),
+		queries:  newQueryCache(config.QueryCacheSize, config.QueryCacheTTL),
 	}
 	s.registerTools()
 	return s
 }
 
+// stdioQueue is how many requests read from stdin wait while one is
+// handled.
+const stdioQueue = 64
+
 // ServeStdio runs the server over stdin/stdout.
 func (s *Server) ServeStdio() error {
-	reader := bufio.NewReader(os.Stdin)
+	ctx := WithClient(context.Background(), stdioClient)
 	encoder := json.NewEncoder(os.Stdout)
 
-	for {
-		line, err := reader.ReadBytes('\n')
-		if err == io.EOF {
-			return nil
-		}
-		if err != nil {
-			return fmt.Errorf("read stdin: %w", err)
+	// Requests are handled in turn while stdin is still read, so that a
+	// notifications/cancelled reaches the request it names
+	lines := make(chan []byte, stdioQueue)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		reader := bufio.NewReader(os.Stdin)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				readErr <- fmt.Errorf("read stdin: %w", err)
+				return
+			}
+			var req Request
+			if json.Unmarshal(line, &req) == nil && req.Method == "notifications/cancelled" {
+				s.HandleRequest(ctx, &req)
+				continue
+			}
+			lines <- line
 		}
+	}()
 
+	for line := range lines {
 		// Parse request
 		var req Request
 		if err := json.Unmarshal(line, &req); err != nil {
@@ -73,40 +203,52 @@ func (s *Server) ServeStdio() error {
 			continue
 		}
 
-		// Handle request (stdio has no cancellation, use background context)
-		resp := s.HandleRequest(context.Background(), &req)
+		resp := s.HandleRequest(ctx, &req)
 		if resp != nil {
 			if err := encoder.Encode(resp); err != nil {
 				log.Printf("Write error: %v", err)
 			}
 		}
 	}
+	select {
+	case err := <-readErr:
+		return err
+	default:
+		return nil
+	}
 }
 
 // HandleRequest processes a single MCP request and returns a response.
 // Returns nil for notifications (requests without an ID).
-// The context is used to cancel long-running operations (e.g., embedding API calls).
+// The context is used to cancel long-running operations (storage queries,
+// embedding API calls), as is a notifications/cancelled naming the request.
 func (s *Server) HandleRequest(ctx context.Context, req *Request) *Response {
 	log.Printf("Request: %s", req.Method)
 
 	// Notifications have no id and expect no response
 	if req.ID == nil || string(req.ID) == "null" {
-		s.handleNotification(req)
+		s.handleNotification(ctx, req)
 		return nil
 	}
+	ctx, done := s.inflight.track(ctx, req.ID)
+	defer done()
 
 	var result interface{}
 	var err *Error
 
 	switch req.Method {
 	case "initialize":
-		result = s.handleInitialize(req.Params)
+		result = s.handleInitialize(ctx, req.Params)
 	case "ping":
 		result = map[string]interface{}{}
 	case "tools/list":
-		result = s.handleToolsList()
+		result = s.handleToolsList(ctx)
 	case "tools/call":
 		result, err = s.handleToolsCall(ctx, req.Params)
+	case "resources/list":
+		result = s.handleResourcesList(ctx)
+	case "resources/read":
+		result, err = s.handleResourcesRead(ctx, req.Params)
 	default:
 		err = &Error{
 			Code:    CodeMethodNotFound,
@@ -122,26 +264,27 @@ func (s *Server) HandleRequest(ctx context.Context, req *Request) *Response {
 	}
 }
 
-func (s *Server) handleNotification(req *Request) {
+func (s *Server) handleNotification(ctx context.Context, req *Request) {
 	switch req.Method {
 	case "notifications/initialized":
 		log.Printf("Client initialized")
 	case "notifications/cancelled":
-		log.Printf("Request cancelled")
+		s.handleCancelled(ctx, req.Params)
 	default:
 		log.Printf("Unknown notification: %s", req.Method)
 	}
 }
 
-func (s *Server) handleInitialize(params json.RawMessage) *InitializeResult {
-	return &InitializeResult{
+func (s *Server) handleInitialize(ctx context.Context, params json.RawMessage) *InitializeResult {
+	result := &InitializeResult{
 		ProtocolVersion: mcpVersion,
 		Capabilities: Capabilities{
-			Tools: &ToolsCapability{},
+			Tools:     &ToolsCapability{},
+			Resources: &ResourcesCapability{},
 		},
 		ServerInfo: ServerInfo{
 			Name:        serverName,
-			Version:     serverVersion,
+			Version:     Version,
 			Title:       "MyKB",
 			Description: "Personal knowledge base with full-text search",
 		},
@@ -151,12 +294,45 @@ Use get_metadata_index() for a high-level overview of what's stored.
 Use get_metadata_values(key) to drill down into a specific metadata field.
 Use search_chunks(query) to find chunks by content or metadata.`,
 	}
+	result.Capabilities.Experimental = map[string]any{}
+	if limits := s.config.RateLimit; limits.Enabled() {
+		result.Capabilities.Experimental[rateLimitsCapability] = RateLimitConfig{ToolCallsPerMinute: limits.ToolCallsPerMinute, Burst: limits.burst()}
+		result.Instructions += limits.instructions()
+	}
+	health := s.EmbeddingHealth(ctx)
+	result.Capabilities.Experimental[semanticSearchCapability] = health
+	switch {
+	case !health.Configured:
+		result.Instructions += "\n\nsemantic_search is unavailable: no embedding provider is configured. Use search_chunks instead."
+	case !health.Available:
+		result.Instructions += "\n\nsemantic_search is currently unavailable: the embedding provider is not responding. Use search_chunks instead."
+	}
+	return result
 }
 
-func (s *Server) handleToolsList() *ToolsListResult {
-	return &ToolsListResult{
-		Tools: toolDefinitions,
+func (s *Server) handleToolsList(ctx context.Context) *ToolsListResult {
+	grant := grantFrom(ctx)
+	if !s.config.ReadOnly && (grant == nil || grant.Tools == nil) {
+		return &ToolsListResult{Tools: toolDefinitions}
+	}
+	var tools []Tool
+	for _, t := range toolDefinitions {
+		if (!s.config.ReadOnly || readOnlyTool(t.Name)) && grant.allows(t.Name) {
+			tools = append(tools, t)
+		}
 	}
+	return &ToolsListResult{Tools: tools}
+}
+
+// readOnlyTool reports whether the named tool is annotated as not
+// modifying the knowledge base.
+func readOnlyTool(name string) bool {
+	for _, t := range toolDefinitions {
+		if t.Name == name {
+			return t.Annotations != nil && t.Annotations.ReadOnlyHint
+		}
+	}
+	return false
 }
 
 func (s *Server) handleToolsCall(ctx context.Context, params json.RawMessage) (*CallToolResult, *Error) {
@@ -170,18 +346,60 @@ func (s *Server) handleToolsCall(ctx context.Context, params json.RawMessage) (*
 
 	handler, ok := s.tools[p.Name]
 	if !ok {
+		s.config.Events.Publish(events.Event{
+			Type:    events.Error,
+			Message: fmt.Sprintf("unknown tool: %s", p.Name),
+			Fields:  map[string]any{"tool": p.Name},
+		})
 		return nil, &Error{
 			Code:    CodeInvalidParams,
 			Message: fmt.Sprintf("Unknown tool: %s", p.Name),
 		}
 	}
 
+	if s.config.ReadOnly && !readOnlyTool(p.Name) {
+		err := fmt.Errorf("%s is not available: this server is a read-only mirror", p.Name)
+		s.publishToolCall(p.Name, 0, err)
+		return &CallToolResult{
+			Content: []Content{TextContent(err.Error())},
+			IsError: true,
+		}, nil
+	}
+
+	if !grantFrom(ctx).allows(p.Name) {
+		err := fmt.Errorf("%s is not available to this token", p.Name)
+		s.publishToolCall(p.Name, 0, err)
+		return &CallToolResult{
+			Content: []Content{TextContent(err.Error())},
+			IsError: true,
+		}, nil
+	}
+
+	if wait := s.rateLimitWait(); wait > 0 {
+		s.config.Events.Publish(events.Event{
+			Type:    events.Error,
+			Message: fmt.Sprintf("rate limited: %s", p.Name),
+			Fields:  map[string]any{"tool": p.Name, "retry_after_ms": wait.Milliseconds()},
+		})
+		return nil, s.rateLimitError(wait)
+	}
+
+	start := time.Now()
 	result, err := handler(ctx, p.Arguments)
+	elapsed := time.Since(start)
+	s.publishToolCall(p.Name, elapsed, err)
+	res := toolResult(result, err)
+	s.recordToolCall(ctx, p, res, elapsed)
+	return res, nil
+}
+
+// toolResult wraps a handler's result, or its error, as a tool response.
+func toolResult(result any, err error) *CallToolResult {
 	if err != nil {
 		return &CallToolResult{
 			Content: []Content{TextContent(err.Error())},
 			IsError: true,
-		}, nil
+		}
 	}
 
 	// Convert result to JSON text
@@ -190,11 +408,38 @@ func (s *Server) handleToolsCall(ctx context.Context, params json.RawMessage) (*
 		return &CallToolResult{
 			Content: []Content{TextContent(fmt.Sprintf("Marshal error: %v", err))},
 			IsError: true,
-		}, nil
+		}
 	}
 
 	return &CallToolResult{
 		Content:           []Content{TextContent(string(data))},
 		StructuredContent: result,
-	}, nil
+	}
+}
+
+// publishToolCall records a finished tool call on the event bus.
+func (s *Server) publishToolCall(name string, elapsed time.Duration, err error) {
+	e := events.Event{
+		Type:    events.ToolCall,
+		Message: name,
+		Fields:  map[string]any{"tool": name, "duration_ms": elapsed.Milliseconds()},
+	}
+	if err != nil {
+		e.Type = events.Error
+		e.Fields["error"] = err.Error()
+	}
+	s.config.Events.Publish(e)
+}
+
+// publishChunk records a chunk change on the event bus. chunk is nil for
+// deletions.
+func (s *Server) publishChunk(ctx context.Context, t events.Type, id string, chunk *storage.Chunk) {
+	e := events.Event{Type: t, Message: id, Fields: map[string]any{"id": id}}
+	if client := clientFrom(ctx); client != "" {
+		e.Fields["client"] = client
+	}
+	if chunk != nil {
+		e.Data = chunk
+	}
+	s.config.Events.Publish(e)
 }
@@ -4,13 +4,23 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/neoden/mykb/bookmarks"
+	"github.com/neoden/mykb/embedding"
+	"github.com/neoden/mykb/events"
+	"github.com/neoden/mykb/ingest"
+	"github.com/neoden/mykb/review"
 	"github.com/neoden/mykb/storage"
 	"github.com/neoden/mykb/vector"
 )
@@ -117,6 +127,9 @@ func TestInitialize(t *testing.T) {
 	if init.Capabilities.Tools == nil {
 		t.Error("Expected tools capability")
 	}
+	if init.Capabilities.Resources == nil {
+		t.Error("Expected resources capability")
+	}
 }
 
 func TestToolsList(t *testing.T) {
@@ -129,8 +142,8 @@ func TestToolsList(t *testing.T) {
 		t.Fatalf("Unmarshal: %v", err)
 	}
 
-	if len(list.Tools) != 8 {
-		t.Errorf("len(tools) = %d, want 8", len(list.Tools))
+	if len(list.Tools) != 25 {
+		t.Errorf("len(tools) = %d, want 25", len(list.Tools))
 	}
 
 	// Check tool names
@@ -142,8 +155,11 @@ func TestToolsList(t *testing.T) {
 	expected := []string{
 		"store_chunk", "search_chunks", "get_chunk",
 		"update_chunk", "delete_chunk",
-		"get_metadata_index", "get_metadata_values",
-		"semantic_search",
+		"get_metadata_index", "get_metadata_values", "count_chunks", "sample_chunks", "get_review_queue", "get_usage_report", "get_stats",
+		"semantic_search", "most_central_chunks", "get_session_chunks",
+		"ingest_document",
+		"store_source", "list_sources", "get_chunks_by_source", "delete_source",
+		"create_child_token",
 	}
 	for _, name := range expected {
 		if !names[name] {
@@ -385,6 +401,45 @@ func TestToolsCallGetMetadataIndex(t *testing.T) {
 	}
 }
 
+func TestToolsCallGetStats(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	db, err := storage.Open(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	db.Migrate()
+	t.Cleanup(func() { db.Close() })
+	s := NewServer(db, &mockEmbedder{}, vector.NewIndex())
+
+	call(t, s, "tools/call", map[string]interface{}{
+		"name":      "store_chunk",
+		"arguments": map[string]interface{}{"content": "Test", "metadata": map[string]interface{}{"type": "note"}},
+	})
+	db.CreateChunk(ctx, "Not embedded", nil)
+
+	result := call(t, s, "tools/call", map[string]interface{}{
+		"name":      "get_stats",
+		"arguments": map[string]interface{}{},
+	})
+	var callResult CallToolResult
+	json.Unmarshal(result, &callResult)
+	if callResult.IsError {
+		t.Fatalf("get_stats failed: %v", callResult.Content)
+	}
+	data, _ := json.Marshal(callResult.StructuredContent)
+	var stats struct {
+		Chunks       int            `json:"chunks"`
+		MetadataKeys map[string]int `json:"metadata_keys"`
+		Model        string         `json:"model"`
+		Coverage     float64        `json:"coverage"`
+	}
+	json.Unmarshal(data, &stats)
+	if stats.Chunks != 2 || stats.MetadataKeys["type"] != 1 || stats.Model != "mock/test" || stats.Coverage != 0.5 {
+		t.Errorf("stats = %s", data)
+	}
+}
+
 func TestToolsCallUnknownTool(t *testing.T) {
 	s := setupTestServer(t)
 
@@ -591,6 +646,349 @@ func TestSemanticSearchWithMockEmbedder(t *testing.T) {
 	}
 }
 
+func TestSemanticSearchMetadataFilter(t *testing.T) {
+	db, err := storage.Init(t.TempDir())
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	s := NewServer(db, &mockEmbedder{embedding: []float32{0.1, 0.2, 0.3}}, vector.NewIndex())
+
+	for _, args := range []map[string]any{
+		{"content": "go note", "metadata": map[string]any{"tags": []string{"go", "tools"}, "year": 2024}},
+		{"content": "rust note", "metadata": map[string]any{"tags": []string{"rust"}, "year": 2024}},
+		{"content": "untagged note"},
+	} {
+		call(t, s, "tools/call", map[string]any{"name": "store_chunk", "arguments": args})
+	}
+
+	search := func(filter map[string]any) []string {
+		result := call(t, s, "tools/call", map[string]any{
+			"name":      "semantic_search",
+			"arguments": map[string]any{"query": "note", "metadata": filter},
+		})
+		var callResult CallToolResult
+		json.Unmarshal(result, &callResult)
+		data, _ := json.Marshal(callResult.StructuredContent)
+		var res struct {
+			Results []struct {
+				Content string `json:"content"`
+			} `json:"results"`
+		}
+		json.Unmarshal(data, &res)
+		var contents []string
+		for _, r := range res.Results {
+			contents = append(contents, r.Content)
+		}
+		return contents
+	}
+
+	if got := search(map[string]any{"tags": "go"}); len(got) != 1 || got[0] != "go note" {
+		t.Errorf("tags=go: %v", got)
+	}
+	if got := search(map[string]any{"year": 2024}); len(got) != 2 {
+		t.Errorf("year=2024: %v", got)
+	}
+	if got := search(map[string]any{"year": 2024, "tags": "python"}); len(got) != 0 {
+		t.Errorf("year=2024 tags=python: %v", got)
+	}
+	if got := search(nil); len(got) != 3 {
+		t.Errorf("unfiltered: %v", got)
+	}
+}
+
+func TestSemanticSearchMinScore(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Init(t.TempDir())
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	idx := vector.NewIndex()
+	s := NewServer(db, &mockEmbedder{embedding: []float32{0.1, 0.2, 0.3}}, idx)
+
+	call(t, s, "tools/call", map[string]any{"name": "store_chunk", "arguments": map[string]any{"content": "match"}})
+	other, _ := db.CreateChunk(ctx, "opposite", nil)
+	idx.Add(other.ID, []float32{-0.1, -0.2, -0.3})
+
+	search := func(minScore float64) CallToolResult {
+		result := call(t, s, "tools/call", map[string]any{
+			"name":      "semantic_search",
+			"arguments": map[string]any{"query": "q", "min_score": minScore},
+		})
+		var callResult CallToolResult
+		json.Unmarshal(result, &callResult)
+		return callResult
+	}
+	scores := func(r CallToolResult) []float32 {
+		data, _ := json.Marshal(r.StructuredContent)
+		var res struct {
+			Results []struct {
+				Score float32 `json:"score"`
+			} `json:"results"`
+		}
+		json.Unmarshal(data, &res)
+		var out []float32
+		for _, r := range res.Results {
+			out = append(out, r.Score)
+		}
+		return out
+	}
+
+	if got := scores(search(0)); len(got) != 2 || got[0] < 0.999 || got[1] > 0.001 {
+		t.Errorf("scores = %v, want 1 and 0", got)
+	}
+	if got := scores(search(0.5)); len(got) != 1 {
+		t.Errorf("min_score 0.5: scores = %v, want one", got)
+	}
+	if r := search(1.5); !r.IsError {
+		t.Error("min_score 1.5 accepted")
+	}
+}
+
+func TestSemanticSearchMMR(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Init(t.TempDir())
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	idx := vector.NewIndex()
+	s := NewServer(db, &mockEmbedder{embedding: []float32{0.1, 0.2, 0.3}}, idx)
+
+	vecs := map[string][]float32{
+		"dup one":   {0.2, 0.2, 0.3},
+		"dup two":   {0.2, 0.2, 0.31},
+		"dup three": {0.2, 0.21, 0.3},
+		"different": {0, 0.2, 0.3},
+	}
+	for content, vec := range vecs {
+		c, _ := db.CreateChunk(ctx, content, nil)
+		idx.Add(c.ID, vec)
+	}
+
+	search := func(args map[string]any) []string {
+		args["query"] = "q"
+		args["limit"] = 2
+		result := call(t, s, "tools/call", map[string]any{"name": "semantic_search", "arguments": args})
+		var callResult CallToolResult
+		json.Unmarshal(result, &callResult)
+		data, _ := json.Marshal(callResult.StructuredContent)
+		var res struct {
+			Results []struct {
+				Content string `json:"content"`
+			} `json:"results"`
+		}
+		json.Unmarshal(data, &res)
+		var contents []string
+		for _, r := range res.Results {
+			contents = append(contents, r.Content)
+		}
+		return contents
+	}
+
+	if got := search(map[string]any{}); slices.Contains(got, "different") {
+		t.Errorf("plain search = %v, want only duplicates", got)
+	}
+	if got := search(map[string]any{"mmr_lambda": 0.5}); len(got) != 2 || got[1] != "different" {
+		t.Errorf("mmr_lambda 0.5 = %v, want a duplicate then different", got)
+	}
+	if got := search(map[string]any{"mmr_lambda": 2}); got != nil {
+		t.Errorf("mmr_lambda 2 = %v, want an error", got)
+	}
+}
+
+func TestSimilarChunks(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Init(t.TempDir())
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	idx := vector.NewIndex()
+	// No embedder: the stored vector is the query
+	s := NewServer(db, nil, idx)
+
+	source, _ := db.CreateChunk(ctx, "source", nil)
+	near, _ := db.CreateChunk(ctx, "near", nil)
+	far, _ := db.CreateChunk(ctx, "far", nil)
+	plain, _ := db.CreateChunk(ctx, "not embedded", nil)
+	idx.Add(source.ID, []float32{1, 0, 0})
+	idx.Add(near.ID, []float32{0.9, 0.1, 0})
+	idx.Add(far.ID, []float32{0, 1, 0})
+
+	similar := func(args map[string]any) (CallToolResult, map[string]any) {
+		result := call(t, s, "tools/call", map[string]any{"name": "similar_chunks", "arguments": args})
+		var callResult CallToolResult
+		json.Unmarshal(result, &callResult)
+		data, _ := json.Marshal(callResult.StructuredContent)
+		var out map[string]any
+		json.Unmarshal(data, &out)
+		return callResult, out
+	}
+
+	_, out := similar(map[string]any{"chunk_id": source.ID, "min_score": 0.6})
+	results, _ := out["results"].([]any)
+	if len(results) != 1 || results[0].(map[string]any)["id"] != near.ID {
+		t.Errorf("results = %v, want only the near chunk", out["results"])
+	}
+	if _, out := similar(map[string]any{"chunk_id": "missing"}); out["found"] != false {
+		t.Errorf("missing chunk = %v, want found false", out)
+	}
+	if res, _ := similar(map[string]any{"chunk_id": plain.ID}); !res.IsError {
+		t.Error("expected error for a chunk without embedding")
+	}
+}
+
+func TestCountChunks(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Init(t.TempDir())
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	s := NewServer(db, nil, vector.NewIndex())
+
+	march := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	april := time.Date(2026, 4, 2, 9, 0, 0, 0, time.UTC)
+	db.PutChunk(ctx, &storage.Chunk{ID: "m1", Content: "standup notes", Metadata: json.RawMessage(`{"type":"meeting","team":"infra"}`), CreatedAt: march, UpdatedAt: march})
+	db.PutChunk(ctx, &storage.Chunk{ID: "m2", Content: "planning notes", Metadata: json.RawMessage(`{"type":"meeting","team":"web"}`), CreatedAt: march, UpdatedAt: march})
+	db.PutChunk(ctx, &storage.Chunk{ID: "m3", Content: "retro notes", Metadata: json.RawMessage(`{"type":"meeting","team":"infra"}`), CreatedAt: april, UpdatedAt: april})
+	db.PutChunk(ctx, &storage.Chunk{ID: "r1", Content: "pancake recipe", Metadata: json.RawMessage(`{"type":"recipe"}`), CreatedAt: march, UpdatedAt: march})
+
+	tool := func(name string, args map[string]any) (CallToolResult, map[string]any) {
+		result := call(t, s, "tools/call", map[string]any{"name": name, "arguments": args})
+		var callResult CallToolResult
+		json.Unmarshal(result, &callResult)
+		data, _ := json.Marshal(callResult.StructuredContent)
+		var out map[string]any
+		json.Unmarshal(data, &out)
+		return callResult, out
+	}
+
+	if _, out := tool("count_chunks", map[string]any{}); out["count"] != 4.0 {
+		t.Errorf("count all = %v, want 4", out["count"])
+	}
+	_, out := tool("count_chunks", map[string]any{
+		"metadata":       map[string]any{"type": "meeting"},
+		"created_after":  "2026-03-01",
+		"created_before": "2026-04-01",
+		"facet":          "team",
+	})
+	if out["count"] != 2.0 {
+		t.Errorf("March meetings = %v, want 2", out["count"])
+	}
+	facet, _ := out["facet"].(map[string]any)
+	if values, _ := facet["values"].(map[string]any); values["infra"] != 1.0 || values["web"] != 1.0 {
+		t.Errorf("facet = %v, want infra 1, web 1", out["facet"])
+	}
+	if res, _ := tool("count_chunks", map[string]any{"created_after": "March"}); !res.IsError {
+		t.Error("expected error for an unparseable date")
+	}
+
+	// Facets of search results
+	_, out = tool("search_chunks", map[string]any{"query": "notes", "facet": "team"})
+	facet, _ = out["facet"].(map[string]any)
+	if values, _ := facet["values"].(map[string]any); out["count"] != 3.0 || values["infra"] != 2.0 || values["web"] != 1.0 {
+		t.Errorf("search_chunks facet = %v, want infra 2, web 1", out["facet"])
+	}
+}
+
+func TestSampleChunks(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Init(t.TempDir())
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	s := NewServer(db, nil, vector.NewIndex())
+
+	old := time.Now().AddDate(-10, 0, 0)
+	db.PutChunk(ctx, &storage.Chunk{ID: "old", Content: "old card", Metadata: json.RawMessage(`{"deck":"go"}`), CreatedAt: old, UpdatedAt: old})
+	db.CreateChunk(ctx, "fresh card", json.RawMessage(`{"deck":"go"}`))
+	db.CreateChunk(ctx, "recipe", json.RawMessage(`{"deck":"food"}`))
+
+	sampleContents := func(args map[string]any) []string {
+		t.Helper()
+		result := call(t, s, "tools/call", map[string]any{"name": "sample_chunks", "arguments": args})
+		var callResult CallToolResult
+		json.Unmarshal(result, &callResult)
+		data, _ := json.Marshal(callResult.StructuredContent)
+		var out struct {
+			Results []struct {
+				Content string `json:"content"`
+			} `json:"results"`
+		}
+		json.Unmarshal(data, &out)
+		var contents []string
+		for _, r := range out.Results {
+			contents = append(contents, r.Content)
+		}
+		return contents
+	}
+
+	if got := sampleContents(map[string]any{"n": 10}); len(got) != 3 {
+		t.Errorf("sample of 10 = %v, want all 3 chunks", got)
+	}
+	if got := sampleContents(map[string]any{"n": 2}); len(got) != 2 || got[0] == got[1] {
+		t.Errorf("sample of 2 = %v, want 2 distinct chunks", got)
+	}
+	for range 20 {
+		got := sampleContents(map[string]any{"n": 1, "metadata": map[string]any{"deck": "go"}, "weight_recent": true})
+		if len(got) != 1 || got[0] != "fresh card" {
+			t.Fatalf("recency-weighted sample = %v, want the fresh card", got)
+		}
+	}
+}
+
+func TestGetReviewQueue(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Init(t.TempDir())
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	config := DefaultConfig()
+	config.Review = review.Config{NeverAccessed: true, DueKey: "review_due"}
+	s := NewServerWithConfig(db, nil, vector.NewIndex(), config)
+
+	unread, _ := db.CreateChunk(ctx, "unread", nil)
+	due, _ := db.CreateChunk(ctx, "card", json.RawMessage(`{"review_due":"2020-01-01"}`))
+
+	queue := func() []string {
+		t.Helper()
+		result := call(t, s, "tools/call", map[string]any{"name": "get_review_queue", "arguments": map[string]any{}})
+		var callResult CallToolResult
+		json.Unmarshal(result, &callResult)
+		data, _ := json.Marshal(callResult.StructuredContent)
+		var out struct {
+			Items []review.Item `json:"items"`
+		}
+		json.Unmarshal(data, &out)
+		var ids []string
+		for _, it := range out.Items {
+			ids = append(ids, it.ID)
+		}
+		return ids
+	}
+	if got := queue(); len(got) != 2 || got[0] != due.ID || got[1] != unread.ID {
+		t.Errorf("queue = %v, want the due card, then the unread chunk", got)
+	}
+	// Reading a chunk takes it off the queue
+	call(t, s, "tools/call", map[string]any{"name": "get_chunk", "arguments": map[string]any{"chunk_id": unread.ID}})
+	if got := queue(); len(got) != 1 || got[0] != due.ID {
+		t.Errorf("queue after get_chunk = %v, want only the due card", got)
+	}
+
+	unset := NewServer(db, nil, vector.NewIndex())
+	result := call(t, unset, "tools/call", map[string]any{"name": "get_review_queue", "arguments": map[string]any{}})
+	var callResult CallToolResult
+	json.Unmarshal(result, &callResult)
+	if !callResult.IsError {
+		t.Error("expected error without a review policy")
+	}
+}
+
 // mockEmbedder returns fixed embeddings for testing
 type mockEmbedder struct {
 	embedding []float32
@@ -709,6 +1107,7 @@ func TestDeleteChunkRemovesFromIndex(t *testing.T) {
 }
 
 func TestStoreChunkFailsWithFailingEmbedder(t *testing.T) {
+	ctx := context.Background()
 	dir := t.TempDir()
 	db, _ := storage.Open(filepath.Join(dir, "test.db"))
 	db.Migrate()
@@ -735,7 +1134,7 @@ func TestStoreChunkFailsWithFailingEmbedder(t *testing.T) {
 	}
 
 	// Chunk should NOT be created (transaction rolled back)
-	chunks, _ := db.GetAllChunks()
+	chunks, _ := db.GetAllChunks(ctx)
 	if len(chunks) != 0 {
 		t.Errorf("No chunks should exist after failed store, got %d", len(chunks))
 	}
@@ -747,6 +1146,7 @@ func TestStoreChunkFailsWithFailingEmbedder(t *testing.T) {
 }
 
 func TestUpdateChunkFailsWithFailingEmbedder(t *testing.T) {
+	ctx := context.Background()
 	dir := t.TempDir()
 	db, _ := storage.Open(filepath.Join(dir, "test.db"))
 	db.Migrate()
@@ -789,7 +1189,7 @@ func TestUpdateChunkFailsWithFailingEmbedder(t *testing.T) {
 	}
 
 	// Content should NOT be updated (transaction rolled back)
-	dbChunk, _ := db.GetChunk(chunk.ID)
+	dbChunk, _ := db.GetChunk(ctx, chunk.ID)
 	if dbChunk.Content != "original" {
 		t.Errorf("Content = %q, want %q (should not be updated)", dbChunk.Content, "original")
 	}
@@ -844,3 +1244,1584 @@ func TestServeStdio(t *testing.T) {
 		t.Errorf("Expected JSON-RPC response, got: %s", buf.String())
 	}
 }
+
+func TestGetChunkEmbeddingStatus(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	db, _ := storage.Open(filepath.Join(dir, "test.db"))
+	db.Migrate()
+	t.Cleanup(func() { db.Close() })
+
+	s := NewServer(db, &mockEmbedder{embedding: []float32{0.1, 0.2, 0.3}}, vector.NewIndex())
+
+	fresh, _ := s.toolStoreChunk(context.Background(), json.RawMessage(`{"content":"embedded"}`))
+	missing, _ := db.CreateChunk(ctx, "not embedded", nil)
+
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{fresh.(*storage.Chunk).ID, storage.EmbeddingFresh},
+		{missing.ID, storage.EmbeddingMissing},
+	}
+	for _, tt := range tests {
+		result := call(t, s, "tools/call", map[string]interface{}{
+			"name":      "get_chunk",
+			"arguments": map[string]interface{}{"chunk_id": tt.id},
+		})
+		var callResult CallToolResult
+		json.Unmarshal(result, &callResult)
+		data, _ := json.Marshal(callResult.StructuredContent)
+		var got map[string]any
+		json.Unmarshal(data, &got)
+
+		if got["embedding_status"] != tt.want {
+			t.Errorf("embedding_status = %v, want %q", got["embedding_status"], tt.want)
+		}
+		if got["content"] == nil {
+			t.Error("Expected chunk fields alongside embedding_status")
+		}
+	}
+}
+
+// recordingEmbedder records the texts it is asked to embed.
+type recordingEmbedder struct {
+	mockEmbedder
+	texts []string
+}
+
+func (m *recordingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	m.texts = append(m.texts, texts...)
+	return m.mockEmbedder.Embed(ctx, texts)
+}
+
+func TestUpdateChunkReEmbedsMetadata(t *testing.T) {
+	dir := t.TempDir()
+	db, _ := storage.Open(filepath.Join(dir, "test.db"))
+	db.Migrate()
+	t.Cleanup(func() { db.Close() })
+
+	embedder := &recordingEmbedder{mockEmbedder: mockEmbedder{embedding: []float32{0.1, 0.2, 0.3}}}
+	cfg := DefaultConfig()
+	cfg.MetadataFields = []string{"title"}
+	cfg.ReembedOnMetadata = true
+	s := NewServerWithConfig(db, embedder, vector.NewIndex(), cfg)
+
+	storeResult := call(t, s, "tools/call", map[string]interface{}{
+		"name": "store_chunk",
+		"arguments": map[string]interface{}{
+			"content":  "body",
+			"metadata": map[string]interface{}{"title": "Old", "tags": []string{"a"}},
+		},
+	})
+
+	var stored CallToolResult
+	json.Unmarshal(storeResult, &stored)
+	data, _ := json.Marshal(stored.StructuredContent)
+	var chunk storage.Chunk
+	json.Unmarshal(data, &chunk)
+
+	if len(embedder.texts) != 1 || embedder.texts[0] != "title: Old\n\nbody" {
+		t.Fatalf("store embedded %q", embedder.texts)
+	}
+
+	// Changing a field that is not embedded does not re-embed
+	call(t, s, "tools/call", map[string]interface{}{
+		"name": "update_chunk",
+		"arguments": map[string]interface{}{
+			"chunk_id": chunk.ID,
+			"metadata": map[string]interface{}{"title": "Old", "tags": []string{"b"}},
+		},
+	})
+	if len(embedder.texts) != 1 {
+		t.Fatalf("unrelated metadata change re-embedded: %q", embedder.texts)
+	}
+
+	// Changing an embedded field does
+	call(t, s, "tools/call", map[string]interface{}{
+		"name": "update_chunk",
+		"arguments": map[string]interface{}{
+			"chunk_id": chunk.ID,
+			"metadata": map[string]interface{}{"title": "New"},
+		},
+	})
+	if len(embedder.texts) != 2 || embedder.texts[1] != "title: New\n\nbody" {
+		t.Fatalf("metadata change embedded %q", embedder.texts)
+	}
+
+	// Without the option, metadata-only updates never re-embed
+	cfg.ReembedOnMetadata = false
+	call(t, s, "tools/call", map[string]interface{}{
+		"name": "update_chunk",
+		"arguments": map[string]interface{}{
+			"chunk_id": chunk.ID,
+			"metadata": map[string]interface{}{"title": "Newer"},
+		},
+	})
+	if len(embedder.texts) != 2 {
+		t.Errorf("re-embedded with option disabled: %q", embedder.texts)
+	}
+}
+
+func TestToolCallEvents(t *testing.T) {
+	dir := t.TempDir()
+	db, _ := storage.Open(filepath.Join(dir, "test.db"))
+	db.Migrate()
+	t.Cleanup(func() { db.Close() })
+
+	cfg := DefaultConfig()
+	cfg.Events = events.NewBus()
+	s := NewServerWithConfig(db, nil, vector.NewIndex(), cfg)
+	ch, cancel := cfg.Events.Subscribe()
+	defer cancel()
+
+	call(t, s, "tools/call", map[string]interface{}{
+		"name":      "store_chunk",
+		"arguments": map[string]interface{}{"content": "hello"},
+	})
+	if e := <-ch; e.Type != events.ChunkCreated {
+		t.Errorf("event = %+v, want chunk_created first", e)
+	}
+	e := <-ch
+	if e.Type != events.ToolCall || e.Fields["tool"] != "store_chunk" {
+		t.Errorf("event = %+v", e)
+	}
+
+	call(t, s, "tools/call", map[string]interface{}{
+		"name":      "get_chunk",
+		"arguments": map[string]interface{}{"id": "missing"},
+	})
+	e = <-ch
+	if e.Type != events.Error || e.Fields["error"] == nil {
+		t.Errorf("event = %+v", e)
+	}
+}
+
+func TestChunkEvents(t *testing.T) {
+	dir := t.TempDir()
+	db, _ := storage.Open(filepath.Join(dir, "test.db"))
+	db.Migrate()
+	t.Cleanup(func() { db.Close() })
+
+	cfg := DefaultConfig()
+	cfg.Events = events.NewBus()
+	s := NewServerWithConfig(db, nil, vector.NewIndex(), cfg)
+	ch, cancel := cfg.Events.Subscribe()
+	defer cancel()
+
+	// next returns the next chunk event, skipping tool call records
+	next := func() events.Event {
+		t.Helper()
+		for e := range ch {
+			if e.Type.IsChunk() {
+				return e
+			}
+		}
+		t.Fatal("bus closed")
+		return events.Event{}
+	}
+
+	ctx := WithClient(context.Background(), "laptop")
+	chunk, _, err := s.StoreChunk(ctx, "hello", nil)
+	if err != nil {
+		t.Fatalf("StoreChunk: %v", err)
+	}
+	e := next()
+	if e.Type != events.ChunkCreated || e.Fields["id"] != chunk.ID || e.Fields["client"] != "laptop" {
+		t.Errorf("event = %+v", e)
+	}
+	if c, ok := e.Data.(*storage.Chunk); !ok || c.Content != "hello" {
+		t.Errorf("data = %#v, want the stored chunk", e.Data)
+	}
+
+	call(t, s, "tools/call", map[string]interface{}{
+		"name":      "update_chunk",
+		"arguments": map[string]interface{}{"chunk_id": chunk.ID, "content": "hello again"},
+	})
+	e = next()
+	if c, ok := e.Data.(*storage.Chunk); e.Type != events.ChunkUpdated || !ok || c.Content != "hello again" {
+		t.Errorf("event = %+v", e)
+	}
+
+	call(t, s, "tools/call", map[string]interface{}{
+		"name":      "delete_chunk",
+		"arguments": map[string]interface{}{"chunk_id": chunk.ID},
+	})
+	e = next()
+	if e.Type != events.ChunkDeleted || e.Fields["id"] != chunk.ID || e.Data != nil {
+		t.Errorf("event = %+v", e)
+	}
+
+	// Deleting a missing chunk changes nothing
+	call(t, s, "tools/call", map[string]interface{}{
+		"name":      "delete_chunk",
+		"arguments": map[string]interface{}{"chunk_id": chunk.ID},
+	})
+	s.DeleteChunks(ctx, []string{"missing"})
+	for len(ch) > 0 {
+		if e := <-ch; e.Type.IsChunk() {
+			t.Errorf("unexpected event %+v", e)
+		}
+	}
+}
+
+// slowEmbedder blocks until the context is done
+type slowEmbedder struct{}
+
+func (e *slowEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (e *slowEmbedder) Dimensions() int { return 3 }
+func (e *slowEmbedder) Model() string   { return "mock/slow" }
+
+// writingEmbedder writes to the database while it embeds, as another
+// client would meanwhile.
+type writingEmbedder struct {
+	mockEmbedder
+	db   *storage.DB
+	errs []error
+}
+
+func (e *writingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	wctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	e.errs = append(e.errs, e.db.SetSetting(wctx, "concurrent", "write"))
+	return e.mockEmbedder.Embed(ctx, texts)
+}
+
+func TestEmbeddingOutsideWriteTransaction(t *testing.T) {
+	dir := t.TempDir()
+	db, _ := storage.Open(filepath.Join(dir, "test.db"))
+	db.Migrate()
+	t.Cleanup(func() { db.Close() })
+	embedder := &writingEmbedder{mockEmbedder: mockEmbedder{embedding: []float32{1, 0, 0}}, db: db}
+	s := NewServer(db, embedder, vector.NewIndex())
+
+	var stored struct {
+		ID string `json:"id"`
+	}
+	var callResult CallToolResult
+	json.Unmarshal(call(t, s, "tools/call", map[string]interface{}{
+		"name":      "store_chunk",
+		"arguments": map[string]interface{}{"content": "first"},
+	}), &callResult)
+	if callResult.IsError {
+		t.Fatalf("store_chunk failed: %s", callResult.Content[0].Text)
+	}
+	json.Unmarshal([]byte(callResult.Content[0].Text), &stored)
+	callResult = CallToolResult{}
+	json.Unmarshal(call(t, s, "tools/call", map[string]interface{}{
+		"name":      "update_chunk",
+		"arguments": map[string]interface{}{"chunk_id": stored.ID, "content": "second"},
+	}), &callResult)
+	if callResult.IsError {
+		t.Fatalf("update_chunk failed: %s", callResult.Content[0].Text)
+	}
+
+	// Other writers are not kept waiting on the provider
+	if len(embedder.errs) != 2 {
+		t.Fatalf("embeds = %d, want 2", len(embedder.errs))
+	}
+	for _, err := range embedder.errs {
+		if err != nil {
+			t.Errorf("write while embedding: %v", err)
+		}
+	}
+}
+
+func TestSemanticSearchTimeout(t *testing.T) {
+	dir := t.TempDir()
+	db, _ := storage.Open(filepath.Join(dir, "test.db"))
+	db.Migrate()
+	t.Cleanup(func() { db.Close() })
+
+	cfg := DefaultConfig()
+	cfg.QueryTimeout = 20 * time.Millisecond
+	s := NewServerWithConfig(db, &slowEmbedder{}, vector.NewIndex(), cfg)
+
+	start := time.Now()
+	result := call(t, s, "tools/call", map[string]interface{}{
+		"name":      "semantic_search",
+		"arguments": map[string]interface{}{"query": "anything"},
+	})
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("semantic_search took %s", elapsed)
+	}
+
+	var callResult CallToolResult
+	json.Unmarshal(result, &callResult)
+	if !callResult.IsError || !strings.Contains(callResult.Content[0].Text, "did not respond within 20ms") {
+		t.Errorf("result = %+v", callResult)
+	}
+}
+
+func TestStoreChunkDefersOnTimeout(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	db, _ := storage.Open(filepath.Join(dir, "test.db"))
+	db.Migrate()
+	t.Cleanup(func() { db.Close() })
+
+	cfg := DefaultConfig()
+	cfg.IngestTimeout = 20 * time.Millisecond
+	s := NewServerWithConfig(db, &slowEmbedder{}, vector.NewIndex(), cfg)
+
+	store := map[string]interface{}{
+		"name":      "store_chunk",
+		"arguments": map[string]interface{}{"content": "slow provider"},
+	}
+
+	// Without deferral the store fails and nothing is kept
+	var callResult CallToolResult
+	json.Unmarshal(call(t, s, "tools/call", store), &callResult)
+	if !callResult.IsError {
+		t.Error("store_chunk should fail on timeout without defer_on_timeout")
+	}
+
+	cfg.DeferOnTimeout = true
+	callResult = CallToolResult{}
+	json.Unmarshal(call(t, s, "tools/call", store), &callResult)
+	if callResult.IsError {
+		t.Fatalf("store_chunk failed: %s", callResult.Content[0].Text)
+	}
+	var stored struct {
+		ID                string `json:"id"`
+		EmbeddingDeferred bool   `json:"embedding_deferred"`
+	}
+	json.Unmarshal([]byte(callResult.Content[0].Text), &stored)
+	if stored.ID == "" || !stored.EmbeddingDeferred {
+		t.Errorf("stored = %+v", stored)
+	}
+
+	pending, _ := db.GetChunksWithoutEmbeddings(ctx, "mock/slow")
+	if len(pending) != 1 {
+		t.Errorf("chunks without embeddings = %d, want 1", len(pending))
+	}
+}
+
+// rateLimitedEmbedder fails as a provider still rate limiting after its
+// retries.
+type rateLimitedEmbedder struct{ failingEmbedder }
+
+func (r *rateLimitedEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return nil, fmt.Errorf("do request: %w", &embedding.RateLimitedError{RetryAfter: time.Minute})
+}
+
+func TestStoreChunkDefersWhenRateLimited(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	db, _ := storage.Open(filepath.Join(dir, "test.db"))
+	db.Migrate()
+	t.Cleanup(func() { db.Close() })
+
+	cfg := DefaultConfig()
+	cfg.DeferOnTimeout = true
+	s := NewServerWithConfig(db, &rateLimitedEmbedder{}, vector.NewIndex(), cfg)
+
+	var callResult CallToolResult
+	json.Unmarshal(call(t, s, "tools/call", map[string]interface{}{
+		"name":      "store_chunk",
+		"arguments": map[string]interface{}{"content": "busy provider"},
+	}), &callResult)
+	if callResult.IsError {
+		t.Fatalf("store_chunk failed: %s", callResult.Content[0].Text)
+	}
+	var stored struct {
+		EmbeddingDeferred bool `json:"embedding_deferred"`
+	}
+	json.Unmarshal([]byte(callResult.Content[0].Text), &stored)
+	if !stored.EmbeddingDeferred {
+		t.Error("embedding should be deferred")
+	}
+	if pending, _ := db.GetChunksWithoutEmbeddings(ctx, "mock/failing"); len(pending) != 1 {
+		t.Errorf("chunks without embeddings = %d, want 1", len(pending))
+	}
+	if n, _ := db.EmbeddingQueueLen(ctx); n != 1 {
+		t.Errorf("EmbeddingQueueLen = %d, want 1", n)
+	}
+}
+
+func TestToolCallRateLimit(t *testing.T) {
+	dir := t.TempDir()
+	db, _ := storage.Open(filepath.Join(dir, "test.db"))
+	db.Migrate()
+	t.Cleanup(func() { db.Close() })
+
+	cfg := DefaultConfig()
+	cfg.RateLimit = RateLimitConfig{ToolCallsPerMinute: 6, Burst: 2}
+	s := NewServerWithConfig(db, nil, vector.NewIndex(), cfg)
+
+	var init InitializeResult
+	json.Unmarshal(call(t, s, "initialize", map[string]interface{}{}), &init)
+	limits, ok := init.Capabilities.Experimental[rateLimitsCapability].(map[string]any)
+	if !ok || limits["toolCallsPerMinute"] != float64(6) || limits["burst"] != float64(2) {
+		t.Errorf("experimental capabilities = %v", init.Capabilities.Experimental)
+	}
+	if !strings.Contains(init.Instructions, "retryAfterMs") {
+		t.Error("instructions do not mention backoff")
+	}
+
+	params := map[string]interface{}{"name": "get_metadata_index", "arguments": map[string]interface{}{}}
+	call(t, s, "tools/call", params)
+	call(t, s, "tools/call", params)
+	rpcErr := callExpectError(t, s, "tools/call", params)
+	if rpcErr.Code != CodeRateLimited {
+		t.Fatalf("error code = %d, want %d", rpcErr.Code, CodeRateLimited)
+	}
+	info, ok := rpcErr.Data.(RetryInfo)
+	if !ok || info.RetryAfterMs <= 0 || info.RetryAfterMs > 10000 {
+		t.Errorf("error data = %+v", rpcErr.Data)
+	}
+}
+
+func TestMostCentralChunks(t *testing.T) {
+	ctx := context.Background()
+	s := setupTestServer(t)
+	db := s.db.(*storage.DB)
+
+	hub, _ := db.CreateChunk(ctx, "Index note about the garden, linking the plans, journals and seeds of every season", nil)
+	other, _ := db.CreateChunk(ctx, "Garden shed", nil)
+	for _, content := range []string{"Planting plan", "Seed journal", "Harvest log"} {
+		db.CreateChunk(ctx, content+" see [["+hub.ID+"]]", nil)
+	}
+	db.CreateChunk(ctx, "Shed repairs [["+other.ID+"]] [[00000000-0000-0000-0000-000000000000]]", nil)
+
+	result := call(t, s, "tools/call", map[string]any{
+		"name":      "most_central_chunks",
+		"arguments": map[string]any{"limit": 5},
+	})
+	var callResult CallToolResult
+	json.Unmarshal(result, &callResult)
+	data, _ := json.Marshal(callResult.StructuredContent)
+	var central struct {
+		Results []struct {
+			ID        string  `json:"id"`
+			Score     float64 `json:"score"`
+			Backlinks int     `json:"backlinks"`
+		} `json:"results"`
+	}
+	json.Unmarshal(data, &central)
+	if len(central.Results) != 2 {
+		t.Fatalf("results = %+v, want hub and shed", central.Results)
+	}
+	if top := central.Results[0]; top.ID != hub.ID || top.Backlinks != 3 || top.Score <= 1 {
+		t.Errorf("top = %+v, want hub with 3 backlinks", top)
+	}
+
+	searchTop := func(boost bool) string {
+		result := call(t, s, "tools/call", map[string]any{
+			"name":      "search_chunks",
+			"arguments": map[string]any{"query": "garden", "boost_central": boost},
+		})
+		var callResult CallToolResult
+		json.Unmarshal(result, &callResult)
+		data, _ := json.Marshal(callResult.StructuredContent)
+		var found struct {
+			Results []storage.SearchResult `json:"results"`
+		}
+		json.Unmarshal(data, &found)
+		if len(found.Results) != 2 {
+			t.Fatalf("results = %+v, want 2", found.Results)
+		}
+		return found.Results[0].ID
+	}
+	if searchTop(false) != other.ID {
+		t.Fatal("expected the short chunk to rank first without boost")
+	}
+	if searchTop(true) != hub.ID {
+		t.Error("boost_central did not lift the hub")
+	}
+}
+
+func TestSearchChunksMatchMode(t *testing.T) {
+	s := setupTestServer(t)
+	call(t, s, "tools/call", map[string]any{
+		"name":      "store_chunk",
+		"arguments": map[string]any{"content": "Kubernetes deployment checklist"},
+	})
+
+	count := func(mode string) (int, bool) {
+		result := call(t, s, "tools/call", map[string]any{
+			"name":      "search_chunks",
+			"arguments": map[string]any{"query": "kube", "match_mode": mode},
+		})
+		var callResult CallToolResult
+		json.Unmarshal(result, &callResult)
+		data, _ := json.Marshal(callResult.StructuredContent)
+		var found struct {
+			Count int `json:"count"`
+		}
+		json.Unmarshal(data, &found)
+		return found.Count, callResult.IsError
+	}
+	if n, _ := count("exact"); n != 0 {
+		t.Errorf("exact = %d results, want 0", n)
+	}
+	if n, _ := count("prefix"); n != 1 {
+		t.Errorf("prefix = %d results, want 1", n)
+	}
+	if _, isErr := count("fuzzy"); !isErr {
+		t.Error("expected fuzzy to fail without the trigram index")
+	}
+	if _, isErr := count("sloppy"); !isErr {
+		t.Error("expected error for unknown match_mode")
+	}
+}
+
+func TestRecencyBoost(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Init(t.TempDir())
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	idx := vector.NewIndex()
+	s := NewServer(db, &mockEmbedder{embedding: []float32{1, 0, 0}}, idx)
+
+	// The stale note is a little closer to the query and mentions it twice
+	stale := time.Now().AddDate(-1, 0, 0)
+	db.PutChunk(ctx, &storage.Chunk{ID: "stale", Content: "garden garden", CreatedAt: stale, UpdatedAt: stale})
+	recent, _ := db.CreateChunk(ctx, "garden notes from this week", nil)
+	idx.Add("stale", []float32{1, 0.1, 0})
+	idx.Add(recent.ID, []float32{1, 0.2, 0})
+
+	top := func(tool string, boost bool) string {
+		result := call(t, s, "tools/call", map[string]any{
+			"name":      tool,
+			"arguments": map[string]any{"query": "garden", "boost_recent": boost},
+		})
+		var callResult CallToolResult
+		json.Unmarshal(result, &callResult)
+		data, _ := json.Marshal(callResult.StructuredContent)
+		var found struct {
+			Results []struct {
+				ID string `json:"id"`
+			} `json:"results"`
+		}
+		json.Unmarshal(data, &found)
+		if len(found.Results) != 2 {
+			t.Fatalf("%s results = %+v, want 2", tool, found.Results)
+		}
+		return found.Results[0].ID
+	}
+	for _, tool := range []string{"search_chunks", "semantic_search"} {
+		if top(tool, false) != "stale" {
+			t.Errorf("%s: expected the stale chunk to rank first without boost", tool)
+		}
+		if top(tool, true) != recent.ID {
+			t.Errorf("%s: boost_recent did not lift the recent chunk", tool)
+		}
+	}
+}
+
+// wordReranker scores documents by how often they contain word.
+type wordReranker struct {
+	word  string
+	calls int
+}
+
+func (r *wordReranker) Rerank(_ context.Context, _ string, documents []string) ([]float64, error) {
+	r.calls++
+	scores := make([]float64, len(documents))
+	for i, d := range documents {
+		scores[i] = float64(strings.Count(d, r.word))
+	}
+	return scores, nil
+}
+
+func (r *wordReranker) Model() string { return "mock/rerank" }
+
+func TestRerank(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Init(t.TempDir())
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	idx := vector.NewIndex()
+	reranker := &wordReranker{word: "answer"}
+	cfg := DefaultConfig()
+	cfg.Reranker = reranker
+	s := NewServerWithConfig(db, &mockEmbedder{embedding: []float32{1, 0, 0}}, idx, cfg)
+
+	// The best answer is far down both rankings and only says so past the
+	// search preview
+	near, _ := db.CreateChunk(ctx, "question question question", nil)
+	far, _ := db.CreateChunk(ctx, "question "+strings.Repeat("filler ", 40)+"answer answer", nil)
+	idx.Add(near.ID, []float32{1, 0, 0})
+	idx.Add(far.ID, []float32{0.2, 1, 0})
+
+	top := func(tool string, args map[string]any) map[string]any {
+		args["query"] = "question"
+		args["limit"] = 1
+		result := call(t, s, "tools/call", map[string]any{"name": tool, "arguments": args})
+		var callResult CallToolResult
+		json.Unmarshal(result, &callResult)
+		data, _ := json.Marshal(callResult.StructuredContent)
+		var found struct {
+			Results []map[string]any `json:"results"`
+		}
+		json.Unmarshal(data, &found)
+		if len(found.Results) != 1 {
+			t.Fatalf("%s results = %+v, want 1", tool, found.Results)
+		}
+		return found.Results[0]
+	}
+	for _, tool := range []string{"search_chunks", "semantic_search"} {
+		if got := top(tool, map[string]any{"rerank": false}); got["id"] != near.ID {
+			t.Errorf("%s without rerank = %v, want the closer chunk", tool, got["id"])
+		}
+		if got := top(tool, map[string]any{}); got["id"] != far.ID {
+			t.Errorf("%s reranked = %v, want the answer", tool, got["id"])
+		}
+	}
+	if got := top("semantic_search", map[string]any{}); got["rerank_score"] != 2.0 {
+		t.Errorf("rerank_score = %v, want 2", got["rerank_score"])
+	}
+	if reranker.calls != 3 {
+		t.Errorf("reranker called %d times, want 3", reranker.calls)
+	}
+}
+
+func TestGetSessionChunks(t *testing.T) {
+	dir := t.TempDir()
+	db, err := storage.Open(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	defer db.Close()
+
+	var disabled CallToolResult
+	json.Unmarshal(call(t, NewServer(db, nil, vector.NewIndex()), "tools/call", map[string]any{
+		"name":      "get_session_chunks",
+		"arguments": map[string]any{"chunk_id": "x"},
+	}), &disabled)
+	if !disabled.IsError {
+		t.Error("expected error with sessions disabled")
+	}
+
+	cfg := DefaultConfig()
+	cfg.Sessions.Enabled = true
+	s := NewServerWithConfig(db, nil, vector.NewIndex(), cfg)
+	store := func(client, content string) string {
+		params, _ := json.Marshal(map[string]any{"name": "store_chunk", "arguments": map[string]any{"content": content}})
+		resp := s.HandleRequest(WithClient(context.Background(), client), &Request{JSONRPC: "2.0", ID: json.RawMessage(`1`), Method: "tools/call", Params: params})
+		data, _ := json.Marshal(resp.Result.(*CallToolResult).StructuredContent)
+		var chunk storage.Chunk
+		json.Unmarshal(data, &chunk)
+		return chunk.ID
+	}
+	first := store("client-a", "Research note one")
+	store("client-b", "Unrelated")
+	store("client-a", "Research note two")
+
+	result := call(t, s, "tools/call", map[string]any{
+		"name":      "get_session_chunks",
+		"arguments": map[string]any{"chunk_id": first},
+	})
+	var callResult CallToolResult
+	json.Unmarshal(result, &callResult)
+	data, _ := json.Marshal(callResult.StructuredContent)
+	var session struct {
+		Client  string `json:"client"`
+		Count   int    `json:"count"`
+		Results []struct {
+			Content string `json:"content"`
+		} `json:"results"`
+	}
+	json.Unmarshal(data, &session)
+	if session.Client != "client-a" || session.Count != 2 || session.Results[1].Content != "Research note two" {
+		t.Errorf("session = %+v", session)
+	}
+}
+
+func TestIngestDocument(t *testing.T) {
+	ctx := context.Background()
+	s := setupTestServer(t)
+	s.config.Ingest = ingest.Config{ChunkTokens: 6, OverlapTokens: 2}
+
+	doc := "# Notes\n\nfirst paragraph has five words\n\nsecond one\n\nthird paragraph is a bit longer"
+	result := call(t, s, "tools/call", map[string]any{
+		"name": "ingest_document",
+		"arguments": map[string]any{
+			"content":  doc,
+			"source":   "notes.md",
+			"metadata": map[string]any{"project": "kb"},
+		},
+	})
+	var callResult CallToolResult
+	json.Unmarshal(result, &callResult)
+	if callResult.IsError {
+		t.Fatalf("ingest_document failed: %+v", callResult.Content)
+	}
+	data, _ := json.Marshal(callResult.StructuredContent)
+	var res IngestResult
+	json.Unmarshal(data, &res)
+	if res.Title != "Notes" || len(res.ChunkIDs) != 4 {
+		t.Fatalf("result = %+v", res)
+	}
+
+	for i, id := range res.ChunkIDs {
+		chunk, err := s.db.GetChunk(ctx, id)
+		if err != nil {
+			t.Fatalf("GetChunk: %v", err)
+		}
+		var meta struct {
+			Source  string `json:"source"`
+			Title   string `json:"title"`
+			Project string `json:"project"`
+			Offset  int    `json:"offset"`
+			Length  int    `json:"length"`
+			Part    int    `json:"part"`
+			Parts   int    `json:"parts"`
+		}
+		json.Unmarshal(chunk.Metadata, &meta)
+		if meta.Source != "notes.md" || meta.Title != "Notes" || meta.Project != "kb" || meta.Part != i+1 || meta.Parts != 4 {
+			t.Errorf("chunk %d metadata = %s", i, chunk.Metadata)
+		}
+		if doc[meta.Offset:meta.Offset+meta.Length] != chunk.Content {
+			t.Errorf("chunk %d offset does not locate %q", i, chunk.Content)
+		}
+	}
+	if chunks, _ := s.db.GetChunksBySource(ctx, res.SourceID); len(chunks) != 4 {
+		t.Errorf("source %q has %d chunks, want 4", res.SourceID, len(chunks))
+	}
+	if src, _ := s.db.FindSource(ctx, "notes.md"); src == nil || src.ID != res.SourceID || string(src.Metadata) != `{"title":"Notes"}` {
+		t.Errorf("source = %+v", src)
+	}
+
+	errResult := call(t, s, "tools/call", map[string]any{
+		"name":      "ingest_document",
+		"arguments": map[string]any{"url": "file:///etc/passwd"},
+	})
+	json.Unmarshal(errResult, &callResult)
+	if !callResult.IsError {
+		t.Error("expected error for non-http url")
+	}
+}
+
+func TestSources(t *testing.T) {
+	s := setupTestServer(t)
+	tool := func(name string, args map[string]any) (map[string]any, bool) {
+		t.Helper()
+		var res CallToolResult
+		json.Unmarshal(call(t, s, "tools/call", map[string]any{"name": name, "arguments": args}), &res)
+		var out map[string]any
+		json.Unmarshal([]byte(res.Content[0].Text), &out)
+		return out, res.IsError
+	}
+
+	src, isErr := tool("store_source", map[string]any{
+		"name":     "Designing Data-Intensive Applications",
+		"metadata": map[string]any{"type": "book", "author": "Kleppmann"},
+	})
+	if isErr || src["id"] == nil {
+		t.Fatalf("store_source = %v", src)
+	}
+	id := src["id"].(string)
+
+	if _, isErr := tool("store_chunk", map[string]any{"content": "orphan", "source_id": "missing"}); !isErr {
+		t.Error("store_chunk with unknown source_id succeeded")
+	}
+	chunk, _ := tool("store_chunk", map[string]any{"content": "replication lag", "source_id": id})
+	other, _ := tool("store_chunk", map[string]any{"content": "no source yet"})
+	tool("update_chunk", map[string]any{"chunk_id": other["id"], "source_id": id})
+
+	got, _ := tool("get_chunk", map[string]any{"chunk_id": chunk["id"]})
+	if source, _ := got["source"].(map[string]any); source["id"] != id {
+		t.Errorf("get_chunk source = %v", got["source"])
+	}
+
+	list, _ := tool("list_sources", map[string]any{})
+	sources, _ := list["sources"].([]any)
+	if len(sources) != 1 || sources[0].(map[string]any)["chunks"] != float64(2) {
+		t.Errorf("list_sources = %v", list)
+	}
+
+	byLink, _ := tool("get_chunks_by_source", map[string]any{"source_id": id})
+	if byLink["count"] != float64(2) {
+		t.Errorf("get_chunks_by_source = %v", byLink)
+	}
+	if res, _ := tool("get_chunks_by_source", map[string]any{"source_id": "missing"}); res["found"] != false {
+		t.Errorf("get_chunks_by_source(missing) = %v", res)
+	}
+
+	// Updating keeps metadata unless given; detaching empties the source
+	updated, _ := tool("store_source", map[string]any{"source_id": id, "name": "DDIA"})
+	if meta, _ := updated["metadata"].(map[string]any); updated["name"] != "DDIA" || meta["author"] != "Kleppmann" {
+		t.Errorf("store_source update = %v", updated)
+	}
+	tool("update_chunk", map[string]any{"chunk_id": other["id"], "source_id": ""})
+	if byLink, _ := tool("get_chunks_by_source", map[string]any{"source_id": id}); byLink["count"] != float64(1) {
+		t.Errorf("after detach: %v", byLink)
+	}
+
+	if res, _ := tool("delete_source", map[string]any{"source_id": id}); res["deleted"] != true {
+		t.Errorf("delete_source = %v", res)
+	}
+	if got, _ := tool("get_chunk", map[string]any{"chunk_id": chunk["id"]}); got["content"] != "replication lag" || got["source"] != nil {
+		t.Errorf("chunk after delete_source = %v", got)
+	}
+}
+
+func TestReadOnlyTools(t *testing.T) {
+	ctx := context.Background()
+	s := setupTestServer(t)
+	s.config.ReadOnly = true
+
+	result := call(t, s, "tools/list", nil)
+	var list ToolsListResult
+	json.Unmarshal(result, &list)
+	for _, tool := range list.Tools {
+		if !tool.Annotations.ReadOnlyHint {
+			t.Errorf("read-only server lists %s", tool.Name)
+		}
+	}
+	if len(list.Tools) == 0 {
+		t.Error("no tools listed")
+	}
+
+	result = call(t, s, "tools/call", map[string]any{
+		"name":      "store_chunk",
+		"arguments": map[string]any{"content": "x"},
+	})
+	var callResult CallToolResult
+	json.Unmarshal(result, &callResult)
+	if !callResult.IsError {
+		t.Error("expected store_chunk to be refused")
+	}
+	if chunks, _ := s.db.GetAllChunks(ctx); len(chunks) != 0 {
+		t.Errorf("stored %d chunks, want 0", len(chunks))
+	}
+
+	result = call(t, s, "tools/call", map[string]any{
+		"name":      "search_chunks",
+		"arguments": map[string]any{"query": "x"},
+	})
+	var searchResult CallToolResult
+	json.Unmarshal(result, &searchResult)
+	if searchResult.IsError {
+		t.Errorf("search_chunks refused: %+v", searchResult.Content)
+	}
+}
+
+func TestRecordToolCalls(t *testing.T) {
+	ctx := context.Background()
+	s := setupTestServer(t)
+	call(t, s, "tools/call", map[string]any{
+		"name":      "search_chunks",
+		"arguments": map[string]any{"query": "unrecorded"},
+	})
+	if calls, _ := s.db.ListToolCalls(ctx, 10); len(calls) != 0 {
+		t.Fatalf("recorded %d calls with recording off", len(calls))
+	}
+
+	s.config.Recording = RecordingConfig{Enabled: true, Keep: 2}
+	call(t, s, "tools/call", map[string]any{
+		"name":      "store_chunk",
+		"arguments": map[string]any{"content": "replayed note"},
+	})
+	call(t, s, "tools/call", map[string]any{
+		"name":      "delete_chunk",
+		"arguments": map[string]any{},
+	})
+	calls, err := s.db.ListToolCalls(ctx, 10)
+	if err != nil || len(calls) != 2 {
+		t.Fatalf("ListToolCalls = %+v, %v", calls, err)
+	}
+	if calls[0].Tool != "delete_chunk" || !calls[0].IsError {
+		t.Errorf("newest call = %+v, want failed delete_chunk", calls[0])
+	}
+	store := calls[1]
+	var recorded CallToolResult
+	json.Unmarshal(store.Response, &recorded)
+	if store.Tool != "store_chunk" || recorded.IsError || len(recorded.Content) != 1 {
+		t.Errorf("store call = %+v, response %+v", store, recorded)
+	}
+
+	// Replaying against a scratch server leaves the original untouched
+	scratch := setupTestServer(t)
+	replayed, err := s.WithStorage(scratch.db, vector.NewIndex()).Replay(context.Background(), &store)
+	if err != nil || replayed.IsError {
+		t.Fatalf("Replay = %+v, %v", replayed, err)
+	}
+	if chunks, _ := scratch.db.GetAllChunks(ctx); len(chunks) != 1 || chunks[0].Content != "replayed note" {
+		t.Errorf("scratch chunks = %+v", chunks)
+	}
+	if chunks, _ := s.db.GetAllChunks(ctx); len(chunks) != 1 {
+		t.Errorf("original has %d chunks, want 1", len(chunks))
+	}
+	if calls, _ := scratch.db.ListToolCalls(ctx, 10); len(calls) != 0 {
+		t.Errorf("replay recorded %d calls", len(calls))
+	}
+}
+
+func TestChildTokens(t *testing.T) {
+	s := setupTestServer(t)
+	request := func(ctx context.Context, method string, params any) *Response {
+		data, _ := json.Marshal(params)
+		return s.HandleRequest(ctx, &Request{JSONRPC: "2.0", ID: json.RawMessage(`1`), Method: method, Params: data})
+	}
+	tool := func(ctx context.Context, name string, args any) *CallToolResult {
+		return request(ctx, "tools/call", map[string]any{"name": name, "arguments": args}).Result.(*CallToolResult)
+	}
+
+	// Without an access token (stdio) there is nothing to delegate from
+	if res := tool(context.Background(), "create_child_token", map[string]any{"tools": []string{"get_chunk"}}); !res.IsError {
+		t.Error("expected error without a grant")
+	}
+
+	parentExpiry := time.Now().Add(time.Hour)
+	ctx := WithGrant(WithClient(context.Background(), "orchestrator"), &Grant{ExpiresAt: parentExpiry})
+	res := tool(ctx, "create_child_token", map[string]any{
+		"tools": []string{"search_chunks", "get_chunk"}, "ttl_minutes": 600, "name": "researcher",
+	})
+	if res.IsError {
+		t.Fatalf("create_child_token: %s", res.Content[0].Text)
+	}
+	data, _ := json.Marshal(res.StructuredContent)
+	var minted struct {
+		AccessToken string    `json:"access_token"`
+		Client      string    `json:"client"`
+		ExpiresAt   time.Time `json:"expires_at"`
+	}
+	json.Unmarshal(data, &minted)
+	if minted.Client != "orchestrator/researcher" || minted.ExpiresAt.After(parentExpiry) {
+		t.Errorf("minted = %+v, want client orchestrator/researcher expiring by %v", minted, parentExpiry)
+	}
+
+	tok, err := s.db.ValidateToken(ctx, storage.HashToken(minted.AccessToken), storage.TokenAccess)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	grant := GrantFromToken(tok)
+	if grant.Parent != "orchestrator" || len(grant.Tools) != 2 {
+		t.Errorf("grant = %+v", grant)
+	}
+
+	// The child sees and calls only its tools
+	child := WithGrant(WithClient(context.Background(), tok.ClientID), grant)
+	var list ToolsListResult
+	data, _ = json.Marshal(request(child, "tools/list", nil).Result)
+	json.Unmarshal(data, &list)
+	if len(list.Tools) != 2 {
+		t.Errorf("child lists %d tools, want 2", len(list.Tools))
+	}
+	if res := tool(child, "store_chunk", map[string]any{"content": "x"}); !res.IsError {
+		t.Error("child called store_chunk")
+	}
+	if res := tool(child, "search_chunks", map[string]any{"query": "x"}); res.IsError {
+		t.Errorf("search_chunks: %s", res.Content[0].Text)
+	}
+
+	// Nor can it delegate more than it has
+	if res := tool(child, "create_child_token", map[string]any{"tools": []string{"get_chunk"}}); !res.IsError {
+		t.Error("child minted a token without create_child_token")
+	}
+	narrow := WithGrant(ctx, &Grant{Tools: []string{"create_child_token", "get_chunk"}})
+	if res := tool(narrow, "create_child_token", map[string]any{"tools": []string{"delete_chunk"}}); !res.IsError {
+		t.Error("delegated a tool the parent lacks")
+	}
+	if res := tool(ctx, "create_child_token", map[string]any{"tools": []string{"no_such_tool"}}); !res.IsError {
+		t.Error("delegated an unknown tool")
+	}
+}
+
+// countingEmbedder counts Embed calls
+type countingEmbedder struct {
+	mockEmbedder
+	calls int
+}
+
+func (e *countingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.calls++
+	return e.mockEmbedder.Embed(ctx, texts)
+}
+
+func TestSemanticSearchCachesQueryEmbeddings(t *testing.T) {
+	dir := t.TempDir()
+	db, _ := storage.Open(filepath.Join(dir, "test.db"))
+	db.Migrate()
+	t.Cleanup(func() { db.Close() })
+
+	embedder := &countingEmbedder{mockEmbedder: mockEmbedder{embedding: []float32{1, 0, 0}}}
+	s := NewServerWithConfig(db, embedder, vector.NewIndex(), DefaultConfig())
+
+	search := func(query string) {
+		result := call(t, s, "tools/call", map[string]interface{}{
+			"name":      "semantic_search",
+			"arguments": map[string]interface{}{"query": query},
+		})
+		var callResult CallToolResult
+		json.Unmarshal(result, &callResult)
+		if callResult.IsError {
+			t.Fatalf("semantic_search: %+v", callResult)
+		}
+	}
+	search("walrus")
+	search("walrus")
+	if embedder.calls != 1 {
+		t.Errorf("repeated query embedded %d times, want 1", embedder.calls)
+	}
+	search("narwhal")
+	if embedder.calls != 2 {
+		t.Errorf("new query: embed calls = %d, want 2", embedder.calls)
+	}
+}
+
+func TestQueryCacheEvictionAndExpiry(t *testing.T) {
+	now := time.Now()
+	c := newQueryCache(2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.put("a", []float32{1})
+	c.put("b", []float32{2})
+	c.get("a") // b is now least recently used
+	c.put("c", []float32{3})
+	if _, ok := c.get("b"); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	if vec, ok := c.get("a"); !ok || vec[0] != 1 {
+		t.Errorf("get(a) = %v, %v", vec, ok)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := c.get("a"); ok {
+		t.Error("entry did not expire after the TTL")
+	}
+
+	if newQueryCache(0, time.Minute) != nil {
+		t.Error("cache of size 0 should be disabled")
+	}
+}
+
+func TestEmbeddingQueueRetriesDeferredChunks(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	db, _ := storage.Open(filepath.Join(dir, "test.db"))
+	db.Migrate()
+	t.Cleanup(func() { db.Close() })
+
+	cfg := DefaultConfig()
+	cfg.DeferOnTimeout = true
+	s := NewServerWithConfig(db, &rateLimitedEmbedder{}, vector.NewIndex(), cfg)
+
+	var callResult CallToolResult
+	json.Unmarshal(call(t, s, "tools/call", map[string]interface{}{
+		"name":      "store_chunk",
+		"arguments": map[string]interface{}{"content": "busy provider"},
+	}), &callResult)
+	if callResult.IsError {
+		t.Fatalf("store_chunk failed: %s", callResult.Content[0].Text)
+	}
+	var stored storage.Chunk
+	json.Unmarshal([]byte(callResult.Content[0].Text), &stored)
+	if n, _ := db.EmbeddingQueueLen(ctx); n != 1 {
+		t.Fatalf("queued = %d, want 1", n)
+	}
+
+	// Still rate limited: the chunk waits for a later attempt
+	if _, err := s.DrainEmbeddingQueue(context.Background()); err == nil {
+		t.Error("expected the pass to stop on rate limiting")
+	}
+	if due, _ := db.DueEmbeddings(ctx, time.Now(), 10); len(due) != 0 {
+		t.Errorf("due right after a failed attempt = %+v", due)
+	}
+
+	// Once the provider recovers the chunk is embedded and dequeued
+	s.embedder = &mockEmbedder{embedding: []float32{1, 0, 0}}
+	db.QueueEmbedding(ctx, stored.ID, "retry now")
+	n, err := s.DrainEmbeddingQueue(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("DrainEmbeddingQueue = %d, %v", n, err)
+	}
+	if queued, _ := db.EmbeddingQueueLen(ctx); queued != 0 || s.index.Size() != 1 {
+		t.Errorf("queued = %d, index size = %d", queued, s.index.Size())
+	}
+}
+
+func TestInitializeReportsSemanticSearch(t *testing.T) {
+	dir := t.TempDir()
+	db, _ := storage.Open(filepath.Join(dir, "test.db"))
+	db.Migrate()
+	t.Cleanup(func() { db.Close() })
+
+	initialize := func(s *Server) (EmbeddingHealth, string) {
+		var result struct {
+			Capabilities struct {
+				Experimental map[string]EmbeddingHealth `json:"experimental"`
+			} `json:"capabilities"`
+			Instructions string `json:"instructions"`
+		}
+		json.Unmarshal(call(t, s, "initialize", map[string]interface{}{"protocolVersion": "2025-11-25"}), &result)
+		return result.Capabilities.Experimental[semanticSearchCapability], result.Instructions
+	}
+
+	health, instructions := initialize(NewServer(db, nil, vector.NewIndex()))
+	if health.Configured || !strings.Contains(instructions, "no embedding provider is configured") {
+		t.Errorf("without provider: %+v, %q", health, instructions)
+	}
+
+	s := NewServer(db, &failingEmbedder{}, vector.NewIndex())
+	health, instructions = initialize(s)
+	if !health.Configured || health.Available || health.Error == "" || !strings.Contains(instructions, "currently unavailable") {
+		t.Errorf("failing provider: %+v, %q", health, instructions)
+	}
+
+	// Any later embedding updates the cached outcome
+	s.embedder = &mockEmbedder{embedding: []float32{1, 0, 0}}
+	if _, err := s.embed(context.Background(), 0, "hello", false); err != nil {
+		t.Fatal(err)
+	}
+	if health, _ = initialize(s); !health.Available || health.Model != "mock/test" {
+		t.Errorf("after a successful embedding: %+v", health)
+	}
+}
+
+func TestAttachmentResources(t *testing.T) {
+	ctx := context.Background()
+	s := setupTestServer(t)
+	chunk, _ := s.db.CreateChunk(ctx, "whiteboard photo", nil)
+	a, err := s.AddAttachment(context.Background(), chunk.ID, "board.jpg", "image/jpeg", []byte("jpeg bytes"))
+	if err != nil {
+		t.Fatalf("AddAttachment: %v", err)
+	}
+	uri := AttachmentURI(a.ID)
+
+	var list ResourcesListResult
+	json.Unmarshal(call(t, s, "resources/list", nil), &list)
+	if len(list.Resources) != 1 || list.Resources[0].URI != uri || list.Resources[0].MimeType != "image/jpeg" {
+		t.Errorf("resources/list = %+v", list)
+	}
+
+	var read ReadResourceResult
+	json.Unmarshal(call(t, s, "resources/read", map[string]any{"uri": uri}), &read)
+	if len(read.Contents) != 1 || read.Contents[0].Blob != "anBlZyBieXRlcw==" {
+		t.Errorf("resources/read = %+v", read)
+	}
+	if e := callExpectError(t, s, "resources/read", map[string]any{"uri": AttachmentURI("missing")}); e.Code != CodeResourceNotFound {
+		t.Errorf("missing resource: code = %d", e.Code)
+	}
+
+	var got struct {
+		Attachments []struct {
+			ID  string `json:"id"`
+			URI string `json:"uri"`
+		} `json:"attachments"`
+	}
+	result := call(t, s, "tools/call", map[string]any{"name": "get_chunk", "arguments": map[string]any{"chunk_id": chunk.ID}})
+	var toolResult CallToolResult
+	json.Unmarshal(result, &toolResult)
+	data, _ := json.Marshal(toolResult.StructuredContent)
+	json.Unmarshal(data, &got)
+	if len(got.Attachments) != 1 || got.Attachments[0].URI != uri {
+		t.Errorf("get_chunk attachments = %+v", got.Attachments)
+	}
+
+	// A token that may not read chunks sees no attachments
+	narrow := WithGrant(context.Background(), &Grant{Tools: []string{"search_chunks"}})
+	if r := s.handleResourcesList(narrow); len(r.Resources) != 0 {
+		t.Errorf("narrow resources/list = %+v", r.Resources)
+	}
+	if _, err := s.AddAttachment(narrow, chunk.ID, "x", "text/plain", nil); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("narrow AddAttachment: err = %v, want ErrNotAllowed", err)
+	}
+}
+
+// fakeTranscriber returns a fixed transcript.
+type fakeTranscriber struct{ text string }
+
+func (f fakeTranscriber) Transcribe(ctx context.Context, name string, audio []byte) (string, error) {
+	return f.text, nil
+}
+
+func (fakeTranscriber) Model() string { return "fake/whisper" }
+
+func TestIngestAudio(t *testing.T) {
+	s := setupTestServer(t)
+	ctx := context.Background()
+	if _, err := s.IngestAudio(ctx, "memo.m4a", "audio/mp4", []byte("audio"), nil); !errors.Is(err, ErrNoTranscriber) {
+		t.Errorf("without transcriber: err = %v, want ErrNoTranscriber", err)
+	}
+
+	s.config.Transcriber = fakeTranscriber{text: "Remember to renew the passport before March."}
+	res, err := s.IngestAudio(ctx, "/notes/memo.m4a", "audio/mp4", []byte("audio"), map[string]any{"type": "voice"})
+	if err != nil {
+		t.Fatalf("IngestAudio: %v", err)
+	}
+	if len(res.ChunkIDs) != 1 || res.AttachmentID == "" || res.Title != "memo" {
+		t.Fatalf("result = %+v", res)
+	}
+	chunk, _ := s.db.GetChunk(ctx, res.ChunkIDs[0])
+	var meta map[string]any
+	json.Unmarshal(chunk.Metadata, &meta)
+	if chunk.Content != "Remember to renew the passport before March." || meta["transcribed_by"] != "fake/whisper" || meta["type"] != "voice" {
+		t.Errorf("chunk = %q %v", chunk.Content, meta)
+	}
+	a, data, err := s.db.GetAttachment(ctx, res.AttachmentID)
+	if err != nil || a.ChunkID != chunk.ID || a.Name != "memo.m4a" || string(data) != "audio" {
+		t.Errorf("attachment = %+v %q, %v", a, data, err)
+	}
+
+	s.config.Transcriber = fakeTranscriber{}
+	if _, err := s.IngestAudio(ctx, "silence.wav", "audio/wav", nil, nil); err == nil {
+		t.Error("empty transcript ingested")
+	}
+}
+
+func TestFindURLs(t *testing.T) {
+	content := "See https://example.com/a, and [docs](https://example.com/b). Again: https://example.com/a\nhttp://x.org/c?q=1!"
+	got := findURLs(content, 10)
+	want := []string{"https://example.com/a", "https://example.com/b", "http://x.org/c?q=1"}
+	if !slices.Equal(got, want) {
+		t.Errorf("findURLs = %v, want %v", got, want)
+	}
+	if got := findURLs(content, 2); len(got) != 2 {
+		t.Errorf("findURLs with limit 2 = %v", got)
+	}
+}
+
+func TestStoreChunkUnfurl(t *testing.T) {
+	ctx := context.Background()
+	bookmarks.AllowPrivate = true
+	t.Cleanup(func() { bookmarks.AllowPrivate = false })
+	pages := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><head><title>Linked page</title></head><body><p>Readable linked text.</p></body></html>")
+	}))
+	defer pages.Close()
+
+	dir := t.TempDir()
+	db, _ := storage.Open(filepath.Join(dir, "test.db"))
+	db.Migrate()
+	t.Cleanup(func() { db.Close() })
+	cfg := DefaultConfig()
+	cfg.Unfurl = UnfurlConfig{Enabled: true, Archive: true}
+	s := NewServerWithConfig(db, nil, vector.NewIndex(), cfg)
+
+	store := func(args map[string]interface{}) (id string, unfurled []Unfurled) {
+		t.Helper()
+		var callResult CallToolResult
+		json.Unmarshal(call(t, s, "tools/call", map[string]interface{}{"name": "store_chunk", "arguments": args}), &callResult)
+		if callResult.IsError {
+			t.Fatalf("store_chunk failed: %s", callResult.Content[0].Text)
+		}
+		var stored struct {
+			ID       string     `json:"id"`
+			Unfurled []Unfurled `json:"unfurled"`
+		}
+		json.Unmarshal([]byte(callResult.Content[0].Text), &stored)
+		return stored.ID, stored.Unfurled
+	}
+
+	id, unfurled := store(map[string]interface{}{"content": "Read " + pages.URL + "/post and " + pages.URL + "/missing"})
+	if len(unfurled) != 2 {
+		t.Fatalf("unfurled = %+v, want 2", unfurled)
+	}
+	page, missing := unfurled[0], unfurled[1]
+	if page.ChunkID == "" || page.Title != "Linked page" || page.AttachmentID == "" || page.Error != "" {
+		t.Errorf("unfurled page = %+v", page)
+	}
+	if missing.ChunkID != "" || missing.Error == "" {
+		t.Errorf("unfurled missing page = %+v, want an error", missing)
+	}
+
+	linked, err := db.GetChunk(ctx, page.ChunkID)
+	if err != nil {
+		t.Fatalf("GetChunk: %v", err)
+	}
+	var meta map[string]any
+	json.Unmarshal(linked.Metadata, &meta)
+	if !strings.Contains(linked.Content, "Readable linked text.") || meta["url"] != pages.URL+"/post" || meta["unfurled_from"] != id {
+		t.Errorf("linked chunk = %q, metadata %v", linked.Content, meta)
+	}
+	a, data, err := db.GetAttachment(ctx, page.AttachmentID)
+	if err != nil || a.ChunkID != page.ChunkID || !bytes.Contains(data, []byte("<title>Linked page</title>")) {
+		t.Errorf("archive = %+v, %q, %v", a, data, err)
+	}
+
+	// A page already stored is linked rather than fetched again
+	_, unfurled = store(map[string]interface{}{"content": "Again " + pages.URL + "/post"})
+	if len(unfurled) != 1 || !unfurled[0].Existing || unfurled[0].ChunkID != page.ChunkID {
+		t.Errorf("unfurled again = %+v, want the existing chunk", unfurled)
+	}
+
+	// The call overrides the configured default
+	_, unfurled = store(map[string]interface{}{"content": "Skip " + pages.URL + "/other", "unfurl": false})
+	if unfurled != nil {
+		t.Errorf("unfurled with unfurl false = %+v", unfurled)
+	}
+}
+
+// fakeCompleter replies with a fixed suggestion, or fails with err.
+type fakeCompleter struct {
+	reply  string
+	err    error
+	prompt string
+}
+
+func (f *fakeCompleter) Complete(ctx context.Context, system, prompt string) (string, error) {
+	f.prompt = prompt
+	return f.reply, f.err
+}
+
+func (f *fakeCompleter) Model() string { return "fake/llm" }
+
+func TestStoreChunkEnrich(t *testing.T) {
+	s := setupTestServer(t)
+	store := func(args map[string]interface{}) (CallToolResult, map[string]any) {
+		t.Helper()
+		var callResult CallToolResult
+		json.Unmarshal(call(t, s, "tools/call", map[string]interface{}{"name": "store_chunk", "arguments": args}), &callResult)
+		if callResult.IsError {
+			return callResult, nil
+		}
+		var stored struct {
+			Metadata map[string]any `json:"metadata"`
+		}
+		json.Unmarshal([]byte(callResult.Content[0].Text), &stored)
+		return callResult, stored.Metadata
+	}
+
+	// Asked for without a model
+	if res, _ := store(map[string]interface{}{"content": "note", "enrich": true}); !res.IsError {
+		t.Error("enrich without an LLM should fail")
+	}
+
+	llm := &fakeCompleter{reply: "Sure:\n```json\n{\"title\": \"Go generics\", \"summary\": \"Notes on type parameters.\", \"tags\": [\"Go\", \"generics\", \"go\", \" \", \"types\"]}\n```"}
+	s.config.LLM = llm
+	s.config.Enrich = EnrichConfig{Enabled: true, MaxTags: 2}
+	_, meta := store(map[string]interface{}{"content": "Type parameters in Go", "metadata": map[string]any{"auto:title": "Mine"}})
+	if llm.prompt != "Type parameters in Go" {
+		t.Errorf("prompt = %q", llm.prompt)
+	}
+	tags, _ := meta["auto:tags"].([]any)
+	if meta["auto:title"] != "Mine" || meta["auto:summary"] != "Notes on type parameters." || len(tags) != 2 || tags[0] != "go" || tags[1] != "generics" {
+		t.Errorf("metadata = %v", meta)
+	}
+
+	// The call overrides the configured default
+	if _, meta := store(map[string]interface{}{"content": "plain", "enrich": false}); meta["auto:title"] != nil {
+		t.Errorf("metadata with enrich false = %v", meta)
+	}
+
+	// A failing model leaves the chunk stored without suggestions
+	llm.err = errors.New("model overloaded")
+	res, meta := store(map[string]interface{}{"content": "still kept"})
+	if res.IsError || meta["auto:title"] != nil || !strings.Contains(res.Content[0].Text, "model overloaded") {
+		t.Errorf("store with failing model = %v, metadata %v", res, meta)
+	}
+}
+
+func TestEntities(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	db, _ := storage.Open(filepath.Join(dir, "test.db"))
+	db.Migrate()
+	t.Cleanup(func() { db.Close() })
+	llm := &fakeCompleter{}
+	cfg := DefaultConfig()
+	cfg.LLM = llm
+	cfg.Entities = EntitiesConfig{Enabled: true}
+	s := NewServerWithConfig(db, &mockEmbedder{embedding: []float32{1, 0, 0}}, vector.NewIndex(), cfg)
+
+	tool := func(name string, args map[string]any) (CallToolResult, map[string]any) {
+		t.Helper()
+		var callResult CallToolResult
+		json.Unmarshal(call(t, s, "tools/call", map[string]any{"name": name, "arguments": args}), &callResult)
+		data, _ := json.Marshal(callResult.StructuredContent)
+		var out map[string]any
+		json.Unmarshal(data, &out)
+		if callResult.IsError {
+			t.Logf("%s: %s", name, callResult.Content[0].Text)
+		}
+		return callResult, out
+	}
+	store := func(content, reply string) string {
+		t.Helper()
+		llm.reply = reply
+		_, out := tool("store_chunk", map[string]any{"content": content})
+		return out["id"].(string)
+	}
+
+	call1 := store("Call with Alice about Apollo on March 1st", `{"people": ["Alice"], "projects": ["Apollo"], "dates": ["2026-03-01", "next week"]}`)
+	review := store("Alice and Bob reviewed the budget", `{"people": ["alice", "Bob"], "projects": [], "dates": []}`)
+	store("Grocery list", `{"people": [], "projects": [], "dates": []}`)
+
+	_, out := tool("get_entities", map[string]any{"kind": "person", "include_chunks": true})
+	entities, _ := out["entities"].([]any)
+	if len(entities) != 2 {
+		t.Fatalf("people = %v, want 2", out)
+	}
+	alice := entities[0].(map[string]any)
+	if alice["name"] != "Alice" || alice["chunks"] != 2.0 || len(alice["chunk_ids"].([]any)) != 2 {
+		t.Errorf("first person = %v, want Alice in 2 chunks", alice)
+	}
+	if _, out := tool("get_entities", map[string]any{"chunk_id": call1}); out["count"] != 3.0 {
+		t.Errorf("entities of chunk = %v, want 3 (the unparsed date dropped)", out)
+	}
+	if _, out := tool("get_entities", map[string]any{"query": "APO"}); out["count"] != 1.0 {
+		t.Errorf("entities matching APO = %v", out)
+	}
+	if res, _ := tool("get_entities", map[string]any{"kind": "place"}); !res.IsError {
+		t.Error("unknown kind should be rejected")
+	}
+
+	// get_chunk lists them, and update_chunk re-extracts from new content
+	if _, out := tool("get_chunk", map[string]any{"chunk_id": review}); len(out["entities"].([]any)) != 2 {
+		t.Errorf("get_chunk entities = %v", out["entities"])
+	}
+	llm.reply = `{"people": ["Bob"]}`
+	tool("update_chunk", map[string]any{"chunk_id": review, "content": "Bob reviewed the budget"})
+	if ids, _ := db.EntityChunkIDs(ctx, storage.EntityPerson, "alice"); !slices.Equal(ids, []string{call1}) {
+		t.Errorf("chunks mentioning Alice after update = %v", ids)
+	}
+
+	// Entity-filtered search
+	_, out = tool("semantic_search", map[string]any{"query": "meetings", "entity": "bob"})
+	results, _ := out["results"].([]any)
+	if len(results) != 1 || results[0].(map[string]any)["id"] != review {
+		t.Errorf("search for bob = %v, want the review", out["results"])
+	}
+	_, out = tool("semantic_search", map[string]any{"query": "meetings", "entity": "Apollo", "entity_kind": "person"})
+	if results, _ := out["results"].([]any); len(results) != 0 {
+		t.Errorf("search for person Apollo = %v, want none", results)
+	}
+}
+
+func TestDailyNote(t *testing.T) {
+	s := setupTestServer(t)
+	s.config.Daily = DailyConfig{Timezone: "Pacific/Kiritimati"}
+	today := time.Now().In(s.config.Daily.location()).Format(time.DateOnly)
+
+	tool := func(name string, args map[string]any) (CallToolResult, map[string]any) {
+		t.Helper()
+		var callResult CallToolResult
+		json.Unmarshal(call(t, s, "tools/call", map[string]any{"name": name, "arguments": args}), &callResult)
+		data, _ := json.Marshal(callResult.StructuredContent)
+		var out map[string]any
+		json.Unmarshal(data, &out)
+		return callResult, out
+	}
+
+	if _, out := tool("get_daily_note", map[string]any{}); out["found"] != false || out["date"] != today {
+		t.Errorf("get_daily_note before any entry = %v", out)
+	}
+	_, first := tool("append_daily_note", map[string]any{"text": "Started the migration"})
+	if first["created"] != true {
+		t.Errorf("first append = %v, want created", first)
+	}
+	_, second := tool("append_daily_note", map[string]any{"text": "Finished it", "date": "today"})
+	if second["id"] != first["id"] {
+		t.Errorf("second append went to %v, want the same note %v", second["id"], first["id"])
+	}
+	_, note := tool("get_daily_note", map[string]any{"date": today})
+	content, _ := note["content"].(string)
+	if !strings.HasPrefix(content, "# "+today+"\n\n") || !strings.Contains(content, " Started the migration\n\n") || !strings.HasSuffix(content, " Finished it") {
+		t.Errorf("daily note = %q", content)
+	}
+	if meta, _ := note["metadata"].(map[string]any); meta[DailyNoteKey] != today {
+		t.Errorf("metadata = %v", note["metadata"])
+	}
+
+	// Other days have their own notes, without times
+	_, past := tool("append_daily_note", map[string]any{"text": "Backfilled", "date": "2026-01-05"})
+	if past["id"] == first["id"] || past["content"] != "# 2026-01-05\n\nBackfilled" {
+		t.Errorf("past day note = %v", past)
+	}
+	if res, _ := tool("append_daily_note", map[string]any{"text": "x", "date": "last tuesday"}); !res.IsError {
+		t.Error("invalid date should be rejected")
+	}
+	if res, _ := tool("append_daily_note", map[string]any{"text": "  "}); !res.IsError {
+		t.Error("empty text should be rejected")
+	}
+}
+
+func TestLockedChunk(t *testing.T) {
+	ctx := context.Background()
+	s := setupTestServer(t)
+	chunk, _ := s.db.CreateChunk(ctx, "reference material", nil)
+	s.db.SetChunkLocked(ctx, chunk.ID, true)
+
+	tool := func(name string, args map[string]any) (CallToolResult, map[string]any) {
+		t.Helper()
+		var callResult CallToolResult
+		json.Unmarshal(call(t, s, "tools/call", map[string]any{"name": name, "arguments": args}), &callResult)
+		data, _ := json.Marshal(callResult.StructuredContent)
+		var out map[string]any
+		json.Unmarshal(data, &out)
+		return callResult, out
+	}
+	denied := func(res CallToolResult) bool {
+		return res.IsError && strings.HasPrefix(res.Content[0].Text, "PERMISSION_DENIED")
+	}
+
+	if res, _ := tool("update_chunk", map[string]any{"chunk_id": chunk.ID, "content": "rewritten"}); !denied(res) {
+		t.Errorf("update_chunk of a locked chunk = %+v", res)
+	}
+	if res, _ := tool("delete_chunk", map[string]any{"chunk_id": chunk.ID}); !denied(res) {
+		t.Errorf("delete_chunk of a locked chunk = %+v", res)
+	}
+	if _, err := s.AddAttachment(context.Background(), chunk.ID, "x.txt", "text/plain", []byte("x")); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("AddAttachment to a locked chunk: err = %v", err)
+	}
+	if c, _ := s.db.GetChunk(ctx, chunk.ID); c == nil || c.Content != "reference material" {
+		t.Errorf("locked chunk changed: %+v", c)
+	}
+	if _, out := tool("get_chunk", map[string]any{"chunk_id": chunk.ID}); out["locked"] != true {
+		t.Errorf("get_chunk locked = %v, want true", out["locked"])
+	}
+
+	s.db.SetChunkLocked(ctx, chunk.ID, false)
+	if res, _ := tool("update_chunk", map[string]any{"chunk_id": chunk.ID, "content": "rewritten"}); res.IsError {
+		t.Errorf("update_chunk after unlock: %s", res.Content[0].Text)
+	}
+}
+
+// lockingEmbedder locks a chunk while it embeds, as an admin would
+// meanwhile.
+type lockingEmbedder struct {
+	mockEmbedder
+	db *storage.DB
+	id string
+}
+
+func (e *lockingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if e.id != "" {
+		e.db.SetChunkLocked(ctx, e.id, true)
+	}
+	return e.mockEmbedder.Embed(ctx, texts)
+}
+
+func TestLockedWhileEmbedding(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	db, _ := storage.Open(filepath.Join(dir, "test.db"))
+	db.Migrate()
+	t.Cleanup(func() { db.Close() })
+	embedder := &lockingEmbedder{mockEmbedder: mockEmbedder{embedding: []float32{1, 0, 0}}, db: db}
+	s := NewServer(db, embedder, vector.NewIndex())
+	chunk, _ := db.CreateChunk(ctx, "reference material", nil)
+	embedder.id = chunk.ID
+
+	var callResult CallToolResult
+	json.Unmarshal(call(t, s, "tools/call", map[string]any{
+		"name":      "update_chunk",
+		"arguments": map[string]any{"chunk_id": chunk.ID, "content": "rewritten"},
+	}), &callResult)
+	if !callResult.IsError || !strings.HasPrefix(callResult.Content[0].Text, "PERMISSION_DENIED") {
+		t.Errorf("update_chunk locked while embedding = %+v", callResult)
+	}
+	if c, _ := db.GetChunk(ctx, chunk.ID); c == nil || c.Content != "reference material" {
+		t.Errorf("chunk locked while embedding changed: %+v", c)
+	}
+}
@@ -0,0 +1,127 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/neoden/mykb/storage"
+)
+
+// DefaultSessionWindow is the longest pause within one capture session.
+const DefaultSessionWindow = 30 * time.Minute
+
+// maxSessionChunks bounds how many chunks get_session_chunks returns.
+const maxSessionChunks = 100
+
+// stdioClient names the client of a stdio server.
+const stdioClient = "stdio"
+
+// SessionConfig controls capture sessions: chunks stored by the same
+// client in quick succession, found with get_session_chunks.
+type SessionConfig struct {
+	// Enabled records which client stores each chunk.
+	Enabled bool `toml:"enabled"`
+	// WindowMinutes is the longest pause between chunks of one session (default 30).
+	WindowMinutes int `toml:"window_minutes"`
+}
+
+// Window returns the longest pause within a session.
+func (c SessionConfig) Window() time.Duration {
+	if c.WindowMinutes > 0 {
+		return time.Duration(c.WindowMinutes) * time.Minute
+	}
+	return DefaultSessionWindow
+}
+
+type clientKey struct{}
+
+// WithClient returns ctx carrying the ID of the client making requests,
+// recorded with the chunks it stores.
+func WithClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+func clientFrom(ctx context.Context) string {
+	client, _ := ctx.Value(clientKey{}).(string)
+	return client
+}
+
+// recordClient attributes a newly stored chunk to the calling client.
+// Failures only cost the chunk its session, so they are logged.
+func (s *Server) recordClient(ctx context.Context, chunkID string) {
+	if !s.config.Sessions.Enabled {
+		return
+	}
+	if err := s.db.SetChunkClient(ctx, chunkID, clientFrom(ctx)); err != nil {
+		log.Printf("Record client of chunk %s: %v", chunkID, err)
+	}
+}
+
+func (s *Server) toolGetSessionChunks(ctx context.Context, args json.RawMessage) (any, error) {
+	if !s.config.Sessions.Enabled {
+		return nil, fmt.Errorf("capture sessions not enabled")
+	}
+
+	var params struct {
+		ChunkID       string `json:"chunk_id"`
+		WindowMinutes int    `json:"window_minutes"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if params.ChunkID == "" {
+		return nil, fmt.Errorf("chunk_id is required")
+	}
+	window := s.config.Sessions.Window()
+	if params.WindowMinutes > 0 {
+		window = time.Duration(params.WindowMinutes) * time.Minute
+	}
+
+	session, err := s.db.CaptureSession(ctx, params.ChunkID, window)
+	if errors.Is(err, storage.ErrChunkNotFound) {
+		return map[string]any{"found": false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	type sessionChunk struct {
+		ID        string          `json:"id"`
+		CreatedAt time.Time       `json:"created_at"`
+		Content   string          `json:"content"`
+		Metadata  json.RawMessage `json:"metadata,omitempty"`
+		Truncated bool            `json:"truncated,omitempty"`
+	}
+
+	output := make([]sessionChunk, 0, min(len(session.ChunkIDs), maxSessionChunks))
+	for _, id := range session.ChunkIDs {
+		if len(output) == maxSessionChunks {
+			break
+		}
+		chunk, err := s.db.GetChunk(ctx, id)
+		if err != nil {
+			continue // deleted meanwhile
+		}
+		content, truncated := storage.Truncate(chunk.Content, storage.SearchPreviewLength)
+		output = append(output, sessionChunk{
+			ID:        id,
+			CreatedAt: chunk.CreatedAt,
+			Content:   content,
+			Metadata:  chunk.Metadata,
+			Truncated: truncated,
+		})
+	}
+
+	return map[string]any{
+		"results": output,
+		"count":   len(output),
+		"total":   len(session.ChunkIDs),
+		"client":  session.Client,
+		"start":   session.Start,
+		"end":     session.End,
+	}, nil
+}
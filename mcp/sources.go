@@ -0,0 +1,123 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/neoden/mykb/storage"
+)
+
+// documentSource returns the ID of the source record for an ingested
+// document named name, creating it with the document's title if needed.
+func (s *Server) documentSource(ctx context.Context, name, title string) (string, error) {
+	src, err := s.db.FindSource(ctx, name)
+	if err == nil {
+		return src.ID, nil
+	}
+	if !errors.Is(err, storage.ErrSourceNotFound) {
+		return "", err
+	}
+	var meta json.RawMessage
+	if title != "" {
+		if meta, err = json.Marshal(map[string]string{"title": title}); err != nil {
+			return "", err
+		}
+	}
+	src, err = s.db.CreateSource(ctx, name, meta)
+	if err != nil {
+		return "", err
+	}
+	return src.ID, nil
+}
+
+// checkSource returns an error unless id is empty or names a source.
+func (s *Server) checkSource(ctx context.Context, id string) error {
+	if id == "" {
+		return nil
+	}
+	if _, err := s.db.GetSource(ctx, id); errors.Is(err, storage.ErrSourceNotFound) {
+		return fmt.Errorf("source %s not found", id)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) toolStoreSource(ctx context.Context, args json.RawMessage) (any, error) {
+	var params struct {
+		SourceID string          `json:"source_id"`
+		Name     *string         `json:"name"`
+		Metadata json.RawMessage `json:"metadata"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if params.Name != nil && *params.Name == "" {
+		return nil, fmt.Errorf("name must not be empty")
+	}
+
+	if params.SourceID == "" {
+		if params.Name == nil {
+			return nil, fmt.Errorf("name is required")
+		}
+		return s.db.CreateSource(ctx, *params.Name, params.Metadata)
+	}
+	src, err := s.db.UpdateSource(ctx, params.SourceID, params.Name, params.Metadata)
+	if errors.Is(err, storage.ErrSourceNotFound) {
+		return map[string]any{"found": false}, nil
+	}
+	return src, err
+}
+
+func (s *Server) toolListSources(ctx context.Context, _ json.RawMessage) (any, error) {
+	sources, err := s.db.ListSources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"sources": sources, "count": len(sources)}, nil
+}
+
+func (s *Server) toolGetChunksBySource(ctx context.Context, args json.RawMessage) (any, error) {
+	var params struct {
+		SourceID string `json:"source_id"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if params.SourceID == "" {
+		return nil, fmt.Errorf("source_id is required")
+	}
+
+	src, err := s.db.GetSource(ctx, params.SourceID)
+	if errors.Is(err, storage.ErrSourceNotFound) {
+		return map[string]any{"found": false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := s.db.GetChunksBySource(ctx, src.ID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"source": src, "chunks": chunks, "count": len(chunks)}, nil
+}
+
+func (s *Server) toolDeleteSource(ctx context.Context, args json.RawMessage) (any, error) {
+	var params struct {
+		SourceID string `json:"source_id"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if params.SourceID == "" {
+		return nil, fmt.Errorf("source_id is required")
+	}
+
+	deleted, err := s.db.DeleteSource(ctx, params.SourceID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]bool{"deleted": deleted}, nil
+}
@@ -5,8 +5,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
+	"sort"
+	"time"
 
+	"github.com/neoden/mykb/embedding"
+	"github.com/neoden/mykb/events"
 	"github.com/neoden/mykb/storage"
+	"github.com/neoden/mykb/vector"
 )
 
 // Tool definitions for tools/list
@@ -26,6 +32,18 @@ var toolDefinitions = []Tool{
 					Type:        "object",
 					Description: "Optional metadata dict. Must be flat: only scalar values or arrays of scalars.",
 				},
+				"source_id": {
+					Type:        "string",
+					Description: "Optional ID of the source (from store_source) the chunk comes from",
+				},
+				"enrich": {
+					Type:        "boolean",
+					Description: "Have the language model suggest a title, a one-line summary and tags, stored in metadata as auto:title, auto:summary and auto:tags. Defaults to the server's [enrich] setting.",
+				},
+				"unfurl": {
+					Type:        "boolean",
+					Description: "Fetch the web pages linked in content and store their text as context chunks (url, title and unfurled_from metadata), returned as unfurled. Defaults to the server's [unfurl] setting.",
+				},
 			},
 			Required: []string{"content"},
 		},
@@ -33,22 +51,77 @@ var toolDefinitions = []Tool{
 			ReadOnlyHint: false,
 		},
 	},
+	{
+		Name:        "ingest_document",
+		Title:       "Ingest Document",
+		Description: "Store a whole document (markdown, HTML, plain text, or a PDF by url) as overlapping chunks. Each chunk's metadata links it back to the document: source, title, offset and length (byte range in the extracted text), part and parts, and page for PDFs. The chunks also reference a source record for the document (see list_sources), returned as source_id. Pass either content or a url to fetch.",
+		InputSchema: InputSchema{
+			Type: "object",
+			Properties: map[string]Property{
+				"content": {
+					Type:        "string",
+					Description: "The document text",
+				},
+				"url": {
+					Type:        "string",
+					Description: "An http(s) URL to fetch instead of content (may be a PDF)",
+				},
+				"format": {
+					Type:        "string",
+					Description: "markdown, html or text (inferred when omitted)",
+				},
+				"source": {
+					Type:        "string",
+					Description: "Name of the original document, stored as source metadata (e.g. a file path)",
+				},
+				"metadata": {
+					Type:        "object",
+					Description: "Optional metadata added to every chunk. Must be flat.",
+				},
+			},
+		},
+		Annotations: &ToolAnnotations{
+			ReadOnlyHint: false,
+		},
+	},
 	{
 		Name:        "search_chunks",
 		Title:       "Search Chunks",
-		Description: "Full-text search across all stored chunks. Returns truncated content (first 80 chars). Use get_chunk(id) to retrieve full content.",
+		Description: "Full-text search across all stored chunks. Returns a content preview (about 80 chars, cut at a markdown-safe boundary; truncated=true when shortened). Use get_chunk(id) to retrieve full content.",
 		InputSchema: InputSchema{
 			Type: "object",
 			Properties: map[string]Property{
 				"query": {
 					Type:        "string",
-					Description: "Search query (supports FTS5 syntax)",
+					Description: "Search query (supports FTS5 syntax; a query it cannot parse is searched for its words)",
+				},
+				"match_mode": {
+					Type:        "string",
+					Description: "How words match: exact (default, FTS5 syntax), prefix (words starting with each query word), or fuzzy (partial words and typos, ranked by shared trigrams; needs [search] trigram)",
+					Default:     "exact",
+					Enum:        []string{"exact", "prefix", "fuzzy"},
 				},
 				"limit": {
 					Type:        "integer",
 					Description: "Maximum results to return",
 					Default:     20,
 				},
+				"boost_central": {
+					Type:        "boolean",
+					Description: "Rank chunks that many notes link to higher",
+				},
+				"boost_recent": {
+					Type:        "boolean",
+					Description: "Rank recently updated chunks higher when relevance is close",
+				},
+				"rerank": {
+					Type:        "boolean",
+					Description: "Reorder the best results with the configured reranker model (default true when one is configured)",
+				},
+				"facet": {
+					Type:        "string",
+					Description: "Also count the results by the values of this metadata key",
+				},
 			},
 			Required: []string{"query"},
 		},
@@ -59,7 +132,7 @@ var toolDefinitions = []Tool{
 	{
 		Name:        "get_chunk",
 		Title:       "Get Chunk",
-		Description: "Get a specific chunk by ID with full content. Use this after search_chunks() to retrieve the complete content.",
+		Description: "Get a specific chunk by ID with full content. Use this after search_chunks() to retrieve the complete content. Includes embedding_status (fresh, stale, missing, wrong_model) when semantic search is configured, the source the chunk comes from, if any, and its attachments, whose data is read as the resource at each uri.",
 		InputSchema: InputSchema{
 			Type: "object",
 			Properties: map[string]Property{
@@ -93,6 +166,10 @@ var toolDefinitions = []Tool{
 					Type:        "object",
 					Description: "New metadata (optional). Must be flat.",
 				},
+				"source_id": {
+					Type:        "string",
+					Description: "New source ID (optional); an empty string detaches the chunk from its source",
+				},
 			},
 			Required: []string{"chunk_id"},
 		},
@@ -160,10 +237,188 @@ var toolDefinitions = []Tool{
 			ReadOnlyHint: true,
 		},
 	},
+	{
+		Name:        "count_chunks",
+		Title:       "Count Chunks",
+		Description: "Count the chunks matching a metadata filter and creation time range, without fetching them, optionally grouped by the values of a metadata key. For example, {\"metadata\": {\"type\": \"meeting\"}, \"created_after\": \"2026-03-01\", \"created_before\": \"2026-04-01\"} counts March's meeting notes.",
+		InputSchema: InputSchema{
+			Type: "object",
+			Properties: map[string]Property{
+				"metadata": {
+					Type:        "object",
+					Description: "Only count chunks whose metadata has these key/value pairs (an array matches if it contains the value)",
+				},
+				"created_after": {
+					Type:        "string",
+					Description: "Only count chunks created at or after this date (YYYY-MM-DD, UTC) or RFC 3339 time",
+				},
+				"created_before": {
+					Type:        "string",
+					Description: "Only count chunks created before this date (YYYY-MM-DD, UTC) or RFC 3339 time",
+				},
+				"facet": {
+					Type:        "string",
+					Description: "Also count the matching chunks by the values of this metadata key",
+				},
+				"top_n": {
+					Type:        "integer",
+					Description: "Maximum number of facet values to return",
+					Default:     50,
+				},
+			},
+		},
+		Annotations: &ToolAnnotations{
+			ReadOnlyHint: true,
+		},
+	},
+	{
+		Name:        "sample_chunks",
+		Title:       "Sample Chunks",
+		Description: "Return random chunks, optionally only those matching a metadata filter, for review prompts (spaced repetition) or spot-checking the knowledge base's quality.",
+		InputSchema: InputSchema{
+			Type: "object",
+			Properties: map[string]Property{
+				"n": {
+					Type:        "integer",
+					Description: "How many chunks to return (at most 100)",
+					Default:     5,
+				},
+				"metadata": {
+					Type:        "object",
+					Description: "Only sample chunks whose metadata has these key/value pairs (an array matches if it contains the value)",
+				},
+				"weight_recent": {
+					Type:        "boolean",
+					Description: "Favour recently updated chunks: one updated a ranking half-life (30 days by default) ago is half as likely as one updated now",
+				},
+			},
+		},
+		Annotations: &ToolAnnotations{
+			ReadOnlyHint: true,
+		},
+	},
+	{
+		Name:        "get_review_queue",
+		Title:       "Get Review Queue",
+		Description: "Get the chunks due for review under the configured policy: past the date in their due metadata key (spaced repetition), left unread and unchanged for a while, or never read. Reading a chunk with get_chunk takes it off the queue until it is due again.",
+		InputSchema: InputSchema{
+			Type: "object",
+			Properties: map[string]Property{
+				"limit": {
+					Type:        "integer",
+					Description: "Maximum chunks to return (default from [review], 20)",
+				},
+			},
+		},
+		Annotations: &ToolAnnotations{
+			ReadOnlyHint: true,
+		},
+	},
+	{
+		Name:        "append_daily_note",
+		Title:       "Append to Daily Note",
+		Description: "Log text to the day's journal: one chunk per calendar day (in the server's [daily] time zone) with daily_note metadata holding the date, created on the first append. Entries of today are prefixed with the time.",
+		InputSchema: InputSchema{
+			Type: "object",
+			Properties: map[string]Property{
+				"text": {
+					Type:        "string",
+					Description: "The entry to append",
+				},
+				"date": {
+					Type:        "string",
+					Description: "The day: YYYY-MM-DD, today or yesterday (default today)",
+				},
+			},
+			Required: []string{"text"},
+		},
+	},
+	{
+		Name:        "get_daily_note",
+		Title:       "Get Daily Note",
+		Description: "Get the daily note (journal chunk) of a day, kept by append_daily_note.",
+		InputSchema: InputSchema{
+			Type: "object",
+			Properties: map[string]Property{
+				"date": {
+					Type:        "string",
+					Description: "The day: YYYY-MM-DD, today or yesterday (default today)",
+				},
+			},
+		},
+		Annotations: &ToolAnnotations{
+			ReadOnlyHint: true,
+		},
+	},
+	{
+		Name:        "get_entities",
+		Title:       "Get Entities",
+		Description: "List the people, projects and dates extracted from chunks (with [entities] enabled), the most mentioned first, with how many chunks mention each. With chunk_id, list the entities of that chunk. Filter semantic_search by one with entity.",
+		InputSchema: InputSchema{
+			Type: "object",
+			Properties: map[string]Property{
+				"kind": {
+					Type:        "string",
+					Description: "Only entities of this kind",
+					Enum:        storage.EntityKinds,
+				},
+				"query": {
+					Type:        "string",
+					Description: "Only entities whose name contains this text (case-insensitive)",
+				},
+				"chunk_id": {
+					Type:        "string",
+					Description: "List the entities of this chunk instead",
+				},
+				"include_chunks": {
+					Type:        "boolean",
+					Description: "Also return the IDs of the chunks mentioning each entity",
+				},
+				"limit": {
+					Type:        "integer",
+					Description: "Maximum entities to return",
+					Default:     50,
+				},
+			},
+		},
+		Annotations: &ToolAnnotations{
+			ReadOnlyHint: true,
+		},
+	},
+	{
+		Name:        "get_usage_report",
+		Title:       "Get Usage Report",
+		Description: "Report how chunks are used, to guide cleanup: the most read (with get_chunk), the most linked to with [[chunk-id]], and those never read nor linked to, oldest first.",
+		InputSchema: InputSchema{
+			Type: "object",
+			Properties: map[string]Property{
+				"limit": {
+					Type:        "integer",
+					Description: "Maximum chunks in each list",
+					Default:     20,
+				},
+			},
+		},
+		Annotations: &ToolAnnotations{
+			ReadOnlyHint: true,
+		},
+	},
+	{
+		Name:        "get_stats",
+		Title:       "Get Stats",
+		Description: "Get the size of the knowledge base: chunk count, total content size, chunks per metadata key, embedding coverage per model, database and full-text index size, and the oldest and newest chunk times.",
+		InputSchema: InputSchema{
+			Type:       "object",
+			Properties: map[string]Property{},
+		},
+		Annotations: &ToolAnnotations{
+			ReadOnlyHint: true,
+		},
+	},
 	{
 		Name:        "semantic_search",
 		Title:       "Semantic Search",
-		Description: "Search chunks by semantic similarity using vector embeddings. Returns chunks most similar in meaning to the query.",
+		Description: "Search chunks by semantic similarity using vector embeddings. Returns chunks most similar in meaning to the query, each with a score from 0 to 1: 1 for the same meaning, around 0.5 for unrelated text.",
 		InputSchema: InputSchema{
 			Type: "object",
 			Properties: map[string]Property{
@@ -176,6 +431,43 @@ var toolDefinitions = []Tool{
 					Description: "Maximum results to return",
 					Default:     10,
 				},
+				"min_score": {
+					Type:        "number",
+					Description: "Drop results scoring below this, from 0 to 1 (default 0, keep all)",
+				},
+				"mmr_lambda": {
+					Type:        "number",
+					Description: "Diversify results by Maximal Marginal Relevance: from 1 (relevance only) to 0 (variety only); 0.5 to 0.7 skips near-duplicates of the same note. Off by default",
+				},
+				"boost_central": {
+					Type:        "boolean",
+					Description: "Rank chunks that many notes link to higher",
+				},
+				"boost_recent": {
+					Type:        "boolean",
+					Description: "Rank recently updated chunks higher when relevance is close",
+				},
+				"rerank": {
+					Type:        "boolean",
+					Description: "Reorder the best results with the configured reranker model (default true when one is configured)",
+				},
+				"metadata": {
+					Type:        "object",
+					Description: "Only search chunks whose metadata has these key/value pairs (an array matches if it contains the value)",
+				},
+				"entity": {
+					Type:        "string",
+					Description: "Only search chunks mentioning this entity (a person, project or YYYY-MM-DD date, as listed by get_entities; case-insensitive)",
+				},
+				"entity_kind": {
+					Type:        "string",
+					Description: "The kind of entity, if the name is ambiguous",
+					Enum:        storage.EntityKinds,
+				},
+				"facet": {
+					Type:        "string",
+					Description: "Also count the results by the values of this metadata key",
+				},
 			},
 			Required: []string{"query"},
 		},
@@ -183,6 +475,176 @@ var toolDefinitions = []Tool{
 			ReadOnlyHint: true,
 		},
 	},
+	{
+		Name:        "similar_chunks",
+		Title:       "Similar Chunks",
+		Description: "Find the chunks most similar in meaning to a stored chunk, by its embedding (\"more like this\"), without embedding a query. Scores run from 0 to 1 as in semantic_search.",
+		InputSchema: InputSchema{
+			Type: "object",
+			Properties: map[string]Property{
+				"chunk_id": {
+					Type:        "string",
+					Description: "The UUID of the chunk to find similar ones to",
+				},
+				"limit": {
+					Type:        "integer",
+					Description: "Maximum results to return",
+					Default:     10,
+				},
+				"min_score": {
+					Type:        "number",
+					Description: "Drop results scoring below this, from 0 to 1 (default 0, keep all)",
+				},
+			},
+			Required: []string{"chunk_id"},
+		},
+		Annotations: &ToolAnnotations{
+			ReadOnlyHint: true,
+		},
+	},
+	{
+		Name:        "get_session_chunks",
+		Title:       "Get Session Chunks",
+		Description: "Get the chunks stored in the same capture session as a chunk: by the same client, each within the session window (default 30 minutes) of the previous one. Useful to recover related notes that were never tagged. Requires [sessions] enabled.",
+		InputSchema: InputSchema{
+			Type: "object",
+			Properties: map[string]Property{
+				"chunk_id": {
+					Type:        "string",
+					Description: "The UUID of any chunk in the session",
+				},
+				"window_minutes": {
+					Type:        "integer",
+					Description: "Longest pause between chunks of the session (default from config)",
+				},
+			},
+			Required: []string{"chunk_id"},
+		},
+		Annotations: &ToolAnnotations{
+			ReadOnlyHint: true,
+		},
+	},
+	{
+		Name:        "most_central_chunks",
+		Title:       "Most Central Chunks",
+		Description: "List the hub notes of the knowledge graph: chunks ranked by PageRank over [[chunk-id]] links between chunks. Score 1 is an average chunk. Only chunks with backlinks are listed.",
+		InputSchema: InputSchema{
+			Type: "object",
+			Properties: map[string]Property{
+				"limit": {
+					Type:        "integer",
+					Description: "Maximum results to return",
+					Default:     10,
+				},
+			},
+		},
+		Annotations: &ToolAnnotations{
+			ReadOnlyHint: true,
+		},
+	},
+	{
+		Name:        "store_source",
+		Title:       "Store Source",
+		Description: "Create or update a source: a book, article, conversation or other document that chunks come from. Source-level metadata (author, url, type...) is kept here once instead of on every chunk. Omit source_id to create a source; pass it to update one. Reference the source with store_chunk(source_id).",
+		InputSchema: InputSchema{
+			Type: "object",
+			Properties: map[string]Property{
+				"source_id": {
+					Type:        "string",
+					Description: "The UUID of the source to update (omit to create one)",
+				},
+				"name": {
+					Type:        "string",
+					Description: "Name of the source, e.g. a title (required to create)",
+				},
+				"metadata": {
+					Type:        "object",
+					Description: "Source metadata (optional). Replaces existing metadata on update.",
+				},
+			},
+		},
+		Annotations: &ToolAnnotations{
+			ReadOnlyHint: false,
+		},
+	},
+	{
+		Name:        "list_sources",
+		Title:       "List Sources",
+		Description: "List all sources with their metadata and number of chunks, ordered by name.",
+		InputSchema: InputSchema{
+			Type:       "object",
+			Properties: map[string]Property{},
+		},
+		Annotations: &ToolAnnotations{
+			ReadOnlyHint: true,
+		},
+	},
+	{
+		Name:        "get_chunks_by_source",
+		Title:       "Get Chunks by Source",
+		Description: "Get a source and all chunks referencing it, oldest first, with full content.",
+		InputSchema: InputSchema{
+			Type: "object",
+			Properties: map[string]Property{
+				"source_id": {
+					Type:        "string",
+					Description: "The UUID of the source",
+				},
+			},
+			Required: []string{"source_id"},
+		},
+		Annotations: &ToolAnnotations{
+			ReadOnlyHint: true,
+		},
+	},
+	{
+		Name:        "delete_source",
+		Title:       "Delete Source",
+		Description: "Delete a source by ID. Its chunks are kept and no longer reference a source.",
+		InputSchema: InputSchema{
+			Type: "object",
+			Properties: map[string]Property{
+				"source_id": {
+					Type:        "string",
+					Description: "The UUID of the source to delete",
+				},
+			},
+			Required: []string{"source_id"},
+		},
+		Annotations: &ToolAnnotations{
+			ReadOnlyHint:    false,
+			DestructiveHint: true,
+		},
+	},
+	{
+		Name:        "create_child_token",
+		Title:       "Create Child Token",
+		Description: "Mint a short-lived access token restricted to the given tools, to hand to a sub-agent. The token cannot call tools this one can't, nor outlive it. Only available over HTTP.",
+		InputSchema: InputSchema{
+			Type: "object",
+			Properties: map[string]Property{
+				"tools": {
+					Type:        "array",
+					Description: "Tools the child token may call",
+					Items:       &Property{Type: "string"},
+				},
+				"ttl_minutes": {
+					Type:        "integer",
+					Description: "Lifetime in minutes (max 1440)",
+					Default:     15,
+				},
+				"name": {
+					Type:        "string",
+					Description: "Name identifying the sub-agent; its client ID becomes <your client>/<name>",
+					Default:     "child",
+				},
+			},
+			Required: []string{"tools"},
+		},
+		Annotations: &ToolAnnotations{
+			ReadOnlyHint: false,
+		},
+	},
 }
 
 // registerTools registers all tool handlers.
@@ -194,7 +656,24 @@ func (s *Server) registerTools() {
 	s.tools["delete_chunk"] = s.toolDeleteChunk
 	s.tools["get_metadata_index"] = s.toolGetMetadataIndex
 	s.tools["get_metadata_values"] = s.toolGetMetadataValues
+	s.tools["count_chunks"] = s.toolCountChunks
+	s.tools["sample_chunks"] = s.toolSampleChunks
+	s.tools["get_review_queue"] = s.toolGetReviewQueue
+	s.tools["get_usage_report"] = s.toolGetUsageReport
+	s.tools["get_entities"] = s.toolGetEntities
+	s.tools["append_daily_note"] = s.toolAppendDailyNote
+	s.tools["get_daily_note"] = s.toolGetDailyNote
+	s.tools["get_stats"] = s.toolGetStats
 	s.tools["semantic_search"] = s.toolSemanticSearch
+	s.tools["similar_chunks"] = s.toolSimilarChunks
+	s.tools["most_central_chunks"] = s.toolMostCentralChunks
+	s.tools["get_session_chunks"] = s.toolGetSessionChunks
+	s.tools["ingest_document"] = s.toolIngestDocument
+	s.tools["store_source"] = s.toolStoreSource
+	s.tools["list_sources"] = s.toolListSources
+	s.tools["get_chunks_by_source"] = s.toolGetChunksBySource
+	s.tools["delete_source"] = s.toolDeleteSource
+	s.tools["create_child_token"] = s.toolCreateChildToken
 }
 
 // Tool handlers
@@ -203,6 +682,9 @@ func (s *Server) toolStoreChunk(ctx context.Context, args json.RawMessage) (any,
 	var params struct {
 		Content  string          `json:"content"`
 		Metadata json.RawMessage `json:"metadata"`
+		SourceID string          `json:"source_id"`
+		Enrich   *bool           `json:"enrich"`
+		Unfurl   *bool           `json:"unfurl"`
 	}
 	if err := json.Unmarshal(args, &params); err != nil {
 		return nil, fmt.Errorf("invalid arguments: %w", err)
@@ -210,52 +692,115 @@ func (s *Server) toolStoreChunk(ctx context.Context, args json.RawMessage) (any,
 	if params.Content == "" {
 		return nil, fmt.Errorf("content is required")
 	}
+	if err := s.checkSource(ctx, params.SourceID); err != nil {
+		return nil, err
+	}
 
-	// If no embedder configured, create chunk without transaction
-	if s.embedder == nil {
-		return s.db.CreateChunk(params.Content, params.Metadata)
+	metadata := params.Metadata
+	var enrichError string
+	if params.Enrich != nil && *params.Enrich || params.Enrich == nil && s.config.Enrich.Enabled {
+		if params.Enrich != nil && s.config.LLM == nil {
+			return nil, ErrNoLLM
+		}
+		// The chunk is stored without suggestions if the model fails
+		if enriched, err := s.enrich(ctx, params.Content, metadata); err != nil {
+			log.Printf("WARNING: enrichment: %v", err)
+			enrichError = err.Error()
+		} else {
+			metadata = enriched
+		}
 	}
 
-	// Use transaction to ensure chunk and embedding are created atomically
-	tx, err := s.db.BeginTx(ctx)
+	chunk, deferred, err := s.storeChunk(ctx, params.Content, metadata, params.SourceID)
 	if err != nil {
-		return nil, fmt.Errorf("begin transaction: %w", err)
+		return nil, err
+	}
+	s.recordEntities(ctx, chunk)
+	var unfurled []Unfurled
+	if params.Unfurl != nil && *params.Unfurl || params.Unfurl == nil && s.config.Unfurl.Enabled {
+		unfurled = s.unfurl(ctx, chunk)
+	}
+	if deferred || len(unfurled) > 0 || enrichError != "" {
+		return struct {
+			*storage.Chunk
+			EmbeddingDeferred bool       `json:"embedding_deferred,omitempty"`
+			Unfurled          []Unfurled `json:"unfurled,omitempty"`
+			EnrichError       string     `json:"enrich_error,omitempty"`
+		}{chunk, deferred, unfurled, enrichError}, nil
+	}
+	return chunk, nil
+}
+
+// storeChunk creates a chunk, referencing sourceID unless it is empty,
+// and its embedding atomically. With DeferOnTimeout, a chunk whose
+// embedding timed out or was rate limited is committed without one
+// together with its place in the embedding queue, and deferred is true.
+func (s *Server) storeChunk(ctx context.Context, content string, metadata json.RawMessage, sourceID string) (chunk *storage.Chunk, deferred bool, err error) {
+	// Embed first: the transaction holds the write lock until it commits
+	text := embedding.Text(content, metadata, s.config.MetadataFields)
+	var vec []float32
+	var embedErr error
+	if s.embedder != nil {
+		vec, embedErr = s.embed(ctx, s.config.IngestTimeout, text, false)
+		var limited *embedding.RateLimitedError
+		deferred = (errors.Is(embedErr, context.DeadlineExceeded) || errors.As(embedErr, &limited)) && s.config.DeferOnTimeout
+		if embedErr != nil && !deferred {
+			return nil, false, fmt.Errorf("generate embedding: %w", embedErr)
+		}
 	}
-	defer tx.Rollback() // no-op if committed
 
-	chunk, err := tx.CreateChunk(params.Content, params.Metadata)
+	// Use transaction to ensure chunk, links, source and embedding are created atomically
+	tx, err := s.db.BeginTx(ctx)
 	if err != nil {
-		return nil, err
+		return nil, false, fmt.Errorf("begin transaction: %w", err)
 	}
+	defer tx.Rollback() // no-op if committed
 
-	// Generate embedding
-	vecs, err := s.embedder.Embed(ctx, []string{params.Content})
+	chunk, err = tx.CreateChunk(ctx, content, metadata)
 	if err != nil {
-		return nil, fmt.Errorf("generate embedding: %w", err)
+		return nil, false, err
 	}
-	if len(vecs) == 0 {
-		return nil, fmt.Errorf("no embedding returned")
+	if sourceID != "" {
+		if err := tx.SetChunkSource(ctx, chunk.ID, sourceID); err != nil {
+			return nil, false, err
+		}
 	}
-
-	// Save embedding
-	if err := tx.SaveEmbedding(chunk.ID, s.embedder.Model(), vecs[0]); err != nil {
-		return nil, fmt.Errorf("save embedding: %w", err)
+	switch {
+	case deferred:
+		// Keep the chunk; the embedding queue retries once the provider recovers
+		if err := tx.QueueEmbedding(ctx, chunk.ID, embedErr.Error()); err != nil {
+			return nil, false, err
+		}
+	case s.embedder != nil:
+		if err := tx.SaveEmbedding(ctx, chunk.ID, s.embedder.Model(), text, vec); err != nil {
+			return nil, false, fmt.Errorf("save embedding: %w", err)
+		}
 	}
-
 	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("commit: %w", err)
+		return nil, false, fmt.Errorf("commit: %w", err)
 	}
 
 	// Add to in-memory index after successful commit
-	s.index.Add(chunk.ID, vecs[0])
-
-	return chunk, nil
+	if s.embedder != nil && !deferred {
+		s.index.Add(chunk.ID, vec)
+	}
+	if deferred {
+		log.Printf("Embedding deferred for chunk %s: %v", chunk.ID, embedErr)
+	}
+	s.recordClient(ctx, chunk.ID)
+	s.publishChunk(ctx, events.ChunkCreated, chunk.ID, chunk)
+	return chunk, deferred, nil
 }
 
-func (s *Server) toolSearchChunks(_ context.Context, args json.RawMessage) (any, error) {
+func (s *Server) toolSearchChunks(ctx context.Context, args json.RawMessage) (any, error) {
 	var params struct {
-		Query string `json:"query"`
-		Limit int    `json:"limit"`
+		Query        string `json:"query"`
+		Limit        int    `json:"limit"`
+		BoostCentral bool   `json:"boost_central"`
+		BoostRecent  bool   `json:"boost_recent"`
+		Rerank       *bool  `json:"rerank"`
+		MatchMode    string `json:"match_mode"`
+		Facet        string `json:"facet"`
 	}
 	if err := json.Unmarshal(args, &params); err != nil {
 		return nil, fmt.Errorf("invalid arguments: %w", err)
@@ -263,23 +808,102 @@ func (s *Server) toolSearchChunks(_ context.Context, args json.RawMessage) (any,
 	if params.Query == "" {
 		return nil, fmt.Errorf("query is required")
 	}
+	mode := storage.MatchMode(params.MatchMode)
+	switch mode {
+	case "":
+		mode = storage.MatchExact
+	case storage.MatchExact, storage.MatchPrefix, storage.MatchFuzzy:
+	default:
+		return nil, fmt.Errorf("match_mode must be exact, prefix or fuzzy")
+	}
+
+	boost := boosts{central: params.BoostCentral, recent: params.BoostRecent}
+	reranked := s.reranks(params.Rerank)
+	if !boost.any() && !reranked {
+		results, err := s.db.SearchChunksMatching(ctx, params.Query, params.Limit, mode)
+		if err != nil {
+			return nil, err
+		}
+		return s.withFacet(ctx, searchResponse(params.Query, results), params.Facet, resultIDs(results))
+	}
 
-	results, err := s.db.SearchChunks(params.Query, params.Limit)
+	if params.Limit <= 0 {
+		params.Limit = 20
+	}
+	limit := params.Limit
+	if reranked {
+		limit = s.rerankLimit(limit)
+	}
+	fetch := limit
+	if boost.any() {
+		fetch *= boostCandidates
+	}
+	candidates, err := s.db.SearchChunksMatching(ctx, params.Query, fetch, mode)
 	if err != nil {
 		return nil, err
 	}
+	if boost.any() {
+		ids := make([]string, len(candidates))
+		for i, r := range candidates {
+			ids[i] = r.ID
+		}
+		order, err := s.boostOrder(ctx, ids, reciprocalRank, boost)
+		if err != nil {
+			return nil, err
+		}
+		boosted := make([]storage.SearchResult, 0, limit)
+		for _, i := range order {
+			if len(boosted) == limit {
+				break
+			}
+			boosted = append(boosted, candidates[i])
+		}
+		candidates = boosted
+	}
+
+	// Results hold previews, so the reranker reads the full chunks
+	if reranked {
+		texts := make([]string, min(len(candidates), s.config.RerankTopN))
+		for i := range texts {
+			texts[i] = candidates[i].Content
+			if chunk, err := s.db.GetChunk(ctx, candidates[i].ID); err == nil {
+				texts[i] = chunk.Content
+			}
+		}
+		if order, _, ok := s.rerankOrder(ctx, params.Query, texts); ok {
+			top := make([]storage.SearchResult, len(order))
+			for i, pos := range order {
+				top[i] = candidates[pos]
+			}
+			copy(candidates, top)
+		}
+	}
+	results := candidates[:min(len(candidates), params.Limit)]
+	return s.withFacet(ctx, searchResponse(params.Query, results), params.Facet, resultIDs(results))
+}
+
+func resultIDs(results []storage.SearchResult) []string {
+	ids := make([]string, len(results))
+	for i, r := range results {
+		ids[i] = r.ID
+	}
+	return ids
+}
+
+// searchResponse wraps full-text results for structuredContent.
+func searchResponse(query string, results []storage.SearchResult) map[string]any {
 	if results == nil {
 		results = []storage.SearchResult{}
 	}
 	// Wrap in object for structuredContent (must be object, not array)
 	return map[string]any{
 		"results": results,
-		"query":   params.Query,
+		"query":   query,
 		"count":   len(results),
-	}, nil
+	}
 }
 
-func (s *Server) toolGetChunk(_ context.Context, args json.RawMessage) (any, error) {
+func (s *Server) toolGetChunk(ctx context.Context, args json.RawMessage) (any, error) {
 	var params struct {
 		ChunkID string `json:"chunk_id"`
 	}
@@ -290,14 +914,59 @@ func (s *Server) toolGetChunk(_ context.Context, args json.RawMessage) (any, err
 		return nil, fmt.Errorf("chunk_id is required")
 	}
 
-	chunk, err := s.db.GetChunk(params.ChunkID)
+	chunk, err := s.db.GetChunk(ctx, params.ChunkID)
 	if errors.Is(err, storage.ErrChunkNotFound) {
 		return map[string]any{"found": false}, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	return chunk, nil
+	// Takes the chunk off the review queue until it is due again
+	if err := s.db.RecordAccess(ctx, chunk.ID); err != nil {
+		log.Printf("WARNING: %v", err)
+	}
+
+	result := chunkWithStatus{Chunk: chunk}
+	if result.Source, err = s.db.ChunkSource(ctx, chunk.ID); err != nil {
+		return nil, err
+	}
+	attachments, err := s.db.ListAttachments(ctx, chunk.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range attachments {
+		result.Attachments = append(result.Attachments, attachmentRef{Attachment: a, URI: AttachmentURI(a.ID)})
+	}
+	if result.Entities, err = s.db.ChunkEntities(ctx, chunk.ID); err != nil {
+		return nil, err
+	}
+	if result.Locked, err = s.db.ChunkLocked(ctx, chunk.ID); err != nil {
+		return nil, err
+	}
+	if s.embedder != nil {
+		status, err := s.db.EmbeddingStatus(ctx, chunk.ID, s.embedder.Model(), s.config.MetadataFields)
+		if err != nil {
+			return nil, err
+		}
+		result.EmbeddingStatus = status
+	}
+	return result, nil
+}
+
+// chunkWithStatus is a chunk annotated with its embedding freshness and
+// source.
+type chunkWithStatus struct {
+	*storage.Chunk
+	// EmbeddingStatus is fresh, stale, missing or wrong_model; omitted if no embedder is configured.
+	EmbeddingStatus string `json:"embedding_status,omitempty"`
+	// Source is the source the chunk references, if any.
+	Source *storage.Source `json:"source,omitempty"`
+	// Attachments are the files attached to the chunk.
+	Attachments []attachmentRef `json:"attachments,omitempty"`
+	// Entities are the people, projects and dates the chunk mentions.
+	Entities []storage.Entity `json:"entities,omitempty"`
+	// Locked chunks cannot be updated or deleted by clients.
+	Locked bool `json:"locked,omitempty"`
 }
 
 func (s *Server) toolUpdateChunk(ctx context.Context, args json.RawMessage) (any, error) {
@@ -305,6 +974,7 @@ func (s *Server) toolUpdateChunk(ctx context.Context, args json.RawMessage) (any
 		ChunkID  string          `json:"chunk_id"`
 		Content  *string         `json:"content"`
 		Metadata json.RawMessage `json:"metadata"`
+		SourceID *string         `json:"source_id"`
 	}
 	if err := json.Unmarshal(args, &params); err != nil {
 		return nil, fmt.Errorf("invalid arguments: %w", err)
@@ -312,58 +982,171 @@ func (s *Server) toolUpdateChunk(ctx context.Context, args json.RawMessage) (any
 	if params.ChunkID == "" {
 		return nil, fmt.Errorf("chunk_id is required")
 	}
-
-	// If no content change or no embedder, update without transaction
-	if params.Content == nil || s.embedder == nil {
-		chunk, err := s.db.UpdateChunk(params.ChunkID, params.Content, params.Metadata)
-		if errors.Is(err, storage.ErrChunkNotFound) {
-			return map[string]any{"found": false}, nil
+	if params.SourceID != nil {
+		if err := s.checkSource(ctx, *params.SourceID); err != nil {
+			return nil, err
 		}
+	}
+
+	chunk, err := s.updateChunk(ctx, params.ChunkID, params.Content, params.Metadata, params.SourceID)
+	if errors.Is(err, storage.ErrChunkNotFound) {
+		return map[string]any{"found": false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return chunk, nil
+}
+
+// updateChunk updates a chunk, and its embedding atomically when the
+// embedded text changes. A non-nil sourceID sets the chunk's source, empty
+// detaching it.
+func (s *Server) updateChunk(ctx context.Context, id string, content *string, metadata json.RawMessage, sourceID *string) (*storage.Chunk, error) {
+	if err := s.checkUnlocked(ctx, id); err != nil {
+		return nil, err
+	}
+	reembed, err := s.needsReembed(ctx, id, content, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	// Embed the updated text first: the transaction holds the write lock
+	// until it commits
+	var text string
+	var vec []float32
+	if reembed {
+		existing, err := s.db.GetChunk(ctx, id)
 		if err != nil {
 			return nil, err
 		}
-		return chunk, nil
+		if content != nil {
+			existing.Content = *content
+		}
+		if metadata != nil {
+			existing.Metadata = metadata
+		}
+		text = s.embedText(existing)
+		if vec, err = s.embed(ctx, s.config.IngestTimeout, text, false); err != nil {
+			return nil, fmt.Errorf("generate embedding: %w", err)
+		}
 	}
 
-	// Use transaction to ensure chunk and embedding are updated atomically
+	// Use transaction to ensure chunk, links, source and embedding are updated atomically
 	tx, err := s.db.BeginTx(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	chunk, err := tx.UpdateChunk(params.ChunkID, params.Content, params.Metadata)
-	if errors.Is(err, storage.ErrChunkNotFound) {
-		return map[string]any{"found": false}, nil
+	// Locked while embedding: the transaction now holds the write lock,
+	// so the lock cannot change before it commits
+	if err := checkUnlocked(ctx, tx, id); err != nil {
+		return nil, err
 	}
+	chunk, err := tx.UpdateChunk(ctx, id, content, metadata)
 	if err != nil {
 		return nil, err
 	}
+	if sourceID != nil {
+		if err := tx.SetChunkSource(ctx, chunk.ID, *sourceID); err != nil {
+			return nil, err
+		}
+	}
+	saved := false
+	if reembed {
+		if s.embedText(chunk) == text {
+			if err := tx.SaveEmbedding(ctx, chunk.ID, s.embedder.Model(), text, vec); err != nil {
+				return nil, fmt.Errorf("save embedding: %w", err)
+			}
+			saved = true
+		} else {
+			// Another update got in while embedding; the queue embeds the text committed
+			if err := tx.QueueEmbedding(ctx, chunk.ID, "chunk changed while embedding"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
 
-	// Re-generate embedding for new content
-	vecs, err := s.embedder.Embed(ctx, []string{*params.Content})
+	// Update in-memory index after successful commit
+	if saved {
+		s.index.Add(chunk.ID, vec)
+	}
+	if content != nil {
+		s.recordEntities(ctx, chunk)
+	}
+	s.publishChunk(ctx, events.ChunkUpdated, chunk.ID, chunk)
+	return chunk, nil
+}
+
+// embed generates one embedding, of a search query when query is set,
+// giving up after timeout (0 leaves the provider's own HTTP timeout in
+// charge).
+func (s *Server) embed(ctx context.Context, timeout time.Duration, text string, query bool) ([]float32, error) {
+	if query {
+		if vec, ok := s.queries.get(text); ok {
+			return vec, nil
+		}
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	var vecs [][]float32
+	var err error
+	if query {
+		vecs, err = embedding.EmbedQueries(ctx, s.embedder, []string{text})
+	} else {
+		vecs, err = s.embedder.Embed(ctx, []string{text})
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("embedding provider did not respond within %s: %w", timeout, context.DeadlineExceeded)
+	}
+	s.recordHealth(err)
 	if err != nil {
-		return nil, fmt.Errorf("generate embedding: %w", err)
+		return nil, err
 	}
 	if len(vecs) == 0 {
 		return nil, fmt.Errorf("no embedding returned")
 	}
-
-	if err := tx.SaveEmbedding(chunk.ID, s.embedder.Model(), vecs[0]); err != nil {
-		return nil, fmt.Errorf("save embedding: %w", err)
-	}
-
-	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("commit: %w", err)
+	if query {
+		s.queries.put(text, vecs[0])
 	}
+	return vecs[0], nil
+}
 
-	// Update in-memory index after successful commit
-	s.index.Add(chunk.ID, vecs[0])
+// embedText returns the text embedded for a chunk.
+func (s *Server) embedText(chunk *storage.Chunk) string {
+	return embedding.Text(chunk.Content, chunk.Metadata, s.config.MetadataFields)
+}
 
-	return chunk, nil
+// needsReembed reports whether an update changes the chunk's embedded text.
+// Metadata-only updates count only if ReembedOnMetadata is enabled and they
+// change one of the embedded MetadataFields.
+func (s *Server) needsReembed(ctx context.Context, id string, content *string, metadata json.RawMessage) (bool, error) {
+	if s.embedder == nil {
+		return false, nil
+	}
+	if content != nil {
+		return true, nil
+	}
+	if metadata == nil || !s.config.ReembedOnMetadata || len(s.config.MetadataFields) == 0 {
+		return false, nil
+	}
+	existing, err := s.db.GetChunk(ctx, id)
+	if errors.Is(err, storage.ErrChunkNotFound) {
+		return false, nil // reported as not found by the update itself
+	}
+	if err != nil {
+		return false, err
+	}
+	return embedding.MetadataChanged(existing.Metadata, metadata, s.config.MetadataFields), nil
 }
 
-func (s *Server) toolDeleteChunk(_ context.Context, args json.RawMessage) (any, error) {
+func (s *Server) toolDeleteChunk(ctx context.Context, args json.RawMessage) (any, error) {
 	var params struct {
 		ChunkID string `json:"chunk_id"`
 	}
@@ -374,33 +1157,44 @@ func (s *Server) toolDeleteChunk(_ context.Context, args json.RawMessage) (any,
 		return nil, fmt.Errorf("chunk_id is required")
 	}
 
-	deleted, err := s.db.DeleteChunk(params.ChunkID)
+	deleted, err := s.deleteUnlocked(ctx, params.ChunkID)
 	if err != nil {
 		return nil, err
 	}
-
-	// Remove from vector index (DB cascade deletes embedding)
-	if deleted && s.index != nil {
-		s.index.Remove(params.ChunkID)
-	}
-
-	return map[string]bool{"deleted": deleted}, nil
+	return map[string]bool{"deleted": len(deleted) > 0}, nil
 }
 
-func (s *Server) toolGetMetadataIndex(_ context.Context, args json.RawMessage) (any, error) {
+func (s *Server) toolGetMetadataIndex(ctx context.Context, args json.RawMessage) (any, error) {
 	var params struct {
 		TopN int `json:"top_n"`
 	}
 	json.Unmarshal(args, &params) // ignore error, use defaults
 
-	result, err := s.db.GetMetadataIndex(params.TopN)
+	result, err := s.db.GetMetadataIndex(ctx, params.TopN)
 	if err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
-func (s *Server) toolGetMetadataValues(_ context.Context, args json.RawMessage) (any, error) {
+func (s *Server) toolGetStats(ctx context.Context, _ json.RawMessage) (any, error) {
+	stats, err := s.db.ContentStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.embedder == nil {
+		return stats, nil
+	}
+	// Coverage for the model semantic_search uses
+	model := s.embedder.Model()
+	return struct {
+		*storage.ContentStats
+		Model    string  `json:"model"`
+		Coverage float64 `json:"coverage"`
+	}{stats, model, stats.Coverage(model)}, nil
+}
+
+func (s *Server) toolGetMetadataValues(ctx context.Context, args json.RawMessage) (any, error) {
 	var params struct {
 		Key  string `json:"key"`
 		TopN int    `json:"top_n"`
@@ -412,21 +1206,123 @@ func (s *Server) toolGetMetadataValues(_ context.Context, args json.RawMessage)
 		return nil, fmt.Errorf("key is required")
 	}
 
-	result, err := s.db.GetMetadataValues(params.Key, params.TopN)
+	result, err := s.db.GetMetadataValues(ctx, params.Key, params.TopN)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *Server) toolGetUsageReport(ctx context.Context, args json.RawMessage) (any, error) {
+	var params struct {
+		Limit int `json:"limit"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	return s.db.UsageReport(ctx, min(params.Limit, 100))
+}
+
+func (s *Server) toolCountChunks(ctx context.Context, args json.RawMessage) (any, error) {
+	var params struct {
+		Metadata      map[string]any `json:"metadata"`
+		CreatedAfter  string         `json:"created_after"`
+		CreatedBefore string         `json:"created_before"`
+		Facet         string         `json:"facet"`
+		TopN          int            `json:"top_n"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	after, err := parseDate(params.CreatedAfter)
+	if err != nil {
+		return nil, fmt.Errorf("created_after: %w", err)
+	}
+	before, err := parseDate(params.CreatedBefore)
+	if err != nil {
+		return nil, fmt.Errorf("created_before: %w", err)
+	}
+
+	// Without a filter, every chunk
+	ids, err := s.db.FilterChunkIDs(ctx, params.Metadata)
 	if err != nil {
 		return nil, err
 	}
+	if !after.IsZero() || !before.IsZero() {
+		created, err := s.db.CreatedTimes(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		in := ids[:0]
+		for _, id := range ids {
+			t, ok := created[id]
+			if ok && !t.Before(after) && (before.IsZero() || t.Before(before)) {
+				in = append(in, id)
+			}
+		}
+		ids = in
+	}
+
+	result := map[string]any{"count": len(ids)}
+	if params.Facet != "" {
+		if result["facet"], err = s.db.FacetChunks(ctx, ids, params.Facet, params.TopN); err != nil {
+			return nil, err
+		}
+	}
 	return result, nil
 }
 
+// parseDate reads a YYYY-MM-DD date, as midnight UTC, or an RFC 3339 time;
+// empty is the zero time.
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a YYYY-MM-DD date or RFC 3339 time", s)
+	}
+	return t, nil
+}
+
+// withFacet adds to a search response the counts of a metadata key's values
+// among its results, unless key is empty.
+func (s *Server) withFacet(ctx context.Context, resp map[string]any, key string, ids []string) (map[string]any, error) {
+	if key == "" {
+		return resp, nil
+	}
+	facet, err := s.db.FacetChunks(ctx, ids, key, 0)
+	if err != nil {
+		return nil, err
+	}
+	resp["facet"] = facet
+	return resp, nil
+}
+
+// mmrCandidates is how many times the results wanted diversified searches
+// consider.
+const mmrCandidates = 4
+
 func (s *Server) toolSemanticSearch(ctx context.Context, args json.RawMessage) (any, error) {
 	if s.embedder == nil {
 		return nil, fmt.Errorf("embedding provider not configured")
 	}
 
 	var params struct {
-		Query string `json:"query"`
-		Limit int    `json:"limit"`
+		Query        string         `json:"query"`
+		Limit        int            `json:"limit"`
+		MinScore     float32        `json:"min_score"`
+		MMRLambda    *float32       `json:"mmr_lambda"`
+		BoostCentral bool           `json:"boost_central"`
+		BoostRecent  bool           `json:"boost_recent"`
+		Rerank       *bool          `json:"rerank"`
+		Metadata     map[string]any `json:"metadata"`
+		Entity       string         `json:"entity"`
+		EntityKind   string         `json:"entity_kind"`
+		Facet        string         `json:"facet"`
 	}
 	if err := json.Unmarshal(args, &params); err != nil {
 		return nil, fmt.Errorf("invalid arguments: %w", err)
@@ -434,51 +1330,249 @@ func (s *Server) toolSemanticSearch(ctx context.Context, args json.RawMessage) (
 	if params.Query == "" {
 		return nil, fmt.Errorf("query is required")
 	}
+	if err := checkEntityKind(params.EntityKind); err != nil {
+		return nil, err
+	}
+	if params.MinScore < 0 || params.MinScore > 1 {
+		return nil, fmt.Errorf("min_score must be between 0 and 1")
+	}
+	if l := params.MMRLambda; l != nil && (*l < 0 || *l > 1) {
+		return nil, fmt.Errorf("mmr_lambda must be between 0 and 1")
+	}
 	if params.Limit <= 0 {
 		params.Limit = 10
 	}
 
+	// Narrow the search to the chunks matching the filter before scoring
+	// any vectors
+	search := func(vec []float32, k int) []vector.Result {
+		return s.index.Search(vec, k, params.MinScore)
+	}
+	if len(params.Metadata) > 0 || params.Entity != "" {
+		ids, err := s.filterIDs(ctx, params.Metadata, params.EntityKind, params.Entity)
+		if err != nil {
+			return nil, err
+		}
+		search = func(vec []float32, k int) []vector.Result {
+			return s.index.SearchWithin(vec, ids, k, params.MinScore)
+		}
+	}
+
 	// Get query embedding
-	vecs, err := s.embedder.Embed(ctx, []string{params.Query})
+	vec, err := s.embed(ctx, s.config.QueryTimeout, params.Query, true)
 	if err != nil {
 		return nil, fmt.Errorf("embed query: %w", err)
 	}
-	if len(vecs) == 0 {
-		return nil, fmt.Errorf("no embedding returned")
+
+	// Diversify among a wider pool of candidates, then boost the picks
+	if params.MMRLambda != nil {
+		pool := search
+		search = func(vec []float32, k int) []vector.Result {
+			return s.index.Diversify(pool(vec, k*mmrCandidates), k, *params.MMRLambda)
+		}
 	}
 
-	// Search vector index
-	results := s.index.Search(vecs[0], params.Limit)
+	// Search vector index, for more results when the best are reranked
+	limit := params.Limit
+	reranked := s.reranks(params.Rerank)
+	if reranked {
+		limit = s.rerankLimit(limit)
+	}
+	var results []vector.Result
+	boost := boosts{central: params.BoostCentral, recent: params.BoostRecent}
+	if !boost.any() {
+		results = search(vec, limit)
+	} else {
+		candidates := search(vec, limit*boostCandidates)
+		ids := make([]string, len(candidates))
+		for i, r := range candidates {
+			ids[i] = r.ID
+		}
+		order, err := s.boostOrder(ctx, ids, func(i int) float64 { return float64(candidates[i].Score) }, boost)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range order {
+			if len(results) == limit {
+				break
+			}
+			results = append(results, candidates[i])
+		}
+	}
 
 	// Fetch chunk details
 	type resultWithChunk struct {
-		ID       string          `json:"id"`
-		Score    float32         `json:"score"`
-		Content  string          `json:"content"`
-		Metadata json.RawMessage `json:"metadata,omitempty"`
+		ID          string          `json:"id"`
+		Score       float32         `json:"score"`
+		RerankScore *float64        `json:"rerank_score,omitempty"`
+		Content     string          `json:"content"`
+		Metadata    json.RawMessage `json:"metadata,omitempty"`
+		Truncated   bool            `json:"truncated,omitempty"`
 	}
 
 	output := make([]resultWithChunk, 0, len(results))
+	var texts []string // full contents, for the reranker
 	for _, r := range results {
-		chunk, err := s.db.GetChunk(r.ID)
+		chunk, err := s.db.GetChunk(ctx, r.ID)
 		if err != nil {
 			continue // skip chunks that were deleted or have errors
 		}
-		content := chunk.Content
-		if len(content) > 200 {
-			content = content[:200] + "..."
+		if reranked && len(texts) < s.config.RerankTopN {
+			texts = append(texts, chunk.Content)
 		}
+		content, truncated := storage.Truncate(chunk.Content, storage.SemanticPreviewLength)
 		output = append(output, resultWithChunk{
-			ID:       r.ID,
-			Score:    r.Score,
-			Content:  content,
-			Metadata: chunk.Metadata,
+			ID:        r.ID,
+			Score:     r.Score,
+			Content:   content,
+			Metadata:  chunk.Metadata,
+			Truncated: truncated,
 		})
 	}
+	if reranked {
+		if order, scores, ok := s.rerankOrder(ctx, params.Query, texts); ok {
+			top := make([]resultWithChunk, len(order))
+			for i, pos := range order {
+				top[i] = output[pos]
+				top[i].RerankScore = &scores[i]
+			}
+			copy(output, top)
+		}
+	}
+	output = output[:min(len(output), params.Limit)]
 
-	return map[string]any{
+	ids := make([]string, len(output))
+	for i, r := range output {
+		ids[i] = r.ID
+	}
+	return s.withFacet(ctx, map[string]any{
 		"results": output,
 		"query":   params.Query,
 		"count":   len(output),
+	}, params.Facet, ids)
+}
+
+func (s *Server) toolSimilarChunks(ctx context.Context, args json.RawMessage) (any, error) {
+	var params struct {
+		ChunkID  string  `json:"chunk_id"`
+		Limit    int     `json:"limit"`
+		MinScore float32 `json:"min_score"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if params.ChunkID == "" {
+		return nil, fmt.Errorf("chunk_id is required")
+	}
+	if params.MinScore < 0 || params.MinScore > 1 {
+		return nil, fmt.Errorf("min_score must be between 0 and 1")
+	}
+	if params.Limit <= 0 {
+		params.Limit = 10
+	}
+
+	results, ok := s.index.SearchByID(params.ChunkID, params.Limit, params.MinScore)
+	if !ok {
+		if _, err := s.db.GetChunk(ctx, params.ChunkID); errors.Is(err, storage.ErrChunkNotFound) {
+			return map[string]any{"found": false}, nil
+		}
+		return nil, fmt.Errorf("chunk %s has no embedding", params.ChunkID)
+	}
+
+	type similarChunk struct {
+		ID        string          `json:"id"`
+		Score     float32         `json:"score"`
+		Content   string          `json:"content"`
+		Metadata  json.RawMessage `json:"metadata,omitempty"`
+		Truncated bool            `json:"truncated,omitempty"`
+	}
+	output := make([]similarChunk, 0, len(results))
+	for _, r := range results {
+		chunk, err := s.db.GetChunk(ctx, r.ID)
+		if err != nil {
+			continue // skip chunks that were deleted or have errors
+		}
+		content, truncated := storage.Truncate(chunk.Content, storage.SemanticPreviewLength)
+		output = append(output, similarChunk{
+			ID:        r.ID,
+			Score:     r.Score,
+			Content:   content,
+			Metadata:  chunk.Metadata,
+			Truncated: truncated,
+		})
+	}
+	return map[string]any{
+		"results":  output,
+		"chunk_id": params.ChunkID,
+		"count":    len(output),
+	}, nil
+}
+
+func (s *Server) toolMostCentralChunks(ctx context.Context, args json.RawMessage) (any, error) {
+	var params struct {
+		Limit int `json:"limit"`
+	}
+	json.Unmarshal(args, &params) // ignore error, use defaults
+	if params.Limit <= 0 {
+		params.Limit = 10
+	} else if params.Limit > 100 {
+		params.Limit = 100
+	}
+
+	scores, _, updated, err := s.rankingSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	backlinks, err := s.db.Backlinks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(backlinks))
+	for id := range backlinks {
+		if _, ok := scores[id]; ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+
+	type centralChunk struct {
+		ID        string          `json:"id"`
+		Score     float64         `json:"score"`
+		Backlinks int             `json:"backlinks"`
+		Content   string          `json:"content"`
+		Metadata  json.RawMessage `json:"metadata,omitempty"`
+		Truncated bool            `json:"truncated,omitempty"`
+	}
+
+	output := make([]centralChunk, 0, params.Limit)
+	for _, id := range ids {
+		if len(output) == params.Limit {
+			break
+		}
+		chunk, err := s.db.GetChunk(ctx, id)
+		if err != nil {
+			continue // deleted since scores were computed
+		}
+		content, truncated := storage.Truncate(chunk.Content, storage.SemanticPreviewLength)
+		output = append(output, centralChunk{
+			ID:        id,
+			Score:     scores[id] * float64(len(scores)),
+			Backlinks: backlinks[id],
+			Content:   content,
+			Metadata:  chunk.Metadata,
+			Truncated: truncated,
+		})
+	}
+
+	return map[string]any{
+		"results":    output,
+		"count":      len(output),
+		"updated_at": updated,
 	}, nil
 }
@@ -0,0 +1,175 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/neoden/mykb/bookmarks"
+	"github.com/neoden/mykb/storage"
+)
+
+// Unfurl defaults.
+const (
+	DefaultUnfurlMaxURLs = 3
+	DefaultUnfurlTimeout = 10 * time.Second
+)
+
+// UnfurlConfig controls fetching the pages that chunks link to.
+type UnfurlConfig struct {
+	// Enabled fetches the web pages whose URLs appear in a chunk stored
+	// with store_chunk and stores their readable text as context chunks;
+	// calls can override it with unfurl.
+	Enabled bool `toml:"enabled"`
+	// MaxURLs is how many URLs of one chunk are fetched (default 3).
+	MaxURLs int `toml:"max_urls"`
+	// TimeoutSeconds bounds fetching each page (default 10).
+	TimeoutSeconds int `toml:"timeout_seconds"`
+	// Archive keeps each fetched page as an attachment of its context
+	// chunk, so the note keeps its value if the link rots.
+	Archive bool `toml:"archive"`
+}
+
+// Validate checks the unfurl settings.
+func (c UnfurlConfig) Validate() error {
+	if c.MaxURLs < 0 || c.TimeoutSeconds < 0 {
+		return errors.New("max_urls and timeout_seconds must not be negative")
+	}
+	return nil
+}
+
+func (c UnfurlConfig) maxURLs() int {
+	if c.MaxURLs > 0 {
+		return c.MaxURLs
+	}
+	return DefaultUnfurlMaxURLs
+}
+
+func (c UnfurlConfig) timeout() time.Duration {
+	if c.TimeoutSeconds > 0 {
+		return time.Duration(c.TimeoutSeconds) * time.Second
+	}
+	return DefaultUnfurlTimeout
+}
+
+// Unfurled is the context chunk stored for one URL of a chunk.
+type Unfurled struct {
+	URL     string `json:"url"`
+	ChunkID string `json:"chunk_id,omitempty"`
+	Title   string `json:"title,omitempty"`
+	// Existing is true when the page was already stored, and is linked
+	// rather than fetched again.
+	Existing bool `json:"existing,omitempty"`
+	// AttachmentID is the archived copy of the page.
+	AttachmentID string `json:"attachment_id,omitempty"`
+	// Error is why the page could not be stored.
+	Error string `json:"error,omitempty"`
+}
+
+// urlPattern matches http(s) URLs in text, stopping at characters that
+// usually close them, such as the parenthesis of a markdown link.
+var urlPattern = regexp.MustCompile("https?://[^\\s<>\"'`()\\[\\]]+")
+
+// findURLs returns the distinct URLs in content, at most limit of them.
+func findURLs(content string, limit int) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, m := range urlPattern.FindAllString(content, -1) {
+		u := strings.TrimRight(m, ".,;:!?")
+		if parsed, err := url.Parse(u); err != nil || parsed.Host == "" || seen[u] {
+			continue
+		}
+		seen[u] = true
+		urls = append(urls, u)
+		if len(urls) == limit {
+			break
+		}
+	}
+	return urls
+}
+
+// unfurl stores the readable text of each page chunk links to as a chunk
+// with url, title and unfurled_from metadata, archiving the page if so
+// configured. A page already stored under its url is linked instead. Pages
+// that fail are reported and logged; chunk itself is kept regardless.
+func (s *Server) unfurl(ctx context.Context, chunk *storage.Chunk) []Unfurled {
+	cfg := s.config.Unfurl
+	fetcher := bookmarks.NewFetcher(1)
+	var results []Unfurled
+	for _, u := range findURLs(chunk.Content, cfg.maxURLs()) {
+		r := Unfurled{URL: u}
+		ids, err := s.db.FilterChunkIDs(ctx, map[string]any{"url": u})
+		if err == nil {
+			for _, id := range ids {
+				if id != chunk.ID {
+					r.ChunkID, r.Existing = id, true
+					break
+				}
+			}
+		}
+		if !r.Existing {
+			if err := s.unfurlPage(ctx, fetcher, chunk.ID, &r); err != nil {
+				log.Printf("Unfurl %s: %v", u, err)
+				r.Error = err.Error()
+			}
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+func (s *Server) unfurlPage(ctx context.Context, fetcher *bookmarks.Fetcher, from string, r *Unfurled) error {
+	fctx, cancel := context.WithTimeout(ctx, s.config.Unfurl.timeout())
+	data, mediaType, err := fetcher.Download(fctx, r.URL)
+	cancel()
+	if err != nil {
+		return err
+	}
+	page, err := bookmarks.PageOf(data, mediaType)
+	if err != nil {
+		return err
+	}
+
+	meta := map[string]any{"url": r.URL, "unfurled_from": from}
+	if page.Title != "" {
+		meta["title"] = page.Title
+	}
+	raw, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	stored, _, err := s.storeChunk(ctx, page.Text, raw, "")
+	if err != nil {
+		return err
+	}
+	r.ChunkID, r.Title = stored.ID, page.Title
+
+	if s.config.Unfurl.Archive {
+		if mediaType == "" {
+			mediaType = "text/html"
+		}
+		a, err := s.db.AddAttachment(ctx, stored.ID, archiveName(r.URL, mediaType), mediaType, data)
+		if err != nil {
+			return err
+		}
+		r.AttachmentID = a.ID
+	}
+	return nil
+}
+
+// archiveName names the archived copy of the page at u after its host.
+func archiveName(u, mediaType string) string {
+	name := "page"
+	if parsed, err := url.Parse(u); err == nil && parsed.Host != "" {
+		name = parsed.Host
+	}
+	if strings.HasPrefix(mediaType, "text/plain") || mediaType == "text/markdown" {
+		return name + ".txt"
+	}
+	return name + ".html"
+}
@@ -0,0 +1,96 @@
+package rerank
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const cohereURL = "https://api.cohere.com/v2/rerank"
+
+// CohereReranker implements Reranker using the Cohere rerank API.
+type CohereReranker struct {
+	apiKey string
+	model  string
+	url    string
+	client *http.Client
+}
+
+// NewCohereReranker creates a new Cohere reranker.
+func NewCohereReranker(apiKey, model string) *CohereReranker {
+	return &CohereReranker{
+		apiKey: apiKey,
+		model:  model,
+		url:    cohereURL,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+type cohereRequest struct {
+	Model     string   `json:"model"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+}
+
+type cohereResponse struct {
+	Results []struct {
+		Index          int     `json:"index"`
+		RelevanceScore float64 `json:"relevance_score"`
+	} `json:"results"`
+}
+
+func (r *CohereReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	if len(documents) == 0 {
+		return nil, nil
+	}
+	reqBody, err := json.Marshal(cohereRequest{Model: r.model, Query: query, Documents: documents})
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", r.url, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+r.apiKey)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("cohere api error: status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result cohereResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	scores := make([]float64, len(documents))
+	seen := 0
+	for _, res := range result.Results {
+		if res.Index < 0 || res.Index >= len(documents) {
+			return nil, fmt.Errorf("cohere returned result for document %d of %d", res.Index, len(documents))
+		}
+		scores[res.Index] = res.RelevanceScore
+		seen++
+	}
+	if seen != len(documents) {
+		return nil, fmt.Errorf("cohere returned %d scores for %d documents", seen, len(documents))
+	}
+	return scores, nil
+}
+
+func (r *CohereReranker) Model() string {
+	return "cohere/" + r.model
+}
@@ -0,0 +1,110 @@
+// Package rerank re-orders search results with a model that reads the
+// query and each result together (a cross-encoder), which judges relevance
+// more precisely than comparing embeddings or matching terms.
+package rerank
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Reranker scores documents against a query.
+type Reranker interface {
+	// Rerank returns the relevance of each document to query, in the
+	// order given; higher is more relevant.
+	Rerank(ctx context.Context, query string, documents []string) ([]float64, error)
+	// Model returns the model identifier.
+	Model() string
+}
+
+// Defaults when not configured.
+const (
+	DefaultTopN    = 20
+	DefaultTimeout = 5 * time.Second
+)
+
+// Config holds reranker settings.
+type Config struct {
+	// Provider is "cohere" (the Cohere rerank API) or "tei" (a local
+	// cross-encoder served by Hugging Face text-embeddings-inference);
+	// empty disables reranking.
+	Provider string `toml:"provider"`
+	// TopN is how many of the best results are reranked (default 20).
+	TopN int `toml:"top_n"`
+	// TimeoutSeconds bounds each rerank request (default 5); on timeout or
+	// error results keep their original order.
+	TimeoutSeconds int `toml:"timeout_seconds"`
+
+	Cohere CohereConfig `toml:"cohere"`
+	TEI    TEIConfig    `toml:"tei"`
+}
+
+// CohereConfig holds Cohere rerank settings.
+type CohereConfig struct {
+	APIKey string `toml:"api_key"`
+	// Model defaults to rerank-v3.5.
+	Model string `toml:"model"`
+}
+
+// TEIConfig holds settings for a text-embeddings-inference server running
+// a reranker model (e.g. BAAI/bge-reranker-base).
+type TEIConfig struct {
+	// URL is the server root, under which /rerank is requested.
+	URL string `toml:"url"`
+}
+
+// Validate checks the reranker settings.
+func (c Config) Validate() error {
+	switch c.Provider {
+	case "":
+	case "cohere":
+		if c.Cohere.APIKey == "" {
+			return fmt.Errorf("cohere.api_key not set")
+		}
+	case "tei":
+		if c.TEI.URL == "" {
+			return fmt.Errorf("tei.url not set")
+		}
+	default:
+		return fmt.Errorf("unknown provider %q: expected cohere or tei", c.Provider)
+	}
+	if c.TopN < 0 || c.TimeoutSeconds < 0 {
+		return fmt.Errorf("top_n and timeout_seconds must not be negative")
+	}
+	return nil
+}
+
+// Candidates returns how many results are reranked.
+func (c Config) Candidates() int {
+	if c.TopN > 0 {
+		return c.TopN
+	}
+	return DefaultTopN
+}
+
+// Timeout returns the timeout for one rerank request.
+func (c Config) Timeout() time.Duration {
+	if c.TimeoutSeconds > 0 {
+		return time.Duration(c.TimeoutSeconds) * time.Second
+	}
+	return DefaultTimeout
+}
+
+// New creates the configured Reranker, or returns nil if none is.
+func New(cfg Config) (Reranker, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	switch cfg.Provider {
+	case "cohere":
+		model := cfg.Cohere.Model
+		if model == "" {
+			model = "rerank-v3.5"
+		}
+		return NewCohereReranker(cfg.Cohere.APIKey, model), nil
+	case "tei":
+		return NewTEIReranker(cfg.TEI.URL), nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,84 @@
+package rerank
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestCohereRerank(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("Authorization = %q", got)
+		}
+		var req cohereRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "rerank-v3.5" || req.Query != "q" || len(req.Documents) != 2 {
+			t.Errorf("request = %+v", req)
+		}
+		// Results come back by relevance, not in document order
+		w.Write([]byte(`{"results":[{"index":1,"relevance_score":0.9},{"index":0,"relevance_score":0.2}]}`))
+	}))
+	defer server.Close()
+
+	r := NewCohereReranker("test-key", "rerank-v3.5")
+	r.url = server.URL
+	scores, err := r.Rerank(context.Background(), "q", []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("Rerank: %v", err)
+	}
+	if !slices.Equal(scores, []float64{0.2, 0.9}) {
+		t.Errorf("scores = %v, want [0.2 0.9]", scores)
+	}
+}
+
+func TestTEIRerank(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rerank" {
+			t.Errorf("Path = %s, want /rerank", r.URL.Path)
+		}
+		var req teiRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Query != "q" || len(req.Texts) != 3 {
+			t.Errorf("request = %+v", req)
+		}
+		w.Write([]byte(`[{"index":2,"score":0.8},{"index":0,"score":0.5},{"index":1,"score":0.1}]`))
+	}))
+	defer server.Close()
+
+	scores, err := NewTEIReranker(server.URL+"/").Rerank(context.Background(), "q", []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatalf("Rerank: %v", err)
+	}
+	if !slices.Equal(scores, []float64{0.5, 0.1, 0.8}) {
+		t.Errorf("scores = %v, want [0.5 0.1 0.8]", scores)
+	}
+
+	// A response missing documents is an error
+	short := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"index":0,"score":0.5}]`))
+	}))
+	defer short.Close()
+	if _, err := NewTEIReranker(short.URL).Rerank(context.Background(), "q", []string{"a", "b"}); err == nil {
+		t.Error("expected error for missing scores")
+	}
+}
+
+func TestNew(t *testing.T) {
+	if r, err := New(Config{}); r != nil || err != nil {
+		t.Errorf("New(empty) = %v, %v, want nil, nil", r, err)
+	}
+	if _, err := New(Config{Provider: "cohere"}); err == nil {
+		t.Error("expected error without cohere.api_key")
+	}
+	if _, err := New(Config{Provider: "sentence"}); err == nil {
+		t.Error("expected error for unknown provider")
+	}
+	r, err := New(Config{Provider: "cohere", Cohere: CohereConfig{APIKey: "k"}})
+	if err != nil || r.Model() != "cohere/rerank-v3.5" {
+		t.Errorf("New(cohere) = %v, %v", r, err)
+	}
+}
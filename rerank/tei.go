@@ -0,0 +1,87 @@
+package rerank
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TEIReranker implements Reranker with the /rerank endpoint of a Hugging
+// Face text-embeddings-inference server, for cross-encoders run locally.
+type TEIReranker struct {
+	url    string
+	client *http.Client
+}
+
+// NewTEIReranker creates a reranker for the server at url.
+func NewTEIReranker(url string) *TEIReranker {
+	return &TEIReranker{
+		url: strings.TrimRight(url, "/"),
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+type teiRequest struct {
+	Query    string   `json:"query"`
+	Texts    []string `json:"texts"`
+	Truncate bool     `json:"truncate"`
+}
+
+type teiResult struct {
+	Index int     `json:"index"`
+	Score float64 `json:"score"`
+}
+
+func (r *TEIReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	if len(documents) == 0 {
+		return nil, nil
+	}
+	reqBody, err := json.Marshal(teiRequest{Query: query, Texts: documents, Truncate: true})
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", r.url+"/rerank", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("tei api error: status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var results []teiResult
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	if len(results) != len(documents) {
+		return nil, fmt.Errorf("tei returned %d scores for %d documents", len(results), len(documents))
+	}
+	scores := make([]float64, len(documents))
+	for _, res := range results {
+		if res.Index < 0 || res.Index >= len(documents) {
+			return nil, fmt.Errorf("tei returned result for document %d of %d", res.Index, len(documents))
+		}
+		scores[res.Index] = res.Score
+	}
+	return scores, nil
+}
+
+func (r *TEIReranker) Model() string {
+	return "tei/" + r.url
+}
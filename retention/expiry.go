@@ -0,0 +1,140 @@
+package retention
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/neoden/mykb/storage"
+)
+
+// Expiry defaults.
+const (
+	DefaultExpiryKey      = "expires_at"
+	DefaultExpiryInterval = 15 * time.Minute
+)
+
+// ExpiryConfig removes chunks once the time in their metadata has passed,
+// such as scratch notes given an expires_at.
+type ExpiryConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Key is the metadata key holding the expiry, a date (expiring at its
+	// start, UTC) or an RFC 3339 time (default expires_at).
+	Key    string `toml:"key"`
+	Action string `toml:"action"` // "delete" (default) or "archive"
+	// IntervalMinutes is how often a running server looks for expired
+	// chunks (default 15).
+	IntervalMinutes int `toml:"interval_minutes"`
+	// WebhookURL receives a JSON POST of each batch of expired chunks.
+	WebhookURL string `toml:"webhook_url"`
+}
+
+// Validate checks the expiry settings.
+func (c ExpiryConfig) Validate() error {
+	if c.IntervalMinutes < 0 {
+		return errors.New("interval_minutes must not be negative")
+	}
+	if c.Action != "" && c.Action != ActionDelete && c.Action != ActionArchive {
+		return fmt.Errorf("action must be %q or %q", ActionDelete, ActionArchive)
+	}
+	if c.WebhookURL != "" && !strings.HasPrefix(c.WebhookURL, "http://") && !strings.HasPrefix(c.WebhookURL, "https://") {
+		return errors.New("webhook_url must be an http or https URL")
+	}
+	return nil
+}
+
+// MetadataKey returns the metadata key holding the expiry.
+func (c ExpiryConfig) MetadataKey() string {
+	if c.Key != "" {
+		return c.Key
+	}
+	return DefaultExpiryKey
+}
+
+// ExpiryAction returns what is done with expired chunks.
+func (c ExpiryConfig) ExpiryAction() string {
+	if c.Action != "" {
+		return c.Action
+	}
+	return ActionDelete
+}
+
+// Interval returns how often expired chunks are looked for.
+func (c ExpiryConfig) Interval() time.Duration {
+	if c.IntervalMinutes > 0 {
+		return time.Duration(c.IntervalMinutes) * time.Minute
+	}
+	return DefaultExpiryInterval
+}
+
+// ExpiresAt returns when chunk expires, and false if its metadata sets no
+// valid expiry.
+func (c ExpiryConfig) ExpiresAt(chunk storage.Chunk) (time.Time, bool) {
+	if len(chunk.Metadata) == 0 {
+		return time.Time{}, false
+	}
+	var meta map[string]any
+	if json.Unmarshal(chunk.Metadata, &meta) != nil {
+		return time.Time{}, false
+	}
+	s, ok := meta[c.MetadataKey()].(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// Expired returns the chunks that have expired at now.
+func (c ExpiryConfig) Expired(chunks []storage.Chunk, now time.Time) []storage.Chunk {
+	var expired []storage.Chunk
+	for _, chunk := range chunks {
+		if t, ok := c.ExpiresAt(chunk); ok && !now.Before(t) {
+			expired = append(expired, chunk)
+		}
+	}
+	return expired
+}
+
+// notifyTimeout bounds delivery of one webhook notification.
+const notifyTimeout = 30 * time.Second
+
+// Notify posts payload as JSON to the webhook, if one is set.
+func (c ExpiryConfig) Notify(ctx context.Context, payload any) error {
+	if c.WebhookURL == "" {
+		return nil
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal notification: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", c.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
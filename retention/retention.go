@@ -0,0 +1,166 @@
+// Package retention evaluates config-defined rules that delete or archive
+// chunks once they reach a given age, or the expiry set in their metadata.
+package retention
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/neoden/mykb/storage"
+)
+
+// DefaultInterval is how often a running server evaluates the rules.
+const DefaultInterval = 24 * time.Hour
+
+// Rule actions.
+const (
+	ActionDelete  = "delete"
+	ActionArchive = "archive"
+)
+
+// Config lists the retention rules.
+type Config struct {
+	// IntervalHours is how often a running server applies the rules (default 24).
+	IntervalHours int          `toml:"interval_hours"`
+	Rules         []Rule       `toml:"rules"`
+	Expiry        ExpiryConfig `toml:"expiry"`
+}
+
+// Rule selects chunks older than OlderThanDays whose metadata matches.
+type Rule struct {
+	Name string `toml:"name"`
+	// Match holds key=value metadata filters that must all match; an array
+	// value matches if it contains the value.
+	Match []string `toml:"match"`
+	// Untagged restricts the rule to chunks without tags.
+	Untagged      bool   `toml:"untagged"`
+	OlderThanDays int    `toml:"older_than_days"`
+	Action        string `toml:"action"` // "delete" or "archive"
+}
+
+// Interval returns how often the rules are applied.
+func (c Config) Interval() time.Duration {
+	if c.IntervalHours > 0 {
+		return time.Duration(c.IntervalHours) * time.Hour
+	}
+	return DefaultInterval
+}
+
+// Validate checks the rules.
+func (c Config) Validate() error {
+	if c.IntervalHours < 0 {
+		return errors.New("interval_hours must not be negative")
+	}
+	if err := c.Expiry.Validate(); err != nil {
+		return fmt.Errorf("expiry: %w", err)
+	}
+	names := make(map[string]bool)
+	for i, r := range c.Rules {
+		if r.Name == "" {
+			return fmt.Errorf("rule %d: name is required", i+1)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("rule %q: duplicate name", r.Name)
+		}
+		names[r.Name] = true
+		if r.OlderThanDays <= 0 {
+			return fmt.Errorf("rule %q: older_than_days must be positive", r.Name)
+		}
+		if r.Action != ActionDelete && r.Action != ActionArchive {
+			return fmt.Errorf("rule %q: action must be %q or %q", r.Name, ActionDelete, ActionArchive)
+		}
+		for _, m := range r.Match {
+			if k, _, ok := strings.Cut(m, "="); !ok || k == "" {
+				return fmt.Errorf("rule %q: invalid match %q: expected key=value", r.Name, m)
+			}
+		}
+	}
+	return nil
+}
+
+// Archives reports whether any rule, or expiry, archives chunks.
+func (c Config) Archives() bool {
+	if c.Expiry.Enabled && c.Expiry.ExpiryAction() == ActionArchive {
+		return true
+	}
+	for _, r := range c.Rules {
+		if r.Action == ActionArchive {
+			return true
+		}
+	}
+	return false
+}
+
+// Fingerprint identifies the rule's definition, so a changed rule is
+// treated as new.
+func (r Rule) Fingerprint() string {
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s\x00%q\x00%t\x00%d\x00%s", r.Name, r.Match, r.Untagged, r.OlderThanDays, r.Action))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Matches reports whether the rule selects c at now.
+func (r Rule) Matches(c storage.Chunk, now time.Time) bool {
+	if now.Sub(c.CreatedAt) < time.Duration(r.OlderThanDays)*24*time.Hour {
+		return false
+	}
+	var meta map[string]any
+	if len(c.Metadata) > 0 {
+		json.Unmarshal(c.Metadata, &meta)
+	}
+	if r.Untagged && hasTags(meta) {
+		return false
+	}
+	for _, m := range r.Match {
+		key, value, _ := strings.Cut(m, "=")
+		if !matchValue(meta[key], value) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasTags(meta map[string]any) bool {
+	switch tags := meta["tags"].(type) {
+	case []any:
+		return len(tags) > 0
+	case string:
+		return tags != ""
+	}
+	return false
+}
+
+// matchValue reports whether v equals value, or contains it if an array.
+func matchValue(v any, value string) bool {
+	if v == nil {
+		return false
+	}
+	if arr, ok := v.([]any); ok {
+		for _, item := range arr {
+			if fmt.Sprint(item) == value {
+				return true
+			}
+		}
+		return false
+	}
+	return fmt.Sprint(v) == value
+}
+
+// Plan returns the chunks each rule selects at now, by rule name. A chunk
+// selected by several rules goes to the first of them.
+func (c Config) Plan(chunks []storage.Chunk, now time.Time) map[string][]storage.Chunk {
+	plan := make(map[string][]storage.Chunk)
+	for _, chunk := range chunks {
+		for _, r := range c.Rules {
+			if r.Matches(chunk, now) {
+				plan[r.Name] = append(plan[r.Name], chunk)
+				break
+			}
+		}
+	}
+	return plan
+}
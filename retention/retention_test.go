@@ -0,0 +1,111 @@
+package retention
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/neoden/mykb/storage"
+)
+
+func TestValidate(t *testing.T) {
+	rule := Rule{Name: "logs", Match: []string{"type=log"}, OlderThanDays: 180, Action: ActionDelete}
+	tests := []struct {
+		name string
+		cfg  Config
+		ok   bool
+	}{
+		{"valid", Config{Rules: []Rule{rule}}, true},
+		{"empty", Config{}, true},
+		{"no name", Config{Rules: []Rule{{OlderThanDays: 1, Action: ActionDelete}}}, false},
+		{"duplicate", Config{Rules: []Rule{rule, rule}}, false},
+		{"no age", Config{Rules: []Rule{{Name: "x", Action: ActionDelete}}}, false},
+		{"bad action", Config{Rules: []Rule{{Name: "x", OlderThanDays: 1, Action: "purge"}}}, false},
+		{"bad match", Config{Rules: []Rule{{Name: "x", OlderThanDays: 1, Action: ActionArchive, Match: []string{"log"}}}}, false},
+		{"negative interval", Config{IntervalHours: -1}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%s: Validate() = %v", tt.name, err)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	chunk := func(id string, age time.Duration, meta string) storage.Chunk {
+		return storage.Chunk{ID: id, CreatedAt: now.Add(-age), Metadata: json.RawMessage(meta)}
+	}
+	day := 24 * time.Hour
+	chunks := []storage.Chunk{
+		chunk("old-log", 200*day, `{"type":"log"}`),
+		chunk("new-log", 10*day, `{"type":"log"}`),
+		chunk("old-tagged-log", 400*day, `{"type":"log","tags":["keep"]}`),
+		chunk("old-untagged", 400*day, `{"tags":[]}`),
+		chunk("old-tagged", 400*day, `{"tags":["go"]}`),
+		chunk("old-plain", 400*day, ``),
+	}
+	cfg := Config{Rules: []Rule{
+		{Name: "logs", Match: []string{"type=log"}, OlderThanDays: 180, Action: ActionDelete},
+		{Name: "untagged", Untagged: true, OlderThanDays: 365, Action: ActionArchive},
+	}}
+
+	plan := cfg.Plan(chunks, now)
+	ids := func(name string) []string {
+		var out []string
+		for _, c := range plan[name] {
+			out = append(out, c.ID)
+		}
+		return out
+	}
+	if got := ids("logs"); len(got) != 2 || got[0] != "old-log" || got[1] != "old-tagged-log" {
+		t.Errorf("logs = %v, want old-log, old-tagged-log", got)
+	}
+	if got := ids("untagged"); len(got) != 2 || got[0] != "old-untagged" || got[1] != "old-plain" {
+		t.Errorf("untagged = %v, want old-untagged, old-plain", got)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	a := Rule{Name: "logs", Match: []string{"type=log"}, OlderThanDays: 180, Action: ActionDelete}
+	b := a
+	b.OlderThanDays = 90
+	if a.Fingerprint() == b.Fingerprint() {
+		t.Error("changed rule has the same fingerprint")
+	}
+	if a.Fingerprint() != (Rule{Name: "logs", Match: []string{"type=log"}, OlderThanDays: 180, Action: ActionDelete}).Fingerprint() {
+		t.Error("fingerprint is not stable")
+	}
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	chunk := func(id, meta string) storage.Chunk {
+		return storage.Chunk{ID: id, Metadata: json.RawMessage(meta)}
+	}
+	chunks := []storage.Chunk{
+		chunk("past-time", `{"expires_at":"2026-06-01T11:00:00Z"}`),
+		chunk("today", `{"expires_at":"2026-06-01"}`),
+		chunk("future", `{"expires_at":"2026-06-02"}`),
+		chunk("invalid", `{"expires_at":"soon"}`),
+		chunk("none", ``),
+	}
+	var got []string
+	for _, c := range (ExpiryConfig{}).Expired(chunks, now) {
+		got = append(got, c.ID)
+	}
+	if len(got) != 2 || got[0] != "past-time" || got[1] != "today" {
+		t.Errorf("Expired = %v, want past-time, today", got)
+	}
+
+	cfg := ExpiryConfig{Key: "ttl"}
+	if got := cfg.Expired([]storage.Chunk{chunk("ttl", `{"ttl":"2026-01-01"}`), chunks[0]}, now); len(got) != 1 || got[0].ID != "ttl" {
+		t.Errorf("Expired with key ttl = %v", got)
+	}
+	if (Config{Expiry: ExpiryConfig{Action: "purge"}}).Validate() == nil {
+		t.Error("Validate accepted an unknown expiry action")
+	}
+	if !(Config{Expiry: ExpiryConfig{Enabled: true, Action: ActionArchive}}).Archives() {
+		t.Error("Archives() = false with archiving expiry")
+	}
+}
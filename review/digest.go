@@ -0,0 +1,128 @@
+package review
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// DigestConfig sets where the review digest goes; with neither set no
+// digest is sent.
+type DigestConfig struct {
+	// WebhookURL receives a JSON POST of the queue.
+	WebhookURL string      `toml:"webhook_url"`
+	Email      EmailConfig `toml:"email"`
+}
+
+// EmailConfig holds SMTP settings for the digest email.
+type EmailConfig struct {
+	// SMTPAddr is the server's host:port, such as smtp.example.com:587;
+	// the connection is upgraded with STARTTLS when the server offers it.
+	SMTPAddr string   `toml:"smtp_addr"`
+	Username string   `toml:"username"`
+	Password string   `toml:"password"`
+	From     string   `toml:"from"`
+	To       []string `toml:"to"`
+}
+
+// Enabled reports whether a digest destination is set.
+func (c DigestConfig) Enabled() bool {
+	return c.WebhookURL != "" || c.Email.SMTPAddr != ""
+}
+
+// Validate checks the digest settings.
+func (c DigestConfig) Validate() error {
+	if c.WebhookURL != "" && !strings.HasPrefix(c.WebhookURL, "http://") && !strings.HasPrefix(c.WebhookURL, "https://") {
+		return fmt.Errorf("webhook_url must be an http or https URL")
+	}
+	if e := c.Email; e.SMTPAddr != "" {
+		if _, _, err := net.SplitHostPort(e.SMTPAddr); err != nil {
+			return fmt.Errorf("email.smtp_addr: %w", err)
+		}
+		if e.From == "" || len(e.To) == 0 {
+			return errors.New("email: from and to are required")
+		}
+	}
+	return nil
+}
+
+// digestTimeout bounds delivery to each destination.
+const digestTimeout = 30 * time.Second
+
+// Send delivers the digest of items to each configured destination.
+func (c DigestConfig) Send(ctx context.Context, items []Item) error {
+	var errs []error
+	if c.WebhookURL != "" {
+		if err := c.post(ctx, items); err != nil {
+			errs = append(errs, fmt.Errorf("webhook: %w", err))
+		}
+	}
+	if c.Email.SMTPAddr != "" {
+		if err := c.Email.send(items); err != nil {
+			errs = append(errs, fmt.Errorf("email: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c DigestConfig) post(ctx context.Context, items []Item) error {
+	body, err := json.Marshal(map[string]any{"items": items, "count": len(items)})
+	if err != nil {
+		return fmt.Errorf("marshal digest: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, digestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", c.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+func (e EmailConfig) send(items []Item) error {
+	var auth smtp.Auth
+	if e.Username != "" {
+		host, _, _ := net.SplitHostPort(e.SMTPAddr)
+		auth = smtp.PlainAuth("", e.Username, e.Password, host)
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\n", e.From, strings.Join(e.To, ", "))
+	fmt.Fprintf(&msg, "Subject: mykb review: %d due\r\n", len(items))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(FormatDigest(items), "\n", "\r\n"))
+	return smtp.SendMail(e.SMTPAddr, auth, e.From, e.To, msg.Bytes())
+}
+
+// FormatDigest renders items as plain text, one paragraph per chunk.
+func FormatDigest(items []Item) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Chunks due for review: %d\n", len(items))
+	for _, it := range items {
+		content := strings.Join(strings.Fields(it.Content), " ")
+		if it.Truncated {
+			content += "..."
+		}
+		fmt.Fprintf(&b, "\n%s (%s since %s)\n%s\n", it.ID, strings.ReplaceAll(it.Reason, "_", " "), it.Since.Format(time.DateOnly), content)
+	}
+	return b.String()
+}
@@ -0,0 +1,176 @@
+// Package review picks chunks due for another look, by config-defined
+// policy, and sends digests of them.
+package review
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/neoden/mykb/storage"
+)
+
+// Defaults when not configured.
+const (
+	DefaultLimit    = 20
+	DefaultInterval = 24 * time.Hour
+)
+
+// Why a chunk is due, most pressing first.
+const (
+	// ReasonDue chunks have passed the date in their DueKey metadata.
+	ReasonDue = "due"
+	// ReasonStale chunks have been neither updated nor read for
+	// OlderThanDays.
+	ReasonStale = "stale"
+	// ReasonNeverAccessed chunks have never been read with get_chunk.
+	ReasonNeverAccessed = "never_accessed"
+)
+
+// Config holds the review policy. A chunk is due if any enabled criterion
+// selects it.
+type Config struct {
+	// OlderThanDays selects chunks neither updated nor read for that many
+	// days (0 disables).
+	OlderThanDays int `toml:"older_than_days"`
+	// NeverAccessed selects chunks never read with get_chunk.
+	NeverAccessed bool `toml:"never_accessed"`
+	// DueKey names a metadata key holding the date a chunk is next due
+	// (YYYY-MM-DD or RFC 3339), as a spaced repetition client sets it after
+	// each review.
+	DueKey string `toml:"due_key"`
+	// Limit is the longest queue returned (default 20).
+	Limit int `toml:"limit"`
+
+	// IntervalHours is how often the digest is sent (default 24).
+	IntervalHours int          `toml:"interval_hours"`
+	Digest        DigestConfig `toml:"digest"`
+}
+
+// Enabled reports whether any criterion is set.
+func (c Config) Enabled() bool {
+	return c.OlderThanDays > 0 || c.NeverAccessed || c.DueKey != ""
+}
+
+// Validate checks the policy and digest settings.
+func (c Config) Validate() error {
+	if c.OlderThanDays < 0 || c.Limit < 0 || c.IntervalHours < 0 {
+		return errors.New("older_than_days, limit and interval_hours must not be negative")
+	}
+	if c.Digest.Enabled() && !c.Enabled() {
+		return errors.New("digest: no review criteria set")
+	}
+	if err := c.Digest.Validate(); err != nil {
+		return fmt.Errorf("digest: %w", err)
+	}
+	return nil
+}
+
+// QueueLimit returns the longest queue returned.
+func (c Config) QueueLimit() int {
+	if c.Limit > 0 {
+		return c.Limit
+	}
+	return DefaultLimit
+}
+
+// Interval returns how often the digest is sent.
+func (c Config) Interval() time.Duration {
+	if c.IntervalHours > 0 {
+		return time.Duration(c.IntervalHours) * time.Hour
+	}
+	return DefaultInterval
+}
+
+// Item is a chunk due for review.
+type Item struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+	// Since is when the chunk became due: its due date, when it was last
+	// updated or read, or when it was created if never read.
+	Since     time.Time       `json:"since"`
+	Content   string          `json:"content"`
+	Metadata  json.RawMessage `json:"metadata,omitempty"`
+	Truncated bool            `json:"truncated,omitempty"`
+}
+
+var reasonOrder = map[string]int{ReasonDue: 0, ReasonStale: 1, ReasonNeverAccessed: 2}
+
+// Queue returns up to limit chunks due at now, given when chunks were last
+// read: chunks past their due date first, then stale ones, then those
+// never read, each longest due first.
+func (c Config) Queue(chunks []storage.Chunk, accessed map[string]time.Time, now time.Time, limit int) []Item {
+	var items []Item
+	for _, chunk := range chunks {
+		reason, since, ok := c.due(chunk, accessed, now)
+		if !ok {
+			continue
+		}
+		content, truncated := storage.Truncate(chunk.Content, storage.SemanticPreviewLength)
+		items = append(items, Item{
+			ID:        chunk.ID,
+			Reason:    reason,
+			Since:     since,
+			Content:   content,
+			Metadata:  chunk.Metadata,
+			Truncated: truncated,
+		})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if a, b := reasonOrder[items[i].Reason], reasonOrder[items[j].Reason]; a != b {
+			return a < b
+		}
+		return items[i].Since.Before(items[j].Since)
+	})
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items
+}
+
+// due reports whether chunk is due at now, why, and since when.
+func (c Config) due(chunk storage.Chunk, accessed map[string]time.Time, now time.Time) (string, time.Time, bool) {
+	if c.DueKey != "" {
+		if at, ok := dueDate(chunk.Metadata, c.DueKey); ok && !at.After(now) {
+			return ReasonDue, at, true
+		}
+	}
+	read, wasRead := accessed[chunk.ID]
+	if c.OlderThanDays > 0 {
+		touched := chunk.UpdatedAt
+		if read.After(touched) {
+			touched = read
+		}
+		if now.Sub(touched) >= time.Duration(c.OlderThanDays)*24*time.Hour {
+			return ReasonStale, touched, true
+		}
+	}
+	if c.NeverAccessed && !wasRead {
+		return ReasonNeverAccessed, chunk.CreatedAt, true
+	}
+	return "", time.Time{}, false
+}
+
+// dueDate reads the date under key in metadata.
+func dueDate(metadata json.RawMessage, key string) (time.Time, bool) {
+	if len(metadata) == 0 {
+		return time.Time{}, false
+	}
+	var meta map[string]any
+	if json.Unmarshal(metadata, &meta) != nil {
+		return time.Time{}, false
+	}
+	s, ok := meta[key].(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, true
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	return t, err == nil
+}
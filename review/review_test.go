@@ -0,0 +1,109 @@
+package review
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neoden/mykb/storage"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		ok   bool
+	}{
+		{"empty", Config{}, true},
+		{"policy and webhook", Config{NeverAccessed: true, Digest: DigestConfig{WebhookURL: "https://example.com/hook"}}, true},
+		{"negative age", Config{OlderThanDays: -1}, false},
+		{"digest without policy", Config{Digest: DigestConfig{WebhookURL: "https://example.com/hook"}}, false},
+		{"bad webhook", Config{NeverAccessed: true, Digest: DigestConfig{WebhookURL: "example.com"}}, false},
+		{"email without port", Config{NeverAccessed: true, Digest: DigestConfig{Email: EmailConfig{SMTPAddr: "smtp.example.com", From: "a@example.com", To: []string{"b@example.com"}}}}, false},
+		{"email without recipients", Config{NeverAccessed: true, Digest: DigestConfig{Email: EmailConfig{SMTPAddr: "smtp.example.com:587", From: "a@example.com"}}}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%s: Validate() = %v", tt.name, err)
+		}
+	}
+}
+
+func TestQueue(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	days := func(n int) time.Time { return now.Add(-time.Duration(n) * 24 * time.Hour) }
+	chunk := func(id string, created, updated time.Time, meta string) storage.Chunk {
+		c := storage.Chunk{ID: id, Content: id, CreatedAt: created, UpdatedAt: updated}
+		if meta != "" {
+			c.Metadata = json.RawMessage(meta)
+		}
+		return c
+	}
+	chunks := []storage.Chunk{
+		chunk("fresh", days(1), days(1), ""),
+		chunk("stale", days(200), days(100), ""),
+		chunk("staler", days(300), days(300), ""),
+		chunk("read-lately", days(300), days(300), ""),
+		chunk("due", days(2), days(2), `{"review_due":"2026-05-20"}`),
+		chunk("not-yet", days(2), days(2), `{"review_due":"2026-07-01"}`),
+	}
+	accessed := map[string]time.Time{
+		"stale": days(92), "staler": days(95), "read-lately": days(3), "not-yet": days(1),
+	}
+	cfg := Config{OlderThanDays: 90, NeverAccessed: true, DueKey: "review_due"}
+
+	var got []string
+	for _, it := range cfg.Queue(chunks, accessed, now, 10) {
+		got = append(got, it.ID+":"+it.Reason)
+	}
+	if strings.Join(got, " ") != "due:due staler:stale stale:stale fresh:never_accessed" {
+		t.Errorf("Queue = %v", got)
+	}
+	if q := cfg.Queue(chunks, accessed, now, 2); len(q) != 2 || q[1].ID != "staler" {
+		t.Errorf("Queue with limit 2 = %v", q)
+	}
+	if q := (Config{DueKey: "review_due"}).Queue(chunks, accessed, now, 10); len(q) != 1 || !q[0].Since.Equal(time.Date(2026, 5, 20, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("due only = %v, want the due chunk since its date", q)
+	}
+}
+
+func TestSendWebhook(t *testing.T) {
+	var got struct {
+		Items []Item `json:"items"`
+		Count int    `json:"count"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	items := []Item{{ID: "a", Reason: ReasonNeverAccessed, Since: time.Now(), Content: "a note"}}
+	if err := (DigestConfig{WebhookURL: srv.URL}).Send(context.Background(), items); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got.Count != 1 || got.Items[0].ID != "a" {
+		t.Errorf("webhook received %+v", got)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	if err := (DigestConfig{WebhookURL: failing.URL}).Send(context.Background(), items); err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("Send to failing webhook: err = %v", err)
+	}
+}
+
+func TestFormatDigest(t *testing.T) {
+	since := time.Date(2026, 5, 20, 0, 0, 0, 0, time.UTC)
+	text := FormatDigest([]Item{{ID: "a", Reason: ReasonNeverAccessed, Since: since, Content: "line one\nline two", Truncated: true}})
+	for _, want := range []string{"Chunks due for review: 1", "a (never accessed since 2026-05-20)", "line one line two..."} {
+		if !strings.Contains(text, want) {
+			t.Errorf("digest %q lacks %q", text, want)
+		}
+	}
+}
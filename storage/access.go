@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RecordAccess notes that a chunk was read just now. Read-only mirrors
+// record nothing.
+func (db *DB) RecordAccess(ctx context.Context, chunkID string) error {
+	if db.readOnly {
+		return nil
+	}
+	_, err := db.conn.ExecContext(ctx, `
+		INSERT INTO chunk_access (chunk_id, accessed_at) VALUES (?, ?)
+		ON CONFLICT(chunk_id) DO UPDATE SET accessed_at = excluded.accessed_at, count = count + 1
+	`, chunkID, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("record access: %w", err)
+	}
+	return nil
+}
+
+// AccessTimes returns when each chunk that has ever been read was last read.
+func (db *DB) AccessTimes(ctx context.Context) (map[string]time.Time, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT chunk_id, accessed_at FROM chunk_access`)
+	if err != nil {
+		return nil, fmt.Errorf("access times: %w", err)
+	}
+	defer rows.Close()
+
+	times := make(map[string]time.Time)
+	for rows.Next() {
+		var id string
+		var at int64
+		if err := rows.Scan(&id, &at); err != nil {
+			return nil, fmt.Errorf("scan access time: %w", err)
+		}
+		times[id] = time.Unix(at, 0)
+	}
+	return times, rows.Err()
+}
+
+// ChunkUsage is how often a chunk has been read and linked to.
+type ChunkUsage struct {
+	ID string `json:"id"`
+	// Content is a preview.
+	Content        string     `json:"content"`
+	Truncated      bool       `json:"truncated,omitempty"`
+	AccessCount    int        `json:"access_count"`
+	LastAccessedAt *time.Time `json:"last_accessed_at,omitempty"`
+	// Backlinks counts the chunks linking to this one with [[id]].
+	Backlinks int       `json:"backlinks"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UsageReport ranks chunks by use, to guide cleanup.
+type UsageReport struct {
+	Chunks int `json:"chunks"`
+	// Accessed counts the chunks read at least once.
+	Accessed     int          `json:"accessed"`
+	MostAccessed []ChunkUsage `json:"most_accessed"`
+	MostLinked   []ChunkUsage `json:"most_linked"`
+	// NeverTouched are chunks never read nor linked to, oldest first.
+	NeverTouched []ChunkUsage `json:"never_touched"`
+}
+
+// UsageReport lists up to limit of the most read chunks, the most linked
+// to, and those never read nor linked to.
+func (db *DB) UsageReport(ctx context.Context, limit int) (*UsageReport, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	backlinks, err := db.Backlinks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT c.id, c.created_at, COALESCE(a.count, 0), a.accessed_at
+		FROM chunks c LEFT JOIN chunk_access a ON a.chunk_id = c.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("usage report: %w", err)
+	}
+	defer rows.Close()
+
+	var all []ChunkUsage
+	for rows.Next() {
+		var u ChunkUsage
+		var at sql.NullInt64
+		if err := rows.Scan(&u.ID, &u.CreatedAt, &u.AccessCount, &at); err != nil {
+			return nil, fmt.Errorf("scan usage: %w", err)
+		}
+		if at.Valid {
+			t := time.Unix(at.Int64, 0)
+			u.LastAccessedAt = &t
+		}
+		u.Backlinks = backlinks[u.ID]
+		all = append(all, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("usage report: %w", err)
+	}
+	rows.Close()
+
+	r := &UsageReport{Chunks: len(all)}
+	var accessed, linked, untouched []ChunkUsage
+	for _, u := range all {
+		if u.AccessCount > 0 {
+			accessed = append(accessed, u)
+		}
+		if u.Backlinks > 0 {
+			linked = append(linked, u)
+		}
+		if u.AccessCount == 0 && u.Backlinks == 0 {
+			untouched = append(untouched, u)
+		}
+	}
+	r.Accessed = len(accessed)
+	sort.SliceStable(accessed, func(i, j int) bool { return accessed[i].AccessCount > accessed[j].AccessCount })
+	sort.SliceStable(linked, func(i, j int) bool { return linked[i].Backlinks > linked[j].Backlinks })
+	sort.SliceStable(untouched, func(i, j int) bool { return untouched[i].CreatedAt.Before(untouched[j].CreatedAt) })
+	if r.MostAccessed, err = db.withPreviews(ctx, accessed, limit); err != nil {
+		return nil, err
+	}
+	if r.MostLinked, err = db.withPreviews(ctx, linked, limit); err != nil {
+		return nil, err
+	}
+	if r.NeverTouched, err = db.withPreviews(ctx, untouched, limit); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// withPreviews returns the first limit usage entries with their content
+// previews.
+func (db *DB) withPreviews(ctx context.Context, usage []ChunkUsage, limit int) ([]ChunkUsage, error) {
+	out := make([]ChunkUsage, 0, min(limit, len(usage)))
+	for _, u := range usage {
+		if len(out) == limit {
+			break
+		}
+		chunk, err := db.GetChunk(ctx, u.ID)
+		if errors.Is(err, ErrChunkNotFound) {
+			continue // deleted meanwhile
+		}
+		if err != nil {
+			return nil, err
+		}
+		u.Content, u.Truncated = Truncate(chunk.Content, SearchPreviewLength)
+		out = append(out, u)
+	}
+	return out, nil
+}
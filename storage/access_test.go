@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRecordAccess(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	read, _ := db.CreateChunk(ctx, "read", nil)
+	db.CreateChunk(ctx, "unread", nil)
+
+	if err := db.RecordAccess(ctx, read.ID); err != nil {
+		t.Fatalf("RecordAccess: %v", err)
+	}
+	if err := db.RecordAccess(ctx, read.ID); err != nil {
+		t.Fatalf("RecordAccess again: %v", err)
+	}
+	times, err := db.AccessTimes(ctx)
+	if err != nil {
+		t.Fatalf("AccessTimes: %v", err)
+	}
+	if len(times) != 1 || time.Since(times[read.ID]) > time.Minute {
+		t.Errorf("AccessTimes = %v, want only the read chunk", times)
+	}
+	var count int
+	db.conn.QueryRow(`SELECT count FROM chunk_access WHERE chunk_id = ?`, read.ID).Scan(&count)
+	if count != 2 {
+		t.Errorf("access count = %d, want 2", count)
+	}
+
+	// Forgotten with the chunk
+	db.DeleteChunk(ctx, read.ID)
+	if times, _ := db.AccessTimes(ctx); len(times) != 0 {
+		t.Errorf("AccessTimes after delete = %v", times)
+	}
+}
+
+func TestUsageReport(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	hub, _ := db.CreateChunk(ctx, "hub", nil)
+	db.CreateChunk(ctx, "links to [["+hub.ID+"]]", nil)
+	often, _ := db.CreateChunk(ctx, "read often", nil)
+	old := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	db.PutChunk(ctx, &Chunk{ID: "forgotten", Content: "forgotten", CreatedAt: old, UpdatedAt: old})
+	for range 3 {
+		db.RecordAccess(ctx, often.ID)
+	}
+	db.RecordAccess(ctx, hub.ID)
+
+	r, err := db.UsageReport(ctx, 10)
+	if err != nil {
+		t.Fatalf("UsageReport: %v", err)
+	}
+	if r.Chunks != 4 || r.Accessed != 2 {
+		t.Errorf("chunks %d, accessed %d; want 4, 2", r.Chunks, r.Accessed)
+	}
+	if len(r.MostAccessed) != 2 || r.MostAccessed[0].ID != often.ID || r.MostAccessed[0].AccessCount != 3 || r.MostAccessed[0].Content != "read often" {
+		t.Errorf("MostAccessed = %+v", r.MostAccessed)
+	}
+	if len(r.MostLinked) != 1 || r.MostLinked[0].ID != hub.ID || r.MostLinked[0].Backlinks != 1 {
+		t.Errorf("MostLinked = %+v", r.MostLinked)
+	}
+	// The linking chunk is neither read nor linked to; the oldest comes first
+	if len(r.NeverTouched) != 2 || r.NeverTouched[0].ID != "forgotten" || r.NeverTouched[0].LastAccessedAt != nil {
+		t.Errorf("NeverTouched = %+v", r.NeverTouched)
+	}
+	if r, _ := db.UsageReport(ctx, 1); len(r.NeverTouched) != 1 {
+		t.Errorf("limit 1: NeverTouched = %+v", r.NeverTouched)
+	}
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrAttachmentNotFound is returned when an attachment with the specified
+// ID does not exist.
+var ErrAttachmentNotFound = errors.New("attachment not found")
+
+// DefaultAttachmentMaxMB bounds the size of an uploaded attachment.
+const DefaultAttachmentMaxMB = 25
+
+// AttachmentConfig holds attachment settings.
+type AttachmentConfig struct {
+	// MaxMB is the largest attachment accepted, in megabytes (default 25).
+	MaxMB int `toml:"max_mb"`
+}
+
+// MaxBytes returns the largest attachment accepted.
+func (c AttachmentConfig) MaxBytes() int64 {
+	mb := c.MaxMB
+	if mb <= 0 {
+		mb = DefaultAttachmentMaxMB
+	}
+	return int64(mb) << 20
+}
+
+// Attachment is a file, such as an image, PDF or recording, that a chunk
+// references. Its data is kept in the database, encrypted with the chunks,
+// and deleted with its chunk.
+type Attachment struct {
+	ID          string    `json:"id"`
+	ChunkID     string    `json:"chunk_id"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+const selectAttachments = `SELECT id, chunk_id, name, content_type, size, created_at FROM attachments `
+
+// AddAttachment stores data as an attachment of a chunk.
+func (db *DB) AddAttachment(ctx context.Context, chunkID, name, contentType string, data []byte) (*Attachment, error) {
+	var exists int
+	err := db.conn.QueryRowContext(ctx, `SELECT 1 FROM chunks WHERE id = ?`, chunkID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return nil, ErrChunkNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("check chunk: %w", err)
+	}
+
+	a := &Attachment{
+		ID:          uuid.New().String(),
+		ChunkID:     chunkID,
+		Name:        name,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		CreatedAt:   time.Now().UTC(),
+	}
+	_, err = db.conn.ExecContext(ctx, `
+		INSERT INTO attachments (id, chunk_id, name, content_type, size, data, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, a.ID, a.ChunkID, db.cipher.sealString(a.Name), a.ContentType, a.Size, db.cipher.sealBytes(data), a.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("insert attachment: %w", err)
+	}
+	return a, nil
+}
+
+// GetAttachment returns an attachment and its data.
+func (db *DB) GetAttachment(ctx context.Context, id string) (*Attachment, []byte, error) {
+	var a Attachment
+	var data []byte
+	err := db.conn.QueryRowContext(ctx, `SELECT id, chunk_id, name, content_type, size, created_at, data FROM attachments WHERE id = ?`, id).
+		Scan(&a.ID, &a.ChunkID, &a.Name, &a.ContentType, &a.Size, &a.CreatedAt, &data)
+	if err == sql.ErrNoRows {
+		return nil, nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("get attachment: %w", err)
+	}
+	if a.Name, err = db.cipher.openString(a.Name); err != nil {
+		return nil, nil, fmt.Errorf("decrypt attachment %s: %w", id, err)
+	}
+	if data, err = db.cipher.openBytes(data); err != nil {
+		return nil, nil, fmt.Errorf("decrypt attachment %s: %w", id, err)
+	}
+	return &a, data, nil
+}
+
+// ListAttachments returns the attachments of a chunk, or of every chunk if
+// chunkID is empty, oldest first.
+func (db *DB) ListAttachments(ctx context.Context, chunkID string) ([]Attachment, error) {
+	query, args := selectAttachments+`ORDER BY created_at, id`, []any(nil)
+	if chunkID != "" {
+		query, args = selectAttachments+`WHERE chunk_id = ? ORDER BY created_at, id`, []any{chunkID}
+	}
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list attachments: %w", err)
+	}
+	defer rows.Close()
+
+	attachments := []Attachment{}
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.ID, &a.ChunkID, &a.Name, &a.ContentType, &a.Size, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan attachment: %w", err)
+		}
+		if a.Name, err = db.cipher.openString(a.Name); err != nil {
+			return nil, fmt.Errorf("decrypt attachment %s: %w", a.ID, err)
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+// DeleteAttachment deletes an attachment, reporting whether it existed.
+func (db *DB) DeleteAttachment(ctx context.Context, id string) (bool, error) {
+	result, err := db.conn.ExecContext(ctx, `DELETE FROM attachments WHERE id = ?`, id)
+	if err != nil {
+		return false, fmt.Errorf("delete attachment: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("rows affected: %w", err)
+	}
+	if rows > 0 {
+		db.reclaimSpace(ctx)
+	}
+	return rows > 0, nil
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAttachments(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	chunk, _ := db.CreateChunk(ctx, "diagram of the pipeline", nil)
+	data := []byte("\x89PNG\r\n\x1a\nimage")
+
+	if _, err := db.AddAttachment(ctx, "missing", "x.png", "image/png", data); !errors.Is(err, ErrChunkNotFound) {
+		t.Errorf("AddAttachment to missing chunk: err = %v, want ErrChunkNotFound", err)
+	}
+	a, err := db.AddAttachment(ctx, chunk.ID, "pipeline.png", "image/png", data)
+	if err != nil {
+		t.Fatalf("AddAttachment: %v", err)
+	}
+	if a.Size != int64(len(data)) || a.ChunkID != chunk.ID {
+		t.Errorf("attachment = %+v", a)
+	}
+
+	got, gotData, err := db.GetAttachment(ctx, a.ID)
+	if err != nil {
+		t.Fatalf("GetAttachment: %v", err)
+	}
+	if got.Name != "pipeline.png" || got.ContentType != "image/png" || !bytes.Equal(gotData, data) {
+		t.Errorf("GetAttachment = %+v %q", got, gotData)
+	}
+	if _, _, err := db.GetAttachment(ctx, "missing"); !errors.Is(err, ErrAttachmentNotFound) {
+		t.Errorf("GetAttachment(missing): err = %v", err)
+	}
+
+	other, _ := db.CreateChunk(ctx, "other", nil)
+	db.AddAttachment(ctx, other.ID, "notes.pdf", "application/pdf", []byte("%PDF"))
+	if list, _ := db.ListAttachments(ctx, chunk.ID); len(list) != 1 || list[0].ID != a.ID {
+		t.Errorf("ListAttachments(chunk) = %+v", list)
+	}
+	if list, _ := db.ListAttachments(ctx, ""); len(list) != 2 {
+		t.Errorf("ListAttachments() = %d attachments, want 2", len(list))
+	}
+
+	if deleted, err := db.DeleteAttachment(ctx, a.ID); err != nil || !deleted {
+		t.Errorf("DeleteAttachment = %v, %v", deleted, err)
+	}
+	if deleted, _ := db.DeleteAttachment(ctx, a.ID); deleted {
+		t.Error("DeleteAttachment deleted twice")
+	}
+
+	// Deleted with their chunk
+	db.DeleteChunk(ctx, other.ID)
+	if list, _ := db.ListAttachments(ctx, ""); len(list) != 0 {
+		t.Errorf("ListAttachments after chunk delete = %+v", list)
+	}
+}
+
+func TestAttachmentsEncrypted(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	chunk, _ := db.CreateChunk(ctx, "scan", nil)
+	plain, _ := db.AddAttachment(ctx, chunk.ID, "before.txt", "text/plain", []byte("written before encryption"))
+	if err := db.SetEncryptionKey(testKey); err != nil {
+		t.Fatalf("SetEncryptionKey: %v", err)
+	}
+	sealed, _ := db.AddAttachment(ctx, chunk.ID, "receipt.txt", "text/plain", []byte("secret receipt"))
+	if _, err := db.EncryptAll(ctx, nil); err != nil {
+		t.Fatalf("EncryptAll: %v", err)
+	}
+
+	for _, a := range []*Attachment{plain, sealed} {
+		var name string
+		var data []byte
+		db.conn.QueryRow(`SELECT name, data FROM attachments WHERE id = ?`, a.ID).Scan(&name, &data)
+		if bytes.Contains(data, []byte("secret")) || bytes.Contains(data, []byte("before")) || name == a.Name {
+			t.Errorf("attachment %s stored in plaintext: %q %q", a.Name, name, data)
+		}
+	}
+	got, data, err := db.GetAttachment(ctx, sealed.ID)
+	if err != nil || got.Name != "receipt.txt" || string(data) != "secret receipt" {
+		t.Errorf("GetAttachment = %+v %q, %v", got, data, err)
+	}
+	if _, data, _ := db.GetAttachment(ctx, plain.ID); string(data) != "written before encryption" {
+		t.Errorf("GetAttachment after EncryptAll = %q", data)
+	}
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"modernc.org/sqlite"
+)
+
+// backuper is implemented by modernc.org/sqlite driver connections.
+type backuper interface {
+	NewBackup(dstUri string) (*sqlite.Backup, error)
+	NewRestore(srcUri string) (*sqlite.Backup, error)
+}
+
+// BackupInfo summarizes a backup file.
+type BackupInfo struct {
+	Chunks     int  `json:"chunks"`
+	Migrations int  `json:"migrations"`
+	Encrypted  bool `json:"encrypted"`
+}
+
+// Backup writes a consistent copy of the database to path using SQLite's
+// online backup API. Readers and writers are not blocked while it runs.
+// The file is written next to path and renamed into place when complete.
+func (db *DB) Backup(ctx context.Context, path string) error {
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	if err := db.withBackup(ctx, func(c backuper) (*sqlite.Backup, error) {
+		return c.NewBackup(tmp)
+	}); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("backup: %w", err)
+	}
+	// The copy holds password and token hashes
+	if err := os.Chmod(tmp, 0600); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("backup: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("backup: %w", err)
+	}
+	return nil
+}
+
+// Restore replaces the database contents with the backup at path and
+// brings its schema up to date. Check the file with CheckBackup first.
+// Any encryption key must be configured again afterwards.
+func (db *DB) Restore(ctx context.Context, path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	if err := db.withBackup(ctx, func(c backuper) (*sqlite.Backup, error) {
+		return c.NewRestore(path)
+	}); err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	db.cipher = nil
+	db.search.invalidate()
+	if err := db.Migrate(); err != nil {
+		return fmt.Errorf("migrate restored database: %w", err)
+	}
+	return nil
+}
+
+// withBackup runs a backup or restore created by start to completion on
+// one pooled connection.
+func (db *DB) withBackup(ctx context.Context, start func(backuper) (*sqlite.Backup, error)) error {
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		c, ok := driverConn.(backuper)
+		if !ok {
+			return errors.New("driver does not support backups")
+		}
+		b, err := start(c)
+		if err != nil {
+			return err
+		}
+		if _, err := b.Step(-1); err != nil {
+			b.Finish()
+			return err
+		}
+		return b.Finish()
+	})
+}
+
+// CheckBackup verifies that path holds an intact mykb database that this
+// version can read, and that cfg has the right key if it is encrypted.
+func CheckBackup(ctx context.Context, path string, cfg Config) (*BackupInfo, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	conn, err := sql.Open("sqlite", "file:"+filepath.ToSlash(path)+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	b := &DB{conn: conn, search: newSearchCache(), searchConfig: SearchConfig{}.withDefaults()}
+	defer b.Close()
+
+	var result string
+	if err := conn.QueryRowContext(ctx, "PRAGMA integrity_check").Scan(&result); err != nil {
+		return nil, fmt.Errorf("not a database: %w", err)
+	}
+	if result != "ok" {
+		return nil, fmt.Errorf("integrity check failed: %s", result)
+	}
+
+	info := &BackupInfo{}
+	known := make(map[string]bool, len(migrations))
+	for _, m := range migrations {
+		known[m.id] = true
+	}
+	rows, err := conn.QueryContext(ctx, "SELECT id FROM migrations")
+	if err != nil {
+		return nil, fmt.Errorf("not a mykb database: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		if !known[id] {
+			return nil, fmt.Errorf("backup was made by a newer version (migration %s)", id)
+		}
+		info.Migrations++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM chunks").Scan(&info.Chunks); err != nil {
+		return nil, fmt.Errorf("not a mykb database: %w", err)
+	}
+
+	if _, err := b.GetSetting(ctx, settingCheck); err == nil {
+		info.Encrypted = true
+		if !cfg.EncryptionEnabled() {
+			return nil, ErrEncrypted
+		}
+		if cfg.EncryptionPassphraseEnv != "" {
+			// A passphrase key derives from the salt stored in the backup
+			if _, err := b.GetSetting(ctx, settingSalt); err != nil {
+				return nil, fmt.Errorf("read salt: %w", err)
+			}
+		}
+		if err := b.ConfigureEncryption(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
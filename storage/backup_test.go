@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	chunk, _ := db.CreateChunk(ctx, "backed up", json.RawMessage(`{"k":"v"}`))
+	path := filepath.Join(t.TempDir(), "backup.db")
+	if err := db.Backup(ctx, path); err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+
+	info, err := CheckBackup(ctx, path, Config{})
+	if err != nil {
+		t.Fatalf("CheckBackup: %v", err)
+	}
+	if info.Chunks != 1 || info.Migrations != len(migrations) || info.Encrypted {
+		t.Errorf("info = %+v", info)
+	}
+
+	// Changes after the backup are rolled back by restore
+	db.DeleteChunk(ctx, chunk.ID)
+	db.CreateChunk(ctx, "written later", nil)
+
+	if err := db.Restore(ctx, path); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	got, err := db.GetChunk(ctx, chunk.ID)
+	if err != nil || got.Content != "backed up" {
+		t.Errorf("GetChunk after restore = %v, %v", got, err)
+	}
+	if n, _ := db.CountChunks(ctx); n != 1 {
+		t.Errorf("CountChunks = %d, want 1", n)
+	}
+	results, _ := db.SearchChunks(ctx, "backed", 10)
+	if len(results) != 1 {
+		t.Errorf("SearchChunks after restore = %d results", len(results))
+	}
+}
+
+func TestCheckBackupRejects(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	if _, err := CheckBackup(ctx, filepath.Join(dir, "missing.db"), Config{}); err == nil {
+		t.Error("expected error for missing file")
+	}
+
+	// A SQLite file without the mykb schema
+	other, _ := Open(filepath.Join(dir, "other.db"))
+	other.conn.Exec("CREATE TABLE t (x)")
+	other.Close()
+	if _, err := CheckBackup(ctx, filepath.Join(dir, "other.db"), Config{}); err == nil || !strings.Contains(err.Error(), "not a mykb database") {
+		t.Errorf("foreign database error = %v", err)
+	}
+
+	// A backup from a newer schema
+	db := setupTestDB(t)
+	db.conn.Exec("INSERT INTO migrations (id) VALUES ('999_future')")
+	newer := filepath.Join(dir, "newer.db")
+	db.Backup(context.Background(), newer)
+	if _, err := CheckBackup(ctx, newer, Config{}); err == nil || !strings.Contains(err.Error(), "newer version") {
+		t.Errorf("newer backup error = %v", err)
+	}
+}
+
+func TestCheckBackupEncrypted(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	t.Setenv("MYKB_TEST_PASSPHRASE", "backup passphrase")
+	cfg := Config{EncryptionPassphraseEnv: "MYKB_TEST_PASSPHRASE"}
+	if err := db.ConfigureEncryption(cfg); err != nil {
+		t.Fatalf("ConfigureEncryption: %v", err)
+	}
+	db.CreateChunk(ctx, "secret", nil)
+
+	path := filepath.Join(t.TempDir(), "backup.db")
+	if err := db.Backup(context.Background(), path); err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+
+	if _, err := CheckBackup(ctx, path, Config{}); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("no key error = %v, want ErrEncrypted", err)
+	}
+	info, err := CheckBackup(ctx, path, cfg)
+	if err != nil || !info.Encrypted {
+		t.Errorf("CheckBackup = %+v, %v", info, err)
+	}
+	t.Setenv("MYKB_TEST_PASSPHRASE", "wrong")
+	if _, err := CheckBackup(ctx, path, cfg); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("wrong key error = %v, want ErrWrongKey", err)
+	}
+}
@@ -1,10 +1,12 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -28,30 +30,35 @@ type SearchResult struct {
 	Content  string          `json:"content"`
 	Metadata json.RawMessage `json:"metadata,omitempty"`
 	Snippet  string          `json:"snippet"`
+	// SnippetText is Snippet without the highlight markers, and Highlights
+	// the byte ranges of its matches, for clients that render highlights
+	// themselves.
+	SnippetText string `json:"snippet_text,omitempty"`
+	Highlights  []Span `json:"highlights,omitempty"`
+	// Truncated is true when Content is a shortened preview.
+	Truncated bool `json:"truncated,omitempty"`
 }
 
 // CreateChunk creates a new chunk.
-func (db *DB) CreateChunk(content string, metadata json.RawMessage) (*Chunk, error) {
-	return createChunk(db.conn, content, metadata)
+func (db *DB) CreateChunk(ctx context.Context, content string, metadata json.RawMessage) (*Chunk, error) {
+	defer db.search.invalidate()
+	return createChunk(ctx, db.conn, db.cipher, content, metadata)
 }
 
-func createChunk(exec sqlExecutor, content string, metadata json.RawMessage) (*Chunk, error) {
+func createChunk(ctx context.Context, exec sqlExecutor, c *fieldCipher, content string, metadata json.RawMessage) (*Chunk, error) {
 	id := uuid.New().String()
 	now := time.Now().UTC()
 
-	var metaStr *string
-	if len(metadata) > 0 {
-		s := string(metadata)
-		metaStr = &s
-	}
-
-	_, err := exec.Exec(`
+	_, err := exec.ExecContext(ctx, `
 		INSERT INTO chunks (id, content, metadata, created_at, updated_at)
 		VALUES (?, ?, ?, ?, ?)
-	`, id, content, metaStr, now, now)
+	`, id, c.sealString(content), c.sealMetadata(metadata), now, now)
 	if err != nil {
 		return nil, fmt.Errorf("insert chunk: %w", err)
 	}
+	if err := setLinks(ctx, exec, id, content); err != nil {
+		return nil, err
+	}
 
 	return &Chunk{
 		ID:        id,
@@ -62,16 +69,38 @@ func createChunk(exec sqlExecutor, content string, metadata json.RawMessage) (*C
 	}, nil
 }
 
+// PutChunk stores c with its own ID and timestamps, replacing any chunk
+// with the same ID. It is used to import chunks from another knowledge base.
+func (db *DB) PutChunk(ctx context.Context, c *Chunk) error {
+	defer db.search.invalidate()
+	_, err := db.conn.ExecContext(ctx, `
+		INSERT INTO chunks (id, content, metadata, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			content = excluded.content,
+			metadata = excluded.metadata,
+			created_at = excluded.created_at,
+			updated_at = excluded.updated_at
+	`, c.ID, db.cipher.sealString(c.Content), db.cipher.sealMetadata(c.Metadata), c.CreatedAt.UTC(), c.UpdatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("put chunk: %w", err)
+	}
+	if _, err := db.conn.ExecContext(ctx, `DELETE FROM chunk_tombstones WHERE chunk_id = ?`, c.ID); err != nil {
+		return fmt.Errorf("put chunk: %w", err)
+	}
+	return setLinks(ctx, db.conn, c.ID, c.Content)
+}
+
 // GetChunk retrieves a chunk by ID.
-func (db *DB) GetChunk(id string) (*Chunk, error) {
-	return getChunk(db.conn, id)
+func (db *DB) GetChunk(ctx context.Context, id string) (*Chunk, error) {
+	return getChunk(ctx, db.conn, db.cipher, id)
 }
 
-func getChunk(exec sqlExecutor, id string) (*Chunk, error) {
+func getChunk(ctx context.Context, exec sqlExecutor, c *fieldCipher, id string) (*Chunk, error) {
 	var chunk Chunk
 	var metaStr sql.NullString
 
-	err := exec.QueryRow(`
+	err := exec.QueryRowContext(ctx, `
 		SELECT id, content, metadata, created_at, updated_at
 		FROM chunks WHERE id = ?
 	`, id).Scan(&chunk.ID, &chunk.Content, &metaStr, &chunk.CreatedAt, &chunk.UpdatedAt)
@@ -86,19 +115,86 @@ func getChunk(exec sqlExecutor, id string) (*Chunk, error) {
 	if metaStr.Valid {
 		chunk.Metadata = json.RawMessage(metaStr.String)
 	}
+	if err := c.openChunk(&chunk); err != nil {
+		return nil, fmt.Errorf("get chunk: %w", err)
+	}
 
 	return &chunk, nil
 }
 
+// UpdatedTimes returns when each of the given chunks was last updated;
+// missing chunks are left out.
+func (db *DB) UpdatedTimes(ctx context.Context, ids []string) (map[string]time.Time, error) {
+	return db.chunkTimes(ctx, "updated_at", ids)
+}
+
+// CreatedTimes returns when each of the given chunks was created; missing
+// chunks are left out.
+func (db *DB) CreatedTimes(ctx context.Context, ids []string) (map[string]time.Time, error) {
+	return db.chunkTimes(ctx, "created_at", ids)
+}
+
+// chunkTimes reads a timestamp column of the given chunks.
+func (db *DB) chunkTimes(ctx context.Context, column string, ids []string) (map[string]time.Time, error) {
+	times := make(map[string]time.Time, len(ids))
+	for start := 0; start < len(ids); start += loadBatch {
+		batch := ids[start:min(start+loadBatch, len(ids))]
+		args := make([]any, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+		rows, err := db.conn.QueryContext(ctx, `SELECT id, `+column+` FROM chunks WHERE id IN (?`+strings.Repeat(",?", len(batch)-1)+`)`, args...)
+		if err != nil {
+			return nil, fmt.Errorf("chunk times: %w", err)
+		}
+		for rows.Next() {
+			var id string
+			var t time.Time
+			if err := rows.Scan(&id, &t); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("scan %s: %w", column, err)
+			}
+			times[id] = t
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("chunk times: %w", err)
+		}
+	}
+	return times, nil
+}
+
 // GetAllChunks returns all chunks.
-func (db *DB) GetAllChunks() ([]Chunk, error) {
-	rows, err := db.conn.Query(`
+func (db *DB) GetAllChunks(ctx context.Context) ([]Chunk, error) {
+	rows, err := db.conn.QueryContext(ctx, `
 		SELECT id, content, metadata, created_at, updated_at
 		FROM chunks ORDER BY created_at
 	`)
 	if err != nil {
 		return nil, fmt.Errorf("get all chunks: %w", err)
 	}
+	return db.readChunks(rows)
+}
+
+// GetChunksPage returns up to limit chunks with IDs after afterID, in ID
+// order, for walking every chunk without holding them all: start with
+// an empty afterID and continue after the last ID of each page until one
+// comes back empty.
+func (db *DB) GetChunksPage(ctx context.Context, afterID string, limit int) ([]Chunk, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT id, content, metadata, created_at, updated_at
+		FROM chunks WHERE id > ? ORDER BY id LIMIT ?
+	`, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("get chunks page: %w", err)
+	}
+	return db.readChunks(rows)
+}
+
+// readChunks reads and closes rows of id, content, metadata, created_at
+// and updated_at.
+func (db *DB) readChunks(rows *sql.Rows) ([]Chunk, error) {
 	defer rows.Close()
 
 	var chunks []Chunk
@@ -111,18 +207,22 @@ func (db *DB) GetAllChunks() ([]Chunk, error) {
 		if metaStr.Valid {
 			chunk.Metadata = json.RawMessage(metaStr.String)
 		}
+		if err := db.cipher.openChunk(&chunk); err != nil {
+			return nil, fmt.Errorf("chunk %s: %w", chunk.ID, err)
+		}
 		chunks = append(chunks, chunk)
 	}
 	return chunks, rows.Err()
 }
 
 // UpdateChunk updates an existing chunk.
-func (db *DB) UpdateChunk(id string, content *string, metadata json.RawMessage) (*Chunk, error) {
-	return updateChunk(db.conn, id, content, metadata)
+func (db *DB) UpdateChunk(ctx context.Context, id string, content *string, metadata json.RawMessage) (*Chunk, error) {
+	defer db.search.invalidate()
+	return updateChunk(ctx, db.conn, db.cipher, id, content, metadata)
 }
 
-func updateChunk(exec sqlExecutor, id string, content *string, metadata json.RawMessage) (*Chunk, error) {
-	existing, err := getChunk(exec, id)
+func updateChunk(ctx context.Context, exec sqlExecutor, c *fieldCipher, id string, content *string, metadata json.RawMessage) (*Chunk, error) {
+	existing, err := getChunk(ctx, exec, c, id)
 	if err != nil {
 		return nil, err // ErrChunkNotFound propagates here
 	}
@@ -139,19 +239,18 @@ func updateChunk(exec sqlExecutor, id string, content *string, metadata json.Raw
 		newMeta = metadata
 	}
 
-	var metaStr *string
-	if len(newMeta) > 0 {
-		s := string(newMeta)
-		metaStr = &s
-	}
-
-	_, err = exec.Exec(`
+	_, err = exec.ExecContext(ctx, `
 		UPDATE chunks SET content = ?, metadata = ?, updated_at = ?
 		WHERE id = ?
-	`, newContent, metaStr, now, id)
+	`, c.sealString(newContent), c.sealMetadata(newMeta), now, id)
 	if err != nil {
 		return nil, fmt.Errorf("update chunk: %w", err)
 	}
+	if content != nil {
+		if err := setLinks(ctx, exec, id, newContent); err != nil {
+			return nil, err
+		}
+	}
 
 	return &Chunk{
 		ID:        id,
@@ -162,9 +261,19 @@ func updateChunk(exec sqlExecutor, id string, content *string, metadata json.Raw
 	}, nil
 }
 
-// DeleteChunk deletes a chunk by ID.
-func (db *DB) DeleteChunk(id string) (bool, error) {
-	result, err := db.conn.Exec("DELETE FROM chunks WHERE id = ?", id)
+// DeleteChunk deletes a chunk by ID, leaving a tombstone (see ChangesSince).
+func (db *DB) DeleteChunk(ctx context.Context, id string) (bool, error) {
+	defer db.search.invalidate()
+	deleted, err := deleteChunk(ctx, db.conn, id)
+	if deleted && err == nil {
+		db.reclaimSpace(ctx)
+	}
+	return deleted, err
+}
+
+// deleteChunk deletes a chunk and records its tombstone.
+func deleteChunk(ctx context.Context, exec sqlExecutor, id string) (bool, error) {
+	result, err := exec.ExecContext(ctx, "DELETE FROM chunks WHERE id = ?", id)
 	if err != nil {
 		return false, fmt.Errorf("delete chunk: %w", err)
 	}
@@ -174,38 +283,117 @@ func (db *DB) DeleteChunk(id string) (bool, error) {
 		return false, fmt.Errorf("rows affected: %w", err)
 	}
 
+	if rows > 0 {
+		if err := addTombstone(ctx, exec, id); err != nil {
+			return true, err
+		}
+	}
 	return rows > 0, nil
 }
 
 // SearchChunks performs full-text search.
-func (db *DB) SearchChunks(query string, limit int) ([]SearchResult, error) {
+// Results are cached until the next chunk mutation, by any process.
+func (db *DB) SearchChunks(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	return db.SearchChunksMatching(ctx, query, limit, MatchExact)
+}
+
+// SearchChunksMatching performs full-text search, matching words as mode
+// selects. Results are cached until the next chunk mutation, by any process.
+func (db *DB) SearchChunksMatching(ctx context.Context, query string, limit int, mode MatchMode) ([]SearchResult, error) {
 	if limit <= 0 {
 		limit = 20
 	} else if limit > 100 {
 		limit = 100
 	}
 
+	db.externalWrites(ctx)
+	key := searchCacheKey{query: query, limit: limit, mode: mode}
+	if results, ok := db.search.get(key); ok {
+		return results, nil
+	}
+	gen := db.search.generation()
+
+	results, err := db.searchChunks(ctx, query, limit, mode)
+	if err != nil {
+		return nil, err
+	}
+	db.search.put(key, gen, results)
+	return results, nil
+}
+
+func (db *DB) searchChunks(ctx context.Context, query string, limit int, mode MatchMode) ([]SearchResult, error) {
 	// Wildcard: return recent chunks
 	if query == "*" {
-		return db.listChunks(limit)
+		return db.listChunks(ctx, limit)
+	}
+	// The FTS index only sees ciphertext; scanning matches substrings,
+	// which covers prefixes
+	if db.cipher != nil {
+		return db.scanChunks(ctx, query, limit)
+	}
+
+	switch mode {
+	case MatchPrefix:
+		query = prefixFTSQuery(query)
+		if query == "" {
+			return nil, nil
+		}
+	case MatchFuzzy:
+		if !db.trigram {
+			return nil, ErrFuzzyDisabled
+		}
+		if q, trigrams := trigramQuery(query); q != "" {
+			results, err := db.fuzzySearch(ctx, q, trigrams, limit)
+			if err != nil {
+				return nil, fmt.Errorf("search chunks: %w", err)
+			}
+			return results, nil
+		}
+		// Words too short for trigrams
+		if query = prefixFTSQuery(query); query == "" {
+			return nil, nil
+		}
 	}
 
-	rows, err := db.conn.Query(`
+	results, err := db.ftsSearch(ctx, "chunks_fts", query, limit, nil)
+	if err != nil && ftsSyntaxError(err) {
+		// Queries written by models often trip over FTS5 syntax; search
+		// for their words instead
+		quoted := quoteFTSQuery(query)
+		if quoted == "" {
+			return nil, nil
+		}
+		results, err = db.ftsSearch(ctx, "chunks_fts", quoted, limit, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("search chunks: %w", err)
+	}
+	return results, nil
+}
+
+// ftsSearch runs an FTS5 query on table, chunks_fts or chunks_trigram,
+// returning the first limit matches that keep accepts (all if nil), out of
+// fuzzyCandidates times as many.
+func (db *DB) ftsSearch(ctx context.Context, table, query string, limit int, keep func(content, metadata string) bool) ([]SearchResult, error) {
+	fetch := limit
+	if keep != nil {
+		fetch *= fuzzyCandidates
+	}
+	// Columns are id, content, metadata
+	cfg := db.searchConfig
+	rows, err := db.conn.QueryContext(ctx, `
 		SELECT c.id,
-		       CASE WHEN length(c.content) > 80
-		            THEN substr(c.content, 1, 80) || '...'
-		            ELSE c.content
-		       END as content,
+		       c.content,
 		       c.metadata,
-		       snippet(chunks_fts, 1, '<mark>', '</mark>', '...', 32) as snippet
-		FROM chunks_fts fts
+		       snippet(`+table+`, 1, ?, ?, ?, ?) as snippet
+		FROM `+table+` fts
 		JOIN chunks c ON fts.id = c.id
-		WHERE chunks_fts MATCH ?
-		ORDER BY rank
+		WHERE `+table+` MATCH ?
+		ORDER BY bm25(`+table+`, 1, ?, ?)
 		LIMIT ?
-	`, query, limit)
+	`, rawMarkStart, rawMarkEnd, cfg.Ellipsis, cfg.SnippetTokens, query, cfg.ContentWeight, cfg.MetadataWeight, fetch)
 	if err != nil {
-		return nil, fmt.Errorf("search chunks: %w", err)
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -217,6 +405,14 @@ func (db *DB) SearchChunks(query string, limit int) ([]SearchResult, error) {
 		if err := rows.Scan(&r.ID, &r.Content, &metaStr, &r.Snippet); err != nil {
 			return nil, fmt.Errorf("scan result: %w", err)
 		}
+		if keep != nil && !keep(r.Content, metaStr.String) {
+			continue
+		}
+		r.Snippet, r.SnippetText, r.Highlights = cfg.markSnippet(r.Snippet)
+		if len(results) == limit {
+			break
+		}
+		r.Content, r.Truncated = Truncate(r.Content, SearchPreviewLength)
 
 		if metaStr.Valid {
 			r.Metadata = json.RawMessage(metaStr.String)
@@ -229,19 +425,22 @@ func (db *DB) SearchChunks(query string, limit int) ([]SearchResult, error) {
 }
 
 // GetMetadataIndex returns aggregated metadata keys with top values.
-func (db *DB) GetMetadataIndex(topN int) (map[string]interface{}, error) {
+func (db *DB) GetMetadataIndex(ctx context.Context, topN int) (map[string]interface{}, error) {
 	if topN <= 0 {
 		topN = 20
 	}
+	if db.cipher != nil {
+		return db.scanMetadataIndex(ctx, topN)
+	}
 
 	// Get total count
 	var total int
-	if err := db.conn.QueryRow("SELECT COUNT(*) FROM chunks").Scan(&total); err != nil {
+	if err := db.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM chunks").Scan(&total); err != nil {
 		return nil, fmt.Errorf("count chunks: %w", err)
 	}
 
 	// Aggregate metadata
-	rows, err := db.conn.Query(`
+	rows, err := db.conn.QueryContext(ctx, `
 		SELECT key, val, SUM(count) as count FROM (
 			SELECT j.key as key, j.value as val, COUNT(*) as count
 			FROM chunks c, json_each(c.metadata) j
@@ -286,12 +485,15 @@ func (db *DB) GetMetadataIndex(topN int) (map[string]interface{}, error) {
 }
 
 // GetMetadataValues returns all values for a specific metadata key.
-func (db *DB) GetMetadataValues(key string, topN int) (map[string]interface{}, error) {
+func (db *DB) GetMetadataValues(ctx context.Context, key string, topN int) (map[string]interface{}, error) {
 	if topN <= 0 {
 		topN = 50
 	}
+	if db.cipher != nil {
+		return db.scanMetadataValues(ctx, key, topN)
+	}
 
-	rows, err := db.conn.Query(`
+	rows, err := db.conn.QueryContext(ctx, `
 		SELECT val, SUM(count) as count FROM (
 			SELECT j.value as val, COUNT(*) as count
 			FROM chunks c, json_each(c.metadata) j
@@ -330,15 +532,56 @@ func (db *DB) GetMetadataValues(key string, topN int) (map[string]interface{}, e
 	}, rows.Err()
 }
 
+// FilterChunkIDs returns the IDs of chunks whose metadata has every key in
+// filter with the given value; an array matches if it contains the value.
+// Values compare as get_metadata_values reports them, so 2 matches "2".
+func (db *DB) FilterChunkIDs(ctx context.Context, filter map[string]any) ([]string, error) {
+	want := make(map[string]string, len(filter))
+	for k, v := range filter {
+		s, ok := metadataValueString(v)
+		if !ok {
+			return nil, fmt.Errorf("metadata filter %q: null never matches", k)
+		}
+		want[k] = s
+	}
+	if db.cipher != nil {
+		return db.scanFilterChunkIDs(ctx, want)
+	}
+
+	var conds []string
+	var args []any
+	for k, v := range want {
+		conds = append(conds, `EXISTS (
+			SELECT 1 FROM json_each(c.metadata) j WHERE j.key = ? AND (
+				j.type != 'array' AND CAST(j.value AS TEXT) = ?
+				OR j.type = 'array' AND EXISTS (SELECT 1 FROM json_each(j.value) je WHERE CAST(je.value AS TEXT) = ?)))`)
+		args = append(args, k, v, v)
+	}
+	query := `SELECT id FROM chunks c`
+	if len(conds) > 0 {
+		query += ` WHERE ` + strings.Join(conds, ` AND `)
+	}
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("filter chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan chunk id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
 // listChunks returns recent chunks (for wildcard query).
-func (db *DB) listChunks(limit int) ([]SearchResult, error) {
-	rows, err := db.conn.Query(`
-		SELECT id,
-		       CASE WHEN length(content) > 80
-		            THEN substr(content, 1, 80) || '...'
-		            ELSE content
-		       END,
-		       metadata
+func (db *DB) listChunks(ctx context.Context, limit int) ([]SearchResult, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT id, content, metadata
 		FROM chunks
 		ORDER BY updated_at DESC
 		LIMIT ?
@@ -358,8 +601,21 @@ func (db *DB) listChunks(limit int) ([]SearchResult, error) {
 		if metaStr.Valid {
 			r.Metadata = json.RawMessage(metaStr.String)
 		}
+		if err := db.cipher.openResult(&r); err != nil {
+			return nil, fmt.Errorf("chunk %s: %w", r.ID, err)
+		}
+		r.Content, r.Truncated = Truncate(r.Content, SearchPreviewLength)
 		r.Snippet = r.Content
 		results = append(results, r)
 	}
 	return results, rows.Err()
 }
+
+// CountChunks returns the number of stored chunks.
+func (db *DB) CountChunks(ctx context.Context) (int, error) {
+	var n int
+	if err := db.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM chunks").Scan(&n); err != nil {
+		return 0, fmt.Errorf("count chunks: %w", err)
+	}
+	return n, nil
+}
@@ -1,11 +1,15 @@
 package storage
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
 func setupTestDB(t *testing.T) *DB {
@@ -23,9 +27,10 @@ func setupTestDB(t *testing.T) *DB {
 }
 
 func TestCreateChunk(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	chunk, err := db.CreateChunk("Hello world", nil)
+	chunk, err := db.CreateChunk(ctx, "Hello world", nil)
 	if err != nil {
 		t.Fatalf("CreateChunk: %v", err)
 	}
@@ -42,16 +47,17 @@ func TestCreateChunk(t *testing.T) {
 }
 
 func TestCreateChunkWithMetadata(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
 	meta := json.RawMessage(`{"tags":["test","go"],"priority":1}`)
-	chunk, err := db.CreateChunk("Test content", meta)
+	chunk, err := db.CreateChunk(ctx, "Test content", meta)
 	if err != nil {
 		t.Fatalf("CreateChunk: %v", err)
 	}
 
 	// Verify metadata is stored
-	got, err := db.GetChunk(chunk.ID)
+	got, err := db.GetChunk(ctx, chunk.ID)
 	if err != nil {
 		t.Fatalf("GetChunk: %v", err)
 	}
@@ -67,11 +73,12 @@ func TestCreateChunkWithMetadata(t *testing.T) {
 }
 
 func TestGetChunk(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	created, _ := db.CreateChunk("Test", nil)
+	created, _ := db.CreateChunk(ctx, "Test", nil)
 
-	got, err := db.GetChunk(created.ID)
+	got, err := db.GetChunk(ctx, created.ID)
 	if err != nil {
 		t.Fatalf("GetChunk: %v", err)
 	}
@@ -81,13 +88,14 @@ func TestGetChunk(t *testing.T) {
 }
 
 func TestGetAllChunks(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	db.CreateChunk("First", nil)
-	db.CreateChunk("Second", nil)
-	db.CreateChunk("Third", nil)
+	db.CreateChunk(ctx, "First", nil)
+	db.CreateChunk(ctx, "Second", nil)
+	db.CreateChunk(ctx, "Third", nil)
 
-	chunks, err := db.GetAllChunks()
+	chunks, err := db.GetAllChunks(ctx)
 	if err != nil {
 		t.Fatalf("GetAllChunks: %v", err)
 	}
@@ -98,9 +106,10 @@ func TestGetAllChunks(t *testing.T) {
 }
 
 func TestGetAllChunksEmpty(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	chunks, err := db.GetAllChunks()
+	chunks, err := db.GetAllChunks(ctx)
 	if err != nil {
 		t.Fatalf("GetAllChunks: %v", err)
 	}
@@ -110,10 +119,41 @@ func TestGetAllChunksEmpty(t *testing.T) {
 	}
 }
 
+func TestGetChunksPage(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	for _, c := range []string{"a", "b", "c", "d", "e"} {
+		db.CreateChunk(ctx, c, nil)
+	}
+
+	var ids []string
+	after := ""
+	for pages := 0; ; pages++ {
+		page, err := db.GetChunksPage(ctx, after, 2)
+		if err != nil {
+			t.Fatalf("GetChunksPage: %v", err)
+		}
+		if len(page) == 0 {
+			if pages != 3 {
+				t.Errorf("pages = %d, want 3", pages)
+			}
+			break
+		}
+		for _, c := range page {
+			ids = append(ids, c.ID)
+		}
+		after = page[len(page)-1].ID
+	}
+	if len(ids) != 5 || !sort.StringsAreSorted(ids) {
+		t.Errorf("ids = %v, want all 5 in order", ids)
+	}
+}
+
 func TestGetChunkNotFound(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	got, err := db.GetChunk("nonexistent-id")
+	got, err := db.GetChunk(ctx, "nonexistent-id")
 	if !errors.Is(err, ErrChunkNotFound) {
 		t.Errorf("GetChunk error = %v, want ErrChunkNotFound", err)
 	}
@@ -123,12 +163,13 @@ func TestGetChunkNotFound(t *testing.T) {
 }
 
 func TestUpdateChunk(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	created, _ := db.CreateChunk("Original", nil)
+	created, _ := db.CreateChunk(ctx, "Original", nil)
 
 	newContent := "Updated"
-	updated, err := db.UpdateChunk(created.ID, &newContent, nil)
+	updated, err := db.UpdateChunk(ctx, created.ID, &newContent, nil)
 	if err != nil {
 		t.Fatalf("UpdateChunk: %v", err)
 	}
@@ -142,12 +183,13 @@ func TestUpdateChunk(t *testing.T) {
 }
 
 func TestUpdateChunkMetadataOnly(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	created, _ := db.CreateChunk("Content", json.RawMessage(`{"v":1}`))
+	created, _ := db.CreateChunk(ctx, "Content", json.RawMessage(`{"v":1}`))
 
 	newMeta := json.RawMessage(`{"v":2}`)
-	updated, err := db.UpdateChunk(created.ID, nil, newMeta)
+	updated, err := db.UpdateChunk(ctx, created.ID, nil, newMeta)
 	if err != nil {
 		t.Fatalf("UpdateChunk: %v", err)
 	}
@@ -164,10 +206,11 @@ func TestUpdateChunkMetadataOnly(t *testing.T) {
 }
 
 func TestUpdateChunkNotFound(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
 	content := "test"
-	updated, err := db.UpdateChunk("nonexistent", &content, nil)
+	updated, err := db.UpdateChunk(ctx, "nonexistent", &content, nil)
 	if !errors.Is(err, ErrChunkNotFound) {
 		t.Errorf("UpdateChunk error = %v, want ErrChunkNotFound", err)
 	}
@@ -177,11 +220,12 @@ func TestUpdateChunkNotFound(t *testing.T) {
 }
 
 func TestDeleteChunk(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	created, _ := db.CreateChunk("To delete", nil)
+	created, _ := db.CreateChunk(ctx, "To delete", nil)
 
-	deleted, err := db.DeleteChunk(created.ID)
+	deleted, err := db.DeleteChunk(ctx, created.ID)
 	if err != nil {
 		t.Fatalf("DeleteChunk: %v", err)
 	}
@@ -190,16 +234,17 @@ func TestDeleteChunk(t *testing.T) {
 	}
 
 	// Verify it's gone
-	_, err = db.GetChunk(created.ID)
+	_, err = db.GetChunk(ctx, created.ID)
 	if !errors.Is(err, ErrChunkNotFound) {
 		t.Errorf("GetChunk after delete: error = %v, want ErrChunkNotFound", err)
 	}
 }
 
 func TestDeleteChunkNotFound(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	deleted, err := db.DeleteChunk("nonexistent")
+	deleted, err := db.DeleteChunk(ctx, "nonexistent")
 	if err != nil {
 		t.Fatalf("DeleteChunk: %v", err)
 	}
@@ -208,14 +253,82 @@ func TestDeleteChunkNotFound(t *testing.T) {
 	}
 }
 
+func TestPutChunk(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+
+	created := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	c := &Chunk{ID: "imported-1", Content: "imported walrus", Metadata: json.RawMessage(`{"k":"v"}`), CreatedAt: created, UpdatedAt: created}
+	if err := db.PutChunk(ctx, c); err != nil {
+		t.Fatalf("PutChunk: %v", err)
+	}
+	got, err := db.GetChunk(ctx, "imported-1")
+	if err != nil {
+		t.Fatalf("GetChunk: %v", err)
+	}
+	if got.Content != "imported walrus" || !got.CreatedAt.Equal(created) {
+		t.Errorf("GetChunk = %+v", got)
+	}
+
+	c.Content = "replaced narwhal"
+	if err := db.PutChunk(ctx, c); err != nil {
+		t.Fatalf("PutChunk replace: %v", err)
+	}
+	if n, _ := db.CountChunks(ctx); n != 1 {
+		t.Errorf("CountChunks = %d, want 1", n)
+	}
+	if results, _ := db.SearchChunks(ctx, "narwhal", 10); len(results) != 1 {
+		t.Errorf("search after replace = %d results, want 1", len(results))
+	}
+	if results, _ := db.SearchChunks(ctx, "walrus", 10); len(results) != 0 {
+		t.Errorf("old content still indexed")
+	}
+}
+
+func TestUpdatedTimes(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+
+	old := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	db.PutChunk(ctx, &Chunk{ID: "old", Content: "old", CreatedAt: old, UpdatedAt: old})
+	fresh, _ := db.CreateChunk(ctx, "fresh", nil)
+
+	times, err := db.UpdatedTimes(ctx, []string{"old", fresh.ID, "missing"})
+	if err != nil {
+		t.Fatalf("UpdatedTimes: %v", err)
+	}
+	if len(times) != 2 || !times["old"].Equal(old) || time.Since(times[fresh.ID]) > time.Minute {
+		t.Errorf("UpdatedTimes = %v", times)
+	}
+}
+
+func TestFacetChunks(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	a, _ := db.CreateChunk(ctx, "a", json.RawMessage(`{"tags":["go","sql"],"type":"note"}`))
+	b, _ := db.CreateChunk(ctx, "b", json.RawMessage(`{"tags":["go"]}`))
+	c, _ := db.CreateChunk(ctx, "c", json.RawMessage(`{"tags":["rust"]}`))
+	db.CreateChunk(ctx, "d", json.RawMessage(`{"tags":["go"]}`))
+
+	facet, err := db.FacetChunks(ctx, []string{a.ID, b.ID, c.ID, "missing"}, "tags", 2)
+	if err != nil {
+		t.Fatalf("FacetChunks: %v", err)
+	}
+	values := facet["values"].(map[string]int)
+	if facet["key"] != "tags" || len(values) != 2 || values["go"] != 2 {
+		t.Errorf("FacetChunks = %v, want go 2 and one other tag", facet)
+	}
+}
+
 func TestSearchChunks(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	db.CreateChunk("The quick brown fox jumps over the lazy dog", nil)
-	db.CreateChunk("Hello world from Go", nil)
-	db.CreateChunk("Another test document", nil)
+	db.CreateChunk(ctx, "The quick brown fox jumps over the lazy dog", nil)
+	db.CreateChunk(ctx, "Hello world from Go", nil)
+	db.CreateChunk(ctx, "Another test document", nil)
 
-	results, err := db.SearchChunks("fox", 10)
+	results, err := db.SearchChunks(ctx, "fox", 10)
 	if err != nil {
 		t.Fatalf("SearchChunks: %v", err)
 	}
@@ -228,14 +341,195 @@ func TestSearchChunks(t *testing.T) {
 	}
 }
 
+func TestSearchChunksWeights(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+
+	tagged, _ := db.CreateChunk(ctx, "Shopping list for the week", json.RawMessage(`{"tags":["walrus"]}`))
+	content, _ := db.CreateChunk(ctx, "The walrus hauls out on the ice floes in large herds every summer", nil)
+
+	first := func() string {
+		results, err := db.SearchChunks(ctx, "walrus", 10)
+		if err != nil || len(results) != 2 {
+			t.Fatalf("SearchChunks = %v, %v", results, err)
+		}
+		return results[0].ID
+	}
+	if first() != content.ID {
+		t.Error("metadata-only match outranks the content match")
+	}
+	db.ConfigureSearch(SearchConfig{MetadataWeight: 10})
+	if first() != tagged.ID {
+		t.Error("metadata_weight did not lift the tagged chunk")
+	}
+
+	db.ConfigureSearch(SearchConfig{SnippetTokens: 4, HighlightStart: "[", HighlightEnd: "]", Ellipsis: "~"})
+	results, _ := db.SearchChunks(ctx, "herds", 10)
+	if len(results) != 1 || !strings.Contains(results[0].Snippet, "[herds]") || !strings.HasPrefix(results[0].Snippet, "~") {
+		t.Errorf("snippet = %q, want [herds] after ~", results[0].Snippet)
+	}
+}
+
+func TestSearchChunksHighlights(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	db.CreateChunk(ctx, "Write <mark> tags around the walrus, then feed the walrus", nil)
+
+	results, err := db.SearchChunks(ctx, "walrus", 10)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("SearchChunks = %v, %v", results, err)
+	}
+	r := results[0]
+	if r.SnippetText != "Write <mark> tags around the walrus, then feed the walrus" {
+		t.Errorf("SnippetText = %q", r.SnippetText)
+	}
+	if len(r.Highlights) != 2 {
+		t.Fatalf("Highlights = %v, want 2", r.Highlights)
+	}
+	for _, h := range r.Highlights {
+		if got := r.SnippetText[h.Start:h.End]; got != "walrus" {
+			t.Errorf("highlight %v = %q, want walrus", h, got)
+		}
+	}
+	if !strings.Contains(r.Snippet, "the <mark>walrus</mark>, then") {
+		t.Errorf("Snippet = %q", r.Snippet)
+	}
+}
+
+func TestSearchChunksSyntaxErrors(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	db.CreateChunk(ctx, "Notes on c++ templates: what's the rule of three?", nil)
+
+	// Each is rejected by FTS5 and searched for its words instead
+	for _, q := range []string{`"templates`, `templates AND`, `rule:three`, `c++`, `what's`, `three?`, `templ* (`} {
+		results, err := db.SearchChunks(ctx, q, 10)
+		if err != nil {
+			t.Errorf("SearchChunks(%q): %v", q, err)
+		} else if len(results) != 1 {
+			t.Errorf("SearchChunks(%q) = %d results, want 1", q, len(results))
+		}
+	}
+	if results, err := db.SearchChunks(ctx, `( )`, 10); err != nil || len(results) != 0 {
+		t.Errorf("SearchChunks of punctuation = %v, %v, want no results", results, err)
+	}
+}
+
+func TestSearchChunksMatchModes(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	kube, _ := db.CreateChunk(ctx, "Kubernetes deployment checklist", nil)
+	db.CreateChunk(ctx, "Walrus migration patterns", nil)
+
+	found := func(query string, mode MatchMode) []SearchResult {
+		t.Helper()
+		results, err := db.SearchChunksMatching(ctx, query, 10, mode)
+		if err != nil {
+			t.Fatalf("SearchChunksMatching(%q, %s): %v", query, mode, err)
+		}
+		return results
+	}
+	if r := found("kube deploy", MatchExact); len(r) != 0 {
+		t.Errorf("exact partial words = %d results, want 0", len(r))
+	}
+	if r := found("kube deploy", MatchPrefix); len(r) != 1 || r[0].ID != kube.ID {
+		t.Errorf("prefix = %v, want the kubernetes chunk", r)
+	}
+	if _, err := db.SearchChunksMatching(ctx, "kubernetse", 10, MatchFuzzy); err != ErrFuzzyDisabled {
+		t.Errorf("fuzzy without trigram index: err = %v, want ErrFuzzyDisabled", err)
+	}
+
+	if err := db.ConfigureSearch(SearchConfig{Trigram: true}); err != nil {
+		t.Fatalf("ConfigureSearch: %v", err)
+	}
+	if r := found("kubernetse", MatchFuzzy); len(r) == 0 || r[0].ID != kube.ID {
+		t.Errorf("fuzzy typo = %v, want the kubernetes chunk first", r)
+	}
+	// Kept in step with later writes
+	helm := "Helm chart notes"
+	db.UpdateChunk(ctx, kube.ID, &helm, nil)
+	if r := found("kubernetse", MatchFuzzy); len(r) != 0 {
+		t.Errorf("fuzzy after update = %v, want none", r)
+	}
+	if r := found("wal", MatchFuzzy); len(r) != 1 {
+		t.Errorf("fuzzy partial word = %d results, want 1", len(r))
+	}
+
+	if err := db.ConfigureSearch(SearchConfig{}); err != nil {
+		t.Fatalf("ConfigureSearch: %v", err)
+	}
+	if ok, _ := db.hasTrigramIndex(); ok {
+		t.Error("trigram index kept after disabling")
+	}
+}
+
+func TestSearchChunksTokenizer(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	run, _ := db.CreateChunk(ctx, "Running the café backups", nil)
+	cjk, _ := db.CreateChunk(ctx, "東京都の天気予報", nil)
+
+	found := func(query string) bool {
+		t.Helper()
+		results, err := db.SearchChunks(ctx, query, 10)
+		if err != nil {
+			t.Fatalf("SearchChunks(%q): %v", query, err)
+		}
+		for _, r := range results {
+			if r.ID == run.ID || r.ID == cjk.ID {
+				return true
+			}
+		}
+		return false
+	}
+	configure := func(cfg SearchConfig) {
+		t.Helper()
+		if err := db.ConfigureSearch(cfg); err != nil {
+			t.Fatalf("ConfigureSearch(%+v): %v", cfg, err)
+		}
+	}
+	if found("run") || !found("cafe") || found("の天気") {
+		t.Error("unicode61 matched a stem or CJK substring, or missed an accent-free spelling")
+	}
+
+	configure(SearchConfig{Tokenizer: TokenizerPorter, KeepDiacritics: true})
+	if !found("run") || found("cafe") {
+		t.Error("porter with keep_diacritics missed a stem or matched an accent-free spelling")
+	}
+	configure(SearchConfig{Tokenizer: TokenizerTrigram})
+	if !found("の天気") || !found("cafe") {
+		t.Error("trigram missed a CJK substring or accent-free spelling")
+	}
+	// Kept in step with later writes
+	db.CreateChunk(ctx, "大阪の天気", nil)
+	if results, _ := db.SearchChunks(ctx, "の天気", 10); len(results) != 2 {
+		t.Errorf("trigram after write = %d results, want 2", len(results))
+	}
+	if v, _ := db.GetSetting(ctx, settingTokenizer); v != "trigram remove_diacritics 1" {
+		t.Errorf("recorded tokenizer = %q, want trigram remove_diacritics 1", v)
+	}
+
+	configure(SearchConfig{})
+	if found("run") || !found("backups") {
+		t.Error("unicode61 not restored")
+	}
+}
+
+func TestQuoteFTSQuery(t *testing.T) {
+	if got, want := quoteFTSQuery(`say "hi" prefix* AND ( c++`), `"say" "hi" "prefix"* "c"`; got != want {
+		t.Errorf("quoteFTSQuery = %s, want %s", got, want)
+	}
+}
+
 func TestSearchChunksMultipleTerms(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	db.CreateChunk("Go is a programming language", nil)
-	db.CreateChunk("Python is also a programming language", nil)
-	db.CreateChunk("Something completely different", nil)
+	db.CreateChunk(ctx, "Go is a programming language", nil)
+	db.CreateChunk(ctx, "Python is also a programming language", nil)
+	db.CreateChunk(ctx, "Something completely different", nil)
 
-	results, err := db.SearchChunks("programming language", 10)
+	results, err := db.SearchChunks(ctx, "programming language", 10)
 	if err != nil {
 		t.Fatalf("SearchChunks: %v", err)
 	}
@@ -246,11 +540,12 @@ func TestSearchChunksMultipleTerms(t *testing.T) {
 }
 
 func TestSearchChunksNoResults(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	db.CreateChunk("Hello world", nil)
+	db.CreateChunk(ctx, "Hello world", nil)
 
-	results, err := db.SearchChunks("nonexistent", 10)
+	results, err := db.SearchChunks(ctx, "nonexistent", 10)
 	if err != nil {
 		t.Fatalf("SearchChunks: %v", err)
 	}
@@ -261,13 +556,14 @@ func TestSearchChunksNoResults(t *testing.T) {
 }
 
 func TestSearchChunksLimit(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
 	for i := 0; i < 10; i++ {
-		db.CreateChunk("test document number", nil)
+		db.CreateChunk(ctx, "test document number", nil)
 	}
 
-	results, err := db.SearchChunks("test", 3)
+	results, err := db.SearchChunks(ctx, "test", 3)
 	if err != nil {
 		t.Fatalf("SearchChunks: %v", err)
 	}
@@ -278,15 +574,16 @@ func TestSearchChunksLimit(t *testing.T) {
 }
 
 func TestSearchChunksMaxLimit(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
 	// Create 105 chunks
 	for i := 0; i < 105; i++ {
-		db.CreateChunk("searchable content here", nil)
+		db.CreateChunk(ctx, "searchable content here", nil)
 	}
 
 	// Request more than max limit
-	results, err := db.SearchChunks("searchable", 500)
+	results, err := db.SearchChunks(ctx, "searchable", 500)
 	if err != nil {
 		t.Fatalf("SearchChunks: %v", err)
 	}
@@ -298,12 +595,13 @@ func TestSearchChunksMaxLimit(t *testing.T) {
 }
 
 func TestSearchChunksMetadata(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	db.CreateChunk("Some content", json.RawMessage(`{"author":"john"}`))
+	db.CreateChunk(ctx, "Some content", json.RawMessage(`{"author":"john"}`))
 
 	// FTS5 should index metadata too
-	results, err := db.SearchChunks("john", 10)
+	results, err := db.SearchChunks(ctx, "john", 10)
 	if err != nil {
 		t.Fatalf("SearchChunks: %v", err)
 	}
@@ -314,13 +612,14 @@ func TestSearchChunksMetadata(t *testing.T) {
 }
 
 func TestGetMetadataIndex(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	db.CreateChunk("A", json.RawMessage(`{"type":"note","tags":["go","test"]}`))
-	db.CreateChunk("B", json.RawMessage(`{"type":"note","tags":["go"]}`))
-	db.CreateChunk("C", json.RawMessage(`{"type":"doc"}`))
+	db.CreateChunk(ctx, "A", json.RawMessage(`{"type":"note","tags":["go","test"]}`))
+	db.CreateChunk(ctx, "B", json.RawMessage(`{"type":"note","tags":["go"]}`))
+	db.CreateChunk(ctx, "C", json.RawMessage(`{"type":"doc"}`))
 
-	result, err := db.GetMetadataIndex(20)
+	result, err := db.GetMetadataIndex(ctx, 20)
 	if err != nil {
 		t.Fatalf("GetMetadataIndex: %v", err)
 	}
@@ -350,13 +649,14 @@ func TestGetMetadataIndex(t *testing.T) {
 }
 
 func TestSearchChunksWildcard(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	db.CreateChunk("First document", nil)
-	db.CreateChunk("Second document", nil)
-	db.CreateChunk("Third document", nil)
+	db.CreateChunk(ctx, "First document", nil)
+	db.CreateChunk(ctx, "Second document", nil)
+	db.CreateChunk(ctx, "Third document", nil)
 
-	results, err := db.SearchChunks("*", 10)
+	results, err := db.SearchChunks(ctx, "*", 10)
 	if err != nil {
 		t.Fatalf("SearchChunks: %v", err)
 	}
@@ -367,13 +667,14 @@ func TestSearchChunksWildcard(t *testing.T) {
 }
 
 func TestSearchChunksWildcardLimit(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
 	for i := 0; i < 5; i++ {
-		db.CreateChunk("Document", nil)
+		db.CreateChunk(ctx, "Document", nil)
 	}
 
-	results, err := db.SearchChunks("*", 2)
+	results, err := db.SearchChunks(ctx, "*", 2)
 	if err != nil {
 		t.Fatalf("SearchChunks: %v", err)
 	}
@@ -384,13 +685,14 @@ func TestSearchChunksWildcardLimit(t *testing.T) {
 }
 
 func TestSearchChunksPrefixWildcard(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	db.CreateChunk("testing the code", nil)
-	db.CreateChunk("tested yesterday", nil)
-	db.CreateChunk("something else", nil)
+	db.CreateChunk(ctx, "testing the code", nil)
+	db.CreateChunk(ctx, "tested yesterday", nil)
+	db.CreateChunk(ctx, "something else", nil)
 
-	results, err := db.SearchChunks("test*", 10)
+	results, err := db.SearchChunks(ctx, "test*", 10)
 	if err != nil {
 		t.Fatalf("SearchChunks: %v", err)
 	}
@@ -401,13 +703,14 @@ func TestSearchChunksPrefixWildcard(t *testing.T) {
 }
 
 func TestSearchChunksOR(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	db.CreateChunk("I have a cat", nil)
-	db.CreateChunk("I have a dog", nil)
-	db.CreateChunk("I have a fish", nil)
+	db.CreateChunk(ctx, "I have a cat", nil)
+	db.CreateChunk(ctx, "I have a dog", nil)
+	db.CreateChunk(ctx, "I have a fish", nil)
 
-	results, err := db.SearchChunks("cat OR dog", 10)
+	results, err := db.SearchChunks(ctx, "cat OR dog", 10)
 	if err != nil {
 		t.Fatalf("SearchChunks: %v", err)
 	}
@@ -418,12 +721,13 @@ func TestSearchChunksOR(t *testing.T) {
 }
 
 func TestSearchChunksPhrase(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	db.CreateChunk("the quick brown fox", nil)
-	db.CreateChunk("quick thinking brown ideas", nil)
+	db.CreateChunk(ctx, "the quick brown fox", nil)
+	db.CreateChunk(ctx, "quick thinking brown ideas", nil)
 
-	results, err := db.SearchChunks(`"quick brown"`, 10)
+	results, err := db.SearchChunks(ctx, `"quick brown"`, 10)
 	if err != nil {
 		t.Fatalf("SearchChunks: %v", err)
 	}
@@ -434,13 +738,14 @@ func TestSearchChunksPhrase(t *testing.T) {
 }
 
 func TestGetMetadataValues(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	db.CreateChunk("A", json.RawMessage(`{"lang":"go"}`))
-	db.CreateChunk("B", json.RawMessage(`{"lang":"go"}`))
-	db.CreateChunk("C", json.RawMessage(`{"lang":"python"}`))
+	db.CreateChunk(ctx, "A", json.RawMessage(`{"lang":"go"}`))
+	db.CreateChunk(ctx, "B", json.RawMessage(`{"lang":"go"}`))
+	db.CreateChunk(ctx, "C", json.RawMessage(`{"lang":"python"}`))
 
-	result, err := db.GetMetadataValues("lang", 50)
+	result, err := db.GetMetadataValues(ctx, "lang", 50)
 	if err != nil {
 		t.Fatalf("GetMetadataValues: %v", err)
 	}
@@ -458,7 +763,55 @@ func TestGetMetadataValues(t *testing.T) {
 	}
 }
 
+func TestFilterChunkIDs(t *testing.T) {
+	ctx := context.Background()
+	for _, encrypted := range []bool{false, true} {
+		db := setupTestDB(t)
+		if encrypted {
+			db.SetEncryptionKey(testKey)
+		}
+		a, _ := db.CreateChunk(ctx, "A", json.RawMessage(`{"lang":"go","tags":["cli","tools"],"stars":5,"done":true}`))
+		b, _ := db.CreateChunk(ctx, "B", json.RawMessage(`{"lang":"go","tags":["web"]}`))
+		db.CreateChunk(ctx, "C", json.RawMessage(`{"lang":"python"}`))
+		db.CreateChunk(ctx, "D", nil)
+
+		tests := []struct {
+			filter map[string]any
+			want   []string
+		}{
+			{map[string]any{"lang": "go"}, []string{a.ID, b.ID}},
+			{map[string]any{"lang": "go", "tags": "tools"}, []string{a.ID}},
+			{map[string]any{"stars": 5.0, "done": true}, []string{a.ID}},
+			{map[string]any{"stars": "5"}, []string{a.ID}},
+			{map[string]any{"lang": "rust"}, nil},
+		}
+		for _, tt := range tests {
+			ids, err := db.FilterChunkIDs(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("FilterChunkIDs(%v): %v", tt.filter, err)
+			}
+			got := make(map[string]bool)
+			for _, id := range ids {
+				got[id] = true
+			}
+			if len(ids) != len(tt.want) {
+				t.Errorf("encrypted=%v FilterChunkIDs(%v) = %v, want %v", encrypted, tt.filter, ids, tt.want)
+				continue
+			}
+			for _, id := range tt.want {
+				if !got[id] {
+					t.Errorf("encrypted=%v FilterChunkIDs(%v) = %v, want %v", encrypted, tt.filter, ids, tt.want)
+				}
+			}
+		}
+		if _, err := db.FilterChunkIDs(ctx, map[string]any{"lang": nil}); err == nil {
+			t.Error("FilterChunkIDs with a null value succeeded")
+		}
+	}
+}
+
 func TestDatabasePersistence(t *testing.T) {
+	ctx := context.Background()
 	dir := t.TempDir()
 	dbPath := filepath.Join(dir, "persist.db")
 
@@ -468,7 +821,7 @@ func TestDatabasePersistence(t *testing.T) {
 		t.Fatalf("Open: %v", err)
 	}
 	db1.Migrate()
-	created, _ := db1.CreateChunk("Persistent data", nil)
+	created, _ := db1.CreateChunk(ctx, "Persistent data", nil)
 	db1.Close()
 
 	// Reopen and read
@@ -478,7 +831,7 @@ func TestDatabasePersistence(t *testing.T) {
 	}
 	defer db2.Close()
 
-	got, err := db2.GetChunk(created.ID)
+	got, err := db2.GetChunk(ctx, created.ID)
 	if err != nil {
 		t.Fatalf("GetChunk: %v", err)
 	}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"time"
@@ -11,33 +12,41 @@ type OAuthClient struct {
 	ClientID     string
 	ClientName   string
 	RedirectURIs []string
+	GrantTypes   []string // as registered; empty for the authorization code grant alone
 	CreatedAt    int64
 	LastUsedAt   int64
 }
 
-// CreateClient registers a new OAuth client.
-func (db *DB) CreateClient(clientID, clientName string, redirectURIs []string) error {
+// CreateClient registers a new OAuth client for grantTypes.
+func (db *DB) CreateClient(ctx context.Context, clientID, clientName string, redirectURIs, grantTypes []string) error {
 	uris, err := json.Marshal(redirectURIs)
 	if err != nil {
 		return err
 	}
+	if grantTypes == nil {
+		grantTypes = []string{}
+	}
+	grants, err := json.Marshal(grantTypes)
+	if err != nil {
+		return err
+	}
 
-	_, err = db.conn.Exec(
-		"INSERT INTO oauth_clients (client_id, client_name, redirect_uris) VALUES (?, ?, ?)",
-		clientID, clientName, string(uris),
+	_, err = db.conn.ExecContext(ctx,
+		"INSERT INTO oauth_clients (client_id, client_name, redirect_uris, grant_types) VALUES (?, ?, ?, ?)",
+		clientID, clientName, string(uris), string(grants),
 	)
 	return err
 }
 
 // GetClient retrieves an OAuth client by ID.
-func (db *DB) GetClient(clientID string) (*OAuthClient, error) {
+func (db *DB) GetClient(ctx context.Context, clientID string) (*OAuthClient, error) {
 	var c OAuthClient
-	var urisJSON string
+	var urisJSON, grantsJSON string
 
-	err := db.conn.QueryRow(
-		"SELECT client_id, client_name, redirect_uris, created_at, last_used_at FROM oauth_clients WHERE client_id = ?",
+	err := db.conn.QueryRowContext(ctx,
+		"SELECT client_id, client_name, redirect_uris, grant_types, created_at, last_used_at FROM oauth_clients WHERE client_id = ?",
 		clientID,
-	).Scan(&c.ClientID, &c.ClientName, &urisJSON, &c.CreatedAt, &c.LastUsedAt)
+	).Scan(&c.ClientID, &c.ClientName, &urisJSON, &grantsJSON, &c.CreatedAt, &c.LastUsedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, ErrNotFound
@@ -49,22 +58,29 @@ func (db *DB) GetClient(clientID string) (*OAuthClient, error) {
 	if err := json.Unmarshal([]byte(urisJSON), &c.RedirectURIs); err != nil {
 		return nil, err
 	}
+	if err := json.Unmarshal([]byte(grantsJSON), &c.GrantTypes); err != nil {
+		return nil, err
+	}
 
 	return &c, nil
 }
 
 // TouchClient updates the last_used_at timestamp.
-func (db *DB) TouchClient(clientID string) error {
-	_, err := db.conn.Exec(
+func (db *DB) TouchClient(ctx context.Context, clientID string) error {
+	_, err := db.conn.ExecContext(ctx,
 		"UPDATE oauth_clients SET last_used_at = ? WHERE client_id = ?",
 		time.Now().Unix(), clientID,
 	)
 	return err
 }
 
-// DeleteStaleClients removes clients unused for more than 90 days.
-func (db *DB) DeleteStaleClients() error {
+// DeleteStaleClients removes clients unused for more than 90 days and
+// returns how many there were.
+func (db *DB) DeleteStaleClients(ctx context.Context) (int64, error) {
 	staleTime := time.Now().Unix() - 90*24*60*60
-	_, err := db.conn.Exec("DELETE FROM oauth_clients WHERE last_used_at < ?", staleTime)
-	return err
+	res, err := db.conn.ExecContext(ctx, "DELETE FROM oauth_clients WHERE last_used_at < ?", staleTime)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
 }
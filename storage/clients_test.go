@@ -1,19 +1,21 @@
 package storage
 
 import (
+	"context"
 	"testing"
 	"time"
 )
 
 func TestCreateAndGetClient(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	err := db.CreateClient("client-id", "My App", []string{"http://localhost/callback"})
+	err := db.CreateClient(ctx, "client-id", "My App", []string{"http://localhost/callback"}, nil)
 	if err != nil {
 		t.Fatalf("CreateClient: %v", err)
 	}
 
-	client, err := db.GetClient("client-id")
+	client, err := db.GetClient(ctx, "client-id")
 	if err != nil {
 		t.Fatalf("GetClient: %v", err)
 	}
@@ -30,15 +32,17 @@ func TestCreateAndGetClient(t *testing.T) {
 }
 
 func TestGetClientNotFound(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	_, err := db.GetClient("nonexistent")
+	_, err := db.GetClient(ctx, "nonexistent")
 	if err != ErrNotFound {
 		t.Errorf("err = %v, want ErrNotFound", err)
 	}
 }
 
 func TestCreateClientMultipleRedirectURIs(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
 	uris := []string{
@@ -46,38 +50,40 @@ func TestCreateClientMultipleRedirectURIs(t *testing.T) {
 		"http://localhost:3000/oauth",
 		"myapp://callback",
 	}
-	db.CreateClient("multi-uri", "App", uris)
+	db.CreateClient(ctx, "multi-uri", "App", uris, nil)
 
-	client, _ := db.GetClient("multi-uri")
+	client, _ := db.GetClient(ctx, "multi-uri")
 	if len(client.RedirectURIs) != 3 {
 		t.Errorf("len(RedirectURIs) = %d, want 3", len(client.RedirectURIs))
 	}
 }
 
 func TestTouchClient(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	db.CreateClient("touch-me", "App", []string{"http://localhost"})
+	db.CreateClient(ctx, "touch-me", "App", []string{"http://localhost"}, nil)
 
 	// Manually set last_used_at to past
 	past := time.Now().Unix() - 100
 	db.conn.Exec("UPDATE oauth_clients SET last_used_at = ? WHERE client_id = ?", past, "touch-me")
 
-	if err := db.TouchClient("touch-me"); err != nil {
+	if err := db.TouchClient(ctx, "touch-me"); err != nil {
 		t.Fatalf("TouchClient: %v", err)
 	}
 
-	client, _ := db.GetClient("touch-me")
+	client, _ := db.GetClient(ctx, "touch-me")
 	if client.LastUsedAt <= past {
 		t.Errorf("LastUsedAt = %d, should be > %d", client.LastUsedAt, past)
 	}
 }
 
 func TestDeleteStaleClients(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
 	// Create client
-	db.CreateClient("stale-client", "Old App", []string{"http://localhost"})
+	db.CreateClient(ctx, "stale-client", "Old App", []string{"http://localhost"}, nil)
 
 	// Manually set last_used_at to 100 days ago
 	db.conn.Exec(
@@ -87,21 +93,25 @@ func TestDeleteStaleClients(t *testing.T) {
 	)
 
 	// Create fresh client
-	db.CreateClient("fresh-client", "New App", []string{"http://localhost"})
+	db.CreateClient(ctx, "fresh-client", "New App", []string{"http://localhost"}, nil)
 
 	// Delete stale
-	if err := db.DeleteStaleClients(); err != nil {
+	n, err := db.DeleteStaleClients(ctx)
+	if err != nil {
 		t.Fatalf("DeleteStaleClients: %v", err)
 	}
+	if n != 1 {
+		t.Errorf("DeleteStaleClients = %d, want 1", n)
+	}
 
 	// Stale should be gone
-	_, err := db.GetClient("stale-client")
+	_, err = db.GetClient(ctx, "stale-client")
 	if err != ErrNotFound {
 		t.Error("Stale client should be deleted")
 	}
 
 	// Fresh should remain
-	_, err = db.GetClient("fresh-client")
+	_, err = db.GetClient(ctx, "fresh-client")
 	if err != nil {
 		t.Error("Fresh client should remain")
 	}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// autoReclaimRatio is the share of free pages above which deletes reclaim
+// space automatically.
+const autoReclaimRatio = 0.25
+
+// SpaceReport describes database file usage.
+type SpaceReport struct {
+	PageSize         int64 `json:"page_size"`
+	PageCount        int64 `json:"page_count"`
+	FreePages        int64 `json:"free_pages"`
+	FileBytes        int64 `json:"file_bytes"`
+	ReclaimableBytes int64 `json:"reclaimable_bytes"`
+	// Incremental is true when free pages can be reclaimed with
+	// IncrementalVacuum instead of a full VACUUM.
+	Incremental bool `json:"incremental"`
+}
+
+// SpaceReport reports how much of the database file is unused.
+func (db *DB) SpaceReport(ctx context.Context) (*SpaceReport, error) {
+	var r SpaceReport
+	var mode int
+	for _, p := range []struct {
+		pragma string
+		dest   any
+	}{
+		{"page_size", &r.PageSize},
+		{"page_count", &r.PageCount},
+		{"freelist_count", &r.FreePages},
+		{"auto_vacuum", &mode},
+	} {
+		if err := db.conn.QueryRowContext(ctx, "PRAGMA "+p.pragma).Scan(p.dest); err != nil {
+			return nil, fmt.Errorf("read %s: %w", p.pragma, err)
+		}
+	}
+	r.FileBytes = r.PageSize * r.PageCount
+	r.ReclaimableBytes = r.PageSize * r.FreePages
+	r.Incremental = mode == 2 // INCREMENTAL
+	return &r, nil
+}
+
+// IncrementalVacuum returns free pages to the filesystem without the
+// exclusive lock of a full VACUUM. pages <= 0 reclaims all free pages.
+func (db *DB) IncrementalVacuum(ctx context.Context, pages int) error {
+	if pages < 0 {
+		pages = 0
+	}
+	// The pragma frees pages one step at a time, so it must be stepped to completion
+	rows, err := db.conn.QueryContext(ctx, fmt.Sprintf("PRAGMA incremental_vacuum(%d)", pages))
+	if err != nil {
+		return fmt.Errorf("incremental vacuum: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("incremental vacuum: %w", err)
+	}
+	return nil
+}
+
+// reclaimSpace runs an incremental vacuum once free pages exceed
+// autoReclaimRatio of the file. Best-effort: failures are only logged.
+func (db *DB) reclaimSpace(ctx context.Context) {
+	r, err := db.SpaceReport(ctx)
+	if err != nil {
+		log.Printf("warning: space report: %v", err)
+		return
+	}
+	if !r.Incremental || r.PageCount == 0 || float64(r.FreePages)/float64(r.PageCount) < autoReclaimRatio {
+		return
+	}
+	if err := db.IncrementalVacuum(ctx, 0); err != nil {
+		log.Printf("warning: %v", err)
+	}
+}
@@ -1,27 +1,61 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 
 	_ "modernc.org/sqlite"
 )
 
 // DB wraps the SQLite connection.
 type DB struct {
-	conn *sql.DB
+	conn   *sql.DB
+	path   string
+	search *searchCache
+	cipher *fieldCipher // nil unless encryption is configured
+
+	searchConfig SearchConfig // see ConfigureSearch
+	trigram      bool         // chunks_trigram is kept, for fuzzy search
+
+	readOnly bool      // opened with OpenReadOnly
+	pin      *sql.Conn // keeps a database opened with OpenMemory alive
+
+	versionMu   sync.Mutex
+	versionConn *sql.Conn // pinned for PRAGMA data_version, see externalWrites
+	version     int64
+}
+
+// Options tune how the database connection is opened.
+type Options struct {
+	// ExternalCheckpoints disables SQLite's automatic WAL checkpoints, for
+	// when an external replicator such as Litestream runs them instead.
+	ExternalCheckpoints bool
 }
 
 // Init initializes storage in the given directory.
 // Creates the directory if needed, opens the database, and runs migrations.
+// The directory Memory keeps the database in memory instead.
 func Init(dataDir string) (*DB, error) {
-	if err := os.MkdirAll(dataDir, 0700); err != nil {
-		return nil, fmt.Errorf("create data directory: %w", err)
-	}
+	return InitWithOptions(dataDir, Options{})
+}
 
-	db, err := Open(filepath.Join(dataDir, "data.db"))
+// InitWithOptions initializes storage in the given directory with opts.
+func InitWithOptions(dataDir string, opts Options) (*DB, error) {
+	var db *DB
+	var err error
+	if dataDir == Memory {
+		db, err = OpenMemory()
+	} else {
+		if err := os.MkdirAll(dataDir, 0700); err != nil {
+			return nil, fmt.Errorf("create data directory: %w", err)
+		}
+		db, err = OpenWithOptions(filepath.Join(dataDir, "data.db"), opts)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -36,12 +70,23 @@ func Init(dataDir string) (*DB, error) {
 
 // Open opens or creates a SQLite database at the given path.
 func Open(path string) (*DB, error) {
+	return OpenWithOptions(path, Options{})
+}
+
+// OpenWithOptions opens or creates a SQLite database at the given path with opts.
+func OpenWithOptions(path string, opts Options) (*DB, error) {
 	// Ensure parent directory exists
 	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return nil, fmt.Errorf("create data dir: %w", err)
 	}
 
-	conn, err := sql.Open("sqlite", path+"?_journal_mode=WAL&_busy_timeout=5000")
+	// Pragmas in the DSN apply to every pooled connection,
+	// and transactions begin IMMEDIATE to queue writers (see write.go)
+	dsn := path + "?_txlock=immediate&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+	if opts.ExternalCheckpoints {
+		dsn += "&_pragma=wal_autocheckpoint(0)"
+	}
+	conn, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("open database: %w", err)
 	}
@@ -58,11 +103,15 @@ func Open(path string) (*DB, error) {
 		return nil, fmt.Errorf("enable foreign keys: %w", err)
 	}
 
-	return &DB{conn: conn}, nil
+	return &DB{conn: conn, path: path, search: newSearchCache(), searchConfig: SearchConfig{}.withDefaults()}, nil
 }
 
 // Close closes the database connection.
 func (db *DB) Close() error {
+	db.closeVersionConn()
+	if db.pin != nil {
+		db.pin.Close()
+	}
 	return db.conn.Close()
 }
 
@@ -94,6 +143,16 @@ func (db *DB) Migrate() error {
 	return nil
 }
 
+// SchemaVersion returns the last migration applied to the database.
+func (db *DB) SchemaVersion(ctx context.Context) (string, error) {
+	var id string
+	err := db.conn.QueryRowContext(ctx, "SELECT id FROM migrations ORDER BY id DESC LIMIT 1").Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return id, err
+}
+
 func (db *DB) isMigrationApplied(id string) (bool, error) {
 	var count int
 	err := db.conn.QueryRow("SELECT COUNT(*) FROM migrations WHERE id = ?", id).Scan(&count)
@@ -119,7 +178,8 @@ CREATE VIRTUAL TABLE IF NOT EXISTS chunks_fts USING fts5(
     content,
     metadata,
     content='chunks',
-    content_rowid='rowid'
+    content_rowid='rowid',
+    prefix='2 3'
 );
 
 -- Triggers to keep FTS in sync
@@ -194,4 +254,180 @@ var migrations = []migration{
 			created_at INTEGER DEFAULT (unixepoch())
 		);`,
 	},
+	{
+		"006_signing_keys",
+		`CREATE TABLE IF NOT EXISTS signing_keys (
+			kid TEXT PRIMARY KEY,
+			private_key BLOB NOT NULL,
+			created_at INTEGER DEFAULT (unixepoch())
+		);`,
+	},
+	{
+		"007_embeddings_content_hash",
+		`ALTER TABLE embeddings ADD COLUMN content_hash TEXT;`,
+	},
+	{
+		// auto_vacuum only takes effect on an existing database after VACUUM
+		"008_auto_vacuum",
+		`PRAGMA auto_vacuum = INCREMENTAL;
+		VACUUM;`,
+	},
+	{
+		// One vector per chunk and model, so switching models keeps the old vectors
+		"009_embeddings_per_model",
+		`CREATE TABLE embeddings_new (
+			chunk_id TEXT NOT NULL REFERENCES chunks(id) ON DELETE CASCADE,
+			model TEXT NOT NULL,
+			embedding BLOB NOT NULL,
+			created_at INTEGER DEFAULT (unixepoch()),
+			content_hash TEXT,
+			PRIMARY KEY (chunk_id, model)
+		);
+		INSERT INTO embeddings_new (chunk_id, model, embedding, created_at, content_hash)
+			SELECT chunk_id, model, embedding, created_at, content_hash FROM embeddings;
+		DROP TABLE embeddings;
+		ALTER TABLE embeddings_new RENAME TO embeddings;`,
+	},
+	{
+		// [[chunk-id]] references; targets may not exist (yet)
+		"010_links",
+		`CREATE TABLE IF NOT EXISTS links (
+			source_id TEXT NOT NULL REFERENCES chunks(id) ON DELETE CASCADE,
+			target_id TEXT NOT NULL,
+			PRIMARY KEY (source_id, target_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_links_target ON links(target_id);`,
+	},
+	{
+		// Which client stored a chunk, for capture sessions
+		"011_chunk_clients",
+		`CREATE TABLE IF NOT EXISTS chunk_clients (
+			chunk_id TEXT PRIMARY KEY REFERENCES chunks(id) ON DELETE CASCADE,
+			client TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_chunk_clients_client ON chunk_clients(client);`,
+	},
+	{
+		// Recent tool calls, kept for mykb replay
+		"012_tool_calls",
+		`CREATE TABLE IF NOT EXISTS tool_calls (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			created_at INTEGER NOT NULL,
+			client TEXT NOT NULL DEFAULT '',
+			tool TEXT NOT NULL,
+			arguments BLOB,
+			response BLOB,
+			is_error INTEGER NOT NULL DEFAULT 0,
+			duration_ms INTEGER NOT NULL DEFAULT 0
+		);`,
+	},
+	{
+		// Daily size snapshots for mykb stats --history
+		"013_storage_stats",
+		`CREATE TABLE IF NOT EXISTS storage_stats (
+			day TEXT PRIMARY KEY,
+			chunks INTEGER NOT NULL,
+			embedded INTEGER NOT NULL,
+			model TEXT NOT NULL DEFAULT '',
+			db_bytes INTEGER NOT NULL,
+			recorded_at INTEGER NOT NULL
+		);`,
+	},
+	{
+		// Sources (books, articles, conversations) that chunks come from
+		"014_sources",
+		`CREATE TABLE IF NOT EXISTS sources (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			metadata JSON,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS chunk_sources (
+			chunk_id TEXT PRIMARY KEY REFERENCES chunks(id) ON DELETE CASCADE,
+			source_id TEXT NOT NULL REFERENCES sources(id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_chunk_sources_source ON chunk_sources(source_id);`,
+	},
+	{
+		// Deleted chunk IDs, so mykb sync can propagate deletes
+		"015_chunk_tombstones",
+		`CREATE TABLE IF NOT EXISTS chunk_tombstones (
+			chunk_id TEXT PRIMARY KEY,
+			deleted_at TIMESTAMP NOT NULL
+		);`,
+	},
+	{
+		// Chunks whose embedding failed, retried by the server in the background
+		"016_embedding_queue",
+		`CREATE TABLE IF NOT EXISTS embedding_queue (
+			chunk_id TEXT PRIMARY KEY REFERENCES chunks(id) ON DELETE CASCADE,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			next_attempt_at INTEGER NOT NULL
+		);`,
+	},
+	{
+		// Prefix indexes, so that prefix queries don't scan the vocabulary
+		"017_fts_prefix",
+		`DROP TABLE IF EXISTS chunks_fts;
+		CREATE VIRTUAL TABLE chunks_fts USING fts5(
+			id, content, metadata,
+			content='chunks', content_rowid='rowid', prefix='2 3'
+		);
+		INSERT INTO chunks_fts(chunks_fts) VALUES ('rebuild');`,
+	},
+	{
+		// When each chunk was last read, for the review queue
+		"018_chunk_access",
+		`CREATE TABLE IF NOT EXISTS chunk_access (
+			chunk_id TEXT PRIMARY KEY REFERENCES chunks(id) ON DELETE CASCADE,
+			accessed_at INTEGER NOT NULL,
+			count INTEGER NOT NULL DEFAULT 1
+		);`,
+	},
+	{
+		// Files attached to chunks, such as images and PDFs
+		"019_attachments",
+		`CREATE TABLE IF NOT EXISTS attachments (
+			id TEXT PRIMARY KEY,
+			chunk_id TEXT NOT NULL REFERENCES chunks(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			content_type TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			data BLOB NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_attachments_chunk ON attachments(chunk_id);`,
+	},
+	{
+		"020_entities",
+		`CREATE TABLE IF NOT EXISTS entities (
+			id INTEGER PRIMARY KEY,
+			kind TEXT NOT NULL,
+			key TEXT NOT NULL UNIQUE,
+			name TEXT NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS chunk_entities (
+			chunk_id TEXT NOT NULL REFERENCES chunks(id) ON DELETE CASCADE,
+			entity_id INTEGER NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+			PRIMARY KEY (chunk_id, entity_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_chunk_entities_entity ON chunk_entities(entity_id);`,
+	},
+	{
+		"021_chunk_locks",
+		`CREATE TABLE IF NOT EXISTS chunk_locks (
+			chunk_id TEXT PRIMARY KEY REFERENCES chunks(id) ON DELETE CASCADE,
+			locked_at TIMESTAMP NOT NULL
+		);`,
+	},
+	{
+		// Registration required redirect URIs of clients not asking for
+		// the device code grant, so only those without them did
+		"022_client_grant_types",
+		`ALTER TABLE oauth_clients ADD COLUMN grant_types TEXT NOT NULL DEFAULT '[]';
+		UPDATE oauth_clients SET grant_types = '["urn:ietf:params:oauth:grant-type:device_code"]'
+			WHERE redirect_uris IN ('[]', 'null');`,
+	},
 }
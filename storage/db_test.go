@@ -1,11 +1,15 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
 func TestInit(t *testing.T) {
+	ctx := context.Background()
 	dir := t.TempDir()
 
 	db, err := Init(dir)
@@ -15,7 +19,7 @@ func TestInit(t *testing.T) {
 	defer db.Close()
 
 	// Should be able to use the database
-	chunk, err := db.CreateChunk("test", nil)
+	chunk, err := db.CreateChunk(ctx, "test", nil)
 	if err != nil {
 		t.Fatalf("CreateChunk: %v", err)
 	}
@@ -43,6 +47,7 @@ func TestInitInvalidPath(t *testing.T) {
 }
 
 func TestInitIdempotent(t *testing.T) {
+	ctx := context.Background()
 	dir := t.TempDir()
 
 	// First init
@@ -50,7 +55,7 @@ func TestInitIdempotent(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Init: %v", err)
 	}
-	db1.CreateChunk("test", nil)
+	db1.CreateChunk(ctx, "test", nil)
 	db1.Close()
 
 	// Second init should work and preserve data
@@ -60,12 +65,34 @@ func TestInitIdempotent(t *testing.T) {
 	}
 	defer db2.Close()
 
-	chunks, _ := db2.GetAllChunks()
+	chunks, _ := db2.GetAllChunks(ctx)
 	if len(chunks) != 1 {
 		t.Errorf("len(chunks) = %d, want 1", len(chunks))
 	}
 }
 
+func TestOpenExternalCheckpoints(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		opts Options
+		want int
+	}{
+		{Options{}, 1000},
+		{Options{ExternalCheckpoints: true}, 0},
+	} {
+		db, err := OpenWithOptions(filepath.Join(dir, "test.db"), tc.opts)
+		if err != nil {
+			t.Fatalf("OpenWithOptions: %v", err)
+		}
+		var pages int
+		db.conn.QueryRow("PRAGMA wal_autocheckpoint").Scan(&pages)
+		db.Close()
+		if pages != tc.want {
+			t.Errorf("wal_autocheckpoint with %+v = %d, want %d", tc.opts, pages, tc.want)
+		}
+	}
+}
+
 func TestOpenInvalidPath(t *testing.T) {
 	// Directory as file path
 	dir := t.TempDir()
@@ -74,3 +101,92 @@ func TestOpenInvalidPath(t *testing.T) {
 		t.Error("Expected error when opening directory as database")
 	}
 }
+
+func TestSpaceReportAndIncrementalVacuum(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+
+	r, err := db.SpaceReport(ctx)
+	if err != nil {
+		t.Fatalf("SpaceReport: %v", err)
+	}
+	if !r.Incremental {
+		t.Fatal("auto_vacuum should be INCREMENTAL after migration")
+	}
+
+	// Fill the database, then delete directly so automatic reclaim does not run
+	big := strings.Repeat("lorem ipsum ", 2000)
+	for i := 0; i < 50; i++ {
+		if _, err := db.CreateChunk(ctx, big, nil); err != nil {
+			t.Fatalf("CreateChunk: %v", err)
+		}
+	}
+	if _, err := db.conn.Exec("DELETE FROM chunks"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	before, _ := db.SpaceReport(ctx)
+	if before.FreePages == 0 || before.ReclaimableBytes != before.FreePages*before.PageSize {
+		t.Fatalf("expected reclaimable space, got %+v", before)
+	}
+
+	if err := db.IncrementalVacuum(ctx, 0); err != nil {
+		t.Fatalf("IncrementalVacuum: %v", err)
+	}
+	after, _ := db.SpaceReport(ctx)
+	if after.FreePages != 0 {
+		t.Errorf("FreePages after vacuum = %d, want 0", after.FreePages)
+	}
+	if after.PageCount >= before.PageCount {
+		t.Errorf("PageCount = %d, want < %d", after.PageCount, before.PageCount)
+	}
+}
+
+func TestDeleteChunkReclaimsSpace(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+
+	big := strings.Repeat("lorem ipsum ", 2000)
+	var ids []string
+	for i := 0; i < 50; i++ {
+		c, _ := db.CreateChunk(ctx, big, nil)
+		ids = append(ids, c.ID)
+	}
+	for _, id := range ids {
+		if _, err := db.DeleteChunk(ctx, id); err != nil {
+			t.Fatalf("DeleteChunk: %v", err)
+		}
+	}
+
+	r, _ := db.SpaceReport(ctx)
+	if float64(r.FreePages)/float64(r.PageCount) >= autoReclaimRatio {
+		t.Errorf("free pages not reclaimed: %+v", r)
+	}
+}
+
+func TestCancelledContext(t *testing.T) {
+	db, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	defer db.Close()
+	chunk, err := db.CreateChunk(context.Background(), "kept", nil)
+	if err != nil {
+		t.Fatalf("CreateChunk: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := db.GetChunk(ctx, chunk.ID); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetChunk: err = %v, want context.Canceled", err)
+	}
+	if _, err := db.SearchChunks(ctx, "kept", 10); !errors.Is(err, context.Canceled) {
+		t.Errorf("SearchChunks: err = %v, want context.Canceled", err)
+	}
+	if _, err := db.CreateChunk(ctx, "dropped", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("CreateChunk: err = %v, want context.Canceled", err)
+	}
+	if n, _ := db.CountChunks(context.Background()); n != 1 {
+		t.Errorf("CountChunks = %d, want 1", n)
+	}
+}
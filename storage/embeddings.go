@@ -1,47 +1,98 @@
 package storage
 
 import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"math"
+	"strings"
+	"time"
+
+	"github.com/neoden/mykb/embedding"
+)
+
+// Embedding freshness relative to the chunk and the configured model.
+const (
+	EmbeddingFresh      = "fresh"       // embedding matches current content and model
+	EmbeddingStale      = "stale"       // content changed since the embedding was generated
+	EmbeddingMissing    = "missing"     // chunk has no embedding
+	EmbeddingWrongModel = "wrong_model" // embedding was generated by a different model
 )
 
-// SaveEmbedding saves an embedding for a chunk.
-func (db *DB) SaveEmbedding(chunkID, model string, vec []float32) error {
-	return saveEmbedding(db.conn, chunkID, model, vec)
+// SaveEmbedding saves a chunk's embedding for model, replacing any earlier
+// one from the same model. Embeddings from other models are kept. text is
+// what was embedded (see embedding.Text).
+func (db *DB) SaveEmbedding(ctx context.Context, chunkID, model, text string, vec []float32) error {
+	return saveEmbedding(ctx, db.conn, db.cipher, chunkID, model, text, vec)
 }
 
-func saveEmbedding(exec sqlExecutor, chunkID, model string, vec []float32) error {
-	blob := float32ToBytes(vec)
-	_, err := exec.Exec(`
-		INSERT INTO embeddings (chunk_id, model, embedding)
-		VALUES (?, ?, ?)
-		ON CONFLICT(chunk_id) DO UPDATE SET
-			model = excluded.model,
+// The hash of the embedded text is recorded alongside the vector so later
+// edits can be detected (see EmbeddingStatus). It is the caller's text
+// rather than the chunk's, which may have changed while it was embedded.
+func saveEmbedding(ctx context.Context, exec sqlExecutor, c *fieldCipher, chunkID, model, text string, vec []float32) error {
+	blob := c.sealBytes(float32ToBytes(vec))
+	res, err := exec.ExecContext(ctx, `
+		INSERT INTO embeddings (chunk_id, model, embedding, content_hash)
+		SELECT ?, ?, ?, ? WHERE EXISTS (SELECT 1 FROM chunks WHERE id = ?)
+		ON CONFLICT(chunk_id, model) DO UPDATE SET
 			embedding = excluded.embedding,
+			content_hash = excluded.content_hash,
 			created_at = unixepoch()
-	`, chunkID, model, blob)
+	`, chunkID, model, blob, c.hash(text), chunkID)
 	if err != nil {
 		return fmt.Errorf("save embedding: %w", err)
 	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrChunkNotFound
+	}
 	return nil
 }
 
-// GetEmbedding retrieves an embedding by chunk ID.
-func (db *DB) GetEmbedding(chunkID string) ([]float32, error) {
+// GetEmbedding retrieves the most recently saved embedding of a chunk.
+func (db *DB) GetEmbedding(ctx context.Context, chunkID string) ([]float32, error) {
 	var blob []byte
-	err := db.conn.QueryRow(`
+	err := db.conn.QueryRowContext(ctx, `
 		SELECT embedding FROM embeddings WHERE chunk_id = ?
+		ORDER BY created_at DESC, rowid DESC LIMIT 1
 	`, chunkID).Scan(&blob)
 	if err != nil {
 		return nil, fmt.Errorf("get embedding: %w", err)
 	}
+	if blob, err = db.cipher.openBytes(blob); err != nil {
+		return nil, fmt.Errorf("get embedding: %w", err)
+	}
 	return bytesToFloat32(blob), nil
 }
 
-// DeleteEmbedding deletes an embedding by chunk ID.
-func (db *DB) DeleteEmbedding(chunkID string) error {
-	_, err := db.conn.Exec(`DELETE FROM embeddings WHERE chunk_id = ?`, chunkID)
+// GetEmbeddings returns all embeddings of a chunk keyed by model.
+func (db *DB) GetEmbeddings(ctx context.Context, chunkID string) (map[string][]float32, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT model, embedding FROM embeddings WHERE chunk_id = ?`, chunkID)
+	if err != nil {
+		return nil, fmt.Errorf("get embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string][]float32)
+	for rows.Next() {
+		var model string
+		var blob []byte
+		if err := rows.Scan(&model, &blob); err != nil {
+			return nil, fmt.Errorf("scan embedding: %w", err)
+		}
+		if blob, err = db.cipher.openBytes(blob); err != nil {
+			return nil, fmt.Errorf("embedding %s/%s: %w", chunkID, model, err)
+		}
+		result[model] = bytesToFloat32(blob)
+	}
+	return result, rows.Err()
+}
+
+// DeleteEmbedding deletes all embeddings of a chunk.
+func (db *DB) DeleteEmbedding(ctx context.Context, chunkID string) error {
+	_, err := db.conn.ExecContext(ctx, `DELETE FROM embeddings WHERE chunk_id = ?`, chunkID)
 	if err != nil {
 		return fmt.Errorf("delete embedding: %w", err)
 	}
@@ -50,29 +101,122 @@ func (db *DB) DeleteEmbedding(chunkID string) error {
 
 // LoadEmbeddingsByModel loads embeddings for a specific model into a map.
 // Only embeddings matching the given model are returned.
-func (db *DB) LoadEmbeddingsByModel(model string) (map[string][]float32, error) {
-	rows, err := db.conn.Query(`SELECT chunk_id, embedding FROM embeddings WHERE model = ?`, model)
+func (db *DB) LoadEmbeddingsByModel(ctx context.Context, model string) (map[string][]float32, error) {
+	result := make(map[string][]float32)
+	return result, db.scanEmbeddings(ctx, result, `SELECT chunk_id, embedding FROM embeddings WHERE model = ?`, model)
+}
+
+// loadBatch is how many chunk IDs a query binds at once (LoadEmbeddingsFor,
+// UpdatedTimes), well under SQLite's variable limit.
+const loadBatch = 500
+
+// LoadEmbeddingsFor loads the model's embeddings of the given chunks; chunks
+// without one are left out.
+func (db *DB) LoadEmbeddingsFor(ctx context.Context, model string, ids []string) (map[string][]float32, error) {
+	result := make(map[string][]float32, len(ids))
+	for start := 0; start < len(ids); start += loadBatch {
+		batch := ids[start:min(start+loadBatch, len(ids))]
+		args := make([]any, 0, len(batch)+1)
+		args = append(args, model)
+		for _, id := range batch {
+			args = append(args, id)
+		}
+		query := `SELECT chunk_id, embedding FROM embeddings WHERE model = ? AND chunk_id IN (?` +
+			strings.Repeat(",?", len(batch)-1) + `)`
+		if err := db.scanEmbeddings(ctx, result, query, args...); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// scanEmbeddings adds the (chunk_id, embedding) rows of query to result.
+func (db *DB) scanEmbeddings(ctx context.Context, result map[string][]float32, query string, args ...any) error {
+	rows, err := db.conn.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("load embeddings: %w", err)
+		return fmt.Errorf("load embeddings: %w", err)
 	}
 	defer rows.Close()
 
-	result := make(map[string][]float32)
 	for rows.Next() {
 		var chunkID string
 		var blob []byte
 		if err := rows.Scan(&chunkID, &blob); err != nil {
-			return nil, fmt.Errorf("scan embedding: %w", err)
+			return fmt.Errorf("scan embedding: %w", err)
+		}
+		if blob, err = db.cipher.openBytes(blob); err != nil {
+			return fmt.Errorf("embedding %s: %w", chunkID, err)
 		}
 		result[chunkID] = bytesToFloat32(blob)
 	}
-	return result, rows.Err()
+	return rows.Err()
+}
+
+// EmbeddingTimes returns when each of the model's embeddings was saved, in
+// Unix seconds, without reading the vectors themselves.
+func (db *DB) EmbeddingTimes(ctx context.Context, model string) (map[string]int64, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT chunk_id, COALESCE(created_at, 0) FROM embeddings WHERE model = ?`, model)
+	if err != nil {
+		return nil, fmt.Errorf("embedding times: %w", err)
+	}
+	defer rows.Close()
+
+	times := make(map[string]int64)
+	for rows.Next() {
+		var id string
+		var at int64
+		if err := rows.Scan(&id, &at); err != nil {
+			return nil, fmt.Errorf("scan embedding time: %w", err)
+		}
+		times[id] = at
+	}
+	return times, rows.Err()
+}
+
+// EmbeddingModels counts the chunks embedded by each model.
+func (db *DB) EmbeddingModels(ctx context.Context) (map[string]int, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT model, COUNT(*) FROM embeddings GROUP BY model`)
+	if err != nil {
+		return nil, fmt.Errorf("count embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var model string
+		var n int
+		if err := rows.Scan(&model, &n); err != nil {
+			return nil, fmt.Errorf("scan embedding count: %w", err)
+		}
+		counts[model] = n
+	}
+	return counts, rows.Err()
+}
+
+// EmbeddedSince returns the IDs of chunks embedded by model at or after
+// since, such as by an interrupted reindex being resumed.
+func (db *DB) EmbeddedSince(ctx context.Context, model string, since time.Time) (map[string]bool, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT chunk_id FROM embeddings WHERE model = ? AND created_at >= ?`, model, since.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("embedded since: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan chunk id: %w", err)
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
 }
 
 // GetChunksWithoutEmbeddings returns chunks that don't have embeddings for the given model.
 // This includes chunks with no embeddings at all and chunks with embeddings from a different model.
-func (db *DB) GetChunksWithoutEmbeddings(model string) ([]Chunk, error) {
-	rows, err := db.conn.Query(`
+func (db *DB) GetChunksWithoutEmbeddings(ctx context.Context, model string) ([]Chunk, error) {
+	rows, err := db.conn.QueryContext(ctx, `
 		SELECT c.id, c.content, c.metadata, c.created_at, c.updated_at
 		FROM chunks c
 		LEFT JOIN embeddings e ON c.id = e.chunk_id AND e.model = ?
@@ -81,21 +225,92 @@ func (db *DB) GetChunksWithoutEmbeddings(model string) ([]Chunk, error) {
 	if err != nil {
 		return nil, fmt.Errorf("get chunks without embeddings: %w", err)
 	}
-	defer rows.Close()
+	return db.readChunks(rows)
+}
 
-	var chunks []Chunk
-	for rows.Next() {
-		var chunk Chunk
-		var metaStr *string
-		if err := rows.Scan(&chunk.ID, &chunk.Content, &metaStr, &chunk.CreatedAt, &chunk.UpdatedAt); err != nil {
-			return nil, fmt.Errorf("scan chunk: %w", err)
-		}
-		if metaStr != nil {
-			chunk.Metadata = []byte(*metaStr)
+// GetChunksWithoutEmbeddingsPage is GetChunksWithoutEmbeddings a page at a
+// time, like GetChunksPage. Chunks embedded meanwhile drop out of later
+// pages without moving the others.
+func (db *DB) GetChunksWithoutEmbeddingsPage(ctx context.Context, model, afterID string, limit int) ([]Chunk, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT c.id, c.content, c.metadata, c.created_at, c.updated_at
+		FROM chunks c
+		LEFT JOIN embeddings e ON c.id = e.chunk_id AND e.model = ?
+		WHERE e.chunk_id IS NULL AND c.id > ?
+		ORDER BY c.id LIMIT ?
+	`, model, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("get chunks without embeddings: %w", err)
+	}
+	return db.readChunks(rows)
+}
+
+// CountChunksWithoutEmbeddings returns how many chunks have no embedding
+// for model.
+func (db *DB) CountChunksWithoutEmbeddings(ctx context.Context, model string) (int, error) {
+	var n int
+	err := db.conn.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM chunks c
+		LEFT JOIN embeddings e ON c.id = e.chunk_id AND e.model = ?
+		WHERE e.chunk_id IS NULL
+	`, model).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("count chunks without embeddings: %w", err)
+	}
+	return n, nil
+}
+
+// EmbeddingStatus reports whether the chunk's embedding is usable by
+// semantic search with the given model: fresh, stale, missing or wrong_model.
+// It is fresh if it was saved for the text the chunk embeds as now, its
+// content with the metadata fields embedded along with it.
+func (db *DB) EmbeddingStatus(ctx context.Context, chunkID, model string, fields []string) (string, error) {
+	var content string
+	var metadata []byte
+	var updatedAt time.Time
+	var embModel, hash sql.NullString
+	var createdAt sql.NullInt64
+	err := db.conn.QueryRowContext(ctx, `
+		SELECT c.content, c.metadata, c.updated_at, e.model, e.content_hash, e.created_at
+		FROM chunks c
+		LEFT JOIN embeddings e ON e.chunk_id = c.id
+		WHERE c.id = ?
+		ORDER BY e.model = ? DESC
+		LIMIT 1
+	`, chunkID, model).Scan(&content, &metadata, &updatedAt, &embModel, &hash, &createdAt)
+	if err == sql.ErrNoRows {
+		return "", ErrChunkNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("embedding status: %w", err)
+	}
+	if content, err = db.cipher.openString(content); err != nil {
+		return "", fmt.Errorf("embedding status: %w", err)
+	}
+	if metadata, err = db.cipher.openMetadata(metadata); err != nil {
+		return "", fmt.Errorf("embedding status: %w", err)
+	}
+
+	switch {
+	case !embModel.Valid:
+		return EmbeddingMissing, nil
+	case embModel.String != model:
+		return EmbeddingWrongModel, nil
+	case hash.Valid:
+		if hash.String != db.cipher.hash(embedding.Text(content, metadata, fields)) {
+			return EmbeddingStale, nil
 		}
-		chunks = append(chunks, chunk)
+	case createdAt.Int64 < updatedAt.Unix():
+		// Embeddings saved before content hashes were recorded: fall back to timestamps
+		return EmbeddingStale, nil
 	}
-	return chunks, rows.Err()
+	return EmbeddingFresh, nil
+}
+
+// contentHash returns the hex SHA-256 of chunk content.
+func contentHash(content string) string {
+	h := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(h[:])
 }
 
 // float32ToBytes converts a float32 slice to bytes (little-endian).
@@ -1,8 +1,11 @@
 package storage
 
 import (
+	"context"
 	"path/filepath"
 	"testing"
+
+	"github.com/neoden/mykb/embedding"
 )
 
 func setupEmbeddingsTestDB(t *testing.T) *DB {
@@ -20,23 +23,24 @@ func setupEmbeddingsTestDB(t *testing.T) *DB {
 }
 
 func TestSaveAndGetEmbedding(t *testing.T) {
+	ctx := context.Background()
 	db := setupEmbeddingsTestDB(t)
 
 	// Create a chunk first
-	chunk, err := db.CreateChunk("test content", nil)
+	chunk, err := db.CreateChunk(ctx, "test content", nil)
 	if err != nil {
 		t.Fatalf("CreateChunk: %v", err)
 	}
 
 	// Save embedding
 	vec := []float32{0.1, 0.2, 0.3, 0.4}
-	err = db.SaveEmbedding(chunk.ID, "openai/text-embedding-3-small", vec)
+	err = db.SaveEmbedding(ctx, chunk.ID, "openai/text-embedding-3-small", chunk.Content, vec)
 	if err != nil {
 		t.Fatalf("SaveEmbedding: %v", err)
 	}
 
 	// Get embedding
-	got, err := db.GetEmbedding(chunk.ID)
+	got, err := db.GetEmbedding(ctx, chunk.ID)
 	if err != nil {
 		t.Fatalf("GetEmbedding: %v", err)
 	}
@@ -52,59 +56,142 @@ func TestSaveAndGetEmbedding(t *testing.T) {
 }
 
 func TestSaveEmbeddingUpsert(t *testing.T) {
+	ctx := context.Background()
 	db := setupEmbeddingsTestDB(t)
 
-	chunk, _ := db.CreateChunk("test", nil)
+	chunk, _ := db.CreateChunk(ctx, "test", nil)
 
 	// Save first embedding
 	vec1 := []float32{0.1, 0.2}
-	db.SaveEmbedding(chunk.ID, "model1", vec1)
+	db.SaveEmbedding(ctx, chunk.ID, "model1", chunk.Content, vec1)
 
-	// Upsert with new embedding
+	// Upsert with new embedding from the same model
 	vec2 := []float32{0.3, 0.4}
-	err := db.SaveEmbedding(chunk.ID, "model2", vec2)
+	err := db.SaveEmbedding(ctx, chunk.ID, "model1", chunk.Content, vec2)
 	if err != nil {
 		t.Fatalf("SaveEmbedding upsert: %v", err)
 	}
 
 	// Should get new embedding
-	got, _ := db.GetEmbedding(chunk.ID)
+	got, _ := db.GetEmbedding(ctx, chunk.ID)
 	if got[0] != vec2[0] || got[1] != vec2[1] {
 		t.Errorf("got = %v, want %v", got, vec2)
 	}
+	if all, _ := db.GetEmbeddings(ctx, chunk.ID); len(all) != 1 {
+		t.Errorf("GetEmbeddings = %v, want one model", all)
+	}
+}
+
+func TestEmbeddingsPerModel(t *testing.T) {
+	ctx := context.Background()
+	db := setupEmbeddingsTestDB(t)
+
+	chunk, _ := db.CreateChunk(ctx, "test", nil)
+	db.SaveEmbedding(ctx, chunk.ID, "model1", chunk.Content, []float32{0.1, 0.2})
+	db.SaveEmbedding(ctx, chunk.ID, "model2", chunk.Content, []float32{0.3, 0.4, 0.5})
+
+	all, err := db.GetEmbeddings(ctx, chunk.ID)
+	if err != nil {
+		t.Fatalf("GetEmbeddings: %v", err)
+	}
+	if len(all["model1"]) != 2 || len(all["model2"]) != 3 {
+		t.Errorf("GetEmbeddings = %v", all)
+	}
+	for _, model := range []string{"model1", "model2"} {
+		if vecs, _ := db.LoadEmbeddingsByModel(ctx, model); len(vecs) != 1 {
+			t.Errorf("LoadEmbeddingsByModel(%s) = %d vectors, want 1", model, len(vecs))
+		}
+		if status, _ := db.EmbeddingStatus(ctx, chunk.ID, model, nil); status != EmbeddingFresh {
+			t.Errorf("EmbeddingStatus(%s) = %s, want fresh", model, status)
+		}
+	}
+	if status, _ := db.EmbeddingStatus(ctx, chunk.ID, "model3", nil); status != EmbeddingWrongModel {
+		t.Errorf("EmbeddingStatus(model3) = %s, want wrong_model", status)
+	}
+
+	db.DeleteEmbedding(ctx, chunk.ID)
+	if all, _ := db.GetEmbeddings(ctx, chunk.ID); len(all) != 0 {
+		t.Errorf("GetEmbeddings after delete = %v", all)
+	}
+}
+
+func TestMigrateEmbeddingsPerModel(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	// Build the schema as it was before embeddings were keyed by model
+	if _, err := db.conn.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations {
+		if m.id == "009_embeddings_per_model" {
+			break
+		}
+		if _, err := db.conn.Exec(m.sql); err != nil {
+			t.Fatalf("%s: %v", m.id, err)
+		}
+		db.conn.Exec("INSERT INTO migrations (id) VALUES (?)", m.id)
+	}
+	chunk := &Chunk{ID: "c1"}
+	if _, err := db.conn.Exec(`INSERT INTO chunks (id, content) VALUES (?, 'old')`, chunk.ID); err != nil {
+		t.Fatalf("insert chunk on old schema: %v", err)
+	}
+	if _, err := db.conn.Exec(`INSERT INTO embeddings (chunk_id, model, embedding, content_hash) VALUES (?, ?, ?, ?)`,
+		chunk.ID, "model1", float32ToBytes([]float32{0.1}), contentHash("old")); err != nil {
+		t.Fatalf("insert on old schema: %v", err)
+	}
+
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if status, _ := db.EmbeddingStatus(ctx, chunk.ID, "model1", nil); status != EmbeddingFresh {
+		t.Errorf("status after migration = %s, want fresh", status)
+	}
+	if err := db.SaveEmbedding(ctx, chunk.ID, "model2", chunk.Content, []float32{0.2}); err != nil {
+		t.Fatalf("SaveEmbedding: %v", err)
+	}
+	if all, _ := db.GetEmbeddings(ctx, chunk.ID); len(all) != 2 {
+		t.Errorf("GetEmbeddings = %v, want two models", all)
+	}
 }
 
 func TestDeleteEmbedding(t *testing.T) {
+	ctx := context.Background()
 	db := setupEmbeddingsTestDB(t)
 
-	chunk, _ := db.CreateChunk("test", nil)
-	db.SaveEmbedding(chunk.ID, "model", []float32{0.1, 0.2})
+	chunk, _ := db.CreateChunk(ctx, "test", nil)
+	db.SaveEmbedding(ctx, chunk.ID, "model", chunk.Content, []float32{0.1, 0.2})
 
-	err := db.DeleteEmbedding(chunk.ID)
+	err := db.DeleteEmbedding(ctx, chunk.ID)
 	if err != nil {
 		t.Fatalf("DeleteEmbedding: %v", err)
 	}
 
-	_, err = db.GetEmbedding(chunk.ID)
+	_, err = db.GetEmbedding(ctx, chunk.ID)
 	if err == nil {
 		t.Error("Expected error after delete")
 	}
 }
 
 func TestLoadEmbeddingsByModel(t *testing.T) {
+	ctx := context.Background()
 	db := setupEmbeddingsTestDB(t)
 
 	// Create chunks and embeddings with different models
-	c1, _ := db.CreateChunk("one", nil)
-	c2, _ := db.CreateChunk("two", nil)
-	c3, _ := db.CreateChunk("three", nil)
+	c1, _ := db.CreateChunk(ctx, "one", nil)
+	c2, _ := db.CreateChunk(ctx, "two", nil)
+	c3, _ := db.CreateChunk(ctx, "three", nil)
 
-	db.SaveEmbedding(c1.ID, "openai/text-embedding-3-small", []float32{0.1, 0.2})
-	db.SaveEmbedding(c2.ID, "openai/text-embedding-3-small", []float32{0.3, 0.4})
-	db.SaveEmbedding(c3.ID, "ollama/nomic-embed-text", []float32{0.5, 0.6})
+	db.SaveEmbedding(ctx, c1.ID, "openai/text-embedding-3-small", c1.Content, []float32{0.1, 0.2})
+	db.SaveEmbedding(ctx, c2.ID, "openai/text-embedding-3-small", c2.Content, []float32{0.3, 0.4})
+	db.SaveEmbedding(ctx, c3.ID, "ollama/nomic-embed-text", c3.Content, []float32{0.5, 0.6})
 
 	// Load only OpenAI embeddings
-	vecs, err := db.LoadEmbeddingsByModel("openai/text-embedding-3-small")
+	vecs, err := db.LoadEmbeddingsByModel(ctx, "openai/text-embedding-3-small")
 	if err != nil {
 		t.Fatalf("LoadEmbeddingsByModel: %v", err)
 	}
@@ -124,16 +211,17 @@ func TestLoadEmbeddingsByModel(t *testing.T) {
 	}
 
 	// Load Ollama embeddings
-	vecs2, _ := db.LoadEmbeddingsByModel("ollama/nomic-embed-text")
+	vecs2, _ := db.LoadEmbeddingsByModel(ctx, "ollama/nomic-embed-text")
 	if len(vecs2) != 1 {
 		t.Errorf("len(vecs2) = %d, want 1", len(vecs2))
 	}
 }
 
 func TestLoadEmbeddingsByModelEmpty(t *testing.T) {
+	ctx := context.Background()
 	db := setupEmbeddingsTestDB(t)
 
-	vecs, err := db.LoadEmbeddingsByModel("nonexistent/model")
+	vecs, err := db.LoadEmbeddingsByModel(ctx, "nonexistent/model")
 	if err != nil {
 		t.Fatalf("LoadEmbeddingsByModel: %v", err)
 	}
@@ -143,16 +231,46 @@ func TestLoadEmbeddingsByModelEmpty(t *testing.T) {
 	}
 }
 
+func TestLoadEmbeddingsFor(t *testing.T) {
+	ctx := context.Background()
+	db := setupEmbeddingsTestDB(t)
+
+	c1, _ := db.CreateChunk(ctx, "one", nil)
+	c2, _ := db.CreateChunk(ctx, "two", nil)
+	c3, _ := db.CreateChunk(ctx, "three", nil)
+	model := "openai/text-embedding-3-small"
+	db.SaveEmbedding(ctx, c1.ID, model, c1.Content, []float32{0.1, 0.2})
+	db.SaveEmbedding(ctx, c2.ID, model, c2.Content, []float32{0.3, 0.4})
+	db.SaveEmbedding(ctx, c3.ID, "ollama/nomic-embed-text", c3.Content, []float32{0.5, 0.6})
+
+	vecs, err := db.LoadEmbeddingsFor(ctx, model, []string{c2.ID, c3.ID, "missing"})
+	if err != nil {
+		t.Fatalf("LoadEmbeddingsFor: %v", err)
+	}
+	if len(vecs) != 1 || vecs[c2.ID] == nil {
+		t.Errorf("vecs = %v, want only c2", vecs)
+	}
+
+	times, err := db.EmbeddingTimes(ctx, model)
+	if err != nil {
+		t.Fatalf("EmbeddingTimes: %v", err)
+	}
+	if len(times) != 2 || times[c1.ID] == 0 || times[c2.ID] == 0 {
+		t.Errorf("times = %v, want c1 and c2", times)
+	}
+}
+
 func TestGetChunksWithoutEmbeddings(t *testing.T) {
+	ctx := context.Background()
 	db := setupEmbeddingsTestDB(t)
 
-	c1, _ := db.CreateChunk("has embedding", nil)
-	c2, _ := db.CreateChunk("no embedding", nil)
-	c3, _ := db.CreateChunk("also no embedding", nil)
+	c1, _ := db.CreateChunk(ctx, "has embedding", nil)
+	c2, _ := db.CreateChunk(ctx, "no embedding", nil)
+	c3, _ := db.CreateChunk(ctx, "also no embedding", nil)
 
-	db.SaveEmbedding(c1.ID, "openai/model", []float32{0.1})
+	db.SaveEmbedding(ctx, c1.ID, "openai/model", c1.Content, []float32{0.1})
 
-	chunks, err := db.GetChunksWithoutEmbeddings("openai/model")
+	chunks, err := db.GetChunksWithoutEmbeddings(ctx, "openai/model")
 	if err != nil {
 		t.Fatalf("GetChunksWithoutEmbeddings: %v", err)
 	}
@@ -177,16 +295,47 @@ func TestGetChunksWithoutEmbeddings(t *testing.T) {
 	}
 }
 
+func TestGetChunksWithoutEmbeddingsPage(t *testing.T) {
+	ctx := context.Background()
+	db := setupEmbeddingsTestDB(t)
+	for _, c := range []string{"a", "b", "c", "d"} {
+		db.CreateChunk(ctx, c, nil)
+	}
+	first, _ := db.GetChunksWithoutEmbeddingsPage(ctx, "openai/model", "", 2)
+	if len(first) != 2 {
+		t.Fatalf("first page = %d chunks, want 2", len(first))
+	}
+
+	// Embedding the first page does not skip any of the rest
+	for _, c := range first {
+		db.SaveEmbedding(ctx, c.ID, "openai/model", c.Content, []float32{0.1})
+	}
+	if n, err := db.CountChunksWithoutEmbeddings(ctx, "openai/model"); err != nil || n != 2 {
+		t.Errorf("CountChunksWithoutEmbeddings = %d, %v; want 2", n, err)
+	}
+	rest, err := db.GetChunksWithoutEmbeddingsPage(ctx, "openai/model", first[1].ID, 2)
+	if err != nil {
+		t.Fatalf("GetChunksWithoutEmbeddingsPage: %v", err)
+	}
+	if len(rest) != 2 {
+		t.Errorf("second page = %d chunks, want 2", len(rest))
+	}
+	if more, _ := db.GetChunksWithoutEmbeddingsPage(ctx, "openai/model", rest[len(rest)-1].ID, 2); len(more) != 0 {
+		t.Errorf("third page = %d chunks, want 0", len(more))
+	}
+}
+
 func TestGetChunksWithoutEmbeddingsAllHave(t *testing.T) {
+	ctx := context.Background()
 	db := setupEmbeddingsTestDB(t)
 
-	c1, _ := db.CreateChunk("one", nil)
-	c2, _ := db.CreateChunk("two", nil)
+	c1, _ := db.CreateChunk(ctx, "one", nil)
+	c2, _ := db.CreateChunk(ctx, "two", nil)
 
-	db.SaveEmbedding(c1.ID, "openai/model", []float32{0.1})
-	db.SaveEmbedding(c2.ID, "openai/model", []float32{0.2})
+	db.SaveEmbedding(ctx, c1.ID, "openai/model", c1.Content, []float32{0.1})
+	db.SaveEmbedding(ctx, c2.ID, "openai/model", c2.Content, []float32{0.2})
 
-	chunks, err := db.GetChunksWithoutEmbeddings("openai/model")
+	chunks, err := db.GetChunksWithoutEmbeddings(ctx, "openai/model")
 	if err != nil {
 		t.Fatalf("GetChunksWithoutEmbeddings: %v", err)
 	}
@@ -197,17 +346,18 @@ func TestGetChunksWithoutEmbeddingsAllHave(t *testing.T) {
 }
 
 func TestGetChunksWithoutEmbeddingsDifferentModel(t *testing.T) {
+	ctx := context.Background()
 	db := setupEmbeddingsTestDB(t)
 
-	c1, _ := db.CreateChunk("has openai embedding", nil)
-	c2, _ := db.CreateChunk("has ollama embedding", nil)
-	c3, _ := db.CreateChunk("no embedding", nil)
+	c1, _ := db.CreateChunk(ctx, "has openai embedding", nil)
+	c2, _ := db.CreateChunk(ctx, "has ollama embedding", nil)
+	c3, _ := db.CreateChunk(ctx, "no embedding", nil)
 
-	db.SaveEmbedding(c1.ID, "openai/text-embedding-3-small", []float32{0.1})
-	db.SaveEmbedding(c2.ID, "ollama/nomic-embed-text", []float32{0.2})
+	db.SaveEmbedding(ctx, c1.ID, "openai/text-embedding-3-small", c1.Content, []float32{0.1})
+	db.SaveEmbedding(ctx, c2.ID, "ollama/nomic-embed-text", c2.Content, []float32{0.2})
 
 	// When querying for openai model, c2 should be included (has wrong model)
-	chunks, err := db.GetChunksWithoutEmbeddings("openai/text-embedding-3-small")
+	chunks, err := db.GetChunksWithoutEmbeddings(ctx, "openai/text-embedding-3-small")
 	if err != nil {
 		t.Fatalf("GetChunksWithoutEmbeddings: %v", err)
 	}
@@ -233,15 +383,16 @@ func TestGetChunksWithoutEmbeddingsDifferentModel(t *testing.T) {
 }
 
 func TestCascadeDeleteEmbedding(t *testing.T) {
+	ctx := context.Background()
 	db := setupEmbeddingsTestDB(t)
 
-	chunk, _ := db.CreateChunk("test", nil)
-	db.SaveEmbedding(chunk.ID, "model", []float32{0.1, 0.2})
+	chunk, _ := db.CreateChunk(ctx, "test", nil)
+	db.SaveEmbedding(ctx, chunk.ID, "model", chunk.Content, []float32{0.1, 0.2})
 
 	// Delete chunk should cascade to embedding
-	db.DeleteChunk(chunk.ID)
+	db.DeleteChunk(ctx, chunk.ID)
 
-	_, err := db.GetEmbedding(chunk.ID)
+	_, err := db.GetEmbedding(ctx, chunk.ID)
 	if err == nil {
 		t.Error("Embedding should be deleted with chunk")
 	}
@@ -263,3 +414,80 @@ func TestFloat32BytesRoundtrip(t *testing.T) {
 		}
 	}
 }
+
+func TestEmbeddingStatus(t *testing.T) {
+	ctx := context.Background()
+	db := setupEmbeddingsTestDB(t)
+
+	chunk, _ := db.CreateChunk(ctx, "original", nil)
+
+	status, err := db.EmbeddingStatus(ctx, chunk.ID, "model-a", nil)
+	if err != nil {
+		t.Fatalf("EmbeddingStatus: %v", err)
+	}
+	if status != EmbeddingMissing {
+		t.Errorf("status = %q, want %q", status, EmbeddingMissing)
+	}
+
+	db.SaveEmbedding(ctx, chunk.ID, "model-a", chunk.Content, []float32{1, 2})
+	if status, _ := db.EmbeddingStatus(ctx, chunk.ID, "model-a", nil); status != EmbeddingFresh {
+		t.Errorf("status = %q, want %q", status, EmbeddingFresh)
+	}
+	if status, _ := db.EmbeddingStatus(ctx, chunk.ID, "model-b", nil); status != EmbeddingWrongModel {
+		t.Errorf("status = %q, want %q", status, EmbeddingWrongModel)
+	}
+
+	// Metadata-only update keeps the embedding fresh
+	db.UpdateChunk(ctx, chunk.ID, nil, []byte(`{"tag":"x"}`))
+	if status, _ := db.EmbeddingStatus(ctx, chunk.ID, "model-a", nil); status != EmbeddingFresh {
+		t.Errorf("after metadata update: status = %q, want %q", status, EmbeddingFresh)
+	}
+
+	newContent := "edited"
+	db.UpdateChunk(ctx, chunk.ID, &newContent, nil)
+	if status, _ := db.EmbeddingStatus(ctx, chunk.ID, "model-a", nil); status != EmbeddingStale {
+		t.Errorf("after content update: status = %q, want %q", status, EmbeddingStale)
+	}
+}
+
+func TestEmbeddingStatusEmbeddedText(t *testing.T) {
+	ctx := context.Background()
+	db := setupEmbeddingsTestDB(t)
+	fields := []string{"title"}
+
+	chunk, _ := db.CreateChunk(ctx, "body", []byte(`{"title":"First","tag":"x"}`))
+	text := embedding.Text(chunk.Content, chunk.Metadata, fields)
+	db.SaveEmbedding(ctx, chunk.ID, "model", text, []float32{1, 2})
+	if status, _ := db.EmbeddingStatus(ctx, chunk.ID, "model", fields); status != EmbeddingFresh {
+		t.Errorf("status = %q, want %q", status, EmbeddingFresh)
+	}
+
+	// Changing a metadata field that is not embedded keeps it fresh
+	db.UpdateChunk(ctx, chunk.ID, nil, []byte(`{"title":"First","tag":"y"}`))
+	if status, _ := db.EmbeddingStatus(ctx, chunk.ID, "model", fields); status != EmbeddingFresh {
+		t.Errorf("after tag update: status = %q, want %q", status, EmbeddingFresh)
+	}
+	db.UpdateChunk(ctx, chunk.ID, nil, []byte(`{"title":"Second","tag":"y"}`))
+	if status, _ := db.EmbeddingStatus(ctx, chunk.ID, "model", fields); status != EmbeddingStale {
+		t.Errorf("after title update: status = %q, want %q", status, EmbeddingStale)
+	}
+
+	// A vector of text the chunk has moved on from is stale when saved
+	db.SaveEmbedding(ctx, chunk.ID, "model", text, []float32{1, 2})
+	if status, _ := db.EmbeddingStatus(ctx, chunk.ID, "model", fields); status != EmbeddingStale {
+		t.Errorf("saved for old text: status = %q, want %q", status, EmbeddingStale)
+	}
+
+	if err := db.SaveEmbedding(ctx, "nonexistent", "model", "x", []float32{1}); err != ErrChunkNotFound {
+		t.Errorf("SaveEmbedding(nonexistent) = %v, want ErrChunkNotFound", err)
+	}
+}
+
+func TestEmbeddingStatusNotFound(t *testing.T) {
+	ctx := context.Background()
+	db := setupEmbeddingsTestDB(t)
+
+	if _, err := db.EmbeddingStatus(ctx, "nonexistent", "model", nil); err != ErrChunkNotFound {
+		t.Errorf("err = %v, want ErrChunkNotFound", err)
+	}
+}
@@ -0,0 +1,516 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/neoden/mykb/embedding"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Config holds storage settings.
+type Config struct {
+	// EncryptionKeyFile holds a 32-byte key (raw, hex, or base64).
+	EncryptionKeyFile string `toml:"encryption_key_file"`
+	// EncryptionPassphraseEnv names an environment variable holding a
+	// passphrase to derive the key from (used if no key file is set).
+	EncryptionPassphraseEnv string `toml:"encryption_passphrase_env"`
+
+	// ReadOnly serves data.db as a mirror of a replicated copy (rsync,
+	// Litestream): migrations are skipped, writes are rejected, and the
+	// vector index is reloaded when the file changes.
+	ReadOnly bool `toml:"read_only"`
+}
+
+// EncryptionEnabled reports whether encryption is configured.
+func (c Config) EncryptionEnabled() bool {
+	return c.EncryptionKeyFile != "" || c.EncryptionPassphraseEnv != ""
+}
+
+var (
+	// ErrEncrypted is returned when opening an encrypted database without a key.
+	ErrEncrypted = errors.New("database is encrypted: configure [storage] encryption")
+	// ErrWrongKey is returned when the configured key does not match the database.
+	ErrWrongKey = errors.New("encryption key does not match database")
+)
+
+// Encrypted values are tagged so plaintext rows written before encryption
+// was enabled stay readable until EncryptAll rewrites them.
+const (
+	encPrefix      = "enc1:"
+	encCheckValue  = "mykb-encryption-check"
+	settingSalt    = "encryption_salt"
+	settingCheck   = "encryption_check"
+	encryptionKeyN = 32
+)
+
+// fieldCipher encrypts chunk content, metadata, and embeddings with
+// AES-256-GCM. A nil *fieldCipher passes data through unchanged; an
+// encrypted database is never opened without a key (see ConfigureEncryption).
+type fieldCipher struct {
+	aead cipher.AEAD
+	mac  []byte // key for content hashes, so they do not reveal plaintext
+}
+
+func newFieldCipher(key []byte) (*fieldCipher, error) {
+	if len(key) != encryptionKeyN {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", encryptionKeyN, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("content-hash"))
+	return &fieldCipher{aead: aead, mac: mac.Sum(nil)}, nil
+}
+
+func (c *fieldCipher) seal(plain []byte) []byte {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return c.aead.Seal(nonce, nonce, plain, nil)
+}
+
+func (c *fieldCipher) open(sealed []byte) ([]byte, error) {
+	n := c.aead.NonceSize()
+	if len(sealed) < n {
+		return nil, ErrWrongKey
+	}
+	plain, err := c.aead.Open(nil, sealed[:n], sealed[n:], nil)
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return plain, nil
+}
+
+func (c *fieldCipher) sealString(s string) string {
+	if c == nil {
+		return s
+	}
+	return encPrefix + base64.RawStdEncoding.EncodeToString(c.seal([]byte(s)))
+}
+
+func (c *fieldCipher) openString(s string) (string, error) {
+	if c == nil || !strings.HasPrefix(s, encPrefix) {
+		return s, nil
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(s[len(encPrefix):])
+	if err != nil {
+		return "", ErrWrongKey
+	}
+	plain, err := c.open(sealed)
+	return string(plain), err
+}
+
+func (c *fieldCipher) sealBytes(b []byte) []byte {
+	if c == nil {
+		return b
+	}
+	return append([]byte(encPrefix), c.seal(b)...)
+}
+
+func (c *fieldCipher) openBytes(b []byte) ([]byte, error) {
+	if c == nil || !bytes.HasPrefix(b, []byte(encPrefix)) {
+		return b, nil
+	}
+	return c.open(b[len(encPrefix):])
+}
+
+// sealMetadata encrypts metadata, keeping NULL for empty metadata.
+func (c *fieldCipher) sealMetadata(metadata []byte) *string {
+	if len(metadata) == 0 {
+		return nil
+	}
+	s := c.sealString(string(metadata))
+	return &s
+}
+
+// openChunk decrypts a chunk's content and metadata in place.
+func (c *fieldCipher) openChunk(chunk *Chunk) error {
+	var err error
+	if chunk.Content, err = c.openString(chunk.Content); err != nil {
+		return err
+	}
+	chunk.Metadata, err = c.openMetadata(chunk.Metadata)
+	return err
+}
+
+// openResult decrypts a search result's content and metadata in place.
+func (c *fieldCipher) openResult(r *SearchResult) error {
+	var err error
+	if r.Content, err = c.openString(r.Content); err != nil {
+		return err
+	}
+	r.Metadata, err = c.openMetadata(r.Metadata)
+	return err
+}
+
+func (c *fieldCipher) openMetadata(metadata []byte) ([]byte, error) {
+	if len(metadata) == 0 {
+		return metadata, nil
+	}
+	m, err := c.openString(string(metadata))
+	return []byte(m), err
+}
+
+// hash returns the content hash recorded with embeddings.
+func (c *fieldCipher) hash(content string) string {
+	if c == nil {
+		return contentHash(content)
+	}
+	mac := hmac.New(sha256.New, c.mac)
+	mac.Write([]byte(content))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ConfigureEncryption enables encryption according to cfg. It fails if the
+// database was encrypted but cfg configures no key, or the key is wrong.
+func (db *DB) ConfigureEncryption(cfg Config) error {
+	if !cfg.EncryptionEnabled() {
+		if _, err := db.GetSetting(context.Background(), settingCheck); err == nil {
+			return ErrEncrypted
+		}
+		return nil
+	}
+
+	var key []byte
+	var err error
+	if cfg.EncryptionKeyFile != "" {
+		key, err = LoadKeyFile(cfg.EncryptionKeyFile)
+	} else {
+		passphrase := os.Getenv(cfg.EncryptionPassphraseEnv)
+		if passphrase == "" {
+			return fmt.Errorf("encryption passphrase: $%s is not set", cfg.EncryptionPassphraseEnv)
+		}
+		key, err = db.DeriveKey(passphrase)
+	}
+	if err != nil {
+		return err
+	}
+	return db.SetEncryptionKey(key)
+}
+
+// SetEncryptionKey encrypts all subsequent writes with key. The first key
+// set on a database is remembered (as an encrypted check value) so a wrong
+// key is rejected instead of silently producing unreadable rows.
+func (db *DB) SetEncryptionKey(key []byte) error {
+	c, err := newFieldCipher(key)
+	if err != nil {
+		return err
+	}
+
+	check, err := db.GetSetting(context.Background(), settingCheck)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		if err := db.SetSetting(context.Background(), settingCheck, c.sealString(encCheckValue)); err != nil {
+			return fmt.Errorf("store encryption check: %w", err)
+		}
+	case err != nil:
+		return fmt.Errorf("read encryption check: %w", err)
+	default:
+		if v, err := c.openString(check); err != nil || v != encCheckValue {
+			return ErrWrongKey
+		}
+	}
+
+	db.cipher = c
+	db.search.invalidate()
+	return nil
+}
+
+// Encrypted reports whether an encryption key is in use.
+func (db *DB) Encrypted() bool {
+	return db.cipher != nil
+}
+
+// DeriveKey derives an encryption key from a passphrase using scrypt.
+// The salt is generated on first use and stored in settings.
+func (db *DB) DeriveKey(passphrase string) ([]byte, error) {
+	saltHex, err := db.GetSetting(context.Background(), settingSalt)
+	if errors.Is(err, ErrNotFound) {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, fmt.Errorf("crypto/rand failed: %w", err)
+		}
+		saltHex = hex.EncodeToString(salt)
+		if err := db.SetSetting(context.Background(), settingSalt, saltHex); err != nil {
+			return nil, fmt.Errorf("store salt: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("read salt: %w", err)
+	}
+	salt, err := hex.DecodeString(saltHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %w", err)
+	}
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, encryptionKeyN)
+}
+
+// LoadKeyFile reads a 32-byte key stored raw, hex-encoded, or base64-encoded.
+func LoadKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key file: %w", err)
+	}
+	if len(data) == encryptionKeyN {
+		return data, nil
+	}
+	text := strings.TrimSpace(string(data))
+	if key, err := hex.DecodeString(text); err == nil && len(key) == encryptionKeyN {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == encryptionKeyN {
+		return key, nil
+	}
+	return nil, fmt.Errorf("key file must contain %d bytes (raw, hex, or base64)", encryptionKeyN)
+}
+
+// EncryptAll rewrites plaintext chunks, embeddings, recorded tool calls,
+// sources, attachments and entities with the configured key, and rebuilds
+// the full-text indexes, whose segments would otherwise keep every
+// plaintext term: updates only add delete markers. A full VACUUM then
+// drops the freed pages; their old copies stay in the WAL until it is
+// checkpointed. fields are the metadata fields embedded with content, to
+// key the hashes of embeddings saved for the chunk as it is.
+// Returns the number of chunks encrypted.
+func (db *DB) EncryptAll(ctx context.Context, fields []string) (int, error) {
+	if db.cipher == nil {
+		return 0, fmt.Errorf("encryption is not configured")
+	}
+	defer db.search.invalidate()
+
+	tx, err := db.beginWrite(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, content, metadata FROM chunks`)
+	if err != nil {
+		return 0, fmt.Errorf("select chunks: %w", err)
+	}
+	type plainChunk struct {
+		id, content string
+		metadata    *string
+	}
+	var chunks []plainChunk
+	for rows.Next() {
+		var c plainChunk
+		if err := rows.Scan(&c.id, &c.content, &c.metadata); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan chunk: %w", err)
+		}
+		if _, err := db.cipher.openString(c.content); err == nil && strings.HasPrefix(c.content, encPrefix) {
+			continue // already encrypted
+		}
+		chunks = append(chunks, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, c := range chunks {
+		var meta []byte
+		if c.metadata != nil {
+			meta = []byte(*c.metadata)
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE chunks SET content = ?, metadata = ? WHERE id = ?`,
+			db.cipher.sealString(c.content), db.cipher.sealMetadata(meta), c.id); err != nil {
+			return 0, fmt.Errorf("encrypt chunk %s: %w", c.id, err)
+		}
+		// Content hashes must now be keyed; the embedding itself is unchanged
+		text := embedding.Text(c.content, meta, fields)
+		if _, err := tx.ExecContext(ctx, `UPDATE embeddings SET content_hash = ? WHERE chunk_id = ? AND content_hash = ?`,
+			db.cipher.hash(text), c.id, contentHash(text)); err != nil {
+			return 0, fmt.Errorf("rehash embedding %s: %w", c.id, err)
+		}
+	}
+
+	embRows, err := tx.QueryContext(ctx, `SELECT rowid, embedding FROM embeddings`)
+	if err != nil {
+		return 0, fmt.Errorf("select embeddings: %w", err)
+	}
+	plainEmb := make(map[int64][]byte)
+	for embRows.Next() {
+		var id int64
+		var blob []byte
+		if err := embRows.Scan(&id, &blob); err != nil {
+			embRows.Close()
+			return 0, fmt.Errorf("scan embedding: %w", err)
+		}
+		if _, err := db.cipher.openBytes(blob); err != nil || !bytes.HasPrefix(blob, []byte(encPrefix)) {
+			plainEmb[id] = blob
+		}
+	}
+	embRows.Close()
+	for id, blob := range plainEmb {
+		if _, err := tx.ExecContext(ctx, `UPDATE embeddings SET embedding = ? WHERE rowid = ?`, db.cipher.sealBytes(blob), id); err != nil {
+			return 0, fmt.Errorf("encrypt embedding %d: %w", id, err)
+		}
+	}
+
+	// Recorded tool calls quote chunk content in their arguments and responses
+	callRows, err := tx.QueryContext(ctx, `SELECT id, arguments, response FROM tool_calls`)
+	if err != nil {
+		return 0, fmt.Errorf("select tool calls: %w", err)
+	}
+	plainCalls := make(map[int64][2][]byte)
+	for callRows.Next() {
+		var id int64
+		var args, resp []byte
+		if err := callRows.Scan(&id, &args, &resp); err != nil {
+			callRows.Close()
+			return 0, fmt.Errorf("scan tool call: %w", err)
+		}
+		if !bytes.HasPrefix(args, []byte(encPrefix)) {
+			plainCalls[id] = [2][]byte{args, resp}
+		}
+	}
+	callRows.Close()
+	for id, c := range plainCalls {
+		if _, err := tx.ExecContext(ctx, `UPDATE tool_calls SET arguments = ?, response = ? WHERE id = ?`,
+			db.cipher.sealBytes(c[0]), db.cipher.sealBytes(c[1]), id); err != nil {
+			return 0, fmt.Errorf("encrypt tool call %d: %w", id, err)
+		}
+	}
+
+	// Source names and metadata are encrypted like chunk metadata
+	srcRows, err := tx.QueryContext(ctx, `SELECT id, name, metadata FROM sources`)
+	if err != nil {
+		return 0, fmt.Errorf("select sources: %w", err)
+	}
+	type plainSource struct {
+		id, name string
+		metadata *string
+	}
+	var sources []plainSource
+	for srcRows.Next() {
+		var src plainSource
+		if err := srcRows.Scan(&src.id, &src.name, &src.metadata); err != nil {
+			srcRows.Close()
+			return 0, fmt.Errorf("scan source: %w", err)
+		}
+		if !strings.HasPrefix(src.name, encPrefix) {
+			sources = append(sources, src)
+		}
+	}
+	srcRows.Close()
+	for _, src := range sources {
+		var meta []byte
+		if src.metadata != nil {
+			meta = []byte(*src.metadata)
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE sources SET name = ?, metadata = ? WHERE id = ?`,
+			db.cipher.sealString(src.name), db.cipher.sealMetadata(meta), src.id); err != nil {
+			return 0, fmt.Errorf("encrypt source %s: %w", src.id, err)
+		}
+	}
+
+	attRows, err := tx.QueryContext(ctx, `SELECT id, name, data FROM attachments`)
+	if err != nil {
+		return 0, fmt.Errorf("select attachments: %w", err)
+	}
+	type plainAttachment struct {
+		id, name string
+		data     []byte
+	}
+	var attachments []plainAttachment
+	for attRows.Next() {
+		var a plainAttachment
+		if err := attRows.Scan(&a.id, &a.name, &a.data); err != nil {
+			attRows.Close()
+			return 0, fmt.Errorf("scan attachment: %w", err)
+		}
+		if !strings.HasPrefix(a.name, encPrefix) {
+			attachments = append(attachments, a)
+		}
+	}
+	attRows.Close()
+	for _, a := range attachments {
+		if _, err := tx.ExecContext(ctx, `UPDATE attachments SET name = ?, data = ? WHERE id = ?`,
+			db.cipher.sealString(a.name), db.cipher.sealBytes(a.data), a.id); err != nil {
+			return 0, fmt.Errorf("encrypt attachment %s: %w", a.id, err)
+		}
+	}
+
+	// Entity keys must now be keyed, like content hashes
+	entRows, err := tx.QueryContext(ctx, `SELECT id, kind, name FROM entities`)
+	if err != nil {
+		return 0, fmt.Errorf("select entities: %w", err)
+	}
+	type plainEntity struct {
+		id         int64
+		kind, name string
+	}
+	var entities []plainEntity
+	for entRows.Next() {
+		var e plainEntity
+		if err := entRows.Scan(&e.id, &e.kind, &e.name); err != nil {
+			entRows.Close()
+			return 0, fmt.Errorf("scan entity: %w", err)
+		}
+		if !strings.HasPrefix(e.name, encPrefix) {
+			entities = append(entities, e)
+		}
+	}
+	entRows.Close()
+	for _, e := range entities {
+		key := db.entityKey(e.kind, e.name)
+		// One recorded since the key was set is merged into
+		var existing int64
+		err := tx.QueryRowContext(ctx, `SELECT id FROM entities WHERE key = ?`, key).Scan(&existing)
+		switch {
+		case err == nil:
+			if _, err := tx.ExecContext(ctx, `UPDATE OR IGNORE chunk_entities SET entity_id = ? WHERE entity_id = ?`, existing, e.id); err != nil {
+				return 0, fmt.Errorf("merge entity %d: %w", e.id, err)
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM entities WHERE id = ?`, e.id); err != nil {
+				return 0, fmt.Errorf("merge entity %d: %w", e.id, err)
+			}
+		case err == sql.ErrNoRows:
+			if _, err := tx.ExecContext(ctx, `UPDATE entities SET key = ?, name = ? WHERE id = ?`,
+				key, db.cipher.sealString(e.name), e.id); err != nil {
+				return 0, fmt.Errorf("encrypt entity %d: %w", e.id, err)
+			}
+		default:
+			return 0, fmt.Errorf("check entity %d: %w", e.id, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO chunks_fts(chunks_fts) VALUES ('rebuild')`); err != nil {
+		return 0, fmt.Errorf("rebuild index: %w", err)
+	}
+	if db.trigram {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO chunks_trigram(chunks_trigram) VALUES ('rebuild')`); err != nil {
+			return 0, fmt.Errorf("rebuild trigram index: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+
+	if _, err := db.conn.ExecContext(ctx, "VACUUM"); err != nil {
+		return len(chunks), fmt.Errorf("vacuum: %w", err)
+	}
+	return len(chunks), nil
+}
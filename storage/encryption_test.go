@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testKey = bytes.Repeat([]byte{0x42}, 32)
+
+func rawContent(t *testing.T, db *DB, id string) (string, string) {
+	t.Helper()
+	var content string
+	var meta *string
+	if err := db.conn.QueryRow("SELECT content, metadata FROM chunks WHERE id = ?", id).Scan(&content, &meta); err != nil {
+		t.Fatalf("raw select: %v", err)
+	}
+	if meta == nil {
+		return content, ""
+	}
+	return content, *meta
+}
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	if err := db.SetEncryptionKey(testKey); err != nil {
+		t.Fatalf("SetEncryptionKey: %v", err)
+	}
+
+	chunk, err := db.CreateChunk(ctx, "secret recipe for pancakes", json.RawMessage(`{"tags":["food"],"title":"Pancakes"}`))
+	if err != nil {
+		t.Fatalf("CreateChunk: %v", err)
+	}
+
+	content, meta := rawContent(t, db, chunk.ID)
+	if !strings.HasPrefix(content, encPrefix) || strings.Contains(content, "pancakes") {
+		t.Errorf("content stored in plaintext: %q", content)
+	}
+	if strings.Contains(meta, "Pancakes") {
+		t.Errorf("metadata stored in plaintext: %q", meta)
+	}
+
+	got, err := db.GetChunk(ctx, chunk.ID)
+	if err != nil {
+		t.Fatalf("GetChunk: %v", err)
+	}
+	if got.Content != "secret recipe for pancakes" || string(got.Metadata) != `{"tags":["food"],"title":"Pancakes"}` {
+		t.Errorf("GetChunk = %q %s", got.Content, got.Metadata)
+	}
+
+	results, err := db.SearchChunks(ctx, "PANCAKES recipe", 10)
+	if err != nil {
+		t.Fatalf("SearchChunks: %v", err)
+	}
+	if len(results) != 1 || !strings.Contains(results[0].Snippet, "<mark>pancakes</mark>") {
+		t.Errorf("SearchChunks = %+v", results)
+	} else if h := results[0].Highlights; len(h) != 2 || results[0].SnippetText[h[1].Start:h[1].End] != "pancakes" {
+		t.Errorf("Highlights = %v in %q", h, results[0].SnippetText)
+	}
+
+	idx, err := db.GetMetadataIndex(ctx, 10)
+	if err != nil {
+		t.Fatalf("GetMetadataIndex: %v", err)
+	}
+	keys := idx["keys"].(map[string]map[string]int)
+	if keys["tags"]["food"] != 1 || keys["title"]["Pancakes"] != 1 {
+		t.Errorf("GetMetadataIndex keys = %v", keys)
+	}
+
+	vals, err := db.GetMetadataValues(ctx, "tags", 10)
+	if err != nil {
+		t.Fatalf("GetMetadataValues: %v", err)
+	}
+	if vals["values"].(map[string]int)["food"] != 1 {
+		t.Errorf("GetMetadataValues = %v", vals)
+	}
+	if facet, err := db.FacetChunks(ctx, []string{chunk.ID}, "tags", 10); err != nil || facet["values"].(map[string]int)["food"] != 1 {
+		t.Errorf("FacetChunks = %v, %v", facet, err)
+	}
+
+	// Embeddings are encrypted and stay fresh across metadata-only updates
+	if err := db.SaveEmbedding(ctx, chunk.ID, "m", chunk.Content, []float32{0.5, 0.25}); err != nil {
+		t.Fatalf("SaveEmbedding: %v", err)
+	}
+	var blob []byte
+	db.conn.QueryRow("SELECT embedding FROM embeddings WHERE chunk_id = ?", chunk.ID).Scan(&blob)
+	if !bytes.HasPrefix(blob, []byte(encPrefix)) {
+		t.Error("embedding stored in plaintext")
+	}
+	vec, err := db.GetEmbedding(ctx, chunk.ID)
+	if err != nil || len(vec) != 2 || vec[0] != 0.5 {
+		t.Errorf("GetEmbedding = %v, %v", vec, err)
+	}
+	loaded, _ := db.LoadEmbeddingsByModel(ctx, "m")
+	if len(loaded[chunk.ID]) != 2 {
+		t.Errorf("LoadEmbeddingsByModel = %v", loaded)
+	}
+
+	db.UpdateChunk(ctx, chunk.ID, nil, json.RawMessage(`{"title":"Pancakes v2"}`))
+	if status, _ := db.EmbeddingStatus(ctx, chunk.ID, "m", nil); status != EmbeddingFresh {
+		t.Errorf("status after metadata update = %s, want fresh", status)
+	}
+	newContent := "waffles"
+	db.UpdateChunk(ctx, chunk.ID, &newContent, nil)
+	if status, _ := db.EmbeddingStatus(ctx, chunk.ID, "m", nil); status != EmbeddingStale {
+		t.Errorf("status after content update = %s, want stale", status)
+	}
+}
+
+func TestEncryptionWrongKey(t *testing.T) {
+	db := setupTestDB(t)
+	if err := db.SetEncryptionKey(testKey); err != nil {
+		t.Fatalf("SetEncryptionKey: %v", err)
+	}
+
+	other := bytes.Repeat([]byte{0x43}, 32)
+	if err := db.SetEncryptionKey(other); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("wrong key error = %v, want ErrWrongKey", err)
+	}
+	if err := db.SetEncryptionKey(testKey); err != nil {
+		t.Errorf("correct key rejected: %v", err)
+	}
+	if err := db.SetEncryptionKey([]byte("short")); err == nil {
+		t.Error("expected error for short key")
+	}
+}
+
+func TestConfigureEncryptionRequiresKey(t *testing.T) {
+	db := setupTestDB(t)
+
+	if err := db.ConfigureEncryption(Config{}); err != nil {
+		t.Fatalf("unencrypted database: %v", err)
+	}
+
+	t.Setenv("MYKB_TEST_PASSPHRASE", "correct horse battery staple")
+	if err := db.ConfigureEncryption(Config{EncryptionPassphraseEnv: "MYKB_TEST_PASSPHRASE"}); err != nil {
+		t.Fatalf("ConfigureEncryption: %v", err)
+	}
+	if !db.Encrypted() {
+		t.Error("Encrypted() = false")
+	}
+
+	// Reopening without a key is refused
+	db.cipher = nil
+	if err := db.ConfigureEncryption(Config{}); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("error = %v, want ErrEncrypted", err)
+	}
+
+	// Same passphrase derives the same key from the stored salt
+	if err := db.ConfigureEncryption(Config{EncryptionPassphraseEnv: "MYKB_TEST_PASSPHRASE"}); err != nil {
+		t.Errorf("reopen with passphrase: %v", err)
+	}
+
+	t.Setenv("MYKB_TEST_PASSPHRASE", "wrong")
+	if err := db.ConfigureEncryption(Config{EncryptionPassphraseEnv: "MYKB_TEST_PASSPHRASE"}); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("wrong passphrase error = %v, want ErrWrongKey", err)
+	}
+}
+
+func TestLoadKeyFile(t *testing.T) {
+	dir := t.TempDir()
+
+	hexPath := filepath.Join(dir, "hex.key")
+	os.WriteFile(hexPath, []byte(hex.EncodeToString(testKey)+"\n"), 0600)
+	key, err := LoadKeyFile(hexPath)
+	if err != nil || !bytes.Equal(key, testKey) {
+		t.Errorf("hex key = %x, %v", key, err)
+	}
+
+	rawPath := filepath.Join(dir, "raw.key")
+	os.WriteFile(rawPath, testKey, 0600)
+	key, err = LoadKeyFile(rawPath)
+	if err != nil || !bytes.Equal(key, testKey) {
+		t.Errorf("raw key = %x, %v", key, err)
+	}
+
+	badPath := filepath.Join(dir, "bad.key")
+	os.WriteFile(badPath, []byte("too short"), 0600)
+	if _, err := LoadKeyFile(badPath); err == nil {
+		t.Error("expected error for invalid key file")
+	}
+}
+
+func TestEncryptAll(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+
+	plain, _ := db.CreateChunk(ctx, "written before encryption", json.RawMessage(`{"k":"v"}`))
+	db.SaveEmbedding(ctx, plain.ID, "m", plain.Content, []float32{1, 2})
+
+	if err := db.SetEncryptionKey(testKey); err != nil {
+		t.Fatalf("SetEncryptionKey: %v", err)
+	}
+	already, _ := db.CreateChunk(ctx, "written after", nil)
+
+	// Plaintext rows stay readable before migration
+	if got, err := db.GetChunk(ctx, plain.ID); err != nil || got.Content != "written before encryption" {
+		t.Fatalf("GetChunk before EncryptAll = %v, %v", got, err)
+	}
+
+	n, err := db.EncryptAll(ctx, nil)
+	if err != nil {
+		t.Fatalf("EncryptAll: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("EncryptAll = %d, want 1", n)
+	}
+
+	content, meta := rawContent(t, db, plain.ID)
+	if !strings.HasPrefix(content, encPrefix) || !strings.HasPrefix(meta, encPrefix) {
+		t.Errorf("row not encrypted: %q %q", content, meta)
+	}
+	if got, _ := db.GetChunk(ctx, already.ID); got.Content != "written after" {
+		t.Errorf("already encrypted chunk = %q", got.Content)
+	}
+	if status, _ := db.EmbeddingStatus(ctx, plain.ID, "m", nil); status != EmbeddingFresh {
+		t.Errorf("status after EncryptAll = %s, want fresh", status)
+	}
+	if vec, err := db.GetEmbedding(ctx, plain.ID); err != nil || len(vec) != 2 {
+		t.Errorf("GetEmbedding after EncryptAll = %v, %v", vec, err)
+	}
+
+	var ftsHits int
+	db.conn.QueryRow("SELECT COUNT(*) FROM chunks_fts WHERE chunks_fts MATCH 'encryption'").Scan(&ftsHits)
+	if ftsHits != 0 {
+		t.Error("plaintext still present in FTS index")
+	}
+}
+
+func TestEncryptAllLeavesNoPlaintextInFile(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	if err := db.ConfigureSearch(SearchConfig{Trigram: true}); err != nil {
+		t.Fatalf("ConfigureSearch: %v", err)
+	}
+	db.CreateChunk(ctx, "meet at the xylophonist quarry", json.RawMessage(`{"tag":"quixoticwombat"}`))
+
+	db.SetEncryptionKey(testKey)
+	if _, err := db.EncryptAll(ctx, nil); err != nil {
+		t.Fatalf("EncryptAll: %v", err)
+	}
+	if _, err := db.Checkpoint(ctx, "TRUNCATE"); err != nil {
+		t.Fatalf("Checkpoint: %v", err)
+	}
+
+	// Neither the rows nor the full-text indexes keep a plaintext term
+	data, err := os.ReadFile(db.Path())
+	if err != nil {
+		t.Fatalf("read database: %v", err)
+	}
+	for _, word := range []string{"xylophonist", "quixoticwombat"} {
+		if bytes.Contains(data, []byte(word)) {
+			t.Errorf("database file still holds %q", word)
+		}
+	}
+}
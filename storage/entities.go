@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Entity kinds extracted from chunks.
+const (
+	EntityPerson  = "person"
+	EntityProject = "project"
+	EntityDate    = "date"
+)
+
+// EntityKinds lists the kinds of entity, in the order they are reported.
+var EntityKinds = []string{EntityPerson, EntityProject, EntityDate}
+
+// Entity is a person, project or date (YYYY-MM-DD) a chunk mentions.
+type Entity struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// EntityCount is an entity with how many chunks mention it.
+type EntityCount struct {
+	Entity
+	Chunks int `json:"chunks"`
+}
+
+// NormalizeEntity returns the form entity names are matched by: lower
+// case, with runs of spaces collapsed.
+func NormalizeEntity(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+// entityKey identifies an entity by kind and normalized name. It is keyed
+// like content hashes, so lookups work without revealing names.
+func (db *DB) entityKey(kind, name string) string {
+	return db.cipher.hash(kind + "\x00" + NormalizeEntity(name))
+}
+
+// SetChunkEntities replaces the entities recorded for a chunk. Entities no
+// chunk mentions any more are dropped.
+func (db *DB) SetChunkEntities(ctx context.Context, chunkID string, entities []Entity) error {
+	tx, err := db.beginWrite(ctx)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRowContext(ctx, `SELECT 1 FROM chunks WHERE id = ?`, chunkID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return ErrChunkNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("check chunk: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM chunk_entities WHERE chunk_id = ?`, chunkID); err != nil {
+		return fmt.Errorf("clear entities: %w", err)
+	}
+	for _, e := range entities {
+		if NormalizeEntity(e.Name) == "" {
+			continue
+		}
+		key := db.entityKey(e.Kind, e.Name)
+		// The first spelling seen is kept
+		if _, err := tx.ExecContext(ctx, `INSERT INTO entities (kind, key, name) VALUES (?, ?, ?) ON CONFLICT(key) DO NOTHING`,
+			e.Kind, key, db.cipher.sealString(strings.TrimSpace(e.Name))); err != nil {
+			return fmt.Errorf("insert entity: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO chunk_entities (chunk_id, entity_id) SELECT ?, id FROM entities WHERE key = ?`,
+			chunkID, key); err != nil {
+			return fmt.Errorf("link entity: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM entities WHERE id NOT IN (SELECT entity_id FROM chunk_entities)`); err != nil {
+		return fmt.Errorf("drop unused entities: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ChunkEntities returns the entities recorded for a chunk.
+func (db *DB) ChunkEntities(ctx context.Context, chunkID string) ([]Entity, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT e.kind, e.name FROM entities e
+		JOIN chunk_entities ce ON ce.entity_id = e.id
+		WHERE ce.chunk_id = ?
+	`, chunkID)
+	if err != nil {
+		return nil, fmt.Errorf("chunk entities: %w", err)
+	}
+	defer rows.Close()
+
+	entities := []Entity{}
+	for rows.Next() {
+		var e Entity
+		if err := rows.Scan(&e.Kind, &e.Name); err != nil {
+			return nil, fmt.Errorf("scan entity: %w", err)
+		}
+		if e.Name, err = db.cipher.openString(e.Name); err != nil {
+			return nil, fmt.Errorf("decrypt entity: %w", err)
+		}
+		entities = append(entities, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(entities, func(i, j int) bool { return entityLess(entities[i], entities[j]) })
+	return entities, nil
+}
+
+// ListEntities returns the entities of kind, or of every kind if kind is
+// empty, that some chunk mentions, the most mentioned first.
+func (db *DB) ListEntities(ctx context.Context, kind string) ([]EntityCount, error) {
+	query := `
+		SELECT e.kind, e.name, COUNT(*) FROM entities e
+		JOIN chunk_entities ce ON ce.entity_id = e.id`
+	var args []any
+	if kind != "" {
+		query += ` WHERE e.kind = ?`
+		args = append(args, kind)
+	}
+	rows, err := db.conn.QueryContext(ctx, query+` GROUP BY e.id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list entities: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []EntityCount{}
+	for rows.Next() {
+		var c EntityCount
+		if err := rows.Scan(&c.Kind, &c.Name, &c.Chunks); err != nil {
+			return nil, fmt.Errorf("scan entity: %w", err)
+		}
+		if c.Name, err = db.cipher.openString(c.Name); err != nil {
+			return nil, fmt.Errorf("decrypt entity: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Names may be encrypted, so they are ordered here
+	sort.SliceStable(counts, func(i, j int) bool {
+		if counts[i].Chunks != counts[j].Chunks {
+			return counts[i].Chunks > counts[j].Chunks
+		}
+		return entityLess(counts[i].Entity, counts[j].Entity)
+	})
+	return counts, nil
+}
+
+// EntityChunkIDs returns the IDs of the chunks mentioning the entity named
+// name, matched normalized, of kind or of any kind if kind is empty.
+func (db *DB) EntityChunkIDs(ctx context.Context, kind, name string) ([]string, error) {
+	kinds := []string{kind}
+	if kind == "" {
+		kinds = EntityKinds
+	}
+	keys := make([]any, len(kinds))
+	for i, k := range kinds {
+		keys[i] = db.entityKey(k, name)
+	}
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT DISTINCT ce.chunk_id FROM chunk_entities ce
+		JOIN entities e ON e.id = ce.entity_id
+		WHERE e.key IN (?`+strings.Repeat(", ?", len(keys)-1)+`)
+		ORDER BY ce.chunk_id
+	`, keys...)
+	if err != nil {
+		return nil, fmt.Errorf("entity chunks: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan chunk id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// entityLess orders entities by kind, as in EntityKinds, then by name.
+func entityLess(a, b Entity) bool {
+	if a.Kind != b.Kind {
+		return kindRank(a.Kind) < kindRank(b.Kind)
+	}
+	return NormalizeEntity(a.Name) < NormalizeEntity(b.Name)
+}
+
+func kindRank(kind string) int {
+	for i, k := range EntityKinds {
+		if k == kind {
+			return i
+		}
+	}
+	return len(EntityKinds)
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestEntities(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	a, _ := db.CreateChunk(ctx, "Call with Alice about Apollo on 2026-03-01", nil)
+	b, _ := db.CreateChunk(ctx, "Alice and Bob reviewed Apollo", nil)
+
+	if err := db.SetChunkEntities(ctx, "missing", []Entity{{EntityPerson, "Alice"}}); !errors.Is(err, ErrChunkNotFound) {
+		t.Errorf("SetChunkEntities(missing): err = %v, want ErrChunkNotFound", err)
+	}
+	db.SetChunkEntities(ctx, a.ID, []Entity{{EntityPerson, "Alice"}, {EntityProject, "Apollo"}, {EntityDate, "2026-03-01"}})
+	db.SetChunkEntities(ctx, b.ID, []Entity{{EntityPerson, " alice "}, {EntityPerson, "Bob"}, {EntityProject, "apollo"}, {EntityPerson, ""}})
+
+	got, err := db.ChunkEntities(ctx, b.ID)
+	if err != nil {
+		t.Fatalf("ChunkEntities: %v", err)
+	}
+	want := []Entity{{EntityPerson, "Alice"}, {EntityPerson, "Bob"}, {EntityProject, "Apollo"}}
+	if !slices.Equal(got, want) {
+		t.Errorf("ChunkEntities = %v, want %v (first spelling kept)", got, want)
+	}
+
+	people, _ := db.ListEntities(ctx, EntityPerson)
+	if len(people) != 2 || people[0].Name != "Alice" || people[0].Chunks != 2 || people[1].Name != "Bob" {
+		t.Errorf("ListEntities(person) = %+v", people)
+	}
+	if all, _ := db.ListEntities(ctx, ""); len(all) != 4 {
+		t.Errorf("ListEntities() = %+v, want 4", all)
+	}
+
+	if ids, _ := db.EntityChunkIDs(ctx, EntityPerson, "ALICE"); len(ids) != 2 {
+		t.Errorf("EntityChunkIDs(person, ALICE) = %v", ids)
+	}
+	if ids, _ := db.EntityChunkIDs(ctx, "", "2026-03-01"); !slices.Equal(ids, []string{a.ID}) {
+		t.Errorf("EntityChunkIDs(any, date) = %v", ids)
+	}
+	if ids, _ := db.EntityChunkIDs(ctx, EntityProject, "Alice"); len(ids) != 0 {
+		t.Errorf("EntityChunkIDs(project, Alice) = %v", ids)
+	}
+
+	// Replacing drops entities no chunk mentions; deleting a chunk unlinks
+	db.SetChunkEntities(ctx, b.ID, []Entity{{EntityPerson, "Alice"}})
+	db.DeleteChunk(ctx, a.ID)
+	if all, _ := db.ListEntities(ctx, ""); len(all) != 1 || all[0].Name != "Alice" || all[0].Chunks != 1 {
+		t.Errorf("ListEntities after changes = %+v", all)
+	}
+}
+
+func TestEntitiesEncrypted(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	a, _ := db.CreateChunk(ctx, "met Carol", nil)
+	b, _ := db.CreateChunk(ctx, "Carol again", nil)
+	db.SetChunkEntities(ctx, a.ID, []Entity{{EntityPerson, "Carol"}})
+	if err := db.SetEncryptionKey(testKey); err != nil {
+		t.Fatalf("SetEncryptionKey: %v", err)
+	}
+	db.SetChunkEntities(ctx, b.ID, []Entity{{EntityPerson, "carol"}})
+	if _, err := db.EncryptAll(ctx, nil); err != nil {
+		t.Fatalf("EncryptAll: %v", err)
+	}
+
+	var n int
+	db.conn.QueryRow(`SELECT COUNT(*) FROM entities WHERE name LIKE '%arol%'`).Scan(&n)
+	if n != 0 {
+		t.Errorf("%d entity names stored in plaintext", n)
+	}
+	people, _ := db.ListEntities(ctx, EntityPerson)
+	if len(people) != 1 || people[0].Chunks != 2 {
+		t.Errorf("ListEntities = %+v, want Carol merged across encryption", people)
+	}
+	if ids, _ := db.EntityChunkIDs(ctx, EntityPerson, "Carol"); len(ids) != 2 {
+		t.Errorf("EntityChunkIDs = %v", ids)
+	}
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// FacetChunks counts the values of a metadata key among the given chunks,
+// in the shape GetMetadataValues returns and keeping the topN most common
+// (default 50). Array elements count separately, as there.
+func (db *DB) FacetChunks(ctx context.Context, ids []string, key string, topN int) (map[string]any, error) {
+	if topN <= 0 {
+		topN = 50
+	}
+	values := make(map[string]int)
+	for start := 0; start < len(ids); start += loadBatch {
+		batch := ids[start:min(start+loadBatch, len(ids))]
+		args := make([]any, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+		rows, err := db.conn.QueryContext(ctx, `SELECT metadata FROM chunks WHERE metadata IS NOT NULL AND id IN (?`+strings.Repeat(",?", len(batch)-1)+`)`, args...)
+		if err != nil {
+			return nil, fmt.Errorf("facet chunks: %w", err)
+		}
+		for rows.Next() {
+			var metadata []byte
+			if err := rows.Scan(&metadata); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("scan metadata: %w", err)
+			}
+			if metadata, err = db.cipher.openMetadata(metadata); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("open metadata: %w", err)
+			}
+			forEachMetadataValue(metadata, func(k, val string) {
+				if k == key {
+					values[val]++
+				}
+			})
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("facet chunks: %w", err)
+		}
+	}
+	return map[string]any{
+		"key":    key,
+		"values": topValues(values, topN),
+	}, nil
+}
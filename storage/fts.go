@@ -0,0 +1,385 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+)
+
+// ftsTriggers keep chunks_fts in step with the chunks table.
+var ftsTriggers = []string{"chunks_ai", "chunks_ad", "chunks_au"}
+
+// FTSCheck describes the state of the full-text index.
+type FTSCheck struct {
+	Chunks int `json:"chunks"`
+	// Indexed counts the documents in the index; it matches Chunks when
+	// the index is in sync.
+	Indexed int `json:"indexed"`
+	// MissingTriggers lists sync triggers that have been dropped.
+	MissingTriggers []string `json:"missing_triggers,omitempty"`
+	// Problem is FTS5's integrity-check error, if any.
+	Problem string `json:"problem,omitempty"`
+}
+
+// OK reports whether the index needs no repair.
+func (c *FTSCheck) OK() bool {
+	return c.Indexed == c.Chunks && len(c.MissingTriggers) == 0 && c.Problem == ""
+}
+
+// String summarizes the check for the CLI.
+func (c *FTSCheck) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d chunks, %d indexed", c.Chunks, c.Indexed)
+	if len(c.MissingTriggers) > 0 {
+		fmt.Fprintf(&b, "; missing triggers: %s", strings.Join(c.MissingTriggers, ", "))
+	}
+	if c.Problem != "" {
+		fmt.Fprintf(&b, "; integrity check: %s", c.Problem)
+	}
+	return b.String()
+}
+
+// CheckFTS verifies that the full-text index matches the chunks table and
+// that the triggers maintaining it are in place.
+func (db *DB) CheckFTS(ctx context.Context) (*FTSCheck, error) {
+	c := &FTSCheck{}
+	if err := db.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM chunks`).Scan(&c.Chunks); err != nil {
+		return nil, fmt.Errorf("count chunks: %w", err)
+	}
+	if err := db.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM chunks_fts_docsize`).Scan(&c.Indexed); err != nil {
+		return nil, fmt.Errorf("count indexed chunks: %w", err)
+	}
+	for _, name := range ftsTriggers {
+		var n int
+		err := db.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = ?`, name).Scan(&n)
+		if err != nil {
+			return nil, fmt.Errorf("check triggers: %w", err)
+		}
+		if n == 0 {
+			c.MissingTriggers = append(c.MissingTriggers, name)
+		}
+	}
+	// With rank 1, the check also compares the index with the chunks
+	// table's content, and reports a mismatch as corruption
+	if _, err := db.conn.ExecContext(ctx, `INSERT INTO chunks_fts(chunks_fts, rank) VALUES ('integrity-check', 1)`); err != nil {
+		c.Problem = err.Error()
+	}
+	return c, nil
+}
+
+// RebuildFTS recreates the full-text index from the chunks table, and its
+// sync triggers as the schema defines them, repairing drift left by
+// triggers that were dropped or altered and by a corrupted index.
+func (db *DB) RebuildFTS(ctx context.Context) error {
+	defer db.search.invalidate()
+	tx, err := db.beginWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, name := range ftsTriggers {
+		if _, err := tx.ExecContext(ctx, "DROP TRIGGER IF EXISTS "+name); err != nil {
+			return fmt.Errorf("drop trigger %s: %w", name, err)
+		}
+	}
+	// The base schema only creates what is missing: here, the triggers
+	if _, err := tx.ExecContext(ctx, schema); err != nil {
+		return fmt.Errorf("recreate triggers: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO chunks_fts(chunks_fts) VALUES ('rebuild')`); err != nil {
+		return fmt.Errorf("rebuild index: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO chunks_fts(chunks_fts) VALUES ('optimize')`); err != nil {
+		return fmt.Errorf("optimize index: %w", err)
+	}
+	if db.trigram {
+		for _, name := range trigramTriggers {
+			if _, err := tx.ExecContext(ctx, "DROP TRIGGER IF EXISTS "+name); err != nil {
+				return fmt.Errorf("drop trigger %s: %w", name, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, trigramSchema); err != nil {
+			return fmt.Errorf("recreate trigram triggers: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO chunks_trigram(chunks_trigram) VALUES ('rebuild')`); err != nil {
+			return fmt.Errorf("rebuild trigram index: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ftsSyntaxError reports whether err is FTS5 rejecting a query it cannot
+// parse, such as one with an unbalanced quote, a stray operator or a
+// "word:" read as a column filter.
+func ftsSyntaxError(err error) bool {
+	msg := err.Error()
+	for _, s := range []string{"fts5: syntax error", "unterminated string", "no such column", "unknown special query"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchMode selects how full-text search matches query words.
+type MatchMode string
+
+const (
+	// MatchExact takes the query as FTS5 syntax, matching whole words.
+	MatchExact MatchMode = "exact"
+	// MatchPrefix matches words starting with each query word.
+	MatchPrefix MatchMode = "prefix"
+	// MatchFuzzy ranks chunks by the letter trigrams they share with the
+	// query words, so partial words and minor typos still match. It needs
+	// [search] trigram.
+	MatchFuzzy MatchMode = "fuzzy"
+)
+
+// ErrFuzzyDisabled is returned for fuzzy searches without the trigram index.
+var ErrFuzzyDisabled = errors.New("fuzzy matching needs [search] trigram enabled")
+
+// ftsWord is a word of a query as FTS5 would index it.
+type ftsWord struct {
+	text   string
+	prefix bool // written with a trailing *
+}
+
+// ftsWords splits query into the words FTS5 would index from it, leaving
+// out operators.
+func ftsWords(query string) []ftsWord {
+	var words []ftsWord
+	for _, f := range strings.Fields(query) {
+		if ftsOperators[f] {
+			continue
+		}
+		parts := strings.FieldsFunc(f, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+		for i, p := range parts {
+			words = append(words, ftsWord{p, i == len(parts)-1 && strings.HasSuffix(f, "*")})
+		}
+	}
+	return words
+}
+
+// quoteFTSQuery rewrites query as its words, each quoted so nothing is read
+// as syntax, and all required. A trailing * stays a prefix search.
+func quoteFTSQuery(query string) string {
+	var quoted []string
+	for _, w := range ftsWords(query) {
+		q := `"` + w.text + `"`
+		if w.prefix {
+			q += "*"
+		}
+		quoted = append(quoted, q)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// prefixFTSQuery rewrites query as a prefix search for each of its words.
+func prefixFTSQuery(query string) string {
+	var quoted []string
+	for _, w := range ftsWords(query) {
+		quoted = append(quoted, `"`+w.text+`"*`)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// trigramQuery rewrites query as any of the trigrams of its words, for
+// chunks_trigram, and returns the trigrams; the query is empty when no
+// word has three letters.
+func trigramQuery(query string) (string, []string) {
+	seen := make(map[string]bool)
+	var trigrams, quoted []string
+	for _, w := range ftsWords(query) {
+		r := []rune(strings.ToLower(w.text))
+		for i := 0; i+3 <= len(r); i++ {
+			if t := string(r[i : i+3]); !seen[t] {
+				seen[t] = true
+				trigrams = append(trigrams, t)
+				quoted = append(quoted, `"`+t+`"`)
+			}
+		}
+	}
+	return strings.Join(quoted, " OR "), trigrams
+}
+
+// Fuzzy matches share at least fuzzyMinShare of the query's trigrams;
+// fuzzyCandidates times the limit are ranked to find them.
+const (
+	fuzzyMinShare   = 0.5
+	fuzzyCandidates = 5
+)
+
+// fuzzySearch finds the chunks sharing the most trigrams with the query.
+func (db *DB) fuzzySearch(ctx context.Context, query string, trigrams []string, limit int) ([]SearchResult, error) {
+	return db.ftsSearch(ctx, "chunks_trigram", query, limit, func(content, metadata string) bool {
+		text := strings.ToLower(content + "\n" + metadata)
+		shared := 0
+		for _, t := range trigrams {
+			if strings.Contains(text, t) {
+				shared++
+			}
+		}
+		return float64(shared) >= fuzzyMinShare*float64(len(trigrams))
+	})
+}
+
+// trigramSchema is the optional trigram index behind fuzzy search, in step
+// with chunks like chunks_fts.
+const trigramSchema = `
+CREATE VIRTUAL TABLE IF NOT EXISTS chunks_trigram USING fts5(
+    id,
+    content,
+    metadata,
+    content='chunks',
+    content_rowid='rowid',
+    tokenize='trigram'
+);
+
+CREATE TRIGGER IF NOT EXISTS chunks_trigram_ai AFTER INSERT ON chunks BEGIN
+    INSERT INTO chunks_trigram(rowid, id, content, metadata)
+    VALUES (NEW.rowid, NEW.id, NEW.content, NEW.metadata);
+END;
+
+CREATE TRIGGER IF NOT EXISTS chunks_trigram_ad AFTER DELETE ON chunks BEGIN
+    INSERT INTO chunks_trigram(chunks_trigram, rowid, id, content, metadata)
+    VALUES('delete', OLD.rowid, OLD.id, OLD.content, OLD.metadata);
+END;
+
+CREATE TRIGGER IF NOT EXISTS chunks_trigram_au AFTER UPDATE ON chunks BEGIN
+    INSERT INTO chunks_trigram(chunks_trigram, rowid, id, content, metadata)
+    VALUES('delete', OLD.rowid, OLD.id, OLD.content, OLD.metadata);
+    INSERT INTO chunks_trigram(rowid, id, content, metadata)
+    VALUES (NEW.rowid, NEW.id, NEW.content, NEW.metadata);
+END;
+`
+
+// trigramTriggers keep chunks_trigram in step with the chunks table.
+var trigramTriggers = []string{"chunks_trigram_ai", "chunks_trigram_ad", "chunks_trigram_au"}
+
+func (db *DB) hasTrigramIndex() (bool, error) {
+	var n int
+	err := db.conn.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'chunks_trigram'`).Scan(&n)
+	return n > 0, err
+}
+
+// setTrigramIndex builds the trigram index, or drops it so that writes no
+// longer maintain it.
+func (db *DB) setTrigramIndex(enabled bool) error {
+	exists, err := db.hasTrigramIndex()
+	if err != nil {
+		return fmt.Errorf("check trigram index: %w", err)
+	}
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if enabled {
+		if _, err := tx.Exec(trigramSchema); err != nil {
+			return fmt.Errorf("create trigram index: %w", err)
+		}
+		if !exists {
+			if _, err := tx.Exec(`INSERT INTO chunks_trigram(chunks_trigram) VALUES ('rebuild')`); err != nil {
+				return fmt.Errorf("build trigram index: %w", err)
+			}
+		}
+		return tx.Commit()
+	}
+	if !exists {
+		return nil
+	}
+	for _, name := range trigramTriggers {
+		if _, err := tx.Exec("DROP TRIGGER IF EXISTS " + name); err != nil {
+			return fmt.Errorf("drop trigger %s: %w", name, err)
+		}
+	}
+	if _, err := tx.Exec(`DROP TABLE chunks_trigram`); err != nil {
+		return fmt.Errorf("drop trigram index: %w", err)
+	}
+	return tx.Commit()
+}
+
+// Tokenizers chunks_fts can be built with.
+const (
+	// TokenizerUnicode61 splits words on Unicode spaces and punctuation.
+	TokenizerUnicode61 = "unicode61"
+	// TokenizerPorter also reduces English words to their stems, so
+	// "running" matches "runs".
+	TokenizerPorter = "porter"
+	// TokenizerTrigram indexes every three characters, for scripts without
+	// spaces between words, such as Chinese and Japanese.
+	TokenizerTrigram = "trigram"
+)
+
+// settingTokenizer records the tokenize option chunks_fts was built with,
+// unicode61 (as the base schema builds it) if unset.
+const settingTokenizer = "fts_tokenizer"
+
+// tokenize returns chunks_fts's FTS5 tokenize option for c.
+func (c SearchConfig) tokenize() string {
+	switch {
+	case c.Tokenizer == TokenizerTrigram && c.KeepDiacritics:
+		return "trigram"
+	case c.Tokenizer == TokenizerTrigram:
+		return "trigram remove_diacritics 1"
+	}
+	spec := "unicode61"
+	if c.Tokenizer == TokenizerPorter {
+		spec = "porter unicode61"
+	}
+	if c.KeepDiacritics {
+		spec += " remove_diacritics 0"
+	}
+	return spec
+}
+
+// setTokenizer rebuilds chunks_fts with tokenize unless it was built with it.
+func (db *DB) setTokenizer(tokenize string) error {
+	current, err := db.GetSetting(context.Background(), settingTokenizer)
+	if errors.Is(err, ErrNotFound) {
+		current, err = "unicode61", nil
+	}
+	if err != nil {
+		return fmt.Errorf("read tokenizer: %w", err)
+	}
+	if current == tokenize {
+		return nil
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Trigrams match any substring, so need no prefix indexes
+	prefix := ", prefix='2 3'"
+	if strings.HasPrefix(tokenize, TokenizerTrigram) {
+		prefix = ""
+	}
+	stmts := []string{
+		`DROP TABLE IF EXISTS chunks_fts`,
+		`CREATE VIRTUAL TABLE chunks_fts USING fts5(
+			id, content, metadata,
+			content='chunks', content_rowid='rowid', tokenize='` + tokenize + `'` + prefix + `
+		)`,
+		`INSERT INTO chunks_fts(chunks_fts) VALUES ('rebuild')`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("rebuild index for tokenizer %q: %w", tokenize, err)
+		}
+	}
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO settings (key, value) VALUES (?, ?)`, settingTokenizer, tokenize); err != nil {
+		return fmt.Errorf("record tokenizer: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Rebuilt the full-text index with tokenizer %q", tokenize)
+	return nil
+}
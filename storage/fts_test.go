@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRebuildFTS(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	a, _ := db.CreateChunk(ctx, "apples and pears", nil)
+	db.CreateChunk(ctx, "plums", nil)
+
+	check, err := db.CheckFTS(ctx)
+	if err != nil {
+		t.Fatalf("CheckFTS: %v", err)
+	}
+	if !check.OK() || check.Chunks != 2 {
+		t.Fatalf("check = %s", check)
+	}
+
+	// A dropped trigger lets the index drift from the chunks
+	db.conn.Exec("DROP TRIGGER chunks_au")
+	content := "cherries"
+	db.UpdateChunk(ctx, a.ID, &content, nil)
+	if results, _ := db.SearchChunks(ctx, "cherries", 10); len(results) != 0 {
+		t.Fatalf("drifted index found %d results", len(results))
+	}
+	check, _ = db.CheckFTS(ctx)
+	if check.OK() || len(check.MissingTriggers) != 1 || check.Problem == "" {
+		t.Errorf("drifted check = %s", check)
+	}
+
+	if err := db.RebuildFTS(ctx); err != nil {
+		t.Fatalf("RebuildFTS: %v", err)
+	}
+	if check, _ = db.CheckFTS(ctx); !check.OK() {
+		t.Errorf("rebuilt check = %s", check)
+	}
+	if results, _ := db.SearchChunks(ctx, "cherries", 10); len(results) != 1 {
+		t.Errorf("rebuilt index found %d results, want 1", len(results))
+	}
+
+	// The recreated trigger keeps the index in sync again
+	content = "damsons"
+	db.UpdateChunk(ctx, a.ID, &content, nil)
+	if results, _ := db.SearchChunks(ctx, "damsons", 10); len(results) != 1 {
+		t.Errorf("found %d results after update, want 1", len(results))
+	}
+
+	// An emptied index is refilled
+	db.conn.Exec("INSERT INTO chunks_fts(chunks_fts) VALUES ('delete-all')")
+	if check, _ = db.CheckFTS(ctx); check.Indexed != 0 || check.OK() {
+		t.Errorf("emptied check = %s", check)
+	}
+	db.RebuildFTS(ctx)
+	if check, _ = db.CheckFTS(ctx); !check.OK() {
+		t.Errorf("refilled check = %s", check)
+	}
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// linksBackfilledKey marks that chunks stored before links were tracked
+// have been parsed.
+const linksBackfilledKey = "links_backfilled"
+
+// linkRef matches a [[chunk-id]] reference in chunk content.
+var linkRef = regexp.MustCompile(`\[\[([0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})\]\]`)
+
+// ParseLinks returns the IDs of the chunks referenced as [[chunk-id]] in
+// content, in order of first appearance.
+func ParseLinks(content string) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, m := range linkRef.FindAllStringSubmatch(content, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			ids = append(ids, m[1])
+		}
+	}
+	return ids
+}
+
+// setLinks replaces the outgoing links of chunk id with those in content.
+// Targets need not exist yet: a link counts once its target is stored.
+func setLinks(ctx context.Context, exec sqlExecutor, id, content string) error {
+	if _, err := exec.ExecContext(ctx, "DELETE FROM links WHERE source_id = ?", id); err != nil {
+		return fmt.Errorf("clear links: %w", err)
+	}
+	for _, target := range ParseLinks(content) {
+		if target == id {
+			continue
+		}
+		if _, err := exec.ExecContext(ctx, "INSERT INTO links (source_id, target_id) VALUES (?, ?)", id, target); err != nil {
+			return fmt.Errorf("insert link: %w", err)
+		}
+	}
+	return nil
+}
+
+// LinkGraph returns every chunk ID and, for each chunk with outgoing links,
+// the existing chunks it links to.
+func (db *DB) LinkGraph(ctx context.Context) ([]string, map[string][]string, error) {
+	rows, err := db.conn.QueryContext(ctx, "SELECT id FROM chunks ORDER BY id")
+	if err != nil {
+		return nil, nil, fmt.Errorf("list chunks: %w", err)
+	}
+	var nodes []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("scan chunk: %w", err)
+		}
+		nodes = append(nodes, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	rows, err = db.conn.QueryContext(ctx, `
+		SELECT l.source_id, l.target_id FROM links l
+		JOIN chunks c ON c.id = l.target_id
+	`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list links: %w", err)
+	}
+	defer rows.Close()
+	links := make(map[string][]string)
+	for rows.Next() {
+		var src, dst string
+		if err := rows.Scan(&src, &dst); err != nil {
+			return nil, nil, fmt.Errorf("scan link: %w", err)
+		}
+		links[src] = append(links[src], dst)
+	}
+	return nodes, links, rows.Err()
+}
+
+// Backlinks counts the stored links pointing at each chunk.
+func (db *DB) Backlinks(ctx context.Context) (map[string]int, error) {
+	rows, err := db.conn.QueryContext(ctx, "SELECT target_id, COUNT(*) FROM links GROUP BY target_id")
+	if err != nil {
+		return nil, fmt.Errorf("count backlinks: %w", err)
+	}
+	defer rows.Close()
+	counts := make(map[string]int)
+	for rows.Next() {
+		var id string
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, fmt.Errorf("scan backlinks: %w", err)
+		}
+		counts[id] = n
+	}
+	return counts, rows.Err()
+}
+
+// BackfillLinks parses the links of chunks stored before links were
+// tracked. It runs once, after encryption is configured, since the
+// content must be readable.
+func (db *DB) BackfillLinks(ctx context.Context) error {
+	if _, err := db.GetSetting(ctx, linksBackfilledKey); err == nil {
+		return nil
+	}
+	chunks, err := db.GetAllChunks(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := db.beginWrite(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for _, c := range chunks {
+		if err := setLinks(ctx, tx, c.ID, c.Content); err != nil {
+			return fmt.Errorf("chunk %s: %w", c.ID, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT OR REPLACE INTO settings (key, value) VALUES (?, '1')", linksBackfilledKey); err != nil {
+		return fmt.Errorf("mark links backfilled: %w", err)
+	}
+	return tx.Commit()
+}
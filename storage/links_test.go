@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestParseLinks(t *testing.T) {
+	a := "0b1c2d3e-0000-4000-8000-000000000001"
+	b := "0b1c2d3e-0000-4000-8000-000000000002"
+	content := "See [[" + a + "]] and [[" + b + "]], again [[" + a + "]]; not [[notes]] or [" + b + "]"
+	if got := ParseLinks(content); !reflect.DeepEqual(got, []string{a, b}) {
+		t.Errorf("ParseLinks = %v", got)
+	}
+}
+
+func TestLinkGraph(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+
+	hub, _ := db.CreateChunk(ctx, "hub", nil)
+	a, _ := db.CreateChunk(ctx, "a links [["+hub.ID+"]]", nil)
+	dangling := "0b1c2d3e-0000-4000-8000-000000000009"
+	b, _ := db.CreateChunk(ctx, "b links [["+hub.ID+"]] and [["+dangling+"]]", nil)
+
+	nodes, links, err := db.LinkGraph(ctx)
+	if err != nil {
+		t.Fatalf("LinkGraph: %v", err)
+	}
+	if len(nodes) != 3 {
+		t.Errorf("nodes = %v, want 3", nodes)
+	}
+	if !reflect.DeepEqual(links[b.ID], []string{hub.ID}) {
+		t.Errorf("links of b = %v, want only the existing hub", links[b.ID])
+	}
+
+	// Editing content replaces links; metadata-only updates keep them
+	content := "a no longer links"
+	db.UpdateChunk(ctx, a.ID, &content, nil)
+	db.UpdateChunk(ctx, b.ID, nil, []byte(`{"k":"v"}`))
+	counts, err := db.Backlinks(ctx)
+	if err != nil {
+		t.Fatalf("Backlinks: %v", err)
+	}
+	if counts[hub.ID] != 1 || counts[dangling] != 1 {
+		t.Errorf("backlinks = %v", counts)
+	}
+
+	// Deleting the source drops its links
+	db.DeleteChunk(ctx, b.ID)
+	if counts, _ := db.Backlinks(ctx); len(counts) != 0 {
+		t.Errorf("backlinks after delete = %v", counts)
+	}
+}
+
+func TestBackfillLinks(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+
+	hub, _ := db.CreateChunk(ctx, "hub", nil)
+	src, _ := db.CreateChunk(ctx, "links [["+hub.ID+"]]", nil)
+	// Simulate a chunk stored before links were tracked
+	db.conn.Exec("DELETE FROM links")
+
+	if err := db.BackfillLinks(ctx); err != nil {
+		t.Fatalf("BackfillLinks: %v", err)
+	}
+	if _, links, _ := db.LinkGraph(ctx); !reflect.DeepEqual(links[src.ID], []string{hub.ID}) {
+		t.Errorf("links after backfill = %v", links)
+	}
+
+	// Only the first call parses chunks
+	db.conn.Exec("DELETE FROM links")
+	db.BackfillLinks(ctx)
+	if counts, _ := db.Backlinks(ctx); len(counts) != 0 {
+		t.Errorf("second backfill reparsed chunks: %v", counts)
+	}
+}
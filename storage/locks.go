@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SetChunkLocked locks or unlocks a chunk. MCP clients cannot change or
+// delete a locked chunk.
+func (db *DB) SetChunkLocked(ctx context.Context, id string, locked bool) error {
+	var exists int
+	err := db.conn.QueryRowContext(ctx, `SELECT 1 FROM chunks WHERE id = ?`, id).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return ErrChunkNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("check chunk: %w", err)
+	}
+	if locked {
+		_, err = db.conn.ExecContext(ctx, `INSERT OR IGNORE INTO chunk_locks (chunk_id, locked_at) VALUES (?, ?)`, id, time.Now().UTC())
+	} else {
+		_, err = db.conn.ExecContext(ctx, `DELETE FROM chunk_locks WHERE chunk_id = ?`, id)
+	}
+	if err != nil {
+		return fmt.Errorf("set chunk lock: %w", err)
+	}
+	return nil
+}
+
+// ChunkLocked reports whether a chunk is locked.
+func (db *DB) ChunkLocked(ctx context.Context, id string) (bool, error) {
+	return chunkLocked(ctx, db.conn, id)
+}
+
+func chunkLocked(ctx context.Context, exec sqlExecutor, id string) (bool, error) {
+	var exists int
+	err := exec.QueryRowContext(ctx, `SELECT 1 FROM chunk_locks WHERE chunk_id = ?`, id).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("chunk lock: %w", err)
+	}
+	return true, nil
+}
+
+// LockedChunkIDs returns the IDs of the locked chunks, most recently
+// locked first.
+func (db *DB) LockedChunkIDs(ctx context.Context) ([]string, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT chunk_id FROM chunk_locks ORDER BY locked_at DESC, chunk_id`)
+	if err != nil {
+		return nil, fmt.Errorf("locked chunks: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan chunk id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestChunkLocks(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	ref, _ := db.CreateChunk(ctx, "reference material", nil)
+	other, _ := db.CreateChunk(ctx, "scratch", nil)
+
+	if err := db.SetChunkLocked(ctx, "missing", true); !errors.Is(err, ErrChunkNotFound) {
+		t.Errorf("SetChunkLocked(missing): err = %v, want ErrChunkNotFound", err)
+	}
+	if locked, _ := db.ChunkLocked(ctx, ref.ID); locked {
+		t.Error("new chunk is locked")
+	}
+	if err := db.SetChunkLocked(ctx, ref.ID, true); err != nil {
+		t.Fatalf("SetChunkLocked: %v", err)
+	}
+	db.SetChunkLocked(ctx, ref.ID, true) // locking twice is a no-op
+	db.SetChunkLocked(ctx, other.ID, true)
+	if locked, _ := db.ChunkLocked(ctx, ref.ID); !locked {
+		t.Error("chunk not locked")
+	}
+	if ids, _ := db.LockedChunkIDs(ctx); len(ids) != 2 {
+		t.Errorf("LockedChunkIDs = %v, want 2", ids)
+	}
+
+	db.SetChunkLocked(ctx, other.ID, false)
+	if ids, _ := db.LockedChunkIDs(ctx); !slices.Equal(ids, []string{ref.ID}) {
+		t.Errorf("LockedChunkIDs after unlock = %v", ids)
+	}
+	// Dropped with their chunk
+	db.DeleteChunk(ctx, ref.ID)
+	if ids, _ := db.LockedChunkIDs(ctx); len(ids) != 0 {
+		t.Errorf("LockedChunkIDs after delete = %v", ids)
+	}
+}
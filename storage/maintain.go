@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultTombstoneDays is how long deletes are kept for sync peers; a peer
+// that has not synced for longer misses them.
+const DefaultTombstoneDays = 90
+
+// MaintenanceConfig schedules mykb maintain in a running server.
+type MaintenanceConfig struct {
+	// IntervalHours is how often a running server runs maintenance; 0 (the
+	// default) leaves it to mykb maintain.
+	IntervalHours int `toml:"interval_hours"`
+	// TombstoneDays is how long deletes are kept for sync (default 90).
+	TombstoneDays int `toml:"tombstone_days"`
+}
+
+// Interval returns how often maintenance runs, 0 when it is not scheduled.
+func (c MaintenanceConfig) Interval() time.Duration {
+	return time.Duration(c.IntervalHours) * time.Hour
+}
+
+// TombstoneAge returns how long tombstones are kept.
+func (c MaintenanceConfig) TombstoneAge() time.Duration {
+	days := c.TombstoneDays
+	if days <= 0 {
+		days = DefaultTombstoneDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// MaintenanceReport describes what Maintain did.
+type MaintenanceReport struct {
+	ExpiredTokens int64 `json:"expired_tokens"`
+	StaleClients  int64 `json:"stale_clients"`
+	Tombstones    int64 `json:"tombstones"`
+	BytesBefore   int64 `json:"bytes_before"`
+	BytesAfter    int64 `json:"bytes_after"`
+}
+
+// Maintain purges expired tokens, stale clients and tombstones older than
+// tombstoneAge, then rewrites the file with VACUUM, refreshes the query
+// planner's statistics with ANALYZE and truncates the WAL. VACUUM holds an
+// exclusive lock while it copies the database.
+func (db *DB) Maintain(ctx context.Context, tombstoneAge time.Duration) (*MaintenanceReport, error) {
+	r := &MaintenanceReport{}
+	before, err := db.SpaceReport(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.BytesBefore = before.FileBytes
+
+	if r.ExpiredTokens, err = db.PurgeExpiredTokens(ctx); err != nil {
+		return nil, fmt.Errorf("purge tokens: %w", err)
+	}
+	if r.StaleClients, err = db.DeleteStaleClients(ctx); err != nil {
+		return nil, fmt.Errorf("purge clients: %w", err)
+	}
+	if r.Tombstones, err = db.PurgeTombstones(ctx, time.Now().Add(-tombstoneAge)); err != nil {
+		return nil, err
+	}
+
+	for _, stmt := range []string{"VACUUM", "ANALYZE", "PRAGMA wal_checkpoint(TRUNCATE)"} {
+		if _, err := db.conn.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("%s: %w", stmt, err)
+		}
+	}
+
+	after, err := db.SpaceReport(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.BytesAfter = after.FileBytes
+	return r, nil
+}
+
+// PurgeExpiredTokens deletes tokens past their expiry.
+func (db *DB) PurgeExpiredTokens(ctx context.Context) (int64, error) {
+	res, err := db.conn.ExecContext(ctx, "DELETE FROM tokens WHERE expires_at < ?", time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// PurgeTombstones deletes the tombstones of chunks deleted before before.
+// A sync peer last seen earlier than that will not learn of those deletes.
+func (db *DB) PurgeTombstones(ctx context.Context, before time.Time) (int64, error) {
+	// Timestamps are compared in Go, as in ChangesSince
+	rows, err := db.conn.QueryContext(ctx, `SELECT chunk_id, deleted_at FROM chunk_tombstones`)
+	if err != nil {
+		return 0, fmt.Errorf("list tombstones: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var t Tombstone
+		if err := rows.Scan(&t.ChunkID, &t.DeletedAt); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan tombstone: %w", err)
+		}
+		if t.DeletedAt.Before(before) {
+			ids = append(ids, t.ChunkID)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("list tombstones: %w", err)
+	}
+
+	for _, id := range ids {
+		if _, err := db.conn.ExecContext(ctx, `DELETE FROM chunk_tombstones WHERE chunk_id = ?`, id); err != nil {
+			return 0, fmt.Errorf("purge tombstones: %w", err)
+		}
+	}
+	return int64(len(ids)), nil
+}
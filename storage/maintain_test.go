@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMaintain(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	old, _ := db.CreateChunk(ctx, "deleted long ago", nil)
+	recent, _ := db.CreateChunk(ctx, "deleted today", nil)
+	db.CreateChunk(ctx, "kept", nil)
+	db.DeleteChunk(ctx, old.ID)
+	db.DeleteChunk(ctx, recent.ID)
+	db.conn.Exec("UPDATE chunk_tombstones SET deleted_at = ? WHERE chunk_id = ?",
+		time.Now().UTC().Add(-100*24*time.Hour), old.ID)
+
+	db.StoreToken(ctx, "live", TokenAccess, "client", time.Now().Add(time.Hour).Unix(), nil)
+	db.StoreToken(ctx, "expired", TokenAccess, "client", time.Now().Add(-time.Hour).Unix(), nil)
+
+	r, err := db.Maintain(ctx, 90*24*time.Hour)
+	if err != nil {
+		t.Fatalf("Maintain: %v", err)
+	}
+	if r.ExpiredTokens != 1 || r.Tombstones != 1 || r.StaleClients != 0 {
+		t.Errorf("report = %+v", r)
+	}
+	if r.BytesAfter <= 0 {
+		t.Errorf("BytesAfter = %d", r.BytesAfter)
+	}
+
+	if _, err := db.ValidateToken(ctx, "live", TokenAccess); err != nil {
+		t.Errorf("live token: %v", err)
+	}
+	_, tombstones, err := db.ChangesSince(ctx, time.Time{})
+	if err != nil {
+		t.Fatalf("ChangesSince: %v", err)
+	}
+	if len(tombstones) != 1 || tombstones[0].ChunkID != recent.ID {
+		t.Errorf("tombstones = %+v, want only %s", tombstones, recent.ID)
+	}
+	if n, _ := db.CountChunks(ctx); n != 1 {
+		t.Errorf("chunks = %d, want 1", n)
+	}
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Memory is the data directory for a database held in memory, for tests
+// and throwaway knowledge bases; it is gone once closed.
+const Memory = ":memory:"
+
+// OpenMemory creates an empty database in memory. Unlike SQLite's
+// ":memory:", which gives each pooled connection a database of its own,
+// every connection shares one database through the memdb VFS, so
+// transactions and concurrent requests see the same data as on disk.
+func OpenMemory() (*DB, error) {
+	// A leading "/" shares the database between connections of this
+	// process; the random name keeps databases opened at once apart
+	dsn := "file:/mykb-" + uuid.NewString() + "?vfs=memdb&_txlock=immediate&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)"
+	conn, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+
+	// The database is freed with its last connection, which the pool may
+	// close whenever it is idle
+	pin, err := conn.Conn(context.Background())
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+
+	return &DB{conn: conn, pin: pin, search: newSearchCache(), searchConfig: SearchConfig{}.withDefaults()}, nil
+}
+
+// InMemory reports whether the database was opened with OpenMemory.
+func (db *DB) InMemory() bool {
+	return db.pin != nil
+}
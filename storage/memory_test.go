@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	db, err := Init(Memory)
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	defer db.Close()
+	if !db.InMemory() || db.Path() != "" {
+		t.Errorf("InMemory = %v, Path = %q; want true and empty", db.InMemory(), db.Path())
+	}
+
+	// Every pooled connection sees the same database
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := db.CreateChunk(ctx, "concurrent write", nil); err != nil {
+				t.Errorf("CreateChunk: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n, err := db.CountChunks(ctx); err != nil || n != 10 {
+		t.Errorf("CountChunks = %d, %v; want 10", n, err)
+	}
+	if results, err := db.SearchChunks(ctx, "concurrent", 20); err != nil || len(results) != 10 {
+		t.Errorf("Search = %d results, %v; want 10", len(results), err)
+	}
+
+	// Databases opened at once are kept apart
+	other, err := Init(Memory)
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	defer other.Close()
+	if n, _ := other.CountChunks(ctx); n != 0 {
+		t.Errorf("second database has %d chunks, want 0", n)
+	}
+
+	if _, err := InitReadOnly(Memory); err == nil {
+		t.Error("InitReadOnly(Memory) should fail")
+	}
+}
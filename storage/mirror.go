@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// mirrorConnLifetime bounds how long a pooled connection of a read-only
+	// mirror keeps reading a replica file that has since been replaced.
+	mirrorConnLifetime = time.Minute
+	// mirrorIdleConns restores database/sql's default idle pool after Refresh.
+	mirrorIdleConns = 2
+)
+
+// InitReadOnly opens the data.db in dataDir as a read-only mirror of a
+// database kept up to date elsewhere (rsync, Litestream). Migrations are
+// not run: the replica must already have every migration this build knows.
+func InitReadOnly(dataDir string) (*DB, error) {
+	if dataDir == Memory {
+		return nil, fmt.Errorf("open replica: a read-only mirror needs a data directory")
+	}
+	path := filepath.Join(dataDir, "data.db")
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("open replica: %w", err)
+	}
+
+	db, err := OpenReadOnly(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := db.pendingMigrations()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("check replica schema: %w", err)
+	}
+	if len(pending) > 0 {
+		db.Close()
+		return nil, fmt.Errorf("replica schema is behind: migration %s not applied (upgrade the primary first)", pending[0])
+	}
+
+	return db, nil
+}
+
+// OpenReadOnly opens an existing SQLite database without write access.
+func OpenReadOnly(path string) (*DB, error) {
+	conn, err := sql.Open("sqlite", "file:"+path+"?mode=ro&_pragma=busy_timeout(5000)&_pragma=query_only(1)")
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ping database: %w", err)
+	}
+	conn.SetConnMaxLifetime(mirrorConnLifetime)
+
+	return &DB{conn: conn, path: path, search: newSearchCache(), searchConfig: SearchConfig{}.withDefaults(), readOnly: true}, nil
+}
+
+// ReadOnly reports whether the database was opened as a read-only mirror.
+func (db *DB) ReadOnly() bool {
+	return db.readOnly
+}
+
+// Refresh makes a read-only mirror pick up a replica file that changed
+// underneath it. Idle connections are closed so later queries reopen the
+// path (rsync replaces the file rather than writing it in place), and
+// cached search results are dropped.
+func (db *DB) Refresh() {
+	db.closeVersionConn()
+	db.conn.SetMaxIdleConns(0)
+	db.conn.SetMaxIdleConns(mirrorIdleConns)
+	db.search.invalidate()
+}
+
+// pendingMigrations lists migrations not yet applied, in order.
+func (db *DB) pendingMigrations() ([]string, error) {
+	var pending []string
+	for _, m := range migrations {
+		applied, err := db.isMigrationApplied(m.id)
+		if err != nil {
+			return nil, err
+		}
+		if !applied {
+			pending = append(pending, m.id)
+		}
+	}
+	return pending, nil
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInitReadOnly(t *testing.T) {
+	ctx := context.Background()
+	if _, err := InitReadOnly(t.TempDir()); err == nil {
+		t.Error("expected error for missing replica")
+	}
+
+	dir := t.TempDir()
+	primary, err := Init(dir)
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	defer primary.Close()
+	chunk, _ := primary.CreateChunk(ctx, "replicated", nil)
+
+	mirror, err := InitReadOnly(dir)
+	if err != nil {
+		t.Fatalf("InitReadOnly: %v", err)
+	}
+	defer mirror.Close()
+	if !mirror.ReadOnly() || primary.ReadOnly() {
+		t.Error("ReadOnly() mismatch")
+	}
+	if got, err := mirror.GetChunk(ctx, chunk.ID); err != nil || got.Content != "replicated" {
+		t.Errorf("GetChunk = %v, %v", got, err)
+	}
+	if _, err := mirror.CreateChunk(ctx, "write", nil); err == nil {
+		t.Error("expected write to mirror to fail")
+	}
+}
+
+func TestInitReadOnlySchemaBehind(t *testing.T) {
+	dir := t.TempDir()
+	db, _ := Init(dir)
+	db.conn.Exec("DELETE FROM migrations WHERE id = ?", migrations[len(migrations)-1].id)
+	db.Close()
+
+	if _, err := InitReadOnly(dir); err == nil {
+		t.Error("expected error for replica missing a migration")
+	}
+}
+
+func TestRefreshReplacedReplica(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.db")
+	primary, _ := Init(dir)
+	primary.CreateChunk(ctx, "old", nil)
+
+	mirror, err := InitReadOnly(dir)
+	if err != nil {
+		t.Fatalf("InitReadOnly: %v", err)
+	}
+	defer mirror.Close()
+	mirror.SearchChunks(ctx, "old", 10) // warm the pool and search cache
+
+	// Replace the file the way rsync does: write elsewhere, rename over
+	primary.CreateChunk(ctx, "new", nil)
+	if err := primary.Backup(t.Context(), filepath.Join(dir, "next.db")); err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	primary.CreateChunk(ctx, "not in the copy", nil)
+	primary.Close()
+	os.Remove(path + "-wal")
+	os.Remove(path + "-shm")
+	if err := os.Rename(filepath.Join(dir, "next.db"), path); err != nil {
+		t.Fatal(err)
+	}
+
+	mirror.Refresh()
+	if n, err := mirror.CountChunks(ctx); err != nil || n != 2 {
+		t.Errorf("CountChunks after Refresh = %d, %v; want 2", n, err)
+	}
+}
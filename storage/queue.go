@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// QueuedEmbedding is a chunk waiting for its embedding to be retried.
+type QueuedEmbedding struct {
+	ChunkID     string
+	Attempts    int
+	LastError   string
+	NextAttempt time.Time
+}
+
+// QueueEmbedding queues a chunk for embedding as soon as possible. A chunk
+// already queued keeps its attempt count.
+func (db *DB) QueueEmbedding(ctx context.Context, chunkID, reason string) error {
+	return queueEmbedding(ctx, db.conn, chunkID, reason)
+}
+
+func queueEmbedding(ctx context.Context, q sqlExecutor, chunkID, reason string) error {
+	_, err := q.ExecContext(ctx, `
+		INSERT INTO embedding_queue (chunk_id, last_error, next_attempt_at) VALUES (?, ?, ?)
+		ON CONFLICT(chunk_id) DO UPDATE SET
+			last_error = excluded.last_error,
+			next_attempt_at = excluded.next_attempt_at
+	`, chunkID, reason, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("queue embedding: %w", err)
+	}
+	return nil
+}
+
+// DueEmbeddings returns up to limit queued chunks due for an attempt by
+// now, the longest waiting first.
+func (db *DB) DueEmbeddings(ctx context.Context, now time.Time, limit int) ([]QueuedEmbedding, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT chunk_id, attempts, last_error, next_attempt_at FROM embedding_queue
+		WHERE next_attempt_at <= ?
+		ORDER BY next_attempt_at, chunk_id
+		LIMIT ?
+	`, now.Unix(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("due embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	var queued []QueuedEmbedding
+	for rows.Next() {
+		var q QueuedEmbedding
+		var next int64
+		if err := rows.Scan(&q.ChunkID, &q.Attempts, &q.LastError, &next); err != nil {
+			return nil, fmt.Errorf("scan queued embedding: %w", err)
+		}
+		q.NextAttempt = time.Unix(next, 0)
+		queued = append(queued, q)
+	}
+	return queued, rows.Err()
+}
+
+// PostponeEmbedding records a failed attempt and when to try again.
+func (db *DB) PostponeEmbedding(ctx context.Context, chunkID, reason string, next time.Time) error {
+	_, err := db.conn.ExecContext(ctx, `
+		UPDATE embedding_queue SET attempts = attempts + 1, last_error = ?, next_attempt_at = ?
+		WHERE chunk_id = ?
+	`, reason, next.Unix(), chunkID)
+	if err != nil {
+		return fmt.Errorf("postpone embedding: %w", err)
+	}
+	return nil
+}
+
+// DequeueEmbedding removes a chunk from the queue.
+func (db *DB) DequeueEmbedding(ctx context.Context, chunkID string) error {
+	if _, err := db.conn.ExecContext(ctx, `DELETE FROM embedding_queue WHERE chunk_id = ?`, chunkID); err != nil {
+		return fmt.Errorf("dequeue embedding: %w", err)
+	}
+	return nil
+}
+
+// EmbeddingQueueLen counts the queued chunks.
+func (db *DB) EmbeddingQueueLen(ctx context.Context) (int, error) {
+	var n int
+	if err := db.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM embedding_queue`).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count embedding queue: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEmbeddingQueue(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	a, _ := db.CreateChunk(ctx, "a", nil)
+	b, _ := db.CreateChunk(ctx, "b", nil)
+
+	if err := db.QueueEmbedding(ctx, a.ID, "timeout"); err != nil {
+		t.Fatalf("QueueEmbedding: %v", err)
+	}
+	db.QueueEmbedding(ctx, b.ID, "timeout")
+
+	now := time.Now()
+	if err := db.PostponeEmbedding(ctx, b.ID, "still down", now.Add(time.Minute)); err != nil {
+		t.Fatalf("PostponeEmbedding: %v", err)
+	}
+	due, err := db.DueEmbeddings(ctx, now, 10)
+	if err != nil {
+		t.Fatalf("DueEmbeddings: %v", err)
+	}
+	if len(due) != 1 || due[0].ChunkID != a.ID || due[0].LastError != "timeout" {
+		t.Errorf("due now = %+v, want only %s", due, a.ID)
+	}
+
+	due, _ = db.DueEmbeddings(ctx, now.Add(2*time.Minute), 10)
+	if len(due) != 2 || due[1].ChunkID != b.ID || due[1].Attempts != 1 || due[1].LastError != "still down" {
+		t.Errorf("due later = %+v", due)
+	}
+
+	// Requeueing keeps the attempt count
+	db.QueueEmbedding(ctx, b.ID, "again")
+	due, _ = db.DueEmbeddings(ctx, now.Add(2*time.Minute), 10)
+	for _, q := range due {
+		if q.ChunkID == b.ID && q.Attempts != 1 {
+			t.Errorf("attempts after requeue = %d, want 1", q.Attempts)
+		}
+	}
+
+	db.DequeueEmbedding(ctx, a.ID)
+	db.DeleteChunk(ctx, b.ID)
+	if n, err := db.EmbeddingQueueLen(ctx); err != nil || n != 0 {
+		t.Errorf("EmbeddingQueueLen = %d, %v; want 0 after dequeue and delete", n, err)
+	}
+}
+
+func TestTxQueueEmbedding(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+
+	// A rolled back chunk leaves nothing queued
+	tx, _ := db.BeginTx(ctx)
+	c, _ := tx.CreateChunk(ctx, "rolled back", nil)
+	if err := tx.QueueEmbedding(ctx, c.ID, "timeout"); err != nil {
+		t.Fatalf("QueueEmbedding: %v", err)
+	}
+	tx.Rollback()
+	if n, _ := db.EmbeddingQueueLen(ctx); n != 0 {
+		t.Errorf("EmbeddingQueueLen after rollback = %d, want 0", n)
+	}
+
+	tx, _ = db.BeginTx(ctx)
+	c, _ = tx.CreateChunk(ctx, "committed", nil)
+	tx.QueueEmbedding(ctx, c.ID, "timeout")
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	due, _ := db.DueEmbeddings(ctx, time.Now(), 10)
+	if len(due) != 1 || due[0].ChunkID != c.ID {
+		t.Errorf("due = %+v, want %s", due, c.ID)
+	}
+}
@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// With encryption enabled, FTS5 and json_each only see ciphertext, so search
+// and metadata aggregation fall back to scanning decrypted chunks in Go.
+// That is linear in the number of chunks, which is fine at personal scale.
+
+// ftsOperators are FTS5 query keywords ignored by the scanning search.
+var ftsOperators = map[string]bool{"AND": true, "OR": true, "NOT": true, "NEAR": true}
+
+// scanChunks searches decrypted chunks for all query terms, case-insensitively.
+// Results are ranked by the number of term occurrences.
+func (db *DB) scanChunks(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	var terms []string
+	for _, f := range strings.Fields(query) {
+		if ftsOperators[f] {
+			continue
+		}
+		if t := strings.Trim(f, `"*()^`); t != "" {
+			terms = append(terms, t)
+		}
+	}
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = regexp.QuoteMeta(t)
+	}
+	re := regexp.MustCompile(`(?i)` + strings.Join(quoted, "|"))
+
+	chunks, err := db.GetAllChunks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	type hit struct {
+		chunk *Chunk
+		score int
+	}
+	var hits []hit
+	for i := range chunks {
+		c := &chunks[i]
+		text := strings.ToLower(c.Content + "\n" + string(c.Metadata))
+		matched := true
+		for _, t := range terms {
+			if !strings.Contains(text, strings.ToLower(t)) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			hits = append(hits, hit{c, len(re.FindAllStringIndex(c.Content, -1))})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	results := make([]SearchResult, len(hits))
+	for i, h := range hits {
+		r := SearchResult{ID: h.chunk.ID, Metadata: h.chunk.Metadata}
+		r.Snippet, r.SnippetText, r.Highlights = db.searchConfig.markSnippet(scanSnippet(h.chunk.Content, re, db.searchConfig))
+		r.Content, r.Truncated = Truncate(h.chunk.Content, SearchPreviewLength)
+		results[i] = r
+	}
+	return results, nil
+}
+
+// scanSnippet returns the text around the first match with matches raw
+// marked, in the same format as the FTS5 snippet() function.
+func scanSnippet(content string, re *regexp.Regexp, cfg SearchConfig) string {
+	// Half the snippet either side of the match
+	snippetRadius := cfg.SnippetTokens * snippetBytesPerToken / 2
+	start, end := 0, len(content)
+	if loc := re.FindStringIndex(content); loc != nil {
+		start = max(0, loc[0]-snippetRadius)
+		end = min(len(content), loc[1]+snippetRadius)
+	} else {
+		end = min(len(content), 2*snippetRadius)
+	}
+	for start > 0 && !utf8.RuneStart(content[start]) {
+		start--
+	}
+	for end < len(content) && !utf8.RuneStart(content[end]) {
+		end++
+	}
+
+	snippet := re.ReplaceAllStringFunc(content[start:end], func(m string) string {
+		return rawMarkStart + m + rawMarkEnd
+	})
+	if start > 0 {
+		snippet = cfg.Ellipsis + snippet
+	}
+	if end < len(content) {
+		snippet += cfg.Ellipsis
+	}
+	return snippet
+}
+
+// scanMetadataIndex computes GetMetadataIndex from decrypted chunks.
+func (db *DB) scanMetadataIndex(ctx context.Context, topN int) (map[string]interface{}, error) {
+	chunks, err := db.GetAllChunks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]map[string]int)
+	for _, c := range chunks {
+		forEachMetadataValue(c.Metadata, func(key, val string) {
+			if counts[key] == nil {
+				counts[key] = make(map[string]int)
+			}
+			counts[key][val]++
+		})
+	}
+
+	keys := make(map[string]map[string]int, len(counts))
+	for key, values := range counts {
+		keys[key] = topValues(values, topN)
+	}
+	return map[string]interface{}{
+		"total_chunks": len(chunks),
+		"keys":         keys,
+	}, nil
+}
+
+// scanContentStats counts chunks, content bytes and metadata keys from
+// decrypted chunks.
+func (db *DB) scanContentStats(ctx context.Context, s *ContentStats) error {
+	chunks, err := db.GetAllChunks(ctx)
+	if err != nil {
+		return err
+	}
+	s.Chunks = len(chunks)
+	for _, c := range chunks {
+		s.ContentBytes += int64(len(c.Content))
+		var meta map[string]json.RawMessage
+		if len(c.Metadata) > 0 && json.Unmarshal(c.Metadata, &meta) == nil {
+			for key := range meta {
+				s.MetadataKeys[key]++
+			}
+		}
+	}
+	return nil
+}
+
+// scanMetadataValues computes GetMetadataValues from decrypted chunks.
+func (db *DB) scanMetadataValues(ctx context.Context, key string, topN int) (map[string]interface{}, error) {
+	chunks, err := db.GetAllChunks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]int)
+	for _, c := range chunks {
+		forEachMetadataValue(c.Metadata, func(k, val string) {
+			if k == key {
+				values[val]++
+			}
+		})
+	}
+	return map[string]interface{}{
+		"key":    key,
+		"values": topValues(values, topN),
+	}, nil
+}
+
+func (db *DB) scanFilterChunkIDs(ctx context.Context, want map[string]string) ([]string, error) {
+	chunks, err := db.GetAllChunks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, c := range chunks {
+		matched := make(map[string]bool, len(want))
+		forEachMetadataValue(c.Metadata, func(k, val string) {
+			if v, ok := want[k]; ok && v == val {
+				matched[k] = true
+			}
+		})
+		if len(matched) == len(want) {
+			ids = append(ids, c.ID)
+		}
+	}
+	return ids, nil
+}
+
+// forEachMetadataValue calls fn for each top-level key and value, expanding
+// arrays into their elements like the json_each queries do.
+func forEachMetadataValue(metadata json.RawMessage, fn func(key, val string)) {
+	if len(metadata) == 0 {
+		return
+	}
+	var meta map[string]any
+	if err := json.Unmarshal(metadata, &meta); err != nil {
+		return
+	}
+	for key, v := range meta {
+		if arr, ok := v.([]any); ok {
+			for _, item := range arr {
+				if s, ok := metadataValueString(item); ok {
+					fn(key, s)
+				}
+			}
+			continue
+		}
+		if s, ok := metadataValueString(v); ok {
+			fn(key, s)
+		}
+	}
+}
+
+// metadataValueString renders a JSON value as SQLite's json_each does.
+func metadataValueString(v any) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		if v {
+			return "1", true
+		}
+		return "0", true
+	default:
+		b, _ := json.Marshal(v)
+		return string(b), true
+	}
+}
+
+// topValues keeps the n most frequent values.
+func topValues(values map[string]int, n int) map[string]int {
+	if len(values) <= n {
+		return values
+	}
+	sorted := make([]string, 0, len(values))
+	for v := range values {
+		sorted = append(sorted, v)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if values[sorted[i]] != values[sorted[j]] {
+			return values[sorted[i]] > values[sorted[j]]
+		}
+		return sorted[i] < sorted[j]
+	})
+	top := make(map[string]int, n)
+	for _, v := range sorted[:n] {
+		top[v] = values[v]
+	}
+	return top
+}
@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Full-text search defaults.
+const (
+	DefaultContentWeight  = 1.0
+	DefaultMetadataWeight = 0.25
+	DefaultSnippetTokens  = 32
+	DefaultHighlightStart = "<mark>"
+	DefaultHighlightEnd   = "</mark>"
+	DefaultEllipsis       = "..."
+
+	// maxSnippetTokens is the longest snippet FTS5 produces.
+	maxSnippetTokens = 64
+	// snippetBytesPerToken converts snippet tokens to the bytes of context
+	// the scanning search shows, with encryption enabled.
+	snippetBytesPerToken = 5
+)
+
+// SearchConfig tunes full-text ranking and snippets.
+type SearchConfig struct {
+	// ContentWeight and MetadataWeight scale bm25 matches in each column
+	// (default 1 and 0.25), so a chunk that only lists a term in its
+	// metadata ranks below strong matches in content.
+	ContentWeight  float64 `toml:"content_weight"`
+	MetadataWeight float64 `toml:"metadata_weight"`
+	// SnippetTokens is the length of a result's snippet (default 32, at
+	// most 64).
+	SnippetTokens int `toml:"snippet_tokens"`
+	// HighlightStart and HighlightEnd surround matches in snippets
+	// (default <mark> and </mark>); Ellipsis marks text cut off (default
+	// "...").
+	HighlightStart string `toml:"highlight_start"`
+	HighlightEnd   string `toml:"highlight_end"`
+	Ellipsis       string `toml:"ellipsis"`
+
+	// Tokenizer splits text into the words chunks_fts indexes: "unicode61"
+	// (default), "porter" for English stemming, or "trigram" for Chinese,
+	// Japanese and other text without spaces, matching any run of three or
+	// more characters. Accents are ignored, so "cafe" matches "café",
+	// unless KeepDiacritics is set. The index is rebuilt at startup when
+	// they change.
+	Tokenizer      string `toml:"tokenizer"`
+	KeepDiacritics bool   `toml:"keep_diacritics"`
+
+	// Trigram keeps a trigram index of chunks for fuzzy matching
+	// (match_mode "fuzzy"), about three times the size of the text. It is
+	// built when enabled and dropped when disabled; encrypted databases
+	// have none.
+	Trigram bool `toml:"trigram"`
+}
+
+// Validate checks the search settings.
+func (c SearchConfig) Validate() error {
+	if c.ContentWeight < 0 || c.MetadataWeight < 0 {
+		return fmt.Errorf("weights must not be negative")
+	}
+	if c.SnippetTokens < 0 || c.SnippetTokens > maxSnippetTokens {
+		return fmt.Errorf("snippet_tokens must be between 0 and %d", maxSnippetTokens)
+	}
+	switch c.Tokenizer {
+	case "", TokenizerUnicode61, TokenizerPorter, TokenizerTrigram:
+	default:
+		return fmt.Errorf("unknown tokenizer %q: expected unicode61, porter or trigram", c.Tokenizer)
+	}
+	return nil
+}
+
+// withDefaults returns c with unset values replaced by their defaults.
+func (c SearchConfig) withDefaults() SearchConfig {
+	if c.ContentWeight == 0 {
+		c.ContentWeight = DefaultContentWeight
+	}
+	if c.MetadataWeight == 0 {
+		c.MetadataWeight = DefaultMetadataWeight
+	}
+	if c.SnippetTokens == 0 {
+		c.SnippetTokens = DefaultSnippetTokens
+	}
+	if c.HighlightStart == "" {
+		c.HighlightStart = DefaultHighlightStart
+	}
+	if c.HighlightEnd == "" {
+		c.HighlightEnd = DefaultHighlightEnd
+	}
+	if c.Ellipsis == "" {
+		c.Ellipsis = DefaultEllipsis
+	}
+	return c
+}
+
+// Highlight returns the markers surrounding matches in snippets.
+func (c SearchConfig) Highlight() (start, end string) {
+	c = c.withDefaults()
+	return c.HighlightStart, c.HighlightEnd
+}
+
+// Span is the byte range [Start, End) of a match in a result's SnippetText.
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Snippets are built with these control characters around matches, which
+// notes do not contain, and then marked as configured.
+const (
+	rawMarkStart = "\x02"
+	rawMarkEnd   = "\x03"
+)
+
+// markSnippet turns a snippet with raw marks into the configured markers,
+// and into plain text with the byte ranges of its matches.
+func (c SearchConfig) markSnippet(raw string) (snippet, text string, spans []Span) {
+	var marked, plain strings.Builder
+	for {
+		i := strings.Index(raw, rawMarkStart)
+		if i < 0 {
+			break
+		}
+		j := strings.Index(raw[i:], rawMarkEnd)
+		if j < 0 {
+			break
+		}
+		match := raw[i+len(rawMarkStart) : i+j]
+		marked.WriteString(raw[:i])
+		marked.WriteString(c.HighlightStart + match + c.HighlightEnd)
+		plain.WriteString(raw[:i])
+		if match != "" {
+			spans = append(spans, Span{Start: plain.Len(), End: plain.Len() + len(match)})
+		}
+		plain.WriteString(match)
+		raw = raw[i+j+len(rawMarkEnd):]
+	}
+	marked.WriteString(raw)
+	plain.WriteString(raw)
+	return marked.String(), plain.String(), spans
+}
+
+// ConfigureSearch applies full-text search settings to later searches,
+// rebuilding the full-text index for a changed tokenizer and building or
+// dropping the trigram index as configured. Read-only mirrors use the
+// indexes the primary keeps.
+func (db *DB) ConfigureSearch(cfg SearchConfig) error {
+	defer db.search.invalidate()
+	db.searchConfig = cfg.withDefaults()
+	switch {
+	case db.readOnly:
+		exists, err := db.hasTrigramIndex()
+		if err != nil {
+			return fmt.Errorf("check trigram index: %w", err)
+		}
+		db.trigram = cfg.Trigram && exists
+		return nil
+	case db.cipher != nil:
+		// It would hold the ciphertext
+		db.trigram = false
+		return db.setTrigramIndex(false)
+	}
+	if err := db.setTokenizer(cfg.tokenize()); err != nil {
+		return err
+	}
+	if err := db.setTrigramIndex(cfg.Trigram); err != nil {
+		return err
+	}
+	db.trigram = cfg.Trigram
+	return nil
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// searchCacheSize bounds the number of cached search result sets.
+const searchCacheSize = 256
+
+// searchCacheKey identifies a search request.
+type searchCacheKey struct {
+	query string
+	limit int
+	mode  MatchMode
+}
+
+type searchCacheEntry struct {
+	gen     uint64
+	results []SearchResult
+}
+
+// searchCache memoizes SearchChunks results. Agents tend to repeat identical
+// searches within one task, and each one otherwise goes through FTS5 anew.
+//
+// Every chunk mutation bumps the generation counter, which invalidates all
+// entries at once. Writes by other processes, such as mykb add, watch or
+// sync, are noticed through PRAGMA data_version (see externalWrites). Results computed concurrently with a mutation are tagged
+// with the generation observed before the query ran, so they are never served
+// after the mutation lands.
+type searchCache struct {
+	gen     atomic.Uint64
+	mu      sync.Mutex
+	entries map[searchCacheKey]searchCacheEntry
+}
+
+func newSearchCache() *searchCache {
+	return &searchCache{entries: make(map[searchCacheKey]searchCacheEntry)}
+}
+
+// generation returns the current generation, to be passed to put.
+func (c *searchCache) generation() uint64 {
+	return c.gen.Load()
+}
+
+// invalidate drops all cached results.
+func (c *searchCache) invalidate() {
+	c.gen.Add(1)
+}
+
+func (c *searchCache) get(key searchCacheKey) ([]SearchResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if e.gen != c.gen.Load() {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return append([]SearchResult(nil), e.results...), true
+}
+
+func (c *searchCache) put(key searchCacheKey, gen uint64, results []SearchResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen.Load() {
+		return
+	}
+	if len(c.entries) >= searchCacheSize {
+		// Cheap bound: start over rather than tracking recency
+		c.entries = make(map[searchCacheKey]searchCacheEntry)
+	}
+	c.entries[key] = searchCacheEntry{gen: gen, results: append([]SearchResult(nil), results...)}
+}
+
+// externalWrites invalidates the search cache if the database changed since
+// it was last called. data_version changes whenever another connection
+// commits, which includes other processes; it must be read on the same
+// connection each time, so one is pinned for it. If it cannot be read the
+// cache is invalidated, as a change may have been missed.
+func (db *DB) externalWrites(ctx context.Context) {
+	db.versionMu.Lock()
+	defer db.versionMu.Unlock()
+
+	if db.versionConn == nil {
+		conn, err := db.conn.Conn(ctx)
+		if err != nil {
+			db.search.invalidate()
+			return
+		}
+		db.versionConn, db.version = conn, -1
+	}
+	var version int64
+	if err := db.versionConn.QueryRowContext(ctx, "PRAGMA data_version").Scan(&version); err != nil {
+		db.versionConn.Close()
+		db.versionConn = nil
+		db.search.invalidate()
+		return
+	}
+	if version != db.version {
+		if db.version != -1 {
+			db.search.invalidate()
+		}
+		db.version = version
+	}
+}
+
+// closeVersionConn releases the connection pinned by externalWrites.
+func (db *DB) closeVersionConn() {
+	db.versionMu.Lock()
+	defer db.versionMu.Unlock()
+	if db.versionConn != nil {
+		db.versionConn.Close()
+		db.versionConn = nil
+	}
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestSearchCacheHit(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	db.CreateChunk(ctx, "cached needle", nil)
+
+	first, _ := db.SearchChunks(ctx, "needle", 10)
+
+	// Bypass the public API so the cache can't observe the change: a write
+	// on the connection that reads data_version does not change it
+	db.versionConn.ExecContext(ctx, "DELETE FROM chunks")
+
+	second, err := db.SearchChunks(ctx, "needle", 10)
+	if err != nil {
+		t.Fatalf("SearchChunks: %v", err)
+	}
+	if len(second) != len(first) || len(second) != 1 {
+		t.Errorf("len = %d, want cached result of 1", len(second))
+	}
+}
+
+func TestSearchCacheInvalidatedOnWrite(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	db.CreateChunk(ctx, "needle one", nil)
+
+	results, _ := db.SearchChunks(ctx, "needle", 10)
+	if len(results) != 1 {
+		t.Fatalf("len = %d, want 1", len(results))
+	}
+
+	chunk, _ := db.CreateChunk(ctx, "needle two", nil)
+	results, _ = db.SearchChunks(ctx, "needle", 10)
+	if len(results) != 2 {
+		t.Errorf("after create: len = %d, want 2", len(results))
+	}
+
+	newContent := "haystack"
+	db.UpdateChunk(ctx, chunk.ID, &newContent, nil)
+	results, _ = db.SearchChunks(ctx, "needle", 10)
+	if len(results) != 1 {
+		t.Errorf("after update: len = %d, want 1", len(results))
+	}
+
+	db.DeleteChunk(ctx, results[0].ID)
+	results, _ = db.SearchChunks(ctx, "needle", 10)
+	if len(results) != 0 {
+		t.Errorf("after delete: len = %d, want 0", len(results))
+	}
+}
+
+func TestSearchCacheInvalidatedOnTxCommit(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	db.SearchChunks(ctx, "needle", 10)
+
+	tx, _ := db.BeginTx(t.Context())
+	tx.CreateChunk(ctx, "needle in tx", nil)
+	tx.Commit()
+
+	results, _ := db.SearchChunks(ctx, "needle", 10)
+	if len(results) != 1 {
+		t.Errorf("len = %d, want 1", len(results))
+	}
+}
+
+func TestSearchCacheKeyIncludesLimit(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	db.CreateChunk(ctx, "needle a", nil)
+	db.CreateChunk(ctx, "needle b", nil)
+
+	one, _ := db.SearchChunks(ctx, "needle", 1)
+	two, _ := db.SearchChunks(ctx, "needle", 2)
+	if len(one) != 1 || len(two) != 2 {
+		t.Errorf("len = %d/%d, want 1/2", len(one), len(two))
+	}
+}
+
+func TestSearchCacheInvalidatedByOtherProcess(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	db.CreateChunk(ctx, "needle one", nil)
+	if results, _ := db.SearchChunks(ctx, "needle", 10); len(results) != 1 {
+		t.Fatalf("len = %d, want 1", len(results))
+	}
+
+	// A second handle stands in for mykb add or sync in another process
+	other, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer other.Close()
+	if _, err := other.CreateChunk(ctx, "needle two", nil); err != nil {
+		t.Fatalf("CreateChunk: %v", err)
+	}
+
+	results, err := db.SearchChunks(ctx, "needle", 10)
+	if err != nil {
+		t.Fatalf("SearchChunks: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("after write by another handle: len = %d, want 2", len(results))
+	}
+}
+
+func TestSearchCacheStalePut(t *testing.T) {
+	c := newSearchCache()
+	key := searchCacheKey{query: "q", limit: 1}
+
+	gen := c.generation()
+	c.invalidate() // mutation lands while query is in flight
+	c.put(key, gen, []SearchResult{{ID: "stale"}})
+
+	if _, ok := c.get(key); ok {
+		t.Error("Stale results should not be cached")
+	}
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Session is a run of chunks stored by one client with no gap between
+// consecutive chunks longer than the session window.
+type Session struct {
+	// Client stored the chunks; empty for chunks with no recorded client.
+	Client   string    `json:"client"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	ChunkIDs []string  `json:"chunk_ids"`
+}
+
+// SetChunkClient records which client stored a chunk.
+func (db *DB) SetChunkClient(ctx context.Context, chunkID, client string) error {
+	_, err := db.conn.ExecContext(ctx, `
+		INSERT INTO chunk_clients (chunk_id, client) VALUES (?, ?)
+		ON CONFLICT(chunk_id) DO UPDATE SET client = excluded.client
+	`, chunkID, client)
+	if err != nil {
+		return fmt.Errorf("set chunk client: %w", err)
+	}
+	return nil
+}
+
+// CaptureSession returns the session containing chunk id: the chunks from
+// the same client created around it, oldest first, where each follows the
+// previous one within window.
+func (db *DB) CaptureSession(ctx context.Context, id string, window time.Duration) (*Session, error) {
+	var client string
+	err := db.conn.QueryRowContext(ctx, `
+		SELECT COALESCE(cc.client, '') FROM chunks c
+		LEFT JOIN chunk_clients cc ON cc.chunk_id = c.id
+		WHERE c.id = ?
+	`, id).Scan(&client)
+	if err == sql.ErrNoRows {
+		return nil, ErrChunkNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get chunk client: %w", err)
+	}
+
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT c.id, c.created_at FROM chunks c
+		LEFT JOIN chunk_clients cc ON cc.chunk_id = c.id
+		WHERE COALESCE(cc.client, '') = ?
+		ORDER BY c.created_at, c.id
+	`, client)
+	if err != nil {
+		return nil, fmt.Errorf("list client chunks: %w", err)
+	}
+	defer rows.Close()
+
+	// Sessions split wherever the gap exceeds window; keep the one holding id
+	s := &Session{Client: client}
+	found := false
+	var last time.Time
+	for rows.Next() {
+		var cid string
+		var created time.Time
+		if err := rows.Scan(&cid, &created); err != nil {
+			return nil, fmt.Errorf("scan chunk: %w", err)
+		}
+		if len(s.ChunkIDs) > 0 && created.Sub(last) > window {
+			if found {
+				break
+			}
+			s.ChunkIDs = s.ChunkIDs[:0]
+		}
+		if len(s.ChunkIDs) == 0 {
+			s.Start = created
+		}
+		s.ChunkIDs = append(s.ChunkIDs, cid)
+		s.End = created
+		last = created
+		found = found || cid == id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCaptureSession(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	base := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	// Research session by one client, interleaved with another client, then
+	// a later session after a long pause
+	for _, c := range []struct {
+		id, client string
+		at         time.Duration
+	}{
+		{"a1", "laptop", 0},
+		{"b1", "phone", 5 * time.Minute},
+		{"a2", "laptop", 20 * time.Minute},
+		{"a3", "laptop", 45 * time.Minute},
+		{"a4", "laptop", 3 * time.Hour},
+		{"x1", "", 10 * time.Minute},
+	} {
+		created := base.Add(c.at)
+		if err := db.PutChunk(ctx, &Chunk{ID: c.id, Content: c.id, CreatedAt: created, UpdatedAt: created}); err != nil {
+			t.Fatalf("PutChunk: %v", err)
+		}
+		if c.client != "" {
+			db.SetChunkClient(ctx, c.id, c.client)
+		}
+	}
+
+	s, err := db.CaptureSession(ctx, "a2", 30*time.Minute)
+	if err != nil {
+		t.Fatalf("CaptureSession: %v", err)
+	}
+	if s.Client != "laptop" || !reflect.DeepEqual(s.ChunkIDs, []string{"a1", "a2", "a3"}) {
+		t.Errorf("session = %+v", s)
+	}
+	if !s.Start.Equal(base) || !s.End.Equal(base.Add(45*time.Minute)) {
+		t.Errorf("session spans %s to %s", s.Start, s.End)
+	}
+
+	if s, _ := db.CaptureSession(ctx, "a4", 30*time.Minute); !reflect.DeepEqual(s.ChunkIDs, []string{"a4"}) {
+		t.Errorf("later session = %v", s.ChunkIDs)
+	}
+	if s, _ := db.CaptureSession(ctx, "a4", 3*time.Hour); len(s.ChunkIDs) != 4 {
+		t.Errorf("wide window session = %v", s.ChunkIDs)
+	}
+	// Chunks without a recorded client group among themselves
+	if s, _ := db.CaptureSession(ctx, "x1", time.Hour); s.Client != "" || !reflect.DeepEqual(s.ChunkIDs, []string{"x1"}) {
+		t.Errorf("unattributed session = %+v", s)
+	}
+	if _, err := db.CaptureSession(ctx, "missing", time.Hour); err != ErrChunkNotFound {
+		t.Errorf("CaptureSession(missing) = %v, want ErrChunkNotFound", err)
+	}
+}
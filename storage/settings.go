@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 )
@@ -8,9 +9,9 @@ import (
 var ErrNotFound = errors.New("not found")
 
 // GetSetting retrieves a setting value by key.
-func (db *DB) GetSetting(key string) (string, error) {
+func (db *DB) GetSetting(ctx context.Context, key string) (string, error) {
 	var value string
-	err := db.conn.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	err := db.conn.QueryRowContext(ctx, "SELECT value FROM settings WHERE key = ?", key).Scan(&value)
 	if err == sql.ErrNoRows {
 		return "", ErrNotFound
 	}
@@ -18,8 +19,8 @@ func (db *DB) GetSetting(key string) (string, error) {
 }
 
 // SetSetting stores a setting value.
-func (db *DB) SetSetting(key, value string) error {
-	_, err := db.conn.Exec(
+func (db *DB) SetSetting(ctx context.Context, key, value string) error {
+	_, err := db.conn.ExecContext(ctx,
 		"INSERT OR REPLACE INTO settings (key, value) VALUES (?, ?)",
 		key, value,
 	)
@@ -27,11 +28,11 @@ func (db *DB) SetSetting(key, value string) error {
 }
 
 // GetPasswordHash retrieves the stored password hash.
-func (db *DB) GetPasswordHash() (string, error) {
-	return db.GetSetting("password_hash")
+func (db *DB) GetPasswordHash(ctx context.Context) (string, error) {
+	return db.GetSetting(ctx, "password_hash")
 }
 
 // SetPasswordHash stores the password hash.
-func (db *DB) SetPasswordHash(hash string) error {
-	return db.SetSetting("password_hash", hash)
+func (db *DB) SetPasswordHash(ctx context.Context, hash string) error {
+	return db.SetSetting(ctx, "password_hash", hash)
 }
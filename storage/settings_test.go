@@ -1,15 +1,19 @@
 package storage
 
-import "testing"
+import (
+	"context"
+	"testing"
+)
 
 func TestSetAndGetSetting(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	if err := db.SetSetting("foo", "bar"); err != nil {
+	if err := db.SetSetting(ctx, "foo", "bar"); err != nil {
 		t.Fatalf("SetSetting: %v", err)
 	}
 
-	got, err := db.GetSetting("foo")
+	got, err := db.GetSetting(ctx, "foo")
 	if err != nil {
 		t.Fatalf("GetSetting: %v", err)
 	}
@@ -19,42 +23,45 @@ func TestSetAndGetSetting(t *testing.T) {
 }
 
 func TestGetSettingNotFound(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	_, err := db.GetSetting("nonexistent")
+	_, err := db.GetSetting(ctx, "nonexistent")
 	if err != ErrNotFound {
 		t.Errorf("err = %v, want ErrNotFound", err)
 	}
 }
 
 func TestSetSettingOverwrite(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	db.SetSetting("key", "value1")
-	db.SetSetting("key", "value2")
+	db.SetSetting(ctx, "key", "value1")
+	db.SetSetting(ctx, "key", "value2")
 
-	got, _ := db.GetSetting("key")
+	got, _ := db.GetSetting(ctx, "key")
 	if got != "value2" {
 		t.Errorf("got %q, want %q", got, "value2")
 	}
 }
 
 func TestPasswordHash(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
 	// Not set initially
-	_, err := db.GetPasswordHash()
+	_, err := db.GetPasswordHash(ctx)
 	if err != ErrNotFound {
 		t.Errorf("err = %v, want ErrNotFound", err)
 	}
 
 	// Set it
-	if err := db.SetPasswordHash("$2a$10$hash"); err != nil {
+	if err := db.SetPasswordHash(ctx, "$2a$10$hash"); err != nil {
 		t.Fatalf("SetPasswordHash: %v", err)
 	}
 
 	// Get it back
-	hash, err := db.GetPasswordHash()
+	hash, err := db.GetPasswordHash(ctx)
 	if err != nil {
 		t.Fatalf("GetPasswordHash: %v", err)
 	}
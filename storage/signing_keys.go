@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// SigningKey is a private key used to sign JWT access tokens.
+type SigningKey struct {
+	KID        string
+	PrivateKey []byte // PKCS#8 DER
+	CreatedAt  int64
+}
+
+// CreateSigningKey stores a new signing key.
+func (db *DB) CreateSigningKey(ctx context.Context, kid string, privateKey []byte) error {
+	_, err := db.conn.ExecContext(ctx,
+		"INSERT INTO signing_keys (kid, private_key) VALUES (?, ?)",
+		kid, privateKey,
+	)
+	if err != nil {
+		return fmt.Errorf("create signing key: %w", err)
+	}
+	return nil
+}
+
+// ListSigningKeys returns all signing keys, newest first.
+func (db *DB) ListSigningKeys(ctx context.Context) ([]SigningKey, error) {
+	rows, err := db.conn.QueryContext(ctx,
+		"SELECT kid, private_key, created_at FROM signing_keys ORDER BY created_at DESC, rowid DESC",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list signing keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []SigningKey
+	for rows.Next() {
+		var k SigningKey
+		if err := rows.Scan(&k.KID, &k.PrivateKey, &k.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan signing key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// DeleteSigningKeysBefore removes signing keys created before the given unix time,
+// except the given kid (the current key is never deleted).
+func (db *DB) DeleteSigningKeysBefore(ctx context.Context, before int64, keep string) error {
+	_, err := db.conn.ExecContext(ctx,
+		"DELETE FROM signing_keys WHERE created_at < ? AND kid != ?",
+		before, keep,
+	)
+	if err != nil {
+		return fmt.Errorf("delete signing keys: %w", err)
+	}
+	return nil
+}
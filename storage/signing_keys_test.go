@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCreateAndListSigningKeys(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+
+	if err := db.CreateSigningKey(ctx, "kid-1", []byte("key1")); err != nil {
+		t.Fatalf("CreateSigningKey: %v", err)
+	}
+	if err := db.CreateSigningKey(ctx, "kid-2", []byte("key2")); err != nil {
+		t.Fatalf("CreateSigningKey: %v", err)
+	}
+
+	keys, err := db.ListSigningKeys(ctx)
+	if err != nil {
+		t.Fatalf("ListSigningKeys: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("len(keys) = %d, want 2", len(keys))
+	}
+	if keys[0].KID != "kid-2" {
+		t.Errorf("newest key = %q, want kid-2", keys[0].KID)
+	}
+	if string(keys[1].PrivateKey) != "key1" {
+		t.Errorf("PrivateKey = %q, want key1", keys[1].PrivateKey)
+	}
+}
+
+func TestDeleteSigningKeysBefore(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+
+	db.CreateSigningKey(ctx, "old", []byte("a"))
+	db.CreateSigningKey(ctx, "current", []byte("b"))
+	db.conn.Exec("UPDATE signing_keys SET created_at = 100")
+
+	if err := db.DeleteSigningKeysBefore(ctx, 200, "current"); err != nil {
+		t.Fatalf("DeleteSigningKeysBefore: %v", err)
+	}
+
+	keys, _ := db.ListSigningKeys(ctx)
+	if len(keys) != 1 || keys[0].KID != "current" {
+		t.Errorf("keys = %+v, want only current", keys)
+	}
+}
@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrSourceNotFound is returned when a source with the specified ID does
+// not exist.
+var ErrSourceNotFound = errors.New("source not found")
+
+// Source is a document that chunks come from, such as a book, article or
+// conversation. Metadata describing the whole source is kept here once
+// rather than on each of its chunks.
+type Source struct {
+	ID       string          `json:"id"`
+	Name     string          `json:"name"`
+	Metadata json.RawMessage `json:"metadata,omitempty"`
+	// Chunks is the number of chunks referencing the source.
+	Chunks    int       `json:"chunks"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const selectSources = `
+	SELECT s.id, s.name, s.metadata, s.created_at, s.updated_at, COUNT(cs.chunk_id)
+	FROM sources s LEFT JOIN chunk_sources cs ON cs.source_id = s.id
+`
+
+// CreateSource creates a new source. Names and metadata are encrypted like
+// chunk content.
+func (db *DB) CreateSource(ctx context.Context, name string, metadata json.RawMessage) (*Source, error) {
+	id := uuid.New().String()
+	now := time.Now().UTC()
+	_, err := db.conn.ExecContext(ctx, `
+		INSERT INTO sources (id, name, metadata, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, id, db.cipher.sealString(name), db.cipher.sealMetadata(metadata), now, now)
+	if err != nil {
+		return nil, fmt.Errorf("insert source: %w", err)
+	}
+	return &Source{ID: id, Name: name, Metadata: metadata, CreatedAt: now, UpdatedAt: now}, nil
+}
+
+// GetSource retrieves a source by ID.
+func (db *DB) GetSource(ctx context.Context, id string) (*Source, error) {
+	row := db.conn.QueryRowContext(ctx, selectSources+`WHERE s.id = ? GROUP BY s.id`, id)
+	src, err := db.scanSource(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrSourceNotFound
+	}
+	return src, err
+}
+
+// FindSource returns the oldest source named name. Names may be encrypted,
+// so sources are compared after decryption.
+func (db *DB) FindSource(ctx context.Context, name string) (*Source, error) {
+	sources, err := db.listSources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var found *Source
+	for i := range sources {
+		if sources[i].Name == name && (found == nil || sources[i].CreatedAt.Before(found.CreatedAt)) {
+			found = &sources[i]
+		}
+	}
+	if found == nil {
+		return nil, ErrSourceNotFound
+	}
+	return found, nil
+}
+
+// ListSources returns all sources ordered by name.
+func (db *DB) ListSources(ctx context.Context) ([]Source, error) {
+	sources, err := db.listSources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(sources, func(i, j int) bool { return sources[i].Name < sources[j].Name })
+	return sources, nil
+}
+
+func (db *DB) listSources(ctx context.Context) ([]Source, error) {
+	rows, err := db.conn.QueryContext(ctx, selectSources+`GROUP BY s.id ORDER BY s.created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("list sources: %w", err)
+	}
+	defer rows.Close()
+
+	sources := []Source{}
+	for rows.Next() {
+		src, err := db.scanSource(rows)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, *src)
+	}
+	return sources, rows.Err()
+}
+
+// UpdateSource updates an existing source. A nil name or metadata keeps the
+// current value.
+func (db *DB) UpdateSource(ctx context.Context, id string, name *string, metadata json.RawMessage) (*Source, error) {
+	src, err := db.GetSource(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if name != nil {
+		src.Name = *name
+	}
+	if metadata != nil {
+		src.Metadata = metadata
+	}
+	src.UpdatedAt = time.Now().UTC()
+	_, err = db.conn.ExecContext(ctx, `
+		UPDATE sources SET name = ?, metadata = ?, updated_at = ? WHERE id = ?
+	`, db.cipher.sealString(src.Name), db.cipher.sealMetadata(src.Metadata), src.UpdatedAt, id)
+	if err != nil {
+		return nil, fmt.Errorf("update source: %w", err)
+	}
+	return src, nil
+}
+
+// DeleteSource deletes a source. Its chunks are kept, no longer referencing
+// any source.
+func (db *DB) DeleteSource(ctx context.Context, id string) (bool, error) {
+	result, err := db.conn.ExecContext(ctx, "DELETE FROM sources WHERE id = ?", id)
+	if err != nil {
+		return false, fmt.Errorf("delete source: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// SetChunkSource makes a chunk reference a source; an empty sourceID
+// removes the reference.
+func (db *DB) SetChunkSource(ctx context.Context, chunkID, sourceID string) error {
+	return setChunkSource(ctx, db.conn, chunkID, sourceID)
+}
+
+func setChunkSource(ctx context.Context, exec sqlExecutor, chunkID, sourceID string) error {
+	var err error
+	if sourceID == "" {
+		_, err = exec.ExecContext(ctx, `DELETE FROM chunk_sources WHERE chunk_id = ?`, chunkID)
+	} else {
+		_, err = exec.ExecContext(ctx, `
+			INSERT INTO chunk_sources (chunk_id, source_id) VALUES (?, ?)
+			ON CONFLICT(chunk_id) DO UPDATE SET source_id = excluded.source_id
+		`, chunkID, sourceID)
+	}
+	if err != nil {
+		return fmt.Errorf("set chunk source: %w", err)
+	}
+	return nil
+}
+
+// ChunkSource returns the source a chunk references, or nil if it
+// references none.
+func (db *DB) ChunkSource(ctx context.Context, chunkID string) (*Source, error) {
+	var sourceID string
+	err := db.conn.QueryRowContext(ctx, `SELECT source_id FROM chunk_sources WHERE chunk_id = ?`, chunkID).Scan(&sourceID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get chunk source: %w", err)
+	}
+	return db.GetSource(ctx, sourceID)
+}
+
+// GetChunksBySource returns the chunks referencing a source, oldest first.
+func (db *DB) GetChunksBySource(ctx context.Context, sourceID string) ([]Chunk, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT c.id, c.content, c.metadata, c.created_at, c.updated_at
+		FROM chunks c JOIN chunk_sources cs ON cs.chunk_id = c.id
+		WHERE cs.source_id = ?
+		ORDER BY c.created_at, c.id
+	`, sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("get source chunks: %w", err)
+	}
+	defer rows.Close()
+
+	chunks := []Chunk{}
+	for rows.Next() {
+		var chunk Chunk
+		var metaStr sql.NullString
+		if err := rows.Scan(&chunk.ID, &chunk.Content, &metaStr, &chunk.CreatedAt, &chunk.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan chunk: %w", err)
+		}
+		if metaStr.Valid {
+			chunk.Metadata = json.RawMessage(metaStr.String)
+		}
+		if err := db.cipher.openChunk(&chunk); err != nil {
+			return nil, fmt.Errorf("chunk %s: %w", chunk.ID, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, rows.Err()
+}
+
+func (db *DB) scanSource(row interface{ Scan(...any) error }) (*Source, error) {
+	var src Source
+	var metaStr sql.NullString
+	if err := row.Scan(&src.ID, &src.Name, &metaStr, &src.CreatedAt, &src.UpdatedAt, &src.Chunks); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("scan source: %w", err)
+	}
+	var err error
+	if src.Name, err = db.cipher.openString(src.Name); err != nil {
+		return nil, fmt.Errorf("decrypt source %s: %w", src.ID, err)
+	}
+	if metaStr.Valid {
+		if src.Metadata, err = db.cipher.openMetadata([]byte(metaStr.String)); err != nil {
+			return nil, fmt.Errorf("decrypt source %s: %w", src.ID, err)
+		}
+	}
+	return &src, nil
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSources(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+
+	book, err := db.CreateSource(ctx, "The Pragmatic Programmer", json.RawMessage(`{"type":"book","author":"Hunt"}`))
+	if err != nil {
+		t.Fatalf("CreateSource: %v", err)
+	}
+	article, _ := db.CreateSource(ctx, "An Article", nil)
+
+	c1, _ := db.CreateChunk(ctx, "first quote", nil)
+	c2, _ := db.CreateChunk(ctx, "second quote", nil)
+	c3, _ := db.CreateChunk(ctx, "unrelated", nil)
+	for _, id := range []string{c1.ID, c2.ID} {
+		if err := db.SetChunkSource(ctx, id, book.ID); err != nil {
+			t.Fatalf("SetChunkSource: %v", err)
+		}
+	}
+
+	sources, err := db.ListSources(ctx)
+	if err != nil {
+		t.Fatalf("ListSources: %v", err)
+	}
+	if len(sources) != 2 || sources[0].Name != "An Article" || sources[1].Chunks != 2 {
+		t.Errorf("ListSources = %+v", sources)
+	}
+
+	chunks, err := db.GetChunksBySource(ctx, book.ID)
+	if err != nil {
+		t.Fatalf("GetChunksBySource: %v", err)
+	}
+	if len(chunks) != 2 || chunks[0].ID != c1.ID || chunks[1].ID != c2.ID {
+		t.Errorf("GetChunksBySource = %+v", chunks)
+	}
+	if src, err := db.ChunkSource(ctx, c1.ID); err != nil || src == nil || src.ID != book.ID {
+		t.Errorf("ChunkSource = %+v, %v", src, err)
+	}
+	if src, err := db.ChunkSource(ctx, c3.ID); err != nil || src != nil {
+		t.Errorf("ChunkSource of unlinked chunk = %+v, %v", src, err)
+	}
+	if src, err := db.FindSource(ctx, "An Article"); err != nil || src.ID != article.ID {
+		t.Errorf("FindSource = %+v, %v", src, err)
+	}
+	if _, err := db.FindSource(ctx, "missing"); err != ErrSourceNotFound {
+		t.Errorf("FindSource(missing) err = %v", err)
+	}
+
+	name := "The Pragmatic Programmer, 2nd ed."
+	updated, err := db.UpdateSource(ctx, book.ID, &name, nil)
+	if err != nil {
+		t.Fatalf("UpdateSource: %v", err)
+	}
+	if updated.Name != name || string(updated.Metadata) != `{"type":"book","author":"Hunt"}` {
+		t.Errorf("UpdateSource = %+v", updated)
+	}
+	if _, err := db.UpdateSource(ctx, "missing", &name, nil); err != ErrSourceNotFound {
+		t.Errorf("UpdateSource(missing) err = %v", err)
+	}
+
+	// Moving a chunk and deleting a chunk update the counts
+	db.SetChunkSource(ctx, c2.ID, article.ID)
+	db.DeleteChunk(ctx, c1.ID)
+	if src, _ := db.GetSource(ctx, book.ID); src.Chunks != 0 {
+		t.Errorf("book chunks = %d, want 0", src.Chunks)
+	}
+
+	// Deleting a source keeps its chunks
+	if deleted, err := db.DeleteSource(ctx, article.ID); err != nil || !deleted {
+		t.Fatalf("DeleteSource = %v, %v", deleted, err)
+	}
+	if _, err := db.GetChunk(ctx, c2.ID); err != nil {
+		t.Errorf("chunk of deleted source: %v", err)
+	}
+	if src, _ := db.ChunkSource(ctx, c2.ID); src != nil {
+		t.Errorf("ChunkSource after DeleteSource = %+v", src)
+	}
+	if _, err := db.GetSource(ctx, article.ID); err != ErrSourceNotFound {
+		t.Errorf("GetSource after delete err = %v", err)
+	}
+}
+
+func TestSourcesEncrypted(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	plain, _ := db.CreateSource(ctx, "written before encryption", json.RawMessage(`{"k":"v"}`))
+
+	if err := db.SetEncryptionKey(testKey); err != nil {
+		t.Fatalf("SetEncryptionKey: %v", err)
+	}
+	sealed, _ := db.CreateSource(ctx, "written after", nil)
+	if _, err := db.EncryptAll(ctx, nil); err != nil {
+		t.Fatalf("EncryptAll: %v", err)
+	}
+
+	for _, id := range []string{plain.ID, sealed.ID} {
+		var name string
+		db.conn.QueryRow(`SELECT name FROM sources WHERE id = ?`, id).Scan(&name)
+		if !strings.HasPrefix(name, encPrefix) {
+			t.Errorf("source %s name stored as %q", id, name)
+		}
+	}
+	src, err := db.FindSource(ctx, "written before encryption")
+	if err != nil || string(src.Metadata) != `{"k":"v"}` {
+		t.Errorf("FindSource = %+v, %v", src, err)
+	}
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// statsDay is the layout of StatsSnapshot.Day.
+const statsDay = "2006-01-02"
+
+// StatsSnapshot records the size of the knowledge base on one day.
+type StatsSnapshot struct {
+	Day    string `json:"day"` // YYYY-MM-DD, UTC
+	Chunks int    `json:"chunks"`
+	// Embedded counts chunks with an embedding for Model.
+	Embedded   int       `json:"embedded"`
+	Model      string    `json:"model,omitempty"`
+	DBBytes    int64     `json:"db_bytes"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// Coverage returns the share of chunks with an embedding.
+func (s StatsSnapshot) Coverage() float64 {
+	if s.Chunks == 0 {
+		return 0
+	}
+	return float64(s.Embedded) / float64(s.Chunks)
+}
+
+// TakeStats measures the database now. Embeddings are counted for model,
+// or for any model if model is empty.
+func (db *DB) TakeStats(ctx context.Context, model string) (*StatsSnapshot, error) {
+	now := time.Now().UTC()
+	s := &StatsSnapshot{Day: now.Format(statsDay), Model: model, RecordedAt: now}
+	if err := db.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM chunks`).Scan(&s.Chunks); err != nil {
+		return nil, fmt.Errorf("count chunks: %w", err)
+	}
+	err := db.conn.QueryRowContext(ctx, `
+		SELECT COUNT(DISTINCT chunk_id) FROM embeddings WHERE ? = '' OR model = ?
+	`, model, model).Scan(&s.Embedded)
+	if err != nil {
+		return nil, fmt.Errorf("count embeddings: %w", err)
+	}
+	space, err := db.SpaceReport(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.DBBytes = space.FileBytes
+	return s, nil
+}
+
+// RecordStats stores s as the snapshot for its day, replacing an earlier
+// one from the same day.
+func (db *DB) RecordStats(ctx context.Context, s *StatsSnapshot) error {
+	_, err := db.conn.ExecContext(ctx, `
+		INSERT INTO storage_stats (day, chunks, embedded, model, db_bytes, recorded_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(day) DO UPDATE SET
+			chunks = excluded.chunks,
+			embedded = excluded.embedded,
+			model = excluded.model,
+			db_bytes = excluded.db_bytes,
+			recorded_at = excluded.recorded_at
+	`, s.Day, s.Chunks, s.Embedded, s.Model, s.DBBytes, s.RecordedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("record stats: %w", err)
+	}
+	return nil
+}
+
+// StatsHistory returns the daily snapshots of the last days days, oldest
+// first.
+func (db *DB) StatsHistory(ctx context.Context, days int) ([]StatsSnapshot, error) {
+	since := time.Now().UTC().AddDate(0, 0, -days).Format(statsDay)
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT day, chunks, embedded, model, db_bytes, recorded_at
+		FROM storage_stats WHERE day > ? ORDER BY day
+	`, since)
+	if err != nil {
+		return nil, fmt.Errorf("stats history: %w", err)
+	}
+	defer rows.Close()
+
+	history := []StatsSnapshot{}
+	for rows.Next() {
+		var s StatsSnapshot
+		var recorded int64
+		if err := rows.Scan(&s.Day, &s.Chunks, &s.Embedded, &s.Model, &s.DBBytes, &recorded); err != nil {
+			return nil, fmt.Errorf("scan stats: %w", err)
+		}
+		s.RecordedAt = time.Unix(recorded, 0).UTC()
+		history = append(history, s)
+	}
+	return history, rows.Err()
+}
+
+// ContentStats describes what the knowledge base holds.
+type ContentStats struct {
+	Chunks int `json:"chunks"`
+	// ContentBytes is the total size of chunk content, as UTF-8.
+	ContentBytes int64 `json:"content_bytes"`
+	// MetadataKeys counts the chunks having each metadata key.
+	MetadataKeys map[string]int `json:"metadata_keys"`
+	// Embeddings counts the chunks embedded with each model.
+	Embeddings map[string]int `json:"embeddings"`
+	DBBytes    int64          `json:"db_bytes"`
+	// FTSBytes is the size of the full-text index's segments.
+	FTSBytes int64 `json:"fts_bytes"`
+	// Oldest and Newest are the earliest and latest chunk creation times,
+	// and LastUpdated the latest change; all nil without chunks.
+	Oldest      *time.Time `json:"oldest,omitempty"`
+	Newest      *time.Time `json:"newest,omitempty"`
+	LastUpdated *time.Time `json:"last_updated,omitempty"`
+}
+
+// Coverage returns the share of chunks with an embedding for model.
+func (s ContentStats) Coverage(model string) float64 {
+	if s.Chunks == 0 {
+		return 0
+	}
+	return float64(s.Embeddings[model]) / float64(s.Chunks)
+}
+
+// ContentStats measures the knowledge base's contents.
+func (db *DB) ContentStats(ctx context.Context) (*ContentStats, error) {
+	s := &ContentStats{MetadataKeys: make(map[string]int), Embeddings: make(map[string]int)}
+	if db.cipher != nil {
+		if err := db.scanContentStats(ctx, s); err != nil {
+			return nil, err
+		}
+	} else {
+		err := db.conn.QueryRowContext(ctx, `SELECT COUNT(*), COALESCE(SUM(LENGTH(CAST(content AS BLOB))), 0) FROM chunks`).
+			Scan(&s.Chunks, &s.ContentBytes)
+		if err != nil {
+			return nil, fmt.Errorf("count chunks: %w", err)
+		}
+		rows, err := db.conn.QueryContext(ctx, `
+			SELECT j.key, COUNT(DISTINCT c.id)
+			FROM chunks c, json_each(c.metadata) j
+			WHERE c.metadata IS NOT NULL
+			GROUP BY j.key
+		`)
+		if err != nil {
+			return nil, fmt.Errorf("count metadata keys: %w", err)
+		}
+		if err := scanCounts(rows, s.MetadataKeys); err != nil {
+			return nil, fmt.Errorf("count metadata keys: %w", err)
+		}
+	}
+
+	rows, err := db.conn.QueryContext(ctx, `SELECT model, COUNT(DISTINCT chunk_id) FROM embeddings GROUP BY model`)
+	if err != nil {
+		return nil, fmt.Errorf("count embeddings: %w", err)
+	}
+	if err := scanCounts(rows, s.Embeddings); err != nil {
+		return nil, fmt.Errorf("count embeddings: %w", err)
+	}
+
+	// Ordering the column itself, rather than taking MIN/MAX, keeps its
+	// type so it scans as a time
+	for _, q := range []struct {
+		dest  **time.Time
+		query string
+	}{
+		{&s.Oldest, `SELECT created_at FROM chunks ORDER BY created_at LIMIT 1`},
+		{&s.Newest, `SELECT created_at FROM chunks ORDER BY created_at DESC LIMIT 1`},
+		{&s.LastUpdated, `SELECT updated_at FROM chunks ORDER BY updated_at DESC LIMIT 1`},
+	} {
+		var t time.Time
+		err := db.conn.QueryRowContext(ctx, q.query).Scan(&t)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("chunk timestamps: %w", err)
+		}
+		t = t.UTC()
+		*q.dest = &t
+	}
+
+	if err := db.conn.QueryRowContext(ctx, `SELECT COALESCE(SUM(LENGTH(block)), 0) FROM chunks_fts_data`).Scan(&s.FTSBytes); err != nil {
+		return nil, fmt.Errorf("measure full-text index: %w", err)
+	}
+	space, err := db.SpaceReport(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.DBBytes = space.FileBytes
+	return s, nil
+}
+
+// scanCounts reads (name, count) rows into counts.
+func scanCounts(rows *sql.Rows, counts map[string]int) error {
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var n int
+		if err := rows.Scan(&name, &n); err != nil {
+			return err
+		}
+		counts[name] = n
+	}
+	return rows.Err()
+}
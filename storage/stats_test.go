@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestStatsHistory(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	a, _ := db.CreateChunk(ctx, "embedded", nil)
+	db.CreateChunk(ctx, "not embedded", nil)
+	db.SaveEmbedding(ctx, a.ID, "test/model", a.Content, []float32{1, 0})
+	db.SaveEmbedding(ctx, a.ID, "other/model", a.Content, []float32{0, 1})
+
+	s, err := db.TakeStats(ctx, "test/model")
+	if err != nil {
+		t.Fatalf("TakeStats: %v", err)
+	}
+	if s.Chunks != 2 || s.Embedded != 1 || s.Coverage() != 0.5 || s.DBBytes <= 0 {
+		t.Errorf("stats = %+v", s)
+	}
+	if all, _ := db.TakeStats(ctx, ""); all.Embedded != 1 {
+		t.Errorf("embedded for any model = %d, want 1", all.Embedded)
+	}
+
+	// Earlier days, and a second snapshot replacing the first one of today
+	now := time.Now().UTC()
+	for i, day := range []string{now.AddDate(0, 0, -40).Format(statsDay), now.AddDate(0, 0, -1).Format(statsDay)} {
+		if err := db.RecordStats(ctx, &StatsSnapshot{Day: day, Chunks: i, RecordedAt: now}); err != nil {
+			t.Fatalf("RecordStats: %v", err)
+		}
+	}
+	db.RecordStats(ctx, &StatsSnapshot{Day: s.Day, Chunks: 1, RecordedAt: now})
+	if err := db.RecordStats(ctx, s); err != nil {
+		t.Fatalf("RecordStats: %v", err)
+	}
+
+	history, err := db.StatsHistory(ctx, 30)
+	if err != nil {
+		t.Fatalf("StatsHistory: %v", err)
+	}
+	if len(history) != 2 || history[0].Chunks != 1 || history[1].Day != s.Day || history[1].Chunks != 2 {
+		t.Errorf("history = %+v", history)
+	}
+	if history[1].Model != "test/model" || history[1].Embedded != 1 {
+		t.Errorf("today = %+v", history[1])
+	}
+}
+
+func TestContentStats(t *testing.T) {
+	ctx := context.Background()
+	for _, encrypted := range []bool{false, true} {
+		db := setupTestDB(t)
+		if encrypted {
+			db.SetEncryptionKey(testKey)
+		}
+		empty, err := db.ContentStats(ctx)
+		if err != nil {
+			t.Fatalf("ContentStats: %v", err)
+		}
+		if empty.Chunks != 0 || empty.Oldest != nil {
+			t.Errorf("empty stats = %+v", empty)
+		}
+
+		a, _ := db.CreateChunk(ctx, "héllo", json.RawMessage(`{"title":"A","tags":["x","y"]}`))
+		time.Sleep(10 * time.Millisecond)
+		b, _ := db.CreateChunk(ctx, "world", json.RawMessage(`{"title":"B"}`))
+		db.CreateChunk(ctx, "plain", nil)
+		db.SaveEmbedding(ctx, a.ID, "test/model", a.Content, []float32{1, 0})
+		db.SaveEmbedding(ctx, b.ID, "test/model", b.Content, []float32{0, 1})
+		db.SaveEmbedding(ctx, a.ID, "other/model", a.Content, []float32{1})
+
+		s, err := db.ContentStats(ctx)
+		if err != nil {
+			t.Fatalf("ContentStats: %v", err)
+		}
+		if s.Chunks != 3 || s.ContentBytes != int64(len("héllo")+10) {
+			t.Errorf("encrypted=%v: chunks = %d, content bytes = %d", encrypted, s.Chunks, s.ContentBytes)
+		}
+		if s.MetadataKeys["title"] != 2 || s.MetadataKeys["tags"] != 1 || len(s.MetadataKeys) != 2 {
+			t.Errorf("encrypted=%v: metadata keys = %v", encrypted, s.MetadataKeys)
+		}
+		if s.Embeddings["test/model"] != 2 || s.Embeddings["other/model"] != 1 || s.Coverage("test/model") != 2.0/3 {
+			t.Errorf("encrypted=%v: embeddings = %v", encrypted, s.Embeddings)
+		}
+		if s.Oldest == nil || !s.Oldest.Equal(a.CreatedAt) || s.Newest.Before(b.CreatedAt) || s.LastUpdated == nil {
+			t.Errorf("encrypted=%v: oldest = %v, newest = %v, want %v, %v", encrypted, s.Oldest, s.Newest, a.CreatedAt, b.CreatedAt)
+		}
+		if s.DBBytes <= 0 || s.FTSBytes <= 0 {
+			t.Errorf("encrypted=%v: db = %d, fts = %d bytes", encrypted, s.DBBytes, s.FTSBytes)
+		}
+	}
+}
@@ -4,16 +4,28 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"time"
 )
 
 // Storage defines the interface for data persistence.
-// Implementations must be safe for concurrent use.
+// Implementations must be safe for concurrent use. Every method takes the
+// context of the request it serves; cancelling it aborts the query.
 type Storage interface {
 	ChunkStore
+	SourceStore
+	LinkStore
+	SessionStore
+	AccessStore
+	AttachmentStore
+	EntityStore
+	ChunkLockStore
+	ToolCallStore
 	EmbeddingStore
+	EmbeddingQueue
 	TokenStore
 	ClientStore
 	SettingsStore
+	SigningKeyStore
 
 	// Close closes the storage connection.
 	Close() error
@@ -21,47 +33,137 @@ type Storage interface {
 
 // ChunkStore handles chunk operations.
 type ChunkStore interface {
-	CreateChunk(content string, metadata json.RawMessage) (*Chunk, error)
-	GetChunk(id string) (*Chunk, error)
-	GetAllChunks() ([]Chunk, error)
-	UpdateChunk(id string, content *string, metadata json.RawMessage) (*Chunk, error)
-	DeleteChunk(id string) (bool, error)
-	SearchChunks(query string, limit int) ([]SearchResult, error)
-	GetMetadataIndex(topN int) (map[string]any, error)
-	GetMetadataValues(key string, topN int) (map[string]any, error)
+	CreateChunk(ctx context.Context, content string, metadata json.RawMessage) (*Chunk, error)
+	GetChunk(ctx context.Context, id string) (*Chunk, error)
+	GetAllChunks(ctx context.Context) ([]Chunk, error)
+	GetChunksPage(ctx context.Context, afterID string, limit int) ([]Chunk, error)
+	UpdateChunk(ctx context.Context, id string, content *string, metadata json.RawMessage) (*Chunk, error)
+	PutChunk(ctx context.Context, c *Chunk) error
+	DeleteChunk(ctx context.Context, id string) (bool, error)
+	ChangesSince(ctx context.Context, since time.Time) ([]Chunk, []Tombstone, error)
+	SearchChunks(ctx context.Context, query string, limit int) ([]SearchResult, error)
+	SearchChunksMatching(ctx context.Context, query string, limit int, mode MatchMode) ([]SearchResult, error)
+	GetMetadataIndex(ctx context.Context, topN int) (map[string]any, error)
+	GetMetadataValues(ctx context.Context, key string, topN int) (map[string]any, error)
+	FilterChunkIDs(ctx context.Context, filter map[string]any) ([]string, error)
+	UpdatedTimes(ctx context.Context, ids []string) (map[string]time.Time, error)
+	CreatedTimes(ctx context.Context, ids []string) (map[string]time.Time, error)
+	FacetChunks(ctx context.Context, ids []string, key string, topN int) (map[string]any, error)
+	ContentStats(ctx context.Context) (*ContentStats, error)
+}
+
+// SourceStore handles sources and the chunks referencing them.
+type SourceStore interface {
+	CreateSource(ctx context.Context, name string, metadata json.RawMessage) (*Source, error)
+	GetSource(ctx context.Context, id string) (*Source, error)
+	FindSource(ctx context.Context, name string) (*Source, error)
+	ListSources(ctx context.Context) ([]Source, error)
+	UpdateSource(ctx context.Context, id string, name *string, metadata json.RawMessage) (*Source, error)
+	DeleteSource(ctx context.Context, id string) (bool, error)
+	SetChunkSource(ctx context.Context, chunkID, sourceID string) error
+	ChunkSource(ctx context.Context, chunkID string) (*Source, error)
+	GetChunksBySource(ctx context.Context, sourceID string) ([]Chunk, error)
+}
+
+// LinkStore reads the graph of [[chunk-id]] links between chunks.
+type LinkStore interface {
+	LinkGraph(ctx context.Context) ([]string, map[string][]string, error)
+	Backlinks(ctx context.Context) (map[string]int, error)
+}
+
+// SessionStore records which client stored each chunk, for capture sessions.
+type SessionStore interface {
+	SetChunkClient(ctx context.Context, chunkID, client string) error
+	CaptureSession(ctx context.Context, id string, window time.Duration) (*Session, error)
+}
+
+// AccessStore records when chunks are read.
+type AccessStore interface {
+	RecordAccess(ctx context.Context, chunkID string) error
+	AccessTimes(ctx context.Context) (map[string]time.Time, error)
+	UsageReport(ctx context.Context, limit int) (*UsageReport, error)
+}
+
+// AttachmentStore keeps files attached to chunks.
+type AttachmentStore interface {
+	AddAttachment(ctx context.Context, chunkID, name, contentType string, data []byte) (*Attachment, error)
+	GetAttachment(ctx context.Context, id string) (*Attachment, []byte, error)
+	ListAttachments(ctx context.Context, chunkID string) ([]Attachment, error)
+	DeleteAttachment(ctx context.Context, id string) (bool, error)
+}
+
+// EntityStore keeps the people, projects and dates chunks mention.
+type EntityStore interface {
+	SetChunkEntities(ctx context.Context, chunkID string, entities []Entity) error
+	ChunkEntities(ctx context.Context, chunkID string) ([]Entity, error)
+	ListEntities(ctx context.Context, kind string) ([]EntityCount, error)
+	EntityChunkIDs(ctx context.Context, kind, name string) ([]string, error)
+}
+
+// ChunkLockStore keeps which chunks are locked against changes by MCP
+// clients.
+type ChunkLockStore interface {
+	SetChunkLocked(ctx context.Context, id string, locked bool) error
+	ChunkLocked(ctx context.Context, id string) (bool, error)
+	LockedChunkIDs(ctx context.Context) ([]string, error)
+}
+
+// ToolCallStore keeps a log of recent tool calls for replay.
+type ToolCallStore interface {
+	RecordToolCall(ctx context.Context, call *ToolCall, keep int) error
+	GetToolCall(ctx context.Context, id int64) (*ToolCall, error)
+	ListToolCalls(ctx context.Context, limit int) ([]ToolCall, error)
 }
 
 // EmbeddingStore handles embedding operations.
 type EmbeddingStore interface {
-	SaveEmbedding(chunkID, model string, vec []float32) error
-	GetEmbedding(chunkID string) ([]float32, error)
-	DeleteEmbedding(chunkID string) error
-	LoadEmbeddingsByModel(model string) (map[string][]float32, error)
-	GetChunksWithoutEmbeddings(model string) ([]Chunk, error)
+	SaveEmbedding(ctx context.Context, chunkID, model, text string, vec []float32) error
+	GetEmbedding(ctx context.Context, chunkID string) ([]float32, error)
+	DeleteEmbedding(ctx context.Context, chunkID string) error
+	LoadEmbeddingsByModel(ctx context.Context, model string) (map[string][]float32, error)
+	GetChunksWithoutEmbeddings(ctx context.Context, model string) ([]Chunk, error)
+	GetChunksWithoutEmbeddingsPage(ctx context.Context, model, afterID string, limit int) ([]Chunk, error)
+	EmbeddingStatus(ctx context.Context, chunkID, model string, fields []string) (string, error)
+}
+
+// EmbeddingQueue holds chunks whose embedding failed, to be retried.
+type EmbeddingQueue interface {
+	QueueEmbedding(ctx context.Context, chunkID, reason string) error
+	DueEmbeddings(ctx context.Context, now time.Time, limit int) ([]QueuedEmbedding, error)
+	PostponeEmbedding(ctx context.Context, chunkID, reason string, next time.Time) error
+	DequeueEmbedding(ctx context.Context, chunkID string) error
+	EmbeddingQueueLen(ctx context.Context) (int, error)
 }
 
 // TokenStore handles OAuth token operations.
 type TokenStore interface {
-	StoreToken(hash string, typ TokenType, clientID string, expiresAt int64, data map[string]string) error
-	ValidateToken(hash string, typ TokenType) (*Token, error)
-	ConsumeToken(hash string, typ TokenType) (*Token, error)
-	DeleteToken(hash string) error
+	StoreToken(ctx context.Context, hash string, typ TokenType, clientID string, expiresAt int64, data map[string]string) error
+	ValidateToken(ctx context.Context, hash string, typ TokenType) (*Token, error)
+	ConsumeToken(ctx context.Context, hash string, typ TokenType) (*Token, error)
+	DeleteToken(ctx context.Context, hash string) error
 }
 
 // ClientStore handles OAuth client operations.
 type ClientStore interface {
-	CreateClient(clientID, clientName string, redirectURIs []string) error
-	GetClient(clientID string) (*OAuthClient, error)
-	TouchClient(clientID string) error
-	DeleteStaleClients() error
+	CreateClient(ctx context.Context, clientID, clientName string, redirectURIs, grantTypes []string) error
+	GetClient(ctx context.Context, clientID string) (*OAuthClient, error)
+	TouchClient(ctx context.Context, clientID string) error
+	DeleteStaleClients(ctx context.Context) (int64, error)
 }
 
 // SettingsStore handles application settings.
 type SettingsStore interface {
-	GetSetting(key string) (string, error)
-	SetSetting(key, value string) error
-	GetPasswordHash() (string, error)
-	SetPasswordHash(hash string) error
+	GetSetting(ctx context.Context, key string) (string, error)
+	SetSetting(ctx context.Context, key, value string) error
+	GetPasswordHash(ctx context.Context) (string, error)
+	SetPasswordHash(ctx context.Context, hash string) error
+}
+
+// SigningKeyStore handles JWT signing keys.
+type SigningKeyStore interface {
+	CreateSigningKey(ctx context.Context, kid string, privateKey []byte) error
+	ListSigningKeys(ctx context.Context) ([]SigningKey, error)
+	DeleteSigningKeysBefore(ctx context.Context, before int64, keep string) error
 }
 
 // TxStorage extends Storage with transaction support.
@@ -76,13 +178,27 @@ type TxStorage interface {
 // Only includes methods needed for atomic chunk+embedding creation.
 type Tx interface {
 	// CreateChunk creates a new chunk within the transaction.
-	CreateChunk(content string, metadata json.RawMessage) (*Chunk, error)
+	CreateChunk(ctx context.Context, content string, metadata json.RawMessage) (*Chunk, error)
 
 	// UpdateChunk updates a chunk within the transaction.
-	UpdateChunk(id string, content *string, metadata json.RawMessage) (*Chunk, error)
+	UpdateChunk(ctx context.Context, id string, content *string, metadata json.RawMessage) (*Chunk, error)
+
+	// SaveEmbedding saves an embedding of text within the transaction.
+	SaveEmbedding(ctx context.Context, chunkID, model, text string, vec []float32) error
+
+	// QueueEmbedding queues a chunk for embedding within the transaction.
+	QueueEmbedding(ctx context.Context, chunkID, reason string) error
 
-	// SaveEmbedding saves an embedding within the transaction.
-	SaveEmbedding(chunkID, model string, vec []float32) error
+	// SetChunkSource sets a chunk's source within the transaction.
+	SetChunkSource(ctx context.Context, chunkID, sourceID string) error
+
+	// DeleteChunk deletes a chunk within the transaction.
+	DeleteChunk(ctx context.Context, id string) (bool, error)
+
+	// ChunkLocked reports whether a chunk is locked, as of the
+	// transaction, which holds the write lock so it cannot change before
+	// commit.
+	ChunkLocked(ctx context.Context, id string) (bool, error)
 
 	// Commit commits the transaction.
 	Commit() error
@@ -96,41 +212,68 @@ var _ TxStorage = (*DB)(nil)
 
 // sqlExecutor abstracts sql.DB and sql.Tx for shared query execution.
 type sqlExecutor interface {
-	Exec(query string, args ...any) (sql.Result, error)
-	Query(query string, args ...any) (*sql.Rows, error)
-	QueryRow(query string, args ...any) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
 }
 
 // txWrapper wraps sql.Tx to implement Tx interface.
 type txWrapper struct {
-	tx *sql.Tx
+	db      *DB
+	tx      *sql.Tx
+	deleted bool // a chunk was deleted, so space may be reclaimed on commit
 }
 
 // BeginTx starts a new transaction.
 func (db *DB) BeginTx(ctx context.Context) (Tx, error) {
-	tx, err := db.conn.BeginTx(ctx, nil)
+	tx, err := db.beginWrite(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return &txWrapper{tx: tx}, nil
+	return &txWrapper{db: db, tx: tx}, nil
 }
 
 func (t *txWrapper) Commit() error {
-	return t.tx.Commit()
+	if err := t.tx.Commit(); err != nil {
+		return err
+	}
+	t.db.search.invalidate()
+	if t.deleted {
+		t.db.reclaimSpace(context.Background())
+	}
+	return nil
 }
 
 func (t *txWrapper) Rollback() error {
 	return t.tx.Rollback()
 }
 
-func (t *txWrapper) CreateChunk(content string, metadata json.RawMessage) (*Chunk, error) {
-	return createChunk(t.tx, content, metadata)
+func (t *txWrapper) CreateChunk(ctx context.Context, content string, metadata json.RawMessage) (*Chunk, error) {
+	return createChunk(ctx, t.tx, t.db.cipher, content, metadata)
+}
+
+func (t *txWrapper) UpdateChunk(ctx context.Context, id string, content *string, metadata json.RawMessage) (*Chunk, error) {
+	return updateChunk(ctx, t.tx, t.db.cipher, id, content, metadata)
+}
+
+func (t *txWrapper) SaveEmbedding(ctx context.Context, chunkID, model, text string, vec []float32) error {
+	return saveEmbedding(ctx, t.tx, t.db.cipher, chunkID, model, text, vec)
+}
+
+func (t *txWrapper) QueueEmbedding(ctx context.Context, chunkID, reason string) error {
+	return queueEmbedding(ctx, t.tx, chunkID, reason)
+}
+
+func (t *txWrapper) SetChunkSource(ctx context.Context, chunkID, sourceID string) error {
+	return setChunkSource(ctx, t.tx, chunkID, sourceID)
 }
 
-func (t *txWrapper) UpdateChunk(id string, content *string, metadata json.RawMessage) (*Chunk, error) {
-	return updateChunk(t.tx, id, content, metadata)
+func (t *txWrapper) DeleteChunk(ctx context.Context, id string) (bool, error) {
+	deleted, err := deleteChunk(ctx, t.tx, id)
+	t.deleted = t.deleted || deleted
+	return deleted, err
 }
 
-func (t *txWrapper) SaveEmbedding(chunkID, model string, vec []float32) error {
-	return saveEmbedding(t.tx, chunkID, model, vec)
+func (t *txWrapper) ChunkLocked(ctx context.Context, id string) (bool, error) {
+	return chunkLocked(ctx, t.tx, id)
 }
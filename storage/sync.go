@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Tombstone records that a chunk was deleted, so the delete can be passed
+// on to other instances.
+type Tombstone struct {
+	ChunkID   string    `json:"chunk_id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+func addTombstone(ctx context.Context, exec sqlExecutor, chunkID string) error {
+	_, err := exec.ExecContext(ctx, `
+		INSERT INTO chunk_tombstones (chunk_id, deleted_at) VALUES (?, ?)
+		ON CONFLICT(chunk_id) DO UPDATE SET deleted_at = excluded.deleted_at
+	`, chunkID, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("record tombstone: %w", err)
+	}
+	return nil
+}
+
+// ChangesSince returns the chunks updated and the chunks deleted after
+// since. Storing a chunk again with PutChunk clears its tombstone.
+func (db *DB) ChangesSince(ctx context.Context, since time.Time) ([]Chunk, []Tombstone, error) {
+	all, err := db.GetAllChunks(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	chunks := []Chunk{}
+	for _, c := range all {
+		if c.UpdatedAt.After(since) {
+			chunks = append(chunks, c)
+		}
+	}
+
+	// Timestamps are compared in Go: their stored text does not sort reliably
+	rows, err := db.conn.QueryContext(ctx, `SELECT chunk_id, deleted_at FROM chunk_tombstones`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list tombstones: %w", err)
+	}
+	defer rows.Close()
+	tombstones := []Tombstone{}
+	for rows.Next() {
+		var t Tombstone
+		if err := rows.Scan(&t.ChunkID, &t.DeletedAt); err != nil {
+			return nil, nil, fmt.Errorf("scan tombstone: %w", err)
+		}
+		if t.DeletedAt.After(since) {
+			tombstones = append(tombstones, t)
+		}
+	}
+	return chunks, tombstones, rows.Err()
+}
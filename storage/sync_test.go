@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestChangesSince(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	old, _ := db.CreateChunk(ctx, "old", nil)
+	gone, _ := db.CreateChunk(ctx, "gone", nil)
+
+	since := time.Now().UTC()
+	time.Sleep(2 * time.Millisecond)
+	fresh, _ := db.CreateChunk(ctx, "fresh", nil)
+	db.DeleteChunk(ctx, gone.ID)
+
+	chunks, tombstones, err := db.ChangesSince(ctx, since)
+	if err != nil {
+		t.Fatalf("ChangesSince: %v", err)
+	}
+	if len(chunks) != 1 || chunks[0].ID != fresh.ID {
+		t.Errorf("chunks = %+v, want only %s", chunks, fresh.ID)
+	}
+	if len(tombstones) != 1 || tombstones[0].ChunkID != gone.ID || !tombstones[0].DeletedAt.After(since) {
+		t.Errorf("tombstones = %+v", tombstones)
+	}
+
+	chunks, _, _ = db.ChangesSince(ctx, time.Time{})
+	if len(chunks) != 2 || chunks[0].ID != old.ID {
+		t.Errorf("all changes = %+v", chunks)
+	}
+
+	// Storing a deleted chunk again brings it back
+	if err := db.PutChunk(ctx, gone); err != nil {
+		t.Fatalf("PutChunk: %v", err)
+	}
+	if _, tombstones, _ := db.ChangesSince(ctx, since); len(tombstones) != 0 {
+		t.Errorf("tombstones after PutChunk = %+v", tombstones)
+	}
+}
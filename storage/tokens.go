@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
@@ -12,10 +13,12 @@ import (
 type TokenType string
 
 const (
-	TokenAccess   TokenType = "access"
-	TokenRefresh  TokenType = "refresh"
-	TokenAuthCode TokenType = "auth_code"
-	TokenCSRF     TokenType = "csrf"
+	TokenAccess     TokenType = "access"
+	TokenRefresh    TokenType = "refresh"
+	TokenAuthCode   TokenType = "auth_code"
+	TokenCSRF       TokenType = "csrf"
+	TokenDeviceCode TokenType = "device_code"
+	TokenUserCode   TokenType = "user_code"
 )
 
 // Token represents a stored token.
@@ -35,9 +38,9 @@ func HashToken(token string) string {
 
 // StoreToken stores a token in the database.
 // data is optional (pass nil for access/refresh tokens).
-func (db *DB) StoreToken(hash string, typ TokenType, clientID string, expiresAt int64, data map[string]string) error {
+func (db *DB) StoreToken(ctx context.Context, hash string, typ TokenType, clientID string, expiresAt int64, data map[string]string) error {
 	// Cleanup expired tokens first
-	db.conn.Exec("DELETE FROM tokens WHERE expires_at < ?", time.Now().Unix())
+	db.conn.ExecContext(ctx, "DELETE FROM tokens WHERE expires_at < ?", time.Now().Unix())
 
 	var dataJSON *string
 	if data != nil {
@@ -49,7 +52,7 @@ func (db *DB) StoreToken(hash string, typ TokenType, clientID string, expiresAt
 		dataJSON = &s
 	}
 
-	_, err := db.conn.Exec(
+	_, err := db.conn.ExecContext(ctx,
 		"INSERT OR REPLACE INTO tokens (hash, type, client_id, expires_at, data) VALUES (?, ?, ?, ?, ?)",
 		hash, string(typ), clientID, expiresAt, dataJSON,
 	)
@@ -57,10 +60,10 @@ func (db *DB) StoreToken(hash string, typ TokenType, clientID string, expiresAt
 }
 
 // ValidateToken checks if a token is valid and returns its data.
-func (db *DB) ValidateToken(hash string, typ TokenType) (*Token, error) {
+func (db *DB) ValidateToken(ctx context.Context, hash string, typ TokenType) (*Token, error) {
 	var t Token
 	var dataStr sql.NullString
-	err := db.conn.QueryRow(
+	err := db.conn.QueryRowContext(ctx,
 		"SELECT hash, type, client_id, expires_at, data FROM tokens WHERE hash = ? AND type = ? AND expires_at > ?",
 		hash, string(typ), time.Now().Unix(),
 	).Scan(&t.Hash, &t.Type, &t.ClientID, &t.ExpiresAt, &dataStr)
@@ -79,10 +82,10 @@ func (db *DB) ValidateToken(hash string, typ TokenType) (*Token, error) {
 }
 
 // ConsumeToken atomically validates and deletes a token (single-use).
-func (db *DB) ConsumeToken(hash string, typ TokenType) (*Token, error) {
+func (db *DB) ConsumeToken(ctx context.Context, hash string, typ TokenType) (*Token, error) {
 	var t Token
 	var dataStr sql.NullString
-	err := db.conn.QueryRow(
+	err := db.conn.QueryRowContext(ctx,
 		"DELETE FROM tokens WHERE hash = ? AND type = ? AND expires_at > ? RETURNING hash, type, client_id, expires_at, data",
 		hash, string(typ), time.Now().Unix(),
 	).Scan(&t.Hash, &t.Type, &t.ClientID, &t.ExpiresAt, &dataStr)
@@ -101,7 +104,46 @@ func (db *DB) ConsumeToken(hash string, typ TokenType) (*Token, error) {
 }
 
 // DeleteToken removes a token from the database.
-func (db *DB) DeleteToken(hash string) error {
-	_, err := db.conn.Exec("DELETE FROM tokens WHERE hash = ?", hash)
+func (db *DB) DeleteToken(ctx context.Context, hash string) error {
+	_, err := db.conn.ExecContext(ctx, "DELETE FROM tokens WHERE hash = ?", hash)
 	return err
 }
+
+// TokenSession summarizes the unexpired access and refresh tokens of a
+// client.
+type TokenSession struct {
+	ClientID string `json:"client_id"`
+	Access   int    `json:"access"`
+	Refresh  int    `json:"refresh"`
+	// ExpiresAt is when the client's last token expires.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TokenSessions returns the clients holding unexpired access or refresh
+// tokens, latest expiry first.
+func (db *DB) TokenSessions(ctx context.Context) ([]TokenSession, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT client_id,
+		       SUM(type = ?), SUM(type = ?), MAX(expires_at)
+		FROM tokens
+		WHERE type IN (?, ?) AND expires_at > ?
+		GROUP BY client_id
+		ORDER BY MAX(expires_at) DESC
+	`, string(TokenAccess), string(TokenRefresh), string(TokenAccess), string(TokenRefresh), time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []TokenSession{}
+	for rows.Next() {
+		var s TokenSession
+		var expires int64
+		if err := rows.Scan(&s.ClientID, &s.Access, &s.Refresh, &expires); err != nil {
+			return nil, err
+		}
+		s.ExpiresAt = time.Unix(expires, 0).UTC()
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"testing"
 	"time"
 )
@@ -22,16 +23,17 @@ func TestHashToken(t *testing.T) {
 }
 
 func TestStoreAndValidateToken(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
 	hash := HashToken("my-access-token")
 	expiry := time.Now().Add(time.Hour).Unix()
 
-	if err := db.StoreToken(hash, TokenAccess, "client-123", expiry, nil); err != nil {
+	if err := db.StoreToken(ctx, hash, TokenAccess, "client-123", expiry, nil); err != nil {
 		t.Fatalf("StoreToken: %v", err)
 	}
 
-	token, err := db.ValidateToken(hash, TokenAccess)
+	token, err := db.ValidateToken(ctx, hash, TokenAccess)
 	if err != nil {
 		t.Fatalf("ValidateToken: %v", err)
 	}
@@ -48,71 +50,76 @@ func TestStoreAndValidateToken(t *testing.T) {
 }
 
 func TestValidateTokenWrongType(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
 	hash := HashToken("token")
 	expiry := time.Now().Add(time.Hour).Unix()
 
-	db.StoreToken(hash, TokenAccess, "client", expiry, nil)
+	db.StoreToken(ctx, hash, TokenAccess, "client", expiry, nil)
 
 	// Try to validate as refresh token
-	_, err := db.ValidateToken(hash, TokenRefresh)
+	_, err := db.ValidateToken(ctx, hash, TokenRefresh)
 	if err == nil {
 		t.Error("Expected error for wrong token type")
 	}
 }
 
 func TestValidateTokenExpired(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
 	hash := HashToken("expired-token")
 	expiry := time.Now().Add(-time.Hour).Unix() // expired
 
-	db.StoreToken(hash, TokenAccess, "client", expiry, nil)
+	db.StoreToken(ctx, hash, TokenAccess, "client", expiry, nil)
 
-	_, err := db.ValidateToken(hash, TokenAccess)
+	_, err := db.ValidateToken(ctx, hash, TokenAccess)
 	if err == nil {
 		t.Error("Expected error for expired token")
 	}
 }
 
 func TestValidateTokenNotFound(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
-	_, err := db.ValidateToken("nonexistent", TokenAccess)
+	_, err := db.ValidateToken(ctx, "nonexistent", TokenAccess)
 	if err == nil {
 		t.Error("Expected error for nonexistent token")
 	}
 }
 
 func TestDeleteToken(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
 	hash := HashToken("to-delete")
 	expiry := time.Now().Add(time.Hour).Unix()
 
-	db.StoreToken(hash, TokenRefresh, "client", expiry, nil)
+	db.StoreToken(ctx, hash, TokenRefresh, "client", expiry, nil)
 
-	if err := db.DeleteToken(hash); err != nil {
+	if err := db.DeleteToken(ctx, hash); err != nil {
 		t.Fatalf("DeleteToken: %v", err)
 	}
 
-	_, err := db.ValidateToken(hash, TokenRefresh)
+	_, err := db.ValidateToken(ctx, hash, TokenRefresh)
 	if err == nil {
 		t.Error("Token should be deleted")
 	}
 }
 
 func TestStoreTokenCleansExpired(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
 	// Store expired token
 	expiredHash := HashToken("expired")
-	db.StoreToken(expiredHash, TokenAccess, "client", time.Now().Add(-time.Hour).Unix(), nil)
+	db.StoreToken(ctx, expiredHash, TokenAccess, "client", time.Now().Add(-time.Hour).Unix(), nil)
 
 	// Store new token - should trigger cleanup
 	newHash := HashToken("new")
-	db.StoreToken(newHash, TokenAccess, "client", time.Now().Add(time.Hour).Unix(), nil)
+	db.StoreToken(ctx, newHash, TokenAccess, "client", time.Now().Add(time.Hour).Unix(), nil)
 
 	// Expired token should be gone
 	var count int
@@ -123,17 +130,18 @@ func TestStoreTokenCleansExpired(t *testing.T) {
 }
 
 func TestStoreTokenWithData(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
 	hash := HashToken("token-with-data")
 	expiry := time.Now().Add(time.Hour).Unix()
 	data := map[string]string{"key": "value", "foo": "bar"}
 
-	if err := db.StoreToken(hash, TokenCSRF, "client", expiry, data); err != nil {
+	if err := db.StoreToken(ctx, hash, TokenCSRF, "client", expiry, data); err != nil {
 		t.Fatalf("StoreToken: %v", err)
 	}
 
-	token, err := db.ValidateToken(hash, TokenCSRF)
+	token, err := db.ValidateToken(ctx, hash, TokenCSRF)
 	if err != nil {
 		t.Fatalf("ValidateToken: %v", err)
 	}
@@ -147,16 +155,17 @@ func TestStoreTokenWithData(t *testing.T) {
 }
 
 func TestConsumeToken(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
 	hash := HashToken("single-use")
 	expiry := time.Now().Add(time.Hour).Unix()
 	data := map[string]string{"code": "abc123"}
 
-	db.StoreToken(hash, TokenAuthCode, "client", expiry, data)
+	db.StoreToken(ctx, hash, TokenAuthCode, "client", expiry, data)
 
 	// First consume succeeds
-	token, err := db.ConsumeToken(hash, TokenAuthCode)
+	token, err := db.ConsumeToken(ctx, hash, TokenAuthCode)
 	if err != nil {
 		t.Fatalf("ConsumeToken: %v", err)
 	}
@@ -165,22 +174,51 @@ func TestConsumeToken(t *testing.T) {
 	}
 
 	// Second consume fails (already consumed)
-	_, err = db.ConsumeToken(hash, TokenAuthCode)
+	_, err = db.ConsumeToken(ctx, hash, TokenAuthCode)
 	if err == nil {
 		t.Error("Second ConsumeToken should fail")
 	}
 }
 
 func TestConsumeTokenExpired(t *testing.T) {
+	ctx := context.Background()
 	db := setupTestDB(t)
 
 	hash := HashToken("expired-consume")
 	expiry := time.Now().Add(-time.Hour).Unix() // expired
 
-	db.StoreToken(hash, TokenCSRF, "client", expiry, nil)
+	db.StoreToken(ctx, hash, TokenCSRF, "client", expiry, nil)
 
-	_, err := db.ConsumeToken(hash, TokenCSRF)
+	_, err := db.ConsumeToken(ctx, hash, TokenCSRF)
 	if err == nil {
 		t.Error("ConsumeToken should fail for expired token")
 	}
 }
+
+func TestTokenSessions(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+
+	soon := time.Now().Add(time.Hour).Unix()
+	later := time.Now().Add(48 * time.Hour).Unix()
+	db.StoreToken(ctx, HashToken("a1"), TokenAccess, "claude", soon, nil)
+	db.StoreToken(ctx, HashToken("a2"), TokenAccess, "claude", soon, nil)
+	db.StoreToken(ctx, HashToken("r1"), TokenRefresh, "claude", later, nil)
+	db.StoreToken(ctx, HashToken("a3"), TokenAccess, "cli", soon, nil)
+	db.StoreToken(ctx, HashToken("old"), TokenAccess, "gone", time.Now().Add(-time.Hour).Unix(), nil)
+	db.StoreToken(ctx, HashToken("csrf"), TokenCSRF, "form", later, nil)
+
+	sessions, err := db.TokenSessions(ctx)
+	if err != nil {
+		t.Fatalf("TokenSessions: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("sessions = %+v, want claude and cli", sessions)
+	}
+	if s := sessions[0]; s.ClientID != "claude" || s.Access != 2 || s.Refresh != 1 || s.ExpiresAt.Unix() != later {
+		t.Errorf("sessions[0] = %+v", s)
+	}
+	if s := sessions[1]; s.ClientID != "cli" || s.Access != 1 || s.Refresh != 0 {
+		t.Errorf("sessions[1] = %+v", s)
+	}
+}
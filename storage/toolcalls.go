@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrToolCallNotFound is returned when no recorded tool call has the ID.
+var ErrToolCallNotFound = errors.New("tool call not found")
+
+// ToolCall is a recorded tool invocation and the response it produced.
+type ToolCall struct {
+	ID     int64     `json:"id"`
+	Time   time.Time `json:"time"`
+	Client string    `json:"client,omitempty"`
+	Tool   string    `json:"tool"`
+	// Arguments are the call's arguments as sent.
+	Arguments json.RawMessage `json:"arguments"`
+	// Response is the tool result returned to the client.
+	Response   json.RawMessage `json:"response"`
+	IsError    bool            `json:"is_error"`
+	DurationMS int64           `json:"duration_ms"`
+}
+
+// RecordToolCall appends call to the tool call log, setting its ID, and
+// drops all but the keep most recent calls. Arguments and responses are
+// encrypted like chunk content.
+func (db *DB) RecordToolCall(ctx context.Context, call *ToolCall, keep int) error {
+	if call.Time.IsZero() {
+		call.Time = time.Now()
+	}
+	res, err := db.conn.ExecContext(ctx, `
+		INSERT INTO tool_calls (created_at, client, tool, arguments, response, is_error, duration_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, call.Time.Unix(), call.Client, call.Tool, db.cipher.sealBytes(call.Arguments),
+		db.cipher.sealBytes(call.Response), call.IsError, call.DurationMS)
+	if err != nil {
+		return fmt.Errorf("record tool call: %w", err)
+	}
+	if call.ID, err = res.LastInsertId(); err != nil {
+		return fmt.Errorf("record tool call: %w", err)
+	}
+	if _, err := db.conn.ExecContext(ctx, `DELETE FROM tool_calls WHERE id <= ?`, call.ID-int64(keep)); err != nil {
+		return fmt.Errorf("prune tool calls: %w", err)
+	}
+	return nil
+}
+
+// GetToolCall returns the recorded tool call with the given ID.
+func (db *DB) GetToolCall(ctx context.Context, id int64) (*ToolCall, error) {
+	row := db.conn.QueryRowContext(ctx, `
+		SELECT id, created_at, client, tool, arguments, response, is_error, duration_ms
+		FROM tool_calls WHERE id = ?
+	`, id)
+	call, err := db.scanToolCall(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrToolCallNotFound
+	}
+	return call, err
+}
+
+// ListToolCalls returns up to limit recorded tool calls, newest first.
+func (db *DB) ListToolCalls(ctx context.Context, limit int) ([]ToolCall, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT id, created_at, client, tool, arguments, response, is_error, duration_ms
+		FROM tool_calls ORDER BY id DESC LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list tool calls: %w", err)
+	}
+	defer rows.Close()
+
+	var calls []ToolCall
+	for rows.Next() {
+		call, err := db.scanToolCall(rows)
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, *call)
+	}
+	return calls, rows.Err()
+}
+
+func (db *DB) scanToolCall(row interface{ Scan(...any) error }) (*ToolCall, error) {
+	var call ToolCall
+	var created int64
+	var args, resp []byte
+	if err := row.Scan(&call.ID, &created, &call.Client, &call.Tool, &args, &resp, &call.IsError, &call.DurationMS); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("scan tool call: %w", err)
+	}
+	call.Time = time.Unix(created, 0)
+	var err error
+	if call.Arguments, err = db.cipher.openBytes(args); err != nil {
+		return nil, fmt.Errorf("decrypt tool call %d: %w", call.ID, err)
+	}
+	if call.Response, err = db.cipher.openBytes(resp); err != nil {
+		return nil, fmt.Errorf("decrypt tool call %d: %w", call.ID, err)
+	}
+	return &call, nil
+}
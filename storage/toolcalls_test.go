@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestToolCallLog(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+
+	var ids []int64
+	for _, tool := range []string{"a", "b", "c", "d", "e"} {
+		call := &ToolCall{
+			Client:    "client-1",
+			Tool:      tool,
+			Arguments: json.RawMessage(`{"query":"x"}`),
+			Response:  json.RawMessage(`{"content":[]}`),
+			IsError:   tool == "e",
+		}
+		if err := db.RecordToolCall(ctx, call, 3); err != nil {
+			t.Fatalf("RecordToolCall: %v", err)
+		}
+		ids = append(ids, call.ID)
+	}
+
+	calls, err := db.ListToolCalls(ctx, 10)
+	if err != nil {
+		t.Fatalf("ListToolCalls: %v", err)
+	}
+	if len(calls) != 3 || calls[0].Tool != "e" || calls[2].Tool != "c" {
+		t.Fatalf("calls = %+v, want e, d, c", calls)
+	}
+	if !calls[0].IsError || calls[0].Client != "client-1" || string(calls[0].Arguments) != `{"query":"x"}` {
+		t.Errorf("call = %+v", calls[0])
+	}
+
+	if _, err := db.GetToolCall(ctx, ids[0]); err != ErrToolCallNotFound {
+		t.Errorf("GetToolCall(pruned) err = %v, want ErrToolCallNotFound", err)
+	}
+	call, err := db.GetToolCall(ctx, ids[3])
+	if err != nil || call.Tool != "d" {
+		t.Errorf("GetToolCall = %+v, %v", call, err)
+	}
+}
+
+func TestToolCallLogEncrypted(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	plain := &ToolCall{Tool: "search", Arguments: json.RawMessage(`{"query":"before"}`), Response: json.RawMessage(`{}`)}
+	if err := db.RecordToolCall(ctx, plain, 10); err != nil {
+		t.Fatalf("RecordToolCall: %v", err)
+	}
+	if err := db.SetEncryptionKey(testKey); err != nil {
+		t.Fatalf("SetEncryptionKey: %v", err)
+	}
+	secret := &ToolCall{Tool: "search", Arguments: json.RawMessage(`{"query":"secret"}`), Response: json.RawMessage(`{}`)}
+	if err := db.RecordToolCall(ctx, secret, 10); err != nil {
+		t.Fatalf("RecordToolCall: %v", err)
+	}
+	if _, err := db.EncryptAll(ctx, nil); err != nil {
+		t.Fatalf("EncryptAll: %v", err)
+	}
+
+	rows, err := db.conn.Query(`SELECT arguments FROM tool_calls`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var raw []byte
+		rows.Scan(&raw)
+		if !bytes.HasPrefix(raw, []byte(encPrefix)) {
+			t.Errorf("stored arguments not encrypted: %s", raw)
+		}
+	}
+
+	calls, err := db.ListToolCalls(ctx, 10)
+	if err != nil || len(calls) != 2 {
+		t.Fatalf("ListToolCalls = %v, %v", calls, err)
+	}
+	if string(calls[0].Arguments) != `{"query":"secret"}` || string(calls[1].Arguments) != `{"query":"before"}` {
+		t.Errorf("decrypted arguments = %s, %s", calls[0].Arguments, calls[1].Arguments)
+	}
+}
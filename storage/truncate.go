@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Preview lengths (in characters) used when returning truncated content.
+const (
+	SearchPreviewLength   = 80
+	SemanticPreviewLength = 200
+)
+
+// Truncate shortens markdown content to at most maxChars characters (plus a
+// trailing "..."), choosing a cut point that keeps the markdown well-formed:
+// section and paragraph boundaries are preferred, and the cut never lands
+// inside a code fence, a link, or a table. Reports whether content was cut.
+func Truncate(content string, maxChars int) (string, bool) {
+	if maxChars <= 0 || utf8.RuneCountInString(content) <= maxChars {
+		return content, false
+	}
+
+	limit := byteOffset(content, maxChars)
+	cut := chooseCut(content, limit)
+	cut = avoidCodeFence(content, cut)
+	cut = avoidTable(content, cut)
+	cut = avoidLink(content, cut)
+
+	if cut > 0 {
+		return strings.TrimRight(content[:cut], " \t\n") + "...", true
+	}
+
+	// The structure starts at the very beginning: fall back to the hard
+	// limit, closing a code fence if we are inside one.
+	out := content[:limit] + "..."
+	if avoidCodeFence(content, limit) != limit {
+		out += "\n```"
+	}
+	return out, true
+}
+
+// byteOffset returns the byte offset of the n-th rune in s.
+func byteOffset(s string, n int) int {
+	i := 0
+	for pos := range s {
+		if i == n {
+			return pos
+		}
+		i++
+	}
+	return len(s)
+}
+
+// chooseCut picks the best boundary at or before limit.
+// Order of preference: heading, blank line, line break, word break.
+// Structural boundaries are only used if they keep at least half the budget.
+func chooseCut(s string, limit int) int {
+	head := s[:limit]
+	floor := limit / 2
+
+	if i := strings.LastIndex(head, "\n#"); i >= floor {
+		return i
+	}
+	if i := strings.LastIndex(head, "\n\n"); i >= floor {
+		return i
+	}
+	if i := strings.LastIndex(head, "\n"); i >= floor {
+		return i
+	}
+	if i := strings.LastIndexAny(head, " \t"); i > 0 {
+		return i
+	}
+	return limit
+}
+
+// avoidCodeFence moves the cut before an unclosed ``` fence.
+func avoidCodeFence(s string, cut int) int {
+	open := -1
+	pos := 0
+	for _, line := range strings.SplitAfter(s[:cut], "\n") {
+		if strings.HasPrefix(strings.TrimLeft(line, " "), "```") {
+			if open == -1 {
+				open = pos
+			} else {
+				open = -1
+			}
+		}
+		pos += len(line)
+	}
+	if open == -1 {
+		return cut
+	}
+	return open
+}
+
+// avoidTable moves the cut before a table if it would split one.
+func avoidTable(s string, cut int) int {
+	lineStart := strings.LastIndex(s[:cut], "\n") + 1
+	if !isTableRow(lineAt(s, lineStart)) {
+		return cut
+	}
+	// Walk back to the first row of the table
+	start := lineStart
+	for start > 0 {
+		prev := strings.LastIndex(s[:start-1], "\n") + 1
+		if !isTableRow(lineAt(s, prev)) {
+			break
+		}
+		start = prev
+	}
+	return start
+}
+
+// avoidLink moves the cut before a [text](url) construct it would split.
+func avoidLink(s string, cut int) int {
+	lineStart := strings.LastIndex(s[:cut], "\n") + 1
+	line := s[lineStart:cut]
+	open := strings.LastIndex(line, "[")
+	if open == -1 {
+		return cut
+	}
+	rest := line[open:]
+	closeBracket := strings.Index(rest, "]")
+	if closeBracket == -1 {
+		return lineStart + open
+	}
+	if strings.HasPrefix(rest[closeBracket+1:], "(") && !strings.Contains(rest[closeBracket:], ")") {
+		return lineStart + open
+	}
+	return cut
+}
+
+func lineAt(s string, start int) string {
+	if end := strings.IndexByte(s[start:], '\n'); end != -1 {
+		return s[start : start+end]
+	}
+	return s[start:]
+}
+
+func isTableRow(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "|")
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTruncateShortContent(t *testing.T) {
+	got, truncated := Truncate("short", 80)
+	if got != "short" || truncated {
+		t.Errorf("Truncate = %q, %v; want unchanged", got, truncated)
+	}
+}
+
+func TestTruncatePrefersParagraphBoundary(t *testing.T) {
+	content := "First paragraph with some words.\n\nSecond paragraph that runs past the limit by a lot."
+	got, truncated := Truncate(content, 60)
+	if !truncated {
+		t.Fatal("Expected truncated")
+	}
+	if got != "First paragraph with some words...." {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestTruncatePrefersHeading(t *testing.T) {
+	content := "# Title\nIntro text here.\n## Section\nLots of section body text follows here."
+	got, _ := Truncate(content, 45)
+	if got != "# Title\nIntro text here...." {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestTruncateAvoidsCodeFence(t *testing.T) {
+	content := "Some intro text before code.\n```go\nfunc main() {\n\tprintln(\"hello\")\n}\n```\n"
+	got, _ := Truncate(content, 50)
+	if strings.Contains(got, "```") {
+		t.Errorf("cut inside code fence: %q", got)
+	}
+	if !strings.HasPrefix(got, "Some intro text before code") {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestTruncateClosesFenceAtStart(t *testing.T) {
+	content := "```\n" + strings.Repeat("x", 100) + "\n```"
+	got, truncated := Truncate(content, 20)
+	if !truncated {
+		t.Fatal("Expected truncated")
+	}
+	if strings.Count(got, "```") != 2 {
+		t.Errorf("fence not closed: %q", got)
+	}
+}
+
+func TestTruncateAvoidsLink(t *testing.T) {
+	content := "See the docs at [the reference guide](https://example.com/a/very/long/path) for details."
+	got, _ := Truncate(content, 50)
+	if strings.Contains(got, "[") {
+		t.Errorf("cut inside link: %q", got)
+	}
+}
+
+func TestTruncateAvoidsTable(t *testing.T) {
+	content := "Intro line for the table below.\n| a | b |\n|---|---|\n| 1 | 2 |\n| 3 | 4 |\n"
+	got, _ := Truncate(content, 50)
+	if strings.Contains(got, "|") {
+		t.Errorf("cut inside table: %q", got)
+	}
+}
+
+func TestTruncateMultibyte(t *testing.T) {
+	content := strings.Repeat("й", 100)
+	got, truncated := Truncate(content, 10)
+	if !truncated {
+		t.Fatal("Expected truncated")
+	}
+	if got != strings.Repeat("й", 10)+"..." {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestSearchChunksTruncatedFlag(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+
+	db.CreateChunk(ctx, "needle "+strings.Repeat("word ", 40), nil)
+	db.CreateChunk(ctx, "needle short", nil)
+
+	results, err := db.SearchChunks(ctx, "needle", 10)
+	if err != nil {
+		t.Fatalf("SearchChunks: %v", err)
+	}
+
+	var long, short int
+	for _, r := range results {
+		if r.Truncated {
+			long++
+		} else {
+			short++
+		}
+	}
+	if long != 1 || short != 1 {
+		t.Errorf("truncated=%d untruncated=%d, want 1 and 1", long, short)
+	}
+}
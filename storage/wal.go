@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Path returns the database file path; the write-ahead log is Path()+"-wal".
+// It is empty for a database in memory.
+func (db *DB) Path() string {
+	return db.path
+}
+
+// ReadLock is a read transaction held open on a dedicated connection.
+// While it is held, SQLite cannot restart the write-ahead log, so frames
+// appended to it stay in place until the lock is released.
+type ReadLock struct {
+	conn *sql.Conn
+	tx   *sql.Tx
+}
+
+// AcquireReadLock starts a read transaction that pins the current WAL.
+func (db *DB) AcquireReadLock(ctx context.Context) (*ReadLock, error) {
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("begin read lock: %w", err)
+	}
+	// A transaction only takes its snapshot on first read
+	var n int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM migrations").Scan(&n); err != nil {
+		tx.Rollback()
+		conn.Close()
+		return nil, fmt.Errorf("acquire read lock: %w", err)
+	}
+	return &ReadLock{conn: conn, tx: tx}, nil
+}
+
+// Release ends the read transaction.
+func (l *ReadLock) Release() error {
+	err := l.tx.Rollback()
+	l.conn.Close()
+	return err
+}
+
+// Checkpoint copies WAL frames into the database file. mode is PASSIVE,
+// FULL, RESTART or TRUNCATE. It reports false if readers or writers kept
+// the checkpoint from completing.
+func (db *DB) Checkpoint(ctx context.Context, mode string) (bool, error) {
+	switch mode {
+	case "PASSIVE", "FULL", "RESTART", "TRUNCATE":
+	default:
+		return false, fmt.Errorf("unknown checkpoint mode %q", mode)
+	}
+	var busy, logFrames, checkpointed int
+	if err := db.conn.QueryRowContext(ctx, "PRAGMA wal_checkpoint("+mode+")").Scan(&busy, &logFrames, &checkpointed); err != nil {
+		return false, fmt.Errorf("checkpoint: %w", err)
+	}
+	return busy == 0, nil
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Writers are serialized by SQLite itself: transactions begin IMMEDIATE
+// (_txlock in the DSN), taking the write lock up front and waiting
+// busy_timeout for it. A deferred transaction that read before writing
+// would instead fail with SQLITE_BUSY at once when another connection
+// wrote meanwhile, since waiting could not help it. Once a transaction
+// holds the lock nothing else in it can be busy in WAL mode, so only
+// beginning one is retried.
+
+// busyRetries is how often beginning a write transaction is retried after
+// busy_timeout ran out, pausing busyPause, doubled each time, in between.
+const (
+	busyRetries = 3
+	busyPause   = 100 * time.Millisecond
+)
+
+// isBusy reports whether err is SQLite finding the database locked by
+// another connection.
+func isBusy(err error) bool {
+	var e *sqlite.Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	code := e.Code() & 0xff // extended codes keep the primary in the low byte
+	return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+}
+
+// retryBusy calls fn until it succeeds, fails other than busy, busyRetries
+// have been made or ctx is done.
+func retryBusy(ctx context.Context, fn func() error) error {
+	pause := busyPause
+	for i := 0; ; i++ {
+		err := fn()
+		if err == nil || i == busyRetries || !isBusy(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(pause):
+		}
+		pause *= 2
+	}
+}
+
+// beginWrite starts a write transaction, retrying while another writer
+// holds the database.
+func (db *DB) beginWrite(ctx context.Context) (*sql.Tx, error) {
+	var tx *sql.Tx
+	err := retryBusy(ctx, func() error {
+		var err error
+		tx, err = db.conn.BeginTx(ctx, nil)
+		return err
+	})
+	return tx, err
+}
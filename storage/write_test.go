@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentWriters(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	chunk, err := db.CreateChunk(ctx, "shared", nil)
+	if err != nil {
+		t.Fatalf("CreateChunk: %v", err)
+	}
+
+	// Each transaction reads before it writes, which a deferred transaction
+	// could not wait to do while another connection writes
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 8; i++ {
+				name := fmt.Sprintf("Writer %d-%d", w, i)
+				if err := db.SetChunkEntities(ctx, chunk.ID, []Entity{{EntityPerson, name}}); err != nil {
+					errs <- fmt.Errorf("SetChunkEntities: %w", err)
+					return
+				}
+				tx, err := db.BeginTx(ctx)
+				if err != nil {
+					errs <- fmt.Errorf("BeginTx: %w", err)
+					return
+				}
+				if _, err := tx.CreateChunk(ctx, name, nil); err != nil {
+					tx.Rollback()
+					errs <- fmt.Errorf("CreateChunk: %w", err)
+					return
+				}
+				if err := tx.Commit(); err != nil {
+					errs <- fmt.Errorf("Commit: %w", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	n, err := db.CountChunks(ctx)
+	if err != nil {
+		t.Fatalf("CountChunks: %v", err)
+	}
+	if n != 1+8*8 {
+		t.Errorf("chunks = %d, want %d", n, 1+8*8)
+	}
+}
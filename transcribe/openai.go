@@ -0,0 +1,48 @@
+package transcribe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// OpenAITranscriber implements Transcriber with the OpenAI audio
+// transcriptions API.
+type OpenAITranscriber struct {
+	apiKey   string
+	model    string
+	url      string
+	language string
+}
+
+// NewOpenAITranscriber creates a transcriber for the API at baseURL.
+func NewOpenAITranscriber(apiKey, model, baseURL, language string) *OpenAITranscriber {
+	return &OpenAITranscriber{
+		apiKey:   apiKey,
+		model:    model,
+		url:      strings.TrimRight(baseURL, "/") + "/audio/transcriptions",
+		language: language,
+	}
+}
+
+func (t *OpenAITranscriber) Transcribe(ctx context.Context, name string, audio []byte) (string, error) {
+	var body bytes.Buffer
+	fields := map[string]string{"model": t.model, "response_format": "json"}
+	if t.language != "" {
+		fields["language"] = t.language
+	}
+	contentType, err := writeForm(&body, name, audio, fields)
+	if err != nil {
+		return "", err
+	}
+	text, err := post(ctx, t.url, contentType, &body, map[string]string{"Authorization": "Bearer " + t.apiKey})
+	if err != nil {
+		return "", fmt.Errorf("openai: %w", err)
+	}
+	return text, nil
+}
+
+func (t *OpenAITranscriber) Model() string {
+	return "openai/" + t.model
+}
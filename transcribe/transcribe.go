@@ -0,0 +1,162 @@
+// Package transcribe turns audio recordings into text with a speech
+// recognition model, such as OpenAI's Whisper API or a local whisper.cpp
+// server.
+package transcribe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Transcriber converts speech to text.
+type Transcriber interface {
+	// Transcribe returns the text spoken in audio; name is the file name,
+	// whose extension tells the format.
+	Transcribe(ctx context.Context, name string, audio []byte) (string, error)
+	// Model returns the model identifier.
+	Model() string
+}
+
+// DefaultTimeout bounds one transcription when not configured.
+const DefaultTimeout = 10 * time.Minute
+
+// Config holds transcription settings.
+type Config struct {
+	// Provider is "openai" (the audio transcriptions API, or a compatible
+	// server at openai.base_url) or "whispercpp" (a whisper.cpp server);
+	// empty disables audio ingestion.
+	Provider string `toml:"provider"`
+	// Language is the ISO-639-1 code of the spoken language; empty lets
+	// the model detect it.
+	Language string `toml:"language"`
+	// TimeoutSeconds bounds each transcription (default 600).
+	TimeoutSeconds int `toml:"timeout_seconds"`
+
+	OpenAI     OpenAIConfig     `toml:"openai"`
+	WhisperCPP WhisperCPPConfig `toml:"whispercpp"`
+}
+
+// OpenAIConfig holds OpenAI transcription settings.
+type OpenAIConfig struct {
+	APIKey string `toml:"api_key"`
+	// Model defaults to whisper-1.
+	Model string `toml:"model"`
+	// BaseURL defaults to https://api.openai.com/v1.
+	BaseURL string `toml:"base_url"`
+}
+
+// WhisperCPPConfig holds settings for a whisper.cpp server.
+type WhisperCPPConfig struct {
+	// URL is the server root, under which /inference is requested.
+	URL string `toml:"url"`
+}
+
+// Validate checks the transcription settings.
+func (c Config) Validate() error {
+	switch c.Provider {
+	case "":
+	case "openai":
+		if c.OpenAI.APIKey == "" {
+			return fmt.Errorf("openai.api_key not set")
+		}
+	case "whispercpp":
+		if c.WhisperCPP.URL == "" {
+			return fmt.Errorf("whispercpp.url not set")
+		}
+	default:
+		return fmt.Errorf("unknown provider %q: expected openai or whispercpp", c.Provider)
+	}
+	if c.TimeoutSeconds < 0 {
+		return fmt.Errorf("timeout_seconds must not be negative")
+	}
+	return nil
+}
+
+// Timeout returns the timeout for one transcription.
+func (c Config) Timeout() time.Duration {
+	if c.TimeoutSeconds > 0 {
+		return time.Duration(c.TimeoutSeconds) * time.Second
+	}
+	return DefaultTimeout
+}
+
+// New creates the configured Transcriber, or returns nil if none is.
+func New(cfg Config) (Transcriber, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	switch cfg.Provider {
+	case "openai":
+		model := cfg.OpenAI.Model
+		if model == "" {
+			model = "whisper-1"
+		}
+		baseURL := cfg.OpenAI.BaseURL
+		if baseURL == "" {
+			baseURL = "https://api.openai.com/v1"
+		}
+		return NewOpenAITranscriber(cfg.OpenAI.APIKey, model, baseURL, cfg.Language), nil
+	case "whispercpp":
+		return NewWhisperCPPTranscriber(cfg.WhisperCPP.URL, cfg.Language), nil
+	}
+	return nil, nil
+}
+
+// writeForm writes audio as the multipart file field both APIs expect,
+// followed by fields, returning the form's content type.
+func writeForm(w io.Writer, name string, audio []byte, fields map[string]string) (string, error) {
+	mw := multipart.NewWriter(w)
+	part, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		return "", fmt.Errorf("create form: %w", err)
+	}
+	if _, err := part.Write(audio); err != nil {
+		return "", fmt.Errorf("create form: %w", err)
+	}
+	for k, v := range fields {
+		if err := mw.WriteField(k, v); err != nil {
+			return "", fmt.Errorf("create form: %w", err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return "", fmt.Errorf("create form: %w", err)
+	}
+	return mw.FormDataContentType(), nil
+}
+
+// post sends a transcription request and returns the text of the JSON
+// response. The context bounds it; recordings can take minutes.
+func post(ctx context.Context, url, contentType string, body io.Reader, headers map[string]string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("decode response: %w", err)
+	}
+	return strings.TrimSpace(result.Text), nil
+}
@@ -0,0 +1,82 @@
+package transcribe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAITranscribe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/audio/transcriptions" {
+			t.Errorf("Path = %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("Authorization = %q", got)
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			t.Fatalf("FormFile: %v", err)
+		}
+		file.Close()
+		if header.Filename != "memo.m4a" || r.FormValue("model") != "whisper-1" || r.FormValue("language") != "de" {
+			t.Errorf("form = %s %v", header.Filename, r.Form)
+		}
+		w.Write([]byte(`{"text":" Guten Morgen. "}`))
+	}))
+	defer server.Close()
+
+	text, err := NewOpenAITranscriber("test-key", "whisper-1", server.URL+"/v1/", "de").Transcribe(context.Background(), "memo.m4a", []byte("audio"))
+	if err != nil {
+		t.Fatalf("Transcribe: %v", err)
+	}
+	if text != "Guten Morgen." {
+		t.Errorf("text = %q", text)
+	}
+}
+
+func TestWhisperCPPTranscribe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/inference" {
+			t.Errorf("Path = %s, want /inference", r.URL.Path)
+		}
+		if r.FormValue("response_format") != "json" {
+			t.Errorf("response_format = %q", r.FormValue("response_format"))
+		}
+		if r.FormValue("language") == "fail" {
+			http.Error(w, "model not loaded", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"text":"hello world"}`))
+	}))
+	defer server.Close()
+
+	text, err := NewWhisperCPPTranscriber(server.URL+"/", "").Transcribe(context.Background(), "a.wav", []byte("RIFF"))
+	if err != nil || text != "hello world" {
+		t.Errorf("Transcribe = %q, %v", text, err)
+	}
+	if _, err := NewWhisperCPPTranscriber(server.URL, "fail").Transcribe(context.Background(), "a.wav", nil); err == nil {
+		t.Error("server error not returned")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		cfg Config
+		ok  bool
+	}{
+		{Config{}, true},
+		{Config{Provider: "openai", OpenAI: OpenAIConfig{APIKey: "k"}}, true},
+		{Config{Provider: "openai"}, false},
+		{Config{Provider: "whispercpp", WhisperCPP: WhisperCPPConfig{URL: "http://localhost:8080"}}, true},
+		{Config{Provider: "whispercpp"}, false},
+		{Config{Provider: "vosk"}, false},
+		{Config{TimeoutSeconds: -1}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); (err == nil) != tt.ok {
+			t.Errorf("Validate(%+v) = %v", tt.cfg, err)
+		}
+	}
+}
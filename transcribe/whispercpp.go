@@ -0,0 +1,41 @@
+package transcribe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// WhisperCPPTranscriber implements Transcriber with the /inference
+// endpoint of a whisper.cpp server, for models run locally.
+type WhisperCPPTranscriber struct {
+	url      string
+	language string
+}
+
+// NewWhisperCPPTranscriber creates a transcriber for the server at url.
+func NewWhisperCPPTranscriber(url, language string) *WhisperCPPTranscriber {
+	return &WhisperCPPTranscriber{url: strings.TrimRight(url, "/"), language: language}
+}
+
+func (t *WhisperCPPTranscriber) Transcribe(ctx context.Context, name string, audio []byte) (string, error) {
+	var body bytes.Buffer
+	fields := map[string]string{"response_format": "json"}
+	if t.language != "" {
+		fields["language"] = t.language
+	}
+	contentType, err := writeForm(&body, name, audio, fields)
+	if err != nil {
+		return "", err
+	}
+	text, err := post(ctx, t.url+"/inference", contentType, &body, nil)
+	if err != nil {
+		return "", fmt.Errorf("whisper.cpp: %w", err)
+	}
+	return text, nil
+}
+
+func (t *WhisperCPPTranscriber) Model() string {
+	return "whispercpp/" + t.url
+}
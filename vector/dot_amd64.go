@@ -0,0 +1,17 @@
+package vector
+
+// dotSSE sums a[i]*b[i] for i < n, four lanes at a time; SSE is part of
+// the amd64 baseline, so it needs no CPU feature check.
+//
+//go:noescape
+func dotSSE(a, b *float32, n int) float32
+
+// dot returns the dot product of a and b, which must be at least as long
+// as a.
+func dot(a, b []float32) float32 {
+	if len(a) == 0 {
+		return 0
+	}
+	_ = b[len(a)-1]
+	return dotSSE(&a[0], &b[0], len(a))
+}
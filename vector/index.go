@@ -3,91 +3,407 @@ package vector
 import (
 	"log"
 	"math"
-	"sort"
+	"runtime"
+	"slices"
 	"sync"
+	"time"
 )
 
+// normalizeBatch is how many loaded vectors the background pass normalizes
+// per write lock, keeping searches responsive while it runs.
+const normalizeBatch = 1024
+
 // Result represents a search result with chunk ID and similarity score.
+// Scores are cosine similarities mapped to [0, 1]: 1 for the same
+// direction, 0.5 for unrelated (orthogonal) vectors, 0 for opposite ones.
 type Result struct {
 	ID    string  `json:"id"`
 	Score float32 `json:"score"`
 }
 
-// Index is an in-memory vector index with brute-force search.
+// entry is an indexed vector. Once unit is set the vector has been scaled
+// to length 1, so its cosine with a normalized query is a dot product.
+// asOf is when, in Unix seconds, vec was known to match its stored
+// embedding, so a snapshot can tell which vectors are still current.
+//
+// In a quantized index a unit vector is kept only as codes (int8, times
+// scale) or as the sign bits of its n components.
+type entry struct {
+	vec  []float32
+	unit bool
+	asOf int64
+
+	codes []int8
+	scale float32
+	bits  []uint64
+	n     int
+}
+
+func (e entry) dim() int {
+	switch {
+	case e.codes != nil:
+		return len(e.codes)
+	case e.bits != nil:
+		return e.n
+	default:
+		return len(e.vec)
+	}
+}
+
+// Index is an in-memory vector index with brute-force search, sharded so
+// that large indexes are searched on all cores.
 type Index struct {
-	mu   sync.RWMutex
-	vecs map[string][]float32
+	mu     sync.RWMutex
+	vecs   shards
+	shards int // len(vecs), fixed at NewIndex
+	// gen counts Loads, so a normalization pass stops once its vectors
+	// have been replaced
+	gen int
+	// normalized is closed when the last Load's vectors are all normalized.
+	normalized chan struct{}
+
+	quant      string       // Config.Quantization
+	oversample int          // candidates rescored per result when quantized
+	exact      VectorSource // exact vectors for rescoring; nil to skip it
 }
 
 // NewIndex creates a new empty vector index.
 func NewIndex() *Index {
+	return NewIndexWithConfig(Config{}, nil)
+}
+
+// NewIndexWithConfig creates a new empty vector index with custom
+// settings. A quantized index rescores search candidates with the vectors
+// from exact.
+func NewIndexWithConfig(cfg Config, exact VectorSource) *Index {
+	done := make(chan struct{})
+	close(done)
+	n := runtime.GOMAXPROCS(0)
 	return &Index{
-		vecs: make(map[string][]float32),
+		vecs:       newShards(n),
+		shards:     n,
+		normalized: done,
+		quant:      cfg.Quantization,
+		oversample: cfg.oversample(),
+		exact:      exact,
 	}
 }
 
-// Load loads vectors from a map into the index.
+// Load loads vectors from a map into the index, which takes ownership of
+// them. They are searchable at once, and normalized in the background;
+// until then they are scored with a full cosine.
 func (idx *Index) Load(vecs map[string][]float32) {
+	idx.LoadAt(vecs, time.Time{})
+}
+
+// LoadAt is Load for vectors read from storage no earlier than asOf.
+func (idx *Index) LoadAt(vecs map[string][]float32, asOf time.Time) {
+	var at int64
+	if !asOf.IsZero() {
+		at = asOf.Unix()
+	}
+	entries := newShards(idx.shards)
+	ids := make([]string, 0, len(vecs))
+	for id, vec := range vecs {
+		entries.set(id, entry{vec: vec, asOf: at})
+		ids = append(ids, id)
+	}
+	idx.replace(entries, ids)
+}
+
+// replace swaps in entries and normalizes those listed in ids.
+func (idx *Index) replace(entries shards, ids []string) {
 	idx.mu.Lock()
-	defer idx.mu.Unlock()
-	idx.vecs = vecs
+	idx.vecs = entries
+	idx.gen++
+	gen := idx.gen
+	done := make(chan struct{})
+	idx.normalized = done
+	idx.mu.Unlock()
+
+	go idx.normalizeLoaded(gen, ids, done)
+}
+
+// normalizeLoaded replaces loaded vectors with unit copies, quantized if
+// configured, batch by batch. Vectors added or removed meanwhile are left
+// alone.
+func (idx *Index) normalizeLoaded(gen int, ids []string, done chan struct{}) {
+	defer close(done)
+	units := make([]entry, 0, normalizeBatch)
+	for start := 0; start < len(ids); start += normalizeBatch {
+		batch := ids[start:min(start+normalizeBatch, len(ids))]
+
+		// Loaded vectors are never modified, only replaced, so they can be
+		// read without the lock once fetched
+		idx.mu.RLock()
+		if idx.gen != gen {
+			idx.mu.RUnlock()
+			return
+		}
+		units = units[:0]
+		for _, id := range batch {
+			e, _ := idx.vecs.get(id)
+			units = append(units, e)
+		}
+		idx.mu.RUnlock()
+		for i, e := range units {
+			units[i] = idx.unitEntry(normalize(e.vec), e.asOf)
+		}
+
+		idx.mu.Lock()
+		if idx.gen != gen {
+			idx.mu.Unlock()
+			return
+		}
+		for i, id := range batch {
+			if e, ok := idx.vecs.get(id); ok && !e.unit {
+				idx.vecs.set(id, units[i])
+			}
+		}
+		idx.mu.Unlock()
+	}
 }
 
 // Add adds or updates a vector in the index.
 func (idx *Index) Add(id string, vec []float32) {
+	e := idx.unitEntry(normalize(vec), time.Now().Unix())
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
-	idx.vecs[id] = vec
+	idx.vecs.set(id, e)
 }
 
 // Remove removes a vector from the index.
 func (idx *Index) Remove(id string) {
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
-	delete(idx.vecs, id)
+	idx.vecs.del(id)
 }
 
 // Size returns the number of vectors in the index.
 func (idx *Index) Size() int {
 	idx.mu.RLock()
 	defer idx.mu.RUnlock()
-	return len(idx.vecs)
+	return idx.vecs.len()
+}
+
+// Search finds the k most similar vectors to the query, leaving out those
+// scoring below minScore. Large indexes are scored shard by shard in
+// parallel, each keeping its own top k; quantized ones rescore their best
+// candidates exactly, and only then apply minScore.
+func (idx *Index) Search(query []float32, k int, minScore float32) []Result {
+	if k <= 0 {
+		return nil
+	}
+	if idx.quant == "" {
+		return idx.search(query, k, minScore)
+	}
+	return idx.rescore(query, idx.search(query, k*idx.oversample, 0), k, minScore)
 }
 
-// Search finds the k most similar vectors to the query.
-func (idx *Index) Search(query []float32, k int) []Result {
+func (idx *Index) search(query []float32, k int, minScore float32) []Result {
 	idx.mu.RLock()
 	defer idx.mu.RUnlock()
 
-	if len(idx.vecs) == 0 || k <= 0 {
+	n := idx.vecs.len()
+	if n == 0 {
 		return nil
 	}
+	q := idx.newQuery(query, minScore)
+	defer q.release()
+	top := newTopK(k, n)
+	if n < parallelMin || len(idx.vecs) == 1 {
+		skipped := 0
+		for _, shard := range idx.vecs {
+			skipped += q.scan(shard, top)
+		}
+		return q.results(top, skipped)
+	}
+
+	tops := make([]*topK, len(idx.vecs))
+	skipped := make([]int, len(idx.vecs))
+	var wg sync.WaitGroup
+	for i, shard := range idx.vecs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tops[i] = pooledTopK(k, len(shard))
+			skipped[i] = q.scan(shard, tops[i])
+		}()
+	}
+	wg.Wait()
+	total := 0
+	for i := range tops {
+		top.merge(tops[i])
+		tops[i].release()
+		total += skipped[i]
+	}
+	return q.results(top, total)
+}
 
-	queryDim := len(query)
+// SearchWithin finds the k most similar vectors to the query among ids,
+// such as the chunks matching a metadata filter. Only the candidates are
+// scored; ids without a vector are ignored. minScore applies as in Search.
+func (idx *Index) SearchWithin(query []float32, ids []string, k int, minScore float32) []Result {
+	if len(ids) == 0 || k <= 0 {
+		return nil
+	}
+	if idx.quant == "" {
+		return idx.searchWithin(query, ids, k, minScore)
+	}
+	return idx.rescore(query, idx.searchWithin(query, ids, k*idx.oversample, 0), k, minScore)
+}
+
+func (idx *Index) searchWithin(query []float32, ids []string, k int, minScore float32) []Result {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	q := idx.newQuery(query, minScore)
+	defer q.release()
+	top := newTopK(k, len(ids))
+	seen := make(map[string]bool, len(ids))
 	skipped := 0
+	for _, id := range ids {
+		e, ok := idx.vecs.get(id)
+		if !ok || seen[id] {
+			continue
+		}
+		seen[id] = true
+		if !q.score(top, id, e) {
+			skipped++
+		}
+	}
+	return q.results(top, skipped)
+}
+
+// SearchByID finds the k vectors most similar to the one indexed for id,
+// leaving out id itself, as a search for "more like this" that needs no
+// query embedding. It reports false if id has no vector. Quantized vectors
+// are searched with their exact vector if the VectorSource has it.
+func (idx *Index) SearchByID(id string, k int, minScore float32) ([]Result, bool) {
+	vec := idx.unitVectors([]Result{{ID: id}})[0]
+	if vec == nil {
+		return nil, false
+	}
+	results := idx.Search(vec, k+1, minScore)
+	for i, r := range results {
+		if r.ID == id {
+			return slices.Delete(results, i, i+1), true
+		}
+	}
+	return results[:min(len(results), k)], true
+}
+
+// query is a search vector, with its unit copy for scoring normalized
+// entries, quantized like the index's. It is only read while scoring, so
+// shards can share it.
+type query struct {
+	vec, unit []float32
+	min       float32 // the minimum score as a cosine
+	codes     []int8
+	scale     float32
+	bits      []uint64
+	buf       *[]float32 // unit's pooled buffer
+}
+
+// release returns the query's buffer to the pool once it is done scoring.
+func (q *query) release() {
+	queryUnits.Put(q.buf)
+}
+
+// queryUnits recycles the unit copies of search vectors.
+var queryUnits sync.Pool
+
+func (idx *Index) newQuery(vec []float32, minScore float32) *query {
+	unit, _ := queryUnits.Get().(*[]float32)
+	if unit == nil || cap(*unit) < len(vec) {
+		unit = new([]float32)
+		*unit = make([]float32, len(vec))
+	}
+	*unit = normalizeInto((*unit)[:len(vec)], vec)
+
+	// Candidates are ranked by cosine, mapped to scores only at the end so
+	// that scores near 1 keep their order
+	q := &query{vec: vec, unit: *unit, buf: unit, min: 2*minScore - 1}
+	switch idx.quant {
+	case QuantizeInt8:
+		q.codes, q.scale = quantizeInt8(q.unit)
+	case QuantizeBinary:
+		q.bits = signBits(q.unit)
+	}
+	return q
+}
 
-	results := make([]Result, 0, len(idx.vecs))
-	for id, vec := range idx.vecs {
-		if len(vec) != queryDim {
+// scan scores every entry of shard, returning how many were skipped for
+// a dimension mismatch.
+func (q *query) scan(shard map[string]entry, top *topK) (skipped int) {
+	for id, e := range shard {
+		if !q.score(top, id, e) {
 			skipped++
-			continue
 		}
-		score := cosineSimilarity(query, vec)
-		results = append(results, Result{ID: id, Score: score})
 	}
+	return skipped
+}
+
+// score offers the entry's similarity to the query to top, unless below
+// the minimum; it reports false, scoring nothing, when the entry's
+// dimension differs.
+func (q *query) score(top *topK, id string, e entry) bool {
+	if e.dim() != len(q.vec) {
+		return false
+	}
+	var s float32
+	switch {
+	case e.codes != nil:
+		s = float32(dotInt8(q.codes, e.codes)) * q.scale * e.scale
+	case e.bits != nil:
+		s = hammingScore(q.bits, e.bits, e.n)
+	case e.unit:
+		s = dot(q.unit, e.vec)
+	default:
+		s = cosineSimilarity(q.vec, e.vec)
+	}
+	if s >= q.min {
+		top.push(Result{ID: id, Score: s})
+	}
+	return true
+}
+
+// similarity maps a cosine to a Result score in [0, 1], clamping rounding
+// errors.
+func similarity(cos float32) float32 {
+	return min(max((cos+1)/2, 0), 1)
+}
 
+// results returns the best results with their scores, and warns about
+// skipped vectors.
+func (q *query) results(top *topK, skipped int) []Result {
 	if skipped > 0 {
-		log.Printf("WARNING: vector search skipped %d vectors with dimension mismatch (query=%d)", skipped, queryDim)
+		log.Printf("WARNING: vector search skipped %d vectors with dimension mismatch (query=%d)", skipped, len(q.vec))
+	}
+	results := top.sorted()
+	for i := range results {
+		results[i].Score = similarity(results[i].Score)
 	}
+	return results
+}
 
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].Score > results[j].Score
-	})
+// normalize returns a copy of v scaled to length 1; a zero vector stays
+// zero, so it scores 0 against everything as with cosineSimilarity.
+func normalize(v []float32) []float32 {
+	return normalizeInto(make([]float32, len(v)), v)
+}
 
-	if k > len(results) {
-		k = len(results)
+// normalizeInto is normalize writing into dst, of v's length.
+func normalizeInto(dst, v []float32) []float32 {
+	norm := float32(math.Sqrt(float64(dot(v, v))))
+	if norm == 0 {
+		clear(dst)
+		return dst
+	}
+	for i, x := range v {
+		dst[i] = x / norm
 	}
-	return results[:k]
+	return dst
 }
 
 // cosineSimilarity computes the cosine similarity between two vectors.
@@ -96,16 +412,16 @@ func cosineSimilarity(a, b []float32) float32 {
 		return 0
 	}
 
-	var dot, normA, normB float64
+	var d, normA, normB float32
 	for i := range a {
-		dot += float64(a[i]) * float64(b[i])
-		normA += float64(a[i]) * float64(a[i])
-		normB += float64(b[i]) * float64(b[i])
+		d += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
 	}
 
 	if normA == 0 || normB == 0 {
 		return 0
 	}
 
-	return float32(dot / (math.Sqrt(normA) * math.Sqrt(normB)))
+	return d / float32(math.Sqrt(float64(normA))*math.Sqrt(float64(normB)))
 }
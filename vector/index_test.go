@@ -1,8 +1,13 @@
 package vector
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"math"
+	"math/rand/v2"
 	"testing"
+	"time"
 )
 
 func TestNewIndex(t *testing.T) {
@@ -49,7 +54,7 @@ func TestLoad(t *testing.T) {
 
 func TestSearchEmpty(t *testing.T) {
 	idx := NewIndex()
-	results := idx.Search([]float32{1, 0, 0}, 10)
+	results := idx.Search([]float32{1, 0, 0}, 10, 0)
 
 	if len(results) != 0 {
 		t.Errorf("len(results) = %d, want 0", len(results))
@@ -62,7 +67,7 @@ func TestSearchFindsExactMatch(t *testing.T) {
 	idx.Add("b", []float32{0, 1, 0})
 	idx.Add("c", []float32{0, 0, 1})
 
-	results := idx.Search([]float32{1, 0, 0}, 1)
+	results := idx.Search([]float32{1, 0, 0}, 1, 0)
 
 	if len(results) != 1 {
 		t.Fatalf("len(results) = %d, want 1", len(results))
@@ -82,7 +87,7 @@ func TestSearchReturnsTopK(t *testing.T) {
 	idx.Add("c", []float32{0.8, 0.2, 0})
 	idx.Add("d", []float32{0, 1, 0})
 
-	results := idx.Search([]float32{1, 0, 0}, 2)
+	results := idx.Search([]float32{1, 0, 0}, 2, 0)
 
 	if len(results) != 2 {
 		t.Fatalf("len(results) = %d, want 2", len(results))
@@ -102,7 +107,7 @@ func TestSearchKLargerThanSize(t *testing.T) {
 	idx.Add("a", []float32{1, 0, 0})
 	idx.Add("b", []float32{0, 1, 0})
 
-	results := idx.Search([]float32{1, 0, 0}, 100)
+	results := idx.Search([]float32{1, 0, 0}, 100, 0)
 
 	if len(results) != 2 {
 		t.Errorf("len(results) = %d, want 2", len(results))
@@ -113,7 +118,7 @@ func TestSearchZeroK(t *testing.T) {
 	idx := NewIndex()
 	idx.Add("a", []float32{1, 0, 0})
 
-	results := idx.Search([]float32{1, 0, 0}, 0)
+	results := idx.Search([]float32{1, 0, 0}, 0, 0)
 
 	if results != nil {
 		t.Errorf("results = %v, want nil", results)
@@ -160,7 +165,7 @@ func TestSearchDimensionMismatch(t *testing.T) {
 	idx.Add("dim3b", []float32{0.9, 0.1, 0})  // 3 dimensions
 
 	// Search with 3-dim query should skip the 4-dim vector
-	results := idx.Search([]float32{1, 0, 0}, 10)
+	results := idx.Search([]float32{1, 0, 0}, 10, 0)
 
 	if len(results) != 2 {
 		t.Errorf("len(results) = %d, want 2 (should skip mismatched dimension)", len(results))
@@ -173,3 +178,315 @@ func TestSearchDimensionMismatch(t *testing.T) {
 		}
 	}
 }
+
+func TestSearchWithin(t *testing.T) {
+	idx := NewIndex()
+	idx.Add("a", []float32{1, 0, 0})
+	idx.Add("b", []float32{0.9, 0.1, 0})
+	idx.Add("c", []float32{0.8, 0.2, 0})
+	idx.Add("d", []float32{0, 1, 0})
+
+	// The best match overall is not a candidate
+	results := idx.SearchWithin([]float32{1, 0, 0}, []string{"d", "c", "missing", "c"}, 10, 0)
+
+	if len(results) != 2 {
+		t.Fatalf("len(results) = %d, want 2", len(results))
+	}
+	if results[0].ID != "c" || results[1].ID != "d" {
+		t.Errorf("results = %v, want c then d", results)
+	}
+	if got := idx.SearchWithin([]float32{1, 0, 0}, nil, 10, 0); got != nil {
+		t.Errorf("results without candidates = %v, want nil", got)
+	}
+}
+
+func TestSearchAllocations(t *testing.T) {
+	idx := NewIndex()
+	for i := range 2000 {
+		idx.Add(fmt.Sprintf("v%d", i), []float32{float32(i % 7), float32(i % 11), 1})
+	}
+	query := []float32{1, 2, 3}
+	idx.Search(query, 10, 0)
+
+	// Little more than the heap of results, however many vectors are scored
+	if n := testing.AllocsPerRun(100, func() { idx.Search(query, 10, 0) }); n > 3 {
+		t.Errorf("Search made %v allocations, want at most 3", n)
+	}
+}
+
+func TestSearchByID(t *testing.T) {
+	idx := NewIndex()
+	idx.Add("a", []float32{1, 0, 0})
+	idx.Add("b", []float32{0.9, 0.1, 0})
+	idx.Add("c", []float32{0.5, 0.5, 0})
+	idx.Add("d", []float32{0, 1, 0})
+
+	results, ok := idx.SearchByID("a", 2, 0)
+	if !ok {
+		t.Fatal("SearchByID: a not found")
+	}
+	if len(results) != 2 || results[0].ID != "b" || results[1].ID != "c" {
+		t.Errorf("results = %v, want b then c", results)
+	}
+	if _, ok := idx.SearchByID("missing", 2, 0); ok {
+		t.Error("SearchByID found a missing id")
+	}
+
+	// Quantized vectors are searched by their exact vector
+	q := NewIndexWithConfig(Config{Quantization: QuantizeBinary}, func(ids []string) (map[string][]float32, error) {
+		return map[string][]float32{"a": {1, 0, 0}}, nil
+	})
+	q.Add("a", []float32{1, 0, 0})
+	q.Add("b", []float32{0.9, 0.1, 0})
+	if results, ok := q.SearchByID("a", 5, 0); !ok || len(results) != 1 || results[0].ID != "b" {
+		t.Errorf("quantized results = %v, want b", results)
+	}
+}
+
+func TestLoadNormalizesInBackground(t *testing.T) {
+	idx := NewIndex()
+	vecs := make(map[string][]float32)
+	for i := 0; i < 3*normalizeBatch; i++ {
+		vecs[fmt.Sprintf("v%d", i)] = []float32{float32(i), 1, 0}
+	}
+	vecs["target"] = []float32{3, 0, 0}
+	idx.Load(vecs)
+
+	// Searches work while loaded vectors are normalized
+	if results := idx.Search([]float32{1, 0, 0}, 1, 0); results[0].ID != "target" {
+		t.Errorf("results[0] = %v, want target", results[0])
+	}
+	idx.Remove("target")
+	idx.Add("added", []float32{0, 0, 2})
+	<-idx.normalized
+
+	idx.mu.RLock()
+	for id, e := range idx.vecs.all() {
+		if !e.unit {
+			t.Errorf("%s not normalized", id)
+			break
+		}
+		if n := dot(e.vec, e.vec); math.Abs(float64(n-1)) > 1e-5 {
+			t.Errorf("%s has length %f", id, n)
+			break
+		}
+	}
+	_, removed := idx.vecs.get("target")
+	idx.mu.RUnlock()
+	if removed {
+		t.Error("normalization restored a removed vector")
+	}
+
+	results := idx.Search([]float32{0, 0, 5}, 1, 0)
+	if results[0].ID != "added" || math.Abs(float64(results[0].Score-1)) > 1e-5 {
+		t.Errorf("results[0] = %v, want added with score 1", results[0])
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	idx := NewIndex()
+	idx.Add("a", []float32{3, 4})
+	idx.Add("b", []float32{0, 2})
+
+	var buf bytes.Buffer
+	if err := idx.WriteSnapshot(&buf, "model"); err != nil {
+		t.Fatalf("WriteSnapshot: %v", err)
+	}
+	key, entries, err := ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("ReadSnapshot: %v", err)
+	}
+	if key != "model" || len(entries) != 2 {
+		t.Fatalf("ReadSnapshot = %q, %d entries", key, len(entries))
+	}
+	a := entries["a"]
+	if !a.Unit || a.AsOf == 0 || len(a.Vec) != 2 || a.Vec[0] != 0.6 || a.Vec[1] != 0.8 {
+		t.Errorf("entry a = %+v", a)
+	}
+
+	restored := NewIndex()
+	restored.Restore(entries, map[string][]float32{"c": {1, 1}}, time.Now())
+	if restored.Size() != 3 {
+		t.Errorf("Size() = %d, want 3", restored.Size())
+	}
+	if r := restored.Search([]float32{0, 1}, 1, 0); len(r) != 1 || r[0].ID != "b" {
+		t.Errorf("Search = %v, want b", r)
+	}
+}
+
+func TestReadSnapshotInvalid(t *testing.T) {
+	idx := NewIndex()
+	idx.Add("a", []float32{1, 0})
+	var buf bytes.Buffer
+	idx.WriteSnapshot(&buf, "model")
+
+	for name, data := range map[string][]byte{
+		"empty":     nil,
+		"magic":     []byte("NOTASNAP"),
+		"truncated": buf.Bytes()[:buf.Len()-1],
+	} {
+		if _, _, err := ReadSnapshot(bytes.NewReader(data)); err != ErrBadSnapshot {
+			t.Errorf("%s: err = %v, want ErrBadSnapshot", name, err)
+		}
+	}
+}
+
+func TestDot(t *testing.T) {
+	for n := range 70 {
+		a := make([]float32, n)
+		b := make([]float32, n+3) // longer b is allowed
+		var want float64
+		for i := range a {
+			a[i] = float32(i%7) - 3.5
+			b[i] = float32(i%5) * 0.25
+			want += float64(a[i]) * float64(b[i])
+		}
+		if got := dot(a, b); math.Abs(float64(got)-want) > 1e-3 {
+			t.Errorf("dot(len %d) = %f, want %f", n, got, want)
+		}
+	}
+}
+
+func TestSearchParallel(t *testing.T) {
+	idx := NewIndex()
+	idx.shards = 4
+	idx.vecs = newShards(4)
+	vecs := make(map[string][]float32)
+	for i := 0; i < parallelMin+100; i++ {
+		vecs[fmt.Sprintf("v%d", i)] = []float32{float32(i % 1000), 1000 - float32(i%1000), 1}
+	}
+	vecs["odd"] = []float32{1, 0} // dimension mismatch, skipped
+	idx.Load(vecs)
+	<-idx.normalized
+
+	query := []float32{1, 0, 0}
+	results := idx.Search(query, 5, 0)
+	if len(results) != 5 {
+		t.Fatalf("got %d results, want 5", len(results))
+	}
+	var best float32
+	for id, vec := range vecs {
+		if len(vec) == 3 && id != "odd" {
+			best = max(best, similarity(cosineSimilarity(query, vec)))
+		}
+	}
+	if math.Abs(float64(results[0].Score-best)) > 1e-5 {
+		t.Errorf("best score = %f, want %f", results[0].Score, best)
+	}
+	for i := 1; i < len(results); i++ {
+		if results[i].Score > results[i-1].Score {
+			t.Errorf("results not sorted: %v", results)
+		}
+	}
+
+	if got := idx.Search(query, len(vecs)+10, 0); len(got) != len(vecs)-1 {
+		t.Errorf("k beyond size: got %d results, want %d", len(got), len(vecs)-1)
+	}
+}
+
+func TestQuantizedSearch(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	vecs := make(map[string][]float32)
+	for i := range 500 {
+		v := make([]float32, 64)
+		for j := range v {
+			v[j] = float32(rng.NormFloat64())
+		}
+		vecs[fmt.Sprintf("v%d", i)] = v
+	}
+	query := make([]float32, 64)
+	for j := range query {
+		query[j] = vecs["v42"][j] + 0.2*float32(rng.NormFloat64())
+	}
+	exact := func(ids []string) (map[string][]float32, error) {
+		m := make(map[string][]float32, len(ids))
+		for _, id := range ids {
+			m[id] = vecs[id]
+		}
+		return m, nil
+	}
+
+	for _, quant := range []string{QuantizeInt8, QuantizeBinary} {
+		t.Run(quant, func(t *testing.T) {
+			idx := NewIndexWithConfig(Config{Quantization: quant}, exact)
+			loaded := make(map[string][]float32, len(vecs))
+			for id, v := range vecs {
+				loaded[id] = append([]float32(nil), v...)
+			}
+			idx.Load(loaded)
+			<-idx.normalized
+			idx.Add("added", vecs["v7"])
+
+			for id, e := range idx.vecs.all() {
+				if e.vec != nil {
+					t.Fatalf("%s keeps its float32 vector", id)
+				}
+			}
+
+			results := idx.Search(query, 3, 0)
+			if len(results) != 3 || results[0].ID != "v42" {
+				t.Fatalf("Search = %v, want v42 first", results)
+			}
+			if want := similarity(cosineSimilarity(query, vecs["v42"])); math.Abs(float64(results[0].Score-want)) > 1e-6 {
+				t.Errorf("score = %f, want exact %f", results[0].Score, want)
+			}
+			within := idx.SearchWithin(vecs["v7"], []string{"added", "v1", "v2"}, 1, 0)
+			if len(within) != 1 || within[0].ID != "added" {
+				t.Errorf("SearchWithin = %v, want added", within)
+			}
+			if err := idx.WriteSnapshot(io.Discard, "model"); err != ErrQuantized {
+				t.Errorf("WriteSnapshot err = %v, want ErrQuantized", err)
+			}
+		})
+	}
+}
+
+func TestSearchMinScore(t *testing.T) {
+	idx := NewIndex()
+	idx.Add("same", []float32{1, 0})
+	idx.Add("close", []float32{1, 1})
+	idx.Add("orthogonal", []float32{0, 1})
+	idx.Add("opposite", []float32{-1, 0})
+
+	results := idx.Search([]float32{2, 0}, 10, 0)
+	want := map[string]float32{"same": 1, "close": 0.8535534, "orthogonal": 0.5, "opposite": 0}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for _, r := range results {
+		if math.Abs(float64(r.Score-want[r.ID])) > 1e-6 {
+			t.Errorf("%s score = %f, want %f", r.ID, r.Score, want[r.ID])
+		}
+	}
+
+	results = idx.Search([]float32{2, 0}, 10, 0.6)
+	if len(results) != 2 || results[0].ID != "same" || results[1].ID != "close" {
+		t.Errorf("min_score 0.6 = %v, want same and close", results)
+	}
+	within := idx.SearchWithin([]float32{2, 0}, []string{"close", "orthogonal"}, 10, 0.9)
+	if len(within) != 0 {
+		t.Errorf("SearchWithin min_score 0.9 = %v, want none", within)
+	}
+}
+
+func TestDiversify(t *testing.T) {
+	for _, quant := range []string{"", QuantizeInt8} {
+		idx := NewIndexWithConfig(Config{Quantization: quant}, nil)
+		idx.Add("a1", []float32{1, 0.01, 0})
+		idx.Add("a2", []float32{1, 0.02, 0})
+		idx.Add("a3", []float32{1, 0, 0.01})
+		idx.Add("b", []float32{0.6, 0.8, 0})
+
+		results := idx.Search([]float32{1, 0.1, 0}, 4, 0)
+		if results[3].ID != "b" {
+			t.Fatalf("%q: Search = %v, want b last", quant, results)
+		}
+		if got := idx.Diversify(results, 2, 1); got[0] != results[0] || got[1] != results[1] {
+			t.Errorf("%q: lambda 1 = %v, want the search order", quant, got)
+		}
+		got := idx.Diversify(results, 2, 0.5)
+		if len(got) != 2 || got[0] != results[0] || got[1].ID != "b" {
+			t.Errorf("%q: lambda 0.5 = %v, want %s then b", quant, got, results[0].ID)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package vector
+
+import "log"
+
+// Diversify re-ranks results, best first as Search returns them, by
+// Maximal Marginal Relevance and keeps at most k. Each pick maximizes
+// lambda*score - (1-lambda)*(its highest similarity to a result already
+// picked), so near-duplicates give way to other relevant vectors: lambda 1
+// keeps the ranking, 0 only seeks variety.
+func (idx *Index) Diversify(results []Result, k int, lambda float32) []Result {
+	k = min(k, len(results))
+	if k <= 0 {
+		return nil
+	}
+	units := idx.unitVectors(results)
+
+	picked := make([]Result, 0, k)
+	used := make([]bool, len(results))
+	closest := make([]float32, len(results)) // highest similarity to a pick
+	for len(picked) < k {
+		best := -1
+		var bestValue float32
+		for i, r := range results {
+			if used[i] {
+				continue
+			}
+			if v := lambda*r.Score - (1-lambda)*closest[i]; best < 0 || v > bestValue {
+				best, bestValue = i, v
+			}
+		}
+		used[best] = true
+		picked = append(picked, results[best])
+
+		u := units[best]
+		if u == nil {
+			continue
+		}
+		for i := range results {
+			if !used[i] && len(units[i]) == len(u) {
+				closest[i] = max(closest[i], similarity(dot(units[i], u)))
+			}
+		}
+	}
+	return picked
+}
+
+// unitVectors returns the unit vector of each result, nil where it is not
+// indexed. Quantized vectors are fetched exactly, or else decoded.
+func (idx *Index) unitVectors(results []Result) [][]float32 {
+	units := make([][]float32, len(results))
+	var quantized []int
+	idx.mu.RLock()
+	for i, r := range results {
+		e, ok := idx.vecs.get(r.ID)
+		switch {
+		case !ok:
+		case e.vec == nil:
+			units[i] = e.decode()
+			quantized = append(quantized, i)
+		case e.unit:
+			units[i] = e.vec
+		default:
+			units[i] = normalize(e.vec)
+		}
+	}
+	idx.mu.RUnlock()
+
+	if len(quantized) == 0 || idx.exact == nil {
+		return units
+	}
+	ids := make([]string, len(quantized))
+	for j, i := range quantized {
+		ids[j] = results[i].ID
+	}
+	vecs, err := idx.exact(ids)
+	if err != nil {
+		log.Printf("WARNING: vector search diversification: %v", err)
+		return units
+	}
+	for _, i := range quantized {
+		if vec, ok := vecs[results[i].ID]; ok && len(vec) == len(units[i]) {
+			units[i] = normalize(vec)
+		}
+	}
+	return units
+}
+
+// decode approximates a quantized entry's unit vector.
+func (e entry) decode() []float32 {
+	v := make([]float32, e.dim())
+	switch {
+	case e.codes != nil:
+		for i, c := range e.codes {
+			v[i] = float32(c) * e.scale
+		}
+	case e.bits != nil:
+		for i := range v {
+			if e.bits[i/64]&(1<<(i%64)) != 0 {
+				v[i] = 1
+			} else {
+				v[i] = -1
+			}
+		}
+	}
+	return normalize(v)
+}
@@ -0,0 +1,160 @@
+package vector
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/bits"
+)
+
+// Quantization modes.
+const (
+	// QuantizeInt8 keeps each component as an int8 scaled to the vector's
+	// largest, a quarter of the memory of float32.
+	QuantizeInt8 = "int8"
+	// QuantizeBinary keeps only each component's sign, a 32nd of the memory;
+	// candidates are compared by Hamming distance.
+	QuantizeBinary = "binary"
+)
+
+// Default candidates rescored per requested result, by quantization.
+const (
+	DefaultInt8Oversample   = 4
+	DefaultBinaryOversample = 10
+)
+
+// Config holds vector index settings.
+type Config struct {
+	// Quantization is "int8" or "binary" to keep vectors compressed in
+	// memory, rescoring the best candidates of each search with their exact
+	// vectors from storage; empty keeps full float32 vectors.
+	Quantization string `toml:"quantization"`
+	// Oversample is how many candidates per requested result are rescored
+	// (default 4 for int8, 10 for binary).
+	Oversample int `toml:"oversample"`
+}
+
+// Validate checks the index settings.
+func (c Config) Validate() error {
+	switch c.Quantization {
+	case "", QuantizeInt8, QuantizeBinary:
+	default:
+		return fmt.Errorf("unknown quantization %q: expected int8 or binary", c.Quantization)
+	}
+	if c.Oversample < 0 {
+		return fmt.Errorf("oversample must not be negative")
+	}
+	return nil
+}
+
+func (c Config) oversample() int {
+	switch {
+	case c.Oversample > 0:
+		return c.Oversample
+	case c.Quantization == QuantizeBinary:
+		return DefaultBinaryOversample
+	default:
+		return DefaultInt8Oversample
+	}
+}
+
+// VectorSource fetches the exact vectors of ids, such as from the stored
+// embeddings; ids without one are left out.
+type VectorSource func(ids []string) (map[string][]float32, error)
+
+// unitEntry makes the entry for a unit vector, quantized as configured.
+func (idx *Index) unitEntry(unit []float32, asOf int64) entry {
+	switch idx.quant {
+	case QuantizeInt8:
+		codes, scale := quantizeInt8(unit)
+		return entry{codes: codes, scale: scale, unit: true, asOf: asOf}
+	case QuantizeBinary:
+		return entry{bits: signBits(unit), n: len(unit), unit: true, asOf: asOf}
+	default:
+		return entry{vec: unit, unit: true, asOf: asOf}
+	}
+}
+
+// quantizeInt8 scales v so that its largest component is ±127; the
+// returned scale maps codes back to components.
+func quantizeInt8(v []float32) ([]int8, float32) {
+	var peak float32
+	for _, x := range v {
+		peak = max(peak, float32(math.Abs(float64(x))))
+	}
+	codes := make([]int8, len(v))
+	if peak == 0 {
+		return codes, 0
+	}
+	for i, x := range v {
+		codes[i] = int8(math.Round(float64(x / peak * 127)))
+	}
+	return codes, peak / 127
+}
+
+func signBits(v []float32) []uint64 {
+	b := make([]uint64, (len(v)+63)/64)
+	for i, x := range v {
+		if x > 0 {
+			b[i/64] |= 1 << (i % 64)
+		}
+	}
+	return b
+}
+
+func dotInt8(a, b []int8) int32 {
+	b = b[:len(a)]
+	var s int32
+	for i := range a {
+		s += int32(a[i]) * int32(b[i])
+	}
+	return s
+}
+
+// hammingScore maps the Hamming distance of two sign vectors of n
+// components to [-1, 1], like a cosine.
+func hammingScore(a, b []uint64, n int) float32 {
+	d := 0
+	for i := range a {
+		d += bits.OnesCount64(a[i] ^ b[i])
+	}
+	return 1 - 2*float32(d)/float32(n)
+}
+
+// rescore replaces the approximate scores of candidates with exact ones
+// and keeps the k best scoring at least minScore. Candidates without an
+// exact vector keep their approximate score; if the vectors cannot be
+// fetched, the approximate ranking is used.
+func (idx *Index) rescore(query []float32, candidates []Result, k int, minScore float32) []Result {
+	if idx.exact == nil || len(candidates) == 0 {
+		return atLeast(candidates, k, minScore)
+	}
+	ids := make([]string, len(candidates))
+	for i, r := range candidates {
+		ids[i] = r.ID
+	}
+	vecs, err := idx.exact(ids)
+	if err != nil {
+		log.Printf("WARNING: vector search rescoring: %v", err)
+		return atLeast(candidates, k, minScore)
+	}
+	top := newTopK(k, len(candidates))
+	for _, r := range candidates {
+		if vec, ok := vecs[r.ID]; ok && len(vec) == len(query) {
+			r.Score = similarity(cosineSimilarity(query, vec))
+		}
+		if r.Score >= minScore {
+			top.push(r)
+		}
+	}
+	return top.sorted()
+}
+
+// atLeast returns the first k of sorted results scoring at least minScore.
+func atLeast(results []Result, k int, minScore float32) []Result {
+	n := 0
+	for n < len(results) && n < k && results[n].Score >= minScore {
+		n++
+	}
+	return results[:n]
+}
@@ -0,0 +1,160 @@
+package vector
+
+import (
+	"iter"
+	"sync"
+)
+
+// parallelMin is the index size from which Search scores shards on
+// separate goroutines; below it the goroutines cost more than they save.
+const parallelMin = 8192
+
+// shards partitions the indexed vectors by a hash of their ID, so that a
+// search can score them on several cores at once.
+type shards []map[string]entry
+
+func newShards(n int) shards {
+	s := make(shards, max(n, 1))
+	for i := range s {
+		s[i] = make(map[string]entry)
+	}
+	return s
+}
+
+// of returns the shard holding id.
+func (s shards) of(id string) map[string]entry {
+	// FNV-1a
+	h := uint32(2166136261)
+	for i := 0; i < len(id); i++ {
+		h ^= uint32(id[i])
+		h *= 16777619
+	}
+	return s[h%uint32(len(s))]
+}
+
+func (s shards) get(id string) (entry, bool) {
+	e, ok := s.of(id)[id]
+	return e, ok
+}
+
+func (s shards) set(id string, e entry) {
+	s.of(id)[id] = e
+}
+
+func (s shards) del(id string) {
+	delete(s.of(id), id)
+}
+
+// all iterates over every entry.
+func (s shards) all() iter.Seq2[string, entry] {
+	return func(yield func(string, entry) bool) {
+		for _, shard := range s {
+			for id, e := range shard {
+				if !yield(id, e) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s shards) len() int {
+	n := 0
+	for _, shard := range s {
+		n += len(shard)
+	}
+	return n
+}
+
+// topK keeps the k best results offered to it, in a min-heap on score so
+// that the worst is the one evicted. It never holds more than k, so a
+// search allocates for its results rather than for every vector scored.
+type topK struct {
+	k int
+	h []Result
+}
+
+func newTopK(k, capacity int) *topK {
+	return &topK{k: k, h: make([]Result, 0, min(k, capacity))}
+}
+
+// shardTops recycles the per-shard heaps of parallel searches, which are
+// merged and dropped at the end of each search.
+var shardTops = sync.Pool{New: func() any { return new(topK) }}
+
+// pooledTopK returns an empty topK from shardTops, to give back with
+// release once merged.
+func pooledTopK(k, capacity int) *topK {
+	t := shardTops.Get().(*topK)
+	t.k = k
+	if n := min(k, capacity); cap(t.h) < n {
+		t.h = make([]Result, 0, n)
+	}
+	return t
+}
+
+func (t *topK) release() {
+	clear(t.h) // drop the IDs
+	t.h = t.h[:0]
+	shardTops.Put(t)
+}
+
+func (t *topK) push(r Result) {
+	if len(t.h) < t.k {
+		t.h = append(t.h, r)
+		t.up(len(t.h) - 1)
+		return
+	}
+	if r.Score > t.h[0].Score {
+		t.h[0] = r
+		t.down(0)
+	}
+}
+
+func (t *topK) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if t.h[parent].Score <= t.h[i].Score {
+			return
+		}
+		t.h[parent], t.h[i] = t.h[i], t.h[parent]
+		i = parent
+	}
+}
+
+func (t *topK) down(i int) {
+	for {
+		least := i
+		if l := 2*i + 1; l < len(t.h) && t.h[l].Score < t.h[least].Score {
+			least = l
+		}
+		if r := 2*i + 2; r < len(t.h) && t.h[r].Score < t.h[least].Score {
+			least = r
+		}
+		if least == i {
+			return
+		}
+		t.h[least], t.h[i] = t.h[i], t.h[least]
+		i = least
+	}
+}
+
+// merge offers another topK's results to t.
+func (t *topK) merge(o *topK) {
+	for _, r := range o.h {
+		t.push(r)
+	}
+}
+
+// sorted returns the results, best first, sorting the heap in place.
+func (t *topK) sorted() []Result {
+	// Heapsort: move the worst to the end until the heap is empty
+	results := t.h
+	for n := len(results) - 1; n > 0; n-- {
+		results[0], results[n] = results[n], results[0]
+		t.h = results[:n]
+		t.down(0)
+	}
+	t.h = results
+	return results
+}
@@ -0,0 +1,149 @@
+package vector
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"time"
+)
+
+// snapshotMagic starts every snapshot, naming the format version.
+const snapshotMagic = "MYKBVIX1"
+
+var (
+	// ErrBadSnapshot is returned when a snapshot is truncated or not one.
+	ErrBadSnapshot = errors.New("invalid vector index snapshot")
+	// ErrQuantized is returned when snapshotting a quantized index, which
+	// no longer holds the vectors a snapshot is made of.
+	ErrQuantized = errors.New("quantized vector indexes are not snapshotted")
+)
+
+// SnapshotEntry is a vector read from a snapshot.
+type SnapshotEntry struct {
+	Vec []float32
+	// Unit is set when Vec is already normalized.
+	Unit bool
+	// AsOf is when, in Unix seconds, the vector was known to match its
+	// stored embedding; 0 if it never was.
+	AsOf int64
+}
+
+// WriteSnapshot writes the index's vectors to w, under key (such as the
+// embedding model) for ReadSnapshot to check.
+func (idx *Index) WriteSnapshot(w io.Writer, key string) error {
+	if idx.quant != "" {
+		return ErrQuantized
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	var buf [binary.MaxVarintLen64]byte
+	putUvarint := func(x uint64) { bw.Write(buf[:binary.PutUvarint(buf[:], x)]) }
+
+	bw.WriteString(snapshotMagic)
+	putUvarint(uint64(len(key)))
+	bw.WriteString(key)
+	putUvarint(uint64(idx.vecs.len()))
+	for id, e := range idx.vecs.all() {
+		putUvarint(uint64(len(id)))
+		bw.WriteString(id)
+		bw.Write(buf[:binary.PutVarint(buf[:], e.asOf)])
+		if e.unit {
+			bw.WriteByte(1)
+		} else {
+			bw.WriteByte(0)
+		}
+		putUvarint(uint64(len(e.vec)))
+		for _, x := range e.vec {
+			binary.LittleEndian.PutUint32(buf[:4], math.Float32bits(x))
+			bw.Write(buf[:4])
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadSnapshot reads a snapshot written by WriteSnapshot, returning its key
+// and vectors.
+func ReadSnapshot(r io.Reader) (string, map[string]SnapshotEntry, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != snapshotMagic {
+		return "", nil, ErrBadSnapshot
+	}
+	key, err := readString(br)
+	if err != nil {
+		return "", nil, err
+	}
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return "", nil, ErrBadSnapshot
+	}
+
+	entries := make(map[string]SnapshotEntry, min(n, 1<<20))
+	for range n {
+		id, err := readString(br)
+		if err != nil {
+			return "", nil, err
+		}
+		var e SnapshotEntry
+		if e.AsOf, err = binary.ReadVarint(br); err != nil {
+			return "", nil, ErrBadSnapshot
+		}
+		unit, err := br.ReadByte()
+		if err != nil {
+			return "", nil, ErrBadSnapshot
+		}
+		e.Unit = unit == 1
+		dim, err := binary.ReadUvarint(br)
+		if err != nil || dim > 1<<16 {
+			return "", nil, ErrBadSnapshot
+		}
+		raw := make([]byte, 4*dim)
+		if _, err := io.ReadFull(br, raw); err != nil {
+			return "", nil, ErrBadSnapshot
+		}
+		e.Vec = make([]float32, dim)
+		for i := range e.Vec {
+			e.Vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[4*i:]))
+		}
+		entries[id] = e
+	}
+	return key, entries, nil
+}
+
+func readString(br *bufio.Reader) (string, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil || n > 1<<16 {
+		return "", ErrBadSnapshot
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(br, b); err != nil {
+		return "", ErrBadSnapshot
+	}
+	return string(b), nil
+}
+
+// Restore replaces the index's vectors with entries from a snapshot and
+// fresh vectors, such as those read for ids the snapshot lacked or had out
+// of date. Fresh vectors are known to match their embeddings as of asOf;
+// like Load's, they are normalized (and any quantized) in the background.
+func (idx *Index) Restore(entries map[string]SnapshotEntry, fresh map[string][]float32, asOf time.Time) {
+	vecs := newShards(idx.shards)
+	var ids []string
+	for id, e := range entries {
+		// Unit vectors are normalized again to quantize them
+		unit := e.Unit && idx.quant == ""
+		vecs.set(id, entry{vec: e.Vec, unit: unit, asOf: e.AsOf})
+		if !unit {
+			ids = append(ids, id)
+		}
+	}
+	for id, vec := range fresh {
+		vecs.set(id, entry{vec: vec, asOf: asOf.Unix()})
+		ids = append(ids, id)
+	}
+	idx.replace(vecs, ids)
+}